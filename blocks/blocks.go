@@ -7,12 +7,15 @@ import (
 	"fmt"
 
 	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
 // Block is a singular block of data in ipfs
 type Block struct {
+	// Multihash is the key of the block: a multihash, or the bytes of a
+	// version 1 cid
 	Multihash mh.Multihash
 	Data      []byte
 }
@@ -22,12 +25,35 @@ func NewBlock(data []byte) *Block {
 	return &Block{Data: data, Multihash: u.Hash(data)}
 }
 
+// SumLike keys data as the block key h is made, with the same cid version
+// and codec, hash function and digest length, so that the result equals h
+// if h is the key of data.
+func SumLike(data []byte, h mh.Multihash) (mh.Multihash, error) {
+	p, err := cid.PrefixOf(key.Key(h))
+	if err != nil {
+		return nil, err
+	}
+	return SumPrefix(data, p)
+}
+
+// SumPrefix keys data as prefix p says.
+func SumPrefix(data []byte, p cid.Prefix) (mh.Multihash, error) {
+	c, err := p.Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	return mh.Multihash(c.Key()), nil
+}
+
 // NewBlockWithHash creates a new block when the hash of the data
 // is already known, this is used to save time in situations where
 // we are able to be confident that the data is correct
 func NewBlockWithHash(data []byte, h mh.Multihash) (*Block, error) {
 	if u.Debug {
-		chk := u.Hash(data)
+		chk, err := SumLike(data, h)
+		if err != nil {
+			return nil, err
+		}
 		if string(chk) != string(h) {
 			return nil, errors.New("Data did not match given hash!")
 		}
@@ -1,6 +1,12 @@
 package blocks
 
-import "testing"
+import (
+	"testing"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
+	u "github.com/ipfs/go-ipfs/util"
+)
 
 func TestBlocksBasic(t *testing.T) {
 
@@ -14,3 +20,47 @@ func TestBlocksBasic(t *testing.T) {
 	// Test some data
 	NewBlock([]byte("Hello world!"))
 }
+
+func TestSumLike(t *testing.T) {
+	data := []byte("Hello world!")
+	for _, code := range []int{mh.SHA2_256, u.SHA3_256, u.SHA3_512} {
+		h, err := u.Sum(data, code, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewBlockWithHash(data, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chk, err := SumLike(b.Data, b.Multihash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(chk) != string(h) {
+			t.Fatalf("%s: SumLike hashed differently", mh.Codes[code])
+		}
+	}
+
+	// a digest longer than the function makes
+	h, err := mh.Encode(make([]byte, 40), u.SHA3_256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SumLike(data, h); err == nil {
+		t.Fatal("hashed to a digest longer than sha3-256 makes")
+	}
+
+	// a version 1 key keeps its codec
+	c, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: u.SHA3_224}.Sum(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chk, err := SumLike(data, mh.Multihash(c.Key()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(chk) != string(c.Key()) {
+		t.Fatal("SumLike keyed a cid differently")
+	}
+}
@@ -0,0 +1,157 @@
+package blockstore
+
+import (
+	"container/list"
+	"sync"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+// arc is an adaptive replacement cache of whether blocks are there. It
+// keeps recently seen keys in t1 and keys seen more than once in t2, and
+// remembers the keys recently evicted from each in the ghost lists b1 and
+// b2, adapting p, the share of the cache given to t1, as it finds it
+// evicted the wrong ones.
+//
+// See "ARC: A Self-Tuning, Low Overhead Replacement Cache", Megiddo and
+// Modha, FAST '03.
+type arc struct {
+	lock sync.Mutex
+	size int
+	p    int
+
+	t1, t2, b1, b2 *list.List
+	// elems maps each key to its element, in whichever list it's in
+	elems map[key.Key]*list.Element
+}
+
+type arcEntry struct {
+	key  key.Key
+	has  bool
+	list *list.List
+}
+
+func newARC(size int) *arc {
+	return &arc{
+		size:  size,
+		t1:    list.New(),
+		t2:    list.New(),
+		b1:    list.New(),
+		b2:    list.New(),
+		elems: make(map[key.Key]*list.Element),
+	}
+}
+
+// Get returns whether k is there, if the cache knows.
+func (c *arc) Get(k key.Key) (has bool, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	el, ok := c.elems[k]
+	if !ok {
+		return false, false
+	}
+	e := el.Value.(*arcEntry)
+	if e.list == c.b1 || e.list == c.b2 {
+		return false, false
+	}
+	c.move(el, c.t2)
+	return e.has, true
+}
+
+// Add records whether k is there.
+func (c *arc) Add(k key.Key, has bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if el, ok := c.elems[k]; ok {
+		e := el.Value.(*arcEntry)
+		e.has = has
+		switch e.list {
+		case c.t1, c.t2:
+		case c.b1:
+			// t1 was too small
+			c.p = min(c.size, c.p+max(c.b2.Len()/c.b1.Len(), 1))
+			c.replace(false)
+		case c.b2:
+			// t2 was too small
+			c.p = max(0, c.p-max(c.b1.Len()/c.b2.Len(), 1))
+			c.replace(true)
+		}
+		c.move(el, c.t2)
+		return
+	}
+
+	switch {
+	case c.t1.Len()+c.b1.Len() >= c.size:
+		if c.t1.Len() < c.size {
+			c.drop(c.b1)
+			c.replace(false)
+		} else {
+			c.drop(c.t1)
+		}
+	case c.t1.Len()+c.t2.Len()+c.b1.Len()+c.b2.Len() >= c.size:
+		if c.t1.Len()+c.t2.Len()+c.b1.Len()+c.b2.Len() >= 2*c.size {
+			c.drop(c.b2)
+		}
+		c.replace(false)
+	}
+	e := &arcEntry{key: k, has: has, list: c.t1}
+	c.elems[k] = c.t1.PushFront(e)
+}
+
+// Remove forgets k.
+func (c *arc) Remove(k key.Key) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if el, ok := c.elems[k]; ok {
+		el.Value.(*arcEntry).list.Remove(el)
+		delete(c.elems, k)
+	}
+}
+
+// replace makes room in the cache, if it's full, moving the least recently
+// used key of t1 or t2 to its ghost list.
+func (c *arc) replace(inB2 bool) {
+	if c.t1.Len()+c.t2.Len() < c.size {
+		return
+	}
+	if c.t1.Len() > 0 && (c.t1.Len() > c.p || (inB2 && c.t1.Len() == c.p)) {
+		c.move(c.t1.Back(), c.b1)
+	} else if c.t2.Len() > 0 {
+		c.move(c.t2.Back(), c.b2)
+	} else {
+		c.move(c.t1.Back(), c.b1)
+	}
+}
+
+// move makes el the most recently used of l.
+func (c *arc) move(el *list.Element, l *list.List) {
+	e := el.Value.(*arcEntry)
+	e.list.Remove(el)
+	e.list = l
+	c.elems[e.key] = l.PushFront(e)
+}
+
+// drop forgets the least recently used key of l.
+func (c *arc) drop(l *list.List) {
+	el := l.Back()
+	if el == nil {
+		return
+	}
+	l.Remove(el)
+	delete(c.elems, el.Value.(*arcEntry).key)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -29,15 +29,26 @@ type Blockstore interface {
 	DeleteBlock(key.Key) error
 	Has(key.Key) (bool, error)
 	Get(key.Key) (*blocks.Block, error)
+	// GetSize returns the size of the data of the block of k, without
+	// reading it where the datastore can tell.
+	GetSize(key.Key) (int, error)
 	Put(*blocks.Block) error
 
 	AllKeysChan(ctx context.Context) (<-chan key.Key, error)
 }
 
+// Sizer is a datastore which tells the size of a value without reading
+// it, such as from the file it's kept in.
+type Sizer interface {
+	GetSize(ds.Key) (int, error)
+}
+
 func NewBlockstore(d ds.ThreadSafeDatastore) Blockstore {
 	dd := dsns.Wrap(d, BlockPrefix)
+	sizer, _ := d.(Sizer)
 	return &blockstore{
 		datastore: dd,
+		sizer:     sizer,
 	}
 }
 
@@ -45,6 +56,9 @@ type blockstore struct {
 	datastore ds.Datastore
 	// cant be ThreadSafeDatastore cause namespace.Datastore doesnt support it.
 	// we do check it on `NewBlockstore` though.
+
+	// sizer is the datastore, if it's a Sizer. It isn't namespaced.
+	sizer Sizer
 }
 
 func (bs *blockstore) Get(k key.Key) (*blocks.Block, error) {
@@ -63,6 +77,21 @@ func (bs *blockstore) Get(k key.Key) (*blocks.Block, error) {
 	return blocks.NewBlockWithHash(bdata, mh.Multihash(k))
 }
 
+func (bs *blockstore) GetSize(k key.Key) (int, error) {
+	if bs.sizer == nil {
+		b, err := bs.Get(k)
+		if err != nil {
+			return 0, err
+		}
+		return len(b.Data), nil
+	}
+	size, err := bs.sizer.GetSize(BlockPrefix.Child(k.DsKey()))
+	if err == ds.ErrNotFound {
+		return 0, ErrNotFound
+	}
+	return size, err
+}
+
 func (bs *blockstore) Put(block *blocks.Block) error {
 	k := block.Key().DsKey()
 
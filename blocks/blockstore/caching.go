@@ -0,0 +1,212 @@
+package blockstore
+
+import (
+	"sync"
+	"sync/atomic"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/ipfs/go-ipfs/blocks"
+	bloom "github.com/ipfs/go-ipfs/blocks/bloom"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+// CacheOpts sizes the caches CachedBlockstore puts in front of a
+// blockstore. A size of zero or less disables that cache.
+type CacheOpts struct {
+	// HasARCCacheSize is how many keys the cache remembers being there,
+	// or not.
+	HasARCCacheSize int
+	// HasBloomFilterSize is the size in bytes of a bloom filter of the keys
+	// in the blockstore, which answers most lookups of keys that aren't.
+	HasBloomFilterSize int
+}
+
+func DefaultCacheOpts() CacheOpts {
+	return CacheOpts{
+		HasARCCacheSize:    64 * 1024,
+		HasBloomFilterSize: 512 * 1024,
+	}
+}
+
+// CacheStats counts how lookups of a cached blockstore were answered.
+type CacheStats struct {
+	// Hits were answered by the ARC cache, and BloomNegatives by the bloom
+	// filter, finding the key isn't there. Misses went to the blockstore.
+	Hits           uint64
+	BloomNegatives uint64
+	Misses         uint64
+
+	// BloomReady is set once the bloom filter holds all the keys in the
+	// blockstore; until then, it isn't consulted.
+	BloomReady bool
+}
+
+// CacheStatser is implemented by the blockstores CachedBlockstore returns.
+type CacheStatser interface {
+	CacheStats() CacheStats
+}
+
+// CachedBlockstore returns a blockstore answering Has, and Get of missing
+// blocks, from memory where it can. The bloom filter is filled with the
+// keys of bs in the background, until ctx is done, and only answers Has:
+// were the filling to miss keys, Get would lose blocks, where Has only
+// makes them fetched again. If both caches are disabled, bs is returned
+// as is.
+func CachedBlockstore(ctx context.Context, bs Blockstore, opts CacheOpts) Blockstore {
+	if opts.HasARCCacheSize <= 0 && opts.HasBloomFilterSize <= 0 {
+		return bs
+	}
+	c := &cachedbs{blockstore: bs}
+	if opts.HasARCCacheSize > 0 {
+		c.arc = newARC(opts.HasARCCacheSize)
+	}
+	if opts.HasBloomFilterSize > 0 {
+		c.bloom = bloom.NewFilter(opts.HasBloomFilterSize)
+		go c.fillBloom(ctx)
+	}
+	return c
+}
+
+type cachedbs struct {
+	blockstore Blockstore
+	arc        *arc
+
+	// the filter isn't safe for concurrent use
+	bloomLock  sync.Mutex
+	bloom      bloom.Filter
+	bloomReady int32
+
+	hits, bloomNegatives, misses uint64
+}
+
+func (c *cachedbs) fillBloom(ctx context.Context) {
+	keys, err := c.blockstore.AllKeysChan(ctx)
+	if err != nil {
+		log.Debugf("filling the blockstore bloom filter: %s", err)
+		return
+	}
+	for k := range keys {
+		c.addBloom(k)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	atomic.StoreInt32(&c.bloomReady, 1)
+}
+
+func (c *cachedbs) addBloom(k key.Key) {
+	if c.bloom == nil {
+		return
+	}
+	c.bloomLock.Lock()
+	defer c.bloomLock.Unlock()
+	c.bloom.Add([]byte(k))
+}
+
+// cached returns whether k is there, if it's known without asking the
+// blockstore, consulting the bloom filter if useBloom is set.
+func (c *cachedbs) cached(k key.Key, useBloom bool) (has bool, ok bool) {
+	if c.arc != nil {
+		if has, ok := c.arc.Get(k); ok {
+			atomic.AddUint64(&c.hits, 1)
+			return has, true
+		}
+	}
+	if useBloom && c.bloom != nil && atomic.LoadInt32(&c.bloomReady) == 1 && listable(k) {
+		c.bloomLock.Lock()
+		found := c.bloom.Find([]byte(k))
+		c.bloomLock.Unlock()
+		if !found {
+			atomic.AddUint64(&c.bloomNegatives, 1)
+			return false, true
+		}
+	}
+	atomic.AddUint64(&c.misses, 1)
+	return false, false
+}
+
+// listable reports whether AllKeysChan lists k, and so whether the bloom
+// filter can tell it's missing: keys that aren't clean paths, such as ones
+// ending in a '/', are stored under a cleaned key, which isn't theirs.
+func listable(k key.Key) bool {
+	return key.KeyFromDsKey(k.DsKey()) == k
+}
+
+func (c *cachedbs) record(k key.Key, has bool) {
+	if c.arc != nil {
+		c.arc.Add(k, has)
+	}
+}
+
+func (c *cachedbs) DeleteBlock(k key.Key) error {
+	err := c.blockstore.DeleteBlock(k)
+	if c.arc != nil {
+		// a failed delete may still have removed it
+		c.arc.Remove(k)
+	}
+	if err == nil {
+		c.record(k, false)
+	}
+	return err
+}
+
+func (c *cachedbs) Has(k key.Key) (bool, error) {
+	if has, ok := c.cached(k, true); ok {
+		return has, nil
+	}
+	has, err := c.blockstore.Has(k)
+	if err != nil {
+		return false, err
+	}
+	c.record(k, has)
+	return has, nil
+}
+
+func (c *cachedbs) Get(k key.Key) (*blocks.Block, error) {
+	if has, ok := c.cached(k, false); ok && !has {
+		return nil, ErrNotFound
+	}
+	b, err := c.blockstore.Get(k)
+	switch err {
+	case nil:
+		c.record(k, true)
+	case ErrNotFound:
+		c.record(k, false)
+	}
+	return b, err
+}
+
+func (c *cachedbs) GetSize(k key.Key) (int, error) {
+	if has, ok := c.cached(k, false); ok && !has {
+		return 0, ErrNotFound
+	}
+	return c.blockstore.GetSize(k)
+}
+
+func (c *cachedbs) Put(b *blocks.Block) error {
+	k := b.Key()
+	if c.arc != nil {
+		if has, ok := c.arc.Get(k); ok && has {
+			return nil
+		}
+	}
+	if err := c.blockstore.Put(b); err != nil {
+		return err
+	}
+	c.addBloom(k)
+	c.record(k, true)
+	return nil
+}
+
+func (c *cachedbs) AllKeysChan(ctx context.Context) (<-chan key.Key, error) {
+	return c.blockstore.AllKeysChan(ctx)
+}
+
+func (c *cachedbs) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:           atomic.LoadUint64(&c.hits),
+		BloomNegatives: atomic.LoadUint64(&c.bloomNegatives),
+		Misses:         atomic.LoadUint64(&c.misses),
+		BloomReady:     atomic.LoadInt32(&c.bloomReady) == 1,
+	}
+}
@@ -0,0 +1,123 @@
+package blockstore
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	syncds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+func TestARC(t *testing.T) {
+	c := newARC(4)
+	for i := 0; i < 4; i++ {
+		c.Add(key.Key(fmt.Sprint(i)), i%2 == 0)
+	}
+	for i := 0; i < 4; i++ {
+		has, ok := c.Get(key.Key(fmt.Sprint(i)))
+		if !ok || has != (i%2 == 0) {
+			t.Fatalf("key %d: got %t %t", i, has, ok)
+		}
+	}
+
+	// all four were seen twice; a run of new keys mustn't flush them
+	for i := 4; i < 20; i++ {
+		c.Add(key.Key(fmt.Sprint(i)), true)
+	}
+	kept := 0
+	for i := 0; i < 4; i++ {
+		if _, ok := c.Get(key.Key(fmt.Sprint(i))); ok {
+			kept++
+		}
+	}
+	if kept == 0 {
+		t.Fatal("a scan flushed the frequently used keys")
+	}
+	if n := c.t1.Len() + c.t2.Len(); n > 4 {
+		t.Fatalf("cache holds %d keys, more than its size", n)
+	}
+	if n := c.t1.Len() + c.t2.Len() + c.b1.Len() + c.b2.Len(); n > 8 {
+		t.Fatalf("cache remembers %d keys, more than twice its size", n)
+	}
+
+	c.Remove("0")
+	if _, ok := c.Get("0"); ok {
+		t.Fatal("removed key still cached")
+	}
+}
+
+func TestCachedBlockstore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cd := &callbackDatastore{f: func() {}, ds: ds.NewMapDatastore()}
+	bs := NewBlockstore(syncds.MutexWrap(cd))
+	old := blocks.NewBlock([]byte("already there"))
+	listed := blocks.NewBlock([]byte("listed"))
+	for _, b := range []*blocks.Block{old, listed} {
+		if err := bs.Put(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cbs := CachedBlockstore(ctx, bs, CacheOpts{HasARCCacheSize: 16, HasBloomFilterSize: 1024})
+	cs := cbs.(CacheStatser)
+	for !cs.CacheStats().BloomReady {
+		time.Sleep(time.Millisecond)
+	}
+
+	b := blocks.NewBlock([]byte("foo"))
+	missing := blocks.NewBlock([]byte("missing"))
+	cd.SetFunc(func() { t.Fatal("lookup of a missing block hit the datastore") })
+	if has, err := cbs.Has(missing.Key()); err != nil || has {
+		t.Fatalf("missing block: %t %v", has, err)
+	}
+	if stats := cs.CacheStats(); stats.BloomNegatives != 1 {
+		t.Fatalf("expected a bloom negative, got %+v", stats)
+	}
+
+	cd.SetFunc(func() {})
+	if err := cbs.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	// its key ends in a '/', so it isn't listed, but is still found
+	if listable(old.Key()) {
+		t.Fatal("expected a key AllKeysChan doesn't list")
+	}
+	if has, err := cbs.Has(old.Key()); err != nil || !has {
+		t.Fatalf("block put before caching: %t %v", has, err)
+	}
+	if has, err := cbs.Has(listed.Key()); err != nil || !has {
+		t.Fatalf("block listed into the bloom filter: %t %v", has, err)
+	}
+
+	cd.SetFunc(func() { t.Fatal("lookup of a cached block hit the datastore") })
+	for _, k := range []key.Key{b.Key(), old.Key()} {
+		if has, err := cbs.Has(k); err != nil || !has {
+			t.Fatalf("cached block: %t %v", has, err)
+		}
+	}
+	if stats := cs.CacheStats(); stats.Hits != 2 || stats.Misses != 2 {
+		t.Fatalf("expected 2 hits and 2 misses, got %+v", stats)
+	}
+
+	cd.SetFunc(func() {})
+	if err := cbs.DeleteBlock(b.Key()); err != nil {
+		t.Fatal(err)
+	}
+	cd.SetFunc(func() { t.Fatal("lookup of a deleted block hit the datastore") })
+	if _, err := cbs.Get(b.Key()); err != ErrNotFound {
+		t.Fatalf("deleted block: %v", err)
+	}
+}
+
+func TestCachedBlockstoreDisabled(t *testing.T) {
+	bs := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	if CachedBlockstore(context.Background(), bs, CacheOpts{}) != bs {
+		t.Fatal("disabled caches should leave the blockstore as is")
+	}
+}
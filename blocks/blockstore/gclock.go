@@ -0,0 +1,26 @@
+package blockstore
+
+import "sync"
+
+// GCLocker keeps garbage collection from removing the blocks of what is
+// being pinned. The removal of blocks which aren't pinned takes the gc
+// lock, and the adding and pinning of blocks takes a pin lock, until
+// they're pinned. Any number of pin locks may be held at once, but none
+// while the gc lock is. The zero GCLocker is ready to use.
+type GCLocker struct {
+	mx sync.RWMutex
+}
+
+// GCLock waits for the pin locks held to be released, and takes the gc
+// lock, until the func returned is called.
+func (l *GCLocker) GCLock() func() {
+	l.mx.Lock()
+	return l.mx.Unlock
+}
+
+// PinLock waits for the gc lock to be released, and takes a pin lock,
+// until the func returned is called.
+func (l *GCLocker) PinLock() func() {
+	l.mx.RLock()
+	return l.mx.RUnlock
+}
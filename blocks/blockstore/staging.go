@@ -0,0 +1,254 @@
+package blockstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dsns "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/namespace"
+	dsq "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+// StagingPrefix is where the staging areas keep their blocks in the
+// datastore, each under a key space of its own.
+var StagingPrefix = ds.NewKey("/local/staging")
+
+// liveStaging holds the ids of the staging areas of this process, which
+// DiscardAbandoned leaves.
+var liveStaging = struct {
+	sync.Mutex
+	ids map[string]bool
+}{ids: make(map[string]bool)}
+
+// Staging is a Blockstore keeping the blocks put in it apart from those of
+// the blockstore it stages for, until they are all committed to it, or
+// discarded. The blocks staged read as if they were in the blockstore.
+type Staging struct {
+	id      string
+	staged  ds.Datastore
+	backing Blockstore
+
+	mx   sync.Mutex
+	keys map[key.Key]struct{}
+}
+
+// NewStaging returns a staging area for bs, keeping its blocks in d, in a
+// key space under StagingPrefix.
+func NewStaging(d ds.Datastore, bs Blockstore) (*Staging, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(buf)
+
+	liveStaging.Lock()
+	liveStaging.ids[id] = true
+	liveStaging.Unlock()
+
+	return &Staging{
+		id:      id,
+		staged:  dsns.Wrap(d, StagingPrefix.ChildString(id)),
+		backing: bs,
+		keys:    make(map[key.Key]struct{}),
+	}, nil
+}
+
+func (s *Staging) isStaged(k key.Key) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	_, ok := s.keys[k]
+	return ok
+}
+
+// Put stages b, unless the blockstore has it already.
+func (s *Staging) Put(b *blocks.Block) error {
+	k := b.Key()
+	if s.isStaged(k) {
+		return nil
+	}
+	if has, err := s.backing.Has(k); err == nil && has {
+		return nil
+	}
+	if err := s.staged.Put(k.DsKey(), b.Data); err != nil {
+		return err
+	}
+
+	s.mx.Lock()
+	s.keys[k] = struct{}{}
+	s.mx.Unlock()
+	return nil
+}
+
+func (s *Staging) Get(k key.Key) (*blocks.Block, error) {
+	if !s.isStaged(k) {
+		return s.backing.Get(k)
+	}
+	v, err := s.staged.Get(k.DsKey())
+	if err == ds.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, ok := v.([]byte)
+	if !ok {
+		return nil, ValueTypeMismatch
+	}
+	return blocks.NewBlockWithHash(data, mh.Multihash(k))
+}
+
+func (s *Staging) GetSize(k key.Key) (int, error) {
+	if !s.isStaged(k) {
+		return s.backing.GetSize(k)
+	}
+	b, err := s.Get(k)
+	if err != nil {
+		return 0, err
+	}
+	return len(b.Data), nil
+}
+
+func (s *Staging) Has(k key.Key) (bool, error) {
+	if s.isStaged(k) {
+		return true, nil
+	}
+	return s.backing.Has(k)
+}
+
+// DeleteBlock removes a block staged. Those of the blockstore are left.
+func (s *Staging) DeleteBlock(k key.Key) error {
+	if !s.isStaged(k) {
+		return ErrNotFound
+	}
+	if err := s.staged.Delete(k.DsKey()); err != nil {
+		return err
+	}
+
+	s.mx.Lock()
+	delete(s.keys, k)
+	s.mx.Unlock()
+	return nil
+}
+
+// AllKeysChan returns the keys of the blocks staged.
+func (s *Staging) AllKeysChan(ctx context.Context) (<-chan key.Key, error) {
+	keys := s.stagedKeys()
+	output := make(chan key.Key)
+	go func() {
+		defer close(output)
+		for _, k := range keys {
+			select {
+			case output <- k:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return output, nil
+}
+
+func (s *Staging) stagedKeys() []key.Key {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	keys := make([]key.Key, 0, len(s.keys))
+	for k := range s.keys {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Commit puts each block staged with put, which puts it in the
+// blockstore, and then discards the staging area. If one fails, the blocks
+// put so far are removed from the blockstore again, those it had already
+// left alone, and the blocks are left staged for the caller to discard.
+func (s *Staging) Commit(put func(*blocks.Block) error) (err error) {
+	var added []key.Key
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, k := range added {
+			if derr := s.backing.DeleteBlock(k); derr != nil {
+				log.Errorf("failed to remove %s after the commit of its staging area failed: %s", k, derr)
+			}
+		}
+	}()
+
+	keys := s.stagedKeys()
+	for _, k := range keys {
+		b, err := s.Get(k)
+		if err != nil {
+			return err
+		}
+		has, err := s.backing.Has(k)
+		if err != nil {
+			return err
+		}
+		if has {
+			continue
+		}
+		if err := put(b); err != nil {
+			return err
+		}
+		added = append(added, k)
+	}
+	return s.Discard()
+}
+
+// Discard removes the blocks staged, leaving the staging area empty, and
+// no longer live.
+func (s *Staging) Discard() error {
+	defer func() {
+		liveStaging.Lock()
+		delete(liveStaging.ids, s.id)
+		liveStaging.Unlock()
+	}()
+
+	for _, k := range s.stagedKeys() {
+		if err := s.DeleteBlock(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DiscardAbandoned removes the blocks of the staging areas of d which this
+// process has not got open, left by those interrupted before committing or
+// discarding their blocks. It returns how many were removed.
+func DiscardAbandoned(d ds.Datastore) (int, error) {
+	res, err := d.Query(dsq.Query{Prefix: StagingPrefix.String(), KeysOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	depth := len(StagingPrefix.Namespaces())
+	for _, e := range entries {
+		k := ds.NewKey(e.Key)
+		ns := k.Namespaces()
+		if !StagingPrefix.IsAncestorOf(k) || len(ns) <= depth {
+			continue
+		}
+
+		liveStaging.Lock()
+		live := liveStaging.ids[ns[depth]]
+		liveStaging.Unlock()
+		if live {
+			continue
+		}
+		if err := d.Delete(k); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
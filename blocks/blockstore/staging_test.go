@@ -0,0 +1,165 @@
+package blockstore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dsq "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+	syncds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+func TestStagingCommit(t *testing.T) {
+	d := syncds.MutexWrap(ds.NewMapDatastore())
+	bs := NewBlockstore(d)
+	s, err := NewStaging(d, bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := blocks.NewBlock([]byte("staged"))
+	if err := s.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := bs.Has(b.Key()); has {
+		t.Fatal("expected the block staged to be kept out of the blockstore")
+	}
+	if got, err := s.Get(b.Key()); err != nil || string(got.Data) != "staged" {
+		t.Fatalf("expected the block staged to be read back: %v", err)
+	}
+
+	if err := s.Commit(bs.Put); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := bs.Has(b.Key()); !has {
+		t.Fatal("expected the block committed to be in the blockstore")
+	}
+	if n := countStaged(t, d); n != 0 {
+		t.Fatalf("expected nothing left staged, got %d", n)
+	}
+}
+
+func TestStagingCommitFail(t *testing.T) {
+	d := syncds.MutexWrap(ds.NewMapDatastore())
+	bs := NewBlockstore(d)
+	s, err := NewStaging(d, bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a block the blockstore has already must be left in it
+	had := blocks.NewBlock([]byte("had"))
+	if err := bs.Put(had); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := s.Put(blocks.NewBlock([]byte(fmt.Sprintf("staged %d", i)))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.mx.Lock()
+	s.keys[had.Key()] = struct{}{}
+	s.mx.Unlock()
+	if err := s.staged.Put(had.Key().DsKey(), had.Data); err != nil {
+		t.Fatal(err)
+	}
+
+	// the disk fills up at the fifth block
+	full := errors.New("disk full")
+	puts := 0
+	err = s.Commit(func(b *blocks.Block) error {
+		if puts == 4 {
+			return full
+		}
+		puts++
+		return bs.Put(b)
+	})
+	if err != full {
+		t.Fatal("expected the commit to fail, got", err)
+	}
+
+	keys, err := bs.AllKeysChan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []key.Key
+	for k := range keys {
+		left = append(left, k)
+	}
+	if len(left) != 1 || left[0] != had.Key() {
+		t.Fatalf("expected the blocks committed to be removed, got %d left", len(left))
+	}
+	if n := countStaged(t, d); n != 11 {
+		t.Fatalf("expected the blocks left staged, got %d", n)
+	}
+	if err := s.Discard(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStagingDiscard(t *testing.T) {
+	d := syncds.MutexWrap(ds.NewMapDatastore())
+	bs := NewBlockstore(d)
+	s, err := NewStaging(d, bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := blocks.NewBlock([]byte("discarded"))
+	if err := s.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Discard(); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := s.Has(b.Key()); has {
+		t.Fatal("expected the block discarded to be gone")
+	}
+	if n := countStaged(t, d); n != 0 {
+		t.Fatalf("expected nothing left staged, got %d", n)
+	}
+}
+
+func TestDiscardAbandoned(t *testing.T) {
+	d := syncds.MutexWrap(ds.NewMapDatastore())
+	bs := NewBlockstore(d)
+
+	// a staging area of an interrupted process
+	if err := d.Put(StagingPrefix.ChildString("abandoned").ChildString("somekey"), []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStaging(d, bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(blocks.NewBlock([]byte("live"))); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := DiscardAbandoned(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected the abandoned block removed, got %d", removed)
+	}
+	if n := countStaged(t, d); n != 1 {
+		t.Fatalf("expected the live staging area left, got %d blocks staged", n)
+	}
+}
+
+func countStaged(t *testing.T, d ds.Datastore) int {
+	res, err := d.Query(dsq.Query{Prefix: StagingPrefix.String(), KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
@@ -0,0 +1,188 @@
+// Package cid implements version 1 content identifiers, keys that name
+// the codec of the data they identify along with its multihash.
+//
+// A version 0 identifier is a bare multihash, the key of every block
+// before there were codecs; its data is a merkledag node or an ipld
+// object. A version 1 identifier is the varint version 1, the varint
+// codec, and the multihash. Both are used as block keys as they are, so
+// that old keys stay valid.
+package cid
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// Codecs of the data identifiers identify.
+const (
+	Raw         = 0x55
+	DagProtobuf = 0x70
+	DagCBOR     = 0x71
+)
+
+// Codecs maps the name of a codec to its code.
+var Codecs = map[string]uint64{
+	"raw":      Raw,
+	"dag-pb":   DagProtobuf,
+	"dag-cbor": DagCBOR,
+}
+
+// CodecNames maps the code of a codec to its name.
+var CodecNames = map[uint64]string{
+	Raw:         "raw",
+	DagProtobuf: "dag-pb",
+	DagCBOR:     "dag-cbor",
+}
+
+// ErrUnknownCodec is returned for identifiers of a codec not in Codecs.
+var ErrUnknownCodec = errors.New("unknown cid codec")
+
+// Cid is a content identifier.
+type Cid struct {
+	Version uint64
+	// Codec is DagProtobuf for version 0 identifiers, which name none
+	Codec uint64
+	Hash  mh.Multihash
+}
+
+// NewV1 returns the version 1 identifier of data of codec hashing to h.
+func NewV1(codec uint64, h mh.Multihash) *Cid {
+	return &Cid{Version: 1, Codec: codec, Hash: h}
+}
+
+// Cast decodes the identifier k is the bytes of.
+func Cast(k key.Key) (*Cid, error) {
+	b := []byte(k)
+	if len(b) == 0 || b[0] != 1 {
+		h, err := mh.Cast(b)
+		if err != nil {
+			return nil, err
+		}
+		return &Cid{Version: 0, Codec: DagProtobuf, Hash: h}, nil
+	}
+
+	b = b[1:]
+	codec, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, errors.New("invalid cid: bad codec varint")
+	}
+	if _, ok := CodecNames[codec]; !ok {
+		return nil, ErrUnknownCodec
+	}
+	h, err := mh.Cast(b[n:])
+	if err != nil {
+		return nil, err
+	}
+	return NewV1(codec, h), nil
+}
+
+// Parse decodes the identifier s is the string of: the b58 multihash of a
+// version 0 one, or a 'z' and the b58 bytes of a version 1 one.
+func Parse(s string) (*Cid, error) {
+	k := key.B58KeyDecode(s)
+	if k == "" {
+		return nil, fmt.Errorf("invalid cid %q: not base58", s)
+	}
+	c, err := Cast(k)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cid %q: %s", s, err)
+	}
+	return c, nil
+}
+
+// Key returns the block key of c: its multihash for version 0, and its
+// bytes for version 1.
+func (c *Cid) Key() key.Key {
+	if c.Version == 0 {
+		return key.Key(c.Hash)
+	}
+	buf := make([]byte, 1+2*binary.MaxVarintLen64+len(c.Hash))
+	buf[0] = 1
+	n := 1 + binary.PutUvarint(buf[1:], c.Codec)
+	n += copy(buf[n:], c.Hash)
+	return key.Key(buf[:n])
+}
+
+func (c *Cid) String() string {
+	return c.Key().B58String()
+}
+
+// Prefix returns how c is made, without its digest.
+func (c *Cid) Prefix() Prefix {
+	dh, _ := mh.Decode(c.Hash)
+	return Prefix{
+		Version:  c.Version,
+		Codec:    c.Codec,
+		MhType:   dh.Code,
+		MhLength: dh.Length,
+	}
+}
+
+// Prefix is how an identifier is made: the version and the codec, the
+// multihash function and the length of its digest.
+type Prefix struct {
+	Version  uint64
+	Codec    uint64
+	MhType   int
+	MhLength int
+}
+
+// V0Prefix is the prefix of the keys blocks get by default.
+var V0Prefix = Prefix{Version: 0, Codec: DagProtobuf, MhType: mh.SHA2_256, MhLength: 32}
+
+// PrefixOf returns how k is made.
+func PrefixOf(k key.Key) (Prefix, error) {
+	c, err := Cast(k)
+	if err != nil {
+		return Prefix{}, err
+	}
+	return c.Prefix(), nil
+}
+
+// Sum returns the identifier of data made as p is.
+func (p Prefix) Sum(data []byte) (*Cid, error) {
+	length := p.MhLength
+	if length == 0 {
+		length = -1
+	}
+	h, err := u.Sum(data, p.MhType, length)
+	if err != nil {
+		return nil, err
+	}
+	return &Cid{Version: p.Version, Codec: p.Codec, Hash: h}, nil
+}
+
+// Bytes encodes p as four varints: version, codec, multihash code and
+// digest length.
+func (p Prefix) Bytes() []byte {
+	buf := make([]byte, 4*binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, p.Version)
+	n += binary.PutUvarint(buf[n:], p.Codec)
+	n += binary.PutUvarint(buf[n:], uint64(p.MhType))
+	n += binary.PutUvarint(buf[n:], uint64(p.MhLength))
+	return buf[:n]
+}
+
+// PrefixFromBytes decodes a prefix encoded with Bytes.
+func PrefixFromBytes(b []byte) (Prefix, error) {
+	var vals [4]uint64
+	for i := range vals {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return Prefix{}, errors.New("invalid cid prefix")
+		}
+		vals[i] = v
+		b = b[n:]
+	}
+	return Prefix{
+		Version:  vals[0],
+		Codec:    vals[1],
+		MhType:   int(vals[2]),
+		MhLength: int(vals[3]),
+	}, nil
+}
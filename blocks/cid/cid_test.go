@@ -0,0 +1,71 @@
+package cid
+
+import (
+	"testing"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := []byte("hello cid")
+	for _, p := range []Prefix{
+		V0Prefix,
+		{Version: 0, Codec: DagProtobuf, MhType: u.SHA3_256, MhLength: 32},
+		{Version: 1, Codec: Raw, MhType: mh.SHA2_256, MhLength: 32},
+		{Version: 1, Codec: DagCBOR, MhType: u.SHA3_512, MhLength: 20},
+	} {
+		c, err := p.Sum(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := c.String()
+		if (p.Version == 1) != (s[0] == 'z') {
+			t.Fatalf("%v: unexpected string %s", p, s)
+		}
+
+		parsed, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Key() != c.Key() {
+			t.Fatalf("%v: %s parsed to a different key", p, s)
+		}
+		if parsed.Prefix() != p {
+			t.Fatalf("%v: parsed with prefix %v", p, parsed.Prefix())
+		}
+
+		q, err := PrefixFromBytes(p.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q != p {
+			t.Fatalf("%v: prefix decoded as %v", p, q)
+		}
+	}
+}
+
+func TestV0IsMultihash(t *testing.T) {
+	h := u.Hash([]byte("beep"))
+	c, err := Cast(key.Key(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 0 || c.Key() != key.Key(h) || c.String() != h.B58String() {
+		t.Fatal("a multihash is not its own version 0 cid")
+	}
+}
+
+func TestCastInvalid(t *testing.T) {
+	h := u.Hash([]byte("beep"))
+	for name, k := range map[string]key.Key{
+		"empty":         "",
+		"unknown codec": key.Key(append([]byte{1, 0x7f}, h...)),
+		"bad multihash": key.Key([]byte{1, Raw, 0x12, 0x20, 1}),
+	} {
+		if _, err := Cast(k); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
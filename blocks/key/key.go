@@ -32,13 +32,28 @@ func (k Key) B58String() string {
 	return B58KeyEncode(k)
 }
 
+// cidV1 is the first byte of the keys that are version 1 content
+// identifiers, rather than bare multihashes. Their b58 strings start with
+// a 'z', the multibase prefix of base58btc.
+const cidV1 = 0x01
+
 // B58KeyDecode returns Key from a b58 encoded string
 func B58KeyDecode(s string) Key {
+	if len(s) > 1 && s[0] == 'z' {
+		if b := b58.Decode(s[1:]); len(b) > 0 && b[0] == cidV1 {
+			if _, err := mh.Cast(b58.Decode(s)); err != nil {
+				return Key(string(b))
+			}
+		}
+	}
 	return Key(string(b58.Decode(s)))
 }
 
 // B58KeyEncode returns Key in a b58 encoded string
 func B58KeyEncode(k Key) string {
+	if len(k) > 0 && k[0] == cidV1 {
+		return "z" + b58.Encode([]byte(k))
+	}
 	return b58.Encode([]byte(k))
 }
 
@@ -55,7 +70,7 @@ func (k *Key) UnmarshalJSON(mk []byte) error {
 		return err
 	}
 
-	*k = Key(string(b58.Decode(s)))
+	*k = B58KeyDecode(s)
 	if len(*k) == 0 && len(s) > 2 { // if b58.Decode fails, k == ""
 		return fmt.Errorf("Key.UnmarshalJSON: invalid b58 string: %v", mk)
 	}
@@ -64,7 +79,7 @@ func (k *Key) UnmarshalJSON(mk []byte) error {
 
 // MarshalJSON returns a JSON-encoded Key (string)
 func (k *Key) MarshalJSON() ([]byte, error) {
-	return json.Marshal(b58.Encode([]byte(*k)))
+	return json.Marshal(B58KeyEncode(*k))
 }
 
 func (k *Key) Loggable() map[string]interface{} {
@@ -0,0 +1,229 @@
+/*
+Package client is a Go client of the HTTP API of the ipfs daemon.
+
+Its methods mirror the ipfs commands, and return their results as Go
+values, so that tools don't need to run ipfs and parse what it prints.
+
+	c := client.New("localhost:5001")
+	hash, err := c.Add(ctx, strings.NewReader("hello"))
+	...
+	r, err := c.Cat(ctx, "/ipfs/"+hash)
+	...
+	defer r.Close()
+
+Bodies, both added and read, are streamed rather than held in memory.
+Cancelling the context of a call aborts its request, and stops the read
+of any stream it returned.
+*/
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+// APIPath is the path the daemon serves its commands under.
+const APIPath = "/api/v0"
+
+// Error is an error returned by the daemon for a command.
+type Error struct {
+	Command string
+	Message string
+
+	// Code is the kind of error, as in the commands package: 0 is a
+	// general error, 1 one caused by the request.
+	Code int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Command, e.Message)
+}
+
+// Client calls the commands of an ipfs daemon.
+type Client struct {
+	address string
+	http    *http.Client
+
+	// authorization is the Authorization header sent with each request.
+	authorization string
+}
+
+// New returns a Client of the daemon whose API listens at address, as
+// host:port.
+func New(address string) *Client {
+	return NewWithHTTPClient(address, http.DefaultClient)
+}
+
+// NewWithHTTPClient returns a Client of the daemon at address, which
+// sends its requests with hc.
+func NewWithHTTPClient(address string, hc *http.Client) *Client {
+	return &Client{address: address, http: hc}
+}
+
+// SetToken makes c present the bearer token to the daemon, for an API
+// restricted by API.Credentials.
+func (c *Client) SetToken(token string) {
+	c.authorization = config.APICredential{Token: token}.Authorization()
+}
+
+// SetBasicAuth makes c present the username and password to the daemon.
+func (c *Client) SetBasicAuth(username, password string) {
+	c.authorization = config.APICredential{Username: username, Password: password}.Authorization()
+}
+
+// request is a call to a command.
+type request struct {
+	command string
+	args    []string
+	opts    map[string]string
+
+	// body holds the files of the request. It is closed once sent.
+	body        io.ReadCloser
+	contentType string
+}
+
+func newRequest(command string, args ...string) *request {
+	return &request{command: command, args: args, opts: make(map[string]string)}
+}
+
+func (r *request) url(address string) string {
+	q := url.Values{}
+	for k, v := range r.opts {
+		q.Set(k, v)
+	}
+	for _, a := range r.args {
+		q.Add("arg", a)
+	}
+	q.Set("encoding", "json")
+	q.Set("stream-channels", "true")
+	return fmt.Sprintf("http://%s%s/%s?%s", address, APIPath, r.command, q.Encode())
+}
+
+// send calls the command of r, and returns the body of the response,
+// which can't be read any more once ctx is done.
+func (c *Client) send(ctx context.Context, r *request) (io.ReadCloser, error) {
+	body := r.body
+	if body == nil {
+		body = ioutil.NopCloser(strings.NewReader(""))
+	}
+
+	httpReq, err := http.NewRequest("POST", r.url(c.address), body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	if r.contentType != "" {
+		httpReq.Header.Set("Content-Type", r.contentType)
+
+		// the daemon may answer before reading the files to their end,
+		// which leaves the connection unusable for the next request.
+		httpReq.Close = true
+	} else {
+		httpReq.Header.Set("Content-Type", "application/octet-stream")
+	}
+	httpReq.Header.Set("User-Agent", fmt.Sprintf("/go-ipfs/%s/client", config.CurrentVersionNumber))
+	if c.authorization != "" {
+		httpReq.Header.Set("Authorization", c.authorization)
+	}
+
+	// cancelling the request aborts both the call and the read of its
+	// response.
+	httpReq.Cancel = ctx.Done()
+
+	httpRes, err := c.http.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	if httpRes.StatusCode >= http.StatusBadRequest {
+		defer httpRes.Body.Close()
+		return nil, decodeError(r.command, httpRes)
+	}
+	return httpRes.Body, nil
+}
+
+func decodeError(command string, httpRes *http.Response) error {
+	e := &Error{Command: command}
+	if httpRes.StatusCode == http.StatusNotFound {
+		e.Message = "command not found"
+		e.Code = 1
+		return e
+	}
+
+	contentType := strings.Split(httpRes.Header.Get("Content-Type"), ";")[0]
+	if contentType == "application/json" {
+		if err := json.NewDecoder(httpRes.Body).Decode(e); err == nil {
+			return e
+		}
+	}
+
+	// the error wasn't marshalled
+	var msg [4096]byte
+	n, _ := io.ReadFull(httpRes.Body, msg[:])
+	e.Message = strings.TrimSpace(string(msg[:n]))
+	if e.Message == "" {
+		e.Message = httpRes.Status
+	}
+	return e
+}
+
+// call calls the command of r, and decodes its output into out, unless
+// out is nil.
+func (c *Client) call(ctx context.Context, r *request, out interface{}) error {
+	body, err := c.send(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// multipartBody returns a body of files for the commands which take
+// some, and its content type. The data of r is copied as it is sent.
+func multipartBody(name string, r io.Reader) (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, url.QueryEscape(name)))
+		h.Set("Content-Type", "application/octet-stream")
+
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, r); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(mw.Close())
+	}()
+
+	return pr, "multipart/form-data; boundary=" + mw.Boundary()
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// testServer serves the API at APIPath with handler, and returns a Client
+// of it.
+func testServer(t *testing.T, handler http.HandlerFunc) (*Client, func()) {
+	mux := http.NewServeMux()
+	mux.Handle(APIPath+"/", handler)
+	s := httptest.NewServer(mux)
+	return New(strings.TrimPrefix(s.URL, "http://")), s.Close
+}
+
+func TestAdd(t *testing.T) {
+	c, done := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != APIPath+"/add" {
+			t.Errorf("unexpected command %s", r.URL.Path)
+		}
+		mr, err := r.MultipartReader()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, _ := ioutil.ReadAll(part)
+		if string(data) != "some data" {
+			t.Errorf("daemon got %q", data)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"Name":"","Bytes":9}`)
+		fmt.Fprintln(w, `{"Name":"","Hash":"QmHash"}`)
+	})
+	defer done()
+
+	h, err := c.Add(context.Background(), strings.NewReader("some data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != "QmHash" {
+		t.Fatalf("expected QmHash, got %s", h)
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	c, done := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query()["arg"]; len(got) != 1 || got[0] != "/ipfs/QmNope" {
+			t.Errorf("unexpected args %v", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, `{"Message":"not found","Code":0}`)
+	})
+	defer done()
+
+	_, err := c.PinAdd(context.Background(), "/ipfs/QmNope", true)
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an *Error, got %v", err)
+	}
+	if e.Command != "pin/add" || e.Message != "not found" {
+		t.Fatalf("unexpected error %#v", e)
+	}
+}
+
+func TestNamePublish(t *testing.T) {
+	c, done := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if key := r.URL.Query().Get("key"); key != "mykey" {
+			t.Errorf("expected key mykey, got %q", key)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"Name":"QmName","Value":"/ipfs/QmValue"}`)
+	})
+	defer done()
+
+	e, err := c.NamePublish(context.Background(), "mykey", "/ipfs/QmValue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Name != "QmName" || e.Value != "/ipfs/QmValue" {
+		t.Fatalf("unexpected entry %v", e)
+	}
+}
+
+func TestCatCancel(t *testing.T) {
+	c, done := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Stream-Output", "1")
+		w.Write([]byte("start"))
+		w.(http.Flusher).Flush()
+		// the rest never comes
+		select {
+		case <-w.(http.CloseNotifier).CloseNotify():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := c.Cat(ctx, "/ipfs/QmFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	buf := make([]byte, 5)
+	if _, err := r.Read(buf); err != nil || string(buf) != "start" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := ioutil.ReadAll(r)
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Fatal("expected the read to fail once cancelled")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("read didn't stop when the context was cancelled")
+	}
+}
+
+func TestToken(t *testing.T) {
+	c, done := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("expected the token, got %q", auth)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"Pinned":["QmPinned"]}`)
+	})
+	defer done()
+
+	c.SetToken("secret")
+	if _, err := c.PinAdd(context.Background(), "/ipfs/QmPinned", true); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// ErrNoHash is returned by Add when the daemon doesn't report the hash
+// of what was added.
+var ErrNoHash = errors.New("add: no hash in the response")
+
+// Add adds the data of r as a file, like 'ipfs add', and returns its
+// hash. The data is streamed to the daemon as it is read.
+func (c *Client) Add(ctx context.Context, r io.Reader) (string, error) {
+	req := newRequest("add")
+	req.body, req.contentType = multipartBody("", r)
+
+	body, err := c.send(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	// the output is a stream of objects, the last of which is the root of
+	// what was added.
+	var hash string
+	dec := json.NewDecoder(body)
+	for {
+		var out struct {
+			Name string
+			Hash string
+		}
+		err := dec.Decode(&out)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", err
+		}
+		if out.Hash != "" {
+			hash = out.Hash
+		}
+	}
+	if hash == "" {
+		return "", ErrNoHash
+	}
+	return hash, nil
+}
+
+// Cat returns the data of the file at path, like 'ipfs cat'.
+func (c *Client) Cat(ctx context.Context, path string) (io.ReadCloser, error) {
+	return c.send(ctx, newRequest("cat", path))
+}
+
+// Get returns a tar archive of the object at path, like 'ipfs get
+// --archive'.
+func (c *Client) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	req := newRequest("get", path)
+	req.opts["archive"] = "true"
+	return c.send(ctx, req)
+}
+
+// PinAdd pins the object at path, like 'ipfs pin add', and returns the
+// hashes of the objects pinned.
+func (c *Client) PinAdd(ctx context.Context, path string, recursive bool) ([]string, error) {
+	return c.pin(ctx, "pin/add", path, recursive)
+}
+
+// PinRm unpins the object at path, like 'ipfs pin rm', and returns the
+// hashes of the objects unpinned.
+func (c *Client) PinRm(ctx context.Context, path string, recursive bool) ([]string, error) {
+	return c.pin(ctx, "pin/rm", path, recursive)
+}
+
+func (c *Client) pin(ctx context.Context, command, path string, recursive bool) ([]string, error) {
+	req := newRequest(command, path)
+	req.opts["recursive"] = strconv.FormatBool(recursive)
+
+	var out struct {
+		Pinned []string
+	}
+	if err := c.call(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return out.Pinned, nil
+}
+
+// NameEntry is a value published under an IPNS name.
+type NameEntry struct {
+	Name  string
+	Value string
+}
+
+// NamePublish publishes path under the name of the key keyName, like
+// 'ipfs name publish --key'. An empty keyName publishes with the
+// identity key of the node.
+func (c *Client) NamePublish(ctx context.Context, keyName, path string) (*NameEntry, error) {
+	req := newRequest("name/publish", path)
+	if keyName != "" {
+		req.opts["key"] = keyName
+	}
+
+	out := new(NameEntry)
+	if err := c.call(ctx, req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// NameResolve returns the value of the IPNS name, like 'ipfs name
+// resolve'.
+func (c *Client) NameResolve(ctx context.Context, name string, recursive bool) (string, error) {
+	req := newRequest("name/resolve", name)
+	req.opts["recursive"] = strconv.FormatBool(recursive)
+
+	var out struct {
+		Path string
+	}
+	if err := c.call(ctx, req, &out); err != nil {
+		return "", err
+	}
+	return out.Path, nil
+}
@@ -6,8 +6,10 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 
 	_ "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/codahale/metrics/runtime"
 	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
@@ -17,21 +19,33 @@ import (
 	"github.com/ipfs/go-ipfs/core"
 	commands "github.com/ipfs/go-ipfs/core/commands"
 	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	"github.com/ipfs/go-ipfs/core/corerouting"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	repo "github.com/ipfs/go-ipfs/repo"
+	config "github.com/ipfs/go-ipfs/repo/config"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	util "github.com/ipfs/go-ipfs/util"
 )
 
 const (
 	initOptionKwd             = "init"
+	initProfileOptionKwd      = "init-profile"
+	migrateKwd                = "migrate"
+	offlineKwd                = "offline"
 	routingOptionKwd          = "routing"
 	routingOptionSupernodeKwd = "supernode"
+	routingOptionDHTClientKwd = "dhtclient"
+	routingOptionDelegatedKwd = "delegated"
 	mountKwd                  = "mount"
 	writableKwd               = "writable"
 	ipfsMountKwd              = "mount-ipfs"
 	ipnsMountKwd              = "mount-ipns"
 	unrestrictedApiAccess     = "unrestricted-api"
+	enableNamesysPubsubKwd    = "enable-namesys-pubsub"
+	enablePubsubKwd           = "enable-pubsub-experiment"
+	forcePnetKwd              = "force-pnet"
+	identityKwd               = "identity"
 	// apiAddrKwd    = "address-api"
 	// swarmAddrKwd  = "address-swarm"
 )
@@ -65,17 +79,88 @@ in the network, use 0.0.0.0 as the ip address:
 
 Be careful if you expose the API. It is a security risk, as anyone could control
 your node remotely. If you need to control the node remotely, make sure to protect
-the port as you would other services or database (firewall, authenticated proxy, etc).`,
+the port as you would other services or database (firewall, authenticated proxy, etc).
+
+With --enable-namesys-pubsub, IPNS records are also published over pubsub, on
+a topic for each name, and the names resolved are followed there. Once the
+records published to a name reach the node, through the peers following it
+too, the name resolves at once, without asking the DHT, which is still
+asked for names not followed yet.
+
+With --enable-pubsub-experiment, the node runs pubsub for 'ipfs pubsub',
+to publish messages to topics, and subscribe to those of other peers, as
+it does with Experiments.Pubsub set in the config.
+
+A swarm.key file in the repo limits the node to the private network of the
+peers holding the same key: all its connections are encrypted with the key,
+and those to peers without it fail. The file holds a random 32 byte key:
+
+    /key/swarm/psk/1.0.0/
+    /base16/
+    <64 hexadecimal digits>
+
+The daemon refuses to start with a swarm.key while its bootstrap list has
+peers of the public network, unless given --force-pnet. Remove them with
+'ipfs bootstrap rm --all', and add peers of the private network instead,
+or give the network a bootstrap list of its own, kept apart from the
+public one, with 'ipfs bootstrap add --pnet'.
+
+With --init, the daemon first initializes the repo if there is none, with
+the profiles of --init-profile applied, as 'ipfs init --profile' does:
+
+    ipfs daemon --init --init-profile=server
+
+The API serves the metrics of the daemon on /debug/vars as JSON, and on
+/debug/metrics/prometheus for Prometheus to scrape: those of bitswap, of
+DHT queries, of gateway requests, the size of the repo, the number of
+pins, and those of the runtime, such as Goroutines_Num.
+
+For orchestrators like Kubernetes or systemd to health check the daemon,
+the API answers /livez with 200 while the daemon runs, and /readyz with
+200 once it is ready, or 503, along with the state of each check as
+JSON: the repo is open, the swarm is listening, the node is connected to
+a peer, unless it has none to bootstrap to, and the daemon is done
+starting. Neither needs credentials.
+
+With --offline, the daemon runs without the network: it serves the API
+and the gateway from the content and names of the repo alone, never
+dialing or listening for peers, and the commands which need the network
+fail at once.
+
+The daemon remembers the peers it connects to in the repo, for Peerstore.TTL
+in the config, and dials them along with the bootstrap peers when it starts
+again. 'ipfs swarm addrs saved' lists them.
+
+With --identity=<name>, the daemon runs as the key <name> of the keystore,
+made with 'ipfs key gen' or 'ipfs key import', rather than as the identity
+of the config: its peer ID, and the name it publishes to as self, are
+those of the key. Hosts running nodes for others can keep the identity of
+each in the keystore, and pick it when starting the daemon.
+
+With --migrate, the daemon first runs the migrations taking the repo to the
+version of this program, as 'ipfs repo migrate' does, should it be of
+another.
+
+On SIGHUP, the daemon reads its config file again and applies what it can
+without a restart, as 'ipfs config reload' does: gateway and API headers,
+the bootstrap peers, the limits of the connection manager and the interval
+of the reprovider. The changes made with 'ipfs config' apply at once.`,
 	},
 
 	Options: []cmds.Option{
 		cmds.BoolOption(initOptionKwd, "Initialize IPFS with default settings if not already initialized"),
-		cmds.StringOption(routingOptionKwd, "Overrides the routing option (dht, supernode)"),
+		cmds.StringOption(initProfileOptionKwd, "Comma separated profiles to initialize with, as in 'ipfs init --profile'"),
+		cmds.BoolOption(migrateKwd, "Migrate the repo to the version of this program if it's of another"),
+		cmds.StringOption(routingOptionKwd, "Overrides the routing option (dht, dhtclient, supernode, delegated)"),
 		cmds.BoolOption(mountKwd, "Mounts IPFS to the filesystem"),
 		cmds.BoolOption(writableKwd, "Enable writing objects (with POST, PUT and DELETE)"),
 		cmds.StringOption(ipfsMountKwd, "Path to the mountpoint for IPFS (if using --mount)"),
 		cmds.StringOption(ipnsMountKwd, "Path to the mountpoint for IPNS (if using --mount)"),
 		cmds.BoolOption(unrestrictedApiAccess, "Allow API access to unlisted hashes"),
+		cmds.BoolOption(enableNamesysPubsubKwd, "Publish and follow IPNS records over pubsub too, to resolve names followed at once"),
+		cmds.BoolOption(enablePubsubKwd, "Enable the experimental pubsub messaging of 'ipfs pubsub'"),
+		cmds.BoolOption(forcePnetKwd, "Start with a swarm.key even if the bootstrap list has public peers"),
+		cmds.StringOption(identityKwd, "Run as the key of that name in the keystore, rather than as the identity of the config"),
 
 		// TODO: add way to override addresses. tricky part: updating the config if also --init.
 		// cmds.StringOption(apiAddrKwd, "Address for the daemon rpc API (overrides config)"),
@@ -124,7 +209,13 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		// `IsInitialized` where the quality of the signal can be improved over
 		// time, and many call-sites can benefit.
 		if !util.FileExists(req.Context().ConfigRoot) {
-			err := initWithDefaults(os.Stdout, req.Context().ConfigRoot)
+			profile, _, err := req.Option(initProfileOptionKwd).String()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+
+			err = initWithDefaults(os.Stdout, req.Context().ConfigRoot, profile)
 			if err != nil {
 				res.SetError(err, cmds.ErrNormal)
 				return
@@ -132,9 +223,23 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		}
 	}
 
+	migrate, _, err := req.Option(migrateKwd).Bool()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
 	// acquire the repo lock _before_ constructing a node. we need to make
 	// sure we are permitted to access the resources (datastore, etc.)
 	repo, err := fsrepo.Open(req.Context().ConfigRoot)
+	if _, ok := err.(fsrepo.VersionError); ok && migrate {
+		var steps []string
+		steps, err = fsrepo.Migrate(req.Context().ConfigRoot, fsrepo.RepoVersion)
+		if err == nil {
+			fmt.Printf("Ran repo migrations %s\n", strings.Join(steps, ", "))
+			repo, err = fsrepo.Open(req.Context().ConfigRoot)
+		}
+	}
 	if err != nil {
 		res.SetError(err, cmds.ErrNormal)
 		return
@@ -146,16 +251,48 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		return
 	}
 
+	forcePnet, _, err := req.Option(forcePnetKwd).Bool()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		repo.Close()
+		return
+	}
+	if err := checkPrivateNetwork(repo, forcePnet); err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		repo.Close() // because ownership hasn't been transferred to the node
+		return
+	}
+
+	offline, _, err := req.Option(offlineKwd).Bool()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		repo.Close()
+		return
+	}
+
 	// Start assembling corebuilder
 	nb := core.NewNodeBuilder().Online()
+	if offline {
+		nb.Offline()
+	}
 	nb.SetRepo(repo)
 
+	identity, _, err := req.Option(identityKwd).String()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	if identity != "" {
+		nb.SetIdentity(identity)
+	}
+
 	routingOption, _, err := req.Option(routingOptionKwd).String()
 	if err != nil {
 		res.SetError(err, cmds.ErrNormal)
 		return
 	}
-	if routingOption == routingOptionSupernodeKwd {
+	switch routingOption {
+	case routingOptionSupernodeKwd:
 		servers, err := repo.Config().SupernodeRouting.ServerIPFSAddrs()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
@@ -170,6 +307,33 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 			})
 		}
 		nb.SetRouting(corerouting.SupernodeClient(infos...))
+	case routingOptionDHTClientKwd:
+		nb.SetRouting(core.DHTClientOption)
+	case routingOptionDelegatedKwd:
+		nb.SetRouting(corerouting.Delegated(repo.Config().DelegatedRouting.API))
+	case "", "dht":
+	default:
+		res.SetError(fmt.Errorf("unrecognized routing option: %s", routingOption), cmds.ErrClient)
+		repo.Close() // because ownership hasn't been transferred to the node
+		return
+	}
+
+	pubsub, _, err := req.Option(enableNamesysPubsubKwd).Bool()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	if pubsub {
+		nb.NamesysPubsub()
+	}
+
+	pubsub, _, err = req.Option(enablePubsubKwd).Bool()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	if pubsub || repo.Config().Experiments.Pubsub {
+		nb.Pubsub()
 	}
 
 	node, err := nb.Build(ctx.Context)
@@ -194,9 +358,34 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 	req.Context().ConstructNode = func() (*core.IpfsNode, error) {
 		return node, nil
 	}
+	// the commands run by the API see the node running, and apply their
+	// changes of the config to it.
+	req.Context().Online = true
 
-	// construct api endpoint - every time
-	err, apiErrc := serveHTTPApi(req)
+	go reloadOnHangup(node, repo)
+
+	if offline {
+		// resolve the names of the repo, as offline commands do.
+		if err := node.SetupOfflineRouting(); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		fmt.Println("Daemon is offline: no peers are dialed or accepted")
+	}
+	if node.PNetKey != nil {
+		fmt.Printf("Swarm is limited to the private network of key fingerprint %x\n", node.PNetKey.Fingerprint())
+	}
+
+	// enforce the storage limit, if one is set
+	if err := corerepo.PeriodicGC(node.Context(), node); err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
+	// construct api endpoint - every time. It reports the daemon ready
+	// once started is closed, when the other servers are up too.
+	started := make(chan struct{})
+	err, apiErrc := serveHTTPApi(req, started)
 	if err != nil {
 		res.SetError(err, cmds.ErrNormal)
 		return
@@ -226,6 +415,8 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		}
 	}
 
+	close(started)
+
 	// collect long-running errors and block for shutdown
 	// TODO(cryptix): our fuse currently doesnt follow this pattern for graceful shutdown
 	for err := range merge(apiErrc, gwErrc) {
@@ -236,8 +427,34 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 	}
 }
 
+// reloadOnHangup applies the config file to node on each SIGHUP, until
+// the node closes.
+func reloadOnHangup(node *core.IpfsNode, r repo.Repo) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-sig:
+		case <-node.Context().Done():
+			return
+		}
+
+		if err := r.ReloadConfig(); err != nil {
+			log.Errorf("reloading the config: %s", err)
+			continue
+		}
+		if err := node.ReloadConfig(); err != nil {
+			log.Errorf("applying the config: %s", err)
+			continue
+		}
+		fmt.Println("Reloaded the config")
+	}
+}
+
 // serveHTTPApi collects options, creates listener, prints status message and starts serving requests
-func serveHTTPApi(req cmds.Request) (error, <-chan error) {
+func serveHTTPApi(req cmds.Request, started <-chan struct{}) (error, <-chan error) {
 	cfg, err := req.Context().GetConfig()
 	if err != nil {
 		return fmt.Errorf("serveHTTPApi: GetConfig() failed: %s", err), nil
@@ -261,6 +478,11 @@ func serveHTTPApi(req cmds.Request) (error, <-chan error) {
 		return fmt.Errorf("serveHTTPApi: Option(%s) failed: %s", unrestrictedApiAccess, err), nil
 	}
 
+	node, err := req.Context().ConstructNode()
+	if err != nil {
+		return fmt.Errorf("serveHTTPGateway: ConstructNode() failed: %s", err), nil
+	}
+
 	apiGw := corehttp.NewGateway(corehttp.GatewayConfig{
 		Writable: true,
 		BlockList: &corehttp.BlockList{
@@ -269,22 +491,28 @@ func serveHTTPApi(req cmds.Request) (error, <-chan error) {
 					return true
 				}
 				// for now, only allow paths in the WebUI path
-				for _, webuipath := range corehttp.WebUIPaths {
-					if strings.HasPrefix(s, webuipath) {
-						return true
-					}
-				}
-				return false
+				return corehttp.IsWebUIPath(node.Repo.Config(), s)
 			},
 		},
 	})
+	webuiOrigins, err := corehttp.WebUIOrigins(apiMaddr)
+	if err != nil {
+		return fmt.Errorf("serveHTTPApi: WebUIOrigins() failed: %s", err), nil
+	}
+	if len(cfg.API.Credentials) == 0 && !manet.IsIPLoopback(apiMaddr) {
+		fmt.Println("WARNING: the API is open to anyone who can reach it. Set API.Credentials to restrict it.")
+	}
+
 	var opts = []corehttp.ServeOption{
-		corehttp.CommandsOption(*req.Context()),
+		corehttp.APIAuthOption(cfg.API),
+		corehttp.CommandsOption(*req.Context(), webuiOrigins...),
 		corehttp.WebUIOption,
 		apiGw.ServeOption(),
 		corehttp.VersionOption(),
+		corehttp.HealthOption(started),
 		defaultMux("/debug/vars"),
 		defaultMux("/debug/pprof/"),
+		corehttp.PrometheusOption("/debug/metrics/prometheus"),
 		corehttp.LogOption(),
 	}
 
@@ -292,9 +520,9 @@ func serveHTTPApi(req cmds.Request) (error, <-chan error) {
 		opts = append(opts, corehttp.RedirectOption("", cfg.Gateway.RootRedirect))
 	}
 
-	node, err := req.Context().ConstructNode()
-	if err != nil {
-		return fmt.Errorf("serveHTTPGateway: ConstructNode() failed: %s", err), nil
+	// the commands run while the daemon holds the repo find the API there
+	if err := node.Repo.SetAPIAddr(apiMaddr.String()); err != nil {
+		return fmt.Errorf("serveHTTPApi: SetAPIAddr() failed: %s", err), nil
 	}
 
 	errc := make(chan error)
@@ -341,7 +569,11 @@ func serveHTTPGateway(req cmds.Request) (error, <-chan error) {
 	var opts = []corehttp.ServeOption{
 		corehttp.VersionOption(),
 		corehttp.IPNSHostnameOption(),
-		corehttp.GatewayOption(writable),
+		corehttp.NewGateway(corehttp.GatewayConfig{
+			Writable:     writable,
+			NoDirListing: cfg.Gateway.NoDirListing,
+			BlockList:    &corehttp.BlockList{},
+		}).ServeOption(),
 	}
 
 	if len(cfg.Gateway.RootRedirect) > 0 {
@@ -427,3 +659,26 @@ func merge(cs ...<-chan error) <-chan error {
 	}()
 	return out
 }
+
+// checkPrivateNetwork refuses a swarm.key in r while the bootstrap list
+// of its network has peers of the public network, which the node cannot
+// connect to, unless forced.
+func checkPrivateNetwork(r repo.Repo, force bool) error {
+	fp, err := core.PNetFingerprint(r)
+	if err != nil || fp == "" || force {
+		return err
+	}
+
+	var public int
+	for _, addr := range r.Config().BootstrapList(fp) {
+		for _, daddr := range config.DefaultBootstrapAddresses {
+			if addr == daddr {
+				public++
+			}
+		}
+	}
+	if public > 0 {
+		return fmt.Errorf("the swarm.key of the repo limits the node to a private network, but its bootstrap list has %d public peers: give the network a list of its own with 'ipfs bootstrap add --pnet', remove them with 'ipfs bootstrap rm --all', or start with --%s", public, forcePnetKwd)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"strings"
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	assets "github.com/ipfs/go-ipfs/assets"
@@ -26,11 +27,30 @@ var initCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline:          "Initializes IPFS config file",
 		ShortDescription: "Initializes IPFS configuration files and generates a new keypair.",
+		LongDescription: `
+Initializes IPFS configuration files and generates a new keypair.
+
+--profile takes a comma separated list of profiles, which adapt the
+config to the node. One may pick the datastore backend the repo keeps
+its blocks in: flatfs, the default, which keeps each block in a file of
+its own, leveldb, or mem, which keeps everything in memory and loses it
+when the node stops. 'ipfs repo convert' moves the blocks of a repo to
+another backend later on. The others set options for a kind of node:
+
+    server     no local discovery, and no dialing of private networks
+    test       loopback addresses, no bootstrap peers, short intervals
+    lowpower   few connections, and rare periodic work
+
+For example:
+
+    ipfs init --profile=leveldb,server
+`,
 	},
 
 	Options: []cmds.Option{
 		cmds.IntOption("bits", "b", fmt.Sprintf("Number of bits to use in the generated RSA private key (defaults to %d)", nBitsForKeypairDefault)),
 		cmds.BoolOption("force", "f", "Overwrite existing config (if it exists)"),
+		cmds.StringOption("profile", "Comma separated profiles to apply to the config, such as a datastore backend (defaults to flatfs)"),
 
 		// TODO need to decide whether to expose the override as a file or a
 		// directory. That is: should we allow the user to also specify the
@@ -73,7 +93,13 @@ var initCmd = &cmds.Command{
 			nBitsForKeypair = nBitsForKeypairDefault
 		}
 
-		if err := doInit(os.Stdout, req.Context().ConfigRoot, force, nBitsForKeypair); err != nil {
+		profile, _, err := req.Option("profile").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if err := doInit(os.Stdout, req.Context().ConfigRoot, force, nBitsForKeypair, profile); err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
@@ -85,11 +111,11 @@ Reinitializing would overwrite your keys.
 (use -f to force overwrite)
 `)
 
-func initWithDefaults(out io.Writer, repoRoot string) error {
-	return doInit(out, repoRoot, false, nBitsForKeypairDefault)
+func initWithDefaults(out io.Writer, repoRoot string, profile string) error {
+	return doInit(out, repoRoot, false, nBitsForKeypairDefault, profile)
 }
 
-func doInit(out io.Writer, repoRoot string, force bool, nBitsForKeypair int) error {
+func doInit(out io.Writer, repoRoot string, force bool, nBitsForKeypair int, profile string) error {
 	if _, err := fmt.Fprintf(out, "initializing ipfs node at %s\n", repoRoot); err != nil {
 		return err
 	}
@@ -107,6 +133,10 @@ func doInit(out io.Writer, repoRoot string, force bool, nBitsForKeypair int) err
 		return err
 	}
 
+	if err := applyProfiles(conf, profile); err != nil {
+		return err
+	}
+
 	if fsrepo.IsInitialized(repoRoot) {
 		if err := fsrepo.Remove(repoRoot); err != nil {
 			return err
@@ -117,6 +147,11 @@ func doInit(out io.Writer, repoRoot string, force bool, nBitsForKeypair int) err
 		return err
 	}
 
+	if conf.Datastore.Type == "mem" {
+		// nothing added now would be there once the repo is opened again
+		return nil
+	}
+
 	if err := addDefaultAssets(out, repoRoot); err != nil {
 		return err
 	}
@@ -124,6 +159,27 @@ func doInit(out io.Writer, repoRoot string, force bool, nBitsForKeypair int) err
 	return initializeIpnsKeyspace(repoRoot)
 }
 
+// applyProfiles applies the comma separated profiles to conf: the
+// datastore backends, and the profiles of the config.
+func applyProfiles(conf *config.Config, profiles string) error {
+	if profiles == "" {
+		return nil
+	}
+	for _, p := range strings.Split(profiles, ",") {
+		p = strings.TrimSpace(p)
+		if _, ok := config.Profiles[p]; ok {
+			if err := config.ApplyProfile(conf, p); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fsrepo.ApplyProfile(conf, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func checkWriteable(dir string) error {
 	_, err := os.Stat(dir)
 	if err == nil {
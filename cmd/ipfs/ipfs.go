@@ -109,4 +109,10 @@ var cmdDetailsMap = map[*cmds.Command]cmdDetails{
 	commands.UpdateCheckCmd:    {preemptsAutoUpdate: true},
 	commands.UpdateLogCmd:      {preemptsAutoUpdate: true},
 	commands.LogCmd:            {cannotRunOnClient: true},
+	commands.ShutdownCmd:       {cannotRunOnClient: true},
+	commands.RepoRestoreCmd:    {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true, doesNotUseRepo: true},
+	commands.RepoConvertCmd:    {cannotRunOnDaemon: true, doesNotUseRepo: true},
+	commands.RepoMigrateCmd:    {cannotRunOnDaemon: true, doesNotUseRepo: true},
+	commands.RepoFsckCmd:       {cannotRunOnDaemon: true, doesNotUseRepo: true},
+	commands.IDRotateCmd:       {cannotRunOnDaemon: true},
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"os"
 	"os/signal"
 	"runtime"
@@ -23,6 +24,7 @@ import (
 	cmdsCli "github.com/ipfs/go-ipfs/commands/cli"
 	cmdsHttp "github.com/ipfs/go-ipfs/commands/http"
 	core "github.com/ipfs/go-ipfs/core"
+	commands "github.com/ipfs/go-ipfs/core/commands"
 	config "github.com/ipfs/go-ipfs/repo/config"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
@@ -37,6 +39,7 @@ var errHelpRequested = errors.New("Help Requested")
 
 const (
 	EnvEnableProfiling = "IPFS_PROF"
+	EnvAPIToken        = "IPFS_API_TOKEN"
 	cpuProfile         = "ipfs.cpuprof"
 	heapProfile        = "ipfs.memprof"
 	errorFormat        = "ERROR: %v\n\n"
@@ -142,8 +145,26 @@ func main() {
 	intrh, ctx := invoc.SetupInterruptHandler(ctx)
 	defer intrh.Close()
 
+	// --timeout bounds the whole command, the output included.
+	timeout, err := cmds.Timeout(invoc.req)
+	if err != nil {
+		printErr(err)
+		printMetaHelp(os.Stderr)
+		os.Exit(1)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	output, err := invoc.Run(ctx)
 	if err != nil {
+		// a command cut short by its timeout fails in many ways, like a
+		// cancelled request to the daemon; report the timeout instead.
+		if ctx.Err() == context.DeadlineExceeded {
+			err = ctx.Err()
+		}
 		printErr(err)
 
 		// if this error was a client error, print short help too.
@@ -155,6 +176,10 @@ func main() {
 
 	// everything went better than expected :)
 	_, err = io.Copy(os.Stdout, output)
+	if ctx.Err() == context.DeadlineExceeded {
+		// the output may have ended early, without an error.
+		err = ctx.Err()
+	}
 	if err != nil {
 		printErr(err)
 
@@ -244,6 +269,9 @@ func (i *cmdInvocation) Parse(ctx context.Context, args []string) error {
 	// this sets up the function that will initialize the node
 	// this is so that we can construct the node lazily.
 	cmdctx.ConstructNode = i.constructNodeFunc(ctx)
+	// the daemon serves the API with this context, tracking its requests
+	// for 'ipfs diag cmds'.
+	cmdctx.ReqLog = &cmds.ReqLog{}
 
 	// if no encoding was specified by user, default to plaintext encoding
 	// (if command doesn't support plaintext, use JSON instead)
@@ -288,6 +316,13 @@ func callCommand(ctx context.Context, req cmds.Request, root *cmds.Command, cmd
 	if err != nil {
 		return nil, err
 	}
+	// 'ipfs version' runs without a repo, but it checks the distribution
+	// through a node, which is the daemon's if one is running.
+	if cmd == commands.VersionCmd {
+		if check, _, _ := req.Option("check").Bool(); check {
+			details = &cmdDetails{}
+		}
+	}
 
 	log.Debug("looking for running daemon...")
 	useDaemon, err := commandShouldRunOnDaemon(*details, req, root)
@@ -314,7 +349,7 @@ func callCommand(ctx context.Context, req cmds.Request, root *cmds.Command, cmd
 			return nil, err
 		}
 
-		addr, err := ma.NewMultiaddr(cfg.Addresses.API)
+		addr, err := daemonAPIAddr(req.Context().ConfigRoot, cfg)
 		if err != nil {
 			return nil, err
 		}
@@ -325,7 +360,7 @@ func callCommand(ctx context.Context, req cmds.Request, root *cmds.Command, cmd
 			return nil, err
 		}
 
-		client := cmdsHttp.NewClient(host)
+		client := cmdsHttp.NewAuthClient(host, apiAuthorization(cfg))
 
 		res, err = client.Send(req)
 		if err != nil {
@@ -347,6 +382,34 @@ func callCommand(ctx context.Context, req cmds.Request, root *cmds.Command, cmd
 	return res, nil
 }
 
+// daemonAPIAddr returns the address of the API of the daemon holding the
+// repo at repoPath: the one of the api file the daemon writes, as it may
+// listen elsewhere than Addresses.API says, like on /tcp/0, or else, if
+// the daemon just stopped, the one of the config.
+func daemonAPIAddr(repoPath string, cfg *config.Config) (ma.Multiaddr, error) {
+	addr, err := fsrepo.APIAddr(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if addr == "" {
+		addr = cfg.Addresses.API
+	}
+	return ma.NewMultiaddr(addr)
+}
+
+// apiAuthorization returns the Authorization header to call the daemon
+// with: the token in $IPFS_API_TOKEN, or else the first admin credential
+// of the config, if any.
+func apiAuthorization(cfg *config.Config) string {
+	if token := os.Getenv(EnvAPIToken); token != "" {
+		return config.APICredential{Token: token}.Authorization()
+	}
+	if c := cfg.API.AdminCredential(); c != nil {
+		return c.Authorization()
+	}
+	return ""
+}
+
 // commandDetails returns a command's details for the command given by |path|
 // within the |root| command tree.
 //
@@ -375,6 +438,18 @@ func commandDetails(path []string, root *cmds.Command) (*cmdDetails, error) {
 // It returns true if the command should be executed on a daemon and false if
 // it should be executed on a client. It returns an error if the command must
 // NOT be executed on either.
+//
+// Commands that use the repo run as follows:
+//
+//	repo free                 locally
+//	held, API answering       on the daemon
+//	held, API silent or none  on the daemon once its API answers, or
+//	                          locally once the repo is let go, waiting
+//	                          up to repoWait for either; else an error
+//
+// Commands which can't run on the daemon, like 'ipfs repo convert', need
+// the repo to themselves, and fail while it is held. Those which can't run
+// on a client fail when it is not.
 func commandShouldRunOnDaemon(details cmdDetails, req cmds.Request, root *cmds.Command) (bool, error) {
 	path := req.Path()
 	// root command.
@@ -386,13 +461,21 @@ func commandShouldRunOnDaemon(details cmdDetails, req cmds.Request, root *cmds.C
 		return false, fmt.Errorf("command disabled: %s", path[0])
 	}
 
+	offline, _, err := req.Option(offlineKwd).Bool()
+	if err != nil {
+		return false, err
+	}
+	if offline && details.cannotRunOnClient {
+		return false, cmds.ClientError(fmt.Sprintf("%s must run on the ipfs daemon, so not with --offline", path[0]))
+	}
+
 	if details.doesNotUseRepo && details.canRunOnClient() {
 		return false, nil
 	}
 
 	// at this point need to know whether daemon is running. we defer
 	// to this point so that some commands dont open files unnecessarily.
-	daemonLocked, err := fsrepo.LockedByOtherProcess(req.Context().ConfigRoot)
+	daemonLocked, err := lockedByOtherProcess(req.Context().ConfigRoot)
 	if err != nil {
 		return false, err
 	}
@@ -402,11 +485,21 @@ func commandShouldRunOnDaemon(details cmdDetails, req cmds.Request, root *cmds.C
 		log.Info("a daemon is running...")
 
 		if details.cannotRunOnDaemon {
-			e := "ipfs daemon is running. please stop it to run this command"
+			e := fmt.Sprintf("ipfs daemon is running, and %s needs the repo to itself. please stop the daemon to run this command", strings.Join(path, " "))
+			return false, cmds.ClientError(e)
+		}
+		if offline {
+			e := "ipfs daemon is running, and holds the repo. please stop it to run commands with --offline, or start it with 'ipfs daemon --offline'"
 			return false, cmds.ClientError(e)
 		}
 
-		return true, nil
+		onDaemon, err := daemonRoute(req.Context().ConfigRoot)
+		if err != nil {
+			return false, err
+		}
+		if onDaemon || details.canRunOnClient() {
+			return onDaemon, nil
+		}
 	}
 
 	if details.cannotRunOnClient {
@@ -416,6 +509,70 @@ func commandShouldRunOnDaemon(details cmdDetails, req cmds.Request, root *cmds.C
 	return false, nil
 }
 
+// repoWait bounds how long commands wait for the process holding the repo
+// to serve its API, or let go of the repo.
+var repoWait = 5 * time.Second
+
+// These are variables for tests to fake the process holding the repo.
+var (
+	lockedByOtherProcess = fsrepo.LockedByOtherProcess
+	repoAPIAddr          = fsrepo.APIAddr
+	apiAnswers           = dialAPI
+)
+
+// daemonRoute returns whether the commands run on the repo at repoPath,
+// which was found held, should go to the daemon holding it, or run
+// locally, the repo having been let go since.
+func daemonRoute(repoPath string) (bool, error) {
+	deadline := time.Now().Add(repoWait)
+	for {
+		apiAddr, err := repoAPIAddr(repoPath)
+		if err != nil {
+			return false, err
+		}
+		if apiAddr != "" && apiAnswers(apiAddr) {
+			return true, nil
+		}
+
+		locked, err := lockedByOtherProcess(repoPath)
+		if err != nil {
+			return false, err
+		}
+		if !locked {
+			log.Info("the repo was let go, running the command locally")
+			return false, nil
+		}
+
+		if time.Now().After(deadline) {
+			if apiAddr != "" {
+				e := fmt.Sprintf("ipfs daemon is running, but its API at %s does not answer", apiAddr)
+				return false, cmds.ClientError(e)
+			}
+			e := "the repo is in use by another ipfs command, or a daemon not ready yet. please wait for it to finish, or the daemon to start"
+			return false, cmds.ClientError(e)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// dialAPI returns whether the API served at addr accepts connections.
+func dialAPI(addr string) bool {
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return false
+	}
+	network, host, err := manet.DialArgs(maddr)
+	if err != nil {
+		return false
+	}
+	c, err := net.DialTimeout(network, host, time.Second)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
+
 func isClientError(err error) bool {
 
 	// Somewhat suprisingly, the pointer cast fails to recognize commands.Error
@@ -546,7 +703,12 @@ func (i *cmdInvocation) SetupInterruptHandler(ctx context.Context) (io.Closer, c
 		}
 	}
 
-	intrh.Handle(handlerFunc, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	sigs := []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	if i.cmd != daemonCmd {
+		// the daemon reloads its config on SIGHUP instead.
+		sigs = append(sigs, syscall.SIGHUP)
+	}
+	intrh.Handle(handlerFunc, sigs...)
 
 	return intrh, ctx
 }
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"net"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-ipfs/commands"
 )
@@ -15,3 +18,74 @@ func TestIsCientErr(t *testing.T) {
 		t.Errorf("misidentified pointer")
 	}
 }
+
+// fakeRepo fakes the process holding a repo for daemonRoute, switching
+// to the state after after calls of lockedByOtherProcess.
+type fakeRepo struct {
+	locked, answers bool
+	api             string
+	calls, after    int
+	then            func(*fakeRepo)
+}
+
+func (f *fakeRepo) install(t *testing.T) func() {
+	oldLocked, oldAPI, oldAnswers, oldWait := lockedByOtherProcess, repoAPIAddr, apiAnswers, repoWait
+	lockedByOtherProcess = func(string) (bool, error) {
+		f.calls++
+		if f.then != nil && f.calls > f.after {
+			f.then(f)
+			f.then = nil
+		}
+		return f.locked, nil
+	}
+	repoAPIAddr = func(string) (string, error) { return f.api, nil }
+	apiAnswers = func(string) bool { return f.answers }
+	repoWait = 300 * time.Millisecond
+	return func() {
+		lockedByOtherProcess, repoAPIAddr, apiAnswers, repoWait = oldLocked, oldAPI, oldAnswers, oldWait
+	}
+}
+
+func TestDaemonRoute(t *testing.T) {
+	const api = "/ip4/127.0.0.1/tcp/5001"
+	cases := []struct {
+		name     string
+		repo     fakeRepo
+		onDaemon bool
+		fails    bool
+	}{
+		{name: "daemon answers", repo: fakeRepo{locked: true, api: api, answers: true}, onDaemon: true},
+		{name: "daemon silent", repo: fakeRepo{locked: true, api: api}, fails: true},
+		{name: "held without api", repo: fakeRepo{locked: true}, fails: true},
+		{name: "let go", repo: fakeRepo{locked: true, after: 2, then: func(f *fakeRepo) { f.locked = false }}},
+		{name: "daemon started", repo: fakeRepo{locked: true, after: 2, then: func(f *fakeRepo) { f.api, f.answers = api, true }}, onDaemon: true},
+		{name: "daemon stopped", repo: fakeRepo{locked: true, api: api, after: 1, then: func(f *fakeRepo) { f.locked = false }}},
+	}
+	for _, c := range cases {
+		repo := c.repo
+		restore := repo.install(t)
+		onDaemon, err := daemonRoute("repo")
+		restore()
+		if (err != nil) != c.fails {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+		if err == nil && onDaemon != c.onDaemon {
+			t.Errorf("%s: expected on daemon %t", c.name, c.onDaemon)
+		}
+	}
+}
+
+func TestDialAPI(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "/ip4/127.0.0.1/tcp/" + strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	if !dialAPI(addr) {
+		t.Fatal("expected the API to answer")
+	}
+	l.Close()
+	if dialAPI(addr) {
+		t.Fatal("expected a closed API not to answer")
+	}
+}
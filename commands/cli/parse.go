@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
@@ -41,7 +42,12 @@ func Parse(input []string, stdin *os.File, root *cmds.Command) (cmds.Request, *c
 		}
 	}
 
-	stringArgs, fileArgs, err := parseArgs(stringVals, stdin, cmd.Arguments, recursive)
+	filter, err := fileFilter(req)
+	if err != nil {
+		return req, cmd, path, err
+	}
+
+	stringArgs, fileArgs, err := parseArgs(stringVals, stdin, cmd.Arguments, recursive, filter)
 	if err != nil {
 		return req, cmd, path, err
 	}
@@ -75,19 +81,30 @@ func parseOpts(args []string, root *cmds.Command) (
 	// parseFlag checks that a flag is valid and saves it into opts
 	// Returns true if the optional second argument is used
 	parseFlag := func(name string, arg *string, mustUse bool) (bool, error) {
-		if _, ok := opts[name]; ok {
-			return false, fmt.Errorf("Duplicate values for option '%s'", name)
-		}
-
 		optDef, found := optDefs[name]
 		if !found {
 			err = fmt.Errorf("Unrecognized option '%s'", name)
 			return false, err
 		}
 
+		if prev, ok := opts[name]; ok {
+			// the globs of the package builtin ignore option add up, one
+			// per line
+			if optDef != cmds.OptionIgnore || arg == nil {
+				return false, fmt.Errorf("Duplicate values for option '%s'", name)
+			}
+			opts[name] = prev.(string) + "\n" + *arg
+			return true, nil
+		}
+
 		if optDef.Type() == cmds.Bool {
 			if mustUse {
-				return false, fmt.Errorf("Option '%s' takes no arguments, but was passed '%s'", name, *arg)
+				// only an explicit value, as in --flag=false
+				if _, err := strconv.ParseBool(*arg); err != nil {
+					return false, fmt.Errorf("Option '%s' takes true or false, but was passed '%s'", name, *arg)
+				}
+				opts[name] = *arg
+				return true, nil
 			}
 			opts[name] = ""
 			return false, nil
@@ -196,7 +213,7 @@ func parseOpts(args []string, root *cmds.Command) (
 	return
 }
 
-func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursive bool) ([]string, []files.File, error) {
+func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursive bool, filter *files.Filter) ([]string, []files.File, error) {
 	// ignore stdin on Windows
 	if runtime.GOOS == "windows" {
 		stdin = nil
@@ -271,7 +288,7 @@ func parseArgs(inputs []string, stdin *os.File, argDefs []cmds.Argument, recursi
 		} else if argDef.Type == cmds.ArgFile {
 			if stdin == nil || !argDef.SupportsStdin {
 				// treat stringArg values as file paths
-				fileArgs, inputs, err = appendFile(fileArgs, inputs, argDef, recursive)
+				fileArgs, inputs, err = appendFile(fileArgs, inputs, argDef, recursive, filter)
 				if err != nil {
 					return nil, nil, err
 				}
@@ -332,7 +349,7 @@ func appendStdinAsString(args []string, stdin *os.File) ([]string, *os.File, err
 	return append(args, strings.Split(input, "\n")...), nil, nil
 }
 
-func appendFile(args []files.File, inputs []string, argDef *cmds.Argument, recursive bool) ([]files.File, []string, error) {
+func appendFile(args []files.File, inputs []string, argDef *cmds.Argument, recursive bool, filter *files.Filter) ([]files.File, []string, error) {
 	path := inputs[0]
 
 	file, err := os.Open(path)
@@ -358,7 +375,7 @@ func appendFile(args []files.File, inputs []string, argDef *cmds.Argument, recur
 		}
 	}
 
-	arg, err := files.NewSerialFile(path, file)
+	arg, err := files.NewFilteredSerialFile(path, file, filter)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -366,6 +383,36 @@ func appendFile(args []files.File, inputs []string, argDef *cmds.Argument, recur
 	return append(args, arg), inputs[1:], nil
 }
 
+// fileFilter returns the filter of the files of the directories given to
+// req: the globs of the package builtin ignore options, if it has them,
+// and those of the files.IgnoreFile of the directories.
+func fileFilter(req cmds.Request) (*files.Filter, error) {
+	var rules []string
+	if opt := req.Option(cmds.IgnoreOpt); opt != nil && opt.Definition() == cmds.OptionIgnore {
+		globs, found, err := opt.String()
+		if err != nil {
+			return nil, u.ErrCast()
+		}
+		if found {
+			rules = append(rules, strings.Split(globs, "\n")...)
+		}
+	}
+	if opt := req.Option(cmds.IgnoreRulesOpt); opt != nil && opt.Definition() == cmds.OptionIgnoreRulesPath {
+		name, found, err := opt.String()
+		if err != nil {
+			return nil, u.ErrCast()
+		}
+		if found {
+			more, err := files.ReadFilterRules(name)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, more...)
+		}
+	}
+	return files.NewFilter(rules)
+}
+
 func appendStdinAsFile(args []files.File, stdin *os.File) ([]files.File, *os.File) {
 	arg := files.NewReaderFile("", stdin, nil)
 	return append(args, arg), nil
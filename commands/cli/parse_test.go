@@ -70,6 +70,7 @@ func TestOptionParsing(t *testing.T) {
 		Options: []commands.Option{
 			commands.StringOption("string", "s", "a string"),
 			commands.BoolOption("bool", "b", "a bool"),
+			commands.OptionIgnore,
 		},
 		Subcommands: map[string]*commands.Command{
 			"test": subCmd,
@@ -112,11 +113,15 @@ func TestOptionParsing(t *testing.T) {
 	test("-b foo", kvs{"b": ""}, words{"foo"})
 	test("--bool foo", kvs{"bool": ""}, words{"foo"})
 	testFail("--bool=foo")
+	test("--bool=false", kvs{"bool": "false"}, words{})
+	test("-b=true foo", kvs{"b": "true"}, words{"foo"})
 	testFail("--string")
 	test("--string foo", kvs{"string": "foo"}, words{})
 	test("--string=foo", kvs{"string": "foo"}, words{})
 	test("-- -b", kvs{}, words{"-b"})
 	test("foo -b", kvs{"b": ""}, words{"foo"})
+	testFail("--string foo --string bar")
+	test("--ignore *.o --ignore=.git/ foo", kvs{"ignore": "*.o\n.git/"}, words{"foo"})
 }
 
 func TestArgumentParsing(t *testing.T) {
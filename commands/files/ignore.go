@@ -0,0 +1,139 @@
+package files
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	fp "path"
+	"strings"
+)
+
+// IgnoreFile is the name of the files holding the rules of the files to
+// leave out of their directory, and of those under it.
+const IgnoreFile = ".ipfsignore"
+
+// Filter leaves out of the directories the files matching its rules, which
+// are globs, one per line, in the manner of a .gitignore:
+//
+//	*.o          any file named *.o, at any depth
+//	build/       any directory named build, but not files
+//	/dist        dist, at the root of the directory added, only
+//	doc/*.tmp    the *.tmp files of doc, at the root
+//
+// Blank lines and those starting with "#" are left out.
+type Filter struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	// base is the directory the rule was read in, relative to the root of
+	// the directory added.
+	base    string
+	pattern string
+	// anchored rules match the path relative to base, the others the
+	// name of the file.
+	anchored bool
+	dirOnly  bool
+}
+
+// NewFilter returns a Filter of rules.
+func NewFilter(rules []string) (*Filter, error) {
+	return new(Filter).with("", rules)
+}
+
+// with returns f, and the rules read in the directory base.
+func (f *Filter) with(base string, rules []string) (*Filter, error) {
+	out := &Filter{rules: append([]ignoreRule(nil), f.rules...)}
+	for _, r := range rules {
+		r = strings.TrimSpace(r)
+		if r == "" || strings.HasPrefix(r, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasSuffix(r, "/") {
+			rule.dirOnly = true
+			r = strings.TrimRight(r, "/")
+		}
+		if strings.Contains(r, "/") {
+			rule.anchored = true
+			r = strings.TrimLeft(r, "/")
+		}
+		if r == "" {
+			continue
+		}
+		if _, err := fp.Match(r, ""); err != nil {
+			return nil, fmt.Errorf("invalid ignore rule %q: %s", r, err)
+		}
+		rule.pattern = r
+		out.rules = append(out.rules, rule)
+	}
+	return out, nil
+}
+
+// Ignored returns whether the file of path, relative to the root of the
+// directory added, is left out.
+func (f *Filter) Ignored(path string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	for _, r := range f.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+
+		name := fp.Base(path)
+		if r.anchored {
+			if r.base != "" {
+				if !strings.HasPrefix(path, r.base+"/") {
+					continue
+				}
+				name = strings.TrimPrefix(path, r.base+"/")
+			} else {
+				name = path
+			}
+		} else if r.base != "" && !strings.HasPrefix(path, r.base+"/") {
+			continue
+		}
+
+		if ok, _ := fp.Match(r.pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadFilterRules returns the rules of the file name, one per line.
+func ReadFilterRules(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		rules = append(rules, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// dirFilter returns f, and the rules of the IgnoreFile of the directory
+// dir, at rel under the root of the directory added. It is nil if f is.
+func (f *Filter) dirFilter(dir, rel string) (*Filter, error) {
+	if f == nil {
+		return nil, nil
+	}
+	rules, err := ReadFilterRules(fp.Join(dir, IgnoreFile))
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.with(rel, rules)
+}
@@ -0,0 +1,127 @@
+package files
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	fp "path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFilterIgnored(t *testing.T) {
+	f, err := NewFilter([]string{"# build artifacts", "*.o", "build/", "/dist", "doc/*.tmp", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err = f.with("src", []string{"gen.go", "/local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"main.o", false, true},
+		{"a/b/main.o", false, true},
+		{"main.go", false, false},
+		{"build", true, true},
+		{"a/build", true, true},
+		{"build", false, false},
+		{"dist", true, true},
+		{"a/dist", true, false},
+		{"doc/a.tmp", false, true},
+		{"a/doc/a.tmp", false, false},
+		{"src/gen.go", false, true},
+		{"src/a/gen.go", false, true},
+		{"gen.go", false, false},
+		{"src/local", true, true},
+		{"local", true, false},
+	} {
+		if got := f.Ignored(c.path, c.isDir); got != c.ignored {
+			t.Errorf("%s: expected ignored to be %t", c.path, c.ignored)
+		}
+	}
+
+	if _, err := NewFilter([]string{"[a-"}); err == nil {
+		t.Fatal("expected a malformed glob to be invalid")
+	}
+}
+
+func TestFilteredSerialFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serialfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, data := range map[string]string{
+		"a.txt":            "a",
+		"a.o":              "object",
+		".git/HEAD":        "ref",
+		"sub/b.txt":        "b",
+		"sub/secret":       "secret",
+		"sub/.ipfsignore":  "secret\n",
+		"sub/deep/secret":  "secret",
+		"sub/deep/c.txt":   "c",
+		"other/secret":     "not ignored here",
+		"other/keep/a.txt": "a",
+	} {
+		name = fp.Join(dir, name)
+		if err := os.MkdirAll(fp.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter, err := NewFilter([]string{"*.o", ".git/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := NewFilteredSerialFile(dir, file, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	var walk func(f File)
+	walk = func(f File) {
+		for {
+			child, err := f.NextFile()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, strings.TrimPrefix(child.FileName(), dir+"/"))
+			if child.IsDirectory() {
+				walk(child)
+			}
+		}
+	}
+	walk(sf)
+	sort.Strings(names)
+
+	expected := []string{"a.txt", "other", "other/keep", "other/keep/a.txt", "other/secret", "sub", "sub/.ipfsignore", "sub/b.txt", "sub/deep", "sub/deep/c.txt"}
+	if strings.Join(names, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected the files %v, got %v", expected, names)
+	}
+
+	size, err := sf.(SizeFile).Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len("a")+len("not ignored here")+len("a")+len("secret\n")+len("b")+len("c")) {
+		t.Fatalf("expected the size of the files not ignored, got %d", size)
+	}
+}
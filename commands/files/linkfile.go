@@ -0,0 +1,50 @@
+package files
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// Symlink implements File for a symbolic link. Reading it yields the
+// path the link points to, which is how links travel in multipart data.
+type Symlink struct {
+	name   string
+	Target string
+	stat   os.FileInfo
+
+	reader io.Reader
+}
+
+func NewLinkFile(name, target string, stat os.FileInfo) File {
+	return &Symlink{
+		name:   name,
+		Target: target,
+		stat:   stat,
+		reader: strings.NewReader(target),
+	}
+}
+
+func (lf *Symlink) IsDirectory() bool {
+	return false
+}
+
+func (lf *Symlink) NextFile() (File, error) {
+	return nil, ErrNotDirectory
+}
+
+func (lf *Symlink) FileName() string {
+	return lf.name
+}
+
+func (lf *Symlink) Read(b []byte) (int, error) {
+	return lf.reader.Read(b)
+}
+
+func (lf *Symlink) Close() error {
+	return nil
+}
+
+func (lf *Symlink) Stat() os.FileInfo {
+	return lf.stat
+}
@@ -1,19 +1,35 @@
 package files
 
 import (
+	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
+	"time"
 )
 
 const (
 	multipartFormdataType = "multipart/form-data"
 	multipartMixedType    = "multipart/mixed"
 
+	// applicationSymlink is the type of a part holding a symlink, whose
+	// body is the link target.
+	applicationSymlink = "application/symlink"
+
 	contentTypeHeader = "Content-Type"
 )
 
+// The headers of a part carrying the permission bits (in octal) and the
+// modification time (in seconds since the Unix epoch) of its file, when
+// they are known.
+const (
+	ModeHeader  = "Ipfs-File-Mode"
+	MtimeHeader = "Ipfs-File-Mtime"
+)
+
 // MultipartFile implements File, and is created from a `multipart.Part`.
 // It can be either a directory or file (checked by calling `IsDirectory()`).
 type MultipartFile struct {
@@ -38,6 +54,14 @@ func NewFileFromPart(part *multipart.Part) (File, error) {
 		return nil, err
 	}
 
+	if f.Mediatype == applicationSymlink {
+		target, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		return NewLinkFile(f.FileName(), string(target), f.Stat()), nil
+	}
+
 	if f.IsDirectory() {
 		boundary, found := params["boundary"]
 		if !found {
@@ -76,6 +100,31 @@ func (f *MultipartFile) FileName() string {
 	return filename
 }
 
+// Stat returns the mode and modification time sent with the part, or nil
+// if the part has none.
+func (f *MultipartFile) Stat() os.FileInfo {
+	mode, err := strconv.ParseUint(f.Part.Header.Get(ModeHeader), 8, 32)
+	if err != nil {
+		return nil
+	}
+	mtime, err := strconv.ParseInt(f.Part.Header.Get(MtimeHeader), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	fi := &partInfo{
+		name:  f.FileName(),
+		mode:  os.FileMode(mode).Perm(),
+		mtime: time.Unix(mtime, 0),
+	}
+	if f.IsDirectory() {
+		fi.mode |= os.ModeDir
+	} else if f.Mediatype == applicationSymlink {
+		fi.mode |= os.ModeSymlink
+	}
+	return fi
+}
+
 func (f *MultipartFile) Read(p []byte) (int, error) {
 	if f.IsDirectory() {
 		return 0, ErrNotReader
@@ -89,3 +138,17 @@ func (f *MultipartFile) Close() error {
 	}
 	return f.Part.Close()
 }
+
+// partInfo is the os.FileInfo of a part, as far as its headers tell.
+type partInfo struct {
+	name  string
+	mode  os.FileMode
+	mtime time.Time
+}
+
+func (fi *partInfo) Name() string       { return fi.name }
+func (fi *partInfo) Size() int64        { return 0 }
+func (fi *partInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *partInfo) ModTime() time.Time { return fi.mtime }
+func (fi *partInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *partInfo) Sys() interface{}   { return nil }
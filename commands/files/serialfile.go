@@ -22,18 +22,30 @@ type serialFile struct {
 	files   []os.FileInfo
 	stat    os.FileInfo
 	current *os.File
+
+	// filter leaves files out of the directory, if not nil; rel is the
+	// path of the directory under the root of the one added.
+	filter *Filter
+	rel    string
 }
 
 func NewSerialFile(path string, file *os.File) (File, error) {
+	return NewFilteredSerialFile(path, file, nil)
+}
+
+// NewFilteredSerialFile is like NewSerialFile, but leaves out of the
+// directories the files filter ignores, and those the IgnoreFile of their
+// directory does. With a nil filter, no file is left out.
+func NewFilteredSerialFile(path string, file *os.File, filter *Filter) (File, error) {
 	stat, err := file.Stat()
 	if err != nil {
 		return nil, err
 	}
 
-	return newSerialFile(path, file, stat)
+	return newSerialFile(path, file, stat, filter, "")
 }
 
-func newSerialFile(path string, file *os.File, stat os.FileInfo) (File, error) {
+func newSerialFile(path string, file *os.File, stat os.FileInfo, filter *Filter, rel string) (File, error) {
 	// for non-directories, return a ReaderFile
 	if !stat.IsDir() {
 		return &ReaderFile{path, file, stat}, nil
@@ -56,7 +68,12 @@ func newSerialFile(path string, file *os.File, stat os.FileInfo) (File, error) {
 	// make sure contents are sorted so -- repeatably -- we get the same inputs.
 	sort.Sort(sortFIByName(contents))
 
-	return &serialFile{path, contents, stat, nil}, nil
+	filter, err = filter.dirFilter(path, rel)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serialFile{path, contents, stat, nil, filter, rel}, nil
 }
 
 func (f *serialFile) IsDirectory() bool {
@@ -72,6 +89,11 @@ func (f *serialFile) NextFile() (File, error) {
 		return nil, err
 	}
 
+	// skip the files left out
+	for len(f.files) > 0 && f.filter.Ignored(fp.Join(f.rel, f.files[0].Name()), f.files[0].IsDir()) {
+		f.files = f.files[1:]
+	}
+
 	// if there aren't any files left in the root directory, we're done
 	if len(f.files) == 0 {
 		return nil, io.EOF
@@ -80,8 +102,18 @@ func (f *serialFile) NextFile() (File, error) {
 	stat := f.files[0]
 	f.files = f.files[1:]
 
-	// open the next file
+	// symlinks are kept as links, rather than followed
 	filePath := fp.Join(f.path, stat.Name())
+	if stat.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return nil, err
+		}
+		f.current = nil
+		return NewLinkFile(filePath, target, stat), nil
+	}
+
+	// open the next file
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
@@ -91,7 +123,11 @@ func (f *serialFile) NextFile() (File, error) {
 	// recursively call the constructor on the next file
 	// if it's a regular file, we will open it as a ReaderFile
 	// if it's a directory, files in it will be opened serially
-	return newSerialFile(filePath, file, stat)
+	if stat.IsDir() {
+		// the constructor closes directories once read
+		f.current = nil
+	}
+	return newSerialFile(filePath, file, stat, f.filter, fp.Join(f.rel, stat.Name()))
 }
 
 func (f *serialFile) FileName() string {
@@ -120,14 +156,19 @@ func (f *serialFile) Stat() os.FileInfo {
 }
 
 func (f *serialFile) Size() (int64, error) {
-	return size(f.stat, f.FileName())
+	return size(f.stat, f.FileName(), f.filter, f.rel)
 }
 
-func size(stat os.FileInfo, filename string) (int64, error) {
+func size(stat os.FileInfo, filename string, filter *Filter, rel string) (int64, error) {
 	if !stat.IsDir() {
 		return stat.Size(), nil
 	}
 
+	filter, err := filter.dirFilter(filename, rel)
+	if err != nil {
+		return 0, err
+	}
+
 	file, err := os.Open(filename)
 	if err != nil {
 		return 0, err
@@ -140,7 +181,11 @@ func size(stat os.FileInfo, filename string) (int64, error) {
 
 	var output int64
 	for _, child := range files {
-		s, err := size(child, fp.Join(filename, child.Name()))
+		childRel := fp.Join(rel, child.Name())
+		if filter.Ignored(childRel, child.IsDir()) {
+			continue
+		}
+		s, err := size(child, fp.Join(filename, child.Name()), filter, childRel)
 		if err != nil {
 			return 0, err
 		}
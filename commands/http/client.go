@@ -27,10 +27,17 @@ type Client interface {
 
 type client struct {
 	serverAddress string
+	authorization string
 }
 
 func NewClient(address string) Client {
-	return &client{address}
+	return &client{serverAddress: address}
+}
+
+// NewAuthClient returns a Client which presents authorization, the value
+// of an Authorization header, to the server.
+func NewAuthClient(address, authorization string) Client {
+	return &client{serverAddress: address, authorization: authorization}
 }
 
 func (c *client) Send(req cmds.Request) (cmds.Response, error) {
@@ -81,6 +88,9 @@ func (c *client) Send(req cmds.Request) (cmds.Response, error) {
 	}
 	version := config.CurrentVersionNumber
 	httpReq.Header.Set("User-Agent", fmt.Sprintf("/go-ipfs/%s/", version))
+	if c.authorization != "" {
+		httpReq.Header.Set("Authorization", c.authorization)
+	}
 
 	ec := make(chan error, 1)
 	rc := make(chan cmds.Response, 1)
@@ -160,7 +170,7 @@ func getResponse(httpRes *http.Response, req cmds.Request) (cmds.Response, error
 	contentType := httpRes.Header.Get(contentTypeHeader)
 	contentType = strings.Split(contentType, ";")[0]
 
-	lengthHeader := httpRes.Header.Get(contentLengthHeader)
+	lengthHeader := httpRes.Header.Get(extraContentLengthHeader)
 	if len(lengthHeader) > 0 {
 		length, err := strconv.ParseUint(lengthHeader, 10, 64)
 		if err != nil {
@@ -183,6 +193,18 @@ func getResponse(httpRes *http.Response, req cmds.Request) (cmds.Response, error
 
 			ctx := req.Context().Context
 
+			// closing the body once cancelled ends the wait for the next
+			// value, which may never come
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				select {
+				case <-ctx.Done():
+					httpRes.Body.Close()
+				case <-done:
+				}
+			}()
+
 			for {
 				var v interface{}
 				var err error
@@ -192,10 +214,6 @@ func getResponse(httpRes *http.Response, req cmds.Request) (cmds.Response, error
 				} else {
 					err = dec.Decode(&v)
 				}
-				if err != nil && err != io.EOF {
-					fmt.Println(err.Error())
-					return
-				}
 
 				select {
 				case <-ctx.Done():
@@ -204,6 +222,11 @@ func getResponse(httpRes *http.Response, req cmds.Request) (cmds.Response, error
 				default:
 				}
 
+				if err != nil && err != io.EOF {
+					fmt.Println(err.Error())
+					return
+				}
+
 				if err == io.EOF {
 					close(outChan)
 					return
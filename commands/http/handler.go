@@ -1,10 +1,14 @@
 package http
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -12,33 +16,59 @@ import (
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
-	u "github.com/ipfs/go-ipfs/util"
+	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
 )
 
-var log = u.Logger("commands/http")
+var log = eventlog.Logger("commands/http")
 
 // the internal handler for the API
 type internalHandler struct {
-	ctx  cmds.Context
-	root *cmds.Command
+	ctx    cmds.Context
+	root   *cmds.Command
+	config func() *ServerConfig
 }
 
 // The Handler struct is funny because we want to wrap our internal handler
 // with CORS while keeping our fields.
 type Handler struct {
 	internalHandler
-	corsHandler http.Handler
+}
+
+// ServerConfig is the HTTP configuration of a Handler.
+type ServerConfig struct {
+	// Headers are set on every response.
+	Headers map[string][]string
+
+	// AllowedOrigins are the origins cross-origin requests are allowed
+	// from, "*" allowing any.
+	AllowedOrigins []string
+	// AllowedMethods are the methods cross-origin requests may use.
+	AllowedMethods []string
+	// AllowedHeaders are the headers cross-origin requests may send.
+	AllowedHeaders []string
+}
+
+// allowsOrigin returns whether cross-origin requests from origin are
+// allowed.
+func (cfg *ServerConfig) allowsOrigin(origin string) bool {
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
 }
 
 var ErrNotFound = errors.New("404 page not found")
 
 const (
-	streamHeader           = "X-Stream-Output"
-	channelHeader          = "X-Chunked-Output"
-	contentTypeHeader      = "Content-Type"
-	contentLengthHeader    = "Content-Length"
-	transferEncodingHeader = "Transfer-Encoding"
-	applicationJson        = "application/json"
+	streamHeader             = "X-Stream-Output"
+	traceHeader              = "X-Ipfs-Trace-Id"
+	channelHeader            = "X-Chunked-Output"
+	contentTypeHeader        = "Content-Type"
+	extraContentLengthHeader = "X-Content-Length"
+	transferEncodingHeader   = "Transfer-Encoding"
+	applicationJson          = "application/json"
 )
 
 var mimeTypes = map[string]string{
@@ -47,34 +77,24 @@ var mimeTypes = map[string]string{
 	cmds.Text: "text/plain",
 }
 
-func NewHandler(ctx cmds.Context, root *cmds.Command, allowedOrigin string) *Handler {
-	// allow whitelisted origins (so we can make API requests from the browser)
-	if len(allowedOrigin) > 0 {
-		log.Info("Allowing API requests from origin: " + allowedOrigin)
-	}
-
-	// Create a handler for the API.
-	internal := internalHandler{ctx, root}
-
-	// Create a CORS object for wrapping the internal handler.
-	c := cors.New(cors.Options{
-		AllowedMethods: []string{"GET", "POST", "PUT"},
-
-		// use AllowOriginFunc instead of AllowedOrigins because we want to be
-		// restrictive by default.
-		AllowOriginFunc: func(origin string) bool {
-			return (allowedOrigin == "*") || (origin == allowedOrigin)
-		},
-	})
+// NewHandler returns a Handler of the commands of root, configured by
+// cfg.
+func NewHandler(ctx cmds.Context, root *cmds.Command, cfg *ServerConfig) *Handler {
+	return NewDynamicHandler(ctx, root, func() *ServerConfig { return cfg })
+}
 
-	// Wrap the internal handler with CORS handling-middleware.
-	return &Handler{internal, c.Handler(internal)}
+// NewDynamicHandler returns a Handler configured by what config returns
+// as each request comes, so that its configuration can change while it
+// serves.
+func NewDynamicHandler(ctx cmds.Context, root *cmds.Command, config func() *ServerConfig) *Handler {
+	return &Handler{internalHandler{ctx, root, config}}
 }
 
 func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Debug("Incoming API request: ", r.URL)
 
-	// error on external referers (to prevent CSRF attacks)
+	// error on external referers (to prevent CSRF attacks), unless they
+	// are allowed origins.
 	referer := r.Referer()
 	scheme := r.URL.Scheme
 	if len(scheme) == 0 {
@@ -82,7 +102,7 @@ func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	host := fmt.Sprintf("%s://%s/", scheme, r.Host)
 	// empty string means the user isn't following a link (they are directly typing in the url)
-	if referer != "" && !strings.HasPrefix(referer, host) {
+	if referer != "" && !strings.HasPrefix(referer, host) && !i.allowsReferer(referer) {
 		w.WriteHeader(http.StatusForbidden)
 		w.Write([]byte("403 - Forbidden"))
 		return
@@ -108,6 +128,34 @@ func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	ctx, cancel := context.WithCancel(node.Context())
 	defer cancel()
+	// a timeout bounds the whole request, the output included.
+	timeout, err := cmds.Timeout(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// the request is over too when the client goes away, which streaming
+	// commands would not notice until they next write. That is only seen
+	// once the body is read, so only for requests without one: the body
+	// of others is for the command to read, as it goes.
+	var clientGone func()
+	if r.ContentLength == 0 {
+		clientGone = cancel
+		if cn, ok := w.(http.CloseNotifier); ok {
+			closed := cn.CloseNotify()
+			go func() {
+				select {
+				case <-closed:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+		}
+	}
 	/*
 		TODO(cryptix): the next line looks very fishy to me..
 		It looks like the the context for the command request beeing prepared here is shared across all incoming requests..
@@ -118,7 +166,25 @@ func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		ps: take note of the name clash - commands.Context != context.Context
 	*/
-	i.ctx.Context = ctx
+
+	// the trace ID of the request is in the events logged for it,
+	// including those of the core operations it runs with ctx.
+	traceID := r.Header.Get(traceHeader)
+	if traceID == "" {
+		traceID = newTraceID()
+	}
+	w.Header().Set(traceHeader, traceID)
+	// a new variable, as the goroutine watching for the client to go away
+	// still reads ctx
+	tctx := eventlog.ContextWithLoggable(ctx, eventlog.LoggableMap{"trace": traceID})
+	defer log.EventBegin(tctx, "apiRequest", eventlog.LoggableMap{
+		"command": strings.Join(req.Path(), "/"),
+	}).Done()
+	if i.ctx.ReqLog != nil {
+		defer i.ctx.ReqLog.Add(req, traceID).Finish()
+	}
+
+	i.ctx.Context = tctx
 	req.SetContext(i.ctx)
 
 	// call the command
@@ -142,9 +208,11 @@ func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(contentTypeHeader, mime)
 	}
 
-	// set the Content-Length from the response length
+	// send the response length as a hint rather than as Content-Length,
+	// which must match the body exactly and so can't be used for
+	// streams like archives.
 	if res.Length() > 0 {
-		w.Header().Set(contentLengthHeader, strconv.FormatUint(res.Length(), 10))
+		w.Header().Set(extraContentLengthHeader, strconv.FormatUint(res.Length(), 10))
 	}
 
 	// if response contains an error, write an HTTP error status code
@@ -176,26 +244,63 @@ func (i internalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		// w.WriteString(transferEncodingHeader + ": chunked\r\n")
 		// w.Header().Set(channelHeader, "1")
 		// w.WriteHeader(200)
-		err = copyChunks(applicationJson, w, out)
+		err = copyChunks(applicationJson, w, out, clientGone)
 		if err != nil {
 			log.Debug(err)
 		}
 		return
 	}
 
-	flushCopy(w, out)
+	flushCopy(w, out, clientGone)
+}
+
+// newTraceID returns a random ID for a request without one.
+func newTraceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		log.Debugf("Error generating trace ID: %s", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// allowsReferer returns whether the page at referer is of an allowed
+// origin.
+func (i internalHandler) allowsReferer(referer string) bool {
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return i.config().allowsOrigin(u.Scheme + "://" + u.Host)
 }
 
 func (i Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Call the CORS handler which wraps the internal handler.
-	i.corsHandler.ServeHTTP(w, r)
+	cfg := i.config()
+	for k, v := range cfg.Headers {
+		w.Header()[k] = v
+	}
+
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{"GET", "POST", "PUT"}
+	}
+	c := cors.New(cors.Options{
+		AllowedMethods: methods,
+		AllowedHeaders: cfg.AllowedHeaders,
+
+		// use AllowOriginFunc instead of AllowedOrigins because we want to be
+		// restrictive by default.
+		AllowOriginFunc: cfg.allowsOrigin,
+	})
+
+	// Wrap the internal handler with CORS handling-middleware.
+	c.Handler(i.internalHandler).ServeHTTP(w, r)
 }
 
 // flushCopy Copies from an io.Reader to a http.ResponseWriter.
 // Flushes chunks over HTTP stream as they are read (if supported by transport).
-func flushCopy(w http.ResponseWriter, out io.Reader) error {
+func flushCopy(w http.ResponseWriter, out io.Reader, clientGone func()) error {
 	if _, ok := w.(http.Flusher); !ok {
-		return copyChunks("", w, out)
+		return copyChunks("", w, out, clientGone)
 	}
 
 	io.Copy(&flushResponse{w}, out)
@@ -204,7 +309,9 @@ func flushCopy(w http.ResponseWriter, out io.Reader) error {
 
 // Copies from an io.Reader to a http.ResponseWriter.
 // Flushes chunks over HTTP stream as they are read (if supported by transport).
-func copyChunks(contentType string, w http.ResponseWriter, out io.Reader) error {
+// clientGone, if not nil, is called if the client closes the connection
+// first; the request body must have been read then.
+func copyChunks(contentType string, w http.ResponseWriter, out io.Reader, clientGone func()) error {
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
 		return errors.New("Could not create hijacker")
@@ -215,6 +322,15 @@ func copyChunks(contentType string, w http.ResponseWriter, out io.Reader) error
 	}
 	defer conn.Close()
 
+	// the server no longer watches the hijacked connection; nothing more
+	// is read from it, so a read only returns once it's closed
+	if clientGone != nil {
+		go func() {
+			io.Copy(ioutil.Discard, writer.Reader)
+			clientGone()
+		}()
+	}
+
 	writer.WriteString("HTTP/1.1 200 OK\r\n")
 	if contentType != "" {
 		writer.WriteString(contentTypeHeader + ": " + contentType + "\r\n")
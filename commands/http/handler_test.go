@@ -1,11 +1,21 @@
 package http
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	"github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
 )
 
 func assertHeaders(t *testing.T, resHeaders http.Header, reqHeaders map[string]string) {
@@ -21,7 +31,7 @@ func TestDisallowedOrigin(t *testing.T) {
 	req, _ := http.NewRequest("GET", "http://example.com/foo", nil)
 	req.Header.Add("Origin", "http://barbaz.com")
 
-	handler := NewHandler(commands.Context{}, nil, "")
+	handler := NewHandler(commands.Context{}, nil, &ServerConfig{})
 	handler.ServeHTTP(res, req)
 
 	assertHeaders(t, res.Header(), map[string]string{
@@ -38,7 +48,7 @@ func TestWildcardOrigin(t *testing.T) {
 	req, _ := http.NewRequest("GET", "http://example.com/foo", nil)
 	req.Header.Add("Origin", "http://foobar.com")
 
-	handler := NewHandler(commands.Context{}, nil, "*")
+	handler := NewHandler(commands.Context{}, nil, &ServerConfig{AllowedOrigins: []string{"*"}})
 	handler.ServeHTTP(res, req)
 
 	assertHeaders(t, res.Header(), map[string]string{
@@ -57,7 +67,7 @@ func TestAllowedMethod(t *testing.T) {
 	req.Header.Add("Origin", "http://www.foobar.com")
 	req.Header.Add("Access-Control-Request-Method", "PUT")
 
-	handler := NewHandler(commands.Context{}, nil, "http://www.foobar.com")
+	handler := NewHandler(commands.Context{}, nil, &ServerConfig{AllowedOrigins: []string{"http://www.foobar.com"}})
 	handler.ServeHTTP(res, req)
 
 	assertHeaders(t, res.Header(), map[string]string{
@@ -69,3 +79,156 @@ func TestAllowedMethod(t *testing.T) {
 		"Access-Control-Expose-Headers":    "",
 	})
 }
+
+func TestConfiguredHeaders(t *testing.T) {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "http://example.com/foo", nil)
+	req.Header.Add("Origin", "http://www.foobar.com")
+	req.Header.Add("Access-Control-Request-Method", "DELETE")
+	req.Header.Add("Access-Control-Request-Headers", "Authorization")
+
+	handler := NewHandler(commands.Context{}, nil, &ServerConfig{
+		Headers:        map[string][]string{"X-Served-By": []string{"ipfs"}},
+		AllowedOrigins: []string{"http://www.foobar.com"},
+		AllowedMethods: []string{"DELETE"},
+		AllowedHeaders: []string{"Authorization"},
+	})
+	handler.ServeHTTP(res, req)
+
+	assertHeaders(t, res.Header(), map[string]string{
+		"X-Served-By":                  "ipfs",
+		"Access-Control-Allow-Origin":  "http://www.foobar.com",
+		"Access-Control-Allow-Methods": "DELETE",
+		"Access-Control-Allow-Headers": "Authorization",
+	})
+}
+
+func TestDynamicConfig(t *testing.T) {
+	cfg := &ServerConfig{}
+	handler := NewDynamicHandler(commands.Context{}, nil, func() *ServerConfig { return cfg })
+
+	get := func() http.Header {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		req.Header.Add("Origin", "http://foobar.com")
+		handler.ServeHTTP(res, req)
+		return res.Header()
+	}
+
+	assertHeaders(t, get(), map[string]string{"Access-Control-Allow-Origin": ""})
+	cfg = &ServerConfig{AllowedOrigins: []string{"http://foobar.com"}}
+	assertHeaders(t, get(), map[string]string{"Access-Control-Allow-Origin": "http://foobar.com"})
+}
+
+func TestAllowedReferer(t *testing.T) {
+	handler := NewHandler(commands.Context{}, nil, &ServerConfig{AllowedOrigins: []string{"http://app.example.org"}})
+	for referer, allowed := range map[string]bool{
+		"http://app.example.org/page": true,
+		"http://evil.example.org/":    false,
+	} {
+		i := handler.internalHandler
+		if got := i.allowsReferer(referer); got != allowed {
+			t.Errorf("referer %s: expected allowed %v, got %v", referer, allowed, got)
+		}
+	}
+}
+
+// testServer serves root over HTTP, with a node to run the commands on.
+func testServer(t *testing.T, root *commands.Command) *httptest.Server {
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cctx := commands.Context{
+		ConstructNode: func() (*core.IpfsNode, error) { return n, nil },
+	}
+	return httptest.NewServer(NewHandler(cctx, root, &ServerConfig{}))
+}
+
+func TestClientGoneCancels(t *testing.T) {
+	cancelled := make(chan struct{})
+	root := &commands.Command{
+		Subcommands: map[string]*commands.Command{
+			"wait": {
+				Run: func(req commands.Request, res commands.Response) {
+					out := make(chan interface{})
+					res.SetOutput((<-chan interface{})(out))
+					go func() {
+						defer close(out)
+						out <- "waiting"
+						<-req.Context().Context.Done()
+						close(cancelled)
+					}()
+				},
+			},
+		},
+	}
+	s := testServer(t, root)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "POST %s/wait?stream-channels=true HTTP/1.1\r\nHost: %s\r\nContent-Length: 0\r\n\r\n", ApiPath, s.Listener.Addr())
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(line, "200") {
+		t.Fatalf("expected the command to run, got %q", line)
+	}
+	conn.Close()
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command kept running once the client was gone")
+	}
+}
+
+// TestBodyLeftToCommand checks the body of a request is left for the
+// command to read.
+func TestBodyLeftToCommand(t *testing.T) {
+	root := &commands.Command{
+		Subcommands: map[string]*commands.Command{
+			"cat": {
+				Arguments: []commands.Argument{
+					commands.FileArg("file", true, false, ""),
+				},
+				Run: func(req commands.Request, res commands.Response) {
+					f, err := req.Files().NextFile()
+					if err != nil {
+						res.SetError(err, commands.ErrNormal)
+						return
+					}
+					res.SetOutput(f)
+				},
+			},
+		},
+	}
+	s := testServer(t, root)
+	defer s.Close()
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("file", "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("the contents of the file"))
+	mw.Close()
+
+	res, err := http.Post(s.URL+ApiPath+"/cat", mw.FormDataContentType(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	got, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "the contents of the file" {
+		t.Fatalf("expected the file back, got %q", got)
+	}
+}
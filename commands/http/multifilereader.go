@@ -7,6 +7,7 @@ import (
 	"mime/multipart"
 	"net/textproto"
 	"net/url"
+	"strconv"
 	"sync"
 
 	files "github.com/ipfs/go-ipfs/commands/files"
@@ -86,10 +87,18 @@ func (mfr *MultiFileReader) Read(buf []byte) (written int, err error) {
 			if file.IsDirectory() {
 				boundary := mfr.currentFile.(*MultiFileReader).Boundary()
 				header.Set("Content-Type", fmt.Sprintf("multipart/mixed; boundary=%s", boundary))
+			} else if _, ok := file.(*files.Symlink); ok {
+				header.Set("Content-Type", "application/symlink")
 			} else {
 				header.Set("Content-Type", "application/octet-stream")
 			}
 
+			if sf, ok := file.(files.StatFile); ok && sf.Stat() != nil {
+				stat := sf.Stat()
+				header.Set(files.ModeHeader, strconv.FormatUint(uint64(stat.Mode().Perm()), 8))
+				header.Set(files.MtimeHeader, strconv.FormatInt(stat.ModTime().Unix(), 10))
+			}
+
 			_, err := mfr.mpWriter.CreatePart(header)
 			if err != nil {
 				return 0, err
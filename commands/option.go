@@ -1,7 +1,9 @@
 package commands
 
 import (
+	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/ipfs/go-ipfs/util"
 )
@@ -154,25 +156,49 @@ func (ov OptionValue) String() (value string, found bool, err error) {
 
 // Flag names
 const (
-	EncShort = "enc"
-	EncLong  = "encoding"
-	RecShort = "r"
-	RecLong  = "recursive"
-	ChanOpt  = "stream-channels"
+	EncShort       = "enc"
+	EncLong        = "encoding"
+	RecShort       = "r"
+	RecLong        = "recursive"
+	ChanOpt        = "stream-channels"
+	TimeoutOpt     = "timeout"
+	IgnoreOpt      = "ignore"
+	IgnoreRulesOpt = "ignore-rules-path"
 )
 
 // options that are used by this package
 var OptionEncodingType = StringOption(EncShort, EncLong, "The encoding type the output should be encoded with (json, xml, or text)")
 var OptionRecursivePath = BoolOption(RecShort, RecLong, "Add directory paths recursively")
+var OptionIgnore = StringOption(IgnoreOpt, "A glob of the files to leave out of the directories, like *.o or .git/; repeat it for more")
+var OptionIgnoreRulesPath = StringOption(IgnoreRulesOpt, "A file of more globs to leave out of the directories, one per line")
 var OptionStreamChannels = BoolOption(ChanOpt, "Stream channel output")
+var OptionTimeout = StringOption(TimeoutOpt, "Fail the command if it takes longer than this duration, e.g. 30s or 5m")
 
 // global options, added to every command
 var globalOptions = []Option{
 	OptionEncodingType,
 	OptionStreamChannels,
+	OptionTimeout,
 }
 
 // the above array of Options, wrapped in a Command
 var globalCommand = &Command{
 	Options: globalOptions,
 }
+
+// Timeout returns the duration of the timeout option of req, 0 if it has
+// none.
+func Timeout(req Request) (time.Duration, error) {
+	s, found, err := req.Option(TimeoutOpt).String()
+	if err != nil || !found || s == "" {
+		return 0, err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %s", s, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q: it must be positive", s)
+	}
+	return d, nil
+}
@@ -1,6 +1,9 @@
 package commands
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestOptionValueExtractBoolNotFound(t *testing.T) {
 	t.Log("ensure that no error is returned when value is not found")
@@ -34,3 +37,34 @@ func TestOptionValueExtractWrongType(t *testing.T) {
 		t.Fatal("No error returned. Failure.")
 	}
 }
+
+func TestTimeout(t *testing.T) {
+	optDefs := map[string]Option{TimeoutOpt: OptionTimeout}
+	for opt, expected := range map[string]time.Duration{
+		"":      0,
+		"30s":   30 * time.Second,
+		"1m30s": 90 * time.Second,
+	} {
+		req, err := NewRequest(nil, OptMap{TimeoutOpt: opt}, nil, nil, nil, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := Timeout(req)
+		if err != nil {
+			t.Fatalf("%q: %s", opt, err)
+		}
+		if d != expected {
+			t.Fatalf("%q: expected %s, got %s", opt, expected, d)
+		}
+	}
+
+	for _, opt := range []string{"soon", "-1s", "0s"} {
+		req, err := NewRequest(nil, OptMap{TimeoutOpt: opt}, nil, nil, nil, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Timeout(req); err == nil {
+			t.Fatalf("expected the timeout %q to be invalid", opt)
+		}
+	}
+}
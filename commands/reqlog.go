@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultReqLogKeep is how long a ReqLog keeps finished requests by
+// default.
+const defaultReqLogKeep = time.Minute
+
+// ReqLogEntry is a command request, in flight or finished.
+type ReqLogEntry struct {
+	ID        int
+	TraceID   string
+	Command   string
+	Args      []string
+	Options   map[string]interface{}
+	StartTime time.Time
+	// EndTime is zero while the request is Active.
+	EndTime time.Time
+	Active  bool
+
+	log *ReqLog
+}
+
+// Finish marks the request done. It's then kept for the keep time of
+// the log.
+func (e *ReqLogEntry) Finish() {
+	e.log.lk.Lock()
+	defer e.log.lk.Unlock()
+
+	e.Active = false
+	e.EndTime = time.Now()
+}
+
+// ReqLog tracks the command requests of a process, for 'ipfs diag cmds'.
+// It is safe for concurrent use; the zero value is ready to use.
+type ReqLog struct {
+	lk       sync.Mutex
+	requests []*ReqLogEntry
+	nextID   int
+	keep     time.Duration
+	keepSet  bool
+}
+
+// Add records req as in flight, under traceID, and returns its entry, which
+// must be finished once the request is done.
+func (rl *ReqLog) Add(req Request, traceID string) *ReqLogEntry {
+	rl.lk.Lock()
+	defer rl.lk.Unlock()
+
+	rl.clearOld()
+	opts := make(map[string]interface{})
+	for k, v := range req.Options() {
+		opts[k] = v
+	}
+	e := &ReqLogEntry{
+		ID:        rl.nextID,
+		TraceID:   traceID,
+		Command:   strings.Join(req.Path(), "/"),
+		Args:      req.Arguments(),
+		Options:   opts,
+		StartTime: time.Now(),
+		Active:    true,
+		log:       rl,
+	}
+	rl.nextID++
+	rl.requests = append(rl.requests, e)
+	return e
+}
+
+// ClearInactive forgets the finished requests.
+func (rl *ReqLog) ClearInactive() {
+	rl.lk.Lock()
+	defer rl.lk.Unlock()
+
+	active := rl.requests[:0]
+	for _, e := range rl.requests {
+		if e.Active {
+			active = append(active, e)
+		}
+	}
+	rl.requests = active
+}
+
+// SetKeepTime sets how long finished requests are kept.
+func (rl *ReqLog) SetKeepTime(t time.Duration) {
+	rl.lk.Lock()
+	defer rl.lk.Unlock()
+
+	rl.keep = t
+	rl.keepSet = true
+}
+
+// Report returns copies of the requests in flight, and of those finished
+// within the keep time, oldest first.
+func (rl *ReqLog) Report() []ReqLogEntry {
+	rl.lk.Lock()
+	defer rl.lk.Unlock()
+
+	rl.clearOld()
+	out := make([]ReqLogEntry, len(rl.requests))
+	for i, e := range rl.requests {
+		out[i] = *e
+		out[i].log = nil
+	}
+	return out
+}
+
+// clearOld forgets the requests finished before the keep time. rl.lk must
+// be held.
+func (rl *ReqLog) clearOld() {
+	keep := rl.keep
+	if !rl.keepSet {
+		keep = defaultReqLogKeep
+	}
+	cutoff := time.Now().Add(-keep)
+
+	kept := rl.requests[:0]
+	for _, e := range rl.requests {
+		if e.Active || e.EndTime.After(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+	rl.requests = kept
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReqLog(t *testing.T) {
+	req, err := NewRequest([]string{"diag", "cmds"}, OptMap{"v": true}, []string{"a"}, nil, &Command{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rl ReqLog
+	e := rl.Add(req, "trace1")
+	rl.Add(req, "trace2")
+
+	report := rl.Report()
+	if len(report) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(report))
+	}
+	if r := report[0]; r.ID != 0 || r.TraceID != "trace1" || r.Command != "diag/cmds" || !r.Active {
+		t.Fatalf("wrong entry: %+v", r)
+	}
+	if report[0].Options["v"] != true || report[0].Args[0] != "a" {
+		t.Fatalf("wrong options or arguments: %+v", report[0])
+	}
+
+	e.Finish()
+	report = rl.Report()
+	if len(report) != 2 || report[0].Active || report[0].EndTime.IsZero() {
+		t.Fatal("finished request should be kept, inactive")
+	}
+
+	rl.ClearInactive()
+	report = rl.Report()
+	if len(report) != 1 || report[0].TraceID != "trace2" {
+		t.Fatal("only the active request should be left")
+	}
+}
+
+func TestReqLogKeepTime(t *testing.T) {
+	req, err := NewEmptyRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rl ReqLog
+	rl.SetKeepTime(0)
+	rl.Add(req, "").Finish()
+	time.Sleep(time.Millisecond)
+	if n := len(rl.Report()); n != 0 {
+		t.Fatalf("finished request should be forgotten, got %d", n)
+	}
+}
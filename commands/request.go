@@ -30,6 +30,9 @@ type Context struct {
 
 	node          *core.IpfsNode
 	ConstructNode func() (*core.IpfsNode, error)
+
+	// ReqLog, when set, tracks the requests served with this Context.
+	ReqLog *ReqLog
 }
 
 // GetConfig returns the config of the current Command exection
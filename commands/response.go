@@ -97,7 +97,9 @@ type Response interface {
 	SetOutput(interface{})
 	Output() interface{}
 
-	// Sets/Returns the length of the output
+	// Sets/Returns the length of the output. For streams whose encoded
+	// size isn't known up front (e.g. archives), it is the size of the
+	// data they carry, and serves as a progress hint.
 	SetLength(uint64)
 	Length() uint64
 
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -10,7 +12,9 @@ import (
 
 	host "github.com/ipfs/go-ipfs/p2p/host"
 	inet "github.com/ipfs/go-ipfs/p2p/net"
+	pnet "github.com/ipfs/go-ipfs/p2p/net/pnet"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	repo "github.com/ipfs/go-ipfs/repo"
 	config "github.com/ipfs/go-ipfs/repo/config"
 	math2 "github.com/ipfs/go-ipfs/thirdparty/math2"
 	lgbl "github.com/ipfs/go-ipfs/util/eventlog/loggables"
@@ -233,3 +237,25 @@ func randomSubsetOfPeers(in []peer.PeerInfo, max int) []peer.PeerInfo {
 	}
 	return out
 }
+
+// PNetFingerprint returns the fingerprint of the key of the private
+// network r limits the node to, in hexadecimal, as the lists of
+// config.PrivateBootstrap are keyed by, or "" if r has no swarm.key.
+func PNetFingerprint(r repo.Repo) (string, error) {
+	swarmkey, err := r.SwarmKey()
+	if err != nil || swarmkey == nil {
+		return "", err
+	}
+	psk, err := pnet.DecodeV1PSK(bytes.NewReader(swarmkey))
+	if err != nil {
+		return "", err
+	}
+	return pnetFingerprint(psk), nil
+}
+
+func pnetFingerprint(psk *pnet.PSK) string {
+	if psk == nil {
+		return ""
+	}
+	return hex.EncodeToString(psk.Fingerprint())
+}
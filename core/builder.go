@@ -24,6 +24,9 @@ type NodeBuilder struct {
 	repo     repo.Repo
 	built    bool
 	nilrepo  bool
+	pubsub   bool
+	nspubsub bool
+	identity string
 }
 
 func NewNodeBuilder() *NodeBuilder {
@@ -87,6 +90,26 @@ func (nb *NodeBuilder) SetRepo(r repo.Repo) *NodeBuilder {
 	return nb
 }
 
+// Pubsub has the node run floodsub when online, for 'ipfs pubsub'.
+func (nb *NodeBuilder) Pubsub() *NodeBuilder {
+	nb.pubsub = true
+	return nb
+}
+
+// NamesysPubsub has the node publish IPNS records over floodsub too, and
+// follow the names it resolves there, when online.
+func (nb *NodeBuilder) NamesysPubsub() *NodeBuilder {
+	nb.nspubsub = true
+	return nb
+}
+
+// SetIdentity has the node run as the key name of the keystore, rather
+// than as the identity of the config.
+func (nb *NodeBuilder) SetIdentity(name string) *NodeBuilder {
+	nb.identity = name
+	return nb
+}
+
 func (nb *NodeBuilder) NilRepo() *NodeBuilder {
 	nb.nilrepo = true
 	return nb
@@ -109,6 +132,6 @@ func (nb *NodeBuilder) Build(ctx context.Context) (*IpfsNode, error) {
 		}
 		nb.repo = r
 	}
-	conf := standardWithRouting(nb.repo, nb.online, nb.routing, nb.peerhost)
+	conf := standardWithRouting(nb.repo, nb.online, nb.routing, nb.peerhost, nb.pubsub, nb.nspubsub, nb.identity)
 	return NewIPFSNode(ctx, conf)
 }
@@ -1,22 +1,37 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/cheggaaa/pb"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	bserv "github.com/ipfs/go-ipfs/blockservice"
 	cmds "github.com/ipfs/go-ipfs/commands"
 	files "github.com/ipfs/go-ipfs/commands/files"
 	core "github.com/ipfs/go-ipfs/core"
-	coreunix "github.com/ipfs/go-ipfs/core/coreunix"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	offline "github.com/ipfs/go-ipfs/exchange/offline"
+	filestore "github.com/ipfs/go-ipfs/filestore"
 	importer "github.com/ipfs/go-ipfs/importer"
+	bal "github.com/ipfs/go-ipfs/importer/balanced"
 	"github.com/ipfs/go-ipfs/importer/chunk"
+	h "github.com/ipfs/go-ipfs/importer/helpers"
+	trickle "github.com/ipfs/go-ipfs/importer/trickle"
 	dag "github.com/ipfs/go-ipfs/merkledag"
 	pin "github.com/ipfs/go-ipfs/pin"
 	ft "github.com/ipfs/go-ipfs/unixfs"
+	hamt "github.com/ipfs/go-ipfs/unixfs/hamt"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -27,15 +42,37 @@ var ErrDepthLimitExceeded = fmt.Errorf("depth limit exceeded")
 const progressReaderIncrement = 1024 * 256
 
 const (
+	quietOptionName    = "quiet"
+	silentOptionName   = "silent"
 	progressOptionName = "progress"
 	trickleOptionName  = "trickle"
+	sparseOptionName   = "sparse"
 	wrapOptionName     = "wrap-with-directory"
+	preserveOptionName = "preserve-metadata"
+	shardingOptionName = "enable-sharding"
+	chunkerOptionName  = "chunker"
+	nocopyOptionName   = "nocopy"
+	hashOptionName     = "hash"
+	stdinNameOption    = "stdin-name"
+	transactionalName  = "transactional"
 )
 
+// directories with more entries than this are sharded with --enable-sharding
+const shardThreshold = 1000
+
+// AddedObject is what 'ipfs add' streams out: one for each file and
+// directory once it's added, with its hash, and, with --progress, ones
+// without a hash as the files are read.
 type AddedObject struct {
-	Name  string
-	Hash  string `json:",omitempty"`
-	Bytes int64  `json:",omitempty"`
+	Name string
+	Hash string `json:",omitempty"`
+
+	// Bytes is how much of the file was read so far, or, once it's added,
+	// its size.
+	Bytes int64 `json:",omitempty"`
+
+	// Total is how much of all the files being added was read so far.
+	Total int64 `json:",omitempty"`
 }
 
 var AddCmd = &cmds.Command{
@@ -46,6 +83,81 @@ Adds contents of <path> to ipfs. Use -r to add directories.
 Note that directories are added recursively, to form the ipfs
 MerkleDAG. A smarter partial add with a staging area (like git)
 remains to be implemented.
+
+With --nocopy, the data of the files is not copied into the repo: the
+repo records where in each file its blocks are, and reads them from
+there. The files must be given by absolute path, readable by the daemon,
+and left as they are; see 'ipfs filestore' to check on them.
+
+With --wrap-with-directory, each file is wrapped in a directory object
+holding it under its name, so the hash of the directory and the name
+lead to it: <dir hash>/<name>. Content read from stdin has no name, which
+--stdin-name gives it, as in:
+
+  > echo "hello" | ipfs add -w --stdin-name=hello.txt
+  added QmU5PLEGqjetW4RAmXgHpEFL7nVCL3vFnEyrCKUfRk4MSq/hello.txt hello.txt
+
+The files of the directories added which match an --ignore glob, or
+those of the file of --ignore-rules-path, are left out, as are those
+matching the rules of the .ipfsignore files of the directories. Rules
+are in the manner of a .gitignore, one per line: '*.o' matches files at
+any depth, 'build/' directories only, and '/dist' or 'doc/*.tmp' paths
+from the directory the rule was read in.
+
+Each file and directory is printed as it's added, under a progress bar
+for the whole add. With --quiet, only the hashes are printed, and with
+--silent, nothing is. Over the API, --progress streams the progress as
+objects with no hash, giving how much of the current file and of all the
+files was read so far.
+
+With --only-hash, the hashes the files would get are printed, but no
+block is written to the repo, and nothing is announced to the network:
+it tells whether content is already published without adding it.
+
+With --preserve-metadata, the permission bits and modification time of
+each file and directory are recorded, and 'ipfs get' restores them. The
+recorded values are part of the objects, so the same files added with and
+without it have different hashes.
+
+With --enable-sharding, directories with more than 1000 entries are
+stored as sharded directories, spread over many objects rather than one
+that lists every entry. 'ipfs ls', 'ipfs get', 'ipfs cat' and the gateway
+read them like any other directory.
+
+--chunker picks how files are split into blocks: 'size-<bytes>' splits
+them into blocks of a fixed size (size-262144 by default), and
+'rabin-<min>-<avg>-<max>' splits them where their contents say to, into
+blocks of <min> to <max> bytes, <avg> on average. With rabin, a file that
+changed in a few places (insertions included) keeps most of its
+blocks, so new versions take little space and transfer quickly.
+
+With --trickle, files are laid out as a trickle-dag rather than a
+balanced tree: the first blocks of a file hang right off its root, and
+each later run of blocks sits one level deeper than the one before it.
+Reading a file from the start then needs few round trips before data
+flows, which suits files that are streamed, such as audio and video
+played with 'ipfs cat <hash> | mplayer -'.
+
+With --sparse, the blocks of a file holding only zeros are not stored:
+the runs of them are recorded by their size, in small blocks holding no
+data, so disk images and other files with large empty regions take
+little space in the repo. Such files get other hashes than when added
+without --sparse. 'ipfs get' writes the long runs of zeros of any file
+as holes, leaving sparse files on filesystems which support them.
+
+With --transactional, the add is all or nothing: the blocks are staged
+apart from the repo, and the pins held back, until every file is added,
+and only then are they moved into the repo and pinned. If the add fails
+partway, say when the disk is full or a file can't be read, the blocks
+staged are discarded at once, rather than lingering until the next
+garbage collection. Those of an add interrupted by a crash are discarded
+by the next 'ipfs repo gc'. The files printed before a failure are not
+kept.
+
+--hash picks the multihash function the objects are hashed with, among
+sha1, sha2-256 (the default), sha2-512, and sha3-224, sha3-256, sha3-384
+and sha3-512. The same files hashed with different functions get
+different hashes, and share no blocks.
 `,
 	},
 
@@ -54,14 +166,27 @@ remains to be implemented.
 	},
 	Options: []cmds.Option{
 		cmds.OptionRecursivePath, // a builtin option that allows recursive paths (-r, --recursive)
-		cmds.BoolOption("quiet", "q", "Write minimal output"),
+		cmds.OptionIgnore,        // builtin options that leave files out of the directories
+		cmds.OptionIgnoreRulesPath,
+		cmds.BoolOption(quietOptionName, "q", "Write only the hashes of the objects added"),
+		cmds.BoolOption(silentOptionName, "Write no output"),
 		cmds.BoolOption(progressOptionName, "p", "Stream progress data"),
 		cmds.BoolOption(wrapOptionName, "w", "Wrap files with a directory object"),
 		cmds.BoolOption(trickleOptionName, "t", "Use trickle-dag format for dag generation"),
+		cmds.BoolOption(sparseOptionName, "Record the blocks of zeros by their size rather than store them"),
 		cmds.BoolOption("only-hash", "n", "Only chunk and hash the specified content, don't write to disk"),
+		cmds.BoolOption(preserveOptionName, "Record file modes and modification times"),
+		cmds.BoolOption(shardingOptionName, "Shard directories with many entries"),
+		cmds.StringOption(chunkerOptionName, "s", "Chunking algorithm: size-<bytes> or rabin-<min>-<avg>-<max>"),
+		cmds.BoolOption(nocopyOptionName, "Add files by reference, without copying their data into the repo"),
+		cmds.StringOption(hashOptionName, "Hash function to use: sha2-256 (default), sha3-256, sha3-512, ..."),
+		cmds.StringOption(stdinNameOption, "The name of the content read from stdin"),
+		cmds.BoolOption(transactionalName, "Add all the files or none, discarding the blocks of a failed add"),
 	},
 	PreRun: func(req cmds.Request) error {
-		if quiet, _, _ := req.Option("quiet").Bool(); quiet {
+		quiet, _, _ := req.Option(quietOptionName).Bool()
+		silent, _, _ := req.Option(silentOptionName).Bool()
+		if quiet || silent {
 			return nil
 		}
 
@@ -92,8 +217,50 @@ remains to be implemented.
 
 		progress, _, _ := req.Option(progressOptionName).Bool()
 		trickle, _, _ := req.Option(trickleOptionName).Bool()
+		sparse, _, _ := req.Option(sparseOptionName).Bool()
 		wrap, _, _ := req.Option(wrapOptionName).Bool()
 		hash, _, _ := req.Option("only-hash").Bool()
+		preserve, _, _ := req.Option(preserveOptionName).Bool()
+		shard, _, _ := req.Option(shardingOptionName).Bool()
+		chunker, _, _ := req.Option(chunkerOptionName).String()
+		nocopy, _, _ := req.Option(nocopyOptionName).Bool()
+		hashName, _, _ := req.Option(hashOptionName).String()
+		stdinName, _, _ := req.Option(stdinNameOption).String()
+		transactional, _, _ := req.Option(transactionalName).Bool()
+
+		if stdinName != "" && (strings.Contains(stdinName, "/") || stdinName == "." || stdinName == "..") {
+			res.SetError(fmt.Errorf("invalid --%s %q: it must be a file name, not a path", stdinNameOption, stdinName), cmds.ErrClient)
+			return
+		}
+
+		if shard {
+			if err := requireExperiment(n, "Sharding"); err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+		}
+		if nocopy {
+			if err := requireExperiment(n, "Filestore"); err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+			if transactional {
+				res.SetError(fmt.Errorf("--%s can't be used with --%s", transactionalName, nocopyOptionName), cmds.ErrClient)
+				return
+			}
+		}
+
+		spl, err := chunk.FromString(chunker)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		hashType, err := hashCode(hashName)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
 
 		if hash {
 			nilnode, err := core.NewNodeBuilder().NilRepo().Build(n.Context())
@@ -107,9 +274,58 @@ remains to be implemented.
 		outChan := make(chan interface{}, 8)
 		res.SetOutput((<-chan interface{})(outChan))
 
+		a := &adder{
+			node:     n,
+			out:      outChan,
+			progress: progress,
+			trickle:  trickle,
+			sparse:   sparse,
+			spl:      spl,
+			preserve: preserve,
+			shard:    shard,
+			nocopy:   nocopy,
+			hashType: hashType,
+			dag:      n.DAG,
+			pins:     n.Pinning.GetManual(),
+		}
+
+		// with --only-hash, nothing is written anyway
+		var stage *bstore.Staging
+		var pins *stagedPins
+		if transactional && !hash {
+			stage, err = bstore.NewStaging(n.Repo.Datastore(), n.Blockstore)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			bsrv, err := bserv.New(stage, offline.Exchange(stage))
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			a.dag = dag.NewDAGService(bsrv)
+			pins = &stagedPins{ManualPinner: a.pins}
+			a.pins = pins
+		}
+		if hashType != mh.SHA2_256 {
+			a.dag = hashingDAG{a.dag, hashType}
+		}
+
 		go func() {
 			defer close(outChan)
+			// gc waits for the files added to be pinned
+			defer n.GCLocker.PinLock()()
+			if stage != nil {
+				// a no-op once committed
+				defer func() {
+					if err := stage.Discard(); err != nil {
+						log.Errorf("discarding the blocks staged: %s", err)
+					}
+				}()
+			}
 
+			// the roots pinned, staged until the commit
+			var pinned []key.Key
 			for {
 				file, err := req.Files().NextFile()
 				if err != nil && err != io.EOF {
@@ -117,10 +333,14 @@ remains to be implemented.
 					return
 				}
 				if file == nil { // done
-					return
+					break
+				}
+				if file.FileName() == "" && stdinName != "" {
+					// the content read from stdin
+					file = &namedFile{file, stdinName}
 				}
 
-				rootnd, err := addFile(n, file, outChan, progress, wrap, trickle)
+				rootnd, err := a.addFile(file, wrap)
 				if err != nil {
 					res.SetError(err, cmds.ErrNormal)
 					return
@@ -132,16 +352,40 @@ remains to be implemented.
 					return
 				}
 
-				mp := n.Pinning.GetManual()
-				mp.RemovePinWithMode(rnk, pin.Indirect)
-				mp.PinWithMode(rnk, pin.Recursive)
+				a.pins.RemovePinWithMode(rnk, pin.Indirect)
+				a.pins.PinWithMode(rnk, pin.Recursive)
+				if stage != nil {
+					pinned = append(pinned, rnk)
+					continue
+				}
 
 				err = n.Pinning.Flush()
 				if err != nil {
 					res.SetError(err, cmds.ErrNormal)
 					return
 				}
+				if !hash {
+					corerepo.NotifyPinned(n, []key.Key{rnk}, true)
+				}
 			}
+
+			if stage == nil {
+				return
+			}
+			err := stage.Commit(func(b *blocks.Block) error {
+				_, err := n.Blocks.AddBlock(b)
+				return err
+			})
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			pins.commit()
+			if err := n.Pinning.Flush(); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			corerepo.NotifyPinned(n, pinned, true)
 		}()
 	},
 	PostRun: func(req cmds.Request, res cmds.Response) {
@@ -155,11 +399,21 @@ remains to be implemented.
 		}
 		res.SetOutput(nil)
 
-		quiet, _, err := req.Option("quiet").Bool()
+		quiet, _, err := req.Option(quietOptionName).Bool()
 		if err != nil {
 			res.SetError(u.ErrCast(), cmds.ErrNormal)
 			return
 		}
+		silent, _, err := req.Option(silentOptionName).Bool()
+		if err != nil {
+			res.SetError(u.ErrCast(), cmds.ErrNormal)
+			return
+		}
+		if silent {
+			for _ = range outChan {
+			}
+			return
+		}
 
 		size := int64(0)
 		s, found := req.Values()["size"]
@@ -187,9 +441,6 @@ remains to be implemented.
 			bar.Update()
 		}
 
-		lastFile := ""
-		var totalProgress, prevFiles, lastBytes int64
-
 		for out := range outChan {
 			output := out.(*AddedObject)
 			if len(output.Hash) > 0 {
@@ -205,21 +456,10 @@ remains to be implemented.
 
 			} else {
 				log.Debugf("add progress: %v %v\n", output.Name, output.Bytes)
+			}
 
-				if !showProgressBar {
-					continue
-				}
-
-				if len(lastFile) == 0 {
-					lastFile = output.Name
-				}
-				if output.Name != lastFile || output.Bytes < lastBytes {
-					prevFiles += lastBytes
-					lastFile = output.Name
-				}
-				lastBytes = output.Bytes
-				delta := prevFiles + lastBytes - totalProgress
-				totalProgress = bar.Add64(delta)
+			if showProgressBar && output.Total > 0 {
+				bar.Set64(output.Total)
 			}
 
 			if showProgressBar {
@@ -230,23 +470,50 @@ remains to be implemented.
 	Type: AddedObject{},
 }
 
-func add(n *core.IpfsNode, reader io.Reader, useTrickle bool) (*dag.Node, error) {
+// adder adds the files of one 'ipfs add', with the options it was given.
+type adder struct {
+	node     *core.IpfsNode
+	out      chan interface{}
+	progress bool
+	trickle  bool
+	sparse   bool
+	spl      chunk.BlockSplitter
+	preserve bool
+	shard    bool
+	nocopy   bool
+	hashType int
+
+	// dag is where the nodes are added, hashed with hashType
+	dag dag.DAGService
+	// pins is where the nodes added are pinned
+	pins pin.ManualPinner
+
+	// total counts the bytes read from all files so far
+	total int64
+}
+
+func (a *adder) add(reader io.Reader, dserv dag.DAGService, stat os.FileInfo) (*dag.Node, error) {
+	dbp := h.DagBuilderParams{
+		Dagserv:  dserv,
+		Maxlinks: h.DefaultLinksPerBlock,
+		NodeCB:   importer.PinIndirectCB(a.pins),
+		HashType: a.hashType,
+		Sparse:   a.sparse,
+	}
+	if a.preserve && stat != nil {
+		// the root is added with the stat in it, not added again
+		dbp.RootData = func(data []byte) ([]byte, error) {
+			return ft.SetStat(data, stat.Mode(), stat.ModTime())
+		}
+	}
+	blkch := a.spl.Split(reader)
+
 	var node *dag.Node
 	var err error
-	if useTrickle {
-		node, err = importer.BuildTrickleDagFromReader(
-			reader,
-			n.DAG,
-			chunk.DefaultSplitter,
-			importer.PinIndirectCB(n.Pinning.GetManual()),
-		)
+	if a.trickle {
+		node, err = trickle.TrickleLayout(dbp.New(blkch))
 	} else {
-		node, err = importer.BuildDagFromReader(
-			reader,
-			n.DAG,
-			chunk.DefaultSplitter,
-			importer.PinIndirectCB(n.Pinning.GetManual()),
-		)
+		node, err = bal.BalancedLayout(dbp.New(blkch))
 	}
 
 	if err != nil {
@@ -256,47 +523,75 @@ func add(n *core.IpfsNode, reader io.Reader, useTrickle bool) (*dag.Node, error)
 	return node, nil
 }
 
-func addFile(n *core.IpfsNode, file files.File, out chan interface{}, progress bool, wrap bool, useTrickle bool) (*dag.Node, error) {
+func (a *adder) addFile(file files.File, wrap bool) (*dag.Node, error) {
 	if file.IsDirectory() {
-		return addDir(n, file, out, progress, useTrickle)
+		return a.addDir(file)
 	}
 
-	// if the progress flag was specified, wrap the file so that we can send
-	// progress updates to the client (over the output channel)
-	var reader io.Reader = file
-	if progress {
-		reader = &progressReader{file: file, out: out}
-	}
-
-	if wrap {
-		p, dagnode, err := coreunix.AddWrapped(n, reader, path.Base(file.FileName()))
+	if s, ok := file.(*files.Symlink); ok {
+		dagnode, err := a.addSymlink(s)
 		if err != nil {
 			return nil, err
 		}
-		out <- &AddedObject{
-			Hash: p,
-			Name: file.FileName(),
+		if err := a.output(file.FileName(), dagnode, 0); err != nil {
+			return nil, err
 		}
 		return dagnode, nil
 	}
 
-	dagnode, err := add(n, reader, useTrickle)
+	// count what's read, and send progress updates to the client (over
+	// the output channel) if the progress flag was specified
+	reader := &progressReader{file: file, adder: a}
+
+	if !a.nocopy {
+		dagnode, err := a.add(reader, a.dag, fileStat(file))
+		if err != nil {
+			return nil, err
+		}
+		return a.addedFile(file, wrap, dagnode, reader.bytes)
+	}
+
+	fpath := file.FileName()
+	if !filepath.IsAbs(fpath) {
+		return nil, fmt.Errorf("--nocopy needs the absolute path of each file, got %s", fpath)
+	}
+	if _, err := os.Stat(fpath); err != nil {
+		return nil, fmt.Errorf("--nocopy needs files the daemon can read: %s", err)
+	}
+
+	held := &nocopyDAG{DAGService: a.dag, leaves: make(map[key.Key]*heldLeaf)}
+	dagnode, err := a.add(reader, held, fileStat(file))
 	if err != nil {
 		return nil, err
 	}
+	if err := held.record(a.node.Context(), a.node.Filestore, fpath, dagnode, 0); err != nil {
+		return nil, err
+	}
+	return a.addedFile(file, wrap, dagnode, reader.bytes)
+}
+
+// addedFile finishes adding the file whose contents were added as
+// dagnode.
+func (a *adder) addedFile(file files.File, wrap bool, dagnode *dag.Node, size int64) (*dag.Node, error) {
+	if wrap {
+		if file.FileName() == "" {
+			return nil, fmt.Errorf("the content read from stdin needs a name to be wrapped with a directory, give it with --%s", stdinNameOption)
+		}
+		return a.addWrapped(file.FileName(), dagnode, size)
+	}
 
 	log.Infof("adding file: %s", file.FileName())
-	if err := outputDagnode(out, file.FileName(), dagnode); err != nil {
+	if err := a.output(file.FileName(), dagnode, size); err != nil {
 		return nil, err
 	}
 	return dagnode, nil
 }
 
-func addDir(n *core.IpfsNode, dir files.File, out chan interface{}, progress bool, useTrickle bool) (*dag.Node, error) {
+func (a *adder) addDir(dir files.File) (*dag.Node, error) {
 	log.Infof("adding directory: %s", dir.FileName())
 
-	tree := &dag.Node{Data: ft.FolderPBData()}
-
+	var names []string
+	var nodes []*dag.Node
 	for {
 		file, err := dir.NextFile()
 		if err != nil && err != io.EOF {
@@ -306,52 +601,315 @@ func addDir(n *core.IpfsNode, dir files.File, out chan interface{}, progress boo
 			break
 		}
 
-		node, err := addFile(n, file, out, progress, false, useTrickle)
+		node, err := a.addFile(file, false)
 		if err != nil {
 			return nil, err
 		}
 
 		_, name := path.Split(file.FileName())
+		names = append(names, name)
+		nodes = append(nodes, node)
+	}
+
+	var tree *dag.Node
+	var err error
+	if a.shard && len(nodes) > shardThreshold {
+		tree, err = a.addShardedDir(dir, names, nodes)
+	} else {
+		tree, err = a.addPlainDir(dir, names, nodes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.output(dir.FileName(), tree, 0)
+	if err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
 
-		err = tree.AddNodeLink(name, node)
+func (a *adder) addPlainDir(dir files.File, names []string, nodes []*dag.Node) (*dag.Node, error) {
+	tree := &dag.Node{Data: ft.FolderPBData()}
+	if stat := fileStat(dir); a.preserve && stat != nil {
+		data, err := ft.SetStat(tree.Data, stat.Mode(), stat.ModTime())
 		if err != nil {
 			return nil, err
 		}
+		tree.Data = data
+	}
+
+	for i, node := range nodes {
+		if err := tree.AddNodeLink(names[i], node); err != nil {
+			return nil, err
+		}
 	}
 
-	err := outputDagnode(out, dir.FileName(), tree)
+	k, err := a.dag.Add(tree)
 	if err != nil {
 		return nil, err
 	}
 
-	k, err := n.DAG.Add(tree)
+	a.pins.PinWithMode(k, pin.Indirect)
+	return tree, nil
+}
+
+func (a *adder) addShardedDir(dir files.File, names []string, nodes []*dag.Node) (*dag.Node, error) {
+	n := a.node
+	// every shard is stored, and needs pinning, not only the root
+	shard, err := hamt.NewShard(pinningDAG{a.dag, a.pins}, hamt.DefaultShardWidth)
 	if err != nil {
 		return nil, err
 	}
+	if stat := fileStat(dir); a.preserve && stat != nil {
+		shard.SetStat(stat.Mode(), stat.ModTime())
+	}
 
-	n.Pinning.GetManual().PinWithMode(k, pin.Indirect)
+	for i, node := range nodes {
+		if err := shard.Set(n.Context(), names[i], node); err != nil {
+			return nil, err
+		}
+	}
+	return shard.Node()
+}
+
+// pinningDAG indirectly pins every node added through it.
+type pinningDAG struct {
+	dag.DAGService
+	mp pin.ManualPinner
+}
 
+func (p pinningDAG) Add(nd *dag.Node) (key.Key, error) {
+	k, err := p.DAGService.Add(nd)
+	if err != nil {
+		return "", err
+	}
+	p.mp.PinWithMode(k, pin.Indirect)
+	return k, nil
+}
+
+// stagedPins holds back the pins of a transactional add, until its blocks
+// are committed.
+type stagedPins struct {
+	pin.ManualPinner
+	ops []stagedPin
+}
+
+type stagedPin struct {
+	k      key.Key
+	mode   pin.PinMode
+	remove bool
+}
+
+func (p *stagedPins) PinWithMode(k key.Key, mode pin.PinMode) {
+	p.ops = append(p.ops, stagedPin{k: k, mode: mode})
+}
+
+func (p *stagedPins) RemovePinWithMode(k key.Key, mode pin.PinMode) {
+	p.ops = append(p.ops, stagedPin{k: k, mode: mode, remove: true})
+}
+
+// commit makes the pins held back, in order.
+func (p *stagedPins) commit() {
+	for _, op := range p.ops {
+		if op.remove {
+			p.ManualPinner.RemovePinWithMode(op.k, op.mode)
+		} else {
+			p.ManualPinner.PinWithMode(op.k, op.mode)
+		}
+	}
+	p.ops = nil
+}
+
+// hashingDAG hashes every node added through it with the function given
+// to --hash.
+type hashingDAG struct {
+	dag.DAGService
+	hashType int
+}
+
+func (d hashingDAG) Add(nd *dag.Node) (key.Key, error) {
+	nd.SetHashType(d.hashType)
+	return d.DAGService.Add(nd)
+}
+
+// nocopyDAG holds back the leaves of a file added with --nocopy. They go
+// in the filestore instead, once the file's DAG is complete and their
+// offsets in the file are known.
+type nocopyDAG struct {
+	dag.DAGService
+	leaves map[key.Key]*heldLeaf
+}
+
+type heldLeaf struct {
+	raw      bool
+	recorded bool
+}
+
+func (d *nocopyDAG) Add(nd *dag.Node) (key.Key, error) {
+	leaf, raw := filestore.IsLeaf(nd)
+	if !leaf {
+		return d.DAGService.Add(nd)
+	}
+
+	k, err := nd.Key()
+	if err != nil {
+		return "", err
+	}
+	d.leaves[k] = &heldLeaf{raw: raw}
+	return k, nil
+}
+
+// record walks the file DAG at nd, whose data starts at offset in the
+// file fpath, and records the leaves held back in fs.
+func (d *nocopyDAG) record(ctx context.Context, fs *filestore.Filestore, fpath string, nd *dag.Node, offset uint64) error {
+	pbd, err := ft.FromBytes(nd.Data)
+	if err != nil {
+		return err
+	}
+
+	k, err := nd.Key()
+	if err != nil {
+		return err
+	}
+	if l, ok := d.leaves[k]; ok {
+		return d.recordLeaf(fs, k, l, fpath, offset, uint64(len(pbd.GetData())))
+	}
+
+	if len(pbd.Blocksizes) != len(nd.Links) {
+		return errors.New("file node lacks a block size for some of its links")
+	}
+	offset += uint64(len(pbd.GetData())) + ft.HoleSize(pbd)
+	for i, lnk := range nd.Links {
+		size := pbd.Blocksizes[i]
+		k := key.Key(lnk.Hash)
+		if l, ok := d.leaves[k]; ok {
+			if err := d.recordLeaf(fs, k, l, fpath, offset, size); err != nil {
+				return err
+			}
+		} else {
+			child, err := lnk.GetNode(ctx, d.DAGService)
+			if err != nil {
+				return err
+			}
+			if err := d.record(ctx, fs, fpath, child, offset); err != nil {
+				return err
+			}
+		}
+		offset += size
+	}
+	return nil
+}
+
+func (d *nocopyDAG) recordLeaf(fs *filestore.Filestore, k key.Key, l *heldLeaf, fpath string, offset, size uint64) error {
+	if l.recorded {
+		// the same data is at more than one place in the file
+		return nil
+	}
+	l.recorded = true
+	return fs.Put(k, &filestore.DataObj{
+		FilePath: fpath,
+		Offset:   offset,
+		Size:     size,
+		Raw:      l.raw,
+	})
+}
+
+// addWrapped wraps the file just added in a directory, to keep its name.
+func (a *adder) addWrapped(name string, dagnode *dag.Node, size int64) (*dag.Node, error) {
+	base := path.Base(name)
+	tree := &dag.Node{Data: ft.FolderPBData()}
+	if err := tree.AddNodeLink(base, dagnode); err != nil {
+		return nil, err
+	}
+
+	k, err := a.dag.Add(tree)
+	if err != nil {
+		return nil, err
+	}
+	a.pins.PinWithMode(k, pin.Indirect)
+
+	a.out <- &AddedObject{
+		Hash:  path.Join(k.B58String(), base),
+		Name:  name,
+		Bytes: size,
+		Total: a.total,
+	}
 	return tree, nil
 }
 
-// outputDagnode sends dagnode info over the output channel
-func outputDagnode(out chan interface{}, name string, dn *dag.Node) error {
+// hashCode returns the code of the multihash function called name, one
+// that can be computed, or sha2-256 if name is empty.
+func hashCode(name string) (int, error) {
+	if name == "" {
+		return mh.SHA2_256, nil
+	}
+	code, ok := mh.Names[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown hash function %q", name)
+	}
+	if _, err := u.Sum(nil, code, -1); err != nil {
+		return 0, fmt.Errorf("hashing with %s is not supported", name)
+	}
+	return code, nil
+}
+
+// fileStat returns the stat of file, or nil if it has none.
+func fileStat(file files.File) os.FileInfo {
+	if sf, ok := file.(files.StatFile); ok {
+		return sf.Stat()
+	}
+	return nil
+}
+
+// addSymlink adds the node of a symlink, which holds its target rather
+// than the contents of the file it points to.
+func (a *adder) addSymlink(s *files.Symlink) (*dag.Node, error) {
+	sdata, err := ft.SymlinkData(s.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	dagnode := &dag.Node{Data: sdata}
+	k, err := a.dag.Add(dagnode)
+	if err != nil {
+		return nil, err
+	}
+
+	a.pins.PinWithMode(k, pin.Indirect)
+	return dagnode, nil
+}
+
+// output sends dagnode info over the output channel
+func (a *adder) output(name string, dn *dag.Node, size int64) error {
 	o, err := getOutput(dn)
 	if err != nil {
 		return err
 	}
 
-	out <- &AddedObject{
-		Hash: o.Hash,
-		Name: name,
+	a.out <- &AddedObject{
+		Hash:  o.Hash,
+		Name:  name,
+		Bytes: size,
+		Total: a.total,
 	}
 
 	return nil
 }
 
+// namedFile is a file under another name.
+type namedFile struct {
+	files.File
+	name string
+}
+
+func (f *namedFile) FileName() string {
+	return f.name
+}
+
 type progressReader struct {
 	file         files.File
-	out          chan interface{}
+	adder        *adder
 	bytes        int64
 	lastProgress int64
 }
@@ -360,11 +918,16 @@ func (i *progressReader) Read(p []byte) (int, error) {
 	n, err := i.file.Read(p)
 
 	i.bytes += int64(n)
+	i.adder.total += int64(n)
+	if !i.adder.progress {
+		return n, err
+	}
 	if i.bytes-i.lastProgress >= progressReaderIncrement || err == io.EOF {
 		i.lastProgress = i.bytes
-		i.out <- &AddedObject{
+		i.adder.out <- &AddedObject{
 			Name:  i.file.FileName(),
 			Bytes: i.bytes,
+			Total: i.adder.total,
 		}
 	}
 
@@ -0,0 +1,308 @@
+package commands
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	fp "path/filepath"
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	cmds "github.com/ipfs/go-ipfs/commands"
+	files "github.com/ipfs/go-ipfs/commands/files"
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/importer"
+	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	path "github.com/ipfs/go-ipfs/path"
+	tar "github.com/ipfs/go-ipfs/thirdparty/tar"
+	utar "github.com/ipfs/go-ipfs/unixfs/tar"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// TestAddPreserveRoundTrip adds a file with --preserve, and gets it back
+// with its mode and modification time.
+func TestAddPreserveRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	n, err := core.NewNodeBuilder().Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	dir, err := ioutil.TempDir("", "add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := []byte("the contents of the file")
+	in := fp.Join(dir, "in")
+	if err := ioutil.WriteFile(in, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(in, 0751); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2015, 10, 21, 16, 29, 0, 0, time.UTC)
+	if err := os.Chtimes(in, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	file, err := files.NewSerialFile(in, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &adder{
+		node:     n,
+		out:      make(chan interface{}, 1),
+		spl:      chunk.DefaultSplitter,
+		preserve: true,
+		dag:      n.DAG,
+		pins:     n.Pinning.GetManual(),
+	}
+	nd, err := a.addFile(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := nd.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !n.Pinning.IsPinned(k) {
+		t.Fatal("expected the root to be pinned")
+	}
+
+	// the root without the stat is never added
+	plain, err := importer.BuildDagFromReader(bytes.NewReader(data), mdtest.Mock(t), chunk.DefaultSplitter, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaink, err := plain.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaink == k {
+		t.Fatal("expected the stat to be in the root")
+	}
+	if has, _ := n.Blockstore.Has(plaink); has {
+		t.Fatal("expected no root without the stat in the blockstore")
+	}
+
+	entries := []utar.Entry{{Path: path.Path("/ipfs/" + k.B58String()), Node: nd}}
+	r, err := utar.NewTarReader(ctx, entries, n.DAG, gzip.NoCompression, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := fp.Join(dir, "out")
+	if err := (&tar.Extractor{Path: out}).Extract(r); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("the file got differs from the one added")
+	}
+	fi, err := os.Stat(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0751 || !fi.ModTime().Equal(mtime) {
+		t.Fatalf("expected mode 0751 and mtime %s, got %o and %s", mtime, fi.Mode().Perm(), fi.ModTime())
+	}
+}
+
+// TestAddWrappedLayout wraps a file with a directory, and expects the file
+// laid out with the chunker and layout given, as it is without wrapping.
+func TestAddWrappedLayout(t *testing.T) {
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(u.NewTimeSeededRand(), 100000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spl := &chunk.SizeSplitter{Size: 512}
+	for _, useTrickle := range []bool{false, true} {
+		a := &adder{
+			node:    n,
+			out:     make(chan interface{}, 1),
+			spl:     spl,
+			trickle: useTrickle,
+			dag:     n.DAG,
+			pins:    n.Pinning.GetManual(),
+		}
+		file := files.NewReaderFile("dir/file", ioutil.NopCloser(bytes.NewReader(data)), nil)
+		tree, err := a.addFile(file, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		added := (<-a.out).(*AddedObject)
+		if len(tree.Links) != 1 || tree.Links[0].Name != "file" {
+			t.Fatalf("expected the file wrapped under its name, got %v", tree.Links)
+		}
+		treek, err := tree.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added.Hash != treek.B58String()+"/file" {
+			t.Fatalf("expected the path of the wrapped file output, got %s", added.Hash)
+		}
+
+		build := importer.BuildDagFromReader
+		if useTrickle {
+			build = importer.BuildTrickleDagFromReader
+		}
+		expected, err := build(bytes.NewReader(data), mdtest.Mock(t), spl, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := expected.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tree.Links[0].Hash.B58String() != k.B58String() {
+			t.Fatalf("trickle %v: expected the wrapped file laid out as it is unwrapped", useTrickle)
+		}
+	}
+}
+
+// TestAddProgress adds two files with --progress, and expects the progress
+// of each file and of both streamed as they are read, then the size of
+// each file once added.
+func TestAddProgress(t *testing.T) {
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	sizes := map[string]int64{"dir/a": 3*progressReaderIncrement + 10, "dir/b": 1000}
+	var entries []files.File
+	for _, name := range []string{"dir/a", "dir/b"} {
+		data := make([]byte, sizes[name])
+		entries = append(entries, files.NewReaderFile(name, ioutil.NopCloser(bytes.NewReader(data)), nil))
+	}
+	dir := files.NewSliceFile("dir", entries)
+
+	a := &adder{
+		node:     n,
+		out:      make(chan interface{}),
+		progress: true,
+		spl:      chunk.DefaultSplitter,
+		dag:      n.DAG,
+		pins:     n.Pinning.GetManual(),
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.addFile(dir, false)
+		close(a.out)
+		done <- err
+	}()
+
+	var total, lastBytes int64
+	var lastName string
+	added := make(map[string]*AddedObject)
+	for v := range a.out {
+		o := v.(*AddedObject)
+		if o.Hash != "" {
+			added[o.Name] = o
+			continue
+		}
+		if o.Name != lastName {
+			lastName, lastBytes = o.Name, 0
+		}
+		if o.Bytes <= lastBytes || o.Total <= total {
+			t.Fatalf("expected the progress to grow, got %+v after %d of %s and %d in all", o, lastBytes, lastName, total)
+		}
+		lastBytes, total = o.Bytes, o.Total
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if total != sizes["dir/a"]+sizes["dir/b"] {
+		t.Fatalf("expected %d bytes read in all, got %d", sizes["dir/a"]+sizes["dir/b"], total)
+	}
+	for name, size := range sizes {
+		o, ok := added[name]
+		if !ok {
+			t.Fatalf("expected %s added", name)
+		}
+		if o.Bytes != size {
+			t.Fatalf("%s: expected its size %d, got %d", name, size, o.Bytes)
+		}
+	}
+	if added["dir/b"].Total != total {
+		t.Fatalf("expected the total read when the last file is added, got %d", added["dir/b"].Total)
+	}
+	if _, ok := added["dir"]; !ok {
+		t.Fatal("expected the directory added")
+	}
+}
+
+// TestAddSilent expects nothing written out by add --silent, and no
+// progress asked for.
+func TestAddSilent(t *testing.T) {
+	optDefs := make(map[string]cmds.Option)
+	for _, opt := range AddCmd.Options {
+		for _, name := range opt.Names() {
+			optDefs[name] = opt
+		}
+	}
+	req, err := cmds.NewRequest(nil, cmds.OptMap{silentOptionName: true}, nil, files.NewSliceFile("", nil), AddCmd, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AddCmd.PreRun(req); err != nil {
+		t.Fatal(err)
+	}
+	if progress, _, _ := req.Option(progressOptionName).Bool(); progress {
+		t.Fatal("expected no progress asked for with --silent")
+	}
+
+	stdout, err := ioutil.TempFile("", "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(stdout.Name())
+	defer stdout.Close()
+	orig := os.Stdout
+	os.Stdout = stdout
+	res := cmds.NewResponse(req)
+	os.Stdout = orig
+
+	outChan := make(chan interface{}, 2)
+	outChan <- &AddedObject{Name: "file", Hash: "QmFoo", Bytes: 3}
+	outChan <- &AddedObject{Name: "dir", Hash: "QmBar"}
+	close(outChan)
+	res.SetOutput((<-chan interface{})(outChan))
+	AddCmd.PostRun(req, res)
+
+	if res.Error() != nil {
+		t.Fatal(res.Error())
+	}
+	if len(outChan) != 0 {
+		t.Fatal("expected the output drained")
+	}
+	written, err := ioutil.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 0 {
+		t.Fatalf("expected nothing written, got %q", written)
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
+	decision "github.com/ipfs/go-ipfs/exchange/bitswap/decision"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	u "github.com/ipfs/go-ipfs/util"
 )
@@ -17,8 +18,10 @@ var BitswapCmd = &cmds.Command{
 		ShortDescription: ``,
 	},
 	Subcommands: map[string]*cmds.Command{
-		"wantlist": showWantlistCmd,
-		"stat":     bitswapStatCmd,
+		"wantlist":  showWantlistCmd,
+		"stat":      bitswapStatCmd,
+		"ledger":    ledgerCmd,
+		"reprovide": reprovideCmd,
 	},
 }
 
@@ -114,6 +117,8 @@ var bitswapStatCmd = &cmds.Command{
 			fmt.Fprintf(buf, "\tprovides buffer: %d / %d\n", out.ProvideBufLen, bitswap.HasBlockBufferSize)
 			fmt.Fprintf(buf, "\tblocks received: %d\n", out.BlocksReceived)
 			fmt.Fprintf(buf, "\tdup blocks received: %d\n", out.DupBlksReceived)
+			fmt.Fprintf(buf, "\tdata received: %d\n", out.DataReceived)
+			fmt.Fprintf(buf, "\tdup data received: %d\n", out.DupDataReceived)
 			fmt.Fprintf(buf, "\twantlist [%d keys]\n", len(out.Wantlist))
 			for _, k := range out.Wantlist {
 				fmt.Fprintf(buf, "\t\t%s\n", k.B58String())
@@ -126,3 +131,89 @@ var bitswapStatCmd = &cmds.Command{
 		},
 	},
 }
+
+var ledgerCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the current ledger for a peer",
+		ShortDescription: `
+The Bitswap decision engine tracks the number of bytes exchanged between IPFS
+nodes, and stores this information as a collection of ledgers. This command
+prints the ledger associated with a given peer.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", true, false, "The PeerID (B58) of the ledger to inspect"),
+	},
+	Type: decision.Receipt{},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !nd.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		bs, ok := nd.Exchange.(*bitswap.Bitswap)
+		if !ok {
+			res.SetError(u.ErrCast(), cmds.ErrNormal)
+			return
+		}
+
+		partner, err := peer.IDB58Decode(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		res.SetOutput(bs.LedgerForPeer(partner))
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*decision.Receipt)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "Ledger for %s\n", out.Peer)
+			fmt.Fprintf(buf, "Debt ratio:\t%f\n", out.Value)
+			fmt.Fprintf(buf, "Exchanges:\t%d\n", out.Exchanged)
+			fmt.Fprintf(buf, "Bytes sent:\t%d\n", out.Sent)
+			fmt.Fprintf(buf, "Bytes received:\t%d\n", out.Recv)
+			return buf, nil
+		},
+	},
+}
+
+var reprovideCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Trigger reprovider",
+		ShortDescription: `
+Triggers a reprovide of the blocks picked by Reprovider.Strategy in the
+config, which otherwise runs every Reprovider.Interval. Use
+'ipfs dht provide' to provide single blocks.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !nd.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		err = nd.Reprovider.Trigger(req.Context().Context)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(nil)
+	},
+}
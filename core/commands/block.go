@@ -11,8 +11,12 @@ import (
 	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	"github.com/ipfs/go-ipfs/blocks"
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	cmds "github.com/ipfs/go-ipfs/commands"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	ipld "github.com/ipfs/go-ipfs/ipld"
+	dag "github.com/ipfs/go-ipfs/merkledag"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -21,6 +25,13 @@ type BlockStat struct {
 	Size int
 }
 
+// RemovedBlock is the outcome of removing a block with 'ipfs block rm':
+// Error is why it wasn't removed, and empty when it was.
+type RemovedBlock struct {
+	Hash  string
+	Error string `json:",omitempty"`
+}
+
 func (bs BlockStat) String() string {
 	return fmt.Sprintf("Key: %s\nSize: %d\n", bs.Key, bs.Size)
 }
@@ -39,6 +50,7 @@ multihash.
 		"stat": blockStatCmd,
 		"get":  blockGetCmd,
 		"put":  blockPutCmd,
+		"rm":   blockRmCmd,
 	},
 }
 
@@ -108,12 +120,26 @@ var blockPutCmd = &cmds.Command{
 		ShortDescription: `
 ipfs block put is a plumbing command for storing raw ipfs blocks.
 It reads from stdin, and <key> is a base58 encoded multihash.
+
+--format picks the key the block gets: v0, the default, keys it by its
+multihash alone, as all blocks used to be; raw, dag-pb and dag-cbor key
+it with a version 1 cid naming that codec, and v1 is dag-pb. dag-pb
+blocks must be merkledag nodes, and dag-cbor ones ipld objects.
+
+--mhtype picks the hash function the key is made with, sha2-256 by
+default, and --mhlen the length of the digest, which defaults to the
+whole of it.
 `,
 	},
 
 	Arguments: []cmds.Argument{
 		cmds.FileArg("data", true, false, "The data to be stored as an IPFS block").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.StringOption("format", "f", "Format of the block: v0 (default), v1, raw, dag-pb or dag-cbor"),
+		cmds.StringOption("mhtype", "Multihash function of the key: sha2-256 (default), sha3-256, ..."),
+		cmds.IntOption("mhlen", "Length of the digest, in bytes; the whole digest by default"),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.Context().GetNode()
 		if err != nil {
@@ -121,6 +147,26 @@ It reads from stdin, and <key> is a base58 encoded multihash.
 			return
 		}
 
+		format, _, _ := req.Option("format").String()
+		prefix, err := blockFormat(format)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		mhtype, _, _ := req.Option("mhtype").String()
+		code, err := hashCode(mhtype)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		mhlen, found, _ := req.Option("mhlen").Int()
+		if !found {
+			mhlen = mh.DefaultLengths[code]
+		} else if mhlen <= 0 || mhlen > mh.DefaultLengths[code] {
+			res.SetError(fmt.Errorf("--mhlen must be between 1 and %d for %s", mh.DefaultLengths[code], mh.Codes[code]), cmds.ErrClient)
+			return
+		}
+
 		file, err := req.Files().NextFile()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
@@ -139,7 +185,22 @@ It reads from stdin, and <key> is a base58 encoded multihash.
 			return
 		}
 
-		b := blocks.NewBlock(data)
+		if err := checkBlockFormat(data, prefix); err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		prefix.MhType = code
+		prefix.MhLength = mhlen
+		h, err := blocks.SumPrefix(data, prefix)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		b, err := blocks.NewBlockWithHash(data, h)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
 		log.Debugf("BlockPut key: '%q'", b.Key())
 
 		k, err := n.Blocks.AddBlock(b)
@@ -162,22 +223,108 @@ It reads from stdin, and <key> is a base58 encoded multihash.
 	Type: BlockStat{},
 }
 
+var blockRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove IPFS blocks from the local blockstore",
+		ShortDescription: `
+'ipfs block rm' is a plumbing command for removing raw ipfs blocks
+from the local blockstore, whatever links to them. <key> is a base58
+encoded multihash.
+
+Pinned blocks, including those of the pinned objects linking to them,
+aren't removed unless --force is given; their pins are kept, and the
+blocks are fetched again should they be needed. Neither are those kept
+by best-effort pins, or fetched by background pins in progress.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, true, "The base58 multihash of the blocks to remove").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("force", "f", "Remove the blocks even if they are pinned"),
+		cmds.BoolOption("quiet", "q", "Only write the blocks which couldn't be removed"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		force, _, _ := req.Option("force").Bool()
+
+		keys := make([]key.Key, len(req.Arguments()))
+		for i, skey := range req.Arguments() {
+			c, err := cid.Parse(skey)
+			if err != nil {
+				res.SetError(fmt.Errorf("invalid block key %q: %s", skey, err), cmds.ErrClient)
+				return
+			}
+			keys[i] = c.Key()
+		}
+
+		outChan := make(chan interface{})
+		go func() {
+			defer close(outChan)
+			errs := corerepo.RemoveBlocks(n, keys, force)
+			for i, k := range keys {
+				r := &RemovedBlock{Hash: k.Pretty()}
+				if errs[i] != nil {
+					r.Error = errs[i].Error()
+				}
+				select {
+				case outChan <- r:
+				case <-req.Context().Context.Done():
+					return
+				}
+			}
+		}()
+		res.SetOutput((<-chan interface{})(outChan))
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			outChan, ok := res.Output().(<-chan interface{})
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			quiet, _, _ := res.Request().Option("quiet").Bool()
+
+			marshal := func(v interface{}) (io.Reader, error) {
+				r, ok := v.(*RemovedBlock)
+				if !ok {
+					return nil, u.ErrCast()
+				}
+				switch {
+				case r.Error != "":
+					return strings.NewReader(fmt.Sprintf("cannot remove %s: %s\n", r.Hash, r.Error)), nil
+				case quiet:
+					return strings.NewReader(""), nil
+				default:
+					return strings.NewReader("removed " + r.Hash + "\n"), nil
+				}
+			}
+
+			return &cmds.ChannelMarshaler{
+				Channel:   outChan,
+				Marshaler: marshal,
+			}, nil
+		},
+	},
+	Type: RemovedBlock{},
+}
+
 func getBlockForKey(req cmds.Request, skey string) (*blocks.Block, error) {
 	n, err := req.Context().GetNode()
 	if err != nil {
 		return nil, err
 	}
 
-	if !u.IsValidHash(skey) {
-		return nil, errors.New("Not a valid hash")
-	}
-
-	h, err := mh.FromB58String(skey)
+	c, err := cid.Parse(skey)
 	if err != nil {
-		return nil, err
+		return nil, errors.New("Not a valid hash")
 	}
 
-	k := key.Key(h)
+	k := c.Key()
 	b, err := n.Blocks.GetBlock(context.TODO(), k)
 	if err != nil {
 		return nil, err
@@ -186,3 +333,38 @@ func getBlockForKey(req cmds.Request, skey string) (*blocks.Block, error) {
 	log.Debugf("ipfs block: got block with key: %q", b.Key())
 	return b, nil
 }
+
+// blockFormat returns the prefix of the keys of blocks of format, one of
+// 'block put --format', less the multihash.
+func blockFormat(format string) (cid.Prefix, error) {
+	switch format {
+	case "", "v0":
+		return cid.Prefix{Version: 0, Codec: cid.DagProtobuf}, nil
+	case "v1":
+		return cid.Prefix{Version: 1, Codec: cid.DagProtobuf}, nil
+	}
+	codec, ok := cid.Codecs[format]
+	if !ok {
+		return cid.Prefix{}, fmt.Errorf("unknown block format %q: use v0, v1, raw, dag-pb or dag-cbor", format)
+	}
+	return cid.Prefix{Version: 1, Codec: codec}, nil
+}
+
+// checkBlockFormat returns an error if data can't be read as the codec its
+// cid names, should it name one.
+func checkBlockFormat(data []byte, p cid.Prefix) error {
+	if p.Version == 0 {
+		return nil
+	}
+	switch p.Codec {
+	case cid.DagProtobuf:
+		if _, err := dag.Decoded(data); err != nil {
+			return fmt.Errorf("not a dag-pb block: %s", err)
+		}
+	case cid.DagCBOR:
+		if _, err := ipld.Decode(data); err != nil || !ipld.IsObject(data) {
+			return errors.New("not a dag-cbor block: not an ipld object")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"testing"
+
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
+	ipld "github.com/ipfs/go-ipfs/ipld"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+)
+
+func TestBlockFormat(t *testing.T) {
+	for format, expected := range map[string]cid.Prefix{
+		"":         {Version: 0, Codec: cid.DagProtobuf},
+		"v0":       {Version: 0, Codec: cid.DagProtobuf},
+		"v1":       {Version: 1, Codec: cid.DagProtobuf},
+		"raw":      {Version: 1, Codec: cid.Raw},
+		"dag-cbor": {Version: 1, Codec: cid.DagCBOR},
+	} {
+		p, err := blockFormat(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != expected {
+			t.Errorf("format %q: expected %v, got %v", format, expected, p)
+		}
+	}
+	if _, err := blockFormat("v2"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+
+	nd, err := (&dag.Node{Data: []byte("node")}).Encoded(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := ipld.Encode(map[string]interface{}{"a": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		format string
+		data   []byte
+		ok     bool
+	}{
+		{"raw", []byte("anything"), true},
+		{"v0", []byte("anything"), true},
+		{"dag-pb", nd, true},
+		{"dag-pb", obj, false},
+		{"dag-cbor", obj, true},
+		{"dag-cbor", nd, false},
+	} {
+		p, _ := blockFormat(c.format)
+		if err := checkBlockFormat(c.data, p); (err == nil) != c.ok {
+			t.Errorf("format %s: unexpected error %v", c.format, err)
+		}
+	}
+}
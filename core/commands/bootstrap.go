@@ -3,10 +3,18 @@ package commands
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"reflect"
 	"sort"
+	"sync"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	inet "github.com/ipfs/go-ipfs/p2p/net"
 	repo "github.com/ipfs/go-ipfs/repo"
 	config "github.com/ipfs/go-ipfs/repo/config"
 	"github.com/ipfs/go-ipfs/repo/fsrepo"
@@ -19,6 +27,21 @@ type BootstrapOutput struct {
 
 var peerOptionDesc = "A peer to add to the bootstrap list (in the format '<multiaddr>/<peerID>')"
 
+// bootstrapCheckTimeout bounds how long 'ipfs bootstrap check' waits for
+// each peer, by default.
+const bootstrapCheckTimeout = 10 * time.Second
+
+var pnetOption = cmds.BoolOption("pnet", "Use the bootstrap list of the private network of the swarm.key of the repo")
+
+// BootstrapCheck is whether a bootstrap peer could be reached, and the
+// round-trip time of a ping to it.
+type BootstrapCheck struct {
+	Peer      string
+	Reachable bool
+	Latency   time.Duration
+	Error     string `json:",omitempty"`
+}
+
 var BootstrapCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Show or edit the list of bootstrap peers",
@@ -26,9 +49,15 @@ var BootstrapCmd = &cmds.Command{
 ipfs bootstrap list             - Show peers in the bootstrap list
 ipfs bootstrap add <peer>...    - Add peers to the bootstrap list
 ipfs bootstrap rm <peer>... - Removes peers from the bootstrap list
+ipfs bootstrap check [<peer>...] - Check that bootstrap peers can be reached
 `,
 		ShortDescription: `
 Running 'ipfs bootstrap' with no arguments will run 'ipfs bootstrap list'.
+
+With a swarm.key in the repo, the node is limited to a private network,
+and bootstraps with the list config.PrivateBootstrap holds for the key,
+if there is one, rather than with the public list, config.Bootstrap.
+Given --pnet, list, add and rm work on the list of the private network.
 ` + bootstrapSecurityWarning,
 	},
 
@@ -37,9 +66,10 @@ Running 'ipfs bootstrap' with no arguments will run 'ipfs bootstrap list'.
 	Type:       bootstrapListCmd.Type,
 
 	Subcommands: map[string]*cmds.Command{
-		"list": bootstrapListCmd,
-		"add":  bootstrapAddCmd,
-		"rm":   bootstrapRemoveCmd,
+		"list":  bootstrapListCmd,
+		"add":   bootstrapAddCmd,
+		"rm":    bootstrapRemoveCmd,
+		"check": bootstrapCheckCmd,
 	},
 }
 
@@ -57,6 +87,7 @@ in the bootstrap list).
 
 	Options: []cmds.Option{
 		cmds.BoolOption("default", "add default bootstrap nodes"),
+		pnetOption,
 	},
 
 	Run: func(req cmds.Request, res cmds.Response) {
@@ -72,7 +103,17 @@ in the bootstrap list).
 			return
 		}
 		defer r.Close()
-		cfg := r.Config()
+		cfg, err := r.Config().Clone()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		fp, err := bootstrapListFingerprint(req, r)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
 
 		deflt, _, err := req.Option("default").Bool()
 		if err != nil {
@@ -80,6 +121,10 @@ in the bootstrap list).
 			return
 		}
 
+		if deflt && fp != "" {
+			res.SetError(errors.New("the default bootstrap peers are of the public network, and cannot be reached from a private one"), cmds.ErrClient)
+			return
+		}
 		if deflt {
 			// parse separately for meaningful, correct error.
 			defltPeers, err := config.DefaultBootstrapPeers()
@@ -96,7 +141,7 @@ in the bootstrap list).
 			return
 		}
 
-		added, err := bootstrapAdd(r, cfg, inputPeers)
+		added, err := bootstrapAdd(r, cfg, fp, inputPeers)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -134,6 +179,7 @@ var bootstrapRemoveCmd = &cmds.Command{
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("all", "Remove all bootstrap peers."),
+		pnetOption,
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		input, err := config.ParseBootstrapPeers(req.Arguments())
@@ -148,7 +194,17 @@ var bootstrapRemoveCmd = &cmds.Command{
 			return
 		}
 		defer r.Close()
-		cfg := r.Config()
+		cfg, err := r.Config().Clone()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		fp, err := bootstrapListFingerprint(req, r)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
 
 		all, _, err := req.Option("all").Bool()
 		if err != nil {
@@ -158,9 +214,9 @@ var bootstrapRemoveCmd = &cmds.Command{
 
 		var removed []config.BootstrapPeer
 		if all {
-			removed, err = bootstrapRemoveAll(r, cfg)
+			removed, err = bootstrapRemoveAll(r, cfg, fp)
 		} else {
-			removed, err = bootstrapRemove(r, cfg, input)
+			removed, err = bootstrapRemove(r, cfg, fp, input)
 		}
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
@@ -189,6 +245,9 @@ var bootstrapListCmd = &cmds.Command{
 		Tagline:          "Show peers in the bootstrap list",
 		ShortDescription: "Peers are output in the format '<multiaddr>/<peerID>'.",
 	},
+	Options: []cmds.Option{
+		pnetOption,
+	},
 
 	Run: func(req cmds.Request, res cmds.Response) {
 		r, err := fsrepo.Open(req.Context().ConfigRoot)
@@ -199,7 +258,13 @@ var bootstrapListCmd = &cmds.Command{
 		defer r.Close()
 		cfg := r.Config()
 
-		peers, err := cfg.BootstrapPeers()
+		fp, err := bootstrapListFingerprint(req, r)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		peers, err := config.ParseBootstrapPeers(bootstrapListOf(cfg, fp))
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -236,13 +301,41 @@ func bootstrapWritePeers(w io.Writer, prefix string, peers []string) error {
 	return nil
 }
 
-func bootstrapAdd(r repo.Repo, cfg *config.Config, peers []config.BootstrapPeer) ([]config.BootstrapPeer, error) {
+// bootstrapListFingerprint returns the fingerprint of the key of the
+// private network whose bootstrap list req works on, given --pnet, or ""
+// for the public list.
+func bootstrapListFingerprint(req cmds.Request, r repo.Repo) (string, error) {
+	usePnet, _, err := req.Option("pnet").Bool()
+	if err != nil || !usePnet {
+		return "", err
+	}
+	fp, err := core.PNetFingerprint(r)
+	if err != nil {
+		return "", err
+	}
+	if fp == "" {
+		return "", errors.New("the repo has no swarm.key, so no private network to edit the bootstrap list of")
+	}
+	return fp, nil
+}
+
+// bootstrapListOf returns the bootstrap list of the private network of
+// key fingerprint fp, or the public one if fp is empty. Unlike
+// cfg.BootstrapList, it doesn't fall back on the public list.
+func bootstrapListOf(cfg *config.Config, fp string) []string {
+	if fp == "" {
+		return cfg.Bootstrap
+	}
+	return cfg.PrivateBootstrap[fp]
+}
+
+func bootstrapAdd(r repo.Repo, cfg *config.Config, fp string, peers []config.BootstrapPeer) ([]config.BootstrapPeer, error) {
 	addedMap := map[string]struct{}{}
 	addedList := make([]config.BootstrapPeer, 0, len(peers))
 
 	// re-add cfg bootstrap peers to rm dupes
-	bpeers := cfg.Bootstrap
-	cfg.Bootstrap = nil
+	bpeers := bootstrapListOf(cfg, fp)
+	var list []string
 
 	// add new peers
 	for _, peer := range peers {
@@ -251,7 +344,7 @@ func bootstrapAdd(r repo.Repo, cfg *config.Config, peers []config.BootstrapPeer)
 			continue
 		}
 
-		cfg.Bootstrap = append(cfg.Bootstrap, s)
+		list = append(list, s)
 		addedList = append(addedList, peer)
 		addedMap[s] = struct{}{}
 	}
@@ -262,10 +355,11 @@ func bootstrapAdd(r repo.Repo, cfg *config.Config, peers []config.BootstrapPeer)
 			continue
 		}
 
-		cfg.Bootstrap = append(cfg.Bootstrap, s)
+		list = append(list, s)
 		addedMap[s] = struct{}{}
 	}
 
+	cfg.SetBootstrapList(fp, list)
 	if err := r.SetConfig(cfg); err != nil {
 		return nil, err
 	}
@@ -273,15 +367,15 @@ func bootstrapAdd(r repo.Repo, cfg *config.Config, peers []config.BootstrapPeer)
 	return addedList, nil
 }
 
-func bootstrapRemove(r repo.Repo, cfg *config.Config, toRemove []config.BootstrapPeer) ([]config.BootstrapPeer, error) {
+func bootstrapRemove(r repo.Repo, cfg *config.Config, fp string, toRemove []config.BootstrapPeer) ([]config.BootstrapPeer, error) {
 	removed := make([]config.BootstrapPeer, 0, len(toRemove))
-	keep := make([]config.BootstrapPeer, 0, len(cfg.Bootstrap))
 
-	peers, err := cfg.BootstrapPeers()
+	peers, err := config.ParseBootstrapPeers(bootstrapListOf(cfg, fp))
 	if err != nil {
 		return nil, err
 	}
 
+	keep := make([]config.BootstrapPeer, 0, len(peers))
 	for _, peer := range peers {
 		found := false
 		for _, peer2 := range toRemove {
@@ -296,7 +390,7 @@ func bootstrapRemove(r repo.Repo, cfg *config.Config, toRemove []config.Bootstra
 			keep = append(keep, peer)
 		}
 	}
-	cfg.SetBootstrapPeers(keep)
+	cfg.SetBootstrapList(fp, config.BootstrapPeerStrings(keep))
 
 	if err := r.SetConfig(cfg); err != nil {
 		return nil, err
@@ -305,13 +399,13 @@ func bootstrapRemove(r repo.Repo, cfg *config.Config, toRemove []config.Bootstra
 	return removed, nil
 }
 
-func bootstrapRemoveAll(r repo.Repo, cfg *config.Config) ([]config.BootstrapPeer, error) {
-	removed, err := cfg.BootstrapPeers()
+func bootstrapRemoveAll(r repo.Repo, cfg *config.Config, fp string) ([]config.BootstrapPeer, error) {
+	removed, err := config.ParseBootstrapPeers(bootstrapListOf(cfg, fp))
 	if err != nil {
 		return nil, err
 	}
 
-	cfg.Bootstrap = nil
+	cfg.SetBootstrapList(fp, nil)
 	if err := r.SetConfig(cfg); err != nil {
 		return nil, err
 	}
@@ -319,6 +413,143 @@ func bootstrapRemoveAll(r repo.Repo, cfg *config.Config) ([]config.BootstrapPeer
 	return removed, nil
 }
 
+var bootstrapCheckCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Check that the bootstrap peers can be reached",
+		ShortDescription: `
+'ipfs bootstrap check' dials each peer of the bootstrap list the node
+uses, over the address of the list, and pings it. As each one answers, or
+fails to, it outputs whether the peer could be reached and the round-trip
+time of the ping. Peers connected to already are pinged over the open
+connection. Given peers, it checks those instead of the list.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", false, true, "A peer to check (in the format '<multiaddr>/<peerID>')").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("timeout", "how long to wait for each peer (default: 10s)"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !n.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		addrs := req.Arguments()
+		if len(addrs) == 0 {
+			addrs = n.BootstrapList()
+		}
+		peers, err := config.ParseBootstrapPeers(addrs)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if len(peers) == 0 {
+			res.SetError(errors.New("no bootstrap peers to check"), cmds.ErrClient)
+			return
+		}
+
+		timeout := bootstrapCheckTimeout
+		timeoutS, found, err := req.Option("timeout").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if found {
+			timeout, err = time.ParseDuration(timeoutS)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+		}
+
+		ctx := req.Context().Context
+		outChan := make(chan interface{})
+		var wg sync.WaitGroup
+		for _, bp := range peers {
+			wg.Add(1)
+			go func(bp config.BootstrapPeer) {
+				defer wg.Done()
+				pctx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				select {
+				case outChan <- checkBootstrapPeer(pctx, n, bp):
+				case <-ctx.Done():
+				}
+			}(bp)
+		}
+		go func() {
+			wg.Wait()
+			close(outChan)
+		}()
+
+		res.SetOutput((<-chan interface{})(outChan))
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			outChan, ok := res.Output().(<-chan interface{})
+			if !ok {
+				fmt.Println(reflect.TypeOf(res.Output()))
+				return nil, u.ErrCast()
+			}
+
+			marshal := func(v interface{}) (io.Reader, error) {
+				c, ok := v.(*BootstrapCheck)
+				if !ok {
+					return nil, u.ErrCast()
+				}
+
+				buf := new(bytes.Buffer)
+				switch {
+				case !c.Reachable:
+					fmt.Fprintf(buf, "%s unreachable: %s\n", c.Peer, c.Error)
+				case c.Error != "":
+					fmt.Fprintf(buf, "%s reachable, but %s\n", c.Peer, c.Error)
+				default:
+					fmt.Fprintf(buf, "%s reachable, time=%.2f ms\n", c.Peer, ms(c.Latency))
+				}
+				return buf, nil
+			}
+
+			return &cmds.ChannelMarshaler{
+				Channel:   outChan,
+				Marshaler: marshal,
+			}, nil
+		},
+	},
+	Type: BootstrapCheck{},
+}
+
+// checkBootstrapPeer dials bp over its address, unless connected to it
+// already, and pings it.
+func checkBootstrapPeer(ctx context.Context, n *core.IpfsNode, bp config.BootstrapPeer) *BootstrapCheck {
+	c := &BootstrapCheck{Peer: bp.String()}
+	pid := bp.ID()
+	if n.PeerHost.Network().Connectedness(pid) != inet.Connected {
+		if err := dialOnly(ctx, n, pid, bp.Transport()); err != nil {
+			c.Error = err.Error()
+			return c
+		}
+	}
+	c.Reachable = true
+
+	took, err := n.Ping.Ping(ctx, pid)
+	if err != nil {
+		c.Error = fmt.Sprintf("ping failed: %s", err)
+		return c
+	}
+	c.Latency = took
+	return c
+}
+
 const bootstrapSecurityWarning = `
 SECURITY WARNING:
 
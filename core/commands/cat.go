@@ -1,31 +1,68 @@
 package commands
 
 import (
+	"errors"
+	"fmt"
 	"io"
 
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	cmds "github.com/ipfs/go-ipfs/commands"
-	core "github.com/ipfs/go-ipfs/core"
-	path "github.com/ipfs/go-ipfs/path"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	exchange "github.com/ipfs/go-ipfs/exchange"
 	uio "github.com/ipfs/go-ipfs/unixfs/io"
 
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/cheggaaa/pb"
-	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 )
 
 const progressBarMinSize = 1024 * 1024 * 8 // show progress bar for outputs > 8MiB
 
+var errNegativeRange = errors.New("--offset and --length must not be negative")
+
+const prefetchWindowOptionName = "prefetch-window"
+
+// prefetchContext returns the context to read the files of req under, as
+// one session, with the prefetch window it sets.
+func prefetchContext(req cmds.Request) (context.Context, error) {
+	ctx := exchange.NewSession(req.Context().Context)
+	window, found, err := req.Option(prefetchWindowOptionName).Int()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return ctx, nil
+	}
+	if window < 1 {
+		return nil, fmt.Errorf("--%s must be at least 1", prefetchWindowOptionName)
+	}
+	return uio.WithPrefetchWindow(ctx, window), nil
+}
+
 var CatCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Show IPFS object data",
 		ShortDescription: `
 Retrieves the object named by <ipfs-or-ipns-path> and outputs the data
 it contains.
+
+To output only part of the data, use '--offset' to skip bytes from the
+start and '--length' to limit how many bytes are output. When several
+paths are given, the range applies to their concatenated data. Only the
+blocks holding the range are fetched.
+
+'--prefetch-window' sets how many blocks of a file are requested ahead of
+the one being read, 32 by default. A larger window reads faster from
+distant peers, for more memory.
 `,
 	},
 
 	Arguments: []cmds.Argument{
 		cmds.StringArg("ipfs-path", true, true, "The path to the IPFS object(s) to be outputted").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.IntOption("offset", "o", "Byte offset to begin reading from"),
+		cmds.IntOption("length", "l", "Maximum number of bytes to read"),
+		cmds.IntOption(prefetchWindowOptionName, "Number of blocks to request ahead of the one being read (default: 32)"),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		node, err := req.Context().GetNode()
 		if err != nil {
@@ -33,15 +70,36 @@ it contains.
 			return
 		}
 
-		readers, length, err := cat(req.Context().Context, node, req.Arguments())
+		offset, _, err := req.Option("offset").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		max, limited, err := req.Option("length").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		if offset < 0 || max < 0 {
+			res.SetError(errNegativeRange, cmds.ErrClient)
+			return
+		}
+		if !limited {
+			max = -1
+		}
+
+		ctx, err := prefetchContext(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		reader, length, err := coreapi.NewCoreAPI(node).Unixfs().Cat(ctx, req.Arguments(), int64(offset), int64(max))
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
 
 		res.SetLength(length)
-
-		reader := io.MultiReader(readers...)
 		res.SetOutput(reader)
 	},
 	PostRun: func(req cmds.Request, res cmds.Response) {
@@ -57,22 +115,3 @@ it contains.
 		res.SetOutput(reader)
 	},
 }
-
-func cat(ctx context.Context, node *core.IpfsNode, paths []string) ([]io.Reader, uint64, error) {
-	readers := make([]io.Reader, 0, len(paths))
-	length := uint64(0)
-	for _, fpath := range paths {
-		dagnode, err := core.Resolve(ctx, node, path.Path(fpath))
-		if err != nil {
-			return nil, 0, err
-		}
-
-		read, err := uio.NewDagReader(ctx, dagnode, node.DAG)
-		if err != nil {
-			return nil, 0, err
-		}
-		readers = append(readers, read)
-		length += uint64(read.Size())
-	}
-	return readers, length, nil
-}
@@ -9,6 +9,8 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"reflect"
+	"sort"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	repo "github.com/ipfs/go-ipfs/repo"
@@ -31,6 +33,8 @@ ipfs config <key> <value>  - Set value of <key> to <value>
 ipfs config show           - Show config file
 ipfs config edit           - Edit config file in $EDITOR
 ipfs config replace <file> - Replaces the config file with <file>
+ipfs config reload         - Applies the config file to the daemon
+ipfs config profile apply <profile> - Applies a profile to the config
 `,
 		ShortDescription: `
 ipfs config controls configuration variables. It works like 'git config'.
@@ -50,6 +54,10 @@ Get the value of the 'datastore.path' key:
 Set the value of the 'datastore.path' key:
 
   ipfs config datastore.path ~/.ipfs/datastore
+
+When a daemon is running, the changes it can apply without a restart take
+effect at once: gateway and API headers, the bootstrap peers, the limits
+of the connection manager and the interval of the reprovider.
 `,
 	},
 
@@ -97,6 +105,12 @@ Set the value of the 'datastore.path' key:
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
+		if len(args) == 2 {
+			if err := reloadNode(req); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
 		res.SetOutput(output)
 	},
 	Marshalers: cmds.MarshalerMap{
@@ -128,6 +142,8 @@ Set the value of the 'datastore.path' key:
 		"show":    configShowCmd,
 		"edit":    configEditCmd,
 		"replace": configReplaceCmd,
+		"reload":  configReloadCmd,
+		"profile": configProfileCmd,
 	},
 }
 
@@ -136,7 +152,9 @@ var configShowCmd = &cmds.Command{
 		Tagline: "Outputs the content of the config file",
 		ShortDescription: `
 WARNING: Your private key is stored in the config file, and it will be
-included in the output of this command.
+included in the output of this command. The S3 credentials and the keys
+of the remote pinning services are left out, unless they refer to the
+environment or to a file, with "env:" or "file:".
 `,
 	},
 
@@ -211,7 +229,136 @@ can't be undone.
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
+		if err := reloadNode(req); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+var configReloadCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Applies the config file to the running daemon",
+		ShortDescription: `
+'ipfs config reload' reads the config file again, as after editing it by
+hand, and applies what it can to the daemon without a restart. Sending
+the daemon SIGHUP does the same.
+`,
+	},
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		r, err := fsrepo.Open(req.Context().ConfigRoot)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer r.Close()
+
+		if err := r.ReloadConfig(); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if err := reloadNode(req); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+var configProfileCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Apply profiles to the config",
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"apply": configProfileApplyCmd,
+	},
+}
+
+// ConfigChange is a change of the value of a config key. Old or New is
+// nil when the key is added or removed.
+type ConfigChange struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+type ConfigChanges struct {
+	Changes []ConfigChange
+}
+
+var configProfileApplyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Apply a profile to the config",
+		ShortDescription: `
+'ipfs config profile apply' changes the config as 'ipfs init --profile'
+would have, and lists the changes. With --dry-run, the config is left
+as it is.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("profile", true, false, "The profile to apply"),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("dry-run", "Only list the changes the profile would make"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		dryRun, _, _ := req.Option("dry-run").Bool()
+
+		r, err := fsrepo.Open(req.Context().ConfigRoot)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer r.Close()
+
+		changes, err := applyProfile(r, req.Arguments()[0], dryRun)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if !dryRun {
+			if err := reloadNode(req); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+		res.SetOutput(&ConfigChanges{Changes: changes})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*ConfigChanges)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for _, c := range out.Changes {
+				if c.Old != nil {
+					fmt.Fprintf(buf, "- %s: %s\n", c.Key, humanValue(c.Old))
+				}
+				if c.New != nil {
+					fmt.Fprintf(buf, "+ %s: %s\n", c.Key, humanValue(c.New))
+				}
+			}
+			return buf, nil
+		},
 	},
+	Type: ConfigChanges{},
+}
+
+// reloadNode applies the config to the node, when run by the daemon, so
+// that changes take effect without a restart.
+func reloadNode(req cmds.Request) error {
+	if !req.Context().Online {
+		return nil
+	}
+	n, err := req.Context().GetNode()
+	if err != nil {
+		return err
+	}
+	return n.ReloadConfig()
 }
 
 func getConfig(r repo.Repo, key string) (*ConfigField, error) {
@@ -240,6 +387,15 @@ func showConfig(filename string) (io.Reader, error) {
 	if err != nil {
 		return nil, err
 	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	config.RemoveSecrets(cfg)
+	data, err = config.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	return bytes.NewReader(data), nil
 }
@@ -263,3 +419,76 @@ func replaceConfig(r repo.Repo, file io.Reader) error {
 
 	return r.SetConfig(&cfg)
 }
+
+// applyProfile applies the named profile to the config of r, saving it
+// unless dryRun, and returns the changes it makes.
+func applyProfile(r repo.Repo, name string, dryRun bool) ([]ConfigChange, error) {
+	before, err := config.ToMap(r.Config())
+	if err != nil {
+		return nil, err
+	}
+	// work on a copy, so nothing changes on a dry run.
+	cfg, err := config.FromMap(before)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.ApplyProfile(cfg, name); err != nil {
+		return nil, err
+	}
+	after, err := config.ToMap(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := diffConfig("", before, after)
+	if !dryRun && len(changes) > 0 {
+		if err := r.SetConfig(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// diffConfig returns the changes from the config map a to b, by key;
+// prefix is the key of the maps.
+func diffConfig(prefix string, a, b map[string]interface{}) []ConfigChange {
+	keys := make(map[string]struct{})
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var changes []ConfigChange
+	for _, k := range sorted {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		av, bv := a[k], b[k]
+		am, aok := av.(map[string]interface{})
+		bm, bok := bv.(map[string]interface{})
+		switch {
+		case aok && bok:
+			changes = append(changes, diffConfig(key, am, bm)...)
+		case !reflect.DeepEqual(av, bv):
+			changes = append(changes, ConfigChange{Key: key, Old: av, New: bv})
+		}
+	}
+	return changes
+}
+
+func humanValue(v interface{}) string {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(buf)
+}
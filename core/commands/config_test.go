@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffConfig(t *testing.T) {
+	a := map[string]interface{}{
+		"Bootstrap": []interface{}{"a"},
+		"Discovery": map[string]interface{}{
+			"MDNS": map[string]interface{}{"Enabled": true, "Interval": 10.0},
+		},
+		"Gone": "x",
+	}
+	b := map[string]interface{}{
+		"Bootstrap": []interface{}{},
+		"Discovery": map[string]interface{}{
+			"MDNS": map[string]interface{}{"Enabled": false, "Interval": 10.0},
+		},
+		"New": 1.0,
+	}
+
+	expected := []ConfigChange{
+		{Key: "Bootstrap", Old: []interface{}{"a"}, New: []interface{}{}},
+		{Key: "Discovery.MDNS.Enabled", Old: true, New: false},
+		{Key: "Gone", Old: "x"},
+		{Key: "New", New: 1.0},
+	}
+	if changes := diffConfig("", a, b); !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("expected %v, got %v", expected, changes)
+	}
+	if changes := diffConfig("", a, a); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %v", changes)
+	}
+}
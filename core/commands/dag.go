@@ -0,0 +1,582 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	humanize "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/dustin/go-humanize"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	cmds "github.com/ipfs/go-ipfs/commands"
+	ipld "github.com/ipfs/go-ipfs/ipld"
+	car "github.com/ipfs/go-ipfs/ipld/car"
+	path "github.com/ipfs/go-ipfs/path"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// DagResolved is the key of an object, and the path within it, that
+// 'ipfs dag put' and 'ipfs dag resolve' return.
+type DagResolved struct {
+	Key     string
+	RemPath string `json:",omitempty"`
+}
+
+var DagCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Interact with structured objects of any shape",
+		ShortDescription: `
+'ipfs dag' stores and reads objects of any shape, which 'ipfs object' can't:
+maps of strings, numbers, byte strings, booleans, null, arrays and maps,
+with links to other objects. They are stored encoded in CBOR, and given in
+JSON, where a link is written {"/": "<hash>"}.
+
+Paths lead through the fields of maps, the indexes of arrays and the
+links met on the way: /ipfs/<hash>/a/b/0/c is field c of the object the
+first entry of the array b in the map a links to. Paths also lead through
+the named links of unixfs objects.
+
+'ipfs dag export' packs whole DAGs, of objects or unixfs nodes, into an
+archive, which 'ipfs dag import' adds to another node, even offline.
+'ipfs dag stat' counts the blocks of a DAG, and their size.
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"put":     dagPutCmd,
+		"get":     dagGetCmd,
+		"resolve": dagResolveCmd,
+		"export":  dagExportCmd,
+		"import":  dagImportCmd,
+		"stat":    dagStatCmd,
+	},
+}
+
+var dagPutCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Store an object",
+		ShortDescription: `
+'ipfs dag put' stores the object <data> is, in JSON, or in CBOR with
+--input-enc=cbor, and prints its hash. The object must be a map. With
+--hash, it is hashed with another function than sha2-256.
+
+Objects can be pinned directly, or best-effort, in which case garbage
+collection keeps what it finds local of the objects they link to, but
+not recursively.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.FileArg("data", true, false, "The object to store").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("input-enc", "Encoding of the object: json (default) or cbor"),
+		cmds.StringOption(hashOptionName, "Hash function to use: sha2-256 (default), sha3-256, ..."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		enc, _, _ := req.Option("input-enc").String()
+		hashName, _, _ := req.Option(hashOptionName).String()
+		code, err := hashCode(hashName)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		file, err := req.Files().NextFile()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer file.Close()
+
+		var obj interface{}
+		switch enc {
+		case "", "json":
+			obj, err = ipld.FromJSON(file)
+		case "cbor":
+			var data []byte
+			data, err = ioutil.ReadAll(file)
+			if err == nil {
+				obj, err = ipld.Decode(data)
+			}
+		default:
+			res.SetError(fmt.Errorf("unknown input encoding %q: use json or cbor", enc), cmds.ErrClient)
+			return
+		}
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		b, err := ipld.NewBlock(obj, code)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		k, err := n.Blocks.AddBlock(b)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&DagResolved{Key: k.B58String()})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: dagResolvedMarshaler,
+	},
+	Type: DagResolved{},
+}
+
+var dagGetCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Get an object, or a value within one",
+		ShortDescription: `
+'ipfs dag get' prints the object or value <path> leads to, in JSON, where
+byte strings are printed in base64, or in CBOR with --output-enc=cbor,
+which 'ipfs dag put --input-enc=cbor' reads back.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "The path of the object or value to get").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("output-enc", "Encoding of the output: json (default) or cbor"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		enc, _, _ := req.Option("output-enc").String()
+		switch enc {
+		case "", "json", "cbor":
+		default:
+			res.SetError(fmt.Errorf("unknown output encoding %q: use json or cbor", enc), cmds.ErrClient)
+			return
+		}
+
+		r, err := resolveDagPath(req, req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if enc == "cbor" {
+			data, err := ipld.Encode(r.Value)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			res.SetOutput(bytes.NewReader(data))
+			return
+		}
+		res.SetOutput(r.Value)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, err := json.MarshalIndent(res.Output(), "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			return bytes.NewReader(append(out, '\n')), nil
+		},
+	},
+}
+
+var dagResolveCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Resolve a path to an object",
+		ShortDescription: `
+'ipfs dag resolve' prints the hash of the last object <path> leads through,
+followed by the rest of the path, within that object, if any.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "The path to resolve").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		r, err := resolveDagPath(req, req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&DagResolved{
+			Key:     r.Key.B58String(),
+			RemPath: strings.Join(r.RemPath, "/"),
+		})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: dagResolvedMarshaler,
+	},
+	Type: DagResolved{},
+}
+
+func dagResolvedMarshaler(res cmds.Response) (io.Reader, error) {
+	r, ok := res.Output().(*DagResolved)
+	if !ok {
+		return nil, u.ErrCast()
+	}
+	s := r.Key
+	if r.RemPath != "" {
+		s += "/" + r.RemPath
+	}
+	return strings.NewReader(s + "\n"), nil
+}
+
+// resolveDagPath resolves the /ipfs path, or hash and path, arg.
+func resolveDagPath(req cmds.Request, arg string) (*ipld.Resolved, error) {
+	n, err := req.Context().GetNode()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := path.ParsePath(arg)
+	if err != nil {
+		// a hash followed by a path, without /ipfs/ in front
+		p, err = path.ParsePath("/ipfs/" + arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if strings.HasPrefix(p.String(), "/ipns/") {
+		return nil, errors.New("paths of objects must start with their hash, or /ipfs/")
+	}
+	h, names, err := path.SplitAbsPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return ipld.Resolve(req.Context().Context, n.Blocks, key.Key(h), names)
+}
+
+var dagExportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Write out DAGs as an archive",
+		ShortDescription: `
+'ipfs dag export' writes out an archive of the objects <root> paths lead
+to, and of all the objects they link to, for 'ipfs dag import'. Archives
+of the same DAGs are always the same bytes, and so have the same hash.
+`,
+		LongDescription: `
+'ipfs dag export' writes out an archive of the objects <root> paths lead
+to, and of all the objects they link to, for 'ipfs dag import'. Archives
+of the same DAGs are always the same bytes, and so have the same hash.
+
+An archive is a header, listing the roots, followed by the blocks of the
+DAGs, each with its multihash. Blocks come in the order of a depth first
+walk of the DAGs, following the links of each object in order, and each
+block only once.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, true, "Paths of the roots of the DAGs to export").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		roots := make([]key.Key, len(req.Arguments()))
+		for i, arg := range req.Arguments() {
+			r, err := resolveDagPath(req, arg)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			if len(r.RemPath) > 0 {
+				res.SetError(fmt.Errorf("%s leads within an object, not to one", arg), cmds.ErrClient)
+				return
+			}
+			roots[i] = r.Key
+		}
+
+		piper, pipew := io.Pipe()
+		go func() {
+			err := car.Write(req.Context().Context, n.Blocks, roots, pipew)
+			if err != nil {
+				log.Debugf("exporting DAG: %s", err)
+			}
+			pipew.CloseWithError(err)
+		}()
+		res.SetOutput(piper)
+	},
+}
+
+// DagImportOutput is what 'ipfs dag import' imported.
+type DagImportOutput struct {
+	Roots  []DagImportRoot
+	Blocks int
+}
+
+// DagImportRoot is a root of an imported archive.
+type DagImportRoot struct {
+	Key    string
+	Pinned bool
+}
+
+var dagImportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add the blocks of an archive",
+		ShortDescription: `
+'ipfs dag import' adds the blocks of archives 'ipfs dag export' wrote, and
+pins their roots recursively, unless --pin-roots=false. Roots that aren't
+unixfs nodes can't be pinned, and are left as they are. Every block is
+checked against its hash before it is added.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.FileArg("file", true, true, "Archives to import").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("pin-roots", "Pin the roots of the archives recursively (default: true)"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		ctx := req.Context().Context
+
+		pinRoots, found, err := req.Option("pin-roots").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		if !found {
+			pinRoots = true
+		}
+		if pinRoots {
+			// gc waits for the roots imported to be pinned
+			defer n.GCLocker.PinLock()()
+		}
+
+		out := &DagImportOutput{}
+		var roots []key.Key
+		for {
+			file, err := req.Files().NextFile()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+
+			r, err := car.NewReader(file)
+			if err != nil {
+				file.Close()
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			for {
+				b, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					file.Close()
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+				if _, err := n.Blocks.AddBlock(b); err != nil {
+					file.Close()
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+				out.Blocks++
+			}
+			file.Close()
+			roots = append(roots, r.Header.Roots...)
+		}
+
+		for _, k := range roots {
+			root := DagImportRoot{Key: k.B58String()}
+			if pinRoots {
+				b, err := n.Blocks.GetBlock(ctx, k)
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+				// objects other than merkledag nodes can't be pinned yet.
+				if !ipld.IsObject(b.Data) {
+					nd, err := n.DAG.Get(ctx, k)
+					if err != nil {
+						res.SetError(err, cmds.ErrNormal)
+						return
+					}
+					if err := n.Pinning.Pin(ctx, nd, true); err != nil {
+						res.SetError(err, cmds.ErrNormal)
+						return
+					}
+					root.Pinned = true
+				}
+			}
+			out.Roots = append(out.Roots, root)
+		}
+		if pinRoots {
+			if err := n.Pinning.Flush(); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*DagImportOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			for _, r := range out.Roots {
+				if r.Pinned {
+					fmt.Fprintf(buf, "root %s pinned\n", r.Key)
+				} else {
+					fmt.Fprintf(buf, "root %s\n", r.Key)
+				}
+			}
+			fmt.Fprintf(buf, "imported %d blocks\n", out.Blocks)
+			return buf, nil
+		},
+	},
+	Type: DagImportOutput{},
+}
+
+// dagStatProgressInterval is how often 'ipfs dag stat --progress' tells
+// how far it got.
+const dagStatProgressInterval = 100 * time.Millisecond
+
+// DagStatOutput is the size of the DAG under Key, or of what was walked of
+// it so far when Progress is set. Err is why the walk failed.
+type DagStatOutput struct {
+	Key string
+	ipld.DagStat
+	Progress bool   `json:",omitempty"`
+	Err      string `json:",omitempty"`
+}
+
+var dagStatCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Count the blocks of a DAG, and their size",
+		ShortDescription: `
+'ipfs dag stat' walks the DAG under <root>, of objects or unixfs nodes,
+and prints the number of its blocks, each counted once, and their total
+size: what pinning or getting the DAG stores. The blocks the node doesn't
+have are fetched, but not pinned, so they go with the next garbage
+collection. With --progress, it tells how far it got as it goes.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "Path of the root of the DAG").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("progress", "p", "Print the counts so far during the walk"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		progress, _, err := req.Option("progress").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		arg := req.Arguments()[0]
+		r, err := resolveDagPath(req, arg)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if len(r.RemPath) > 0 {
+			res.SetError(fmt.Errorf("%s leads within an object, not to one", arg), cmds.ErrClient)
+			return
+		}
+		root := r.Key.B58String()
+
+		out := make(chan interface{})
+		res.SetOutput((<-chan interface{})(out))
+
+		go func() {
+			defer close(out)
+			ctx := req.Context().Context
+
+			var onBlock func(ipld.DagStat)
+			if progress {
+				last := time.Now()
+				onBlock = func(st ipld.DagStat) {
+					if time.Since(last) < dagStatProgressInterval {
+						return
+					}
+					last = time.Now()
+					select {
+					case out <- &DagStatOutput{Key: root, DagStat: st, Progress: true}:
+					case <-ctx.Done():
+					}
+				}
+			}
+
+			final := &DagStatOutput{Key: root}
+			if st, err := ipld.Stat(ctx, n.Blocks, r.Key, onBlock); err != nil {
+				final.Err = err.Error()
+			} else {
+				final.DagStat = *st
+			}
+			select {
+			case out <- final:
+			case <-ctx.Done():
+			}
+		}()
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			outCh, ok := res.Output().(<-chan interface{})
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			inProgress := false
+			return &cmds.ChannelMarshaler{
+				Channel: outCh,
+				Marshaler: func(v interface{}) (io.Reader, error) {
+					st, ok := v.(*DagStatOutput)
+					if !ok {
+						return nil, u.ErrCast()
+					}
+
+					if st.Err != "" {
+						return nil, errors.New(st.Err)
+					}
+
+					buf := new(bytes.Buffer)
+					if st.Progress {
+						inProgress = true
+						fmt.Fprintf(buf, "\r%d blocks, %s so far", st.NumBlocks, humanize.Bytes(st.Size))
+						return buf, nil
+					}
+					if inProgress {
+						fmt.Fprintln(buf)
+					}
+					fmt.Fprintf(buf, "NumBlocks: %d\nSize: %d\n", st.NumBlocks, st.Size)
+					return buf, nil
+				},
+			}, nil
+		},
+	},
+	Type: DagStatOutput{},
+}
@@ -0,0 +1,225 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	denylist "github.com/ipfs/go-ipfs/denylist"
+)
+
+var DenylistCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the content refused to the gateway and peers",
+		Synopsis: `
+ipfs denylist                  - List the entries of the denylist
+ipfs denylist add <entry>...   - Deny the given hashes or paths
+ipfs denylist rm <entry>...    - Stop denying the given hashes or paths
+ipfs denylist log              - Show the requests denied lately
+`,
+		ShortDescription: `
+The denylist holds the content the node refuses to serve: hashes, like
+Qm..., and path prefixes, like /ipns/example.com/private, which deny the
+paths under them. The gateway answers 410 Gone to the requests for them
+and, with Denylist.Bitswap set in the config, the node does not send
+the blocks of the hashes listed to other peers.
+`,
+		LongDescription: `
+The denylist holds the content the node refuses to serve: hashes, like
+Qm..., and path prefixes, like /ipns/example.com/private, which deny the
+paths under them. The gateway answers 410 Gone to the requests for them
+and, with Denylist.Bitswap set in the config, the node does not send
+the blocks of the hashes listed to other peers.
+
+The entries are read from Denylist.Entries in the config and from the
+file of Denylist.File, one per line, when the node starts. 'ipfs
+denylist add' and 'ipfs denylist rm' change the denylist of the running
+node, and Denylist.Entries.
+
+The requests denied are recorded, for 'ipfs denylist log' to show.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&stringList{n.Denylist.Entries()})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: stringListMarshaler,
+	},
+	Type: stringList{},
+	Subcommands: map[string]*cmds.Command{
+		"add": denylistAddCmd,
+		"rm":  denylistRmCmd,
+		"log": denylistLogCmd,
+	},
+}
+
+var denylistAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Deny content to the gateway and peers",
+		ShortDescription: `
+'ipfs denylist add' denies the given hashes or path prefixes, and saves
+them to the config.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("entry", true, true, "The hash or path to deny, e.g. /ipns/example.com/private"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		entries, err := parseDenylistEntries(req.Arguments())
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		if err := n.Denylist.Add(entries...); err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		cfg, err := n.Repo.Config().Clone()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		for _, e := range entries {
+			if !hasString(cfg.Denylist.Entries, e) {
+				cfg.Denylist.Entries = append(cfg.Denylist.Entries, e)
+			}
+		}
+		if err := n.Repo.SetConfig(cfg); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&stringList{entries})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: stringListMarshaler,
+	},
+	Type: stringList{},
+}
+
+var denylistRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stop denying content to the gateway and peers",
+		ShortDescription: `
+'ipfs denylist rm' stops denying the given hashes or path prefixes, and
+removes them from the config. The entries of Denylist.File are denied
+again when the node restarts, unless removed from the file.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("entry", true, true, "The denied hash or path"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		entries, err := parseDenylistEntries(req.Arguments())
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		cfg, err := n.Repo.Config().Clone()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		for _, e := range entries {
+			removed, err := n.Denylist.Remove(e)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+
+			keep := cfg.Denylist.Entries[:0]
+			for _, s := range cfg.Denylist.Entries {
+				if p, err := denylist.ParseEntry(s); err == nil && p == e {
+					removed = true
+					continue
+				}
+				keep = append(keep, s)
+			}
+			cfg.Denylist.Entries = keep
+
+			if !removed {
+				res.SetError(fmt.Errorf("%s is not denied", e), cmds.ErrNormal)
+				return
+			}
+		}
+		if err := n.Repo.SetConfig(cfg); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&stringList{entries})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: stringListMarshaler,
+	},
+	Type: stringList{},
+}
+
+type deniedRequests struct {
+	Requests []denylist.Blocked
+}
+
+var denylistLogCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the requests denied lately",
+		ShortDescription: `
+'ipfs denylist log' shows the latest requests denied by the running
+node, oldest first: when, by which entry, and whether they came from the
+gateway or from a peer over bitswap.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&deniedRequests{n.Denylist.AuditLog()})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*deniedRequests)
+			if !ok {
+				return nil, errors.New("failed to cast denied requests")
+			}
+
+			buf := new(bytes.Buffer)
+			for _, b := range out.Requests {
+				fmt.Fprintf(buf, "%s %s %s (%s)\n", b.Time.Format(time.RFC3339), b.Source, b.What, b.Entry)
+			}
+			return buf, nil
+		},
+	},
+	Type: deniedRequests{},
+}
+
+// parseDenylistEntries returns args in the form they are listed in.
+func parseDenylistEntries(args []string) ([]string, error) {
+	entries := make([]string, len(args))
+	for i, a := range args {
+		e, err := denylist.ParseEntry(a)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = e
+	}
+	return entries, nil
+}
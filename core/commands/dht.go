@@ -2,6 +2,7 @@ package commands
 
 import (
 	"bytes"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -29,6 +30,7 @@ var DhtCmd = &cmds.Command{
 		"findpeer":  findPeerDhtCmd,
 		"get":       getValueDhtCmd,
 		"put":       putValueDhtCmd,
+		"provide":   provideRefDhtCmd,
 	},
 }
 
@@ -51,6 +53,11 @@ var queryDhtCmd = &cmds.Command{
 			return
 		}
 
+		if !n.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
 		dht, ok := n.Routing.(*ipdht.IpfsDHT)
 		if !ok {
 			res.SetError(ErrNotDHT, cmds.ErrNormal)
@@ -158,6 +165,11 @@ FindProviders will return a list of peers who are able to provide the value requ
 			return
 		}
 
+		if !n.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
 		dht, ok := n.Routing.(*ipdht.IpfsDHT)
 		if !ok {
 			res.SetError(ErrNotDHT, cmds.ErrNormal)
@@ -271,6 +283,11 @@ var findPeerDhtCmd = &cmds.Command{
 			return
 		}
 
+		if !n.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
 		dht, ok := n.Routing.(*ipdht.IpfsDHT)
 		if !ok {
 			res.SetError(ErrNotDHT, cmds.ErrNormal)
@@ -373,6 +390,7 @@ GetValue will return the value stored in the dht at the given key.
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("verbose", "v", "Write extra information"),
+		cmds.BoolOption("base64", "Write the value base64 encoded, for values which aren't text"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.Context().GetNode()
@@ -381,6 +399,11 @@ GetValue will return the value stored in the dht at the given key.
 			return
 		}
 
+		if !n.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
 		dht, ok := n.Routing.(*ipdht.IpfsDHT)
 		if !ok {
 			res.SetError(ErrNotDHT, cmds.ErrNormal)
@@ -400,6 +423,8 @@ GetValue will return the value stored in the dht at the given key.
 			}
 		}()
 
+		b64, _, _ := req.Option("base64").Bool()
+
 		go func() {
 			defer close(events)
 			val, err := dht.GetValue(ctx, key.B58KeyDecode(req.Arguments()[0]))
@@ -409,9 +434,13 @@ GetValue will return the value stored in the dht at the given key.
 					Extra: err.Error(),
 				})
 			} else {
+				extra := string(val)
+				if b64 {
+					extra = base64.StdEncoding.EncodeToString(val)
+				}
 				notif.PublishQueryEvent(ctx, &notif.QueryEvent{
 					Type:  notif.Value,
-					Extra: string(val),
+					Extra: extra,
 				})
 			}
 		}()
@@ -481,6 +510,7 @@ PutValue will store the given key value pair in the dht.
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("verbose", "v", "Write extra information"),
+		cmds.BoolOption("base64", "Read the value base64 encoded, for values which aren't text"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.Context().GetNode()
@@ -489,6 +519,11 @@ PutValue will store the given key value pair in the dht.
 			return
 		}
 
+		if !n.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
 		dht, ok := n.Routing.(*ipdht.IpfsDHT)
 		if !ok {
 			res.SetError(ErrNotDHT, cmds.ErrNormal)
@@ -502,7 +537,14 @@ PutValue will store the given key value pair in the dht.
 		ctx := notif.RegisterForQueryEvents(req.Context().Context, events)
 
 		key := key.B58KeyDecode(req.Arguments()[0])
-		data := req.Arguments()[1]
+		data := []byte(req.Arguments()[1])
+		if b64, _, _ := req.Option("base64").Bool(); b64 {
+			data, err = base64.StdEncoding.DecodeString(req.Arguments()[1])
+			if err != nil {
+				res.SetError(fmt.Errorf("invalid base64 value: %s", err), cmds.ErrClient)
+				return
+			}
+		}
 
 		go func() {
 			defer close(outChan)
@@ -513,7 +555,7 @@ PutValue will store the given key value pair in the dht.
 
 		go func() {
 			defer close(events)
-			err := dht.PutValue(ctx, key, []byte(data))
+			err := dht.PutValue(ctx, key, data)
 			if err != nil {
 				notif.PublishQueryEvent(ctx, &notif.QueryEvent{
 					Type:  notif.QueryError,
@@ -576,3 +618,135 @@ PutValue will store the given key value pair in the dht.
 	},
 	Type: notif.QueryEvent{},
 }
+
+var provideRefDhtCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Announce to the network that you are providing given values",
+		ShortDescription: `
+Provide stores provider records for the given keys, of blocks in the local
+blockstore, at the peers closest to them in the dht.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, true, "The key[s] to send provide records for").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("verbose", "v", "Write extra information"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !n.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		dht, ok := n.Routing.(*ipdht.IpfsDHT)
+		if !ok {
+			res.SetError(ErrNotDHT, cmds.ErrNormal)
+			return
+		}
+
+		var keys []key.Key
+		for _, arg := range req.Arguments() {
+			k := key.B58KeyDecode(arg)
+			if k == "" {
+				res.SetError(fmt.Errorf("incorrectly formatted key: %s", arg), cmds.ErrClient)
+				return
+			}
+
+			has, err := n.Blockstore.Has(k)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			if !has {
+				res.SetError(fmt.Errorf("block %s not found locally, cannot provide", arg), cmds.ErrNormal)
+				return
+			}
+			keys = append(keys, k)
+		}
+
+		outChan := make(chan interface{})
+		res.SetOutput((<-chan interface{})(outChan))
+
+		events := make(chan *notif.QueryEvent)
+		ctx := notif.RegisterForQueryEvents(req.Context().Context, events)
+
+		go func() {
+			defer close(outChan)
+			for e := range events {
+				outChan <- e
+			}
+		}()
+
+		go func() {
+			defer close(events)
+			for _, k := range keys {
+				err := dht.Provide(ctx, k)
+				if err != nil {
+					notif.PublishQueryEvent(ctx, &notif.QueryEvent{
+						Type:  notif.QueryError,
+						Extra: err.Error(),
+					})
+				}
+			}
+		}()
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			outChan, ok := res.Output().(<-chan interface{})
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			verbose, _, _ := res.Request().Option("v").Bool()
+
+			marshal := func(v interface{}) (io.Reader, error) {
+				obj, ok := v.(*notif.QueryEvent)
+				if !ok {
+					return nil, u.ErrCast()
+				}
+
+				buf := new(bytes.Buffer)
+				if verbose {
+					fmt.Fprintf(buf, "%s: ", time.Now().Format("15:04:05.000"))
+				}
+				switch obj.Type {
+				case notif.FinalPeer:
+					if verbose {
+						fmt.Fprintf(buf, "sending provider record to peer %s\n", obj.ID)
+					}
+				case notif.PeerResponse:
+					if verbose {
+						fmt.Fprintf(buf, "* %s says use ", obj.ID)
+						for _, p := range obj.Responses {
+							fmt.Fprintf(buf, "%s ", p.ID)
+						}
+						fmt.Fprintln(buf)
+					}
+				case notif.SendingQuery:
+					if verbose {
+						fmt.Fprintf(buf, "* querying %s\n", obj.ID)
+					}
+				case notif.QueryError:
+					fmt.Fprintf(buf, "error: %s\n", obj.Extra)
+				default:
+					fmt.Fprintf(buf, "unrecognized event type: %d\n", obj.Type)
+				}
+				return buf, nil
+			}
+
+			return &cmds.ChannelMarshaler{
+				Channel:   outChan,
+				Marshaler: marshal,
+			}, nil
+		},
+	},
+	Type: notif.QueryEvent{},
+}
@@ -45,7 +45,9 @@ var DiagCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"net": diagNetCmd,
+		"net":     diagNetCmd,
+		"connect": diagConnectCmd,
+		"cmds":    diagCmdsCmd,
 	},
 }
 
@@ -0,0 +1,135 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// DiagCmdsOutput is the requests listed by 'ipfs diag cmds', oldest first.
+type DiagCmdsOutput struct {
+	Requests []cmds.ReqLogEntry
+}
+
+var errNoReqLog = errors.New("requests are only tracked by the daemon")
+
+var diagCmdsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the commands the daemon is running",
+		ShortDescription: `
+Lists the API requests in flight on the daemon, with the time they've been
+running, and those finished within the last minute, with the time they
+took. Each request has a trace ID, which is in the events the daemon logs
+for it (see 'ipfs log tail'); clients can give their own with the
+X-Ipfs-Trace-Id header, and the daemon sends it back in the response.
+`,
+	},
+
+	Options: []cmds.Option{
+		cmds.BoolOption("verbose", "v", "Also show the arguments and options of each request"),
+	},
+	Subcommands: map[string]*cmds.Command{
+		"clear":    diagCmdsClearCmd,
+		"set-time": diagCmdsSetTimeCmd,
+	},
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		reqlog := req.Context().ReqLog
+		if reqlog == nil {
+			res.SetError(errNoReqLog, cmds.ErrClient)
+			return
+		}
+		res.SetOutput(&DiagCmdsOutput{Requests: reqlog.Report()})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			output, ok := res.Output().(*DiagCmdsOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			verbose, _, _ := res.Request().Option("v").Bool()
+
+			buf := new(bytes.Buffer)
+			w := tabwriter.NewWriter(buf, 1, 2, 1, ' ', 0)
+			fmt.Fprint(w, "ID\tTrace\tCommand\tStatus\tTime")
+			if verbose {
+				fmt.Fprint(w, "\tArguments\tOptions")
+			}
+			fmt.Fprintln(w)
+			for _, e := range output.Requests {
+				status, took := "done", e.EndTime.Sub(e.StartTime)
+				if e.Active {
+					status, took = "active", time.Since(e.StartTime)
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s", e.ID, e.TraceID, e.Command, status, took)
+				if verbose {
+					fmt.Fprintf(w, "\t%s\t%s", strings.Join(e.Args, " "), formatOptions(e.Options))
+				}
+				fmt.Fprintln(w)
+			}
+			w.Flush()
+			return buf, nil
+		},
+	},
+	Type: DiagCmdsOutput{},
+}
+
+// formatOptions returns opts as "name=value" pairs, sorted by name.
+func formatOptions(opts map[string]interface{}) string {
+	pairs := make([]string, 0, len(opts))
+	for k, v := range opts {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+var diagCmdsClearCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Forget the finished requests",
+	},
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		reqlog := req.Context().ReqLog
+		if reqlog == nil {
+			res.SetError(errNoReqLog, cmds.ErrClient)
+			return
+		}
+		reqlog.ClearInactive()
+	},
+}
+
+var diagCmdsSetTimeCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Set how long finished requests are listed",
+		ShortDescription: `
+Sets how long 'ipfs diag cmds' lists requests after they finish, as a
+duration such as "10m". It is a minute by default.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("time", true, false, "How long finished requests are listed"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		reqlog := req.Context().ReqLog
+		if reqlog == nil {
+			res.SetError(errNoReqLog, cmds.ErrClient)
+			return
+		}
+		t, err := time.ParseDuration(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		reqlog.SetKeepTime(t)
+	},
+}
@@ -0,0 +1,291 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	conn "github.com/ipfs/go-ipfs/p2p/net/conn"
+	swarm "github.com/ipfs/go-ipfs/p2p/net/swarm"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
+	identify "github.com/ipfs/go-ipfs/p2p/protocol/identify"
+	pb "github.com/ipfs/go-ipfs/p2p/protocol/identify/pb"
+	u "github.com/ipfs/go-ipfs/util"
+	iaddr "github.com/ipfs/go-ipfs/util/ipfsaddr"
+
+	ggio "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/io"
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+	psy "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-peerstream/transport/yamux"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// The stages of a connection, in the order they are attempted.
+const (
+	stageResolve   = "resolution"
+	stageDial      = "dial"
+	stageHandshake = "handshake"
+	stageMuxer     = "muxer"
+	stageIdentify  = "identify"
+)
+
+// ConnectStage is the outcome of one stage of a diagnostic connection
+// attempt. Address is empty for the resolution stage.
+type ConnectStage struct {
+	Address string
+	Stage   string
+	Success bool
+	Error   string `json:",omitempty"`
+	Detail  string `json:",omitempty"`
+}
+
+var diagConnectCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Diagnose why a connection to a peer fails",
+		ShortDescription: `
+Resolves the addresses of the given peer, then tries each one in turn,
+reporting every stage of the connection separately:
+
+  resolution  finding addresses for the peer ID
+  dial        opening the raw transport connection
+  handshake   negotiating the encrypted channel and checking the peer ID
+  muxer       setting up stream multiplexing
+  identify    exchanging identify messages
+
+The peer may be given as a peer ID, or as a multiaddr ending in
+/ipfs/<peerid> to test that address only. The probe uses its own
+connection, so existing connections to the peer are left untouched.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", true, false, "peer ID or multiaddr of the peer to diagnose").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("timeout", "timeout for each address attempted"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !n.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		var addr ma.Multiaddr
+		var pid peer.ID
+		arg := req.Arguments()[0]
+		if strings.HasPrefix(arg, "/") {
+			a, err := iaddr.ParseString(arg)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			addr, pid = a.Transport(), a.ID()
+		} else {
+			pid, err = peer.IDB58Decode(arg)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		timeoutS, _, err := req.Option("timeout").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		timeout := DefaultDiagnosticTimeout
+		if timeoutS != "" {
+			t, err := time.ParseDuration(timeoutS)
+			if err != nil {
+				res.SetError(errors.New("error parsing timeout"), cmds.ErrNormal)
+				return
+			}
+			timeout = t
+		}
+
+		outChan := make(chan interface{})
+		go func() {
+			defer close(outChan)
+			diagConnect(req.Context().Context, n, pid, addr, timeout, outChan)
+		}()
+		res.SetOutput((<-chan interface{})(outChan))
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			outChan, ok := res.Output().(<-chan interface{})
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			marshal := func(v interface{}) (io.Reader, error) {
+				st, ok := v.(*ConnectStage)
+				if !ok {
+					return nil, u.ErrCast()
+				}
+
+				buf := new(bytes.Buffer)
+				if st.Address != "" {
+					fmt.Fprintf(buf, "%s ", st.Address)
+				}
+				fmt.Fprintf(buf, "%s: ", st.Stage)
+				if st.Success {
+					buf.WriteString("ok")
+				} else {
+					buf.WriteString("failed: " + st.Error)
+				}
+				if st.Detail != "" {
+					fmt.Fprintf(buf, " (%s)", st.Detail)
+				}
+				buf.WriteString("\n")
+				return buf, nil
+			}
+
+			return &cmds.ChannelMarshaler{
+				Channel:   outChan,
+				Marshaler: marshal,
+			}, nil
+		},
+	},
+	Type: ConnectStage{},
+}
+
+// diagConnect resolves the addresses of pid (unless addr is given) and
+// probes each of them, sending a ConnectStage on out for every stage it
+// attempts. Probing an address stops at its first failing stage.
+func diagConnect(ctx context.Context, n *core.IpfsNode, pid peer.ID, addr ma.Multiaddr, timeout time.Duration, out chan<- interface{}) {
+	var addrs []ma.Multiaddr
+	if addr != nil {
+		addrs = []ma.Multiaddr{addr}
+	} else {
+		addrs = n.Peerstore.Addrs(pid)
+		if len(addrs) == 0 {
+			fctx, cancel := context.WithTimeout(ctx, timeout)
+			pi, err := n.Routing.FindPeer(fctx, pid)
+			cancel()
+			if err != nil {
+				out <- &ConnectStage{Stage: stageResolve, Error: err.Error()}
+				return
+			}
+			addrs = pi.Addrs
+		}
+	}
+	if len(addrs) == 0 {
+		out <- &ConnectStage{Stage: stageResolve, Error: "peer has no addresses"}
+		return
+	}
+	out <- &ConnectStage{
+		Stage:   stageResolve,
+		Success: true,
+		Detail:  fmt.Sprintf("%d addresses", len(addrs)),
+	}
+
+	for _, a := range addrs {
+		actx, cancel := context.WithTimeout(ctx, timeout)
+		probeAddr(actx, n, pid, a, out)
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+// probeDialer returns the dialer to probe addresses with: that of the
+// swarm of n, so that its transports and private network are those
+// probed, without adding the conns it opens to the swarm.
+func probeDialer(n *core.IpfsNode) *conn.Dialer {
+	if snet, ok := n.PeerHost.Network().(*swarm.Network); ok {
+		return snet.Swarm().Dialer(n.PrivateKey)
+	}
+	return &conn.Dialer{
+		Dialer: manet.Dialer{
+			Dialer: net.Dialer{Timeout: swarm.DialTimeout},
+		},
+		LocalPeer:  n.Identity,
+		PrivateKey: n.PrivateKey,
+	}
+}
+
+// probeAddr walks a single address through the connection stages.
+func probeAddr(ctx context.Context, n *core.IpfsNode, pid peer.ID, addr ma.Multiaddr, out chan<- interface{}) {
+	report := func(stage string, err error, detail string) bool {
+		st := &ConnectStage{
+			Address: addr.String(),
+			Stage:   stage,
+			Success: err == nil,
+			Detail:  detail,
+		}
+		if err != nil {
+			st.Error = err.Error()
+		}
+		out <- st
+		return err == nil
+	}
+
+	d := probeDialer(n)
+	raw, err := d.DialRaw(ctx, addr, pid)
+	if !report(stageDial, err, transportName(addr)) {
+		return
+	}
+	raw.Close()
+
+	c, err := d.Dial(ctx, addr, pid)
+	if err == nil && c.RemotePeer() != pid {
+		err = fmt.Errorf("remote identified as %s", c.RemotePeer().Pretty())
+		c.Close()
+	}
+	if !report(stageHandshake, err, "") {
+		return
+	}
+	defer c.Close()
+
+	mc, err := psy.DefaultTransport.NewConn(c, false)
+	if err != nil {
+		report(stageMuxer, err, "")
+		return
+	}
+	defer mc.Close()
+	s, err := mc.OpenStream()
+	if !report(stageMuxer, err, "yamux") {
+		return
+	}
+	defer s.Close()
+
+	mes := new(pb.Identify)
+	done := make(chan error, 1)
+	go func() {
+		if err := protocol.WriteHeader(s, identify.ID); err != nil {
+			done <- err
+			return
+		}
+		done <- ggio.NewDelimitedReader(s, 2048).ReadMsg(mes)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err == io.EOF {
+		err = errors.New("remote closed the identify stream")
+	}
+	if err != nil {
+		report(stageIdentify, err, "")
+		return
+	}
+	report(stageIdentify, nil, fmt.Sprintf("%s %s", mes.GetAgentVersion(), mes.GetProtocolVersion()))
+}
@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	core "github.com/ipfs/go-ipfs/core"
+	bhost "github.com/ipfs/go-ipfs/p2p/host/basic"
+	pnet "github.com/ipfs/go-ipfs/p2p/net/pnet"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	testutil "github.com/ipfs/go-ipfs/p2p/test/util"
+	offroute "github.com/ipfs/go-ipfs/routing/offline"
+)
+
+// collectStages runs diagConnect and returns the stages it reports.
+func collectStages(ctx context.Context, n *core.IpfsNode, pid peer.ID, addr ma.Multiaddr) []*ConnectStage {
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		diagConnect(ctx, n, pid, addr, 5*time.Second, out)
+	}()
+	var stages []*ConnectStage
+	for v := range out {
+		stages = append(stages, v.(*ConnectStage))
+	}
+	return stages
+}
+
+// expectStages fails unless stages are those named, in order, the last one
+// failing if failed.
+func expectStages(t *testing.T, stages []*ConnectStage, failed bool, names ...string) {
+	if len(stages) != len(names) {
+		t.Fatalf("expected the stages %v, got %d of them: %v", names, len(stages), stages)
+	}
+	for i, st := range stages {
+		if st.Stage != names[i] {
+			t.Fatalf("expected stage %s, got %s", names[i], st.Stage)
+		}
+		ok := !(failed && i == len(stages)-1)
+		if st.Success != ok {
+			t.Fatalf("%s: expected success %v, got %+v", st.Stage, ok, st)
+		}
+		if !st.Success && st.Error == "" {
+			t.Fatalf("%s: expected the error of the failed stage", st.Stage)
+		}
+	}
+}
+
+func TestDiagConnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := testutil.GenHostSwarm(t, ctx)
+	dst := testutil.GenHostSwarm(t, ctx)
+	n := nodeOnHost(t, ctx, src)
+	n.PrivateKey = src.Peerstore().PrivKey(src.ID())
+
+	stages := collectStages(ctx, n, dst.ID(), dst.Addrs()[0])
+	expectStages(t, stages, false, stageResolve, stageDial, stageHandshake, stageMuxer, stageIdentify)
+	if stages[1].Address != dst.Addrs()[0].String() {
+		t.Fatalf("expected the stages of %s, got those of %s", dst.Addrs()[0], stages[1].Address)
+	}
+	if len(src.Network().ConnsToPeer(dst.ID())) != 0 {
+		t.Fatal("expected the probe to leave the network of the node alone")
+	}
+
+	// the addresses of the peer are those known to the node
+	src.Peerstore().AddAddr(dst.ID(), dst.Addrs()[0], time.Hour)
+	stages = collectStages(ctx, n, dst.ID(), nil)
+	expectStages(t, stages, false, stageResolve, stageDial, stageHandshake, stageMuxer, stageIdentify)
+
+	// another peer listens at the address
+	other := testutil.GenHostSwarm(t, ctx)
+	stages = collectStages(ctx, n, other.ID(), dst.Addrs()[0])
+	expectStages(t, stages, true, stageResolve, stageDial, stageHandshake)
+
+	// nothing listens at the address
+	closed := ma.StringCast("/ip4/127.0.0.1/tcp/1")
+	stages = collectStages(ctx, n, dst.ID(), closed)
+	expectStages(t, stages, true, stageResolve, stageDial)
+
+	// nor are there any for the peer to be found
+	n.Routing = offroute.NewOfflineRouter(n.Repo.Datastore(), n.PrivateKey)
+	stages = collectStages(ctx, n, other.ID(), nil)
+	expectStages(t, stages, true, stageResolve)
+}
+
+// TestDiagConnectPrivateNetwork probes a peer of the private network of the
+// node, which the node only gets through to with the key of the network.
+func TestDiagConnectPrivateNetwork(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	psk := new(pnet.PSK)
+	psk[0] = 1
+	src := bhost.New(testutil.GenPrivateSwarmNetwork(t, ctx, psk))
+	dst := bhost.New(testutil.GenPrivateSwarmNetwork(t, ctx, psk))
+	n := nodeOnHost(t, ctx, src)
+	n.PrivateKey = src.Peerstore().PrivKey(src.ID())
+
+	stages := collectStages(ctx, n, dst.ID(), dst.Addrs()[0])
+	expectStages(t, stages, false, stageResolve, stageDial, stageHandshake, stageMuxer, stageIdentify)
+
+	// a peer outside of the network fails the handshake
+	other := testutil.GenHostSwarm(t, ctx)
+	stages = collectStages(ctx, n, other.ID(), other.Addrs()[0])
+	expectStages(t, stages, true, stageResolve, stageDial, stageHandshake)
+}
@@ -1,11 +1,15 @@
 package commands
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"strings"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	namesys "github.com/ipfs/go-ipfs/namesys"
+	path "github.com/ipfs/go-ipfs/path"
+	config "github.com/ipfs/go-ipfs/repo/config"
 	util "github.com/ipfs/go-ipfs/util"
 )
 
@@ -24,9 +28,12 @@ remember.  To create memorable aliases for multihashes, DNS TXT
 records can point to other DNS links, IPFS objects, IPNS keys, etc.
 This command resolves those links to the referenced object.
 
+The TXT records of _dnslink.<domain-name> are looked up first, and those
+of <domain-name> itself only if none of them is a DNS link.
+
 For example, with this DNS TXT record:
 
-  ipfs.io. TXT "dnslink=/ipfs/QmRzTuh2Lpuz7Gr39stNr6mTFdqAghsZec1JoUnfySUzcy ..."
+  _dnslink.ipfs.io. TXT "dnslink=/ipfs/QmRzTuh2Lpuz7Gr39stNr6mTFdqAghsZec1JoUnfySUzcy ..."
 
 The resolver will give:
 
@@ -35,14 +42,17 @@ The resolver will give:
 
 And with this DNS TXT record:
 
-  ipfs.ipfs.io. TXT "dnslink=/dns/ipfs.io ..."
+  ipfs.ipfs.io. TXT "dnslink=/ipns/ipfs.io ..."
 
 The resolver will give:
 
-  > ipfs dns ipfs.io
-  /dns/ipfs.io
-  > ipfs dns --recursive
+  > ipfs dns ipfs.ipfs.io
+  /ipns/ipfs.io
+  > ipfs dns --recursive ipfs.ipfs.io
   /ipfs/QmRzTuh2Lpuz7Gr39stNr6mTFdqAghsZec1JoUnfySUzcy
+
+With --recursive, DNS links pointing at IPNS keys are followed too, and
+the keys resolved in turn, through at most --depth links (32 by default).
 `,
 	},
 
@@ -51,18 +61,50 @@ The resolver will give:
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("recursive", "r", "Resolve until the result is not a DNS link"),
+		cmds.IntOption("depth", "How many links to follow at most with --recursive (default: 32)"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 
 		recursive, _, _ := req.Option("recursive").Bool()
 		name := req.Arguments()[0]
-		resolver := namesys.NewDNSResolver()
 
-		depth := 1
-		if recursive {
-			depth = namesys.DefaultDepthLimit
+		if !recursive {
+			output, err := namesys.NewDNSResolver().ResolveN(req.Context().Context, name, 1)
+			// a link to anything but an IPFS path is as far as one step goes
+			if err != nil && err != namesys.ErrResolveRecursion {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			res.SetOutput(&ResolvedPath{output})
+			return
+		}
+
+		depth := namesys.DefaultDepthLimit
+		if d, found, err := req.Option("depth").Int(); err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		} else if found {
+			if d < 1 {
+				res.SetError(fmt.Errorf("invalid depth %d", d), cmds.ErrClient)
+				return
+			}
+			depth = d
+		}
+
+		// the node's name system follows the links to IPNS keys as well
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if !n.OnlineMode() {
+			if err := n.SetupOfflineRouting(); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
 		}
-		output, err := resolver.ResolveN(req.Context().Context, name, depth)
+
+		output, err := n.Namesys.ResolveN(req.Context().Context, "/ipns/"+name, depth)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -79,4 +121,96 @@ The resolver will give:
 		},
 	},
 	Type: ResolvedPath{},
+	Subcommands: map[string]*cmds.Command{
+		"publish": dnsPublishCmd,
+	},
+}
+
+var dnsPublishCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Point a domain's DNSLink record at an IPFS path",
+		ShortDescription: `
+Replaces the TXT records at _dnslink.<domain-name> with
+
+  dnslink=<ipfs-path>
+
+by sending an RFC 2136 dynamic update to the server configured in the
+DNSLink section of the config:
+
+  "DNSLink": {
+    "Server": "ns1.example.com:53",
+    "Zone": "example.com.",
+    "TTL": 60,
+    "TsigName": "ipfs-key.",
+    "TsigSecretFile": "/etc/ipfs/tsig.key",
+    "TsigAlgorithm": "hmac-sha256"
+  }
+
+The TSIG secret is read, base64 encoded, from TsigSecretFile, which must
+have mode 0600 or stricter.
+
+Run this after 'ipfs add' or 'ipfs name publish' to move a DNSLink-hosted
+site to new content.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("domain-name", true, false, "The domain whose DNSLink record to update"),
+		cmds.StringArg("ipfs-path", true, false, "The path the record should point to").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		cfg, err := req.Context().GetConfig()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		dl := cfg.DNSLink
+		if dl.Server == "" || dl.Zone == "" {
+			res.SetError(errors.New("DNSLink.Server and DNSLink.Zone must be set in the config"), cmds.ErrNormal)
+			return
+		}
+
+		value, err := path.ParsePath(req.Arguments()[1])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var tsig *namesys.TSIGKey
+		if dl.TsigName != "" {
+			if dl.TsigSecretFile == "" {
+				res.SetError(errors.New("DNSLink.TsigSecretFile must be set to sign updates as DNSLink.TsigName"), cmds.ErrNormal)
+				return
+			}
+			secret, err := config.ReadSecretFile(dl.TsigSecretFile)
+			if err != nil {
+				res.SetError(fmt.Errorf("reading DNSLink.TsigSecretFile: %s", err), cmds.ErrNormal)
+				return
+			}
+			tsig = &namesys.TSIGKey{
+				Name:      dl.TsigName,
+				Secret:    secret,
+				Algorithm: dl.TsigAlgorithm,
+			}
+		}
+
+		pub := namesys.NewRFC2136Publisher(dl.Server, dl.Zone, dl.TTL, tsig)
+		if err := pub.PublishDNSLink(req.Context().Context, req.Arguments()[0], value); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&ResolvedPath{value})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			output, ok := res.Output().(*ResolvedPath)
+			if !ok {
+				return nil, util.ErrCast()
+			}
+			domain := res.Request().Arguments()[0]
+			return strings.NewReader(fmt.Sprintf("Published %s.%s: %s\n",
+				namesys.DNSLinkSubdomain, domain, output.Path)), nil
+		},
+	},
+	Type: ResolvedPath{},
 }
@@ -0,0 +1,182 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+type ExperimentOutput struct {
+	Name        string
+	Description string
+	Enabled     bool
+}
+
+type ExperimentList struct {
+	Experiments []ExperimentOutput
+}
+
+var ExperimentsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List and toggle the experimental features",
+		Synopsis: `
+ipfs experiments                  - List the experiments, and whether they are enabled
+ipfs experiments enable <name>    - Enable an experiment
+ipfs experiments disable <name>   - Disable an experiment
+`,
+		ShortDescription: `
+Experimental features ship disabled, as they, or the data they write,
+may still change. Each is enabled by the key Experiments.<name> of the
+config, which 'ipfs experiments enable' and 'ipfs experiments disable'
+set. The commands of a disabled experiment fail, saying how to enable it.
+`,
+		LongDescription: `
+Experimental features ship disabled, as they, or the data they write,
+may still change. Each is enabled by the key Experiments.<name> of the
+config, which 'ipfs experiments enable' and 'ipfs experiments disable'
+set. The commands of a disabled experiment fail, saying how to enable it.
+
+The experiments are:
+
+    Filestore   'ipfs add --nocopy', and 'ipfs filestore'
+    Pubsub      'ipfs pubsub', as the daemon runs with --enable-pubsub-experiment
+    Relay       circuits to and through relays, set up by Relay in the config
+    Sharding    'ipfs add --enable-sharding'
+
+Pubsub and Relay are set up when the node starts: the daemon has to be
+restarted for them to be enabled or disabled.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		e := n.Repo.Config().Experiments
+		out := &ExperimentList{Experiments: []ExperimentOutput{}}
+		for _, x := range config.ExperimentList {
+			out.Experiments = append(out.Experiments, ExperimentOutput{
+				Name:        x.Name,
+				Description: x.Description,
+				Enabled:     x.Enabled(&e),
+			})
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: experimentListMarshaler,
+	},
+	Type: ExperimentList{},
+	Subcommands: map[string]*cmds.Command{
+		"enable":  experimentsEnableCmd,
+		"disable": experimentsDisableCmd,
+	},
+}
+
+var experimentsEnableCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Enable an experimental feature",
+		ShortDescription: `
+'ipfs experiments enable' sets Experiments.<name> in the config.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, true, "The name of the experiment, e.g. Sharding"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		setExperiments(req, res, true)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: experimentListMarshaler,
+	},
+	Type: ExperimentList{},
+}
+
+var experimentsDisableCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Disable an experimental feature",
+		ShortDescription: `
+'ipfs experiments disable' unsets Experiments.<name> in the config.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, true, "The name of the experiment, e.g. Sharding"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		setExperiments(req, res, false)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: experimentListMarshaler,
+	},
+	Type: ExperimentList{},
+}
+
+// setExperiments enables or disables the experiments named by the
+// arguments of req, and saves them to the config.
+func setExperiments(req cmds.Request, res cmds.Response, enabled bool) {
+	n, err := req.Context().GetNode()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
+	var xs []*config.Experiment
+	for _, name := range req.Arguments() {
+		x, err := config.FindExperiment(name)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		xs = append(xs, x)
+	}
+
+	cfg, err := n.Repo.Config().Clone()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	out := &ExperimentList{}
+	for _, x := range xs {
+		x.Set(&cfg.Experiments, enabled)
+		out.Experiments = append(out.Experiments, ExperimentOutput{
+			Name:        x.Name,
+			Description: x.Description,
+			Enabled:     enabled,
+		})
+	}
+	if err := n.Repo.SetConfig(cfg); err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	res.SetOutput(out)
+}
+
+func experimentListMarshaler(res cmds.Response) (io.Reader, error) {
+	list, ok := res.Output().(*ExperimentList)
+	if !ok {
+		return nil, u.ErrCast()
+	}
+
+	buf := new(bytes.Buffer)
+	for _, x := range list.Experiments {
+		state := "disabled"
+		if x.Enabled {
+			state = "enabled"
+		}
+		fmt.Fprintf(buf, "%-10s %-9s %s\n", x.Name, state, x.Description)
+	}
+	return buf, nil
+}
+
+// requireExperiment returns an error unless the experiment of name is
+// enabled in the config of n.
+func requireExperiment(n *core.IpfsNode, name string) error {
+	return n.Repo.Config().Experiments.Require(name)
+}
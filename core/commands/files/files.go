@@ -0,0 +1,730 @@
+package files
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	gopath "path"
+	"strings"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	ipnsfs "github.com/ipfs/go-ipfs/ipnsfs"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	path "github.com/ipfs/go-ipfs/path"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+var errNegativeRange = errors.New("--offset and --count must not be negative")
+
+var FilesCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manipulate unixfs files in a mutable tree",
+		ShortDescription: `
+'ipfs files' keeps a mutable tree of unixfs files and directories,
+which can be changed with familiar commands instead of patching
+objects by hand. The tree is kept in the repo: every change produces
+a new root object, which is pinned and recorded before the command
+returns. 'ipfs files stat /' shows the hash of the current root.
+
+Paths name entries in the tree and must start with '/'.
+`,
+		Synopsis: `
+ipfs files ls [-l] [<path>]                  - List directory contents
+ipfs files stat <path>                       - Show information about an entry
+ipfs files read [-o <n>] [-n <n>] <path>     - Output the contents of a file
+ipfs files write [-e] [-t] [-o <n>] <path> <data>
+                                             - Write data to a file
+ipfs files mkdir [-p] <path>                 - Create a directory
+ipfs files cp <source> <dest>                - Copy an entry or ipfs object
+ipfs files mv <source> <dest>                - Move an entry
+ipfs files rm [-r] <path>                    - Remove an entry
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":    FilesLsCmd,
+		"stat":  FilesStatCmd,
+		"read":  FilesReadCmd,
+		"write": FilesWriteCmd,
+		"mkdir": FilesMkdirCmd,
+		"cp":    FilesCpCmd,
+		"mv":    FilesMvCmd,
+		"rm":    FilesRmCmd,
+	},
+}
+
+type FilesEntry struct {
+	Name string
+	Type string
+	Size uint64
+	Hash string
+}
+
+type FilesLsOutput struct {
+	Entries []FilesEntry
+}
+
+var FilesLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List directories in the mutable tree",
+		ShortDescription: `
+Lists the entries of the directory at <path>, or the root directory if
+no path is given. With '-l', the type, size and hash of each entry are
+shown too. Listing a file shows the file itself.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", false, false, "Path of the directory to list"),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("l", "Use a long listing format"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		p := "/"
+		if len(req.Arguments()) > 0 {
+			p = req.Arguments()[0]
+		}
+		fsn, err := lookup(n.FilesRoot.GetValue(), p)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		output := &FilesLsOutput{}
+		switch fsn := fsn.(type) {
+		case *ipnsfs.Directory:
+			for _, name := range fsn.List() {
+				child, err := fsn.Child(name)
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+				entry, err := statEntry(name, child)
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+				output.Entries = append(output.Entries, *entry)
+			}
+		default:
+			entry, err := statEntry(gopath.Base(p), fsn)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			output.Entries = append(output.Entries, *entry)
+		}
+		res.SetOutput(output)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*FilesLsOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			long, _, _ := res.Request().Option("l").Bool()
+
+			buf := new(bytes.Buffer)
+			for _, e := range out.Entries {
+				if long {
+					fmt.Fprintf(buf, "%s %-9s %10d %s\n", e.Hash, e.Type, e.Size, e.Name)
+				} else {
+					fmt.Fprintln(buf, e.Name)
+				}
+			}
+			return buf, nil
+		},
+	},
+	Type: FilesLsOutput{},
+}
+
+type FilesStatOutput struct {
+	Hash           string
+	Type           string
+	Size           uint64
+	CumulativeSize uint64
+	Blocks         int
+}
+
+var FilesStatCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show information about an entry in the mutable tree",
+		ShortDescription: `
+Shows the hash, type and sizes of the file or directory at <path>.
+Size is the length of a file's contents; CumulativeSize is the size of
+the whole object graph below the entry.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "Path of the entry"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		fsn, err := lookup(n.FilesRoot.GetValue(), req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		nd, err := fsn.GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		entry, err := statEntry("", fsn)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		cumulative, err := nd.Size()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&FilesStatOutput{
+			Hash:           entry.Hash,
+			Type:           entry.Type,
+			Size:           entry.Size,
+			CumulativeSize: cumulative,
+			Blocks:         len(nd.Links),
+		})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*FilesStatOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			fmt.Fprintln(buf, out.Hash)
+			fmt.Fprintf(buf, "Type: %s\n", out.Type)
+			fmt.Fprintf(buf, "Size: %d\n", out.Size)
+			fmt.Fprintf(buf, "CumulativeSize: %d\n", out.CumulativeSize)
+			fmt.Fprintf(buf, "ChildBlocks: %d\n", out.Blocks)
+			return buf, nil
+		},
+	},
+	Type: FilesStatOutput{},
+}
+
+var FilesReadCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Output the contents of a file in the mutable tree",
+		ShortDescription: `
+Outputs the contents of the file at <path>. Use '--offset' to start
+reading further into the file, and '--count' to limit the number of
+bytes output.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "Path of the file to read"),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption("offset", "o", "Byte offset to begin reading from"),
+		cmds.IntOption("count", "n", "Maximum number of bytes to read"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		offset, _, err := req.Option("offset").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		count, limited, err := req.Option("count").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		if offset < 0 || count < 0 {
+			res.SetError(errNegativeRange, cmds.ErrClient)
+			return
+		}
+
+		fsn, err := lookup(n.FilesRoot.GetValue(), req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		fi, ok := fsn.(*ipnsfs.File)
+		if !ok {
+			res.SetError(ipnsfs.ErrIsDirectory, cmds.ErrNormal)
+			return
+		}
+
+		// read from a snapshot of the file, so that concurrent writes
+		// and reads don't move each other's offsets.
+		nd, err := fi.GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		dr, err := uio.NewDagReader(req.Context().Context, nd, n.DAG)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if _, err := dr.Seek(int64(offset), os.SEEK_SET); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var r io.Reader = dr
+		if limited {
+			r = io.LimitReader(dr, int64(count))
+		}
+		res.SetOutput(r)
+	},
+}
+
+var FilesWriteCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Write data to a file in the mutable tree",
+		ShortDescription: `
+Writes <data> to the file at <path>, starting at '--offset' (the start
+of the file by default) and overwriting what was there. Use '--create'
+to create the file if it does not exist, and '--truncate' to empty it
+before writing.
+
+  echo "hello world" | ipfs files write --create /greeting
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "Path of the file to write to"),
+		cmds.FileArg("data", true, false, "Data to write").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption("offset", "o", "Byte offset to begin writing at"),
+		cmds.BoolOption("create", "e", "Create the file if it does not exist"),
+		cmds.BoolOption("truncate", "t", "Truncate the file before writing"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		offset, _, err := req.Option("offset").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		if offset < 0 {
+			res.SetError(errors.New("--offset must not be negative"), cmds.ErrClient)
+			return
+		}
+		create, _, _ := req.Option("create").Bool()
+		trunc, _, _ := req.Option("truncate").Bool()
+
+		fi, err := openFile(n, req.Arguments()[0], create)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		data, err := req.Files().NextFile()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer data.Close()
+
+		if trunc {
+			if err := fi.Truncate(0); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+		if _, err := fi.Seek(int64(offset), os.SEEK_SET); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if _, err := io.Copy(fi, data); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		// closing the file propagates the change up to the root
+		if err := fi.Close(); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(nil)
+	},
+}
+
+var FilesMkdirCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Create a directory in the mutable tree",
+		ShortDescription: `
+Creates the directory <path>. With '--parents', missing parent
+directories are created too, and it is not an error if the directory
+exists already.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "Path of the directory to create"),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("parents", "p", "Create parent directories as needed"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		parents, _, _ := req.Option("parents").Bool()
+
+		if err := mkdir(n, req.Arguments()[0], parents); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(nil)
+	},
+}
+
+var FilesCpCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Copy files into the mutable tree",
+		ShortDescription: `
+Copies <source> to <dest>, which must not exist yet. The source is
+either a path in the tree, or an /ipfs/ or /ipns/ path, which brings
+an existing object into the tree without copying its data:
+
+  ipfs files cp /ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn /empty
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("source", true, false, "Entry or ipfs path to copy"),
+		cmds.StringArg("dest", true, false, "Destination path in the tree"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		src, dst := req.Arguments()[0], req.Arguments()[1]
+		var nd *dag.Node
+		if strings.HasPrefix(src, "/ipfs/") || strings.HasPrefix(src, "/ipns/") {
+			nd, err = core.Resolve(req.Context().Context, n, path.Path(src))
+		} else {
+			nd, err = nodeAt(n.FilesRoot.GetValue(), src)
+		}
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if err := putNode(n.FilesRoot.GetValue(), dst, nd); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(nil)
+	},
+}
+
+var FilesMvCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Move entries within the mutable tree",
+		ShortDescription: `
+Moves the entry <source> to <dest>, which must not exist yet.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("source", true, false, "Entry to move"),
+		cmds.StringArg("dest", true, false, "Destination path in the tree"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		src, dst := req.Arguments()[0], req.Arguments()[1]
+		if src, err = checkPath(src); err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		if src == "/" {
+			res.SetError(errors.New("cannot move the root directory"), cmds.ErrClient)
+			return
+		}
+		if dst, err = checkPath(dst); err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		if strings.HasPrefix(dst, src+"/") {
+			res.SetError(fmt.Errorf("cannot move %s into itself", src), cmds.ErrClient)
+			return
+		}
+
+		// both steps make a single new root, so that the entry is never
+		// recorded at both paths, or at neither
+		err = n.FilesRoot.Batch(func(root *ipnsfs.Directory) error {
+			nd, err := nodeAt(root, src)
+			if err != nil {
+				return err
+			}
+			if err := putNode(root, dst, nd); err != nil {
+				return err
+			}
+			return remove(root, src, true)
+		})
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(nil)
+	},
+}
+
+var FilesRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove entries from the mutable tree",
+		ShortDescription: `
+Removes the file or directory at <path>. Directories that are not empty
+are only removed with '--recursive'.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "Path of the entry to remove"),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("recursive", "r", "Remove directories and their contents"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		recursive, _, _ := req.Option("recursive").Bool()
+
+		if err := remove(n.FilesRoot.GetValue(), req.Arguments()[0], recursive); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(nil)
+	},
+}
+
+// checkPath cleans a path in the tree, which must be absolute.
+func checkPath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("paths must start with '/': %s", p)
+	}
+	return gopath.Clean(p), nil
+}
+
+// lookup returns the entry at p in the tree below root.
+func lookup(root *ipnsfs.Directory, p string) (ipnsfs.FSNode, error) {
+	p, err := checkPath(p)
+	if err != nil {
+		return nil, err
+	}
+	fsn, err := ipnsfs.Lookup(root, p)
+	if err == os.ErrNotExist {
+		return nil, fmt.Errorf("%s does not exist", p)
+	}
+	return fsn, err
+}
+
+func lookupDir(root *ipnsfs.Directory, p string) (*ipnsfs.Directory, error) {
+	fsn, err := lookup(root, p)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := fsn.(*ipnsfs.Directory)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a directory", p)
+	}
+	return dir, nil
+}
+
+func nodeAt(root *ipnsfs.Directory, p string) (*dag.Node, error) {
+	fsn, err := lookup(root, p)
+	if err != nil {
+		return nil, err
+	}
+	return fsn.GetNode()
+}
+
+// statEntry describes fsn, naming it name.
+func statEntry(name string, fsn ipnsfs.FSNode) (*FilesEntry, error) {
+	nd, err := fsn.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	k, err := nd.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &FilesEntry{Name: name, Hash: k.B58String()}
+	switch fsn.Type() {
+	case ipnsfs.TDir:
+		entry.Type = "directory"
+	case ipnsfs.TFile:
+		entry.Type = "file"
+		pbn, err := ft.FromBytes(nd.Data)
+		if err != nil {
+			return nil, err
+		}
+		entry.Size = pbn.GetFilesize()
+	}
+	return entry, nil
+}
+
+// openFile returns the file at p, creating an empty one if it doesn't
+// exist and create is set.
+func openFile(n *core.IpfsNode, p string, create bool) (*ipnsfs.File, error) {
+	p, err := checkPath(p)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := lookupDir(n.FilesRoot.GetValue(), gopath.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+
+	name := gopath.Base(p)
+	fsn, err := dir.Child(name)
+	if err == os.ErrNotExist && create {
+		nd := &dag.Node{Data: ft.FilePBData(nil, 0)}
+		if _, err := n.DAG.Add(nd); err != nil {
+			return nil, err
+		}
+		if err := dir.AddChild(name, nd); err != nil {
+			return nil, err
+		}
+		fsn, err = dir.Child(name)
+	}
+	if err == os.ErrNotExist {
+		return nil, fmt.Errorf("%s does not exist", p)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fi, ok := fsn.(*ipnsfs.File)
+	if !ok {
+		return nil, fmt.Errorf("%s is a directory", p)
+	}
+	return fi, nil
+}
+
+func mkdir(n *core.IpfsNode, p string, parents bool) error {
+	p, err := checkPath(p)
+	if err != nil {
+		return err
+	}
+	if p == "/" {
+		if parents {
+			return nil
+		}
+		return os.ErrExist
+	}
+
+	dir := n.FilesRoot.GetValue()
+	parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i, name := range parts {
+		last := i == len(parts)-1
+		fsn, err := dir.Child(name)
+		switch {
+		case err == os.ErrNotExist && (parents || last):
+			dir, err = dir.Mkdir(name)
+			if err != nil {
+				return err
+			}
+			continue
+		case err == os.ErrNotExist:
+			return fmt.Errorf("%s does not exist", gopath.Dir(p))
+		case err != nil:
+			return err
+		case last && !parents:
+			return fmt.Errorf("%s already exists", p)
+		}
+
+		d, ok := fsn.(*ipnsfs.Directory)
+		if !ok {
+			return fmt.Errorf("%s is not a directory", "/"+strings.Join(parts[:i+1], "/"))
+		}
+		dir = d
+	}
+	return nil
+}
+
+// putNode links nd into the tree below root at p, which must not exist
+// yet.
+func putNode(root *ipnsfs.Directory, p string, nd *dag.Node) error {
+	p, err := checkPath(p)
+	if err != nil {
+		return err
+	}
+	if p == "/" {
+		return errors.New("cannot replace the root directory")
+	}
+	dir, err := lookupDir(root, gopath.Dir(p))
+	if err != nil {
+		return err
+	}
+
+	name := gopath.Base(p)
+	if _, err := dir.Child(name); err == nil {
+		return fmt.Errorf("%s already exists", p)
+	}
+	return dir.AddChild(name, nd)
+}
+
+// remove unlinks the entry at p from the tree below root.
+func remove(root *ipnsfs.Directory, p string, recursive bool) error {
+	p, err := checkPath(p)
+	if err != nil {
+		return err
+	}
+	if p == "/" {
+		return errors.New("cannot remove the root directory")
+	}
+	dir, err := lookupDir(root, gopath.Dir(p))
+	if err != nil {
+		return err
+	}
+
+	name := gopath.Base(p)
+	fsn, err := dir.Child(name)
+	if err == os.ErrNotExist {
+		return fmt.Errorf("%s does not exist", p)
+	}
+	if err != nil {
+		return err
+	}
+	if child, ok := fsn.(*ipnsfs.Directory); ok && !recursive && len(child.List()) > 0 {
+		return fmt.Errorf("%s is a directory that is not empty, use -r to remove it", p)
+	}
+	return dir.Unlink(name)
+}
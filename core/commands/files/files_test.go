@@ -0,0 +1,196 @@
+package files
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	cmds "github.com/ipfs/go-ipfs/commands"
+	files "github.com/ipfs/go-ipfs/commands/files"
+	"github.com/ipfs/go-ipfs/core"
+	ipnsfs "github.com/ipfs/go-ipfs/ipnsfs"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+)
+
+func newNode(t *testing.T) *core.IpfsNode {
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// run calls cmd on n with args and opts, and the data, if there is any,
+// as its file argument.
+func run(n *core.IpfsNode, cmd *cmds.Command, args []string, opts cmds.OptMap, data string) (interface{}, error) {
+	optDefs := make(map[string]cmds.Option)
+	for _, opt := range cmd.Options {
+		for _, name := range opt.Names() {
+			optDefs[name] = opt
+		}
+	}
+	var file files.File
+	if data != "" {
+		f := files.NewReaderFile("data", ioutil.NopCloser(strings.NewReader(data)), nil)
+		file = files.NewSliceFile("", []files.File{f})
+	}
+
+	req, err := cmds.NewRequest(nil, opts, args, file, cmd, optDefs)
+	if err != nil {
+		return nil, err
+	}
+	req.SetContext(cmds.Context{
+		Context:       context.Background(),
+		ConstructNode: func() (*core.IpfsNode, error) { return n, nil },
+	})
+	res := cmd.Call(req)
+	if res.Error() != nil {
+		return nil, res.Error()
+	}
+	return res.Output(), nil
+}
+
+func mustRun(t *testing.T, n *core.IpfsNode, cmd *cmds.Command, args []string, opts cmds.OptMap, data string) interface{} {
+	out, err := run(n, cmd, args, opts, data)
+	if err != nil {
+		t.Fatalf("%s: %s", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+func list(t *testing.T, n *core.IpfsNode, p string) []string {
+	out := mustRun(t, n, FilesLsCmd, []string{p}, nil, "").(*FilesLsOutput)
+	var names []string
+	for _, e := range out.Entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func read(t *testing.T, n *core.IpfsNode, p string) string {
+	out := mustRun(t, n, FilesReadCmd, []string{p}, nil, "")
+	b, err := ioutil.ReadAll(out.(io.Reader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestFilesCommands(t *testing.T) {
+	n := newNode(t)
+	defer n.Close()
+
+	mustRun(t, n, FilesMkdirCmd, []string{"/a/b"}, cmds.OptMap{"parents": true}, "")
+	mustRun(t, n, FilesWriteCmd, []string{"/a/b/f"}, cmds.OptMap{"create": true}, "hello")
+	if got := read(t, n, "/a/b/f"); got != "hello" {
+		t.Fatalf("expected hello, got %q", got)
+	}
+
+	mustRun(t, n, FilesMvCmd, []string{"/a/b/f", "/a/g"}, nil, "")
+	if got := strings.Join(list(t, n, "/a"), " "); got != "b g" {
+		t.Fatalf("expected b and g in /a, got %q", got)
+	}
+	if got := list(t, n, "/a/b"); len(got) != 0 {
+		t.Fatalf("expected /a/b empty after the move, got %v", got)
+	}
+	if got := read(t, n, "/a/g"); got != "hello" {
+		t.Fatalf("expected hello, got %q", got)
+	}
+
+	mustRun(t, n, FilesCpCmd, []string{"/a/g", "/h"}, nil, "")
+	if _, err := run(n, FilesRmCmd, []string{"/a"}, nil, ""); err == nil {
+		t.Fatal("expected an error removing a directory that is not empty")
+	}
+	mustRun(t, n, FilesRmCmd, []string{"/a"}, cmds.OptMap{"recursive": true}, "")
+	if got := strings.Join(list(t, n, "/"), " "); got != "h" {
+		t.Fatalf("expected only h in /, got %q", got)
+	}
+
+	k, err := n.FilesRoot.GetNode().Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !n.Pinning.IsPinned(k) {
+		t.Fatal("the files root is not pinned")
+	}
+}
+
+// countRoot replaces the files root of n with one whose updates are
+// counted, and fail while fail is set.
+func countRoot(t *testing.T, n *core.IpfsNode, updates *int, fail *bool) {
+	root, err := ipnsfs.NewRoot(n.DAG, n.Pinning, n.FilesRoot.GetNode(), func(nd *dag.Node) error {
+		if *fail {
+			return errors.New("update failed")
+		}
+		*updates++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.FilesRoot = root
+}
+
+func TestFilesMvSingleUpdate(t *testing.T) {
+	n := newNode(t)
+	defer n.Close()
+	mustRun(t, n, FilesMkdirCmd, []string{"/a/b"}, cmds.OptMap{"parents": true}, "")
+	mustRun(t, n, FilesMkdirCmd, []string{"/c"}, nil, "")
+
+	var updates int
+	var fail bool
+	countRoot(t, n, &updates, &fail)
+
+	mustRun(t, n, FilesMvCmd, []string{"/a/b", "/c/b"}, nil, "")
+	if updates != 1 {
+		t.Fatalf("expected the move to update the root once, got %d", updates)
+	}
+
+	// a move that can't be recorded leaves the tree as it was
+	fail = true
+	before, err := n.FilesRoot.GetNode().Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(n, FilesMvCmd, []string{"/c/b", "/a/b"}, nil, ""); err == nil {
+		t.Fatal("expected the move to fail")
+	}
+	after, err := n.FilesRoot.GetNode().Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Fatal("the root changed on a failed move")
+	}
+	fail = false
+	if got := strings.Join(list(t, n, "/c"), " "); got != "b" {
+		t.Fatalf("expected b still in /c, got %q", got)
+	}
+	if got := list(t, n, "/a"); len(got) != 0 {
+		t.Fatalf("expected nothing moved to /a, got %v", got)
+	}
+}
+
+func TestFilesFailedWrite(t *testing.T) {
+	n := newNode(t)
+	defer n.Close()
+
+	var updates int
+	fail := true
+	countRoot(t, n, &updates, &fail)
+
+	if _, err := run(n, FilesMkdirCmd, []string{"/a"}, nil, ""); err == nil {
+		t.Fatal("expected mkdir to fail")
+	}
+	fail = false
+	if got := list(t, n, "/"); len(got) != 0 {
+		t.Fatalf("expected the failed mkdir undone, got %v", got)
+	}
+	mustRun(t, n, FilesMkdirCmd, []string{"/b"}, nil, "")
+	if got := strings.Join(list(t, n, "/"), " "); got != "b" {
+		t.Fatalf("expected only b in /, got %q", got)
+	}
+}
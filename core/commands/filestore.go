@@ -0,0 +1,203 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	filestore "github.com/ipfs/go-ipfs/filestore"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+type FilestoreObject struct {
+	Key      string
+	FilePath string
+	Offset   uint64
+	Size     uint64
+	Status   string `json:",omitempty"`
+	Error    string `json:",omitempty"`
+}
+
+type FilestoreList struct {
+	Objects []FilestoreObject
+}
+
+var FilestoreCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage blocks kept in files outside the repo",
+		ShortDescription: `
+Files added with 'ipfs add --nocopy' stay where they are: the repo only
+records, for each block of their data, the file, offset and length it's
+read from. These commands list and check those records. If a file is
+moved, changed or deleted, its blocks can no longer be read.
+`,
+		Synopsis: `
+ipfs filestore ls            - List blocks kept in files
+ipfs filestore verify        - Check that those blocks can still be read
+ipfs filestore rm-orphans    - Forget blocks whose files changed or are gone
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":         filestoreLsCmd,
+		"verify":     filestoreVerifyCmd,
+		"rm-orphans": filestoreRmOrphansCmd,
+	},
+}
+
+var filestoreLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List blocks kept in files outside the repo",
+		ShortDescription: `
+Lists the hash of each block kept in a file, with the file, and the
+offset and length of the block's data in it.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		objs, err := listFilestore(req, nil)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&FilestoreList{Objects: objs})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*FilestoreList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			for _, o := range list.Objects {
+				fmt.Fprintf(buf, "%s %s %d %d\n", o.Key, o.FilePath, o.Offset, o.Size)
+			}
+			return buf, nil
+		},
+	},
+	Type: FilestoreList{},
+}
+
+var filestoreVerifyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Check that blocks kept in files can still be read",
+		ShortDescription: `
+Reads back every block kept in a file, and prints its status: 'ok' if it
+can be read, 'changed' if its file no longer holds its data, 'missing'
+if its file is gone, or 'error' if the file can't be read.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		objs, err := listFilestore(req, func(n *core.IpfsNode, l filestore.ListRes, o *FilestoreObject) bool {
+			verifyObject(n, l, o)
+			return true
+		})
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&FilestoreList{Objects: objs})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*FilestoreList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			for _, o := range list.Objects {
+				fmt.Fprintf(buf, "%-7s %s %s %d\n", o.Status, o.Key, o.FilePath, o.Offset)
+				if o.Error != "" {
+					fmt.Fprintf(buf, "        %s\n", o.Error)
+				}
+			}
+			return buf, nil
+		},
+	},
+	Type: FilestoreList{},
+}
+
+var filestoreRmOrphansCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Forget blocks whose files changed or are gone",
+		ShortDescription: `
+Removes the records of blocks that 'ipfs filestore verify' finds changed
+or missing, as they can't be read any more, and prints their hashes. The
+objects they belong to can be added again once their files are back.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		var rmErr error
+		objs, err := listFilestore(req, func(n *core.IpfsNode, l filestore.ListRes, o *FilestoreObject) bool {
+			verifyObject(n, l, o)
+			if o.Status != filestore.StatusChanged && o.Status != filestore.StatusMissing {
+				return false
+			}
+			if err := n.Filestore.Delete(l.Key); err != nil && rmErr == nil {
+				rmErr = err
+			}
+			return true
+		})
+		if err == nil {
+			err = rmErr
+		}
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&FilestoreList{Objects: objs})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*FilestoreList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			for _, o := range list.Objects {
+				fmt.Fprintf(buf, "removed %s (%s)\n", o.Key, o.Status)
+			}
+			return buf, nil
+		},
+	},
+	Type: FilestoreList{},
+}
+
+// listFilestore returns the blocks in the filestore for which keep, if
+// given, returns true. keep may fill in more of the object.
+func listFilestore(req cmds.Request, keep func(*core.IpfsNode, filestore.ListRes, *FilestoreObject) bool) ([]FilestoreObject, error) {
+	n, err := req.Context().GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if err := requireExperiment(n, "Filestore"); err != nil {
+		return nil, err
+	}
+
+	leaves, err := n.Filestore.List(req.Context().Context)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := []FilestoreObject{}
+	for l := range leaves {
+		o := FilestoreObject{
+			Key:      l.Key.B58String(),
+			FilePath: l.FilePath,
+			Offset:   l.Offset,
+			Size:     l.Size,
+		}
+		if keep == nil || keep(n, l, &o) {
+			objs = append(objs, o)
+		}
+	}
+	return objs, nil
+}
+
+func verifyObject(n *core.IpfsNode, l filestore.ListRes, o *FilestoreObject) {
+	status, err := n.Filestore.Verify(l.Key, l.DataObj)
+	o.Status = status
+	if err != nil {
+		o.Error = err.Error()
+	}
+}
@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// parseFormat compiles the value of a --format option. The format is a Go
+// template executed against fields, which must be a struct. As a shorthand,
+// <name> stands for {{.Name}}, where name is a field name in lower case,
+// so "<src> -> <dst>" and "{{.Src}} -> {{.Dst}}" are equivalent.
+func parseFormat(format string, fields interface{}) (*template.Template, error) {
+	t := reflect.TypeOf(fields)
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		format = strings.Replace(format, "<"+strings.ToLower(name)+">", "{{."+name+"}}", -1)
+	}
+
+	tmpl, err := template.New("format").Option("missingkey=error").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format: %s", err)
+	}
+
+	// catch references to fields that don't exist now, rather than
+	// halfway through the output.
+	if err := tmpl.Execute(new(bytes.Buffer), fields); err != nil {
+		return nil, fmt.Errorf("invalid format: %s", err)
+	}
+	return tmpl, nil
+}
+
+// execFormat runs tmpl against v and returns the result.
+func execFormat(tmpl *template.Template, v interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
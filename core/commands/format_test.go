@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	edge := RefEdge{Src: "QmA", Dst: "QmB", LinkName: "foo"}
+	for format, expected := range map[string]string{
+		"<src> -> <dst>":           "QmA -> QmB",
+		"{{.Src}} {{.LinkName}}":   "QmA foo",
+		"<dst> <linkname> <other>": "QmB foo <other>",
+	} {
+		tmpl, err := parseFormat(format, RefEdge{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := execFormat(tmpl, edge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != expected {
+			t.Errorf("format %q: expected %q, got %q", format, expected, s)
+		}
+	}
+
+	for _, format := range []string{"{{.Nope}}", "{{.Src"} {
+		if _, err := parseFormat(format, RefEdge{}); err == nil {
+			t.Errorf("format %q: expected an error", format)
+		}
+	}
+}
@@ -1,26 +1,34 @@
 package commands
 
 import (
+	"bytes"
 	"compress/gzip"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	gopath "path"
+	fp "path/filepath"
 	"strings"
 
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/cheggaaa/pb"
-	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
-	core "github.com/ipfs/go-ipfs/core"
-	path "github.com/ipfs/go-ipfs/path"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
 	tar "github.com/ipfs/go-ipfs/thirdparty/tar"
 	utar "github.com/ipfs/go-ipfs/unixfs/tar"
 )
 
 var ErrInvalidCompressionLevel = errors.New("Compression level must be between 1 and 9")
 
+var errContinueArchive = errors.New("--continue can't be used with --archive")
+
+var errArchiveFormat = errors.New("--archive-format must be tar or zip")
+
+var errVerifyArchive = errors.New("--verify and --manifest can't be used with --archive")
+
 var GetCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Download IPFS objects",
@@ -31,24 +39,108 @@ By default, the output will be stored at ./<ipfs-path>, but an alternate path
 can be specified with '--output=<path>' or '-o=<path>'.
 
 To output a TAR archive instead of unpacked files, use '--archive' or '-a'.
+For a ZIP archive, which Windows can open natively, use
+'--archive-format=zip' (this implies '--archive').
 
 To compress the output with GZIP compression, use '--compress' or '-C'. You
-may also specify the level of compression by specifying '-l=<1-9>'.
+may also specify the level of compression by specifying '-l=<1-9>'. ZIP
+archives are stored uncompressed unless '-C' is given, in which case their
+entries are deflated instead.
+
+To resume an interrupted download, use '--continue' with the same
+output path. Files already on disk are kept, partially written files are
+appended to, and only the blocks that are still missing are fetched. The
+data on disk is hashed and checked against the DAG first: a file whose
+data differs from that of the DAG is downloaded again in full.
+
+Several paths may be given at once. Each is stored in its own directory,
+./<ipfs-path>, or inside the directory given with '--output'. With
+'--archive', they are all put in a single archive, ./ipfs.tar by default.
+A path that can't be fetched doesn't stop the others: the error is
+reported once the rest are done, and archives hold a <name>.error file in
+its place.
+
+Symlinks are written as symlinks. To write files with identical contents
+only once, and hardlink the copies to the first one, use
+'--dedupe-links'. ZIP archives can't hold hardlinks, so it only applies to
+TAR output and unpacked files.
+
+The runs of zeros of the files unpacked are left as holes, for files like
+disk images to be sparse on filesystems which support them.
+
+To check the files written against the DAG, use '--verify': each file is
+read back once written and its data hashed into the blocks it came from,
+and the command fails on the first file that doesn't match. To also
+record what was written, use '--manifest=<file>', which implies
+'--verify': the manifest is a JSON file listing the path, size, hash and
+block hashes of every file. Both only apply to unpacked files. With
+'--continue', the blocks of the data already on disk are fetched too, to
+verify it.
+
+'--prefetch-window' sets how many blocks of a file are requested ahead of
+the one being read, 32 by default, as with 'ipfs cat'.
 `,
 	},
 
 	Arguments: []cmds.Argument{
-		cmds.StringArg("ipfs-path", true, false, "The path to the IPFS object(s) to be outputted").EnableStdin(),
+		cmds.StringArg("ipfs-path", true, true, "The path to the IPFS object(s) to be outputted").EnableStdin(),
 	},
 	Options: []cmds.Option{
 		cmds.StringOption("output", "o", "The path where output should be stored"),
 		cmds.BoolOption("archive", "a", "Output a TAR archive"),
+		cmds.StringOption("archive-format", "The archive format to output: tar or zip. Defaults to tar"),
 		cmds.BoolOption("compress", "C", "Compress the output with GZIP compression"),
 		cmds.IntOption("compression-level", "l", "The level of compression (1-9)"),
+		cmds.BoolOption("continue", "Resume a partial download into the output path"),
+		cmds.BoolOption("dedupe-links", "Hardlink files with identical contents instead of writing them again"),
+		cmds.BoolOption("verify", "Check each file written against the hashes of its blocks"),
+		cmds.StringOption("manifest", "Write a manifest of the files written to the given file (implies --verify)"),
+		cmds.IntOption(prefetchWindowOptionName, "Number of blocks to request ahead of the one being read (default: 32)"),
+		cmds.StringOption("offsets", "Sizes and hashes of the files already downloaded, as JSON (set by --continue)"),
 	},
 	PreRun: func(req cmds.Request) error {
 		_, err := getCompressOptions(req)
-		return err
+		if err != nil {
+			return err
+		}
+		format, err := getArchiveFormat(req)
+		if err != nil {
+			return err
+		}
+
+		archive, _, _ := req.Option("archive").Bool()
+		if getVerify(req) && (archive || format == "zip") {
+			return errVerifyArchive
+		}
+
+		resume, _, _ := req.Option("continue").Bool()
+		if !resume {
+			return nil
+		}
+		if archive || format == "zip" {
+			return errContinueArchive
+		}
+
+		// tell the daemon how much of each file we already have, and its
+		// hash, for the daemon to check it against the DAG.
+		outPath := getOutputPath(req)
+		offsets := make(map[string]utar.Resume)
+		for _, arg := range req.Arguments() {
+			_, name := gopath.Split(arg)
+			root := outPath
+			if len(req.Arguments()) > 1 {
+				root = fp.Join(outPath, name)
+			}
+			if err := localOffsets(offsets, root, name); err != nil {
+				return err
+			}
+		}
+		b, err := json.Marshal(offsets)
+		if err != nil {
+			return err
+		}
+		req.SetOption("offsets", string(b))
+		return nil
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		cmplvl, err := getCompressOptions(req)
@@ -57,17 +149,44 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 			return
 		}
 
+		format, err := getArchiveFormat(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
 		node, err := req.Context().GetNode()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
 
-		reader, err := get(req.Context().Context, node, req.Arguments()[0], cmplvl)
+		offsets, err := parseOffsets(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		dedupe, _, _ := req.Option("dedupe-links").Bool()
+
+		// the blocks of the DAG are fetched from the peers which have it
+		ctx, err := prefetchContext(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		reader, size, err := coreapi.NewCoreAPI(node).Unixfs().Get(ctx, req.Arguments(), coreapi.GetOptions{
+			Format:      format,
+			Compression: cmplvl,
+			Offsets:     offsets,
+			Dedupe:      dedupe,
+			Verify:      getVerify(req),
+		})
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
+		res.SetLength(size)
 		res.SetOutput(reader)
 	},
 	PostRun: func(req cmds.Request, res cmds.Response) {
@@ -77,11 +196,7 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		outReader := res.Output().(io.Reader)
 		res.SetOutput(nil)
 
-		outPath, _, _ := req.Option("output").String()
-		if len(outPath) == 0 {
-			_, outPath = gopath.Split(req.Arguments()[0])
-			outPath = gopath.Clean(outPath)
-		}
+		outPath := getOutputPath(req)
 
 		cmplvl, err := getCompressOptions(req)
 		if err != nil {
@@ -89,12 +204,19 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 			return
 		}
 
-		if archive, _, _ := req.Option("archive").Bool(); archive {
-			if !strings.HasSuffix(outPath, ".tar") {
-				outPath += ".tar"
-			}
-			if cmplvl != gzip.NoCompression {
-				outPath += ".gz"
+		format, _ := getArchiveFormat(req)
+		if archive, _, _ := req.Option("archive").Bool(); archive || format == "zip" {
+			if format == "zip" {
+				if !strings.HasSuffix(outPath, ".zip") {
+					outPath += ".zip"
+				}
+			} else {
+				if !strings.HasSuffix(outPath, ".tar") {
+					outPath += ".tar"
+				}
+				if cmplvl != gzip.NoCompression {
+					outPath += ".gz"
+				}
 			}
 			fmt.Printf("Saving archive to %s\n", outPath)
 
@@ -105,7 +227,13 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 			}
 			defer file.Close()
 
-			bar := pb.New(0).SetUnits(pb.U_BYTES)
+			// the file sizes are only a good estimate of the archive size
+			// when it isn't compressed.
+			var total int64
+			if cmplvl == gzip.NoCompression {
+				total = int64(res.Length())
+			}
+			bar := pb.New64(total).SetUnits(pb.U_BYTES)
 			bar.Output = os.Stderr
 			pbReader := bar.NewProxyReader(outReader)
 			bar.Start()
@@ -122,13 +250,13 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 
 		fmt.Printf("Saving file(s) to %s\n", outPath)
 
-		// TODO: get total length of files
-		bar := pb.New(0).SetUnits(pb.U_BYTES)
+		// the length is the total size of the files, so count the file
+		// bytes written rather than the bytes of the archive.
+		bar := pb.New64(int64(res.Length())).SetUnits(pb.U_BYTES)
 		bar.Output = os.Stderr
 
-		// wrap the reader with the progress bar proxy reader
-		// if the output is compressed, also wrap it in a gzip.Reader
-		var reader io.Reader
+		// if the output is compressed, wrap it in a gzip.Reader
+		reader := outReader
 		if cmplvl != gzip.NoCompression {
 			gzipReader, err := gzip.NewReader(outReader)
 			if err != nil {
@@ -136,18 +264,63 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 				return
 			}
 			defer gzipReader.Close()
-			reader = bar.NewProxyReader(gzipReader)
-		} else {
-			reader = bar.NewProxyReader(outReader)
+			reader = gzipReader
 		}
 
 		bar.Start()
 		defer bar.Finish()
 
-		extractor := &tar.Extractor{outPath}
+		var current string
+		var failed int
+		resume, _, _ := req.Option("continue").Bool()
+		extractor := &tar.Extractor{
+			Path:     outPath,
+			Resume:   resume,
+			KeepRoot: len(req.Arguments()) > 1,
+			Sparse:   true,
+			Progress: func(name string, n int64) {
+				if name != current {
+					current = name
+					bar.Prefix(gopath.Base(name) + " ")
+				}
+				bar.Add64(n)
+			},
+			PathError: func(name, msg string) {
+				failed++
+				fmt.Fprintf(os.Stderr, "Error: %s: %s\n", name, msg)
+			},
+		}
+		var manifest getManifest
+		if getVerify(req) {
+			extractor.Verify = func(name, path, hash string, blocks []byte) error {
+				f, err := verifyFile(path, hash, blocks)
+				if err != nil {
+					return err
+				}
+				manifest.Files = append(manifest.Files, f)
+				return nil
+			}
+		}
 		err = extractor.Extract(reader)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if extractor.Verify != nil {
+			bar.Finish()
+			fmt.Printf("Verified %d file(s) against their hashes\n", len(manifest.Files))
+		}
+		if manifestPath, _, _ := req.Option("manifest").String(); manifestPath != "" {
+			if err := writeManifest(manifestPath, &manifest); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			fmt.Printf("Saved manifest to %s\n", manifestPath)
+		}
+		if failed > 0 {
+			err = fmt.Errorf("%d of %d paths could not be fetched", failed, len(req.Arguments()))
+			res.SetError(err, cmds.ErrNormal)
 		}
 	},
 }
@@ -166,12 +339,138 @@ func getCompressOptions(req cmds.Request) (int, error) {
 	return gzip.NoCompression, nil
 }
 
-func get(ctx context.Context, node *core.IpfsNode, p string, compression int) (io.Reader, error) {
-	pathToResolve := path.Path(p)
-	dagnode, err := core.Resolve(ctx, node, pathToResolve)
+func getArchiveFormat(req cmds.Request) (string, error) {
+	format, found, _ := req.Option("archive-format").String()
+	if !found {
+		return "tar", nil
+	}
+	switch format {
+	case "tar", "zip":
+		return format, nil
+	}
+	return "", errArchiveFormat
+}
+
+// getVerify returns whether the files written are to be verified.
+func getVerify(req cmds.Request) bool {
+	verify, _, _ := req.Option("verify").Bool()
+	manifest, _, _ := req.Option("manifest").String()
+	return verify || manifest != ""
+}
+
+// getManifest is the manifest written with --manifest.
+type getManifest struct {
+	Files []manifestFile
+}
+
+type manifestFile struct {
+	Path   string
+	Hash   string
+	Size   int64
+	Blocks []string
+}
+
+// verifyFile checks the file written to path, of the given hash, against
+// the contents of its block list entry, and returns its manifest entry.
+func verifyFile(path, hash string, blocks []byte) (manifestFile, error) {
+	bs, err := utar.ParseBlockList(bytes.NewReader(blocks))
+	if err != nil {
+		return manifestFile{}, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return manifestFile{}, err
+	}
+	defer f.Close()
+	if err := utar.VerifyFile(f, bs); err != nil {
+		return manifestFile{}, fmt.Errorf("%s does not match %s: %s", path, hash, err)
+	}
+
+	mf := manifestFile{Path: path, Hash: hash, Blocks: make([]string, len(bs))}
+	for i, b := range bs {
+		mf.Size += b.Size
+		mf.Blocks[i] = b.Hash.B58String()
+	}
+	return mf, nil
+}
+
+func writeManifest(path string, m *getManifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+func getOutputPath(req cmds.Request) string {
+	outPath, _, _ := req.Option("output").String()
+	if len(outPath) != 0 {
+		return outPath
+	}
+
+	if len(req.Arguments()) > 1 {
+		// several paths go into the current directory, or into one
+		// archive.
+		format, _ := getArchiveFormat(req)
+		if archive, _, _ := req.Option("archive").Bool(); archive || format == "zip" {
+			return "ipfs"
+		}
+		return "."
+	}
+
+	_, outPath = gopath.Split(req.Arguments()[0])
+	return gopath.Clean(outPath)
+}
+
+// localOffsets adds the sizes and hashes of the files already written
+// under outPath to offsets, keyed by their names in the archive, which are
+// rooted at name.
+func localOffsets(offsets map[string]utar.Resume, outPath, name string) error {
+	return fp.Walk(outPath, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == outPath {
+				return nil // nothing downloaded yet
+			}
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
 
-	return utar.NewReader(pathToResolve, node.DAG, dagnode, compression)
+		rel, err := fp.Rel(outPath, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h, err := utar.HashPrefix(io.LimitReader(f, fi.Size()))
+		if err != nil {
+			return err
+		}
+		offsets[gopath.Join(name, fp.ToSlash(rel))] = utar.Resume{Offset: fi.Size(), Hash: h}
+		return nil
+	})
+}
+
+// parseOffsets returns the files already downloaded, as the offsets option
+// lists them.
+func parseOffsets(req cmds.Request) (map[string]utar.Resume, error) {
+	o, found, _ := req.Option("offsets").String()
+	if !found || o == "" {
+		return nil, nil
+	}
+	var offsets map[string]utar.Resume
+	if err := json.Unmarshal([]byte(o), &offsets); err != nil {
+		return nil, fmt.Errorf("invalid offsets: %s", err)
+	}
+	for name, r := range offsets {
+		if r.Offset < 0 || r.Hash == "" {
+			return nil, fmt.Errorf("invalid offset of %s: a size and a hash are needed", name)
+		}
+	}
+	return offsets, nil
 }
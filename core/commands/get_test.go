@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	fp "path/filepath"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	cmds "github.com/ipfs/go-ipfs/commands"
+	"github.com/ipfs/go-ipfs/importer"
+	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	path "github.com/ipfs/go-ipfs/path"
+	tar "github.com/ipfs/go-ipfs/thirdparty/tar"
+	utar "github.com/ipfs/go-ipfs/unixfs/tar"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// TestGetResume resumes the download of a file from the part of it on
+// disk, as get --continue does, and from a part which isn't that of the
+// file.
+func TestGetResume(t *testing.T) {
+	data, err := ioutil.ReadAll(io.LimitReader(u.NewTimeSeededRand(), 1024*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := mdtest.Mock(t)
+	nd, err := importer.BuildDagFromReader(bytes.NewReader(data), ds, chunk.DefaultSplitter, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := fp.Join(dir, "file")
+
+	changed := append([]byte(nil), data[:300000]...)
+	changed[1234] ^= 0xff
+	for name, local := range map[string][]byte{"prefix": data[:300000], "changed": changed} {
+		if err := ioutil.WriteFile(out, local, 0644); err != nil {
+			t.Fatal(err)
+		}
+		offsets := make(map[string]utar.Resume)
+		if err := localOffsets(offsets, out, "file"); err != nil {
+			t.Fatal(err)
+		}
+		if res := offsets["file"]; res.Offset != 300000 || res.Hash == "" {
+			t.Fatalf("%s: expected the size and hash of the part on disk, got %+v", name, res)
+		}
+
+		entries := []utar.Entry{{Path: path.Path("/ipfs/QmFoo/file"), Node: nd}}
+		r, err := utar.NewTarReader(context.Background(), entries, ds, gzip.NoCompression, offsets, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		te := &tar.Extractor{Path: out, Resume: true}
+		if err := te.Extract(r); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s: the file resumed differs from the DAG", name)
+		}
+	}
+}
+
+func TestParseOffsets(t *testing.T) {
+	optDefs := make(map[string]cmds.Option)
+	for _, opt := range GetCmd.Options {
+		for _, name := range opt.Names() {
+			optDefs[name] = opt
+		}
+	}
+	parse := func(o string) (map[string]utar.Resume, error) {
+		req, err := cmds.NewRequest(nil, cmds.OptMap{"offsets": o}, nil, nil, GetCmd, optDefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parseOffsets(req)
+	}
+
+	offsets, err := parse(`{"file":{"Offset":3,"Hash":"QmFoo"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offsets["file"] != (utar.Resume{Offset: 3, Hash: "QmFoo"}) {
+		t.Fatalf("wrong offsets: %v", offsets)
+	}
+	for _, o := range []string{`{"file":{"Offset":3}}`, `{"file":{"Offset":-1,"Hash":"QmFoo"}}`, `{"file":3}`} {
+		if _, err := parse(o); err == nil {
+			t.Fatalf("expected %s to be refused", o)
+		}
+	}
+}
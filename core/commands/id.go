@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"strings"
 
@@ -32,6 +33,9 @@ type IdOutput struct {
 	Addresses       []string
 	AgentVersion    string
 	ProtocolVersion string
+	// Reachability is whether peers can dial the local node: public,
+	// private or unknown. It is left out for other peers.
+	Reachability string `json:",omitempty"`
 }
 
 var IDCmd = &cmds.Command{
@@ -46,6 +50,7 @@ ipfs id supports the format option for output with the following keys:
 <aver>: agent version
 <pver>: protocol version
 <pubkey>: public key
+<reach>: reachability of the local node (public, private or unknown)
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -54,6 +59,9 @@ ipfs id supports the format option for output with the following keys:
 	Options: []cmds.Option{
 		cmds.StringOption("f", "format", "optional output format"),
 	},
+	Subcommands: map[string]*cmds.Command{
+		"rotate": IDRotateCmd,
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		node, err := req.Context().GetNode()
 		if err != nil {
@@ -119,6 +127,7 @@ ipfs id supports the format option for output with the following keys:
 				output = strings.Replace(output, "<aver>", val.AgentVersion, -1)
 				output = strings.Replace(output, "<pver>", val.ProtocolVersion, -1)
 				output = strings.Replace(output, "<pubkey>", val.PublicKey, -1)
+				output = strings.Replace(output, "<reach>", val.Reachability, -1)
 				return strings.NewReader(output), nil
 			} else {
 
@@ -191,7 +200,149 @@ func printSelf(node *core.IpfsNode) (interface{}, error) {
 			info.Addresses = append(info.Addresses, s)
 		}
 	}
+	if node.AutoNAT != nil {
+		info.Reachability = node.AutoNAT.Status().String()
+	}
 	info.ProtocolVersion = identify.IpfsVersion
 	info.AgentVersion = identify.ClientVersion
 	return info, nil
 }
+
+type IdRotateOutput struct {
+	Old string
+	New string
+	// OldKey is the name of the old identity key in the keystore.
+	OldKey string
+}
+
+var IDRotateCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Give the node a new identity keypair",
+		ShortDescription: `
+'ipfs id rotate' generates a new identity keypair for the node, of the
+--type and --size given as to 'ipfs key gen', and saves it to the config:
+the node has a new peer ID the next time it starts. The old identity key
+is kept in the keystore under the name of --old-key-backup, so that the
+names published with it can still be updated:
+
+  > ipfs id rotate --old-key-backup=old-self
+  > ipfs name publish --key=old-self /ipfs/<hash>
+
+The daemon must be stopped first.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("old-key-backup", "o", "The name to keep the old identity key under in the keystore"),
+		cmds.StringOption("type", "t", "The type of key to create: rsa (default) or ed25519"),
+		cmds.IntOption("size", "s", "The size of the key, in bits, for rsa keys (default: 2048)"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if n.OnlineMode() {
+			res.SetError(errors.New("the identity can't be rotated while the daemon is running, stop it first"), cmds.ErrClient)
+			return
+		}
+
+		backup, _, err := req.Option("old-key-backup").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if backup == "" {
+			res.SetError(errors.New("give --old-key-backup=<name> to keep the old identity key in the keystore"), cmds.ErrClient)
+			return
+		}
+		ks, err := writableKeystore(n, backup)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		if has, err := ks.Has(backup); err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		} else if has {
+			res.SetError(fmt.Errorf("a key named %q is in the keystore already", backup), cmds.ErrClient)
+			return
+		}
+
+		typ, _, err := req.Option("type").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		size, sizeFound, err := req.Option("size").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		kt, size, err := keyTypeAndSize(typ, size, sizeFound)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		if n.PrivateKey == nil {
+			if err := n.LoadPrivateKey(); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+		oldKey := n.PrivateKey
+
+		sk, _, err := ic.GenerateKeyPair(kt, size)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		skb, err := sk.Bytes()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		id, err := peer.IDFromPrivateKey(sk)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if err := ks.Put(backup, oldKey); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		cfg, err := n.Repo.Config().Clone()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		cfg.Identity.PeerID = id.Pretty()
+		cfg.Identity.PrivKey = base64.StdEncoding.EncodeToString(skb)
+		if err := n.Repo.SetConfig(cfg); err != nil {
+			// the old key is still the identity
+			if err := ks.Delete(backup); err != nil {
+				log.Errorf("removing the backup of the identity key: %s", err)
+			}
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&IdRotateOutput{
+			Old:    n.Identity.Pretty(),
+			New:    id.Pretty(),
+			OldKey: backup,
+		})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*IdRotateOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return strings.NewReader(fmt.Sprintf("rotated the identity from %s to %s, the old key is kept as %s\n", out.Old, out.New, out.OldKey)), nil
+		},
+	},
+	Type: IdRotateOutput{},
+}
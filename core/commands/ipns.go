@@ -4,9 +4,13 @@ import (
 	"errors"
 	"io"
 	"strings"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	namesys "github.com/ipfs/go-ipfs/namesys"
+	path "github.com/ipfs/go-ipfs/path"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -23,6 +27,19 @@ IPNS is a PKI namespace, where names are the hashes of public keys, and
 the private key enables publishing new (signed) values. In resolve, the
 default value of <name> is your own identity public key.
 
+Names whose records carry a ttl (see 'ipfs name publish --ttl') are cached
+for that long, in the repo, so they resolve at once until it runs out, even
+after the daemon restarts. With --nocache, the cache is passed over, and
+updated with what's found.
+
+With --recursive, names resolving to other names are resolved in turn,
+through --depth of them at most (32 by default, 0 for no limit), until an
+/ipfs/ path is found. --steps prints each value passed through on the
+way, one per line, ending with the last.
+
+With --stream, the name is resolved again every --interval (1m by
+default), passing over the cache, and its value printed anew whenever it
+changes, until interrupted.
 
 Examples:
 
@@ -36,6 +53,12 @@ Resolve the value of another name:
   > ipfs name resolve QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n
   QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
 
+Resolve a name through the names it points to:
+
+  > ipfs name resolve -r --steps ipfs.io
+  /ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n
+  /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+
 `,
 	},
 
@@ -44,6 +67,11 @@ Resolve the value of another name:
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("recursive", "r", "Resolve until the result is not an IPNS name"),
+		cmds.IntOption("depth", "d", "The most names to resolve through; 32 with --recursive by default, 0 for no limit"),
+		cmds.BoolOption("steps", "s", "Print each value resolved through, one per line"),
+		cmds.BoolOption("nocache", "n", "Do not use cached entries"),
+		cmds.BoolOption("stream", "Resolve again until interrupted, printing the value whenever it changes"),
+		cmds.StringOption("interval", "How often to resolve again with --stream, such as \"30s\"; 1m by default"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 
@@ -79,20 +107,129 @@ Resolve the value of another name:
 		if recursive {
 			depth = namesys.DefaultDepthLimit
 		}
+		if d, found, err := req.Option("depth").Int(); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		} else if found {
+			if d < 0 {
+				res.SetError(errors.New("depth must not be negative"), cmds.ErrClient)
+				return
+			}
+			depth = d
+		}
+		steps, _, _ := req.Option("steps").Bool()
+		stream, _, _ := req.Option("stream").Bool()
 
-		resolver := namesys.NewRoutingResolver(n.Routing)
-		output, err := resolver.ResolveN(n.Context(), name, depth)
+		interval := time.Minute
+		intervalS, found, err := req.Option("interval").String()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
+		if found {
+			interval, err = time.ParseDuration(intervalS)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+			if interval <= 0 {
+				res.SetError(errors.New("interval must be positive"), cmds.ErrClient)
+				return
+			}
+		}
+
+		ctx := n.Context()
+		if stream {
+			ctx = req.Context().Context
+		}
+		if nocache, _, _ := req.Option("nocache").Bool(); nocache {
+			ctx = namesys.WithoutCache(ctx)
+		}
+		if !strings.HasPrefix(name, "/ipns/") {
+			name = "/ipns/" + name
+		}
 
-		// TODO: better errors (in the case of not finding the name, we get "failed to find any peer in table")
+		if !steps && !stream {
+			output, err := n.Namesys.ResolveN(ctx, name, depth)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
 
-		res.SetOutput(&ResolvedPath{output})
+			// TODO: better errors (in the case of not finding the name, we get "failed to find any peer in table")
+
+			res.SetOutput(&ResolvedPath{output})
+			return
+		}
+
+		values, err := resolveSteps(ctx, n.Namesys, name, depth)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		outChan := make(chan interface{})
+		res.SetOutput((<-chan interface{})(outChan))
+
+		go func() {
+			defer close(outChan)
+
+			send := func(values []path.Path) bool {
+				if !steps {
+					values = values[len(values)-1:]
+				}
+				for _, p := range values {
+					select {
+					case outChan <- &ResolvedPath{p}:
+					case <-ctx.Done():
+						return false
+					}
+				}
+				return true
+			}
+			if !send(values) || !stream {
+				return
+			}
+
+			last := values[len(values)-1]
+			for {
+				select {
+				case <-time.After(interval):
+				case <-ctx.Done():
+					return
+				}
+
+				values, err := resolveSteps(namesys.WithoutCache(ctx), n.Namesys, name, depth)
+				if err != nil {
+					log.Debugf("resolving %s again: %s", name, err)
+					continue
+				}
+				if values[len(values)-1] == last {
+					continue
+				}
+				last = values[len(values)-1]
+				if !send(values) {
+					return
+				}
+			}
+		}()
 	},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			if outChan, ok := res.Output().(<-chan interface{}); ok {
+				marshal := func(v interface{}) (io.Reader, error) {
+					output, ok := v.(*ResolvedPath)
+					if !ok {
+						return nil, u.ErrCast()
+					}
+					return strings.NewReader(output.Path.String() + "\n"), nil
+				}
+				return &cmds.ChannelMarshaler{
+					Channel:   outChan,
+					Marshaler: marshal,
+				}, nil
+			}
+
 			output, ok := res.Output().(*ResolvedPath)
 			if !ok {
 				return nil, u.ErrCast()
@@ -102,3 +239,22 @@ Resolve the value of another name:
 	},
 	Type: ResolvedPath{},
 }
+
+// resolveSteps resolves name one name at a time, through depth of them at
+// most, or any number if depth is namesys.UnlimitedDepth, and returns each
+// value resolved through, the last of which is not an IPNS name.
+func resolveSteps(ctx context.Context, r namesys.Resolver, name string, depth int) ([]path.Path, error) {
+	var values []path.Path
+	for depth == namesys.UnlimitedDepth || len(values) < depth {
+		p, err := r.ResolveN(ctx, name, 1)
+		if err != nil && err != namesys.ErrResolveRecursion {
+			return nil, err
+		}
+		values = append(values, p)
+		if !strings.HasPrefix(p.String(), "/ipns/") {
+			return values, nil
+		}
+		name = p.String()
+	}
+	return nil, namesys.ErrResolveRecursion
+}
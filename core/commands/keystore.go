@@ -0,0 +1,499 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	crypto "github.com/ipfs/go-ipfs/p2p/crypto"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	u "github.com/ipfs/go-ipfs/util"
+	seal "github.com/ipfs/go-ipfs/util/seal"
+)
+
+// keyExportMagic starts the keys 'ipfs key export' writes.
+const keyExportMagic = "ipfs-key\n"
+
+type KeyOutput struct {
+	Name string
+	Id   string
+}
+
+type KeyOutputList struct {
+	Keys []KeyOutput
+}
+
+type KeyRenameOutput struct {
+	Was string
+	Now string
+	Id  string
+}
+
+var KeyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the keypairs of the keystore",
+		ShortDescription: `
+'ipfs key' manages the keypairs a node holds besides its identity, which
+is the key named self. Each can be published to with
+'ipfs name publish --key=<name>'.
+
+  > ipfs key gen --type=ed25519 mykey
+  > ipfs name publish --key=mykey /ipfs/<hash>
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"gen":    keyGenCmd,
+		"list":   keyListCmd,
+		"rename": keyRenameCmd,
+		"rm":     keyRmCmd,
+		"export": keyExportCmd,
+		"import": keyImportCmd,
+	},
+}
+
+var keyGenCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Generate a new keypair",
+		ShortDescription: `
+'ipfs key gen' generates a keypair of the --type given, rsa (the default)
+or ed25519, stores it in the keystore under <name>, and prints its name
+and the hash of its public key: the name it publishes to. RSA keys are
+--size bits long, 2048 by default.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The name of the key to create"),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("type", "t", "The type of key to create: rsa (default) or ed25519"),
+		cmds.IntOption("size", "s", "The size of the key, in bits, for rsa keys (default: 2048)"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		name := req.Arguments()[0]
+		ks, err := writableKeystore(n, name)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		typ, _, err := req.Option("type").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		size, sizeFound, err := req.Option("size").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		kt, size, err := keyTypeAndSize(typ, size, sizeFound)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		sk, _, err := crypto.GenerateKeyPair(kt, size)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		out, err := putKey(ks, name, sk)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: keyOutputMarshaler,
+	},
+	Type: KeyOutput{},
+}
+
+var keyListCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the keys of the keystore",
+		ShortDescription: `
+'ipfs key list' lists the names of the keys of the keystore, self first.
+With -l, the hashes of their public keys are listed too.
+`,
+	},
+
+	Options: []cmds.Option{
+		cmds.BoolOption("l", "Also list the hashes of the public keys"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		names := []string{coreapi.SelfKeyName}
+		if ks := n.Repo.Keystore(); ks != nil {
+			stored, err := ks.List()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			names = append(names, stored...)
+		}
+
+		list := &KeyOutputList{}
+		for _, name := range names {
+			sk, err := coreapi.LookupKey(n, name)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			id, err := peer.IDFromPrivateKey(sk)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			list.Keys = append(list.Keys, KeyOutput{Name: name, Id: id.Pretty()})
+		}
+		res.SetOutput(list)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*KeyOutputList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			long, _, _ := res.Request().Option("l").Bool()
+
+			buf := new(bytes.Buffer)
+			for _, k := range list.Keys {
+				if long {
+					fmt.Fprintf(buf, "%s %s\n", k.Id, k.Name)
+				} else {
+					fmt.Fprintln(buf, k.Name)
+				}
+			}
+			return buf, nil
+		},
+	},
+	Type: KeyOutputList{},
+}
+
+var keyRenameCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Rename a key",
+		ShortDescription: `
+'ipfs key rename' renames the key <old> to <new>, which mustn't be taken.
+The key, and the name it publishes to, stay the same. The self key can't
+be renamed.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("old", true, false, "The current name of the key"),
+		cmds.StringArg("new", true, false, "The new name of the key"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		oldName, newName := req.Arguments()[0], req.Arguments()[1]
+		if oldName == coreapi.SelfKeyName {
+			res.SetError(errors.New("the self key can't be renamed"), cmds.ErrClient)
+			return
+		}
+		ks, err := writableKeystore(n, newName)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		sk, err := coreapi.LookupKey(n, oldName)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		out, err := putKey(ks, newName, sk)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if err := ks.Delete(oldName); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&KeyRenameOutput{Was: oldName, Now: newName, Id: out.Id})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*KeyRenameOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return strings.NewReader(fmt.Sprintf("%s: renamed %s to %s\n", out.Id, out.Was, out.Now)), nil
+		},
+	},
+	Type: KeyRenameOutput{},
+}
+
+var keyRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove keys from the keystore",
+		ShortDescription: `
+'ipfs key rm' removes the keys named from the keystore, and prints their
+names and public key hashes. Names published to with them can't be
+updated anymore, unless the keys were exported first. The self key can't
+be removed.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, true, "The names of the keys to remove"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		// check all of them before removing any
+		list := &KeyOutputList{}
+		for _, name := range req.Arguments() {
+			if name == coreapi.SelfKeyName {
+				res.SetError(errors.New("the self key can't be removed"), cmds.ErrClient)
+				return
+			}
+			sk, err := coreapi.LookupKey(n, name)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			id, err := peer.IDFromPrivateKey(sk)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			list.Keys = append(list.Keys, KeyOutput{Name: name, Id: id.Pretty()})
+		}
+
+		ks := n.Repo.Keystore()
+		for _, k := range list.Keys {
+			if err := ks.Delete(k.Name); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+		res.SetOutput(list)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*KeyOutputList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			for _, k := range list.Keys {
+				fmt.Fprintf(buf, "removed %s %s\n", k.Id, k.Name)
+			}
+			return buf, nil
+		},
+	},
+	Type: KeyOutputList{},
+}
+
+var keyExportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Export a key, encrypted",
+		ShortDescription: `
+'ipfs key export' writes the private key <name> to stdout, encrypted with
+the passphrase in the file given, or on stdin, for 'ipfs key import' to
+read on another node. The self key can be exported too.
+
+  > ipfs key export mykey passfile > mykey.key
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The name of the key to export"),
+		passphraseArg("The file holding the passphrase to encrypt the key with"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		pass, err := readPassphrase(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		sk, err := coreapi.LookupKey(n, req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		b, err := crypto.MarshalPrivateKey(sk)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		sealed, err := seal.Seal(b, pass, keyExportMagic)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(bytes.NewReader(sealed))
+	},
+}
+
+var keyImportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Import a key exported with 'ipfs key export'",
+		ShortDescription: `
+'ipfs key import' decrypts the key in <file> with the passphrase it was
+exported with, in the file given or on stdin, and stores it in the
+keystore under <name>.
+
+  > ipfs key import mykey mykey.key passfile
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The name to store the key under"),
+		cmds.FileArg("file", true, false, "The exported key"),
+		passphraseArg("The file holding the passphrase the key was encrypted with"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		name := req.Arguments()[0]
+		ks, err := writableKeystore(n, name)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		file, err := req.Files().NextFile()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer file.Close()
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		pass, err := readPassphrase(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		b, err := seal.Open(data, pass, keyExportMagic)
+		switch err {
+		case nil:
+		case seal.ErrNotSealed:
+			res.SetError(errors.New("not a key exported with 'ipfs key export'"), cmds.ErrClient)
+			return
+		case seal.ErrBadPassphrase:
+			res.SetError(errors.New("wrong passphrase, or the key is corrupted"), cmds.ErrClient)
+			return
+		default:
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		sk, err := crypto.UnmarshalPrivateKey(b)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		out, err := putKey(ks, name, sk)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: keyOutputMarshaler,
+	},
+	Type: KeyOutput{},
+}
+
+// keyTypeAndSize returns the type and size of the keys to generate of the
+// --type and --size given: rsa keys of 2048 bits by default.
+func keyTypeAndSize(typ string, size int, sizeFound bool) (int, int, error) {
+	switch strings.ToLower(typ) {
+	case "", "rsa":
+		if !sizeFound {
+			size = 2048
+		}
+		if size < 1024 {
+			return 0, 0, fmt.Errorf("rsa keys must be at least 1024 bits, not %d", size)
+		}
+		return crypto.RSA, size, nil
+	case "ed25519":
+		if sizeFound {
+			return 0, 0, errors.New("ed25519 keys have a fixed size, --size can't be given")
+		}
+		return crypto.Ed25519, size, nil
+	default:
+		return 0, 0, fmt.Errorf("unknown key type %q: use rsa or ed25519", typ)
+	}
+}
+
+// writableKeystore returns the keystore of n, for a key to be stored in
+// under name.
+func writableKeystore(n *core.IpfsNode, name string) (keystore.Keystore, error) {
+	if name == coreapi.SelfKeyName {
+		return nil, fmt.Errorf("the name %q is reserved for the identity key", coreapi.SelfKeyName)
+	}
+	ks := n.Repo.Keystore()
+	if ks == nil {
+		return nil, errors.New("this node has no keystore")
+	}
+	return ks, nil
+}
+
+// putKey stores sk in ks under name, and returns its name and ID.
+func putKey(ks keystore.Keystore, name string, sk crypto.PrivKey) (*KeyOutput, error) {
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.Put(name, sk); err != nil {
+		return nil, err
+	}
+	return &KeyOutput{Name: name, Id: id.Pretty()}, nil
+}
+
+func keyOutputMarshaler(res cmds.Response) (io.Reader, error) {
+	k, ok := res.Output().(*KeyOutput)
+	if !ok {
+		return nil, u.ErrCast()
+	}
+	return strings.NewReader(fmt.Sprintf("%s %s\n", k.Id, k.Name)), nil
+}
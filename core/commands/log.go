@@ -1,14 +1,14 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
+	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
 	u "github.com/ipfs/go-ipfs/util"
-
-	tail "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/ActiveState/tail"
 )
 
 // Golang os.Args overrides * and replaces the character argument with
@@ -28,6 +28,7 @@ output of a running daemon.
 
 	Subcommands: map[string]*cmds.Command{
 		"level": logLevelCmd,
+		"ls":    logLsCmd,
 		"tail":  logTailCmd,
 	},
 }
@@ -37,7 +38,15 @@ var logLevelCmd = &cmds.Command{
 		Tagline: "Change the logging level",
 		ShortDescription: `
 'ipfs log level' is a utility command used to change the logging
-output of a running daemon.
+output of a running daemon. Each subsystem, as listed by 'ipfs log ls',
+has a level of its own:
+
+  > ipfs log level dht debug
+
+The daemon starts with all of them at the level of the IPFS_LOGGING
+environment variable, error by default, and writes the logs to stderr in
+the format of IPFS_LOGGING_FMT: color, nocolor, or json, for a JSON object
+on each line.
 `,
 	},
 
@@ -71,50 +80,55 @@ output of a running daemon.
 	Type: MessageOutput{},
 }
 
+var logLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the logging subsystems",
+		ShortDescription: `
+'ipfs log ls' lists the subsystems of a running daemon whose logging
+level 'ipfs log level' can change.
+`,
+	},
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		res.SetOutput(&stringList{u.Loggers()})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: stringListMarshaler,
+	},
+	Type: stringList{},
+}
+
 var logTailCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Read the logs",
 		ShortDescription: `
-'ipfs log tail' is a utility command used to read log output as it is written.
+'ipfs log tail' streams the logs of a running daemon as they're written,
+each entry a JSON object on a line of its own: those of the subsystems, at
+the levels set with 'ipfs log level', and the events of the event log.
 `,
 	},
 
 	Run: func(req cmds.Request, res cmds.Response) {
-		path := fmt.Sprintf("%s/logs/events.log", req.Context().ConfigRoot)
+		ctx := req.Context().Context
+		lines := make(chan string, logTailBuffer)
+		w := &tailWriter{lines: lines, done: ctx.Done()}
+		u.AddLogWriter(w)
+		eventlog.WriterGroup.AddWriter(w)
 
 		outChan := make(chan interface{})
-
 		go func() {
 			defer close(outChan)
-
-			t, err := tail.TailFile(path, tail.Config{
-				Location:  &tail.SeekInfo{0, 2},
-				Follow:    true,
-				MustExist: true,
-				Logger:    tail.DiscardingLogger,
-			})
-			if err != nil {
-				fmt.Println(err.Error())
-				return
-			}
-			defer t.Stop()
-
-			done := req.Context().Context.Done()
-
-			for line := range t.Lines {
-				// return when context closes
+			for {
 				select {
-				case <-done:
-					return
-				default:
-				}
-
-				if line.Err != nil {
-					fmt.Println(err.Error())
+				case line := <-lines:
+					select {
+					case outChan <- &MessageOutput{strings.TrimSuffix(line, "\n")}:
+					case <-ctx.Done():
+						return
+					}
+				case <-ctx.Done():
 					return
 				}
-				// TODO: unpack the line text into a struct and output that
-				outChan <- &MessageOutput{line.Text}
 			}
 		}()
 
@@ -138,3 +152,30 @@ var logTailCmd = &cmds.Command{
 	},
 	Type: MessageOutput{},
 }
+
+// logTailBuffer is how many log entries 'ipfs log tail' holds for a slow
+// reader before it drops them.
+const logTailBuffer = 256
+
+var errLogTailClosed = errors.New("log tail closed")
+
+// tailWriter sends the log entries written to it on lines without waiting,
+// so that a slow reader doesn't hold up logging, and fails once done is
+// closed, which has the loggers drop it.
+type tailWriter struct {
+	lines chan<- string
+	done  <-chan struct{}
+}
+
+func (w *tailWriter) Write(b []byte) (int, error) {
+	select {
+	case <-w.done:
+		return 0, errLogTailClosed
+	default:
+	}
+	select {
+	case w.lines <- string(b):
+	default:
+	}
+	return len(b), nil
+}
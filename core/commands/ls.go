@@ -9,14 +9,21 @@ import (
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	cmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
 	merkledag "github.com/ipfs/go-ipfs/merkledag"
 	path "github.com/ipfs/go-ipfs/path"
 	unixfs "github.com/ipfs/go-ipfs/unixfs"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
 	unixfspb "github.com/ipfs/go-ipfs/unixfs/pb"
+	u "github.com/ipfs/go-ipfs/util"
 )
 
+// LsTypeUnknown is the type of the links whose objects weren't looked at,
+// with --resolve-type=false.
+const LsTypeUnknown unixfspb.Data_DataType = -1
+
 type LsLink struct {
 	Name, Hash string
 	Size       uint64
@@ -40,6 +47,22 @@ Retrieves the object named by <ipfs-or-ipns-path> and displays the links
 it contains, with the following format:
 
   <link base58 hash> <link size in bytes> <link name>
+
+--format takes a Go template, run once per link, with the fields
+{{.Hash}}, {{.Size}}, {{.Name}} and {{.Type}}. Each field may also be
+written as its lower case name in angle brackets:
+
+  ipfs ls --format="<name> <size>" <ipfs-path>
+
+Headers and per-object grouping are omitted when a format is given.
+
+The size is the cumulative size of the object a link points to, with all it
+links to in turn. Directories are listed with a trailing slash; the objects
+links point to are fetched to tell them from files. With
+--resolve-type=false, only the objects stored locally are looked at, so
+that listing a directory whose entries aren't local doesn't wait for them:
+the links are listed as they're read, and the type of entries that aren't
+local is unknown, -1, listed without a slash.
 `,
 	},
 
@@ -48,6 +71,8 @@ it contains, with the following format:
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("headers", "", "Print table headers (Hash, Name, Size)"),
+		cmds.StringOption("format", "Emit links with given format. fields: <hash> <size> <name> <type>"),
+		cmds.BoolOption("resolve-type", "Fetch the objects links point to, to tell their type (default: true)"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		node, err := req.Context().GetNode()
@@ -61,6 +86,25 @@ it contains, with the following format:
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
+		resolve, found, err := req.Option("resolve-type").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if !found {
+			resolve = true
+		}
+		format, _, err := req.Option("format").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if format != "" {
+			if _, err := parseFormat(format, LsLink{}); err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+		}
 
 		paths := req.Arguments()
 
@@ -74,31 +118,63 @@ it contains, with the following format:
 			dagnodes = append(dagnodes, dagnode)
 		}
 
+		ctx := req.Context().Context
+		if !resolve {
+			// list the links as they're read, not to wait for them all
+			outChan := make(chan interface{})
+			res.SetOutput((<-chan interface{})(outChan))
+			go func() {
+				defer close(outChan)
+				send := func(obj LsObject) bool {
+					select {
+					case outChan <- &LsOutput{[]LsObject{obj}}:
+						return true
+					case <-ctx.Done():
+						return false
+					}
+				}
+				for i, dagnode := range dagnodes {
+					links, err := uio.DirLinks(ctx, dagnode, node.DAG)
+					if err != nil {
+						res.SetError(err, cmds.ErrNormal)
+						return
+					}
+					// an object without links starts each listing
+					if !send(LsObject{Hash: paths[i]}) {
+						return
+					}
+					for _, link := range links {
+						lsl, err := lsLink(ctx, node, link, false)
+						if err != nil {
+							res.SetError(err, cmds.ErrNormal)
+							return
+						}
+						if !send(LsObject{Hash: paths[i], Links: []LsLink{lsl}}) {
+							return
+						}
+					}
+				}
+			}()
+			return
+		}
+
 		output := make([]LsObject, len(req.Arguments()))
 		for i, dagnode := range dagnodes {
+			links, err := uio.DirLinks(ctx, dagnode, node.DAG)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
 			output[i] = LsObject{
 				Hash:  paths[i],
-				Links: make([]LsLink, len(dagnode.Links)),
+				Links: make([]LsLink, len(links)),
 			}
-			for j, link := range dagnode.Links {
-				ctx, cancel := context.WithTimeout(context.TODO(), time.Minute)
-				defer cancel()
-				link.Node, err = link.GetNode(ctx, node.DAG)
+			for j, link := range links {
+				output[i].Links[j], err = lsLink(ctx, node, link, true)
 				if err != nil {
 					res.SetError(err, cmds.ErrNormal)
 					return
 				}
-				d, err := unixfs.FromBytes(link.Node.Data)
-				if err != nil {
-					res.SetError(err, cmds.ErrNormal)
-					return
-				}
-				output[i].Links[j] = LsLink{
-					Name: link.Name,
-					Hash: link.Hash.B58String(),
-					Size: link.Size,
-					Type: d.GetType(),
-				}
 			}
 		}
 
@@ -108,8 +184,32 @@ it contains, with the following format:
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
 
 			headers, _, _ := res.Request().Option("headers").Bool()
+			if outChan, ok := res.Output().(<-chan interface{}); ok {
+				return &cmds.ChannelMarshaler{
+					Channel:   outChan,
+					Marshaler: lsStreamMarshaler(res.Request(), headers),
+				}, nil
+			}
 			output := res.Output().(*LsOutput)
 			buf := new(bytes.Buffer)
+
+			if format, _, _ := res.Request().Option("format").String(); format != "" {
+				tmpl, err := parseFormat(format, LsLink{})
+				if err != nil {
+					return nil, err
+				}
+				for _, object := range output.Objects {
+					for _, link := range object.Links {
+						s, err := execFormat(tmpl, link)
+						if err != nil {
+							return nil, err
+						}
+						fmt.Fprintln(buf, s)
+					}
+				}
+				return buf, nil
+			}
+
 			w := tabwriter.NewWriter(buf, 1, 2, 1, ' ', 0)
 			for _, object := range output.Objects {
 				if len(output.Objects) > 1 {
@@ -119,7 +219,7 @@ it contains, with the following format:
 					fmt.Fprintln(w, "Hash\tSize\tName")
 				}
 				for _, link := range object.Links {
-					if link.Type == unixfspb.Data_Directory {
+					if link.Type == unixfspb.Data_Directory || link.Type == unixfspb.Data_HAMTShard {
 						link.Name += "/"
 					}
 					fmt.Fprintf(w, "%s\t%v\t%s\n", link.Hash, link.Size, link.Name)
@@ -135,3 +235,86 @@ it contains, with the following format:
 	},
 	Type: LsOutput{},
 }
+
+// lsLink returns the listing of link. Unless resolve is true, the type is
+// only told if the object it points to is local.
+func lsLink(ctx context.Context, n *core.IpfsNode, link *merkledag.Link, resolve bool) (LsLink, error) {
+	lsl := LsLink{
+		Name: link.Name,
+		Hash: link.Hash.B58String(),
+		Size: link.Size,
+	}
+	if !resolve {
+		// only look at what's local, not to wait on the network
+		has, err := n.Blockstore.Has(key.Key(link.Hash))
+		if err != nil || !has {
+			lsl.Type = LsTypeUnknown
+			return lsl, nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	nd, err := link.GetNode(ctx, n.DAG)
+	if err != nil {
+		return LsLink{}, err
+	}
+	d, err := unixfs.FromBytes(nd.Data)
+	if err != nil {
+		return LsLink{}, err
+	}
+	lsl.Type = d.GetType()
+	return lsl, nil
+}
+
+// lsStreamMarshaler returns the marshaler of the listings streamed, each
+// an object without links starting the listing of a path, or one link.
+// Lines aren't aligned as they are once all are read.
+func lsStreamMarshaler(req cmds.Request, headers bool) func(interface{}) (io.Reader, error) {
+	format, _, _ := req.Option("format").String()
+	multiple := len(req.Arguments()) > 1
+	started := false
+	return func(v interface{}) (io.Reader, error) {
+		output, ok := v.(*LsOutput)
+		if !ok || len(output.Objects) != 1 {
+			return nil, u.ErrCast()
+		}
+		object := output.Objects[0]
+		buf := new(bytes.Buffer)
+
+		if format != "" {
+			tmpl, err := parseFormat(format, LsLink{})
+			if err != nil {
+				return nil, err
+			}
+			for _, link := range object.Links {
+				s, err := execFormat(tmpl, link)
+				if err != nil {
+					return nil, err
+				}
+				fmt.Fprintln(buf, s)
+			}
+			return buf, nil
+		}
+
+		if len(object.Links) == 0 {
+			if multiple {
+				if started {
+					fmt.Fprintln(buf)
+				}
+				fmt.Fprintf(buf, "%s:\n", object.Hash)
+			}
+			started = true
+			if headers {
+				fmt.Fprintln(buf, "Hash Size Name")
+			}
+			return buf, nil
+		}
+		for _, link := range object.Links {
+			if link.Type == unixfspb.Data_Directory || link.Type == unixfspb.Data_HAMTShard {
+				link.Name += "/"
+			}
+			fmt.Fprintf(buf, "%s %v %s\n", link.Hash, link.Size, link.Name)
+		}
+		return buf, nil
+	}
+}
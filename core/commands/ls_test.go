@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	unixfspb "github.com/ipfs/go-ipfs/unixfs/pb"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// TestLsNoResolve lists a directory with an entry that isn't local, as
+// ls --resolve-type=false does: as the links are read, with the type of
+// that entry unknown.
+func TestLsNoResolve(t *testing.T) {
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	file := &dag.Node{Data: ft.FilePBData([]byte("file"), 4)}
+	sub := &dag.Node{Data: ft.FolderPBData()}
+	dir := &dag.Node{Data: ft.FolderPBData()}
+	for name, nd := range map[string]*dag.Node{"file": file, "sub": sub} {
+		if _, err := n.DAG.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := dir.AddNodeLink(name, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir.Links = append(dir.Links, &dag.Link{Name: "gone", Hash: u.Hash([]byte("gone")), Size: 5})
+	k, err := n.DAG.Add(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	optDefs := make(map[string]cmds.Option)
+	for _, opt := range LsCmd.Options {
+		for _, name := range opt.Names() {
+			optDefs[name] = opt
+		}
+	}
+	req, err := cmds.NewRequest(nil, cmds.OptMap{"resolve-type": false}, []string{"/ipfs/" + k.B58String()}, nil, LsCmd, optDefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetContext(cmds.Context{
+		Context:       context.Background(),
+		ConstructNode: func() (*core.IpfsNode, error) { return n, nil },
+	})
+	res := LsCmd.Call(req)
+	if res.Error() != nil {
+		t.Fatal(res.Error())
+	}
+	outChan, ok := res.Output().(<-chan interface{})
+	if !ok {
+		t.Fatalf("expected the links streamed, got %T", res.Output())
+	}
+
+	var objects []LsObject
+	for v := range outChan {
+		objects = append(objects, v.(*LsOutput).Objects...)
+	}
+	if len(objects) != 4 || len(objects[0].Links) != 0 {
+		t.Fatalf("expected the object, then each of its links, got %v", objects)
+	}
+	expected := map[string]unixfspb.Data_DataType{
+		"file": unixfspb.Data_File,
+		"sub":  unixfspb.Data_Directory,
+		"gone": LsTypeUnknown,
+	}
+	for _, obj := range objects[1:] {
+		if len(obj.Links) != 1 {
+			t.Fatalf("expected one link at a time, got %v", obj.Links)
+		}
+		l := obj.Links[0]
+		if typ, ok := expected[l.Name]; !ok || l.Type != typ {
+			t.Errorf("%s: expected type %v, got %v", l.Name, typ, l.Type)
+		}
+	}
+}
@@ -1,4 +1,3 @@
-// +build linux darwin freebsd
 // +build !nofuse
 
 package commands
@@ -7,35 +6,34 @@ import (
 	"fmt"
 	"io"
 	"strings"
-	"time"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
-	ipns "github.com/ipfs/go-ipfs/fuse/ipns"
 	mount "github.com/ipfs/go-ipfs/fuse/mount"
-	rofs "github.com/ipfs/go-ipfs/fuse/readonly"
 	config "github.com/ipfs/go-ipfs/repo/config"
 )
 
-// amount of time to wait for mount errors
-// TODO is this non-deterministic?
-const mountTimeout = time.Second
+// mountBackend mounts the ipfs and ipns filesystems on the OS. The
+// backend is selected at build time: fuse on unix, none yet on windows.
+type mountBackend interface {
+	// Check returns an error if the backend can't mount on this machine,
+	// for example because its driver is missing.
+	Check(node *core.IpfsNode) error
 
-// fuseNoDirectory used to check the returning fuse error
-const fuseNoDirectory = "fusermount: failed to access mountpoint"
+	// MountIpfs mounts the read-only /ipfs filesystem at fsdir.
+	MountIpfs(node *core.IpfsNode, fsdir string) (mount.Mount, error)
 
-// fuseExitStatus1 used to check the returning fuse error
-const fuseExitStatus1 = "fusermount: exit status 1"
+	// MountIpns mounts the /ipns filesystem at nsdir, linking into the
+	// /ipfs mount at fsdir.
+	MountIpns(node *core.IpfsNode, nsdir, fsdir string) (mount.Mount, error)
 
-// platformFuseChecks can get overridden by arch-specific files
-// to run fuse checks (like checking the OSXFUSE version)
-var platformFuseChecks = func(*core.IpfsNode) error {
-	return nil
+	// FormatErr turns a mount error into a user-facing one.
+	FormatErr(err error, mountpoint string) error
 }
 
 var MountCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
-		Tagline: "Mounts IPFS to the filesystem (read-only)",
+		Tagline: "Mounts IPFS to the filesystem",
 		Synopsis: `
 ipfs mount [-f <ipfs mount path>] [-n <ipns mount path>]
 `,
@@ -43,6 +41,8 @@ ipfs mount [-f <ipfs mount path>] [-n <ipns mount path>]
 Mount ipfs at a read-only mountpoint on the OS (default: /ipfs and /ipns).
 All ipfs objects will be accessible under that directory. Note that the
 root will not be listable, as it is virtual. Access known paths directly.
+Files under /ipns/local can be written: the changes are republished under
+your peer ID on fsync and close.
 
 You may have to create /ipfs and /ipns before using 'ipfs mount':
 
@@ -55,6 +55,8 @@ You may have to create /ipfs and /ipns before using 'ipfs mount':
 Mount ipfs at a read-only mountpoint on the OS (default: /ipfs and /ipns).
 All ipfs objects will be accessible under that directory. Note that the
 root will not be listable, as it is virtual. Access known paths directly.
+Files under /ipns/local can be written: the changes are republished under
+your peer ID on fsync and close.
 
 You may have to create /ipfs and /ipns before using 'ipfs mount':
 
@@ -171,33 +173,19 @@ func Mount(node *core.IpfsNode, fsdir, nsdir string) error {
 		node.Mounts.Ipns.Unmount()
 	}
 
-	if err := platformFuseChecks(node); err != nil {
+	if err := platformMount.Check(node); err != nil {
 		return err
 	}
 
 	var err error
-	if err = doMount(node, fsdir, nsdir); err != nil {
+	if err = doMount(platformMount, node, fsdir, nsdir); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func doMount(node *core.IpfsNode, fsdir, nsdir string) error {
-	fmtFuseErr := func(err error, mountpoint string) error {
-		s := err.Error()
-		if strings.Contains(s, fuseNoDirectory) {
-			s = strings.Replace(s, `fusermount: "fusermount:`, "", -1)
-			s = strings.Replace(s, `\n", exit status 1`, "", -1)
-			return cmds.ClientError(s)
-		}
-		if s == fuseExitStatus1 {
-			s = fmt.Sprintf("fuse failed to access mountpoint %s", mountpoint)
-			return cmds.ClientError(s)
-		}
-		return err
-	}
-
+func doMount(b mountBackend, node *core.IpfsNode, fsdir, nsdir string) error {
 	// this sync stuff is so that both can be mounted simultaneously.
 	var fsmount mount.Mount
 	var nsmount mount.Mount
@@ -207,12 +195,12 @@ func doMount(node *core.IpfsNode, fsdir, nsdir string) error {
 	done := make(chan struct{})
 
 	go func() {
-		fsmount, err1 = rofs.Mount(node, fsdir)
+		fsmount, err1 = b.MountIpfs(node, fsdir)
 		done <- struct{}{}
 	}()
 
 	go func() {
-		nsmount, err2 = ipns.Mount(node, nsdir, fsdir)
+		nsmount, err2 = b.MountIpns(node, nsdir, fsdir)
 		done <- struct{}{}
 	}()
 
@@ -229,9 +217,9 @@ func doMount(node *core.IpfsNode, fsdir, nsdir string) error {
 		}
 
 		if err1 != nil {
-			return fmtFuseErr(err1, fsdir)
+			return b.FormatErr(err1, fsdir)
 		}
-		return fmtFuseErr(err2, nsdir)
+		return b.FormatErr(err2, nsdir)
 	}
 
 	// setup node state, so that it can be cancelled
@@ -0,0 +1,63 @@
+// +build linux darwin freebsd
+// +build !nofuse
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	ipns "github.com/ipfs/go-ipfs/fuse/ipns"
+	mount "github.com/ipfs/go-ipfs/fuse/mount"
+	rofs "github.com/ipfs/go-ipfs/fuse/readonly"
+)
+
+// amount of time to wait for mount errors
+// TODO is this non-deterministic?
+const mountTimeout = time.Second
+
+// fuseNoDirectory used to check the returning fuse error
+const fuseNoDirectory = "fusermount: failed to access mountpoint"
+
+// fuseExitStatus1 used to check the returning fuse error
+const fuseExitStatus1 = "fusermount: exit status 1"
+
+// platformFuseChecks can get overridden by arch-specific files
+// to run fuse checks (like checking the OSXFUSE version)
+var platformFuseChecks = func(*core.IpfsNode) error {
+	return nil
+}
+
+var platformMount mountBackend = fuseBackend{}
+
+// fuseBackend mounts the fuse filesystems of fuse/readonly and fuse/ipns.
+type fuseBackend struct{}
+
+func (fuseBackend) Check(node *core.IpfsNode) error {
+	return platformFuseChecks(node)
+}
+
+func (fuseBackend) MountIpfs(node *core.IpfsNode, fsdir string) (mount.Mount, error) {
+	return rofs.Mount(node, fsdir)
+}
+
+func (fuseBackend) MountIpns(node *core.IpfsNode, nsdir, fsdir string) (mount.Mount, error) {
+	return ipns.Mount(node, nsdir, fsdir)
+}
+
+func (fuseBackend) FormatErr(err error, mountpoint string) error {
+	s := err.Error()
+	if strings.Contains(s, fuseNoDirectory) {
+		s = strings.Replace(s, `fusermount: "fusermount:`, "", -1)
+		s = strings.Replace(s, `\n", exit status 1`, "", -1)
+		return cmds.ClientError(s)
+	}
+	if s == fuseExitStatus1 {
+		s = fmt.Sprintf("fuse failed to access mountpoint %s", mountpoint)
+		return cmds.ClientError(s)
+	}
+	return err
+}
@@ -1,4 +1,3 @@
-// +build linux darwin freebsd
 // +build nofuse
 
 package commands
@@ -1,25 +1,38 @@
+// +build !nofuse
+
 package commands
 
 import (
 	"errors"
 
-	cmds "github.com/ipfs/go-ipfs/commands"
-	"github.com/ipfs/go-ipfs/core"
+	core "github.com/ipfs/go-ipfs/core"
+	mount "github.com/ipfs/go-ipfs/fuse/mount"
 )
 
-var MountCmd = &cmds.Command{
-	Helptext: cmds.HelpText{
-		Tagline:          "Not yet implemented on Windows",
-		ShortDescription: "Not yet implemented on Windows. :(",
-	},
+// errMountUnsupported is returned by 'ipfs mount' and 'ipfs daemon --mount'
+// on windows, which no backend serves the filesystems on yet.
+var errMountUnsupported = errors.New("mount is not supported in this build: no backend serves the filesystems on Windows")
+
+var platformMount mountBackend = unsupportedBackend{}
+
+// unsupportedBackend fails every mount, so that mounting fails clearly
+// rather than silently doing nothing. It stands in until a WinFsp backend,
+// which needs a WinFsp binding vendored under Godeps, implements
+// mountBackend; that backend is left to a follow-up.
+type unsupportedBackend struct{}
+
+func (unsupportedBackend) Check(node *core.IpfsNode) error {
+	return errMountUnsupported
+}
+
+func (unsupportedBackend) MountIpfs(node *core.IpfsNode, fsdir string) (mount.Mount, error) {
+	return nil, errMountUnsupported
+}
 
-	Run: func(req cmds.Request, res cmds.Response) {
-		res.SetError(errors.New("Mount isn't compatible with Windows yet"), cmds.ErrNormal)
-	},
+func (unsupportedBackend) MountIpns(node *core.IpfsNode, nsdir, fsdir string) (mount.Mount, error) {
+	return nil, errMountUnsupported
 }
 
-func Mount(node *core.IpfsNode, fsdir, nsdir string) error {
-	// TODO
-	// currently a no-op, but we don't want to return an error
-	return nil
+func (unsupportedBackend) FormatErr(err error, mountpoint string) error {
+	return err
 }
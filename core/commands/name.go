@@ -13,6 +13,7 @@ var NameCmd = &cmds.Command{
 		Synopsis: `
 ipfs name publish [<name>] <ipfs-path> - Publish an object to IPNS
 ipfs name resolve [<name>]             - Gets the value currently published at an IPNS name
+ipfs name inspect <name> [<record>]    - Validate and print the contents of an IPNS record
 `,
 		ShortDescription: `
 IPNS is a PKI namespace, where names are the hashes of public keys, and
@@ -53,5 +54,6 @@ Resolve the value of another name:
 	Subcommands: map[string]*cmds.Command{
 		"publish": PublishCmd,
 		"resolve": IpnsCmd,
+		"inspect": IpnsInspectCmd,
 	},
 }
@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	cmds "github.com/ipfs/go-ipfs/commands"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	routing "github.com/ipfs/go-ipfs/routing"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+type IpnsInspectResult struct {
+	Name         string
+	Value        string
+	ValidityType string
+	Validity     time.Time
+	Expired      bool
+	Sequence     uint64
+	TTL          time.Duration
+	Verified     bool
+	// Error is why the record failed to parse, and SignatureError why its
+	// signature failed to verify. A record failing to parse isn't verified.
+	Error          string `json:",omitempty"`
+	SignatureError string `json:",omitempty"`
+}
+
+var IpnsInspectCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Validate and print the contents of an IPNS record",
+		ShortDescription: `
+Decodes a marshaled IPNS record, verifies its signature against the public
+key of <name>, and prints its value, validity window, sequence number and
+TTL. Useful for debugging names that resolve to stale values.
+`,
+		LongDescription: `
+Decodes a marshaled IPNS record, verifies its signature against the public
+key of <name>, and prints its value, validity window, sequence number and
+TTL. Useful for debugging names that resolve to stale values.
+
+The record is read from <record>, or from stdin. If neither is given, the
+record currently stored in the routing system for <name> is fetched.
+
+Examples:
+
+Inspect the record currently published for a name:
+
+  > ipfs name inspect QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n
+  Value: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+  Signature: valid
+  Validity: EOL 2015-08-25T21:32:13.462Z
+  Sequence: 0
+  TTL: 0s
+
+Inspect a record saved to a file:
+
+  > ipfs name inspect QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n record.bin
+
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The IPNS name the record was published under"),
+		cmds.FileArg("record", false, false, "The marshaled IPNS record").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !n.OnlineMode() {
+			err := n.SetupOfflineRouting()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		name := req.Arguments()[0]
+		hash, err := mh.FromB58String(name)
+		if err != nil {
+			res.SetError(fmt.Errorf("invalid IPNS name %q: %s", name, err), cmds.ErrNormal)
+			return
+		}
+
+		var data []byte
+		var file io.Reader
+		if req.Files() != nil {
+			f, err := req.Files().NextFile()
+			if err != nil && err != io.EOF {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			if f != nil {
+				file = f
+			}
+		}
+
+		if file != nil {
+			data, err = ioutil.ReadAll(file)
+		} else {
+			data, err = n.Routing.GetValue(req.Context().Context, key.Key("/ipns/"+string(hash)))
+		}
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		info, err := namesys.InspectRecord(data)
+		if info == nil {
+			res.SetError(fmt.Errorf("not an IPNS record: %s", err), cmds.ErrNormal)
+			return
+		}
+
+		out := &IpnsInspectResult{
+			Name:         name,
+			Value:        info.Value,
+			ValidityType: info.ValidityType,
+			Validity:     info.Validity,
+			Expired:      info.Expired,
+			Sequence:     info.Sequence,
+			TTL:          info.TTL,
+		}
+		if err != nil {
+			out.Error = err.Error()
+			res.SetOutput(out)
+			return
+		}
+
+		pubkey, err := routing.GetPublicKey(n.Routing, req.Context().Context, hash)
+		if err != nil {
+			out.SignatureError = fmt.Sprintf("could not fetch public key: %s", err)
+		} else if err := namesys.VerifyRecord(pubkey, data); err != nil {
+			out.SignatureError = err.Error()
+		} else {
+			out.Verified = true
+		}
+
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*IpnsInspectResult)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "Value: %s\n", out.Value)
+			switch {
+			case out.Verified:
+				fmt.Fprintln(buf, "Signature: valid")
+			case out.SignatureError != "":
+				fmt.Fprintf(buf, "Signature: NOT VERIFIED: %s\n", out.SignatureError)
+			default:
+				fmt.Fprintln(buf, "Signature: NOT VERIFIED")
+			}
+			if out.Validity.IsZero() {
+				fmt.Fprintf(buf, "Validity: %s (unparseable)\n", out.ValidityType)
+			} else {
+				fmt.Fprintf(buf, "Validity: %s %s", out.ValidityType, u.FormatRFC3339(out.Validity))
+				if out.Expired {
+					fmt.Fprint(buf, " (expired)")
+				}
+				fmt.Fprintln(buf)
+			}
+			fmt.Fprintf(buf, "Sequence: %d\n", out.Sequence)
+			fmt.Fprintf(buf, "TTL: %s\n", out.TTL)
+			if out.Error != "" {
+				fmt.Fprintf(buf, "Error: %s\n", out.Error)
+			}
+			return buf, nil
+		},
+	},
+	Type: IpnsInspectResult{},
+}
@@ -17,7 +17,10 @@ import (
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	cmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	ipld "github.com/ipfs/go-ipfs/ipld"
 	dag "github.com/ipfs/go-ipfs/merkledag"
+	dagutils "github.com/ipfs/go-ipfs/merkledag/utils"
 	path "github.com/ipfs/go-ipfs/path"
 	ft "github.com/ipfs/go-ipfs/unixfs"
 	u "github.com/ipfs/go-ipfs/util"
@@ -43,6 +46,22 @@ type Object struct {
 	Links []Link
 }
 
+// ObjectChange is one change 'ipfs object diff' found. Sizes are given for
+// unixfs files only.
+type ObjectChange struct {
+	Type       string
+	Path       string
+	Before     string `json:",omitempty"`
+	After      string `json:",omitempty"`
+	File       bool   `json:",omitempty"`
+	SizeBefore uint64 `json:",omitempty"`
+	SizeAfter  uint64 `json:",omitempty"`
+}
+
+type ObjectDiff struct {
+	Changes []ObjectChange
+}
+
 var ObjectCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Interact with ipfs objects",
@@ -57,6 +76,7 @@ ipfs object links <key>     - Outputs links pointed to by object
 ipfs object stat <key>      - Outputs statistics of object
 ipfs object new <template>  - Create new ipfs objects
 ipfs object patch <args>    - Create new object from old ones
+ipfs object diff <a> <b>    - Outputs the changes from one DAG to another
 `,
 	},
 
@@ -68,6 +88,7 @@ ipfs object patch <args>    - Create new object from old ones
 		"stat":  objectStatCmd,
 		"new":   objectNewCmd,
 		"patch": objectPatchCmd,
+		"diff":  objectDiffCmd,
 	},
 }
 
@@ -99,13 +120,12 @@ output is the raw data of the object.
 			return
 		}
 
-		fpath := path.Path(req.Arguments()[0])
-		node, err := core.Resolve(req.Context().Context, n, fpath)
+		data, err := coreapi.NewCoreAPI(n).Object().Data(req.Context().Context, req.Arguments()[0])
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		res.SetOutput(bytes.NewReader(node.Data))
+		res.SetOutput(data)
 	},
 }
 
@@ -129,8 +149,7 @@ multihash.
 			return
 		}
 
-		fpath := path.Path(req.Arguments()[0])
-		node, err := core.Resolve(req.Context().Context, n, fpath)
+		node, err := coreapi.NewCoreAPI(n).Object().Get(req.Context().Context, req.Arguments()[0])
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -188,9 +207,7 @@ This command outputs data in the following encodings:
 			return
 		}
 
-		fpath := path.Path(req.Arguments()[0])
-
-		object, err := core.Resolve(req.Context().Context, n, fpath)
+		object, err := coreapi.NewCoreAPI(n).Object().Get(req.Context().Context, req.Arguments()[0])
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -229,6 +246,13 @@ This command outputs data in the following encodings:
 	},
 }
 
+// ObjectStat is the output of 'ipfs object stat': the stats of the node
+// and, with --cumulative, the size of its DAG.
+type ObjectStat struct {
+	dag.NodeStat
+	Dag *ipld.DagStat `json:",omitempty"`
+}
+
 var objectStatCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Get stats for the DAG node named by <key>",
@@ -241,39 +265,72 @@ var objectStatCmd = &cmds.Command{
 	LinksSize       int size of the links segment
 	DataSize        int size of the data segment
 	CumulativeSize  int cumulative size of object and its references
+
+With --cumulative, it walks the DAG under the node, fetching the blocks
+it doesn't have, and outputs too:
+
+	DagBlocks       int number of blocks of the DAG, each counted once
+	DagSize         int size of those blocks, what pinning the DAG stores
+
+CumulativeSize is what the links of the node claim, and counts the
+blocks linked more than once each time. See 'ipfs dag stat' to follow
+the progress of the walk.
 `,
 	},
 
 	Arguments: []cmds.Argument{
 		cmds.StringArg("key", true, false, "Key of the object to retrieve (in base58-encoded multihash format)").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption("cumulative", "Walk the DAG under the object, to count its blocks and their size"),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.Context().GetNode()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
+		ctx := req.Context().Context
 
-		fpath := path.Path(req.Arguments()[0])
-
-		object, err := core.Resolve(req.Context().Context, n, fpath)
+		nd, err := coreapi.NewCoreAPI(n).Object().Get(ctx, req.Arguments()[0])
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-
-		ns, err := object.Stat()
+		ns, err := nd.Stat()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
+		out := &ObjectStat{NodeStat: *ns}
+
+		cumulative, _, err := req.Option("cumulative").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		if cumulative {
+			k, err := nd.Key()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			out.Dag, err = ipld.Stat(ctx, n.Blocks, k, nil)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
 
-		res.SetOutput(ns)
+		res.SetOutput(out)
 	},
-	Type: dag.NodeStat{},
+	Type: ObjectStat{},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
-			ns := res.Output().(*dag.NodeStat)
+			ns, ok := res.Output().(*ObjectStat)
+			if !ok {
+				return nil, u.ErrCast()
+			}
 
 			buf := new(bytes.Buffer)
 			w := func(s string, n int) {
@@ -284,6 +341,10 @@ var objectStatCmd = &cmds.Command{
 			w("LinksSize", ns.LinksSize)
 			w("DataSize", ns.DataSize)
 			w("CumulativeSize", ns.CumulativeSize)
+			if ns.Dag != nil {
+				w("DagBlocks", ns.Dag.NumBlocks)
+				fmt.Fprintf(buf, "DagSize: %d\n", ns.Dag.Size)
+			}
 
 			return buf, nil
 		},
@@ -377,6 +438,105 @@ and then run
 	Type: Object{},
 }
 
+var objectDiffCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Outputs the changes from one DAG to another",
+		ShortDescription: `
+'ipfs object diff' compares the DAGs at <a> and <b>, and prints what it
+takes to turn one into the other: the entries of unixfs directories added
+(+), removed (-) and changed (~), by path, with the sizes of the files.
+Directories present on both sides are compared entry by entry.
+
+  $ ipfs object diff /ipns/example.com /ipfs/QmNewSite
+  ~ index.html QmOld -> QmNew (1024 -> 1100 bytes, +76)
+  + img/logo.png QmLogo (2048 bytes)
+  - old.html QmGone (512 bytes)
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("a", true, false, "Path of the object to compare from"),
+		cmds.StringArg("b", true, false, "Path of the object to compare to"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		ctx := req.Context().Context
+
+		var roots []*dag.Node
+		for _, arg := range req.Arguments() {
+			nd, err := core.Resolve(ctx, n, path.Path(arg))
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			roots = append(roots, nd)
+		}
+
+		changes, err := dagutils.Diff(ctx, n.DAG, roots[0], roots[1])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		out := &ObjectDiff{Changes: make([]ObjectChange, len(changes))}
+		for i, c := range changes {
+			out.Changes[i] = ObjectChange{
+				Type:       c.Type.String(),
+				Path:       c.Path,
+				File:       c.File,
+				SizeBefore: c.SizeBefore,
+				SizeAfter:  c.SizeAfter,
+			}
+			if c.Before != "" {
+				out.Changes[i].Before = c.Before.B58String()
+			}
+			if c.After != "" {
+				out.Changes[i].After = c.After.B58String()
+			}
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*ObjectDiff)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			var buf bytes.Buffer
+			for _, c := range out.Changes {
+				p := c.Path
+				if p == "" {
+					p = "/"
+				}
+				switch c.Type {
+				case "add":
+					fmt.Fprintf(&buf, "+ %s %s", p, c.After)
+					if c.File {
+						fmt.Fprintf(&buf, " (%d bytes)", c.SizeAfter)
+					}
+				case "remove":
+					fmt.Fprintf(&buf, "- %s %s", p, c.Before)
+					if c.File {
+						fmt.Fprintf(&buf, " (%d bytes)", c.SizeBefore)
+					}
+				default:
+					fmt.Fprintf(&buf, "~ %s %s -> %s", p, c.Before, c.After)
+					if c.File {
+						fmt.Fprintf(&buf, " (%d -> %d bytes, %+d)", c.SizeBefore, c.SizeAfter, int64(c.SizeAfter)-int64(c.SizeBefore))
+					}
+				}
+				buf.WriteByte('\n')
+			}
+			return &buf, nil
+		},
+	},
+	Type: ObjectDiff{},
+}
+
 var objectNewCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "creates a new object from an ipfs template",
@@ -434,9 +594,23 @@ var objectPatchCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Create a new merkledag object based on an existing one",
 		ShortDescription: `
-'ipfs object patch <root> [add-link|rm-link] <args>' is a plumbing command used to
-build custom DAG objects. It adds and removes links from objects, creating a new
-object as a result. This is the merkle-dag version of modifying an object.
+'ipfs object patch <root> <command> <args>' is a plumbing command used to
+build custom DAG objects. It adds and removes links from objects, or changes
+their data, creating a new object as a result. This is the merkle-dag version
+of modifying an object. <root> may be a hash, or an /ipfs or /ipns path.
+
+The commands are:
+
+    add-link <name> <hash>    link <hash> under <name>, replacing any link
+                              already named so
+    rm-link <name>            remove the link named <name>
+    set-data <data>           set the data of the object to <data>
+    append-data <data>        append <data> to the data of the object
+
+The data may also be read from stdin. The names of add-link and rm-link may
+be paths, such as a/b/c, to modify an object linked below the root; every
+object on the way is updated, and the new root is returned. With --create,
+add-link makes the unixfs directories missing along the path.
 
 Examples:
 
@@ -451,9 +625,19 @@ a file containing 'bar', and returns the hash of the new object.
 
 This removes the link named foo from the hash in $FOO_BAR and returns the
 resulting object hash.
+
+    ipfs object patch --create $EMPTY_DIR add-link a/b/foo $BAR
+
+This links the file under foo, in a directory b made in a directory a.
+
+    echo "data" | ipfs object patch $FOO_BAR set-data
+
+This sets the data of the object in $FOO_BAR to 'data'.
 `,
 	},
-	Options: []cmds.Option{},
+	Options: []cmds.Option{
+		cmds.BoolOption("create", "p", "Create the unixfs directories missing on the path of add-link"),
+	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("root", true, false, "the hash of the node to modify"),
 		cmds.StringArg("command", true, false, "the operation to perform"),
@@ -467,14 +651,8 @@ resulting object hash.
 			return
 		}
 
-		rhash := key.B58KeyDecode(req.Arguments()[0])
-		if rhash == "" {
-			res.SetError(fmt.Errorf("incorrectly formatted root hash"), cmds.ErrNormal)
-			return
-		}
-
 		ctx, cancel := context.WithTimeout(req.Context().Context, time.Second*30)
-		rnode, err := nd.DAG.Get(ctx, rhash)
+		rnode, err := core.Resolve(ctx, nd, path.Path(req.Arguments()[0]))
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			cancel()
@@ -514,7 +692,7 @@ resulting object hash.
 			}
 			res.SetOutput(&Object{Hash: k.B58String()})
 		default:
-			res.SetError(fmt.Errorf("unrecognized subcommand"), cmds.ErrNormal)
+			res.SetError(fmt.Errorf("unrecognized subcommand %q: use add-link, rm-link, set-data or append-data", action), cmds.ErrClient)
 			return
 		}
 	},
@@ -532,7 +710,7 @@ resulting object hash.
 
 func appendDataCaller(req cmds.Request, root *dag.Node) (key.Key, error) {
 	if len(req.Arguments()) < 3 {
-		return "", fmt.Errorf("not enough arguments for set-data")
+		return "", fmt.Errorf("not enough arguments for append-data")
 	}
 
 	nd, err := req.Context().GetNode()
@@ -580,19 +758,16 @@ func rmLinkCaller(req cmds.Request, root *dag.Node) (key.Key, error) {
 		return "", err
 	}
 
-	name := req.Arguments()[2]
-
-	err = root.RemoveNodeLink(name)
+	parts, err := patchPath(req.Arguments()[2])
 	if err != nil {
 		return "", err
 	}
 
-	newkey, err := nd.DAG.Add(root)
+	nnode, err := rmNodeAtPath(req.Context().Context, nd.DAG, root, parts)
 	if err != nil {
 		return "", err
 	}
-
-	return newkey, nil
+	return nnode.Key()
 }
 
 func addLinkCaller(req cmds.Request, root *dag.Node) (key.Key, error) {
@@ -605,18 +780,40 @@ func addLinkCaller(req cmds.Request, root *dag.Node) (key.Key, error) {
 		return "", err
 	}
 
-	path := req.Arguments()[2]
-	childk := key.B58KeyDecode(req.Arguments()[3])
+	create, _, err := req.Option("create").Bool()
+	if err != nil {
+		return "", err
+	}
 
-	parts := strings.Split(path, "/")
+	parts, err := patchPath(req.Arguments()[2])
+	if err != nil {
+		return "", err
+	}
+	childh, err := mh.FromB58String(req.Arguments()[3])
+	if err != nil {
+		return "", fmt.Errorf("incorrectly formatted child hash %q", req.Arguments()[3])
+	}
+	childk := key.Key(childh)
 
-	nnode, err := insertNodeAtPath(req.Context().Context, nd.DAG, root, parts, childk)
+	nnode, err := insertNodeAtPath(req.Context().Context, nd.DAG, root, parts, childk, create)
 	if err != nil {
 		return "", err
 	}
 	return nnode.Key()
 }
 
+// patchPath splits the path of a link to add or remove into the names
+// leading to it.
+func patchPath(p string) ([]string, error) {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("invalid link path %q", p)
+		}
+	}
+	return parts, nil
+}
+
 func addLink(ctx context.Context, ds dag.DAGService, root *dag.Node, childname string, childk key.Key) (*dag.Node, error) {
 	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
 	childnd, err := ds.Get(ctx, childk)
@@ -626,26 +823,53 @@ func addLink(ctx context.Context, ds dag.DAGService, root *dag.Node, childname s
 	}
 	cancel()
 
-	err = root.AddNodeLinkClean(childname, childnd)
-	if err != nil {
-		return nil, err
+	return replaceLink(ds, root, childname, childnd)
+}
+
+func insertNodeAtPath(ctx context.Context, ds dag.DAGService, root *dag.Node, path []string, toinsert key.Key, create bool) (*dag.Node, error) {
+	if len(path) == 1 {
+		return addLink(ctx, ds, root, path[0], toinsert)
 	}
 
-	_, err = ds.Add(root)
+	var nd *dag.Node
+	child, err := root.GetNodeLink(path[0])
+	switch {
+	case err == dag.ErrNotFound && create:
+		nd = &dag.Node{Data: ft.FolderPBData()}
+	case err != nil:
+		return nil, fmt.Errorf("no link named %q: %s", path[0], err)
+	default:
+		nd, err = child.GetNode(ctx, ds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ndprime, err := insertNodeAtPath(ctx, ds, nd, path[1:], toinsert, create)
 	if err != nil {
 		return nil, err
 	}
-	return root, nil
+
+	return replaceLink(ds, root, path[0], ndprime)
 }
 
-func insertNodeAtPath(ctx context.Context, ds dag.DAGService, root *dag.Node, path []string, toinsert key.Key) (*dag.Node, error) {
+func rmNodeAtPath(ctx context.Context, ds dag.DAGService, root *dag.Node, path []string) (*dag.Node, error) {
 	if len(path) == 1 {
-		return addLink(ctx, ds, root, path[0], toinsert)
+		err := root.RemoveNodeLink(path[0])
+		if err != nil {
+			return nil, fmt.Errorf("no link named %q: %s", path[0], err)
+		}
+
+		_, err = ds.Add(root)
+		if err != nil {
+			return nil, err
+		}
+		return root, nil
 	}
 
 	child, err := root.GetNodeLink(path[0])
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("no link named %q: %s", path[0], err)
 	}
 
 	nd, err := child.GetNode(ctx, ds)
@@ -653,17 +877,23 @@ func insertNodeAtPath(ctx context.Context, ds dag.DAGService, root *dag.Node, pa
 		return nil, err
 	}
 
-	ndprime, err := insertNodeAtPath(ctx, ds, nd, path[1:], toinsert)
+	ndprime, err := rmNodeAtPath(ctx, ds, nd, path[1:])
 	if err != nil {
 		return nil, err
 	}
 
-	err = root.RemoveNodeLink(path[0])
-	if err != nil {
+	return replaceLink(ds, root, path[0], ndprime)
+}
+
+// replaceLink points the link of root named name at nd, adding it if
+// there's none, and stores the updated root.
+func replaceLink(ds dag.DAGService, root *dag.Node, name string, nd *dag.Node) (*dag.Node, error) {
+	err := root.RemoveNodeLink(name)
+	if err != nil && err != dag.ErrNotFound {
 		return nil, err
 	}
 
-	err = root.AddNodeLinkClean(path[0], ndprime)
+	err = root.AddNodeLinkClean(name, nd)
 	if err != nil {
 		return nil, err
 	}
@@ -733,7 +963,7 @@ func objectPut(n *core.IpfsNode, input io.Reader, encoding string) (*Object, err
 		return nil, err
 	}
 
-	_, err = n.DAG.Add(dagnode)
+	_, err = coreapi.NewCoreAPI(n).Object().Put(n.Context(), dagnode)
 	if err != nil {
 		return nil, err
 	}
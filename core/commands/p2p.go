@@ -0,0 +1,282 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
+	tunnel "github.com/ipfs/go-ipfs/p2p/tunnel"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// defaultForwardAddress is listened on by 'ipfs p2p dial' when no address
+// is given: any free port, on the loopback interface.
+const defaultForwardAddress = "/ip4/127.0.0.1/tcp/0"
+
+// P2PListener is a protocol listened to, and the address its streams are
+// handed to.
+type P2PListener struct {
+	Protocol string
+	Target   string
+}
+
+// P2PForward is an address listened on, and the peer and protocol of the
+// streams its connections are handed to.
+type P2PForward struct {
+	Address  string
+	Peer     string
+	Protocol string
+}
+
+type P2PLsOutput struct {
+	Listeners []P2PListener
+	Forwards  []P2PForward
+}
+
+var P2PCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Forward local sockets over the swarm",
+		Synopsis: `
+ipfs p2p listen <protocol> <target-address>             - Hand streams of a protocol to a local address
+ipfs p2p dial <peer-id> <protocol> [<listen-address>]   - Hand local connections to streams to a peer
+ipfs p2p ls                                             - List listeners and forwards
+ipfs p2p close <protocol>|<listen-address>              - Close a listener or forward
+`,
+		ShortDescription: `
+ipfs p2p has applications reach each other over the swarm, through the
+NATs and firewalls between their nodes, by tunneling their connections
+in streams of custom protocols, whose names start with /x/.
+
+On the node serving the application:
+
+  > ipfs p2p listen /x/myapp /ip4/127.0.0.1/tcp/8080
+
+And on the node of a client:
+
+  > ipfs p2p dial <peer-id> /x/myapp /ip4/127.0.0.1/tcp/9090
+
+The connections the client makes to 127.0.0.1:9090 are then handed to
+127.0.0.1:8080, on the serving node.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"listen": p2pListenCmd,
+		"dial":   p2pDialCmd,
+		"ls":     p2pLsCmd,
+		"close":  p2pCloseCmd,
+	},
+}
+
+// tunnelsNode returns the node, if it's online.
+func tunnelsNode(req cmds.Request) (*core.IpfsNode, error) {
+	n, err := req.Context().GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if !n.OnlineMode() {
+		return nil, errNotOnline
+	}
+	return n, nil
+}
+
+var p2pListenCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Hand streams of a protocol to a local address",
+		ShortDescription: `
+Registers <protocol> with the swarm, and hands the streams of it that
+peers open to a connection to <target-address>.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("protocol", true, false, "The protocol to listen to, starting with /x/"),
+		cmds.StringArg("target-address", true, false, "The address to hand the streams to, e.g. /ip4/127.0.0.1/tcp/8080"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := tunnelsNode(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		target, err := ma.NewMultiaddr(req.Arguments()[1])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		l, err := n.Tunnels.Listen(protocol.ID(req.Arguments()[0]), target)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&P2PListener{
+			Protocol: string(l.Protocol),
+			Target:   l.Target.String(),
+		})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			l, ok := res.Output().(*P2PListener)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return strings.NewReader(fmt.Sprintf("%s -> %s\n", l.Protocol, l.Target)), nil
+		},
+	},
+	Type: P2PListener{},
+}
+
+var p2pDialCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Hand local connections to streams to a peer",
+		ShortDescription: `
+Listens on <listen-address>, and hands the connections made to it to
+streams of <protocol> opened to <peer-id>, which must be listening to
+it. The address listened on is printed; by default, it's a free port on
+127.0.0.1.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer-id", true, false, "The peer to open streams to"),
+		cmds.StringArg("protocol", true, false, "The protocol of the streams, starting with /x/"),
+		cmds.StringArg("listen-address", false, false, "The address to listen on (default: "+defaultForwardAddress+")"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := tunnelsNode(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		args := req.Arguments()
+		p, err := peer.IDB58Decode(args[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		laddr := defaultForwardAddress
+		if len(args) > 2 {
+			laddr = args[2]
+		}
+		addr, err := ma.NewMultiaddr(laddr)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		f, err := n.Tunnels.Dial(p, protocol.ID(args[1]), addr)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(forwardOutput(f))
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			f, ok := res.Output().(*P2PForward)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return strings.NewReader(f.Address + "\n"), nil
+		},
+	},
+	Type: P2PForward{},
+}
+
+func forwardOutput(f *tunnel.Forward) *P2PForward {
+	return &P2PForward{
+		Address:  f.Address.String(),
+		Peer:     f.Peer.Pretty(),
+		Protocol: string(f.Protocol),
+	}
+}
+
+var p2pLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List listeners and forwards",
+		ShortDescription: `
+Lists the protocols listened to, with the addresses their streams are
+handed to, and then the addresses listened on, with the peers and
+protocols their connections are handed to.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := tunnelsNode(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		out := new(P2PLsOutput)
+		for _, l := range n.Tunnels.Listeners() {
+			out.Listeners = append(out.Listeners, P2PListener{
+				Protocol: string(l.Protocol),
+				Target:   l.Target.String(),
+			})
+		}
+		for _, f := range n.Tunnels.Forwards() {
+			out.Forwards = append(out.Forwards, *forwardOutput(f))
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*P2PLsOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			for _, l := range out.Listeners {
+				fmt.Fprintf(buf, "%s -> %s\n", l.Protocol, l.Target)
+			}
+			for _, f := range out.Forwards {
+				fmt.Fprintf(buf, "%s -> /ipfs/%s%s\n", f.Address, f.Peer, f.Protocol)
+			}
+			return buf, nil
+		},
+	},
+	Type: P2PLsOutput{},
+}
+
+var p2pCloseCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Close a listener or forward",
+		ShortDescription: `
+Stops listening to a protocol, or on the address of a forward. The
+connections handed over already stay open.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The protocol of a listener, or the address of a forward"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := tunnelsNode(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		name := req.Arguments()[0]
+		if strings.HasPrefix(name, tunnel.ProtocolPrefix) {
+			err = n.Tunnels.CloseListener(protocol.ID(name))
+		} else {
+			var addr ma.Multiaddr
+			addr, err = ma.NewMultiaddr(name)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+			err = n.Tunnels.CloseForward(addr)
+		}
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
@@ -2,12 +2,20 @@ package commands
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	gopath "path"
+	"sort"
+	"strings"
 
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	path "github.com/ipfs/go-ipfs/path"
+	pin "github.com/ipfs/go-ipfs/pin"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -17,14 +25,21 @@ var PinCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"add": addPinCmd,
-		"rm":  rmPinCmd,
-		"ls":  listPinCmd,
+		"add":    addPinCmd,
+		"rm":     rmPinCmd,
+		"ls":     listPinCmd,
+		"update": updatePinCmd,
+		"status": statusPinCmd,
+		"remote": remotePinCmd,
+		"repair": repairPinCmd,
 	},
 }
 
 type PinOutput struct {
 	Pinned []key.Key
+	// Manifests are the erasure coding manifests of the pins, with
+	// --replication.
+	Manifests []key.Key `json:",omitempty"`
 }
 
 var addPinCmd = &cmds.Command{
@@ -33,6 +48,46 @@ var addPinCmd = &cmds.Command{
 		ShortDescription: `
 Retrieves the object named by <ipfs-path> and stores it locally
 on disk.
+`,
+		LongDescription: `
+Retrieves the object named by <ipfs-path> and stores it locally
+on disk.
+
+Use --name to give the pins a name, and --meta to attach metadata to
+them, as comma separated key=value pairs:
+
+  ipfs pin add -r --name=website --meta=owner=web,env=prod <ipfs-path>
+
+Pins can then be listed by name with 'ipfs pin ls --name'. Pinning an
+object again with --name or --meta replaces the name and metadata it had.
+
+With --background, the objects are queued to be pinned by the daemon, and
+the command returns at once, without waiting for them to be fetched. The
+daemon retries failed fetches, backing off between attempts, and keeps
+the blocks fetched along the way. Use 'ipfs pin status' to follow how
+the pins are doing. Queued pins are lost if the daemon is stopped.
+
+--type gives the kind of pin: "direct", "recursive", the same as -r, or
+"best-effort". A best-effort pin keeps the object, and what the node has
+of its graph, from garbage collection only while space permits: once the
+repo outgrows Datastore.StorageMax, or an 'ipfs repo gc' can't free
+--target-free-bytes otherwise, the best-effort pins are evicted, least
+recently used first, and their blocks removed. The gateway serving an
+object counts as a use. Only the object itself is fetched, so a gateway
+can keep its hot content warm, without committing to store it for good:
+
+  ipfs pin add --type=best-effort <ipfs-path>
+
+--replication=k/n pins the objects recursively, and erasure codes their
+graphs: the blocks are grouped k at a time, and n-k parity blocks are
+computed of each group, so that any n-k blocks of a group lost can be
+rebuilt out of the others with 'ipfs pin repair'. The parity is listed
+in a manifest, which is pinned recursively along with it, and labelled
+"erasure". The remote pinning services of Pinning.RemoteServices are
+asked to pin the manifest, and the parity blocks in turn, so that the
+parity is spread across them:
+
+  ipfs pin add --replication=10/14 <ipfs-path>
 `,
 	},
 
@@ -41,6 +96,11 @@ on disk.
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("recursive", "r", "Recursively pin the object linked to by the specified object(s)"),
+		cmds.StringOption("name", "A name for the pin(s)"),
+		cmds.StringOption("meta", "Metadata for the pin(s), as comma separated key=value pairs"),
+		cmds.BoolOption("background", "b", "Pin in the background, returning at once"),
+		cmds.StringOption("type", "t", "The type of pin: \"direct\", \"recursive\" or \"best-effort\". Defaults to \"direct\", or \"recursive\" with -r"),
+		cmds.StringOption("replication", "Erasure code the pins recursively as k/n: n blocks for each k, with parity"),
 	},
 	Type: PinOutput{},
 	Run: func(req cmds.Request, res cmds.Response) {
@@ -50,23 +110,100 @@ on disk.
 			return
 		}
 
-		// set recursive flag
-		recursive, found, err := req.Option("recursive").Bool()
+		pinType, err := pinAddType(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		recursive := pinType == "recursive"
+
+		name, nameFound, err := req.Option("name").String()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		if !found {
-			recursive = false
+		metaStr, metaFound, err := req.Option("meta").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		meta, err := parsePinMeta(metaStr)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		background, _, err := req.Option("background").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if background && pinType == "best-effort" {
+			res.SetError(errors.New("best-effort pins can't be made in the background"), cmds.ErrClient)
+			return
+		}
+		replication, replicate, err := req.Option("replication").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		var k, nn int
+		if replicate {
+			if background {
+				res.SetError(errors.New("erasure coded pins can't be made in the background"), cmds.ErrClient)
+				return
+			}
+			k, nn, err = corerepo.ParseReplication(replication)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+		}
+		if background {
+			var label *pin.Label
+			if nameFound || metaFound {
+				label = &pin.Label{Name: name, Meta: meta}
+			}
+			queued, err := corerepo.PinBackground(n, req.Arguments(), recursive, label)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			res.SetOutput(&PinOutput{Pinned: queued})
+			return
 		}
 
-		added, err := corerepo.Pin(n, req.Arguments(), recursive)
+		var added []key.Key
+		if pinType == "best-effort" {
+			added, err = corerepo.PinBestEffort(n, req.Arguments())
+		} else {
+			added, err = coreapi.NewCoreAPI(n).Pin().Add(req.Context().Context, req.Arguments(), recursive)
+		}
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
 
-		res.SetOutput(&PinOutput{added})
+		if nameFound || metaFound {
+			err := corerepo.LabelPins(n, added, pin.Label{Name: name, Meta: meta})
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		out := &PinOutput{Pinned: added}
+		if replicate {
+			for _, root := range added {
+				mk, err := corerepo.PinErasure(req.Context().Context, n, root, k, nn)
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+				out.Manifests = append(out.Manifests, mk)
+			}
+		}
+		res.SetOutput(out)
 	},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
@@ -76,22 +213,71 @@ on disk.
 			}
 
 			var pintype string
-			rec, _, _ := res.Request().Option("recursive").Bool()
-			if rec {
+			switch t, _ := pinAddType(res.Request()); t {
+			case "recursive":
 				pintype = "recursively"
-			} else {
+			case "best-effort":
+				pintype = "best-effort"
+			default:
 				pintype = "directly"
 			}
 
+			verb := "pinned"
+			if bg, _, _ := res.Request().Option("background").Bool(); bg {
+				verb = "queued to pin"
+			}
+
 			buf := new(bytes.Buffer)
-			for _, k := range added.Pinned {
-				fmt.Fprintf(buf, "pinned %s %s\n", k, pintype)
+			for i, k := range added.Pinned {
+				fmt.Fprintf(buf, "%s %s %s\n", verb, k, pintype)
+				if i < len(added.Manifests) {
+					fmt.Fprintf(buf, "erasure coded %s, manifest %s\n", k, added.Manifests[i])
+				}
 			}
 			return buf, nil
 		},
 	},
 }
 
+// pinAddType returns the type of pin req asks for, of --type or -r.
+// --replication pins recursively.
+func pinAddType(req cmds.Request) (string, error) {
+	recursive, recFound, err := req.Option("recursive").Bool()
+	if err != nil {
+		return "", err
+	}
+	typeStr, typeFound, err := req.Option("type").String()
+	if err != nil {
+		return "", err
+	}
+	_, replicate, err := req.Option("replication").String()
+	if err != nil {
+		return "", err
+	}
+	if replicate {
+		if (typeFound && typeStr != "recursive") || (recFound && !recursive) {
+			return "", errors.New("--replication pins recursively only")
+		}
+		return "recursive", nil
+	}
+	if !typeFound {
+		if recursive {
+			return "recursive", nil
+		}
+		return "direct", nil
+	}
+
+	switch typeStr {
+	case "direct", "recursive", "best-effort":
+	default:
+		return "", fmt.Errorf("Invalid type '%s', must be one of {direct, recursive, best-effort}", typeStr)
+	}
+	if recFound && recursive != (typeStr == "recursive") {
+		return "", fmt.Errorf("--recursive=%t conflicts with --type=%s", recursive, typeStr)
+	}
+	return typeStr, nil
+}
+
 var rmPinCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Unpin an object from local storage",
@@ -125,13 +311,13 @@ collected if needed.
 			recursive = false // default
 		}
 
-		removed, err := corerepo.Unpin(n, req.Arguments(), recursive)
+		removed, err := coreapi.NewCoreAPI(n).Pin().Rm(req.Context().Context, req.Arguments(), recursive)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
 
-		res.SetOutput(&PinOutput{removed})
+		res.SetOutput(&PinOutput{Pinned: removed})
 	},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
@@ -149,6 +335,242 @@ collected if needed.
 	},
 }
 
+var updatePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Move a recursive pin from one object to another",
+		ShortDescription: `
+Pins <to-path> recursively and unpins <from-path>, which must be pinned
+recursively, as 'ipfs pin add -r' and 'ipfs pin rm -r' would. Subgraphs
+the two objects share are neither walked nor fetched again, so updating
+the pin of a large object after a small change only fetches what changed.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("from-path", true, false, "Path to the recursively pinned object to unpin"),
+		cmds.StringArg("to-path", true, false, "Path to the object to pin in its place"),
+	},
+	Type: PinOutput{},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		keys, err := corerepo.PinUpdate(n, req.Arguments()[0], req.Arguments()[1])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&PinOutput{Pinned: keys})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*PinOutput)
+			if !ok || len(out.Pinned) != 2 {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "updated %s to %s\n", out.Pinned[0], out.Pinned[1])
+			return buf, nil
+		},
+	},
+}
+
+type PinStatusObject struct {
+	Key       string
+	Recursive bool
+	State     string
+	Fetched   int
+	Remaining int
+	Attempts  int
+	Error     string `json:",omitempty"`
+}
+
+type PinStatusList struct {
+	Pins []PinStatusObject
+}
+
+var statusPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the progress of background pins",
+		ShortDescription: `
+Shows how the pins queued with 'ipfs pin add --background' are doing: their
+state, one of queued, fetching, retrying, pinned or failed, the number of
+blocks fetched so far, and the number known to be left, which grows as
+more of the objects are found. Without arguments, all the background pins
+are shown.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", false, true, "Path to object(s) being pinned"),
+	},
+	Type: PinStatusList{},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if n.PinQueue == nil {
+			res.SetError(errors.New("background pins need the daemon to be running"), cmds.ErrNormal)
+			return
+		}
+
+		var sts []pin.PinStatus
+		if len(req.Arguments()) == 0 {
+			sts = n.PinQueue.List()
+		}
+		for _, p := range req.Arguments() {
+			k, err := core.ResolveToKey(req.Context().Context, n, path.Path(p))
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			st, ok := n.PinQueue.Status(k)
+			if !ok {
+				res.SetError(fmt.Errorf("%s is not being pinned in the background", k), cmds.ErrNormal)
+				return
+			}
+			sts = append(sts, st)
+		}
+
+		out := &PinStatusList{Pins: []PinStatusObject{}}
+		for _, st := range sts {
+			out.Pins = append(out.Pins, PinStatusObject{
+				Key:       st.Key.B58String(),
+				Recursive: st.Recursive,
+				State:     st.State,
+				Fetched:   st.Fetched,
+				Remaining: st.Remaining,
+				Attempts:  st.Attempts,
+				Error:     st.Err,
+			})
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*PinStatusList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for _, st := range list.Pins {
+				fmt.Fprintf(buf, "%s %s: %d blocks fetched, %d remaining\n", st.Key, st.State, st.Fetched, st.Remaining)
+				if st.Error != "" {
+					fmt.Fprintf(buf, "  attempt %d failed: %s\n", st.Attempts, st.Error)
+				}
+			}
+			return buf, nil
+		},
+	},
+}
+
+type PinRepairObject struct {
+	Key      string
+	Manifest string
+	Repaired []string
+}
+
+type PinRepairList struct {
+	Pins []PinRepairObject
+}
+
+var repairPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Rebuild the lost blocks of erasure coded pins",
+		ShortDescription: `
+Checks the blocks of the pins made with 'ipfs pin add --replication', and
+rebuilds those missing or corrupt out of the others of their group and the
+parity, fetching from the network the parity the node doesn't have, such
+as that held by the remote pinning services. Without arguments, all the
+erasure coded pins are repaired.
+
+A group of k blocks to n can be rebuilt as long as k of its n blocks are
+left.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", false, true, "Path to object(s) pinned with --replication"),
+	},
+	Type: PinRepairList{},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		ctx := req.Context().Context
+
+		manifests := corerepo.ErasureManifests(n)
+		var roots []key.Key
+		if len(req.Arguments()) == 0 {
+			for root := range manifests {
+				roots = append(roots, root)
+			}
+			sort.Sort(key.KeySlice(roots))
+		}
+		for _, p := range req.Arguments() {
+			k, err := core.ResolveToKey(ctx, n, path.Path(p))
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			if _, ok := manifests[k]; !ok {
+				res.SetError(fmt.Errorf("%s is not pinned with --replication", k), cmds.ErrClient)
+				return
+			}
+			roots = append(roots, k)
+		}
+
+		out := &PinRepairList{Pins: []PinRepairObject{}}
+		for _, root := range roots {
+			repaired, err := corerepo.RepairErasure(ctx, n, manifests[root])
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			obj := PinRepairObject{
+				Key:      root.B58String(),
+				Manifest: manifests[root].B58String(),
+				Repaired: []string{},
+			}
+			for _, k := range repaired {
+				obj.Repaired = append(obj.Repaired, k.B58String())
+			}
+			out.Pins = append(out.Pins, obj)
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*PinRepairList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for _, p := range list.Pins {
+				if len(p.Repaired) == 0 {
+					fmt.Fprintf(buf, "%s is intact\n", p.Key)
+					continue
+				}
+				for _, k := range p.Repaired {
+					fmt.Fprintf(buf, "repaired %s of %s\n", k, p.Key)
+				}
+			}
+			return buf, nil
+		},
+	},
+}
+
 var listPinCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "List objects pinned to local storage",
@@ -164,17 +586,29 @@ Use --type=<type> to specify the type of pinned keys to list. Valid values are:
     * "direct": pin that specific object.
     * "recursive": pin that specific object, and indirectly pin all its decendants
     * "indirect": pinned indirectly by an ancestor (like a refcount)
+    * "best-effort": kept, with what is local of its graph, while space permits
     * "all"
 
 To see the ref count on indirect pins, pass the -count option flag.
 Defaults to "direct".
+
+--name lists only the pins whose name, given with 'ipfs pin add --name',
+matches a glob, such as "web*". With --name, the type defaults to "all".
+
+--format takes a Go template, run once per pinned key, with the fields
+{{.Key}}, {{.Type}}, {{.Count}} and {{.Name}}. Each field may also be written as its
+lower case name in angle brackets:
+
+  ipfs pin ls --type=all --format="<type> <key>"
 `,
 	},
 
 	Options: []cmds.Option{
-		cmds.StringOption("type", "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", or \"all\". Defaults to \"direct\""),
+		cmds.StringOption("type", "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", \"best-effort\", or \"all\". Defaults to \"direct\""),
 		cmds.BoolOption("count", "n", "Show refcount when listing indirect pins"),
 		cmds.BoolOption("quiet", "q", "Write just hashes of objects"),
+		cmds.StringOption("format", "Emit pins with given format. fields: <key> <type> <count> <name>"),
+		cmds.StringOption("name", "List only pins whose name matches the given glob"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.Context().GetNode()
@@ -183,6 +617,28 @@ Defaults to "direct".
 			return
 		}
 
+		format, _, err := req.Option("format").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if format != "" {
+			if _, err := parseFormat(format, pinLsEntry{}); err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+		}
+
+		nameGlob, nameFound, err := req.Option("name").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if _, err := gopath.Match(nameGlob, ""); err != nil {
+			res.SetError(fmt.Errorf("invalid name glob %q: %s", nameGlob, err), cmds.ErrClient)
+			return
+		}
+
 		typeStr, found, err := req.Option("type").String()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
@@ -190,37 +646,38 @@ Defaults to "direct".
 		}
 		if !found {
 			typeStr = "direct"
+			if nameFound {
+				typeStr = "all"
+			}
 		}
 
 		switch typeStr {
-		case "all", "direct", "indirect", "recursive":
+		case "all", "direct", "indirect", "recursive", "best-effort":
 		default:
-			err = fmt.Errorf("Invalid type '%s', must be one of {direct, indirect, recursive, all}", typeStr)
+			err = fmt.Errorf("Invalid type '%s', must be one of {direct, indirect, recursive, best-effort, all}", typeStr)
 			res.SetError(err, cmds.ErrClient)
+			return
 		}
 
-		keys := make(map[string]RefKeyObject)
-		if typeStr == "direct" || typeStr == "all" {
-			for _, k := range n.Pinning.DirectKeys() {
-				keys[k.B58String()] = RefKeyObject{
-					Type:  "direct",
-					Count: 1,
-				}
-			}
+		pins, err := coreapi.NewCoreAPI(n).Pin().Ls(req.Context().Context, typeStr)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
 		}
-		if typeStr == "indirect" || typeStr == "all" {
-			for k, v := range n.Pinning.IndirectKeys() {
-				keys[k.B58String()] = RefKeyObject{
-					Type:  "indirect",
-					Count: v,
-				}
+
+		keys := make(map[string]RefKeyObject)
+		for _, p := range pins {
+			keys[p.Key.B58String()] = RefKeyObject{
+				Type:  p.Type,
+				Count: p.Count,
+				Name:  p.Label.Name,
+				Meta:  p.Label.Meta,
 			}
 		}
-		if typeStr == "recursive" || typeStr == "all" {
-			for _, k := range n.Pinning.RecursiveKeys() {
-				keys[k.B58String()] = RefKeyObject{
-					Type:  "recursive",
-					Count: 1,
+		if nameFound {
+			for k, obj := range keys {
+				if ok, _ := gopath.Match(nameGlob, obj.Name); !ok || obj.Name == "" {
+					delete(keys, k)
 				}
 			}
 		}
@@ -250,6 +707,21 @@ Defaults to "direct".
 				return nil, u.ErrCast()
 			}
 			out := new(bytes.Buffer)
+			if format, _, _ := res.Request().Option("format").String(); format != "" {
+				tmpl, err := parseFormat(format, pinLsEntry{})
+				if err != nil {
+					return nil, err
+				}
+				for k, v := range keys.Keys {
+					s, err := execFormat(tmpl, pinLsEntry{Key: k, Type: v.Type, Count: v.Count, Name: v.Name})
+					if err != nil {
+						return nil, err
+					}
+					fmt.Fprintln(out, s)
+				}
+				return out, nil
+			}
+
 			if typeStr == "indirect" && count {
 				for k, v := range keys.Keys {
 					if quiet {
@@ -260,9 +732,12 @@ Defaults to "direct".
 				}
 			} else {
 				for k, v := range keys.Keys {
-					if quiet {
+					switch {
+					case quiet:
 						fmt.Fprintf(out, "%s\n", k)
-					} else {
+					case v.Name != "":
+						fmt.Fprintf(out, "%s %s %s\n", k, v.Type, v.Name)
+					default:
 						fmt.Fprintf(out, "%s %s\n", k, v.Type)
 					}
 				}
@@ -272,11 +747,37 @@ Defaults to "direct".
 	},
 }
 
+// pinLsEntry holds the fields available to pin ls --format.
+type pinLsEntry struct {
+	Key   string
+	Type  string
+	Count int
+	Name  string
+}
+
 type RefKeyObject struct {
 	Type  string
 	Count int
+	Name  string            `json:",omitempty"`
+	Meta  map[string]string `json:",omitempty"`
 }
 
 type RefKeyList struct {
 	Keys map[string]RefKeyObject
 }
+
+// parsePinMeta parses the comma separated key=value pairs of pin add --meta.
+func parsePinMeta(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	meta := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid metadata %q, expected key=value", kv)
+		}
+		meta[parts[0]] = parts[1]
+	}
+	return meta, nil
+}
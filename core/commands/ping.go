@@ -2,6 +2,7 @@ package commands
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
@@ -23,6 +24,18 @@ type PingResult struct {
 	Success bool
 	Time    time.Duration
 	Text    string
+	// Stats is set on the last result, when the pings are over.
+	Stats *PingStats `json:",omitempty"`
+}
+
+// PingStats sums up the pings sent to a peer. Min, Avg and Max are of the
+// pings which got a pong back.
+type PingStats struct {
+	Sent     int
+	Received int
+	Min      time.Duration
+	Avg      time.Duration
+	Max      time.Duration
 }
 
 var PingCmd = &cmds.Command{
@@ -33,8 +46,15 @@ Send pings to a peer using the routing system to discover its address
 		`,
 		ShortDescription: `
 ipfs ping is a tool to test sending data to other nodes. It finds nodes
-via the routing system, send pings, wait for pongs, and print out round-
-trip latency information.
+via the routing system, sends pings over the ping protocol, apart from the
+DHT and bitswap, and prints the round-trip time of each pong as it comes,
+then the minimum, average and maximum of them, and how many pings were
+lost.
+
+With --address, existing connections to the peer are closed and it is
+dialed over the given multiaddr only, to verify a single transport. With
+--relay-only, it is dialed through the circuit relays only, which takes
+Experiments.Relay.
 		`,
 	},
 	Arguments: []cmds.Argument{
@@ -42,6 +62,9 @@ trip latency information.
 	},
 	Options: []cmds.Option{
 		cmds.IntOption("count", "n", "number of ping messages to send"),
+		cmds.StringOption("interval", "time between ping messages (default: 1s)"),
+		cmds.StringOption("address", "dial the peer over this multiaddr only"),
+		cmds.BoolOption("relay-only", "dial the peer through circuit relays only"),
 	},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
@@ -58,10 +81,18 @@ trip latency information.
 				}
 
 				buf := new(bytes.Buffer)
-				if len(obj.Text) > 0 {
+				if st := obj.Stats; st != nil {
+					fmt.Fprintln(buf, obj.Text)
+					fmt.Fprintf(buf, "%d pings sent, %d received, %.0f%% loss\n",
+						st.Sent, st.Received, pingLoss(st)*100)
+					if st.Received > 0 {
+						fmt.Fprintf(buf, "round-trip min/avg/max = %.2f/%.2f/%.2f ms\n",
+							ms(st.Min), ms(st.Avg), ms(st.Max))
+					}
+				} else if len(obj.Text) > 0 {
 					buf = bytes.NewBufferString(obj.Text + "\n")
 				} else if obj.Success {
-					fmt.Fprintf(buf, "Pong received: time=%.2f ms\n", obj.Time.Seconds()*1000)
+					fmt.Fprintf(buf, "Pong received: time=%.2f ms\n", ms(obj.Time))
 				} else {
 					fmt.Fprintf(buf, "Pong failed\n")
 				}
@@ -94,7 +125,31 @@ trip latency information.
 			return
 		}
 
-		if addr != nil {
+		var forced ma.Multiaddr
+		force, found, err := req.Option("address").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if found {
+			forced, err = ma.NewMultiaddr(force)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		relayOnly, _, err := req.Option("relay-only").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if relayOnly && forced != nil {
+			res.SetError(errors.New("--address and --relay-only can't be used together"), cmds.ErrClient)
+			return
+		}
+
+		if addr != nil && forced == nil && !relayOnly {
 			n.Peerstore.AddAddr(peerID, addr, peer.TempAddrTTL) // temporary
 		}
 
@@ -109,18 +164,45 @@ trip latency information.
 			numPings = val
 		}
 
-		outChan := pingPeer(ctx, n, peerID, numPings)
+		interval := time.Second
+		intervalS, found, err := req.Option("interval").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if found {
+			interval, err = time.ParseDuration(intervalS)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+		}
+
+		outChan := pingPeer(ctx, n, peerID, forced, relayOnly, numPings, interval)
 		res.SetOutput(outChan)
 	},
 	Type: PingResult{},
 }
 
-func pingPeer(ctx context.Context, n *core.IpfsNode, pid peer.ID, numPings int) <-chan interface{} {
+// pingPeer pings pid numPings times. It dials it over forced only if set,
+// or through the circuit relays only if relayOnly is.
+func pingPeer(ctx context.Context, n *core.IpfsNode, pid peer.ID, forced ma.Multiaddr, relayOnly bool, numPings int, interval time.Duration) <-chan interface{} {
 	outChan := make(chan interface{})
 	go func() {
 		defer close(outChan)
 
-		if len(n.Peerstore.Addrs(pid)) == 0 {
+		if forced != nil || relayOnly {
+			ctx, cancel := context.WithTimeout(ctx, kPingTimeout)
+			defer cancel()
+			if err := dialOnly(ctx, n, pid, forced); err != nil {
+				via := "through relays"
+				if forced != nil {
+					via = forced.String()
+				}
+				outChan <- &PingResult{Text: fmt.Sprintf("Dial %s failed: %s", via, err)}
+				return
+			}
+		} else if len(n.Peerstore.Addrs(pid)) == 0 {
 			// Make sure we can find the node in question
 			outChan <- &PingResult{
 				Text: fmt.Sprintf("Looking up peer %s", pid.Pretty()),
@@ -138,39 +220,68 @@ func pingPeer(ctx context.Context, n *core.IpfsNode, pid peer.ID, numPings int)
 
 		outChan <- &PingResult{Text: fmt.Sprintf("PING %s.", pid.Pretty())}
 
-		var done bool
+		var stats PingStats
 		var total time.Duration
-		for i := 0; i < numPings && !done; i++ {
-			select {
-			case <-ctx.Done():
-				done = true
-				continue
-			default:
+	pings:
+		for i := 0; i < numPings; i++ {
+			if i > 0 {
+				select {
+				case <-time.After(interval):
+				case <-ctx.Done():
+					break pings
+				}
 			}
 
-			ctx, cancel := context.WithTimeout(ctx, kPingTimeout)
-			defer cancel()
-			took, err := n.Routing.Ping(ctx, pid)
+			pctx, cancel := context.WithTimeout(ctx, kPingTimeout)
+			took, err := n.Ping.Ping(pctx, pid)
+			cancel()
+			stats.Sent++
 			if err != nil {
+				if ctx.Err() != nil {
+					// interrupted, rather than lost.
+					stats.Sent--
+					break
+				}
 				log.Debugf("Ping error: %s", err)
 				outChan <- &PingResult{Text: fmt.Sprintf("Ping error: %s", err)}
-				break
+				continue
 			}
 			outChan <- &PingResult{
 				Success: true,
 				Time:    took,
 			}
+			stats.Received++
 			total += took
-			time.Sleep(time.Second)
+			if stats.Min == 0 || took < stats.Min {
+				stats.Min = took
+			}
+			if took > stats.Max {
+				stats.Max = took
+			}
+		}
+		if stats.Received > 0 {
+			stats.Avg = total / time.Duration(stats.Received)
 		}
-		averagems := total.Seconds() * 1000 / float64(numPings)
 		outChan <- &PingResult{
-			Text: fmt.Sprintf("Average latency: %.2fms", averagems),
+			Text:  fmt.Sprintf("--- %s ping statistics ---%s", pid.Pretty(), describeConns(n, pid)),
+			Stats: &stats,
 		}
 	}()
 	return outChan
 }
 
+// pingLoss returns the share of the pings of st which got no pong.
+func pingLoss(st *PingStats) float64 {
+	if st.Sent == 0 {
+		return 0
+	}
+	return float64(st.Sent-st.Received) / float64(st.Sent)
+}
+
+func ms(d time.Duration) float64 {
+	return d.Seconds() * 1000
+}
+
 func ParsePeerParam(text string) (ma.Multiaddr, peer.ID, error) {
 	// to be replaced with just multiaddr parsing, once ptp is a multiaddr protocol
 	idx := strings.LastIndex(text, "/")
@@ -0,0 +1,563 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	path "github.com/ipfs/go-ipfs/path"
+	remote "github.com/ipfs/go-ipfs/pin/remote"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	u "github.com/ipfs/go-ipfs/util"
+	iaddr "github.com/ipfs/go-ipfs/util/ipfsaddr"
+)
+
+// remotePinPollInterval is how often 'ipfs pin remote add' asks the service
+// how the pin is doing, until it is pinned.
+const remotePinPollInterval = 2 * time.Second
+
+var remotePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Pin objects to remote pinning services",
+		Synopsis: `
+ipfs pin remote service add <name> <endpoint> <key> - Register a pinning service
+ipfs pin remote service ls                          - List the pinning services
+ipfs pin remote service rm <name>                   - Forget a pinning service
+ipfs pin remote add <ipfs-path>...                  - Pin objects on a service
+ipfs pin remote ls                                  - List the pins of a service
+ipfs pin remote rm <key>...                         - Remove pins from a service
+`,
+		ShortDescription: `
+'ipfs pin remote' asks the services of the IPFS pinning service API to pin
+objects on nodes of their own, e.g. to back them up. Services are
+registered in Pinning.RemoteServices of the config, by name, with the
+endpoint of their API and the access key they gave.
+
+The commands pick the service with --service, which may be left out when
+a single one is registered.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"service": remotePinServiceCmd,
+		"add":     remotePinAddCmd,
+		"ls":      remotePinLsCmd,
+		"rm":      remotePinRmCmd,
+	},
+}
+
+var remotePinServiceCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the remote pinning services",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": remotePinServiceAddCmd,
+		"ls":  remotePinServiceLsCmd,
+		"rm":  remotePinServiceRmCmd,
+	},
+}
+
+type RemotePinService struct {
+	Name     string
+	Endpoint string
+}
+
+type RemotePinServiceList struct {
+	Services []RemotePinService
+}
+
+var remotePinServiceAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Register a remote pinning service",
+		ShortDescription: `
+Saves the service whose API is rooted at <endpoint> in the config, under
+<name>, with the access <key> it gave, such as:
+
+  ipfs pin remote service add mypinner https://pinning.example.com/api/v1 <key>
+
+To keep the key out of the config, give "env:NAME" to read it from the
+environment variable NAME, or "file:PATH" to read it from the file at
+PATH, which must have mode 0600 or stricter, each time it is used.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The name to give the service"),
+		cmds.StringArg("endpoint", true, false, "The root URL of the API of the service"),
+		cmds.StringArg("key", true, false, "The access key of the service"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		name, endpoint, secret := req.Arguments()[0], req.Arguments()[1], req.Arguments()[2]
+		if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+			res.SetError(fmt.Errorf("endpoint %q is not an http(s) URL", endpoint), cmds.ErrClient)
+			return
+		}
+
+		cfg, err := n.Repo.Config().Clone()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if _, ok := cfg.Pinning.RemoteServices[name]; ok {
+			res.SetError(fmt.Errorf("a pinning service named %q is registered already", name), cmds.ErrClient)
+			return
+		}
+		if cfg.Pinning.RemoteServices == nil {
+			cfg.Pinning.RemoteServices = make(map[string]config.RemotePinningService)
+		}
+		cfg.Pinning.RemoteServices[name] = config.RemotePinningService{
+			Endpoint: endpoint,
+			Key:      secret,
+		}
+		if err := n.Repo.SetConfig(cfg); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+var remotePinServiceLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the remote pinning services",
+		ShortDescription: `
+Lists the registered services, by name, with their endpoints. Their keys
+are left out.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		out := &RemotePinServiceList{Services: []RemotePinService{}}
+		for name, s := range n.Repo.Config().Pinning.RemoteServices {
+			out.Services = append(out.Services, RemotePinService{Name: name, Endpoint: s.Endpoint})
+		}
+		sort.Sort(remotePinServicesByName(out.Services))
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*RemotePinServiceList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for _, s := range list.Services {
+				fmt.Fprintf(buf, "%s %s\n", s.Name, s.Endpoint)
+			}
+			return buf, nil
+		},
+	},
+	Type: RemotePinServiceList{},
+}
+
+type remotePinServicesByName []RemotePinService
+
+func (s remotePinServicesByName) Len() int           { return len(s) }
+func (s remotePinServicesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s remotePinServicesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+var remotePinServiceRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Forget a remote pinning service",
+		ShortDescription: `
+Removes the service <name> from the config. Its pins are left on it.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The name of the service"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		name := req.Arguments()[0]
+		cfg, err := n.Repo.Config().Clone()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if _, ok := cfg.Pinning.RemoteServices[name]; !ok {
+			res.SetError(fmt.Errorf("no pinning service named %q", name), cmds.ErrClient)
+			return
+		}
+		delete(cfg.Pinning.RemoteServices, name)
+		if err := n.Repo.SetConfig(cfg); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+type RemotePinObject struct {
+	RequestID string
+	Status    remote.Status
+	Key       string
+	Name      string            `json:",omitempty"`
+	Info      map[string]string `json:",omitempty"`
+}
+
+type RemotePinList struct {
+	Pins []RemotePinObject
+}
+
+var remotePinAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Pin objects on a remote pinning service",
+		ShortDescription: `
+Asks the service to pin the objects named by <ipfs-path>, recursively,
+and waits until they are pinned, unless --background is given. The
+service is told the addresses of the node, to fetch the objects from, and
+the node connects to the peers of the service pinning them, if online.
+
+Use --name to give the pins a name, and --meta to attach metadata to
+them, as comma separated key=value pairs.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", true, true, "Path to object(s) to be pinned").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("service", "The name of the pinning service"),
+		cmds.StringOption("name", "A name for the pin(s)"),
+		cmds.StringOption("meta", "Metadata for the pin(s), as comma separated key=value pairs"),
+		cmds.BoolOption("background", "b", "Return once the service has the pins queued"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		ctx := req.Context().Context
+
+		c, err := remotePinClient(req, n)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		name, _, err := req.Option("name").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		metaStr, _, err := req.Option("meta").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		meta, err := parsePinMeta(metaStr)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		background, _, err := req.Option("background").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var origins []string
+		if n.PeerHost != nil {
+			for _, a := range n.PeerHost.Addrs() {
+				origins = append(origins, a.String()+"/ipfs/"+n.Identity.Pretty())
+			}
+		}
+
+		out := &RemotePinList{Pins: []RemotePinObject{}}
+		for _, p := range req.Arguments() {
+			k, err := core.ResolveToKey(ctx, n, path.Path(p))
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+
+			st, err := c.Add(ctx, remote.Pin{
+				Cid:     k.B58String(),
+				Name:    name,
+				Origins: origins,
+				Meta:    meta,
+			})
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			connectDelegates(n, st.Delegates)
+
+			if !background {
+				st, err = waitRemotePin(ctx, c, st)
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+				if st.Status == remote.Failed {
+					res.SetError(fmt.Errorf("the service failed to pin %s", k), cmds.ErrNormal)
+					return
+				}
+			}
+			out.Pins = append(out.Pins, remotePinObject(st))
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: remotePinListMarshaler,
+	},
+	Type: RemotePinList{},
+}
+
+var remotePinLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the pins of a remote pinning service",
+		ShortDescription: `
+Lists the pins of the service, with their status, key and name, the latest
+first. Pins of any status are listed, unless --status is given as a comma
+separated list of queued, pinning, pinned and failed.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("service", "The name of the pinning service"),
+		cmds.StringOption("name", "List the pins of that name only"),
+		cmds.StringOption("key", "List the pins of those comma separated keys only"),
+		cmds.StringOption("status", "List the pins of those comma separated statuses only"),
+		cmds.IntOption("limit", "The most pins to list; the service decides by default"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		c, err := remotePinClient(req, n)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		var f remote.Filter
+		f.Name, _, err = req.Option("name").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		keys, _, err := req.Option("key").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if keys != "" {
+			f.Cids = strings.Split(keys, ",")
+		}
+		statuses, _, err := req.Option("status").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if statuses != "" {
+			for _, s := range strings.Split(statuses, ",") {
+				st, err := remote.ParseStatus(s)
+				if err != nil {
+					res.SetError(err, cmds.ErrClient)
+					return
+				}
+				f.Status = append(f.Status, st)
+			}
+		}
+		f.Limit, _, err = req.Option("limit").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		sts, err := c.Ls(req.Context().Context, f)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		out := &RemotePinList{Pins: []RemotePinObject{}}
+		for i := range sts {
+			out.Pins = append(out.Pins, remotePinObject(&sts[i]))
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: remotePinListMarshaler,
+	},
+	Type: RemotePinList{},
+}
+
+var remotePinRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove pins from a remote pinning service",
+		ShortDescription: `
+Removes the pins of each <key> from the service, whatever their status,
+and lists them.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("key", true, true, "Key(s) of the objects to unpin").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("service", "The name of the pinning service"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		ctx := req.Context().Context
+
+		c, err := remotePinClient(req, n)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		var cids []string
+		for _, a := range req.Arguments() {
+			s := strings.TrimPrefix(a, "/ipfs/")
+			if key.B58KeyDecode(s) == "" {
+				res.SetError(fmt.Errorf("invalid key %q", a), cmds.ErrClient)
+				return
+			}
+			cids = append(cids, s)
+		}
+
+		sts, err := c.Ls(ctx, remote.Filter{Cids: cids})
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		out := &RemotePinList{Pins: []RemotePinObject{}}
+		for i := range sts {
+			if err := c.Rm(ctx, sts[i].RequestID); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			out.Pins = append(out.Pins, remotePinObject(&sts[i]))
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: remotePinListMarshaler,
+	},
+	Type: RemotePinList{},
+}
+
+// remotePinClient returns a client of the service named by the --service
+// option of req, or of the only one registered if it is left out.
+func remotePinClient(req cmds.Request, n *core.IpfsNode) (*remote.Client, error) {
+	services := n.Repo.Config().Pinning.RemoteServices
+	name, found, err := req.Option("service").String()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if len(services) != 1 {
+			return nil, errors.New("pick a pinning service with --service, see 'ipfs pin remote service ls'")
+		}
+		for only := range services {
+			name = only
+		}
+	}
+
+	s, ok := services[name]
+	if !ok {
+		return nil, fmt.Errorf("no pinning service named %q", name)
+	}
+	secret, err := config.ResolveSecret(s.Key)
+	if err != nil {
+		return nil, fmt.Errorf("the key of pinning service %q: %s", name, err)
+	}
+	return remote.NewClient(s.Endpoint, secret), nil
+}
+
+// waitRemotePin asks the service how the pin of st is doing, until it is
+// pinned or failed.
+func waitRemotePin(ctx context.Context, c *remote.Client, st *remote.PinStatus) (*remote.PinStatus, error) {
+	for st.Status != remote.Pinned && st.Status != remote.Failed {
+		select {
+		case <-time.After(remotePinPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		var err error
+		st, err = c.Get(ctx, st.RequestID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// connectDelegates connects n to the peers of the service pinning an
+// object, for them to fetch it from n, if n is online.
+func connectDelegates(n *core.IpfsNode, delegates []string) {
+	if n.PeerHost == nil {
+		return
+	}
+	for _, d := range delegates {
+		a, err := iaddr.ParseString(d)
+		if err != nil {
+			log.Debugf("invalid delegate address %q: %s", d, err)
+			continue
+		}
+		pi := peer.PeerInfo{ID: a.ID(), Addrs: []ma.Multiaddr{a.Transport()}}
+		go func() {
+			if err := n.PeerHost.Connect(n.Context(), pi); err != nil {
+				log.Debugf("connecting to delegate %s: %s", pi.ID, err)
+			}
+		}()
+	}
+}
+
+func remotePinObject(st *remote.PinStatus) RemotePinObject {
+	return RemotePinObject{
+		RequestID: st.RequestID,
+		Status:    st.Status,
+		Key:       st.Pin.Cid,
+		Name:      st.Pin.Name,
+		Info:      st.Info,
+	}
+}
+
+func remotePinListMarshaler(res cmds.Response) (io.Reader, error) {
+	list, ok := res.Output().(*RemotePinList)
+	if !ok {
+		return nil, u.ErrCast()
+	}
+
+	buf := new(bytes.Buffer)
+	for _, p := range list.Pins {
+		fmt.Fprintf(buf, "%s %s", p.Key, p.Status)
+		if p.Name != "" {
+			fmt.Fprintf(buf, " %s", p.Name)
+		}
+		fmt.Fprintln(buf)
+	}
+	return buf, nil
+}
@@ -5,17 +5,15 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
-	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
-
-	key "github.com/ipfs/go-ipfs/blocks/key"
 	cmds "github.com/ipfs/go-ipfs/commands"
-	core "github.com/ipfs/go-ipfs/core"
-	crypto "github.com/ipfs/go-ipfs/p2p/crypto"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	namesys "github.com/ipfs/go-ipfs/namesys"
 	path "github.com/ipfs/go-ipfs/path"
 )
 
-var errNotOnline = errors.New("This command must be run in online mode. Try running 'ipfs daemon' first.")
+var errNotOnline = errors.New("This command must be run in online mode. Try running 'ipfs daemon' first, without --offline.")
 
 var PublishCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
@@ -24,12 +22,23 @@ var PublishCmd = &cmds.Command{
 IPNS is a PKI namespace, where names are the hashes of public keys, and
 the private key enables publishing new (signed) values. In publish, the
 default value of <name> is your own identity public key.
+
+With --key=<key>, the name of another key in the keystore is published
+to instead, see 'ipfs key'; the default key, self, is your identity. The
+record published is valid for the --lifetime given, 24h by default, and
+tells resolvers they may cache it for the --ttl given, if any.
 `,
 		LongDescription: `
 IPNS is a PKI namespace, where names are the hashes of public keys, and
 the private key enables publishing new (signed) values. In publish, the
 default value of <name> is your own identity public key.
 
+With --key=<key>, the name of another key in the keystore is published
+to instead, see 'ipfs key'; the default key, self, is your identity. The
+record published is valid for the --lifetime given, 24h by default, and
+tells resolvers they may cache it for the --ttl given, if any. Durations
+are written like 300s, 1.5h or 2h45m.
+
 Examples:
 
 Publish an <ipfs-path> to your identity name:
@@ -37,18 +46,24 @@ Publish an <ipfs-path> to your identity name:
   > ipfs name publish /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
   Published to QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
 
-Publish an <ipfs-path> to another public key (not implemented):
+Publish an <ipfs-path> to the name of the key mykey, for a week, letting
+resolvers cache it for ten minutes:
 
-  > ipfs name publish /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n
-  Published to QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+  > ipfs name publish --key=mykey --lifetime=168h --ttl=10m /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+  Published to QmSrPmbaUKA3ZodhzPWZnpFgcPMFWF4QsxXbkWfEptTBJd: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
 
 `,
 	},
 
 	Arguments: []cmds.Argument{
-		cmds.StringArg("name", false, false, "The IPNS name to publish to. Defaults to your node's peerID"),
+		cmds.StringArg("name", false, false, "The IPNS name to publish to. Defaults to the name of --key"),
 		cmds.StringArg("ipfs-path", true, false, "IPFS path of the obejct to be published at <name>").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.StringOption("key", "k", "Name of the key to publish with: self (default), or one in the keystore"),
+		cmds.StringOption("lifetime", "t", "How long the record is valid for (default: 24h)"),
+		cmds.StringOption("ttl", "How long resolvers may cache the record for (default: not at all)"),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		log.Debug("Begin Publish")
 		n, err := req.Context().GetNode()
@@ -57,34 +72,43 @@ Publish an <ipfs-path> to another public key (not implemented):
 			return
 		}
 
-		if !n.OnlineMode() {
-			err := n.SetupOfflineRouting()
-			if err != nil {
-				res.SetError(err, cmds.ErrNormal)
+		lifetime := namesys.DefaultRecordLifetime
+		if s, found, _ := req.Option("lifetime").String(); found {
+			lifetime, err = time.ParseDuration(s)
+			if err != nil || lifetime <= 0 {
+				res.SetError(fmt.Errorf("invalid lifetime %q", s), cmds.ErrClient)
 				return
 			}
 		}
 
-		args := req.Arguments()
-
-		if n.Identity == "" {
-			res.SetError(errors.New("Identity not loaded!"), cmds.ErrNormal)
-			return
+		var ttl time.Duration
+		if s, found, _ := req.Option("ttl").String(); found {
+			ttl, err = time.ParseDuration(s)
+			if err != nil || ttl < 0 {
+				res.SetError(fmt.Errorf("invalid ttl %q", s), cmds.ErrClient)
+				return
+			}
 		}
 
-		var name string
+		args := req.Arguments()
+		api := coreapi.NewCoreAPI(n).Name()
+		keyname, _, _ := req.Option("key").String()
+
 		var pstr string
 
 		switch len(args) {
 		case 2:
-			name = args[0]
 			pstr = args[1]
-			if name != n.Identity.Pretty() {
-				res.SetError(errors.New("keychains not yet implemented"), cmds.ErrNormal)
+			name, err := api.KeyName(keyname)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			if args[0] != name {
+				res.SetError(fmt.Errorf("%s is not the name of the key %s: use --key to pick another key", args[0], keyOrSelf(keyname)), cmds.ErrClient)
 				return
 			}
 		case 1:
-			// name = n.Identity.Pretty()
 			pstr = args[0]
 		}
 
@@ -94,14 +118,16 @@ Publish an <ipfs-path> to another public key (not implemented):
 			return
 		}
 
-		// TODO n.Keychain.Get(name).PrivKey
-		// TODO(cryptix): is req.Context().Context a child of n.Context()?
-		output, err := publish(req.Context().Context, n, n.PrivateKey, p)
+		entry, err := api.Publish(req.Context().Context, p, coreapi.PublishOptions{
+			Key:      keyname,
+			Lifetime: lifetime,
+			TTL:      ttl,
+		})
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		res.SetOutput(output)
+		res.SetOutput(&IpnsEntry{Name: entry.Name, Value: entry.Value})
 	},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
@@ -113,25 +139,9 @@ Publish an <ipfs-path> to another public key (not implemented):
 	Type: IpnsEntry{},
 }
 
-func publish(ctx context.Context, n *core.IpfsNode, k crypto.PrivKey, ref path.Path) (*IpnsEntry, error) {
-	// First, verify the path exists
-	_, err := core.Resolve(ctx, n, ref)
-	if err != nil {
-		return nil, err
+func keyOrSelf(name string) string {
+	if name == "" {
+		return coreapi.SelfKeyName
 	}
-
-	err = n.Namesys.Publish(ctx, k, ref)
-	if err != nil {
-		return nil, err
-	}
-
-	hash, err := k.GetPublic().Hash()
-	if err != nil {
-		return nil, err
-	}
-
-	return &IpnsEntry{
-		Name:  key.Key(hash).String(),
-		Value: ref.String(),
-	}, nil
+	return name
 }
@@ -0,0 +1,216 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	floodsub "github.com/ipfs/go-ipfs/p2p/protocol/floodsub"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+var errPubsubDisabled = errors.New("pubsub is experimental and disabled: run the daemon with --enable-pubsub-experiment, or enable it with 'ipfs experiments enable Pubsub'")
+
+// PubsubMessage is a message received on a subscription.
+type PubsubMessage struct {
+	From   string // the peer that published it
+	Data   []byte
+	Topics []string
+}
+
+var PubsubCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "An experimental publish-subscribe system on ipfs",
+		Synopsis: `
+ipfs pubsub pub <topic> <data>... - Publish messages to a topic
+ipfs pubsub sub <topic>           - Print the messages published to a topic
+ipfs pubsub ls                    - List the topics subscribed to
+ipfs pubsub peers <topic>         - List the peers subscribed to a topic
+`,
+		ShortDescription: `
+ipfs pubsub publishes messages to topics, and subscribes to the messages
+of topics, over the peers connected to, which forward the messages to
+the peers they know to subscribe in turn.
+
+This is experimental: the daemon must be started with
+--enable-pubsub-experiment for these commands to work, and peers only
+hear of the messages of the others that run it too.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"pub":   pubsubPubCmd,
+		"sub":   pubsubSubCmd,
+		"ls":    pubsubLsCmd,
+		"peers": pubsubPeersCmd,
+	},
+}
+
+// pubsubNode returns the node, if it runs pubsub.
+func pubsubNode(req cmds.Request) (*core.IpfsNode, error) {
+	n, err := req.Context().GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if !n.OnlineMode() {
+		return nil, errNotOnline
+	}
+	if !n.PubsubEnabled() {
+		return nil, errPubsubDisabled
+	}
+	return n, nil
+}
+
+var pubsubPubCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Publish messages to a topic",
+		ShortDescription: `
+Publishes each <data> given as a message to <topic>, for the peers
+subscribed to it to receive.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("topic", true, false, "The topic to publish to"),
+		cmds.StringArg("data", true, true, "The messages to publish").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := pubsubNode(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		topic := req.Arguments()[0]
+		for _, data := range req.Arguments()[1:] {
+			if err := n.Floodsub.Publish(topic, []byte(data)); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+	},
+}
+
+var pubsubSubCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the messages published to a topic",
+		ShortDescription: `
+Subscribes to <topic>, and prints the messages published to it as they
+come in, until interrupted.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("topic", true, false, "The topic to subscribe to"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := pubsubNode(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		sub, err := n.Floodsub.Subscribe(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		outChan := make(chan interface{})
+		res.SetOutput((<-chan interface{})(outChan))
+
+		go func() {
+			defer close(outChan)
+			defer sub.Cancel()
+
+			ctx := req.Context().Context
+			for {
+				msg, err := sub.Next(ctx)
+				if err != nil {
+					return
+				}
+				select {
+				case outChan <- pubsubMessageOutput(msg):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			outChan, ok := res.Output().(<-chan interface{})
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			marshal := func(v interface{}) (io.Reader, error) {
+				msg, ok := v.(*PubsubMessage)
+				if !ok {
+					return nil, u.ErrCast()
+				}
+				return bytes.NewReader(msg.Data), nil
+			}
+
+			return &cmds.ChannelMarshaler{
+				Channel:   outChan,
+				Marshaler: marshal,
+			}, nil
+		},
+	},
+	Type: PubsubMessage{},
+}
+
+func pubsubMessageOutput(msg *floodsub.Message) *PubsubMessage {
+	return &PubsubMessage{
+		From:   msg.From.Pretty(),
+		Data:   msg.Data,
+		Topics: msg.Topics,
+	}
+}
+
+var pubsubLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the topics subscribed to",
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := pubsubNode(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		res.SetOutput(&stringList{n.Floodsub.GetTopics()})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: stringListMarshaler,
+	},
+	Type: stringList{},
+}
+
+var pubsubPeersCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the peers subscribed to a topic",
+		ShortDescription: `
+Lists the connected peers known to subscribe to <topic>.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("topic", true, false, "The topic to list the subscribers of"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := pubsubNode(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		var peers []string
+		for _, p := range n.Floodsub.ListPeers(req.Arguments()[0]) {
+			peers = append(peers, p.Pretty())
+		}
+		res.SetOutput(&stringList{peers})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: stringListMarshaler,
+	},
+	Type: stringList{},
+}
@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"text/template"
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	cmds "github.com/ipfs/go-ipfs/commands"
 	"github.com/ipfs/go-ipfs/core"
 	dag "github.com/ipfs/go-ipfs/merkledag"
+	traverse "github.com/ipfs/go-ipfs/merkledag/traverse"
 	path "github.com/ipfs/go-ipfs/path"
 	u "github.com/ipfs/go-ipfs/util"
 )
@@ -40,7 +42,15 @@ hashes it contains, with the following format:
 
   <link base58 hash>
 
-Note: list all refs recursively with -r.
+Note: list all refs recursively with -r, down to a depth of <n> links from
+the object with --max-depth=<n>. With -u, each ref is listed once. Refs are
+listed as they're found.
+
+--format takes a Go template, run once per edge, with the fields
+{{.Src}}, {{.Dst}} and {{.LinkName}}. Each field may also be written as
+its lower case name in angle brackets:
+
+  ipfs refs --format="<src> -> <dst> ({{.LinkName}})" <ipfs-path>
 `,
 	},
 	Subcommands: map[string]*cmds.Command{
@@ -50,10 +60,11 @@ Note: list all refs recursively with -r.
 		cmds.StringArg("ipfs-path", true, true, "Path to the object(s) to list refs from").EnableStdin(),
 	},
 	Options: []cmds.Option{
-		cmds.StringOption("format", "Emit edges with given format. tokens: <src> <dst> <linkname>"),
+		cmds.StringOption("format", "Emit edges with given format. fields: <src> <dst> <linkname>"),
 		cmds.BoolOption("edges", "e", "Emit edge format: `<from> -> <to>`"),
 		cmds.BoolOption("unique", "u", "Omit duplicate refs from output"),
 		cmds.BoolOption("recursive", "r", "Recursively list links of child nodes"),
+		cmds.IntOption("max-depth", "Only for recursive refs, list down to a maximum depth of links"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		ctx := req.Context().Context
@@ -75,6 +86,20 @@ Note: list all refs recursively with -r.
 			return
 		}
 
+		maxDepth, found, err := req.Option("max-depth").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		switch {
+		case !recursive:
+			// only the direct refs
+			maxDepth = 1
+		case !found || maxDepth < 0:
+			// no limit
+			maxDepth = -1
+		}
+
 		edges, _, err := req.Option("edges").Bool()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
@@ -87,6 +112,15 @@ Note: list all refs recursively with -r.
 			return
 		}
 
+		var tmpl *template.Template
+		if format != "" {
+			tmpl, err = parseFormat(format, RefEdge{})
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+		}
+
 		objs, err := objectsForPaths(ctx, n, req.Arguments())
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
@@ -105,8 +139,8 @@ Note: list all refs recursively with -r.
 				Ctx:       ctx,
 				Unique:    unique,
 				PrintEdge: edges,
-				PrintFmt:  format,
-				Recursive: recursive,
+				PrintFmt:  tmpl,
+				MaxDepth:  maxDepth,
 			}
 
 			for _, o := range objs {
@@ -151,7 +185,8 @@ var RefsLocalCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Lists all local references",
 		ShortDescription: `
-Displays the hashes of all local objects.
+Displays the hashes of all local objects, as they're read from the
+blockstore, however many there are.
 `,
 	},
 
@@ -163,7 +198,6 @@ Displays the hashes of all local objects.
 			return
 		}
 
-		// todo: make async
 		allKeys, err := n.Blockstore.AllKeysChan(ctx)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
@@ -178,7 +212,8 @@ Displays the hashes of all local objects.
 			for k := range allKeys {
 				s := k.Pretty() + "\n"
 				if _, err := pipew.Write([]byte(s)); err != nil {
-					log.Error("pipe write error: ", err)
+					// the client went away
+					log.Debugf("writing refs: %s", err)
 					return
 				}
 			}
@@ -205,103 +240,81 @@ type RefWrapper struct {
 	Err string
 }
 
+// RefEdge holds the fields available to refs --format.
+type RefEdge struct {
+	Src, Dst, LinkName string
+}
+
 type RefWriter struct {
 	out chan interface{}
 	DAG dag.DAGService
 	Ctx context.Context
 
 	Unique    bool
-	Recursive bool
 	PrintEdge bool
-	PrintFmt  string
+	PrintFmt  *template.Template
 
-	seen map[key.Key]struct{}
+	// MaxDepth is how many links deep to list refs, or -1 for no limit
+	MaxDepth int
+
+	// seen holds the depth refs were listed at, when Unique
+	seen map[key.Key]int
 }
 
 // WriteRefs writes refs of the given object to the underlying writer.
 func (rw *RefWriter) WriteRefs(n *dag.Node) (int, error) {
-	if rw.Recursive {
-		return rw.writeRefsRecursive(n)
-	}
-	return rw.writeRefsSingle(n)
-}
-
-func (rw *RefWriter) writeRefsRecursive(n *dag.Node) (int, error) {
-	nkey, err := n.Key()
-	if err != nil {
-		return 0, err
-	}
-
-	if rw.skip(nkey) {
-		return 0, nil
-	}
-
 	var count int
-	for i, ng := range rw.DAG.GetDAG(rw.Ctx, n) {
-		lk := key.Key(n.Links[i].Hash)
-		if rw.skip(lk) {
-			continue
-		}
-
-		if err := rw.WriteEdge(nkey, lk, n.Links[i].Name); err != nil {
-			return count, err
-		}
-
-		nd, err := ng.Get(rw.Ctx)
-		if err != nil {
-			return count, err
-		}
-
-		c, err := rw.writeRefsRecursive(nd)
-		count += c
-		if err != nil {
-			return count, err
-		}
-	}
-	return count, nil
-}
-
-func (rw *RefWriter) writeRefsSingle(n *dag.Node) (int, error) {
-	nkey, err := n.Key()
-	if err != nil {
-		return 0, err
-	}
-
-	if rw.skip(nkey) {
-		return 0, nil
-	}
-
-	count := 0
-	for _, l := range n.Links {
-		lk := key.Key(l.Hash)
-
-		if rw.skip(lk) {
-			continue
-		}
-
-		if err := rw.WriteEdge(nkey, lk, l.Name); err != nil {
-			return count, err
-		}
-		count++
-	}
-	return count, nil
+	err := traverse.Traverse(n, traverse.Options{
+		DAG:   rw.DAG,
+		Ctx:   rw.Ctx,
+		Order: traverse.DFSPre,
+		// fetch the children of a node ahead, once one is descended into
+		Concurrency: -1,
+		LinkFunc: func(from traverse.State, l *dag.Link) (bool, error) {
+			lk := key.Key(l.Hash)
+			descend, write := rw.visit(lk, from.Depth+1)
+			if write {
+				nkey, err := from.Node.Key()
+				if err != nil {
+					return false, err
+				}
+				if err := rw.WriteEdge(nkey, lk, l.Name); err != nil {
+					return false, err
+				}
+				count++
+			}
+			return descend, nil
+		},
+	})
+	return count, err
 }
 
-// skip returns whether to skip a key
-func (rw *RefWriter) skip(k key.Key) bool {
+// visit returns whether to descend into, and whether to write, the ref k
+// met at depth. Unique refs are written once, but a ref met again less
+// deep than before is descended into again, as its refs may have been cut
+// off by MaxDepth the first time.
+func (rw *RefWriter) visit(k key.Key, depth int) (descend, write bool) {
+	atMax := rw.MaxDepth >= 0 && depth >= rw.MaxDepth
 	if !rw.Unique {
-		return false
+		return !atMax, true
 	}
 
 	if rw.seen == nil {
-		rw.seen = make(map[key.Key]struct{})
+		rw.seen = make(map[key.Key]int)
 	}
 
-	_, found := rw.seen[k]
-	if !found {
-		rw.seen[k] = struct{}{}
+	prev, found := rw.seen[k]
+	switch {
+	case !found:
+		rw.seen[k] = depth
+		return !atMax, true
+	case rw.MaxDepth < 0 || prev <= depth:
+		// everything below was listed already
+		return false, false
+	default:
+		rw.seen[k] = depth
+		return !atMax, false
 	}
-	return found
 }
 
 // Write one edge
@@ -316,11 +329,16 @@ func (rw *RefWriter) WriteEdge(from, to key.Key, linkname string) error {
 
 	var s string
 	switch {
-	case rw.PrintFmt != "":
-		s = rw.PrintFmt
-		s = strings.Replace(s, "<src>", from.Pretty(), -1)
-		s = strings.Replace(s, "<dst>", to.Pretty(), -1)
-		s = strings.Replace(s, "<linkname>", linkname, -1)
+	case rw.PrintFmt != nil:
+		var err error
+		s, err = execFormat(rw.PrintFmt, RefEdge{
+			Src:      from.Pretty(),
+			Dst:      to.Pretty(),
+			LinkName: linkname,
+		})
+		if err != nil {
+			return err
+		}
 	case rw.PrintEdge:
 		s = from.Pretty() + " -> " + to.Pretty()
 	default:
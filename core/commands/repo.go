@@ -2,11 +2,19 @@ package commands
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
+	"time"
 
+	humanize "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/dustin/go-humanize"
 	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -19,7 +27,14 @@ var RepoCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"gc": repoGcCmd,
+		"gc":      repoGcCmd,
+		"stat":    repoStatCmd,
+		"backup":  repoBackupCmd,
+		"restore": RepoRestoreCmd,
+		"convert": RepoConvertCmd,
+		"migrate": RepoMigrateCmd,
+		"verify":  repoVerifyCmd,
+		"fsck":    RepoFsckCmd,
 	},
 }
 
@@ -30,11 +45,34 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+`,
+		LongDescription: `
+'ipfs repo gc' is a plumbing command that will sweep the local
+set of stored objects and remove ones that are not pinned in
+order to reclaim hard disk space.
+
+A sweep can be kept short: --max-duration stops it after a while, such
+as "30s", and --target-free-bytes once it has removed that much, such
+as "500MB". The next sweep picks up the garbage left over.
+
+The daemon collects garbage by itself when Datastore.StorageMax is set
+in the config, such as "10GB": it checks the repo size every
+Datastore.GCPeriodSeconds (an hour by default), and once the repo is
+past Datastore.StorageGCHighWater percent of StorageMax (90 by default),
+collects garbage until it's under Datastore.StorageGCLowWater percent
+(70 by default).
+
+Best-effort pins, of 'ipfs pin add --type=best-effort', keep their
+objects only while space permits: when the blocks which aren't pinned
+fall short of --target-free-bytes, or of what the daemon needs to free,
+the best-effort pins are evicted too, least recently used first.
 `,
 	},
 
 	Options: []cmds.Option{
 		cmds.BoolOption("quiet", "q", "Write minimal output"),
+		cmds.StringOption("max-duration", "Stop the sweep after this long, such as \"30s\""),
+		cmds.StringOption("target-free-bytes", "Stop the sweep once this much is freed, such as \"500MB\""),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.Context().GetNode()
@@ -43,7 +81,29 @@ order to reclaim hard disk space.
 			return
 		}
 
-		gcOutChan, err := corerepo.GarbageCollectAsync(n, req.Context().Context)
+		var budget corerepo.GCBudget
+		if d, found, err := req.Option("max-duration").String(); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		} else if found {
+			budget.MaxDuration, err = time.ParseDuration(d)
+			if err != nil {
+				res.SetError(fmt.Errorf("invalid max duration %q: %s", d, err), cmds.ErrClient)
+				return
+			}
+		}
+		if b, found, err := req.Option("target-free-bytes").String(); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		} else if found {
+			budget.TargetFree, err = humanize.ParseBytes(b)
+			if err != nil {
+				res.SetError(fmt.Errorf("invalid target free bytes %q: %s", b, err), cmds.ErrClient)
+				return
+			}
+		}
+
+		gcOutChan, err := corerepo.GarbageCollectBudget(n, req.Context().Context, budget)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -94,3 +154,538 @@ order to reclaim hard disk space.
 		},
 	},
 }
+
+type RepoStatOutput struct {
+	corerepo.Stat
+	RepoPath string
+	Version  string
+}
+
+var repoStatCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the size of the repo and the number of objects in it",
+		ShortDescription: `
+'ipfs repo stat' shows the number of objects in the local repo, the disk
+space the repo takes, the limit set by Datastore.StorageMax, if any, and
+where the repo is and how it's stored.
+
+The daemon also exports the disk space the repo takes on /debug/vars, as
+fsrepo.<peer id>.usage, and on /debug/metrics/prometheus, as fsrepo_usage.
+`,
+	},
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		stat, err := corerepo.RepoStat(n, req.Context().Context)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&RepoStatOutput{
+			Stat:     *stat,
+			RepoPath: req.Context().ConfigRoot,
+			Version:  "fs-repo@" + fsrepo.RepoVersion,
+		})
+	},
+	Type: RepoStatOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			stat, ok := res.Output().(*RepoStatOutput)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			printRepoStat(buf, stat)
+			return buf, nil
+		},
+	},
+}
+
+func printRepoStat(out io.Writer, stat *RepoStatOutput) {
+	max := "none"
+	if stat.StorageMax > 0 {
+		max = humanize.Bytes(stat.StorageMax)
+	}
+
+	fmt.Fprintf(out, "NumObjects: %d\n", stat.NumObjects)
+	fmt.Fprintf(out, "RepoSize: %s\n", humanize.Bytes(stat.RepoSize))
+	fmt.Fprintf(out, "StorageMax: %s\n", max)
+	fmt.Fprintf(out, "RepoPath: %s\n", stat.RepoPath)
+	fmt.Fprintf(out, "Version: %s\n", stat.Version)
+	fmt.Fprintf(out, "Datastore: %s\n", stat.Datastore)
+}
+
+var errNoPassphrase = errors.New("a passphrase is required, in the file given or on stdin")
+
+// passphraseArg is the argument of the commands encrypting with a
+// passphrase: a file holding it, or stdin, which keeps it out of the
+// process list, the shell history and the URLs of the API.
+func passphraseArg(desc string) cmds.Argument {
+	return cmds.FileArg("passphrase-file", true, false, desc).EnableStdin()
+}
+
+// maxPassphraseSize bounds what is read of the file of a passphrase.
+const maxPassphraseSize = 4096
+
+// readPassphrase returns the passphrase in the next file of req, without
+// the newline ending it.
+func readPassphrase(req cmds.Request) (string, error) {
+	file, err := req.Files().NextFile()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(file, maxPassphraseSize))
+	if err != nil {
+		return "", err
+	}
+	pass := strings.TrimRight(string(b), "\r\n")
+	if pass == "" {
+		return "", errNoPassphrase
+	}
+	return pass, nil
+}
+
+var repoBackupCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Write an encrypted backup bundle of the node",
+		ShortDescription: `
+'ipfs repo backup' writes an encrypted bundle containing the node's config
+(including its identity), keystore, pinset, ipns filesystem root and 'ipfs
+files' root to stdout. Blocks are not included; 'ipfs repo restore' re-fetches
+them by pin. The passphrase is read from the file given, or from stdin.
+
+The S3 credentials and the keys of the remote pinning services written in
+the config are left out; set them again after restoring, or refer to them
+with "env:" or "file:", which are kept.
+
+  > ipfs repo backup passfile > node.backup
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		passphraseArg("The file holding the passphrase to encrypt the bundle with"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		pass, err := readPassphrase(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		b, err := corerepo.NewBackup(n)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		buf := new(bytes.Buffer)
+		if err := corerepo.WriteBackup(buf, b, pass); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(buf)
+	},
+}
+
+// RepoRestoreCmd must run locally: it creates the repo it then uses.
+var RepoRestoreCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Recreate a node from a backup bundle",
+		ShortDescription: `
+'ipfs repo restore' initializes a new repo from a bundle written by
+'ipfs repo backup', then brings the node online and re-pins everything the
+bundle lists, fetching the data from the network. The ipns filesystem
+root is republished under the restored identity, and the 'ipfs files'
+root restored. The passphrase is read from the file given, or from stdin.
+
+Use --no-fetch to only restore the config, identity and keystore.
+
+  > ipfs repo restore node.backup passfile
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.FileArg("bundle", true, false, "The backup bundle to restore"),
+		passphraseArg("The file holding the passphrase the bundle was encrypted with"),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("no-fetch", "Only restore the config, identity and keystore, without re-pinning"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		noFetch, _, err := req.Option("no-fetch").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		file, err := req.Files().NextFile()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer file.Close()
+		pass, err := readPassphrase(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		b, err := corerepo.ReadBackup(file, pass)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		conf, err := config.FromMap(b.Config)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		root := req.Context().ConfigRoot
+		if fsrepo.IsInitialized(root) {
+			res.SetError(fmt.Errorf("a repo already exists at %s", root), cmds.ErrNormal)
+			return
+		}
+		if err := fsrepo.Init(root, conf); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		r, err := fsrepo.Open(root)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if err := corerepo.RestoreKeys(r.Keystore(), b); err != nil {
+			r.Close()
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		outChan := make(chan interface{})
+		res.SetOutput((<-chan interface{})(outChan))
+
+		go func() {
+			defer close(outChan)
+			outChan <- &MessageOutput{fmt.Sprintf("restored identity %s\n", conf.Identity.PeerID)}
+			if len(b.Keys) > 0 {
+				outChan <- &MessageOutput{fmt.Sprintf("restored %d keys\n", len(b.Keys))}
+			}
+			if noFetch {
+				r.Close()
+				return
+			}
+
+			ctx := req.Context().Context
+			n, err := core.NewIPFSNode(ctx, core.Online(r))
+			if err != nil {
+				r.Close()
+				outChan <- &MessageOutput{fmt.Sprintf("error starting node: %s\n", err)}
+				return
+			}
+			defer n.Close()
+
+			for msg := range corerepo.RestorePins(ctx, n, b) {
+				outChan <- &MessageOutput{msg + "\n"}
+			}
+		}()
+	},
+	Type: MessageOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			outChan, ok := res.Output().(<-chan interface{})
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			marshal := func(v interface{}) (io.Reader, error) {
+				obj, ok := v.(*MessageOutput)
+				if !ok {
+					return nil, u.ErrCast()
+				}
+				return bytes.NewBufferString(obj.Message), nil
+			}
+
+			return &cmds.ChannelMarshaler{
+				Channel:   outChan,
+				Marshaler: marshal,
+			}, nil
+		},
+	},
+}
+
+var RepoConvertCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Move the repo's blocks to another datastore backend",
+		ShortDescription: `
+'ipfs repo convert' copies every block of the repo to a datastore of the
+given backend, which then takes the place of the old one, and records
+the new backend as Datastore.BlocksType in the config. The daemon must
+not be running.
+
+  > ipfs repo convert --blocks=leveldb
+`,
+		LongDescription: `
+'ipfs repo convert' copies every block of the repo to a datastore of the
+given backend, which then takes the place of the old one, and records
+the new backend as Datastore.BlocksType in the config. The daemon must
+not be running.
+
+  > ipfs repo convert --blocks=leveldb
+
+The backends built in are flatfs, the default, which keeps each block in
+a file of its own, leveldb, s3, and mem, which keeps blocks in memory and
+can't be converted to or from. badger is not built in; it and other
+backends can be registered by programs embedding ipfs with
+fsrepo.RegisterBackend.
+
+If the config can't be written once the blocks are copied, the old
+datastore is put back, so the repo stays as it was.
+
+s3 keeps blocks in the bucket set in Datastore.S3.blocks in the config,
+which must exist:
+
+  > ipfs config --json Datastore.S3.blocks '{"Bucket": "ipfs", "Prefix": "blocks"}'
+  > ipfs repo convert --blocks=s3
+
+Nodes converted to the same bucket and prefix share their blocks. Their
+copies in the bucket stay there when converting away from s3.
+`,
+	},
+
+	Options: []cmds.Option{
+		cmds.StringOption("blocks", "The backend to keep blocks in"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		to, found, err := req.Option("blocks").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if !found || to == "" {
+			res.SetError(fmt.Errorf("no backend given, use --blocks, one of %v", fsrepo.Backends()), cmds.ErrClient)
+			return
+		}
+
+		count, err := fsrepo.ConvertBlocks(req.Context().ConfigRoot, to)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&MessageOutput{fmt.Sprintf("moved %d blocks to %s\n", count, to)})
+	},
+	Type: MessageOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: MessageTextMarshaler,
+	},
+}
+
+var RepoMigrateCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Migrate the repo to the version of this program",
+		ShortDescription: `
+'ipfs repo migrate' runs the migrations taking the repo from its version
+to the one of this program, or to the one given with --to. It backs up
+the files each migration changes in the backups directory of the repo
+first. The daemon must not be running.
+
+  > ipfs repo migrate
+
+Going back to an older version, to run an older program, works as long
+as the migrations in between can be undone:
+
+  > ipfs repo migrate --to=2
+`,
+	},
+
+	Options: []cmds.Option{
+		cmds.StringOption("to", "The version to migrate the repo to"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		to, found, err := req.Option("to").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if !found || to == "" {
+			to = fsrepo.RepoVersion
+		}
+
+		steps, err := fsrepo.Migrate(req.Context().ConfigRoot, to)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if len(steps) == 0 {
+			res.SetOutput(&MessageOutput{fmt.Sprintf("repo is at version %s already\n", to)})
+			return
+		}
+		res.SetOutput(&MessageOutput{fmt.Sprintf("ran migrations %s, repo is at version %s\n", strings.Join(steps, ", "), to)})
+	},
+	Type: MessageOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: MessageTextMarshaler,
+	},
+}
+
+// RepoVerifyOutput is a corrupt block found by 'ipfs repo verify', or,
+// last, the number of blocks verified and found corrupt.
+type RepoVerifyOutput struct {
+	Key     string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+	Removed bool   `json:",omitempty"`
+
+	Verified int `json:",omitempty"`
+	Corrupt  int `json:",omitempty"`
+}
+
+var repoVerifyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Verify the data of every block in the repo",
+		ShortDescription: `
+'ipfs repo verify' reads every block in the repo, and checks that its
+data hashes to its key. It lists the blocks which don't, as after a disk
+failure, and removes them with --remove, so that they're fetched again
+the next time they're needed.
+`,
+	},
+
+	Options: []cmds.Option{
+		cmds.BoolOption("remove", "Remove the corrupt blocks"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		remove, _, err := req.Option("remove").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		checks, err := corerepo.VerifyBlocks(req.Context().Context, n, remove)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		outChan := make(chan interface{})
+		res.SetOutput((<-chan interface{})(outChan))
+
+		go func() {
+			defer close(outChan)
+			var total RepoVerifyOutput
+			for c := range checks {
+				total.Verified++
+				if c.Err == nil {
+					continue
+				}
+				total.Corrupt++
+				outChan <- &RepoVerifyOutput{Key: c.Key.B58String(), Error: c.Err.Error(), Removed: c.Removed}
+			}
+			outChan <- &total
+		}()
+	},
+	Type: RepoVerifyOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			outChan, ok := res.Output().(<-chan interface{})
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			marshal := func(v interface{}) (io.Reader, error) {
+				obj, ok := v.(*RepoVerifyOutput)
+				if !ok {
+					return nil, u.ErrCast()
+				}
+
+				switch {
+				case obj.Key == "":
+					return strings.NewReader(fmt.Sprintf("verified %d blocks, %d corrupt\n", obj.Verified, obj.Corrupt)), nil
+				case obj.Removed:
+					return strings.NewReader(fmt.Sprintf("removed corrupt block %s: %s\n", obj.Key, obj.Error)), nil
+				default:
+					return strings.NewReader(fmt.Sprintf("corrupt block %s: %s\n", obj.Key, obj.Error)), nil
+				}
+			}
+
+			return &cmds.ChannelMarshaler{
+				Channel:   outChan,
+				Marshaler: marshal,
+			}, nil
+		},
+	},
+}
+
+var RepoFsckCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Check the files of the repo",
+		ShortDescription: `
+'ipfs repo fsck' looks for the files of the repo left in the way, as by
+a crash: a stale lock, which it removes, and files in the flatfs
+directory which aren't blocks it can read, such as writes cut short, or
+blocks in the wrong directory. With --fix, it moves those to the
+.quarantine directory of the blocks directory, to be inspected. The
+daemon must not be running.
+
+Use 'ipfs repo verify' to check the data of the blocks themselves.
+`,
+	},
+
+	Options: []cmds.Option{
+		cmds.BoolOption("fix", "Quarantine the files found in the way"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		fix, _, err := req.Option("fix").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		report, err := fsrepo.Fsck(req.Context().ConfigRoot, fix)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(report)
+	},
+	Type: fsrepo.FsckReport{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			report, ok := res.Output().(*fsrepo.FsckReport)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			if report.StaleLock {
+				fmt.Fprintln(buf, "removed stale repo lock")
+			}
+			for _, f := range report.Incomplete {
+				fmt.Fprintf(buf, "incomplete block write %s\n", f)
+			}
+			for _, f := range report.Orphans {
+				fmt.Fprintf(buf, "orphaned file %s\n", f)
+			}
+			fmt.Fprintf(buf, "found %d files in the way, quarantined %d\n", len(report.Incomplete)+len(report.Orphans), report.Quarantined)
+			return buf, nil
+		},
+	},
+}
@@ -5,7 +5,7 @@ import (
 	"strings"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
-	namesys "github.com/ipfs/go-ipfs/namesys"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
 	path "github.com/ipfs/go-ipfs/path"
 	u "github.com/ipfs/go-ipfs/util"
 )
@@ -16,18 +16,25 @@ type ResolvedPath struct {
 
 var ResolveCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
-		Tagline: "Resolve the value of names to IPFS",
+		Tagline: "Resolve any path to its /ipfs/<hash> form",
 		ShortDescription: `
-There are a number of mutable name protocols that can link among
-themselves and into IPNS.  This command accepts any of these
-identifiers and resolves them to the referenced item.
+'ipfs resolve' resolves /ipns/ and /ipfs/ paths, and bare hashes, to the
+hash of the object they end at: the IPNS name or DNS link a path starts
+from is resolved, and the links of the path are followed, to print
+/ipfs/<hash>. Names are resolved a step only, unless --recursive is set.
 `,
 		LongDescription: `
+'ipfs resolve' resolves /ipns/ and /ipfs/ paths, and bare hashes, to the
+hash of the object they end at: the IPNS name or DNS link a path starts
+from is resolved, and the links of the path are followed, to print
+/ipfs/<hash>.
+
 There are a number of mutable name protocols that can link among
-themselves and into IPNS.  For example IPNS references can (currently)
+themselves and into IPNS. For example IPNS references can (currently)
 point at IPFS object, and DNS links can point at other DNS links, IPNS
-entries, or IPFS objects.  This command accepts any of these
-identifiers and resolves them to the referenced item.
+entries, or IPFS objects. Names are resolved a step only, unless
+--recursive is set: a path into a name pointing to another name
+resolves to a path into the other.
 
 Examples:
 
@@ -46,11 +53,16 @@ Resolve the value of another name recursively:
   > ipfs resolve -r /ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n
   /ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj
 
+Resolve a file in the directory of a DNS link:
+
+  > ipfs resolve -r /ipns/ipfs.io/media/
+  /ipfs/QmcpqNmWbT2BUamRHMmyBtaeDFxwQfeyXvoPmzVaXBxKFm
+
 `,
 	},
 
 	Arguments: []cmds.Argument{
-		cmds.StringArg("name", true, false, "The name to resolve.").EnableStdin(),
+		cmds.StringArg("path", true, false, "The path to resolve, e.g. /ipns/example.com/a").EnableStdin(),
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("recursive", "r", "Resolve until the result is an IPFS name"),
@@ -63,22 +75,10 @@ Resolve the value of another name recursively:
 			return
 		}
 
-		if !n.OnlineMode() {
-			err := n.SetupOfflineRouting()
-			if err != nil {
-				res.SetError(err, cmds.ErrNormal)
-				return
-			}
-		}
-
-		name := req.Arguments()[0]
+		p := req.Arguments()[0]
 		recursive, _, _ := req.Option("recursive").Bool()
-		depth := 1
-		if recursive {
-			depth = namesys.DefaultDepthLimit
-		}
 
-		output, err := n.Namesys.ResolveN(n.Context(), name, depth)
+		output, err := coreapi.NewCoreAPI(n).ResolvePath(req.Context().Context, p, recursive)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -92,7 +92,7 @@ Resolve the value of another name recursively:
 			if !ok {
 				return nil, u.ErrCast()
 			}
-			return strings.NewReader(output.Path.String()), nil
+			return strings.NewReader(output.Path.String() + "\n"), nil
 		},
 	},
 	Type: ResolvedPath{},
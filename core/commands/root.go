@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
+	files "github.com/ipfs/go-ipfs/core/commands/files"
 	unixfs "github.com/ipfs/go-ipfs/core/commands/unixfs"
 	evlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
 )
@@ -37,16 +38,22 @@ DATA STRUCTURE COMMANDS
     block         Interact with raw blocks in the datastore
     object        Interact with raw dag nodes
     file          Interact with Unix filesystem objects
+    files         Manipulate a mutable tree of files
+    tar           Import and export tar archives losslessly
 
 ADVANCED COMMANDS
 
     daemon        Start a long-running daemon process
+    shutdown      Shut down the running daemon
     mount         Mount an ipfs read-only mountpoint
-    resolve       Resolve any type of name
+    resolve       Resolve any path to its /ipfs/<hash> form
     name          Publish or resolve IPNS names
+    key           Create and manage keypairs to publish with
     dns           Resolve DNS links
     pin           Pin objects to local storage
     repo gc       Garbage collect unpinned objects
+    filestore     Manage blocks kept in files outside the repo
+    denylist      Refuse content to the gateway and peers
 
 NETWORK COMMANDS
 
@@ -54,16 +61,25 @@ NETWORK COMMANDS
     bootstrap     Add or remove bootstrap peers
     swarm         Manage connections to the p2p network
     dht           Query the dht for values or peers
+    provide       Announce that you provide blocks
     ping          Measure the latency of a connection
+    pubsub        Send and receive messages over pubsub (experimental)
+    p2p           Forward local sockets over the swarm
     diag          Print diagnostics
 
 TOOL COMMANDS
 
     config        Manage configuration
+    experiments   List and toggle the experimental features
     version       Show ipfs version information
     update        Download and apply go-ipfs updates
     commands      List all available commands
 
+With --offline, commands run on a node of their own, which never touches
+the network: the content and names of the repo are all it knows, and the
+commands which need the network fail at once. 'ipfs daemon --offline'
+serves the API and the gateway that way.
+
 Use 'ipfs <command> --help' to learn more about each command.
 `,
 	},
@@ -73,6 +89,7 @@ Use 'ipfs <command> --help' to learn more about each command.
 		cmds.BoolOption("help", "Show the full command help text"),
 		cmds.BoolOption("h", "Show a short version of the command help text"),
 		cmds.BoolOption("local", "L", "Run the command locally, instead of using the daemon"),
+		cmds.BoolOption("offline", "Run the command without the network: locally on an offline node, or the daemon offline"),
 	},
 }
 
@@ -80,34 +97,45 @@ Use 'ipfs <command> --help' to learn more about each command.
 var CommandsDaemonCmd = CommandsCmd(Root)
 
 var rootSubcommands = map[string]*cmds.Command{
-	"add":       AddCmd,
-	"block":     BlockCmd,
-	"bootstrap": BootstrapCmd,
-	"cat":       CatCmd,
-	"commands":  CommandsDaemonCmd,
-	"config":    ConfigCmd,
-	"dht":       DhtCmd,
-	"diag":      DiagCmd,
-	"dns":       DNSCmd,
-	"get":       GetCmd,
-	"id":        IDCmd,
-	"log":       LogCmd,
-	"ls":        LsCmd,
-	"mount":     MountCmd,
-	"name":      NameCmd,
-	"object":    ObjectCmd,
-	"pin":       PinCmd,
-	"ping":      PingCmd,
-	"refs":      RefsCmd,
-	"repo":      RepoCmd,
-	"resolve":   ResolveCmd,
-	"stats":     StatsCmd,
-	"swarm":     SwarmCmd,
-	"tour":      tourCmd,
-	"file":      unixfs.UnixFSCmd,
-	"update":    UpdateCmd,
-	"version":   VersionCmd,
-	"bitswap":   BitswapCmd,
+	"add":         AddCmd,
+	"block":       BlockCmd,
+	"bootstrap":   BootstrapCmd,
+	"cat":         CatCmd,
+	"commands":    CommandsDaemonCmd,
+	"config":      ConfigCmd,
+	"dag":         DagCmd,
+	"denylist":    DenylistCmd,
+	"dht":         DhtCmd,
+	"diag":        DiagCmd,
+	"dns":         DNSCmd,
+	"experiments": ExperimentsCmd,
+	"filestore":   FilestoreCmd,
+	"get":         GetCmd,
+	"id":          IDCmd,
+	"log":         LogCmd,
+	"key":         KeyCmd,
+	"ls":          LsCmd,
+	"mount":       MountCmd,
+	"name":        NameCmd,
+	"object":      ObjectCmd,
+	"p2p":         P2PCmd,
+	"pin":         PinCmd,
+	"ping":        PingCmd,
+	"provide":     provideRefDhtCmd,
+	"pubsub":      PubsubCmd,
+	"refs":        RefsCmd,
+	"repo":        RepoCmd,
+	"resolve":     ResolveCmd,
+	"shutdown":    ShutdownCmd,
+	"stats":       StatsCmd,
+	"swarm":       SwarmCmd,
+	"tar":         TarCmd,
+	"tour":        tourCmd,
+	"file":        unixfs.UnixFSCmd,
+	"files":       files.FilesCmd,
+	"update":      UpdateCmd,
+	"version":     VersionCmd,
+	"bitswap":     BitswapCmd,
 }
 
 func init() {
@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
+	lockfile "github.com/ipfs/go-ipfs/repo/fsrepo/lock"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+const (
+	// shutdownFlushTimeout bounds how long the daemon waits for the
+	// blocks it got to be provided before closing.
+	shutdownFlushTimeout = 30 * time.Second
+	// shutdownWaitTimeout bounds how long 'ipfs shutdown' waits for the
+	// daemon to release the repo.
+	shutdownWaitTimeout = time.Minute
+)
+
+var ShutdownCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Shut down the daemon",
+		ShortDescription: `
+'ipfs shutdown' stops the running daemon cleanly, as an interrupt does:
+the blocks it got are provided first, then the node, its datastore and
+its listeners are closed, and the repo lock is released. The command
+returns once the daemon has let go of the repo, so another can use it.
+
+Over the API, /api/v0/shutdown takes the admin scope when API.Credentials
+are set.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		if !req.Context().Online {
+			res.SetError(errors.New("ipfs shutdown stops the daemon, and no daemon is running"), cmds.ErrClient)
+			return
+		}
+
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if bs, ok := n.Exchange.(*bitswap.Bitswap); ok {
+			ctx, cancel := context.WithTimeout(req.Context().Context, shutdownFlushTimeout)
+			err := bs.FlushProvides(ctx)
+			cancel()
+			if err != nil {
+				log.Warningf("shutting down without providing all the blocks: %s", err)
+			}
+		}
+
+		// close the node once this request is answered, which ends the
+		// daemon.
+		done := req.Context().Context.Done()
+		go func() {
+			<-done
+			log.Info("shutdown requested, closing the node")
+			if err := n.Close(); err != nil {
+				log.Errorf("closing the node: %s", err)
+			}
+		}()
+
+		res.SetOutput(&MessageOutput{"Shut down the daemon\n"})
+	},
+	PostRun: func(req cmds.Request, res cmds.Response) {
+		if res.Error() != nil {
+			return
+		}
+
+		// the daemon is down once it has released the repo, removing
+		// the lock file as it does. (asking for the lock again and again
+		// would fail: the lock package remembers the failed attempts.)
+		lockPath := path.Join(req.Context().ConfigRoot, lockfile.LockFile)
+		deadline := time.Now().Add(shutdownWaitTimeout)
+		for u.FileExists(lockPath) {
+			if time.Now().After(deadline) {
+				res.SetError(fmt.Errorf("the daemon still holds the repo after %s", shutdownWaitTimeout), cmds.ErrNormal)
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: MessageTextMarshaler,
+	},
+	Type: MessageOutput{},
+}
@@ -5,39 +5,185 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"time"
 
 	humanize "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/dustin/go-humanize"
 
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
 	cmds "github.com/ipfs/go-ipfs/commands"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
+	scheduler "github.com/ipfs/go-ipfs/exchange/scheduler"
 	metrics "github.com/ipfs/go-ipfs/metrics"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
+	path "github.com/ipfs/go-ipfs/path"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+	ipdht "github.com/ipfs/go-ipfs/routing/dht"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
 var StatsCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
-		Tagline:          "Query IPFS statistics",
-		ShortDescription: ``,
+		Tagline: "Query IPFS statistics",
+		Synopsis: `
+ipfs stats bw          - Print the bandwidth used
+ipfs stats repo        - Print the size of the repo
+ipfs stats bitswap     - Print the blocks and data exchanged over bitswap
+ipfs stats dht         - Print the size of the tables of the DHT
+ipfs stats blockstore  - Print how blockstore lookups were answered
+ipfs stats paths       - Print how path resolutions were answered
+ipfs stats fetch       - Print the state of the fetches of blocks
+`,
+		ShortDescription: `
+'ipfs stats' gathers the statistics of the node. Pass --enc=json for
+output to be read by programs. 'ipfs stats bw', 'ipfs stats repo',
+'ipfs stats bitswap' and 'ipfs stats dht' print them again at the
+interval of --interval, a second by default, with --poll.
+`,
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"bw": statBwCmd,
+		"bw":         statBwCmd,
+		"repo":       statRepoCmd,
+		"bitswap":    statBitswapCmd,
+		"dht":        statDhtCmd,
+		"blockstore": statBlockstoreCmd,
+		"paths":      statPathsCmd,
+		"fetch":      statFetchCmd,
 	},
 }
 
+// pollOptionsList are the options of the stats printed again at an
+// interval with --poll.
+var pollOptionsList = []cmds.Option{
+	cmds.BoolOption("poll", "print the stats at an interval"),
+	cmds.StringOption("interval", "i", "time interval to wait between updating output"),
+}
+
+// pollOptions returns whether req asks for the stats at an interval, and
+// the interval.
+func pollOptions(req cmds.Request) (bool, time.Duration, error) {
+	doPoll, _, err := req.Option("poll").Bool()
+	if err != nil {
+		return false, 0, err
+	}
+
+	interval := time.Second
+	timeS, found, err := req.Option("interval").String()
+	if err != nil {
+		return false, 0, err
+	}
+	if found {
+		v, err := time.ParseDuration(timeS)
+		if err != nil {
+			return false, 0, err
+		}
+		if v <= 0 {
+			return false, 0, fmt.Errorf("invalid interval %s, must be positive", timeS)
+		}
+		interval = v
+	}
+	return doPoll, interval, nil
+}
+
+// pollStats sets the output of res to the stats returned by stat: once,
+// or at the interval of the options of req with --poll, until stat fails
+// or the request is canceled.
+func pollStats(req cmds.Request, res cmds.Response, stat func() (interface{}, error)) {
+	doPoll, interval, err := pollOptions(req)
+	if err != nil {
+		res.SetError(err, cmds.ErrClient)
+		return
+	}
+
+	v, err := stat()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
+	out := make(chan interface{})
+	res.SetOutput((<-chan interface{})(out))
+
+	go func() {
+		defer close(out)
+		ctx := req.Context().Context
+		for {
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+			if !doPoll {
+				return
+			}
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return
+			}
+			if v, err = stat(); err != nil {
+				log.Errorf("stats: %s", err)
+				return
+			}
+		}
+	}()
+}
+
+// pollMarshaler returns the text marshaler of the stats of pollStats,
+// which are printed by print, and separated by a blank line with --poll.
+func pollMarshaler(print func(io.Writer, interface{}) error) cmds.Marshaler {
+	return func(res cmds.Response) (io.Reader, error) {
+		outCh, ok := res.Output().(<-chan interface{})
+		if !ok {
+			return nil, u.ErrCast()
+		}
+
+		first := true
+		return &cmds.ChannelMarshaler{
+			Channel: outCh,
+			Marshaler: func(v interface{}) (io.Reader, error) {
+				out := new(bytes.Buffer)
+				if !first {
+					fmt.Fprintln(out)
+				}
+				first = false
+				if err := print(out, v); err != nil {
+					return nil, err
+				}
+				return out, nil
+			},
+		}, nil
+	}
+}
+
+// BandwidthOutput is the output of 'ipfs stats bw'. Peers and Protocols
+// are only set when the bandwidth of every peer or protocol is asked for,
+// and stay null otherwise.
+type BandwidthOutput struct {
+	metrics.Stats
+	Peers     map[string]metrics.Stats
+	Protocols map[string]metrics.Stats
+}
+
 var statBwCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
-		Tagline:          "Print ipfs bandwidth information",
-		ShortDescription: ``,
+		Tagline: "Print ipfs bandwidth information",
+		ShortDescription: `
+Prints the bandwidth used by the streams of the node, in total, for a
+single peer with --peer or a single protocol with --proto. --peers and
+--protos print the bandwidth of every peer or protocol the node has
+talked to, to find which ones use up the most.
+`,
 	},
-	Options: []cmds.Option{
+	Options: append([]cmds.Option{
 		cmds.StringOption("peer", "p", "specify a peer to print bandwidth for"),
 		cmds.StringOption("proto", "t", "specify a protocol to print bandwidth for"),
-		cmds.BoolOption("poll", "print bandwidth at an interval"),
-		cmds.StringOption("interval", "i", "time interval to wait between updating output"),
-	},
+		cmds.BoolOption("peers", "print bandwidth for every peer"),
+		cmds.BoolOption("protos", "print bandwidth for every protocol"),
+	}, pollOptionsList...),
 
 	Run: func(req cmds.Request, res cmds.Response) {
 		nd, err := req.Context().GetNode()
@@ -63,39 +209,42 @@ var statBwCmd = &cmds.Command{
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		if pfound && tfound {
-			res.SetError(errors.New("please only specify peer OR protocol"), cmds.ErrClient)
+		allPeers, _, err := req.Option("peers").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
 			return
 		}
 
-		var pid peer.ID
-		if pfound {
-			checkpid, err := peer.IDB58Decode(pstr)
-			if err != nil {
-				res.SetError(err, cmds.ErrNormal)
-				return
-			}
-			pid = checkpid
-		}
-
-		interval := time.Second
-		timeS, found, err := req.Option("interval").String()
+		allProtos, _, err := req.Option("protos").Bool()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		if found {
-			v, err := time.ParseDuration(timeS)
+
+		n := 0
+		for _, b := range []bool{pfound, tfound, allPeers, allProtos} {
+			if b {
+				n++
+			}
+		}
+		if n > 1 {
+			res.SetError(errors.New("please only specify one of peer, proto, peers OR protos"), cmds.ErrClient)
+			return
+		}
+
+		var pid peer.ID
+		if pfound {
+			checkpid, err := peer.IDB58Decode(pstr)
 			if err != nil {
 				res.SetError(err, cmds.ErrNormal)
 				return
 			}
-			interval = v
+			pid = checkpid
 		}
 
-		doPoll, _, err := req.Option("poll").Bool()
+		doPoll, interval, err := pollOptions(req)
 		if err != nil {
-			res.SetError(err, cmds.ErrNormal)
+			res.SetError(err, cmds.ErrClient)
 			return
 		}
 
@@ -105,16 +254,32 @@ var statBwCmd = &cmds.Command{
 		go func() {
 			defer close(out)
 			for {
-				if pfound {
-					stats := nd.Reporter.GetBandwidthForPeer(pid)
-					out <- &stats
-				} else if tfound {
+				var bw BandwidthOutput
+				switch {
+				case pfound:
+					bw.Stats = nd.Reporter.GetBandwidthForPeer(pid)
+				case tfound:
 					protoId := protocol.ID(tstr)
-					stats := nd.Reporter.GetBandwidthForProtocol(protoId)
-					out <- &stats
-				} else {
-					totals := nd.Reporter.GetBandwidthTotals()
-					out <- &totals
+					bw.Stats = nd.Reporter.GetBandwidthForProtocol(protoId)
+				case allPeers:
+					bw.Stats = nd.Reporter.GetBandwidthTotals()
+					bw.Peers = make(map[string]metrics.Stats)
+					for p, st := range nd.Reporter.GetBandwidthByPeer() {
+						bw.Peers[p.Pretty()] = st
+					}
+				case allProtos:
+					bw.Stats = nd.Reporter.GetBandwidthTotals()
+					bw.Protocols = make(map[string]metrics.Stats)
+					for proto, st := range nd.Reporter.GetBandwidthByProtocol() {
+						bw.Protocols[string(proto)] = st
+					}
+				default:
+					bw.Stats = nd.Reporter.GetBandwidthTotals()
+				}
+				select {
+				case out <- &bw:
+				case <-req.Context().Context.Done():
+					return
 				}
 				if !doPoll {
 					return
@@ -127,7 +292,7 @@ var statBwCmd = &cmds.Command{
 			}
 		}()
 	},
-	Type: metrics.Stats{},
+	Type: BandwidthOutput{},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
 			outCh, ok := res.Output().(<-chan interface{})
@@ -142,12 +307,18 @@ var statBwCmd = &cmds.Command{
 
 			first := true
 			marshal := func(v interface{}) (io.Reader, error) {
-				bs, ok := v.(*metrics.Stats)
+				bw, ok := v.(*BandwidthOutput)
 				if !ok {
 					return nil, u.ErrCast()
 				}
+				bs := &bw.Stats
 				out := new(bytes.Buffer)
-				if !polling {
+				if bw.Peers != nil || bw.Protocols != nil {
+					if polling {
+						fmt.Fprintln(out)
+					}
+					printStatsTable(out, bw)
+				} else if !polling {
 					printStats(out, bs)
 				} else {
 					if first {
@@ -179,3 +350,336 @@ func printStats(out io.Writer, bs *metrics.Stats) {
 	fmt.Fprintf(out, "RateIn: %s/s\n", humanize.Bytes(uint64(bs.RateIn)))
 	fmt.Fprintf(out, "RateOut: %s/s\n", humanize.Bytes(uint64(bs.RateOut)))
 }
+
+// printStatsTable prints a line for each peer or protocol of bw, the
+// biggest users of the uplink first.
+func printStatsTable(out io.Writer, bw *BandwidthOutput) {
+	rows, title := bw.Peers, "Peer"
+	if bw.Protocols != nil {
+		rows, title = bw.Protocols, "Protocol"
+	}
+
+	keys := make([]string, 0, len(rows))
+	for k := range rows {
+		keys = append(keys, k)
+	}
+	sort.Sort(byRateOut{keys, rows})
+
+	fmt.Fprintf(out, "%s\tTotal Up\tTotal Down\tRate Up\tRate Down\n", title)
+	for _, k := range keys {
+		st := rows[k]
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s/s\t%s/s\n", k,
+			humanize.Bytes(uint64(st.TotalOut)),
+			humanize.Bytes(uint64(st.TotalIn)),
+			humanize.Bytes(uint64(st.RateOut)),
+			humanize.Bytes(uint64(st.RateIn)))
+	}
+}
+
+// byRateOut sorts the keys of a bandwidth table by decreasing upload
+// rate, then by total upload.
+type byRateOut struct {
+	keys []string
+	rows map[string]metrics.Stats
+}
+
+func (b byRateOut) Len() int      { return len(b.keys) }
+func (b byRateOut) Swap(i, j int) { b.keys[i], b.keys[j] = b.keys[j], b.keys[i] }
+func (b byRateOut) Less(i, j int) bool {
+	si, sj := b.rows[b.keys[i]], b.rows[b.keys[j]]
+	if si.RateOut != sj.RateOut {
+		return si.RateOut > sj.RateOut
+	}
+	if si.TotalOut != sj.TotalOut {
+		return si.TotalOut > sj.TotalOut
+	}
+	return b.keys[i] < b.keys[j]
+}
+
+var statRepoCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the size of the repo",
+		ShortDescription: `
+Prints the number of objects in the local repo, the disk space it takes
+and the limit set by Datastore.StorageMax, like 'ipfs repo stat'.
+`,
+	},
+	Options: pollOptionsList,
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		pollStats(req, res, func() (interface{}, error) {
+			stat, err := corerepo.RepoStat(n, req.Context().Context)
+			if err != nil {
+				return nil, err
+			}
+			return &RepoStatOutput{
+				Stat:     *stat,
+				RepoPath: req.Context().ConfigRoot,
+				Version:  "fs-repo@" + fsrepo.RepoVersion,
+			}, nil
+		})
+	},
+	Type: RepoStatOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: pollMarshaler(func(out io.Writer, v interface{}) error {
+			stat, ok := v.(*RepoStatOutput)
+			if !ok {
+				return u.ErrCast()
+			}
+			printRepoStat(out, stat)
+			return nil
+		}),
+	},
+}
+
+var statBitswapCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the blocks and data exchanged over bitswap",
+		ShortDescription: `
+Prints the blocks and data received over bitswap, the totals of the
+ledgers kept for the partners of the node, and the depth of the queue of
+the blocks waiting to be provided to the routing system. 'ipfs bitswap
+stat' also lists the wantlist and the partners.
+`,
+	},
+	Options: pollOptionsList,
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !nd.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		bs, ok := nd.Exchange.(*bitswap.Bitswap)
+		if !ok {
+			res.SetError(u.ErrCast(), cmds.ErrNormal)
+			return
+		}
+
+		pollStats(req, res, func() (interface{}, error) {
+			return bs.Stat()
+		})
+	},
+	Type: bitswap.Stat{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: pollMarshaler(func(out io.Writer, v interface{}) error {
+			st, ok := v.(*bitswap.Stat)
+			if !ok {
+				return u.ErrCast()
+			}
+			fmt.Fprintln(out, "Bitswap")
+			fmt.Fprintf(out, "ProvideQueue: %d/%d\n", st.ProvideBufLen, bitswap.HasBlockBufferSize)
+			fmt.Fprintf(out, "BlocksReceived: %d\n", st.BlocksReceived)
+			fmt.Fprintf(out, "DupBlocksReceived: %d\n", st.DupBlksReceived)
+			fmt.Fprintf(out, "DataReceived: %s\n", humanize.Bytes(st.DataReceived))
+			fmt.Fprintf(out, "DupDataReceived: %s\n", humanize.Bytes(st.DupDataReceived))
+			fmt.Fprintf(out, "Wantlist: %d\n", len(st.Wantlist))
+			fmt.Fprintf(out, "Partners: %d\n", len(st.Peers))
+			fmt.Fprintf(out, "LedgerSent: %s\n", humanize.Bytes(st.Ledger.Sent))
+			fmt.Fprintf(out, "LedgerRecv: %s\n", humanize.Bytes(st.Ledger.Recv))
+			fmt.Fprintf(out, "LedgerExchanged: %d\n", st.Ledger.Exchanged)
+			fmt.Fprintf(out, "DebtRatio: %f\n", st.Ledger.Value)
+			return nil
+		}),
+	},
+}
+
+var statDhtCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the size of the tables of the DHT",
+		ShortDescription: `
+Prints the number of peers in the routing table of the DHT, the number
+of keys it knows providers for, and of those the node provides itself.
+`,
+	},
+	Options: pollOptionsList,
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !nd.OnlineMode() {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		dht, ok := nd.Routing.(*ipdht.IpfsDHT)
+		if !ok {
+			res.SetError(ErrNotDHT, cmds.ErrNormal)
+			return
+		}
+
+		pollStats(req, res, func() (interface{}, error) {
+			return dht.Stat(), nil
+		})
+	},
+	Type: ipdht.Stat{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: pollMarshaler(func(out io.Writer, v interface{}) error {
+			st, ok := v.(*ipdht.Stat)
+			if !ok {
+				return u.ErrCast()
+			}
+			fmt.Fprintln(out, "DHT")
+			fmt.Fprintf(out, "RoutingTableSize: %d\n", st.RoutingTableSize)
+			fmt.Fprintf(out, "ProviderKeys: %d\n", st.ProviderKeys)
+			fmt.Fprintf(out, "LocalProviderKeys: %d\n", st.LocalProviderKeys)
+			return nil
+		}),
+	},
+}
+
+var statBlockstoreCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print how blockstore lookups were answered",
+		ShortDescription: `
+Prints how many lookups of blocks the in-memory caches in front of the
+blockstore answered: Hits by the ARC cache, whose size is set by
+Datastore.HasARCCacheSize in the config, and BloomNegatives, blocks
+found missing, by the bloom filter of Datastore.HasBloomFilterSize bytes.
+Misses went to the datastore. The bloom filter is only kept by the
+daemon, and is used once it's filled with every block in the repo.
+`,
+	},
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		c, ok := nd.Blockstore.(bstore.CacheStatser)
+		if !ok {
+			res.SetError(errors.New("the blockstore caches are disabled"), cmds.ErrNormal)
+			return
+		}
+		stats := c.CacheStats()
+		res.SetOutput(&stats)
+	},
+	Type: bstore.CacheStats{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			stats, ok := res.Output().(*bstore.CacheStats)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			out := new(bytes.Buffer)
+			fmt.Fprintln(out, "Blockstore cache")
+			fmt.Fprintf(out, "Hits: %d\n", stats.Hits)
+			fmt.Fprintf(out, "BloomNegatives: %d\n", stats.BloomNegatives)
+			fmt.Fprintf(out, "Misses: %d\n", stats.Misses)
+			fmt.Fprintf(out, "BloomReady: %t\n", stats.BloomReady)
+			return out, nil
+		},
+	},
+}
+
+var statPathsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print how path resolutions were answered",
+		ShortDescription: `
+Prints how many resolutions of paths the cache of the paths resolved
+lately answered, without walking their links: Hits, and how many it
+missed. Datastore.PathCacheSize in the config sets how many paths it
+holds.
+`,
+	},
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if nd.Resolver.Cache == nil {
+			res.SetError(errors.New("the path cache is disabled"), cmds.ErrNormal)
+			return
+		}
+		stats := nd.Resolver.Cache.Stats()
+		res.SetOutput(&stats)
+	},
+	Type: path.CacheStats{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			stats, ok := res.Output().(*path.CacheStats)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			rate := 0.0
+			if total := stats.Hits + stats.Misses; total > 0 {
+				rate = 100 * float64(stats.Hits) / float64(total)
+			}
+			out := new(bytes.Buffer)
+			fmt.Fprintln(out, "Path cache")
+			fmt.Fprintf(out, "Hits: %d\n", stats.Hits)
+			fmt.Fprintf(out, "Misses: %d\n", stats.Misses)
+			fmt.Fprintf(out, "HitRate: %.1f%%\n", rate)
+			fmt.Fprintf(out, "Paths: %d/%d\n", stats.Len, stats.Size)
+			return out, nil
+		},
+	},
+}
+
+var statFetchCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the state of the fetches of blocks",
+		ShortDescription: `
+Prints how many blocks the node is fetching, and how many wait for others
+to be fetched first, as it fetches Bitswap.MaxConcurrentFetches of the
+config at once at most. Commands wanting the same block at the same time,
+like a pin and a get of overlapping DAGs, share one fetch of it:
+Deduplicated is how many fetches were saved that way. A fetch taking
+longer than 30 seconds stops counting towards the limit, for the next
+one to start: Slot timeouts is how many did.
+`,
+	},
+
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if nd.Fetches == nil {
+			res.SetError(errors.New("the node does not fetch blocks"), cmds.ErrNormal)
+			return
+		}
+		stat := nd.Fetches.Stat()
+		res.SetOutput(&stat)
+	},
+	Type: scheduler.Stat{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			stat, ok := res.Output().(*scheduler.Stat)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			out := new(bytes.Buffer)
+			fmt.Fprintln(out, "Block fetches")
+			fmt.Fprintf(out, "Fetching: %d/%d\n", stat.Fetching, stat.MaxFetches)
+			fmt.Fprintf(out, "Queued: %d\n", stat.Queued)
+			fmt.Fprintf(out, "Fetched: %d\n", stat.Fetched)
+			fmt.Fprintf(out, "Deduplicated: %d\n", stat.Deduplicated)
+			fmt.Fprintf(out, "Slot timeouts: %d\n", stat.SlotTimeouts)
+			return out, nil
+		},
+	},
+}
@@ -5,13 +5,24 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"sort"
+	"strings"
+	"time"
 
 	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	inat "github.com/ipfs/go-ipfs/p2p/nat"
+	inet "github.com/ipfs/go-ipfs/p2p/net"
+	filter "github.com/ipfs/go-ipfs/p2p/net/filter"
+	swarm "github.com/ipfs/go-ipfs/p2p/net/swarm"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	relay "github.com/ipfs/go-ipfs/p2p/protocol/relay"
+	u "github.com/ipfs/go-ipfs/util"
 	iaddr "github.com/ipfs/go-ipfs/util/ipfsaddr"
 
 	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	mamask "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/whyrusleeping/multiaddr-filter"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 )
 
@@ -29,8 +40,16 @@ var SwarmCmd = &cmds.Command{
 		Synopsis: `
 ipfs swarm peers                - List peers with open connections
 ipfs swarm addrs                - List known addresses. Useful to debug.
+ipfs swarm addrs listen         - List the addresses the node listens on
+ipfs swarm addrs saved          - List the peers remembered across restarts
 ipfs swarm connect <address>    - Open connection to a given address
 ipfs swarm disconnect <address> - Close connection to a given address
+ipfs swarm filters              - List address filters
+ipfs swarm filters add <filter> - Add an address filter
+ipfs swarm filters rm <filter>  - Remove an address filter
+ipfs swarm connmgr              - Show the state of the connection manager
+ipfs swarm connmgr peers        - List the peers it tracks, with their scores
+ipfs swarm connmgr trim         - Trim the connections now
 `,
 		ShortDescription: `
 ipfs swarm is a tool to manipulate the network swarm. The swarm is the
@@ -43,16 +62,45 @@ ipfs peers in the internet.
 		"addrs":      swarmAddrsCmd,
 		"connect":    swarmConnectCmd,
 		"disconnect": swarmDisconnectCmd,
+		"filters":    swarmFiltersCmd,
+		"connmgr":    swarmConnMgrCmd,
 	},
 }
 
+// swarmPeers is the output of 'ipfs swarm peers': Strings lists the
+// connections, and with --verbose, Peers details them, in the same order.
+type swarmPeers struct {
+	Strings []string
+	Peers   []swarmPeer `json:",omitempty"`
+}
+
+type swarmPeer struct {
+	Addr      string
+	Peer      string
+	Latency   string `json:",omitempty"`
+	Direction string `json:",omitempty"`
+	Transport string
+	Protocols []string
+}
+
 var swarmPeersCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "List peers with open connections",
 		ShortDescription: `
 ipfs swarm peers lists the set of peers this node is connected to.
+With --discovered, the peers found on the local network by mDNS
+(Discovery.MDNS in the config) are marked with "(discovered)".
+
+With --verbose, each connection is followed by the latency of the peer,
+as last measured by the DHT or 'ipfs ping', whether it was dialed
+(outbound) or accepted (inbound), its transport, and the protocols the
+peer said it speaks.
 `,
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption("discovered", "Mark the peers found by local discovery"),
+		cmds.BoolOption("verbose", "v", "Show latency, direction, transport and protocols"),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 
 		log.Debug("ipfs swarm peers")
@@ -67,21 +115,101 @@ ipfs swarm peers lists the set of peers this node is connected to.
 			return
 		}
 
+		discovered, _, err := req.Option("discovered").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		verbose, _, err := req.Option("verbose").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
 		conns := n.PeerHost.Network().Conns()
-		addrs := make([]string, len(conns))
+		out := &swarmPeers{Strings: make([]string, len(conns))}
 		for i, c := range conns {
 			pid := c.RemotePeer()
 			addr := c.RemoteMultiaddr()
-			addrs[i] = fmt.Sprintf("%s/ipfs/%s", addr, pid.Pretty())
+			out.Strings[i] = fmt.Sprintf("%s/ipfs/%s", addr, pid.Pretty())
+			if discovered && n.Discovery != nil && n.Discovery.Discovered(pid) {
+				out.Strings[i] += " (discovered)"
+			}
 		}
+		sort.Sort(byString{out.Strings, conns})
 
-		sort.Sort(sort.StringSlice(addrs))
-		res.SetOutput(&stringList{addrs})
+		if verbose {
+			out.Peers = make([]swarmPeer, len(conns))
+			for i, c := range conns {
+				out.Peers[i] = describePeer(n, c)
+			}
+		}
+		res.SetOutput(out)
 	},
 	Marshalers: cmds.MarshalerMap{
-		cmds.Text: stringListMarshaler,
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			out, ok := res.Output().(*swarmPeers)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for i, s := range out.Strings {
+				fmt.Fprintln(buf, s)
+				if i >= len(out.Peers) {
+					continue
+				}
+				p := out.Peers[i]
+				latency := p.Latency
+				if latency == "" {
+					latency = "n/a"
+				}
+				fmt.Fprintf(buf, "\tlatency: %s, direction: %s, transport: %s\n", latency, p.Direction, p.Transport)
+				if len(p.Protocols) > 0 {
+					fmt.Fprintf(buf, "\tprotocols: %s\n", strings.Join(p.Protocols, " "))
+				}
+			}
+			return buf, nil
+		},
 	},
-	Type: stringList{},
+	Type: swarmPeers{},
+}
+
+// byString sorts conns along with their Strings.
+type byString struct {
+	s     []string
+	conns []inet.Conn
+}
+
+func (b byString) Len() int           { return len(b.s) }
+func (b byString) Less(i, j int) bool { return b.s[i] < b.s[j] }
+func (b byString) Swap(i, j int) {
+	b.s[i], b.s[j] = b.s[j], b.s[i]
+	b.conns[i], b.conns[j] = b.conns[j], b.conns[i]
+}
+
+// describePeer returns the details of c for 'ipfs swarm peers --verbose'.
+func describePeer(n *core.IpfsNode, c inet.Conn) swarmPeer {
+	pid := c.RemotePeer()
+	addr := c.RemoteMultiaddr()
+	p := swarmPeer{
+		Addr:      addr.String(),
+		Peer:      pid.Pretty(),
+		Transport: transportName(addr),
+	}
+	if lat := n.Peerstore.LatencyEWMA(pid); lat > 0 {
+		p.Latency = lat.String()
+	}
+	if sc, ok := c.(*swarm.Conn); ok {
+		p.Direction = "inbound"
+		if sc.Outbound() {
+			p.Direction = "outbound"
+		}
+	}
+	if protos, err := n.Peerstore.Get(pid, "Protocols"); err == nil {
+		p.Protocols, _ = protos.([]string)
+	}
+	return p
 }
 
 var swarmAddrsCmd = &cmds.Command{
@@ -91,6 +219,10 @@ var swarmAddrsCmd = &cmds.Command{
 ipfs swarm addrs lists all addresses this node is aware of.
 `,
 	},
+	Subcommands: map[string]*cmds.Command{
+		"listen": swarmAddrsListenCmd,
+		"saved":  swarmAddrsSavedCmd,
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 
 		n, err := req.Context().GetNode()
@@ -144,6 +276,134 @@ ipfs swarm addrs lists all addresses this node is aware of.
 	Type: addrMap{},
 }
 
+// listenAddrs is the output of 'ipfs swarm addrs listen': Mapped lists the
+// external addresses of the port mappings on the NAT.
+type listenAddrs struct {
+	Listen []string
+	Mapped []string `json:",omitempty"`
+}
+
+var swarmAddrsListenCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the addresses the node listens on",
+		ShortDescription: `
+'ipfs swarm addrs listen' lists the addresses the swarm listens on, on
+each network interface, then the external addresses mapped to them on the
+NAT the node is behind, if any, marked "(nat)".
+
+The listen ports are mapped with UPnP or NAT-PMP unless
+Swarm.DisableNatPortMap is set in the config.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if n.PeerHost == nil {
+			res.SetError(errNotOnline, cmds.ErrClient)
+			return
+		}
+
+		addrs, err := n.PeerHost.Network().InterfaceListenAddresses()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		out := new(listenAddrs)
+		for _, a := range addrs {
+			out.Listen = append(out.Listen, a.String())
+		}
+		sort.Strings(out.Listen)
+
+		if nh, ok := n.PeerHost.(interface {
+			NATMappings() []inat.Mapping
+		}); ok {
+			for _, m := range nh.NATMappings() {
+				ext, err := m.ExternalAddr()
+				if err != nil {
+					continue // not mapped yet
+				}
+				out.Mapped = append(out.Mapped, ext.String())
+			}
+			sort.Strings(out.Mapped)
+		}
+		res.SetOutput(out)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*listenAddrs)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for _, a := range list.Listen {
+				fmt.Fprintln(buf, a)
+			}
+			for _, a := range list.Mapped {
+				fmt.Fprintf(buf, "%s (nat)\n", a)
+			}
+			return buf, nil
+		},
+	},
+	Type: listenAddrs{},
+}
+
+type savedPeers struct {
+	Peers []core.SavedPeer
+}
+
+var swarmAddrsSavedCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the peers remembered across restarts",
+		ShortDescription: `
+'ipfs swarm addrs saved' lists the peers saved in the repo, the most
+recently connected to first, with their addresses and when the node was
+last connected to them. The daemon dials them along with the bootstrap
+peers when it starts.
+
+The peers connected to are saved every 10 minutes and when the daemon
+stops, and remembered for Peerstore.TTL in the config, 24h by default,
+up to Peerstore.MaxPeers of them. A TTL of "0" remembers none.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		saved, err := core.LoadSavedPeers(n.Repo.Datastore())
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&savedPeers{saved})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*savedPeers)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for _, p := range list.Peers {
+				fmt.Fprintf(buf, "%s (%d) last connected %s\n", p.ID, len(p.Addrs), p.LastSeen.Format(time.RFC3339))
+				for _, a := range p.Addrs {
+					fmt.Fprintf(buf, "\t%s\n", a)
+				}
+			}
+			return buf, nil
+		},
+	},
+	Type: savedPeers{},
+}
+
 var swarmConnectCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Open connection to a given address",
@@ -153,11 +413,21 @@ var swarmConnectCmd = &cmds.Command{
 The address format is an ipfs multiaddr:
 
 ipfs swarm connect /ip4/104.131.131.82/tcp/4001/ipfs/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
+
+With --force, any existing connections to the peer are closed and only the
+given address is dialed, so a success proves that transport works end to
+end. With --relay-only, the peer is dialed through the circuit relays
+only, which takes Experiments.Relay. The address and transport that
+carried the connection are reported.
 `,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("address", true, true, "address of peer to connect to").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption("force", "f", "Dial only the given address, closing existing connections first"),
+		cmds.BoolOption("relay-only", "Dial only through circuit relays, closing existing connections first"),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		ctx := context.TODO()
 
@@ -180,15 +450,29 @@ ipfs swarm connect /ip4/104.131.131.82/tcp/4001/ipfs/QmaCpDMGvV2BGHeYERUEnRQAwe3
 			return
 		}
 
+		force, _, _ := req.Option("force").Bool()
+		relayOnly, _, _ := req.Option("relay-only").Bool()
+		if force && relayOnly {
+			res.SetError(errors.New("--force and --relay-only can't be used together"), cmds.ErrClient)
+			return
+		}
+
 		output := make([]string, len(pis))
 		for i, pi := range pis {
 			output[i] = "connect " + pi.ID.Pretty()
 
-			err := n.PeerHost.Connect(ctx, pi)
+			switch {
+			case relayOnly:
+				err = dialOnly(ctx, n, pi.ID, nil)
+			case force:
+				err = dialOnly(ctx, n, pi.ID, pi.Addrs[0])
+			default:
+				err = n.PeerHost.Connect(ctx, pi)
+			}
 			if err != nil {
 				output[i] += " failure: " + err.Error()
 			} else {
-				output[i] += " success"
+				output[i] += " success" + describeConns(n, pi.ID)
 			}
 		}
 
@@ -208,6 +492,10 @@ var swarmDisconnectCmd = &cmds.Command{
 is an ipfs multiaddr:
 
 ipfs swarm disconnect /ip4/104.131.131.82/tcp/4001/ipfs/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
+
+Without a transport address, all the connections to the peer are closed:
+
+ipfs swarm disconnect /ipfs/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -238,6 +526,17 @@ ipfs swarm disconnect /ip4/104.131.131.82/tcp/4001/ipfs/QmaCpDMGvV2BGHeYERUEnRQA
 			taddr := addr.Transport()
 			output[i] = "disconnect " + addr.ID().Pretty()
 
+			if len(taddr.Bytes()) == 0 {
+				if n.PeerHost.Network().Connectedness(addr.ID()) != inet.Connected {
+					output[i] += " failure: not connected"
+				} else if err := n.PeerHost.Network().ClosePeer(addr.ID()); err != nil {
+					output[i] += " failure: " + err.Error()
+				} else {
+					output[i] += " success"
+				}
+				continue
+			}
+
 			found := false
 			conns := n.PeerHost.Network().ConnsToPeer(addr.ID())
 			for _, conn := range conns {
@@ -294,6 +593,76 @@ func parseAddresses(addrs []string) (iaddrs []iaddr.IPFSAddr, err error) {
 	return
 }
 
+var (
+	errRelayOff   = errors.New("circuit relay is off: set Experiments.Relay in the config")
+	errNotRelayed = errors.New("connected directly, not through a relay")
+)
+
+// dialOnly connects to pid over addr and nothing else, or through the
+// circuit relays only if addr is nil. Existing connections to pid are
+// closed first, and the other known addresses are put back once the dial
+// completes, expiring when they would have.
+func dialOnly(ctx context.Context, n *core.IpfsNode, pid peer.ID, addr ma.Multiaddr) error {
+	if addr == nil && n.Relay == nil {
+		return errRelayOff
+	}
+	if err := n.PeerHost.Network().ClosePeer(pid); err != nil {
+		return err
+	}
+
+	ps := n.Peerstore
+	known := ps.AddrTTLs(pid)
+	ps.ClearAddrs(pid)
+	defer func() {
+		for _, a := range known {
+			ps.AddAddr(pid, a.Addr, a.TTL)
+		}
+	}()
+
+	if addr != nil {
+		ps.AddAddr(pid, addr, peer.TempAddrTTL)
+	}
+	if _, err := n.PeerHost.Network().DialPeer(ctx, pid); err != nil {
+		return err
+	}
+	if addr == nil {
+		for _, c := range n.PeerHost.Network().ConnsToPeer(pid) {
+			if !relay.IsRelayed(c) {
+				return errNotRelayed
+			}
+		}
+	}
+	return nil
+}
+
+// describeConns reports the addresses and transports of the open
+// connections to pid, e.g. " via /ip4/1.2.3.4/tcp/4001 (tcp)".
+func describeConns(n *core.IpfsNode, pid peer.ID) string {
+	var out string
+	for _, c := range n.PeerHost.Network().ConnsToPeer(pid) {
+		addr := c.RemoteMultiaddr()
+		out += fmt.Sprintf(" via %s (%s)", addr, transportName(addr))
+	}
+	return out
+}
+
+// transportName names the transport of addr: the protocols that follow
+// the network layer, e.g. "tcp" or "udp/utp".
+func transportName(addr ma.Multiaddr) string {
+	var names []string
+	for _, p := range addr.Protocols() {
+		switch p.Name {
+		case "ip4", "ip6", "ipfs":
+			continue
+		}
+		names = append(names, p.Name)
+	}
+	if len(names) == 0 {
+		return "unknown"
+	}
+	return strings.Join(names, "/")
+}
+
 // peersWithAddresses is a function that takes in a slice of string peer addresses
 // (multiaddr + peerid) and returns a slice of properly constructed peers
 func peersWithAddresses(addrs []string) (pis []peer.PeerInfo, err error) {
@@ -310,3 +679,382 @@ func peersWithAddresses(addrs []string) (pis []peer.PeerInfo, err error) {
 	}
 	return pis, nil
 }
+
+var swarmFiltersCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List address filters",
+		ShortDescription: `
+'ipfs swarm filters' lists the address filters of the swarm. The node
+neither dials the addresses they match, nor accepts connections from
+them. Filters are IPv4 ranges, in the multiaddr format:
+
+  /ip4/192.168.0.0/ipcidr/16
+
+They are kept in the DialBlocklist of the config. Public nodes may keep
+off private networks with:
+
+  ipfs swarm filters add /ip4/10.0.0.0/ipcidr/8 /ip4/172.16.0.0/ipcidr/12 /ip4/192.168.0.0/ipcidr/16
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": swarmFiltersAddCmd,
+		"rm":  swarmFiltersRmCmd,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		_, filters, err := swarmFilters(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		var output []string
+		for _, f := range filters.Filters() {
+			output = append(output, filterString(f))
+		}
+		res.SetOutput(&stringList{output})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: stringListMarshaler,
+	},
+	Type: stringList{},
+}
+
+var swarmFiltersAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add an address filter",
+		ShortDescription: `
+'ipfs swarm filters add' filters the given ranges, and saves them to
+the config. The connections open already stay open.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("filter", true, true, "The range to filter, e.g. /ip4/10.0.0.0/ipcidr/8"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, filters, err := swarmFilters(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		masks, err := parseFilters(req.Arguments())
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		cfg, err := n.Repo.Config().Clone()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		var output []string
+		for _, f := range masks {
+			fs := filterString(f)
+			if !hasFilter(filters.Filters(), f) {
+				filters.AddDialFilter(f)
+			}
+			if !hasString(cfg.DialBlocklist, fs) {
+				cfg.DialBlocklist = append(cfg.DialBlocklist, fs)
+			}
+			output = append(output, fs)
+		}
+		if err := n.Repo.SetConfig(cfg); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&stringList{output})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: stringListMarshaler,
+	},
+	Type: stringList{},
+}
+
+var swarmFiltersRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove an address filter",
+		ShortDescription: `
+'ipfs swarm filters rm' stops filtering the given ranges, and removes
+them from the config.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("filter", true, true, "The filtered range, e.g. /ip4/10.0.0.0/ipcidr/8"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, filters, err := swarmFilters(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+		masks, err := parseFilters(req.Arguments())
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		cfg, err := n.Repo.Config().Clone()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		var output []string
+		for _, f := range masks {
+			fs := filterString(f)
+			removed := filters.Remove(f)
+
+			keep := cfg.DialBlocklist[:0]
+			for _, s := range cfg.DialBlocklist {
+				if m, err := mamask.NewMask(s); err == nil && filterString(m) == fs {
+					removed = true
+					continue
+				}
+				keep = append(keep, s)
+			}
+			cfg.DialBlocklist = keep
+
+			if !removed {
+				res.SetError(fmt.Errorf("%s is not filtered", fs), cmds.ErrNormal)
+				return
+			}
+			output = append(output, fs)
+		}
+		if err := n.Repo.SetConfig(cfg); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&stringList{output})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: stringListMarshaler,
+	},
+	Type: stringList{},
+}
+
+// swarmFilters returns the node, and the address filters of its swarm.
+func swarmFilters(req cmds.Request) (*core.IpfsNode, *filter.Filters, error) {
+	n, err := req.Context().GetNode()
+	if err != nil {
+		return nil, nil, err
+	}
+	if n.PeerHost == nil {
+		return nil, nil, errNotOnline
+	}
+	snet, ok := n.PeerHost.Network().(*swarm.Network)
+	if !ok {
+		return nil, nil, errors.New("the network of this node has no address filters")
+	}
+	return n, snet.Swarm().Filters, nil
+}
+
+func parseFilters(args []string) ([]*net.IPNet, error) {
+	masks := make([]*net.IPNet, len(args))
+	for i, a := range args {
+		m, err := mamask.NewMask(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q, expected e.g. /ip4/10.0.0.0/ipcidr/8", a)
+		}
+		masks[i] = m
+	}
+	return masks, nil
+}
+
+// filterString formats f like the filters of the config.
+func filterString(f *net.IPNet) string {
+	bits, _ := f.Mask.Size()
+	return fmt.Sprintf("/ip4/%s/ipcidr/%d", f.IP, bits)
+}
+
+func hasFilter(fs []*net.IPNet, f *net.IPNet) bool {
+	for _, ft := range fs {
+		if filterString(ft) == filterString(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasString(ss []string, s string) bool {
+	for _, s2 := range ss {
+		if s2 == s {
+			return true
+		}
+	}
+	return false
+}
+
+type connMgrInfo struct {
+	LowWater    int
+	HighWater   int
+	GracePeriod string
+	LastTrim    string
+	Conns       int
+	Peers       int
+	Protected   int
+}
+
+type connMgrPeer struct {
+	ID        string
+	Value     int
+	Tags      map[string]int
+	Protected bool
+}
+
+type connMgrPeers struct {
+	Peers []connMgrPeer
+}
+
+var swarmConnMgrCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the state of the connection manager",
+		ShortDescription: `
+'ipfs swarm connmgr' shows the limits of the connection manager, and the
+connections it tracks. Once the node has more connections than the high
+water mark, the manager closes those of the least useful peers, until
+the node is down to the low water mark. Peers are scored by the tags the
+services put on them: bitswap tags the peers it recently got blocks
+from, and the DHT those of its routing table. Peers connected for less
+than the grace period, and those of ConnMgr.Protected in the config, are
+never trimmed. A high water mark of 0 disables trimming.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"peers": swarmConnMgrPeersCmd,
+		"trim":  swarmConnMgrTrimCmd,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := onlineNode(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		info := n.PeerHost.ConnManager().GetInfo()
+		last := "never"
+		if !info.LastTrim.IsZero() {
+			last = info.LastTrim.Format(time.RFC3339)
+		}
+		res.SetOutput(&connMgrInfo{
+			LowWater:    info.LowWater,
+			HighWater:   info.HighWater,
+			GracePeriod: info.GracePeriod.String(),
+			LastTrim:    last,
+			Conns:       len(n.PeerHost.Network().Conns()),
+			Peers:       info.Peers,
+			Protected:   info.Protected,
+		})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			info, ok := res.Output().(*connMgrInfo)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "Low water: %d\n", info.LowWater)
+			fmt.Fprintf(buf, "High water: %d\n", info.HighWater)
+			fmt.Fprintf(buf, "Grace period: %s\n", info.GracePeriod)
+			fmt.Fprintf(buf, "Last trim: %s\n", info.LastTrim)
+			fmt.Fprintf(buf, "Connections: %d\n", info.Conns)
+			fmt.Fprintf(buf, "Peers tracked: %d\n", info.Peers)
+			fmt.Fprintf(buf, "Peers protected: %d\n", info.Protected)
+			return buf, nil
+		},
+	},
+	Type: connMgrInfo{},
+}
+
+var swarmConnMgrPeersCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the peers tracked by the connection manager",
+		ShortDescription: `
+'ipfs swarm connmgr peers' lists the peers tracked by the connection
+manager, by descending score, with their tags. The peers with the lowest
+scores are trimmed first.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := onlineNode(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		var output []connMgrPeer
+		for _, ti := range n.PeerHost.ConnManager().Peers() {
+			output = append(output, connMgrPeer{
+				ID:        ti.ID.Pretty(),
+				Value:     ti.Value,
+				Tags:      ti.Tags,
+				Protected: ti.Protected,
+			})
+		}
+		res.SetOutput(&connMgrPeers{output})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*connMgrPeers)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for _, p := range list.Peers {
+				tags := make([]string, 0, len(p.Tags))
+				for t, v := range p.Tags {
+					tags = append(tags, fmt.Sprintf("%s=%d", t, v))
+				}
+				sort.Strings(tags)
+				if p.Protected {
+					tags = append(tags, "protected")
+				}
+				fmt.Fprintf(buf, "%s %d %s\n", p.ID, p.Value, strings.Join(tags, ","))
+			}
+			return buf, nil
+		},
+	},
+	Type: connMgrPeers{},
+}
+
+var swarmConnMgrTrimCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Trim the connections down to the low water mark",
+		ShortDescription: `
+'ipfs swarm connmgr trim' closes the connections of the least useful
+peers now, until the node is down to the low water mark, if trimming is
+enabled.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := onlineNode(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
+
+		network := n.PeerHost.Network()
+		before := len(network.Conns())
+		n.PeerHost.ConnManager().TrimOpenConns(network)
+		after := len(network.Conns())
+		res.SetOutput(&stringList{[]string{
+			fmt.Sprintf("closed %d connections, %d left", before-after, after),
+		}})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: stringListMarshaler,
+	},
+	Type: stringList{},
+}
+
+// onlineNode returns the node of req, if it is online.
+func onlineNode(req cmds.Request) (*core.IpfsNode, error) {
+	n, err := req.Context().GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if n.PeerHost == nil {
+		return nil, errNotOnline
+	}
+	return n, nil
+}
@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	core "github.com/ipfs/go-ipfs/core"
+	bhost "github.com/ipfs/go-ipfs/p2p/host/basic"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	relay "github.com/ipfs/go-ipfs/p2p/protocol/relay"
+	testutil "github.com/ipfs/go-ipfs/p2p/test/util"
+)
+
+// nodeOnHost returns a node whose network is that of h.
+func nodeOnHost(t *testing.T, ctx context.Context, h *bhost.BasicHost) *core.IpfsNode {
+	n, err := core.NewNodeBuilder().Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Identity = h.ID()
+	n.Peerstore = h.Peerstore()
+	n.PeerHost = h
+	return n
+}
+
+// expectTTL fails unless a, among the addresses of p, expires in about ttl.
+func expectTTL(t *testing.T, ps peer.Peerstore, p peer.ID, a ma.Multiaddr, ttl time.Duration) {
+	for _, at := range ps.AddrTTLs(p) {
+		if !at.Addr.Equal(a) {
+			continue
+		}
+		if at.TTL > ttl || at.TTL < ttl-time.Minute {
+			t.Fatalf("expected %s to expire in %s, got %s", a, ttl, at.TTL)
+		}
+		return
+	}
+	t.Fatalf("expected %s among the addresses of the peer", a)
+}
+
+func TestDialOnlyKeepsTTLs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := testutil.GenHostSwarm(t, ctx)
+	dst := testutil.GenHostSwarm(t, ctx)
+	n := nodeOnHost(t, ctx, src)
+
+	other := ma.StringCast("/ip4/127.0.0.1/tcp/1")
+	src.Peerstore().AddAddr(dst.ID(), other, time.Hour)
+	src.Peerstore().AddAddr(dst.ID(), dst.Addrs()[0], peer.PermanentAddrTTL)
+
+	if err := dialOnly(ctx, n, dst.ID(), dst.Addrs()[0]); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range src.Network().ConnsToPeer(dst.ID()) {
+		if !c.RemoteMultiaddr().Equal(dst.Addrs()[0]) {
+			t.Fatalf("expected a conn over %s only, got one over %s", dst.Addrs()[0], c.RemoteMultiaddr())
+		}
+	}
+	expectTTL(t, src.Peerstore(), dst.ID(), other, time.Hour)
+	expectTTL(t, src.Peerstore(), dst.ID(), dst.Addrs()[0], peer.PermanentAddrTTL)
+}
+
+func TestDialOnlyRelays(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := testutil.GenHostSwarm(t, ctx)
+	r := testutil.GenHostSwarm(t, ctx)
+	dst := testutil.GenHostSwarm(t, ctx)
+	n := nodeOnHost(t, ctx, src)
+
+	if err := dialOnly(ctx, n, dst.ID(), nil); err != errRelayOff {
+		t.Fatalf("expected relaying to be off, got %v", err)
+	}
+
+	srcc, err := relay.NewCircuit(ctx, src, relay.CircuitOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Relay = srcc
+	if _, err := relay.NewCircuit(ctx, dst, relay.CircuitOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := relay.NewCircuit(ctx, r, relay.CircuitOpts{Hop: true}); err != nil {
+		t.Fatal(err)
+	}
+	rpi := r.Peerstore().PeerInfo(r.ID())
+	if err := src.Connect(ctx, rpi); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Connect(ctx, rpi); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; len(srcc.Relays()) == 0; i++ {
+		if i == 50 {
+			t.Fatal("the relay was never found")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// connected directly, and knowing the address of dst, src still goes
+	// through the relay
+	src.Peerstore().AddAddr(dst.ID(), dst.Addrs()[0], time.Hour)
+	if err := src.Connect(ctx, dst.Peerstore().PeerInfo(dst.ID())); err != nil {
+		t.Fatal(err)
+	}
+	var ttl time.Duration
+	for _, at := range src.Peerstore().AddrTTLs(dst.ID()) {
+		if at.Addr.Equal(dst.Addrs()[0]) {
+			ttl = at.TTL
+		}
+	}
+	if err := dialOnly(ctx, n, dst.ID(), nil); err != nil {
+		t.Fatal(err)
+	}
+	conns := src.Network().ConnsToPeer(dst.ID())
+	if len(conns) != 1 || !relay.IsRelayed(conns[0]) {
+		t.Fatalf("expected a relayed conn to dst only, got %v", conns)
+	}
+	expectTTL(t, src.Peerstore(), dst.ID(), dst.Addrs()[0], ttl)
+}
@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"io"
+	"strings"
+
+	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	path "github.com/ipfs/go-ipfs/path"
+	utar "github.com/ipfs/go-ipfs/unixfs/tar"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+var TarCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Import and export tar archives losslessly",
+		ShortDescription: `
+'ipfs tar add' stores a tar archive as a DAG that keeps every header of
+the archive as it was, and 'ipfs tar cat' writes the archive back out,
+byte for byte. Unlike 'ipfs add' of an unpacked archive, nothing about
+the entries (owners, modes, timestamps, PAX records) is lost.
+`,
+		Synopsis: `
+ipfs tar add <file>    - Import a tar archive
+ipfs tar cat <path>    - Export a tar archive imported with 'ipfs tar add'
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": tarAddCmd,
+		"cat": tarCatCmd,
+	},
+}
+
+var tarAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Import a tar archive into ipfs",
+		ShortDescription: `
+Imports the tar archive <file>, or the archive read from stdin, and
+prints the hash of the resulting object, which is pinned. The contents
+of the files in the archive are stored as unixfs files, so they are
+shared with identical files added with 'ipfs add'. Compressed archives
+must be decompressed first.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.FileArg("file", true, false, "tar file to import").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		// gc waits for the archive imported to be pinned
+		defer n.GCLocker.PinLock()()
+
+		fi, err := req.Files().NextFile()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer fi.Close()
+
+		root, err := utar.ImportTar(fi, n.DAG)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		k, err := root.Key()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if err := n.Pinning.Pin(req.Context().Context, root, true); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if err := n.Pinning.Flush(); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&AddedObject{
+			Name: fi.FileName(),
+			Hash: k.B58String(),
+		})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			o, ok := res.Output().(*AddedObject)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			return strings.NewReader(o.Hash + "\n"), nil
+		},
+	},
+	Type: AddedObject{},
+}
+
+var tarCatCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Export a tar archive from ipfs",
+		ShortDescription: `
+Outputs the tar archive stored at <path> by 'ipfs tar add', identical to
+the archive that was imported.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, false, "ipfs path of the archive to export"),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.Context().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		root, err := core.Resolve(req.Context().Context, n, path.Path(req.Arguments()[0]))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		r, err := utar.ExportTar(req.Context().Context, root, n.DAG)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(r)
+	},
+}
@@ -14,6 +14,7 @@ import (
 	core "github.com/ipfs/go-ipfs/core"
 	path "github.com/ipfs/go-ipfs/path"
 	unixfs "github.com/ipfs/go-ipfs/unixfs"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
 	unixfspb "github.com/ipfs/go-ipfs/unixfs/pb"
 )
 
@@ -23,11 +24,18 @@ type LsLink struct {
 	Type       string
 }
 
+// LsBlock is a block of a file, with the size of the file data under it.
+type LsBlock struct {
+	Hash string
+	Size uint64
+}
+
 type LsObject struct {
-	Hash  string
-	Size  uint64
-	Type  string
-	Links []LsLink
+	Hash   string
+	Size   uint64
+	Type   string
+	Links  []LsLink
+	Blocks []LsBlock `json:",omitempty"`
 }
 
 type LsOutput struct {
@@ -46,12 +54,21 @@ contents with the following format:
 
 For files, the child size is the total size of the file contents.  For
 directories, the child size is the IPFS link size.
+
+With --blocks, files are listed with their size and the blocks their data
+is split into, with the size of the data under each, in the order of the
+file. They are read from the root of the file alone, without fetching the
+blocks, which makes them a cheap way to plan downloads. Data held in the
+root itself counts in the size of the file, but is in no block.
 `,
 	},
 
 	Arguments: []cmds.Argument{
 		cmds.StringArg("ipfs-path", true, true, "The path to the IPFS object(s) to list links from").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption("blocks", "b", "List the blocks of files, with their sizes"),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		node, err := req.Context().GetNode()
 		if err != nil {
@@ -60,6 +77,7 @@ directories, the child size is the IPFS link size.
 		}
 
 		paths := req.Arguments()
+		blocks, _, _ := req.Option("blocks").Bool()
 
 		output := LsOutput{
 			Arguments: map[string]string{},
@@ -107,11 +125,30 @@ directories, the child size is the IPFS link size.
 				res.SetError(fmt.Errorf("unrecognized type: %s", t), cmds.ErrImplementation)
 				return
 			case unixfspb.Data_File:
-				break
-			case unixfspb.Data_Directory:
-				links := make([]LsLink, len(merkleNode.Links))
+				if !blocks {
+					break
+				}
+				// the sizes are those of the children, in the order of
+				// the links.
+				sizes := unixFSNode.GetBlocksizes()
+				if len(sizes) != len(merkleNode.Links) {
+					res.SetError(unixfs.ErrMalformedFileFormat, cmds.ErrNormal)
+					return
+				}
+				fileBlocks := make([]LsBlock, len(sizes))
+				for i, l := range merkleNode.Links {
+					fileBlocks[i] = LsBlock{Hash: l.Hash.B58String(), Size: sizes[i]}
+				}
+				output.Objects[hash].Blocks = fileBlocks
+			case unixfspb.Data_Directory, unixfspb.Data_HAMTShard:
+				dirLinks, err := uio.DirLinks(ctx, merkleNode, node.DAG)
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+				links := make([]LsLink, len(dirLinks))
 				output.Objects[hash].Links = links
-				for i, link := range merkleNode.Links {
+				for i, link := range dirLinks {
 					getCtx, cancel := context.WithTimeout(ctx, time.Minute)
 					defer cancel()
 					link.Node, err = link.GetNode(getCtx, node.DAG)
@@ -157,7 +194,7 @@ directories, the child size is the IPFS link size.
 					return nil, fmt.Errorf("unresolved hash: %s", hash)
 				}
 
-				if object.Type == "Directory" {
+				if object.Type == "Directory" || object.Type == "HAMTShard" {
 					directories = append(directories, argument)
 				} else {
 					nonDirectories = append(nonDirectories, argument)
@@ -166,8 +203,20 @@ directories, the child size is the IPFS link size.
 			sort.Strings(nonDirectories)
 			sort.Strings(directories)
 
-			for _, argument := range nonDirectories {
-				fmt.Fprintf(w, "%s\n", argument)
+			blocks, _, _ := res.Request().Option("blocks").Bool()
+			for i, argument := range nonDirectories {
+				if !blocks {
+					fmt.Fprintf(w, "%s\n", argument)
+					continue
+				}
+				object := output.Objects[output.Arguments[argument]]
+				if i > 0 {
+					fmt.Fprintln(w)
+				}
+				fmt.Fprintf(w, "%s: %d bytes, %d blocks\n", argument, object.Size, len(object.Blocks))
+				for _, b := range object.Blocks {
+					fmt.Fprintf(w, "%s\t%d\n", b.Hash, b.Size)
+				}
 			}
 
 			seen := map[string]bool{}
@@ -1,31 +1,107 @@
 package commands
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"runtime"
 	"strings"
+	"time"
 
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	cmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	path "github.com/ipfs/go-ipfs/path"
 	config "github.com/ipfs/go-ipfs/repo/config"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+	"github.com/ipfs/go-ipfs/updates"
 )
 
+// versionCheckTimeout bounds the lookup of the distribution.
+const versionCheckTimeout = time.Minute
+
 type VersionOutput struct {
-	Version string
+	Version      string
+	Commit       string   `json:",omitempty"`
+	Repo         string   `json:",omitempty"`
+	System       string   `json:",omitempty"`
+	Golang       string   `json:",omitempty"`
+	Experimental []string `json:",omitempty"`
+
+	// Update is the newer release --check found, if any.
+	Update *updates.Release `json:",omitempty"`
 }
 
 var VersionCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline:          "Shows ipfs version information",
 		ShortDescription: "Returns the current version of ipfs and exits.",
+		LongDescription: `
+Returns the current version of ipfs and exits.
+
+With --all, also reports the commit the binary was built from, the repo
+version it uses, the OS/arch and Go version, and the experiments enabled
+in the config, of those 'ipfs experiments' lists. Use --enc=json for a
+machine-readable object suitable for bug reports and inventories.
+
+With --check, looks for a newer release in the distribution on ipfs the
+Version.DistPath config key names, and reports the path and hash of its
+binary for this platform. The release must be signed with the key
+Version.DistPubKey names, or the one built in; without either, the check
+fails, unless Version.AllowUnverified is set, in which case the release
+is reported without its signature having been checked. Nothing is
+downloaded or installed: fetching the binary and swapping it in is left
+to other tools. Over the API, this is /api/v0/version?check=true.
+`,
 	},
 
 	Options: []cmds.Option{
 		cmds.BoolOption("number", "n", "Only show the version number"),
+		cmds.BoolOption("all", "Show build and runtime details"),
+		cmds.BoolOption("check", "Check the distribution for a newer release"),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		res.SetOutput(&VersionOutput{
+		out := &VersionOutput{
 			Version: config.CurrentVersionNumber,
-		})
+		}
+
+		all, _, err := req.Option("all").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if all {
+			out.Commit = config.CurrentCommit
+			out.Repo = fsrepo.RepoVersion
+			out.System = runtime.GOARCH + "/" + runtime.GOOS
+			out.Golang = runtime.Version()
+
+			// version must work before init, so a missing config is fine.
+			if cfg, err := fsrepo.ConfigAt(req.Context().ConfigRoot); err == nil {
+				out.Experimental = experimentalFeatures(cfg)
+			}
+		}
+
+		check, _, err := req.Option("check").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if check {
+			rel, err := checkDist(req)
+			switch err {
+			case nil:
+				out.Update = rel
+			case updates.ErrNoUpdateAvailable:
+			default:
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+		res.SetOutput(out)
 	},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
@@ -38,8 +114,98 @@ var VersionCmd = &cmds.Command{
 			if found && number {
 				return strings.NewReader(fmt.Sprintln(v.Version)), nil
 			}
+
+			check, _, err := res.Request().Option("check").Bool()
+			if err != nil {
+				return nil, err
+			}
+			if check {
+				if v.Update == nil {
+					return strings.NewReader(fmt.Sprintf("ipfs version %s is up to date\n", v.Version)), nil
+				}
+				buf := new(bytes.Buffer)
+				fmt.Fprintf(buf, "A new version of ipfs is available: %s (running %s)\n", v.Update.Version, v.Version)
+				fmt.Fprintf(buf, "Binary: %s (%s)\n", v.Update.Path, v.Update.Hash)
+				if v.Update.Verified {
+					fmt.Fprintln(buf, "Its signature matches the key of the distribution.")
+				} else {
+					fmt.Fprintln(buf, "WARNING: its signature was NOT checked, as there is no key for the distribution")
+					fmt.Fprintln(buf, "and Version.AllowUnverified is set. Do not install it unless you trust where it came from.")
+				}
+				return buf, nil
+			}
+
+			all, _, err := res.Request().Option("all").Bool()
+			if err != nil {
+				return nil, err
+			}
+			if all {
+				experimental := "none"
+				if len(v.Experimental) > 0 {
+					experimental = strings.Join(v.Experimental, ", ")
+				}
+				commit := v.Commit
+				if commit == "" {
+					commit = "unknown"
+				}
+
+				buf := new(bytes.Buffer)
+				fmt.Fprintf(buf, "go-ipfs version: %s\n", v.Version)
+				fmt.Fprintf(buf, "Commit: %s\n", commit)
+				fmt.Fprintf(buf, "Repo version: %s\n", v.Repo)
+				fmt.Fprintf(buf, "System version: %s\n", v.System)
+				fmt.Fprintf(buf, "Golang version: %s\n", v.Golang)
+				fmt.Fprintf(buf, "Experimental: %s\n", experimental)
+				return buf, nil
+			}
 			return strings.NewReader(fmt.Sprintf("ipfs version %s\n", v.Version)), nil
 		},
 	},
 	Type: VersionOutput{},
 }
+
+// experimentalFeatures lists the experiments enabled in cfg, by the name
+// of the config key that enables them.
+func experimentalFeatures(cfg *config.Config) []string {
+	var features []string
+	for _, x := range config.ExperimentList {
+		if x.Enabled(&cfg.Experiments) {
+			features = append(features, x.Key())
+		}
+	}
+	return features
+}
+
+// checkDist looks for a newer release in the distribution the config
+// names, read through the node.
+func checkDist(req cmds.Request) (*updates.Release, error) {
+	n, err := req.Context().GetNode()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := req.Context().GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context().Context, versionCheckTimeout)
+	defer cancel()
+	return updates.CheckDist(ctx, nodeDist{n}, cfg.Version)
+}
+
+// nodeDist reads a distribution through an ipfs node.
+type nodeDist struct {
+	n *core.IpfsNode
+}
+
+func (d nodeDist) Cat(ctx context.Context, p string) (io.Reader, error) {
+	nd, err := core.Resolve(ctx, d.n, path.Path(p))
+	if err != nil {
+		return nil, err
+	}
+	return uio.NewDagReader(ctx, nd, d.n.DAG)
+}
+
+func (d nodeDist) Resolve(ctx context.Context, p string) (key.Key, error) {
+	return core.ResolveToKey(ctx, d.n, path.Path(p))
+}
@@ -10,12 +10,15 @@ interfaces and how core/... fits into the bigger IPFS picture, see:
 package core
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"time"
 
+	cmetrics "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/codahale/metrics"
+	humanize "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/dustin/go-humanize"
 	b58 "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-base58"
 	ctxgroup "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-ctxgroup"
 	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
@@ -29,9 +32,16 @@ import (
 	p2phost "github.com/ipfs/go-ipfs/p2p/host"
 	p2pbhost "github.com/ipfs/go-ipfs/p2p/host/basic"
 	rhost "github.com/ipfs/go-ipfs/p2p/host/routed"
+	connmgr "github.com/ipfs/go-ipfs/p2p/net/connmgr"
+	pnet "github.com/ipfs/go-ipfs/p2p/net/pnet"
 	swarm "github.com/ipfs/go-ipfs/p2p/net/swarm"
 	addrutil "github.com/ipfs/go-ipfs/p2p/net/swarm/addr"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	autonat "github.com/ipfs/go-ipfs/p2p/protocol/autonat"
+	floodsub "github.com/ipfs/go-ipfs/p2p/protocol/floodsub"
+	ping "github.com/ipfs/go-ipfs/p2p/protocol/ping"
+	relay "github.com/ipfs/go-ipfs/p2p/protocol/relay"
+	tunnel "github.com/ipfs/go-ipfs/p2p/tunnel"
 	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
 
 	routing "github.com/ipfs/go-ipfs/routing"
@@ -40,15 +50,21 @@ import (
 	offroute "github.com/ipfs/go-ipfs/routing/offline"
 
 	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	bserv "github.com/ipfs/go-ipfs/blockservice"
+	denylist "github.com/ipfs/go-ipfs/denylist"
 	exchange "github.com/ipfs/go-ipfs/exchange"
 	bitswap "github.com/ipfs/go-ipfs/exchange/bitswap"
 	bsnet "github.com/ipfs/go-ipfs/exchange/bitswap/network"
+	httpfallback "github.com/ipfs/go-ipfs/exchange/httpfallback"
 	offline "github.com/ipfs/go-ipfs/exchange/offline"
 	rp "github.com/ipfs/go-ipfs/exchange/reprovide"
+	scheduler "github.com/ipfs/go-ipfs/exchange/scheduler"
+	filestore "github.com/ipfs/go-ipfs/filestore"
 
 	mount "github.com/ipfs/go-ipfs/fuse/mount"
 	ipnsfs "github.com/ipfs/go-ipfs/ipnsfs"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	merkledag "github.com/ipfs/go-ipfs/merkledag"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	path "github.com/ipfs/go-ipfs/path"
@@ -82,15 +98,20 @@ type IpfsNode struct {
 
 	// Local node
 	Pinning    pin.Pinner // the pinning manager
+	PinQueue   *pin.Queue // background pins, when online
 	Mounts     Mounts     // current mount state, if any.
 	PrivateKey ic.PrivKey // the local node's private Key
 
 	// Services
 	Peerstore  peer.Peerstore       // storage for other Peer instances
 	Blockstore bstore.Blockstore    // the block store (lower level)
+	GCLocker   bstore.GCLocker      // gc and the pins of new blocks wait on each other
+	Filestore  *filestore.Filestore // leaves kept in files outside the repo
 	Blocks     *bserv.BlockService  // the block service, get/add blocks.
+	Fetches    *scheduler.Scheduler // the fetches of the block service
 	DAG        merkledag.DAGService // the merkle dag service, get/add objects.
 	Resolver   *path.Resolver       // the path resolution system
+	Denylist   *denylist.Denylist   // content refused to the gateway and peers
 	Reporter   metrics.Reporter
 	Discovery  discovery.Service
 
@@ -101,13 +122,31 @@ type IpfsNode struct {
 	Exchange     exchange.Interface  // the block exchange + strategy (bitswap)
 	Namesys      namesys.NameSystem  // the name system, resolves paths to hashes
 	Diagnostics  *diag.Diagnostics   // the diagnostics service
+	Ping         *ping.PingService   // the ping service
 	Reprovider   *rp.Reprovider      // the value reprovider system
+	Floodsub     *floodsub.PubSub    // the pubsub service, if enabled
+	Tunnels      *tunnel.Tunnels     // local sockets forwarded over the swarm
+	Relay        *relay.Circuit      // circuits to peers behind NATs, through relays
+	AutoNAT      *autonat.AutoNAT    // reachability of the node, from peers dialing it back
+	PNetKey      *pnet.PSK           // key of the private network, if limited to one
 
-	IpnsFs *ipnsfs.Filesystem
+	IpnsFs    *ipnsfs.Filesystem
+	FilesRoot *ipnsfs.Root // the tree behind 'ipfs files'
 
 	ctxgroup.ContextGroup
 
 	mode mode
+
+	// pubsub has the node run floodsub, for 'ipfs pubsub'
+	pubsub bool
+	// namesysPubsub has IPNS records published and followed over floodsub
+	namesysPubsub bool
+	// identityName is the key of the keystore the node runs as, if not the
+	// identity of the config
+	identityName string
+
+	// peerMemory saves the peers connected to in the repo, when online
+	peerMemory *peerMemory
 }
 
 // Mounts defines what the node's mount state is. This should
@@ -141,7 +180,7 @@ func NewIPFSNode(parent context.Context, option ConfigOption) (*IpfsNode, error)
 	// to be initialized at this point, and 2) which variables will be
 	// initialized after this point.
 
-	node.Blocks, err = bserv.New(node.Blockstore, node.Exchange)
+	node.Blocks, err = bserv.New(node.Blockstore, node.blockExchange())
 	if err != nil {
 		return nil, err
 	}
@@ -153,7 +192,29 @@ func NewIPFSNode(parent context.Context, option ConfigOption) (*IpfsNode, error)
 	if err != nil {
 		node.Pinning = pin.NewPinner(node.Repo.Datastore(), node.DAG)
 	}
-	node.Resolver = &path.Resolver{DAG: node.DAG}
+	// the pins of the node built last, as a process runs one but in tests.
+	pinning := node.Pinning
+	cmetrics.Gauge("pin.Recursive").SetFunc(func() int64 { return int64(len(pinning.RecursiveKeys())) })
+	cmetrics.Gauge("pin.Direct").SetFunc(func() int64 { return int64(len(pinning.DirectKeys())) })
+	pathCache, err := newPathCache(node.Repo.Config())
+	if err != nil {
+		return nil, err
+	}
+	node.Resolver = &path.Resolver{DAG: node.DAG, Cache: pathCache}
+	if pathCache != nil {
+		cmetrics.Gauge("path.CacheHits").SetFunc(func() int64 { return int64(pathCache.Stats().Hits) })
+		cmetrics.Gauge("path.CacheMisses").SetFunc(func() int64 { return int64(pathCache.Stats().Misses) })
+	}
+	if node.OnlineMode() {
+		node.PinQueue = pin.NewQueue(ctx, node.Pinning, node.DAG, pin.QueueOptions{})
+		if err := node.startReprovider(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := node.setupFilesRoot(ctx); err != nil {
+		return nil, err
+	}
 
 	// Setup the mutable ipns filesystem structure
 	if node.OnlineMode() {
@@ -168,12 +229,33 @@ func NewIPFSNode(parent context.Context, option ConfigOption) (*IpfsNode, error)
 	return node, nil
 }
 
+// blockExchange returns the exchange the block service should fetch through:
+// the node's exchange, backed by HTTP block providers when the node is
+// online and some are configured, behind n.Fetches which fetches each
+// block once for the commands wanting it at the same time. n.Exchange
+// itself is left unwrapped so callers can still reach bitswap directly.
+func (n *IpfsNode) blockExchange() exchange.Interface {
+	ex := n.Exchange
+	maxFetches := 0
+	if n.Repo != nil {
+		cfg := n.Repo.Config()
+		bp := cfg.BlockProviders
+		if n.OnlineMode() && len(bp.URLs) > 0 {
+			delay := time.Duration(bp.FallbackDelaySeconds) * time.Second
+			ex = httpfallback.WithFallback(ex, httpfallback.NewFetcher(bp.URLs), delay)
+		}
+		maxFetches = cfg.Bitswap.MaxConcurrentFetches
+	}
+	n.Fetches = scheduler.New(ex, scheduler.Options{MaxFetches: maxFetches})
+	return n.Fetches
+}
+
 func Offline(r repo.Repo) ConfigOption {
 	return Standard(r, false)
 }
 
 func OnlineWithOptions(r repo.Repo, router RoutingOption, ho HostOption) ConfigOption {
-	return standardWithRouting(r, true, router, ho)
+	return standardWithRouting(r, true, router, ho, false, false, "")
 }
 
 func Online(r repo.Repo) ConfigOption {
@@ -182,11 +264,11 @@ func Online(r repo.Repo) ConfigOption {
 
 // DEPRECATED: use Online, Offline functions
 func Standard(r repo.Repo, online bool) ConfigOption {
-	return standardWithRouting(r, online, DHTOption, DefaultHostOption)
+	return standardWithRouting(r, online, DHTOption, DefaultHostOption, false, false, "")
 }
 
 // TODO refactor so maybeRouter isn't special-cased in this way
-func standardWithRouting(r repo.Repo, online bool, routingOption RoutingOption, hostOption HostOption) ConfigOption {
+func standardWithRouting(r repo.Repo, online bool, routingOption RoutingOption, hostOption HostOption, pubsub, namesysPubsub bool, identityName string) ConfigOption {
 	return func(ctx context.Context) (n *IpfsNode, err error) {
 		// FIXME perform node construction in the main constructor so it isn't
 		// necessary to perform this teardown in this scope.
@@ -211,7 +293,10 @@ func standardWithRouting(r repo.Repo, online bool, routingOption RoutingOption,
 				}
 				return offlineMode
 			}(),
-			Repo: r,
+			Repo:          r,
+			pubsub:        pubsub,
+			namesysPubsub: namesysPubsub,
+			identityName:  identityName,
 		}
 
 		// setup Peerstore
@@ -222,7 +307,15 @@ func standardWithRouting(r repo.Repo, online bool, routingOption RoutingOption,
 			return nil, err
 		}
 
-		n.Blockstore, err = bstore.WriteCached(bstore.NewBlockstore(n.Repo.Datastore()), kSizeBlockstoreWriteCache)
+		n.Filestore = filestore.New(n.Repo.Datastore())
+		bs := filestore.NewBlockstore(bstore.NewBlockstore(n.Repo.Datastore()), n.Filestore)
+		wbs, err := bstore.WriteCached(bs, kSizeBlockstoreWriteCache)
+		if err != nil {
+			return nil, err
+		}
+		n.Blockstore = bstore.CachedBlockstore(ctx, wbs, cacheOpts(n.Repo.Config(), online))
+
+		n.Denylist, err = loadDenylist(n.Repo.Config().Denylist)
 		if err != nil {
 			return nil, err
 		}
@@ -261,12 +354,29 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 	for _, s := range cfg.DialBlocklist {
 		f, err := mamask.NewMask(s)
 		if err != nil {
-			return fmt.Errorf("incorrectly formatter address filter in config: %s", s)
+			return fmt.Errorf("incorrectly formatted address filter in config: %s", s)
 		}
 		addrfilter = append(addrfilter, f)
 	}
 
-	peerhost, err := hostOption(ctx, n.Identity, n.Peerstore, n.Reporter, addrfilter)
+	cmgr, err := constructConnMgr(cfg.ConnMgr)
+	if err != nil {
+		return err
+	}
+
+	// get the key of the private network, if there is one
+	swarmkey, err := n.Repo.SwarmKey()
+	if err != nil {
+		return err
+	}
+	if swarmkey != nil {
+		n.PNetKey, err = pnet.DecodeV1PSK(bytes.NewReader(swarmkey))
+		if err != nil {
+			return err
+		}
+	}
+
+	peerhost, err := hostOption(ctx, n.Identity, n.Peerstore, n.Reporter, addrfilter, cmgr, n.PNetKey, cfg.Experiments.Utp, !cfg.Swarm.DisableNatPortMap)
 	if err != nil {
 		return err
 	}
@@ -280,8 +390,11 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 		return err
 	}
 
-	n.Reprovider = rp.NewReprovider(n.Routing, n.Blockstore)
-	go n.Reprovider.ProvideEvery(ctx, kReprovideFrequency)
+	// the peers remembered from before are dialed along with the
+	// bootstrap peers.
+	if err := n.startPeerMemory(ctx); err != nil {
+		return err
+	}
 
 	// setup local discovery
 	if do != nil {
@@ -297,6 +410,38 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 	return n.Bootstrap(DefaultBootstrapConfig)
 }
 
+// cacheOpts returns the blockstore caches cfg asks for. The bloom filter is
+// only kept by online nodes, as filling it lists every block in the repo.
+func cacheOpts(cfg *config.Config, online bool) bstore.CacheOpts {
+	opts := bstore.DefaultCacheOpts()
+	if cfg == nil {
+		return opts
+	}
+	if size := cfg.Datastore.HasARCCacheSize; size != 0 {
+		opts.HasARCCacheSize = size
+	}
+	if size := cfg.Datastore.HasBloomFilterSize; size != 0 {
+		opts.HasBloomFilterSize = size
+	}
+	if !online {
+		opts.HasBloomFilterSize = 0
+	}
+	return opts
+}
+
+// newPathCache returns the cache of the paths resolved cfg asks for, or
+// nil if it's disabled.
+func newPathCache(cfg *config.Config) (*path.Cache, error) {
+	size := path.DefaultCacheSize
+	if cfg != nil && cfg.Datastore.PathCacheSize != 0 {
+		size = cfg.Datastore.PathCacheSize
+	}
+	if size < 0 {
+		return nil, nil
+	}
+	return path.NewCache(size)
+}
+
 func setupDiscoveryOption(d config.Discovery) DiscoveryOption {
 	if d.MDNS.Enabled {
 		return func(h p2phost.Host) (discovery.Service, error) {
@@ -310,7 +455,7 @@ func setupDiscoveryOption(d config.Discovery) DiscoveryOption {
 }
 
 func (n *IpfsNode) HandlePeerFound(p peer.PeerInfo) {
-	log.Warning("trying peer info: ", p)
+	log.Debug("trying peer info: ", p)
 	ctx, _ := context.WithTimeout(context.TODO(), time.Second*10)
 	err := n.PeerHost.Connect(ctx, p)
 	if err != nil {
@@ -334,13 +479,66 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, host p2phost
 	// Wrap standard peer host with routing system to allow unknown peer lookups
 	n.PeerHost = rhost.Wrap(host, n.Routing)
 
+	// setup ping service
+	n.Ping = ping.NewPingService(n.PeerHost)
+
+	// setup circuit relay, on the swarm networks it works with
+	if _, ok := host.Network().(*swarm.Network); ok {
+		if cfg := n.Repo.Config(); cfg.Experiments.Relay {
+			n.Relay, err = relay.NewCircuit(ctx, host, relay.CircuitOpts{
+				Hop:                cfg.Relay.Hop,
+				PreferDirect:       cfg.Relay.PreferDirect,
+				MaxCircuits:        cfg.Relay.MaxCircuits,
+				MaxCircuitsPerPeer: cfg.Relay.MaxCircuitsPerPeer,
+				BandwidthLimit:     cfg.Relay.BandwidthLimit,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		// setup reachability detection, which stops the addresses peers
+		// can't dial back from being advertised
+		n.AutoNAT, err = autonat.NewAutoNAT(ctx, host)
+		if err != nil {
+			return err
+		}
+	}
+
 	// setup exchange service
 	const alwaysSendToPeer = true // use YesManStrategy
 	bitswapNetwork := bsnet.NewFromIpfsHost(n.PeerHost, n.Routing)
-	n.Exchange = bitswap.New(ctx, n.Identity, bitswapNetwork, n.Blockstore, alwaysSendToPeer)
+	bs := bitswap.New(ctx, n.Identity, bitswapNetwork, n.Blockstore, alwaysSendToPeer).(*bitswap.Bitswap)
+	limits, err := serveLimits(n.Repo.Config().Bitswap)
+	if err != nil {
+		return err
+	}
+	bs.SetServeLimits(limits)
+	if n.Repo.Config().Denylist.Bitswap {
+		bs.SetServeFilter(func(p peer.ID, k key.Key) bool {
+			entry, denied := n.Denylist.DeniedKey(k)
+			if denied {
+				n.Denylist.Audit(k.B58String(), entry, "bitswap "+p.Pretty())
+			}
+			return !denied
+		})
+	}
+	n.Exchange = bs
+
+	// setup the forwarding of local sockets
+	n.Tunnels = tunnel.New(ctx, n.PeerHost)
+
+	// setup pubsub service
+	if n.pubsub || n.namesysPubsub {
+		n.Floodsub = floodsub.NewPubSub(ctx, n.PeerHost)
+	}
 
 	// setup name system
-	n.Namesys = namesys.NewNameSystem(n.Routing)
+	if n.namesysPubsub {
+		n.Namesys = namesys.NewPubsubNameSystem(ctx, n.Routing, n.Repo.Datastore(), n.Floodsub)
+	} else {
+		n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore())
+	}
 
 	return nil
 }
@@ -349,6 +547,12 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, host p2phost
 // the first error.
 func (n *IpfsNode) teardown() error {
 	log.Debug("core is shutting down...")
+	if n.peerMemory != nil {
+		if err := n.peerMemory.save(); err != nil {
+			log.Errorf("saving the peerstore: %s", err)
+		}
+	}
+
 	// owned objects are closed in this teardown to ensure that they're closed
 	// regardless of which constructor was used to add them to the node.
 	closers := []io.Closer{
@@ -370,6 +574,10 @@ func (n *IpfsNode) teardown() error {
 		closers = append(closers, n.Bootstrapper)
 	}
 
+	if n.Discovery != nil {
+		closers = append(closers, n.Discovery)
+	}
+
 	if dht, ok := n.Routing.(*dht.IpfsDHT); ok {
 		closers = append(closers, dht)
 	}
@@ -399,6 +607,12 @@ func (n *IpfsNode) OnlineMode() bool {
 	}
 }
 
+// PubsubEnabled returns whether the node runs pubsub for 'ipfs pubsub',
+// and not only to publish IPNS records over it.
+func (n *IpfsNode) PubsubEnabled() bool {
+	return n.pubsub && n.Floodsub != nil
+}
+
 func (n *IpfsNode) Bootstrap(cfg BootstrapConfig) error {
 
 	// TODO what should return value be when in offlineMode?
@@ -417,7 +631,9 @@ func (n *IpfsNode) Bootstrap(cfg BootstrapConfig) error {
 			ps, err := n.loadBootstrapPeers()
 			if err != nil {
 				log.Warningf("failed to parse bootstrap peers from config: %s", n.Repo.Config().Bootstrap)
-				return nil
+			}
+			if n.peerMemory != nil {
+				ps = append(ps, n.peerMemory.bootstrapPeers()...)
 			}
 			return ps
 		}
@@ -433,6 +649,15 @@ func (n *IpfsNode) loadID() error {
 		return errors.New("identity already loaded")
 	}
 
+	if n.identityName != "" {
+		sk, err := n.keystoreIdentity()
+		if err != nil {
+			return err
+		}
+		n.Identity, err = peer.IDFromPrivateKey(sk)
+		return err
+	}
+
 	cid := n.Repo.Config().Identity.PeerID
 	if cid == "" {
 		return errors.New("Identity was not set in config (was ipfs init run?)")
@@ -454,7 +679,13 @@ func (n *IpfsNode) LoadPrivateKey() error {
 		return errors.New("private key already loaded")
 	}
 
-	sk, err := loadPrivateKey(&n.Repo.Config().Identity, n.Identity)
+	var sk ic.PrivKey
+	var err error
+	if n.identityName != "" {
+		sk, err = n.keystoreIdentity()
+	} else {
+		sk, err = loadPrivateKey(&n.Repo.Config().Identity, n.Identity)
+	}
 	if err != nil {
 		return err
 	}
@@ -465,8 +696,15 @@ func (n *IpfsNode) LoadPrivateKey() error {
 	return nil
 }
 
+// BootstrapList returns the addresses of the peers the node bootstraps
+// with: those of its private network, if it is limited to one which has
+// a list in config.PrivateBootstrap, or else config.Bootstrap.
+func (n *IpfsNode) BootstrapList() []string {
+	return n.Repo.Config().BootstrapList(pnetFingerprint(n.PNetKey))
+}
+
 func (n *IpfsNode) loadBootstrapPeers() ([]peer.PeerInfo, error) {
-	parsed, err := n.Repo.Config().BootstrapPeers()
+	parsed, err := config.ParseBootstrapPeers(n.BootstrapList())
 	if err != nil {
 		return nil, err
 	}
@@ -477,18 +715,32 @@ func (n *IpfsNode) loadBootstrapPeers() ([]peer.PeerInfo, error) {
 // uses it to instantiate a routing system in offline mode.
 // This is primarily used for offline ipns modifications.
 func (n *IpfsNode) SetupOfflineRouting() error {
-	err := n.LoadPrivateKey()
-	if err != nil {
-		return err
+	if n.PrivateKey == nil {
+		if err := n.LoadPrivateKey(); err != nil {
+			return err
+		}
 	}
 
 	n.Routing = offroute.NewOfflineRouter(n.Repo.Datastore(), n.PrivateKey)
 
-	n.Namesys = namesys.NewNameSystem(n.Routing)
+	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore())
 
 	return nil
 }
 
+// keystoreIdentity returns the key of the keystore the node runs as.
+func (n *IpfsNode) keystoreIdentity() (ic.PrivKey, error) {
+	ks := n.Repo.Keystore()
+	if ks == nil {
+		return nil, errors.New("this node has no keystore to take its identity from")
+	}
+	sk, err := ks.Get(n.identityName)
+	if err == keystore.ErrNoSuchKey {
+		return nil, fmt.Errorf("no key named %q in the keystore to run as", n.identityName)
+	}
+	return sk, err
+}
+
 func loadPrivateKey(cfg *config.Identity, id peer.ID) (ic.PrivKey, error) {
 	sk, err := cfg.DecodePrivateKey("passphrase todo!")
 	if err != nil {
@@ -520,24 +772,164 @@ func listenAddresses(cfg *config.Config) ([]ma.Multiaddr, error) {
 	return listen, nil
 }
 
-type HostOption func(ctx context.Context, id peer.ID, ps peer.Peerstore, bwr metrics.Reporter, fs []*net.IPNet) (p2phost.Host, error)
+type HostOption func(ctx context.Context, id peer.ID, ps peer.Peerstore, bwr metrics.Reporter, fs []*net.IPNet, cmgr *connmgr.ConnManager, psk *pnet.PSK, utp, natPortMap bool) (p2phost.Host, error)
 
 var DefaultHostOption HostOption = constructPeerHost
 
 // isolates the complex initialization steps
-func constructPeerHost(ctx context.Context, id peer.ID, ps peer.Peerstore, bwr metrics.Reporter, fs []*net.IPNet) (p2phost.Host, error) {
+func constructPeerHost(ctx context.Context, id peer.ID, ps peer.Peerstore, bwr metrics.Reporter, fs []*net.IPNet, cmgr *connmgr.ConnManager, psk *pnet.PSK, utp, natPortMap bool) (p2phost.Host, error) {
 
 	// no addresses to begin with. we'll start later.
-	network, err := swarm.NewNetwork(ctx, nil, id, ps, bwr)
+	network, err := swarm.NewNetwork(ctx, nil, id, ps, bwr, psk, utp)
 	if err != nil {
 		return nil, err
 	}
 
-	host := p2pbhost.New(network, p2pbhost.NATPortMap, bwr)
+	for _, f := range fs {
+		network.Swarm().Filters.AddDialFilter(f)
+	}
+
+	opts := []interface{}{bwr, cmgr}
+	if natPortMap {
+		opts = append(opts, p2pbhost.NATPortMap)
+	}
+	host := p2pbhost.New(network, opts...)
 
 	return host, nil
 }
 
+// startReprovider starts reproviding the blocks picked by the strategy of
+// the config, every interval of it.
+func (n *IpfsNode) startReprovider(ctx context.Context) error {
+	cfg := n.Repo.Config().Reprovider
+
+	interval, err := reprovideInterval(cfg)
+	if err != nil {
+		return err
+	}
+
+	keyProvider, err := rp.NewStrategyProvider(cfg.Strategy, n.Blockstore, n.Pinning)
+	if err != nil {
+		return fmt.Errorf("config.Reprovider.Strategy %q: %s", cfg.Strategy, err)
+	}
+
+	n.Reprovider = rp.NewReprovider(n.Routing, keyProvider)
+	go n.Reprovider.ProvideEvery(ctx, interval)
+	return nil
+}
+
+// reprovideInterval returns the interval of reproviding configured by cfg.
+func reprovideInterval(cfg config.Reprovider) (time.Duration, error) {
+	if cfg.Interval == "" {
+		return kReprovideFrequency, nil
+	}
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("incorrectly formatted duration in config.Reprovider.Interval: %s", cfg.Interval)
+	}
+	return interval, nil
+}
+
+// serveLimits returns the bitswap serving limits configured by cfg.
+func serveLimits(cfg config.Bitswap) (bitswap.ServeLimits, error) {
+	var l bitswap.ServeLimits
+	if cfg.MaxServeRate != "" {
+		rate, err := humanize.ParseBytes(cfg.MaxServeRate)
+		if err != nil {
+			return l, fmt.Errorf("invalid Bitswap.MaxServeRate %q: %s", cfg.MaxServeRate, err)
+		}
+		l.Rate = rate
+	}
+	if cfg.BusyServeRate != "" {
+		rate, err := humanize.ParseBytes(cfg.BusyServeRate)
+		if err != nil {
+			return l, fmt.Errorf("invalid Bitswap.BusyServeRate %q: %s", cfg.BusyServeRate, err)
+		}
+		l.BusyRate = rate
+	}
+	return l, nil
+}
+
+// loadDenylist returns the denylist of the entries of cfg, and of its file.
+func loadDenylist(cfg config.Denylist) (*denylist.Denylist, error) {
+	entries := cfg.Entries
+	if cfg.File != "" {
+		more, err := denylist.ReadFile(cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("reading Denylist.File: %s", err)
+		}
+		entries = append(append([]string(nil), entries...), more...)
+	}
+	return denylist.New(entries...)
+}
+
+// constructConnMgr returns the connection manager configured by cfg.
+func constructConnMgr(cfg config.ConnMgr) (*connmgr.ConnManager, error) {
+	cmgr := connmgr.New(0, 0, 0)
+	if err := configureConnMgr(cmgr, cfg); err != nil {
+		return nil, err
+	}
+	return cmgr, nil
+}
+
+// configureConnMgr sets the limits and protected peers of cmgr to those
+// of cfg.
+func configureConnMgr(cmgr *connmgr.ConnManager, cfg config.ConnMgr) error {
+	var grace time.Duration
+	if cfg.GracePeriod != "" {
+		var err error
+		grace, err = time.ParseDuration(cfg.GracePeriod)
+		if err != nil {
+			return fmt.Errorf("incorrectly formatted duration in config.ConnMgr.GracePeriod: %s", cfg.GracePeriod)
+		}
+	}
+
+	protected := make([]peer.ID, 0, len(cfg.Protected))
+	for _, s := range cfg.Protected {
+		p, err := peer.IDB58Decode(s)
+		if err != nil {
+			return fmt.Errorf("incorrect peer ID in config.ConnMgr.Protected: %s", s)
+		}
+		protected = append(protected, p)
+	}
+
+	cmgr.SetLimits(cfg.LowWater, cfg.HighWater, grace)
+	cmgr.SetProtected("config", protected)
+	return nil
+}
+
+// ReloadConfig applies the config of the repo, as it is now, to the parts
+// of the running node which can change: the limits of the connection
+// manager, and the interval of the reprovider. Others read the config as
+// they go, like the bootstrapper its peers and the gateway its headers,
+// and the rest only apply once the node restarts.
+func (n *IpfsNode) ReloadConfig() error {
+	cfg := n.Repo.Config()
+
+	// check the whole config before applying any of it.
+	interval, err := reprovideInterval(cfg.Reprovider)
+	if err != nil {
+		return err
+	}
+	if _, err := constructConnMgr(cfg.ConnMgr); err != nil {
+		return err
+	}
+
+	if n.PeerHost != nil {
+		if cmgr := n.PeerHost.ConnManager(); cmgr != nil {
+			if err := configureConnMgr(cmgr, cfg.ConnMgr); err != nil {
+				return err
+			}
+			// trim at once, should the limits be lower.
+			go cmgr.TrimOpenConns(n.PeerHost.Network())
+		}
+	}
+	if n.Reprovider != nil {
+		n.Reprovider.SetInterval(interval)
+	}
+	return nil
+}
+
 // startListening on the network addresses
 func startListening(ctx context.Context, host p2phost.Host, cfg *config.Config) error {
 	listenAddrs, err := listenAddresses(cfg)
@@ -548,6 +940,9 @@ func startListening(ctx context.Context, host p2phost.Host, cfg *config.Config)
 	// make sure we error out if our config does not have addresses we can use
 	log.Debugf("Config.Addresses.Swarm:%s", listenAddrs)
 	filteredAddrs := addrutil.FilterUsableAddrs(listenAddrs)
+	if cfg.Experiments.Utp {
+		filteredAddrs = addrutil.FilterUsableAddrsWithUtp(listenAddrs)
+	}
 	log.Debugf("Config.Addresses.Swarm:%s (filtered)", filteredAddrs)
 	if len(filteredAddrs) < 1 {
 		return fmt.Errorf("addresses in config not usable: %s", listenAddrs)
@@ -573,8 +968,17 @@ func constructDHTRouting(ctx context.Context, host p2phost.Host, dstore ds.Threa
 	return dhtRouting, nil
 }
 
+func constructClientDHTRouting(ctx context.Context, host p2phost.Host, dstore ds.ThreadSafeDatastore) (routing.IpfsRouting, error) {
+	dhtRouting := dht.NewDHTClient(ctx, host, dstore)
+	dhtRouting.Validator[IpnsValidatorTag] = namesys.IpnsRecordValidator
+	return dhtRouting, nil
+}
+
 type RoutingOption func(context.Context, p2phost.Host, ds.ThreadSafeDatastore) (routing.IpfsRouting, error)
 
 type DiscoveryOption func(p2phost.Host) (discovery.Service, error)
 
 var DHTOption RoutingOption = constructDHTRouting
+
+// DHTClientOption has the node query the DHT without answering queries.
+var DHTClientOption RoutingOption = constructClientDHTRouting
@@ -0,0 +1,30 @@
+package coreapi
+
+import (
+	core "github.com/ipfs/go-ipfs/core"
+)
+
+type coreAPI struct {
+	node *core.IpfsNode
+}
+
+// NewCoreAPI returns the CoreAPI of node.
+func NewCoreAPI(node *core.IpfsNode) CoreAPI {
+	return &coreAPI{node: node}
+}
+
+func (api *coreAPI) Unixfs() UnixfsAPI {
+	return (*unixfsAPI)(api)
+}
+
+func (api *coreAPI) Pin() PinAPI {
+	return (*pinAPI)(api)
+}
+
+func (api *coreAPI) Name() NameAPI {
+	return (*nameAPI)(api)
+}
+
+func (api *coreAPI) Object() ObjectAPI {
+	return (*objectAPI)(api)
+}
@@ -0,0 +1,268 @@
+package coreapi
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	coremock "github.com/ipfs/go-ipfs/core/mock"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+func newAPI(t *testing.T) CoreAPI {
+	nd, err := coremock.NewMockNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewCoreAPI(nd)
+}
+
+func TestAddCat(t *testing.T) {
+	ctx := context.Background()
+	api := newAPI(t)
+
+	k1, err := api.Unixfs().Add(ctx, strings.NewReader("hello "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := api.Unixfs().Add(ctx, strings.NewReader("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{"/ipfs/" + k1.B58String(), "/ipfs/" + k2.B58String()}
+
+	for _, c := range []struct {
+		offset, max int64
+		out         string
+	}{
+		{0, -1, "hello world"},
+		{3, -1, "lo world"},
+		{6, -1, "world"},
+		{4, 4, "o wo"},
+	} {
+		r, n, err := api.Unixfs().Cat(ctx, paths, c.offset, c.max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		if string(out) != c.out || n != uint64(len(c.out)) {
+			t.Fatalf("cat from %d, at most %d: got %q (%d bytes), expected %q", c.offset, c.max, out, n, c.out)
+		}
+	}
+
+	pins, err := api.Pin().Ls(ctx, "recursive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 2 {
+		t.Fatalf("expected the 2 added files to be pinned, got %v", pins)
+	}
+}
+
+func TestGetTar(t *testing.T) {
+	ctx := context.Background()
+	api := newAPI(t)
+
+	k, err := api.Unixfs().Add(ctx, strings.NewReader("some data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, size, err := api.Unixfs().Get(ctx, []string{k.B58String()}, GetOptions{Compression: gzip.NoCompression})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if size != uint64(len("some data")) {
+		t.Fatalf("expected size %d, got %d", len("some data"), size)
+	}
+
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Name != k.B58String() {
+		t.Fatalf("expected the entry to be named %s, got %s", k.B58String(), hdr.Name)
+	}
+	data, err := ioutil.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "some data" {
+		t.Fatalf("got %q out of the archive", data)
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Fatalf("expected a single entry, got %v", err)
+	}
+}
+
+func TestPinAddRm(t *testing.T) {
+	ctx := context.Background()
+	api := newAPI(t)
+
+	k, err := api.Unixfs().Add(ctx, strings.NewReader("pin me"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := "/ipfs/" + k.B58String()
+
+	if _, err := api.Pin().Rm(ctx, []string{p}, true); err != nil {
+		t.Fatal(err)
+	}
+	pins, err := api.Pin().Ls(ctx, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 0 {
+		t.Fatalf("expected no pins, got %v", pins)
+	}
+
+	if _, err := api.Pin().Add(ctx, []string{p}, false); err != nil {
+		t.Fatal(err)
+	}
+	pins, err = api.Pin().Ls(ctx, "direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].Key != k || pins[0].Type != "direct" {
+		t.Fatalf("expected %s to be pinned directly, got %v", k, pins)
+	}
+
+	if _, err := api.Pin().Ls(ctx, "sideways"); err != ErrInvalidPinType {
+		t.Fatalf("expected ErrInvalidPinType, got %v", err)
+	}
+}
+
+func TestObject(t *testing.T) {
+	ctx := context.Background()
+	api := newAPI(t)
+
+	k, err := api.Unixfs().Add(ctx, strings.NewReader("object data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := api.Object().Stat(ctx, k.B58String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.NumLinks != 0 {
+		t.Fatalf("expected no links, got %d", st.NumLinks)
+	}
+
+	nd, err := api.Object().Get(ctx, k.B58String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd.Data = append(nd.Data, 'x')
+	k2, err := api.Object().Put(ctx, nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k2 == k {
+		t.Fatal("changed node should have a new key")
+	}
+	data, err := api.Object().Data(ctx, k2.B58String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(data)
+	if b[len(b)-1] != 'x' {
+		t.Fatalf("data of the new node is %q", b)
+	}
+}
+
+func TestNamePublishResolve(t *testing.T) {
+	ctx := context.Background()
+	api := newAPI(t)
+
+	k, err := api.Unixfs().Add(ctx, strings.NewReader("published"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := path.FromString("/ipfs/" + k.B58String())
+
+	entry, err := api.Name().Publish(ctx, p, PublishOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	self, err := api.Name().KeyName("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Name != self || entry.Value != p.String() {
+		t.Fatalf("published %v, expected %s under %s", entry, p, self)
+	}
+
+	res, err := api.Name().Resolve(ctx, "/ipns/"+entry.Name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != p {
+		t.Fatalf("resolved to %s, expected %s", res, p)
+	}
+
+	if _, err := api.Name().KeyName("nope"); err == nil {
+		t.Fatal("expected an error for a key not in the keystore")
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	ctx := context.Background()
+	api := newAPI(t)
+
+	k, err := api.Unixfs().Add(ctx, strings.NewReader("leaf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := api.Object().Get(ctx, k.B58String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := new(dag.Node)
+	if err := dir.AddNodeLinkClean("a", leaf); err != nil {
+		t.Fatal(err)
+	}
+	dk, err := api.Object().Put(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafPath := path.FromKey(k)
+
+	for _, p := range []string{k.B58String(), leafPath.String(), "/ipfs/" + dk.B58String() + "/a"} {
+		res, err := api.ResolvePath(ctx, p, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != leafPath {
+			t.Fatalf("%s resolved to %s, expected %s", p, res, leafPath)
+		}
+	}
+
+	entry, err := api.Name().Publish(ctx, path.FromKey(dk), PublishOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := api.ResolvePath(ctx, "/ipns/"+entry.Name+"/a", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != leafPath {
+		t.Fatalf("resolved to %s through the name, expected %s", res, leafPath)
+	}
+
+	if _, err := api.ResolvePath(ctx, "/ipfs/"+dk.B58String()+"/nope", false); err == nil {
+		t.Fatal("expected a missing link to fail")
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Package coreapi is the programmatic interface to an IpfsNode.
+
+It does what the ipfs commands do, for Go programs that embed a node and
+would otherwise have to shell out to ipfs, or copy the Run functions of
+the commands. The commands themselves are built on it.
+
+	api := coreapi.NewCoreAPI(node)
+	k, err := api.Unixfs().Add(ctx, strings.NewReader("hello"))
+	...
+	r, _, err := api.Unixfs().Cat(ctx, []string{"/ipfs/" + k.B58String()}, 0, -1)
+
+Paths are /ipfs/ or /ipns/ paths, or bare keys, as the commands take
+them.
+*/
+package coreapi
+
+import (
+	"io"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	path "github.com/ipfs/go-ipfs/path"
+	pin "github.com/ipfs/go-ipfs/pin"
+	utar "github.com/ipfs/go-ipfs/unixfs/tar"
+)
+
+// CoreAPI gives access to the node through the APIs of its subsystems.
+type CoreAPI interface {
+	Unixfs() UnixfsAPI
+	Pin() PinAPI
+	Name() NameAPI
+	Object() ObjectAPI
+
+	// ResolvePath returns p in its /ipfs/<hash> form: the name it starts
+	// from resolved, and its links followed to the object it ends at.
+	// Unless recursive is set, the name is only resolved a step, and p
+	// is returned as a path into the next name, should it point to one.
+	ResolvePath(ctx context.Context, p string, recursive bool) (path.Path, error)
+}
+
+// UnixfsAPI reads and writes unixfs files and directories, like ipfs add,
+// cat, get and ls.
+type UnixfsAPI interface {
+	// Add imports the data of r as a file, pins it, and returns its key.
+	Add(ctx context.Context, r io.Reader) (key.Key, error)
+
+	// Cat returns a reader of the data of the files at paths, from offset
+	// bytes into their concatenation, and the number of bytes it reads:
+	// at most max, unless max is negative. Only the blocks in the range
+	// are fetched. Closing the reader stops the fetch.
+	Cat(ctx context.Context, paths []string, offset, max int64) (io.ReadCloser, uint64, error)
+
+	// Get returns an archive of the objects at paths, and the total size
+	// of the files in it. Closing the reader stops the fetch.
+	Get(ctx context.Context, paths []string, opts GetOptions) (io.ReadCloser, uint64, error)
+
+	// Ls returns the links of the directory at p.
+	Ls(ctx context.Context, p string) ([]*dag.Link, error)
+}
+
+// GetOptions are the options of UnixfsAPI.Get, as those of ipfs get.
+type GetOptions struct {
+	// Format is the format of the archive: "tar", the default, or "zip".
+	Format string
+
+	// Compression is the gzip level of a tar archive, or whether the
+	// entries of a zip archive are deflated. The default is
+	// gzip.NoCompression.
+	Compression int
+
+	// Offsets are the parts of the files already downloaded, keyed by
+	// their names in the archive, to resume a tar archive from.
+	Offsets map[string]utar.Resume
+
+	// Dedupe hardlinks the files of a tar archive with identical
+	// contents to the first one.
+	Dedupe bool
+
+	// Verify lists the blocks of each file of a tar archive before it,
+	// for the file to be checked against its hashes once extracted.
+	Verify bool
+}
+
+// PinAPI manages the pins of the node, like ipfs pin.
+type PinAPI interface {
+	// Add pins the objects at paths, and returns their keys.
+	Add(ctx context.Context, paths []string, recursive bool) ([]key.Key, error)
+
+	// Rm unpins the objects at paths, and returns their keys.
+	Rm(ctx context.Context, paths []string, recursive bool) ([]key.Key, error)
+
+	// Ls returns the pins of the given type: "direct", "indirect",
+	// "recursive", "best-effort" or "all".
+	Ls(ctx context.Context, typ string) ([]Pin, error)
+}
+
+// Pin is a key pinned by the node.
+type Pin struct {
+	Key key.Key
+
+	// Type is "direct", "indirect" or "recursive".
+	Type string
+
+	// Count is the number of pins holding an indirect key.
+	Count int
+
+	// Label names the pin, unless it is indirect.
+	Label pin.Label
+}
+
+// NameAPI publishes and resolves IPNS names, like ipfs name.
+type NameAPI interface {
+	// Publish publishes p under the name of a key, and returns the name
+	// and the published value.
+	Publish(ctx context.Context, p path.Path, opts PublishOptions) (*NameEntry, error)
+
+	// Resolve returns the value of name, following names to the end
+	// when recursive is set.
+	Resolve(ctx context.Context, name string, recursive bool) (path.Path, error)
+
+	// KeyName returns the IPNS name which the key named keyName
+	// publishes to.
+	KeyName(keyName string) (string, error)
+}
+
+// PublishOptions are the options of NameAPI.Publish.
+type PublishOptions struct {
+	// Key is the name of the key to publish with: SelfKeyName, the
+	// default, or one in the keystore.
+	Key string
+
+	// Lifetime is how long the record is valid for. It defaults to
+	// namesys.DefaultRecordLifetime.
+	Lifetime time.Duration
+
+	// TTL is how long resolvers may cache the record for.
+	TTL time.Duration
+}
+
+// NameEntry is a value published under an IPNS name.
+type NameEntry struct {
+	Name  string
+	Value string
+}
+
+// ObjectAPI reads and writes raw DAG nodes, like ipfs object.
+type ObjectAPI interface {
+	// Get returns the node at p.
+	Get(ctx context.Context, p string) (*dag.Node, error)
+
+	// Data returns the data of the node at p.
+	Data(ctx context.Context, p string) (io.Reader, error)
+
+	// Links returns the links of the node at p.
+	Links(ctx context.Context, p string) ([]*dag.Link, error)
+
+	// Stat returns the statistics of the node at p.
+	Stat(ctx context.Context, p string) (*dag.NodeStat, error)
+
+	// Put stores nd, and returns its key.
+	Put(ctx context.Context, nd *dag.Node) (key.Key, error)
+}
@@ -0,0 +1,117 @@
+package coreapi
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	core "github.com/ipfs/go-ipfs/core"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	crypto "github.com/ipfs/go-ipfs/p2p/crypto"
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+// SelfKeyName names the identity key of the node, among those in the
+// keystore.
+const SelfKeyName = "self"
+
+type nameAPI coreAPI
+
+func (api *nameAPI) Publish(ctx context.Context, p path.Path, opts PublishOptions) (*NameEntry, error) {
+	n := api.node
+	if err := api.setupRouting(); err != nil {
+		return nil, err
+	}
+
+	k, err := LookupKey(n, opts.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	// First, verify the path exists
+	if _, err := core.Resolve(ctx, n, p); err != nil {
+		return nil, err
+	}
+
+	lifetime := opts.Lifetime
+	if lifetime == 0 {
+		lifetime = namesys.DefaultRecordLifetime
+	}
+	eol := time.Now().Add(lifetime)
+	if err := n.Namesys.PublishWithEOL(ctx, k, p, eol, opts.TTL); err != nil {
+		return nil, err
+	}
+
+	hash, err := k.GetPublic().Hash()
+	if err != nil {
+		return nil, err
+	}
+	return &NameEntry{
+		Name:  key.Key(hash).String(),
+		Value: p.String(),
+	}, nil
+}
+
+func (api *nameAPI) Resolve(ctx context.Context, name string, recursive bool) (path.Path, error) {
+	if err := api.setupRouting(); err != nil {
+		return "", err
+	}
+
+	depth := 1
+	if recursive {
+		depth = namesys.DefaultDepthLimit
+	}
+	return api.node.Namesys.ResolveN(ctx, name, depth)
+}
+
+func (api *nameAPI) KeyName(keyName string) (string, error) {
+	k, err := LookupKey(api.node, keyName)
+	if err != nil {
+		return "", err
+	}
+	h, err := k.GetPublic().Hash()
+	if err != nil {
+		return "", err
+	}
+	return key.Key(h).Pretty(), nil
+}
+
+// setupRouting lets an offline node publish and resolve names, from its
+// own records.
+func (api *nameAPI) setupRouting() error {
+	if api.node.OnlineMode() || api.node.Namesys != nil {
+		return nil
+	}
+	return api.node.SetupOfflineRouting()
+}
+
+// LookupKey returns the private key named name: the identity key of the
+// node for SelfKeyName, or "", or else the one in the keystore.
+func LookupKey(n *core.IpfsNode, name string) (crypto.PrivKey, error) {
+	if name == "" || name == SelfKeyName {
+		if n.Identity == "" {
+			return nil, errors.New("Identity not loaded!")
+		}
+		// offline, the identity key is only loaded on demand
+		if n.PrivateKey == nil {
+			if err := n.LoadPrivateKey(); err != nil {
+				return nil, err
+			}
+		}
+		return n.PrivateKey, nil
+	}
+
+	ks := n.Repo.Keystore()
+	if ks == nil {
+		return nil, errors.New("this node has no keystore")
+	}
+	k, err := ks.Get(name)
+	if err == keystore.ErrNoSuchKey {
+		return nil, fmt.Errorf("no key named %q in the keystore", name)
+	}
+	return k, err
+}
@@ -0,0 +1,47 @@
+package coreapi
+
+import (
+	"bytes"
+	"io"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	core "github.com/ipfs/go-ipfs/core"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+type objectAPI coreAPI
+
+func (api *objectAPI) Get(ctx context.Context, p string) (*dag.Node, error) {
+	return core.Resolve(ctx, api.node, path.Path(p))
+}
+
+func (api *objectAPI) Data(ctx context.Context, p string) (io.Reader, error) {
+	nd, err := api.Get(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(nd.Data), nil
+}
+
+func (api *objectAPI) Links(ctx context.Context, p string) ([]*dag.Link, error) {
+	nd, err := api.Get(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return nd.Links, nil
+}
+
+func (api *objectAPI) Stat(ctx context.Context, p string) (*dag.NodeStat, error) {
+	nd, err := api.Get(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return nd.Stat()
+}
+
+func (api *objectAPI) Put(ctx context.Context, nd *dag.Node) (key.Key, error) {
+	return api.node.DAG.Add(nd)
+}
@@ -0,0 +1,44 @@
+package coreapi
+
+import (
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	core "github.com/ipfs/go-ipfs/core"
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+func (api *coreAPI) ResolvePath(ctx context.Context, p string, recursive bool) (path.Path, error) {
+	pp, err := path.ParsePath(p)
+	if err != nil {
+		return "", err
+	}
+
+	seg := pp.Segments()
+	if seg[0] == "ipns" {
+		if len(seg) < 2 || seg[1] == "" {
+			return "", path.ErrNoComponents
+		}
+		v, err := api.Name().Resolve(ctx, "/ipns/"+seg[1], recursive)
+		if err != nil {
+			return "", err
+		}
+		pp, err = path.FromSegments("/", append(v.Segments(), seg[2:]...)...)
+		if err != nil {
+			return "", err
+		}
+		seg = pp.Segments()
+		if seg[0] == "ipns" {
+			// resolved a step only
+			return pp, nil
+		}
+	}
+
+	if len(seg) == 2 {
+		return pp, nil
+	}
+	k, err := core.ResolveToKey(ctx, api.node, pp)
+	if err != nil {
+		return "", err
+	}
+	return path.FromKey(k), nil
+}
@@ -0,0 +1,78 @@
+package coreapi
+
+import (
+	"errors"
+	"sort"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+)
+
+// ErrInvalidPinType is returned by PinAPI.Ls for an unknown type of pins.
+var ErrInvalidPinType = errors.New("Invalid type, must be one of {direct, indirect, recursive, best-effort, all}")
+
+type pinAPI coreAPI
+
+func (api *pinAPI) Add(ctx context.Context, paths []string, recursive bool) ([]key.Key, error) {
+	return corerepo.Pin(api.node, paths, recursive)
+}
+
+func (api *pinAPI) Rm(ctx context.Context, paths []string, recursive bool) ([]key.Key, error) {
+	return corerepo.Unpin(api.node, paths, recursive)
+}
+
+func (api *pinAPI) Ls(ctx context.Context, typ string) ([]Pin, error) {
+	switch typ {
+	case "all", "direct", "indirect", "recursive", "best-effort":
+	default:
+		return nil, ErrInvalidPinType
+	}
+
+	// a key pinned in several ways is listed once, recursive pins first,
+	// then indirect, direct and best-effort ones.
+	pinning := api.node.Pinning
+	pins := make(map[key.Key]Pin)
+	if typ == "best-effort" || typ == "all" {
+		for _, k := range pinning.BestEffortKeys() {
+			pins[k] = Pin{Key: k, Type: "best-effort", Count: 1}
+		}
+	}
+	if typ == "direct" || typ == "all" {
+		for _, k := range pinning.DirectKeys() {
+			pins[k] = Pin{Key: k, Type: "direct", Count: 1}
+		}
+	}
+	if typ == "indirect" || typ == "all" {
+		for k, v := range pinning.IndirectKeys() {
+			pins[k] = Pin{Key: k, Type: "indirect", Count: v}
+		}
+	}
+	if typ == "recursive" || typ == "all" {
+		for _, k := range pinning.RecursiveKeys() {
+			pins[k] = Pin{Key: k, Type: "recursive", Count: 1}
+		}
+	}
+
+	for k, l := range pinning.Labels() {
+		p, ok := pins[k]
+		if ok && p.Type != "indirect" {
+			p.Label = l
+			pins[k] = p
+		}
+	}
+
+	out := make([]Pin, 0, len(pins))
+	for _, p := range pins {
+		out = append(out, p)
+	}
+	sort.Sort(pinsByKey(out))
+	return out, nil
+}
+
+type pinsByKey []Pin
+
+func (s pinsByKey) Len() int           { return len(s) }
+func (s pinsByKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s pinsByKey) Less(i, j int) bool { return s[i].Key < s[j].Key }
@@ -0,0 +1,179 @@
+package coreapi
+
+import (
+	"io"
+	"os"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	core "github.com/ipfs/go-ipfs/core"
+	importer "github.com/ipfs/go-ipfs/importer"
+	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	path "github.com/ipfs/go-ipfs/path"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+	utar "github.com/ipfs/go-ipfs/unixfs/tar"
+)
+
+type unixfsAPI coreAPI
+
+func (api *unixfsAPI) Add(ctx context.Context, r io.Reader) (key.Key, error) {
+	n := api.node
+	dagnode, err := importer.BuildDagFromReader(
+		r,
+		n.DAG,
+		chunk.DefaultSplitter,
+		importer.BasicPinnerCB(n.Pinning.GetManual()),
+	)
+	if err != nil {
+		return "", err
+	}
+	if err := n.Pinning.Flush(); err != nil {
+		return "", err
+	}
+	return dagnode.Key()
+}
+
+func (api *unixfsAPI) Cat(ctx context.Context, paths []string, offset, max int64) (io.ReadCloser, uint64, error) {
+	n := api.node
+	readers := make([]io.Reader, 0, len(paths))
+	closeAll := func() {
+		for _, r := range readers {
+			r.(io.Closer).Close()
+		}
+	}
+
+	// files ending before offset are skipped without being read, and the
+	// first file read is seeked into, so only the blocks past the offset
+	// are fetched.
+	length := uint64(0)
+	for _, fpath := range paths {
+		dagnode, err := core.Resolve(ctx, n, path.Path(fpath))
+		if err != nil {
+			closeAll()
+			return nil, 0, err
+		}
+
+		read, err := uio.NewDagReader(ctx, dagnode, n.DAG)
+		if err != nil {
+			closeAll()
+			return nil, 0, err
+		}
+
+		size := read.Size()
+		if offset >= size {
+			offset -= size
+			read.Close()
+			continue
+		}
+		if offset > 0 {
+			if _, err := read.Seek(offset, os.SEEK_SET); err != nil {
+				read.Close()
+				closeAll()
+				return nil, 0, err
+			}
+			size -= offset
+			offset = 0
+		}
+
+		readers = append(readers, read)
+		length += uint64(size)
+		if max >= 0 && length >= uint64(max) {
+			length = uint64(max)
+			break
+		}
+	}
+
+	rr := &rangeReader{
+		r:       io.MultiReader(readers...),
+		left:    length,
+		readers: readers,
+	}
+	return rr, length, nil
+}
+
+// rangeReader reads the first left bytes of r, then closes readers, so
+// that the blocks prefetched past the end of the range are no longer
+// requested.
+type rangeReader struct {
+	r       io.Reader
+	left    uint64
+	readers []io.Reader
+	closed  bool
+}
+
+func (rr *rangeReader) Read(p []byte) (int, error) {
+	if rr.left == 0 {
+		rr.Close()
+		return 0, io.EOF
+	}
+	if uint64(len(p)) > rr.left {
+		p = p[:rr.left]
+	}
+	n, err := rr.r.Read(p)
+	rr.left -= uint64(n)
+	if rr.left == 0 {
+		rr.Close()
+	}
+	return n, err
+}
+
+func (rr *rangeReader) Close() error {
+	if rr.closed {
+		return nil
+	}
+	rr.closed = true
+	for _, r := range rr.readers {
+		r.(io.Closer).Close()
+	}
+	return nil
+}
+
+func (api *unixfsAPI) Get(ctx context.Context, paths []string, opts GetOptions) (io.ReadCloser, uint64, error) {
+	n := api.node
+
+	// paths that fail to resolve are left to the archive to report,
+	// unless there is only one.
+	entries := make([]utar.Entry, len(paths))
+	for i, p := range paths {
+		pathToResolve := path.Path(p)
+		dagnode, err := core.Resolve(ctx, n, pathToResolve)
+		if err != nil && len(paths) == 1 {
+			return nil, 0, err
+		}
+		entries[i] = utar.Entry{Path: pathToResolve, Node: dagnode, Err: err}
+	}
+
+	// zip archives can't hold hardlinks, nor be resumed.
+	dedupe, offsets := opts.Dedupe, opts.Offsets
+	if opts.Format == "zip" {
+		dedupe, offsets = false, nil
+	}
+
+	// resolve the whole tree up front, so progress can be reported
+	// against the real total.
+	size, err := utar.TotalSize(ctx, entries, n.DAG, offsets, dedupe)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var reader *utar.Reader
+	if opts.Format == "zip" {
+		reader, err = utar.NewZipReader(ctx, entries, n.DAG, opts.Compression)
+	} else {
+		reader, err = utar.NewTarReader(ctx, entries, n.DAG, opts.Compression, offsets, dedupe, opts.Verify)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return reader, size, nil
+}
+
+func (api *unixfsAPI) Ls(ctx context.Context, p string) ([]*dag.Link, error) {
+	dagnode, err := core.Resolve(ctx, api.node, path.Path(p))
+	if err != nil {
+		return nil, err
+	}
+	return dagnode.Links, nil
+}
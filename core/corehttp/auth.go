@@ -0,0 +1,218 @@
+package corehttp
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	cmdsHttp "github.com/ipfs/go-ipfs/commands/http"
+	core "github.com/ipfs/go-ipfs/core"
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+// readOnlyCommands are the commands which don't change the node, nor
+// reveal its secrets, and so are allowed in the read scope. All others
+// need the admin scope.
+var readOnlyCommands = map[string]bool{
+	"bitswap/ledger":        true,
+	"bitswap/stat":          true,
+	"bitswap/wantlist":      true,
+	"block/get":             true,
+	"block/stat":            true,
+	"bootstrap":             true,
+	"bootstrap/check":       true,
+	"bootstrap/list":        true,
+	"cat":                   true,
+	"commands":              true,
+	"dag/get":               true,
+	"dag/resolve":           true,
+	"dag/stat":              true,
+	"dht/findpeer":          true,
+	"dht/findprovs":         true,
+	"dht/get":               true,
+	"dht/query":             true,
+	"dns":                   true,
+	"experiments":           true,
+	"file/ls":               true,
+	"files/ls":              true,
+	"files/read":            true,
+	"files/stat":            true,
+	"filestore/ls":          true,
+	"get":                   true,
+	"id":                    true,
+	"ls":                    true,
+	"name/inspect":          true,
+	"name/resolve":          true,
+	"object/data":           true,
+	"object/diff":           true,
+	"object/get":            true,
+	"object/links":          true,
+	"object/stat":           true,
+	"pin/ls":                true,
+	"pin/remote/ls":         true,
+	"pin/remote/service/ls": true,
+	"pin/status":            true,
+	"ping":                  true,
+	"pubsub/ls":             true,
+	"pubsub/peers":          true,
+	"pubsub/sub":            true,
+	"refs":                  true,
+	"refs/local":            true,
+	"repo/stat":             true,
+	"resolve":               true,
+	"stats/bw":              true,
+	"stats/repo":            true,
+	"stats/bitswap":         true,
+	"stats/dht":             true,
+	"stats/blockstore":      true,
+	"stats/paths":           true,
+	"stats/fetch":           true,
+	"swarm/addrs":           true,
+	"swarm/addrs/listen":    true,
+	"swarm/addrs/saved":     true,
+	"swarm/peers":           true,
+	"tar/cat":               true,
+	"version":               true,
+}
+
+// scopeRank orders the scopes, each allowing what the ones before it do.
+var scopeRank = map[string]int{
+	config.APIScopeNone:  0,
+	config.APIScopeRead:  1,
+	config.APIScopeAdmin: 2,
+}
+
+// APIAuthOption restricts what the requests to the rest of the options
+// may do to the scope of the credentials they present, as configured in
+// cfg. Without credentials configured, every request is let through.
+func APIAuthOption(cfg config.API) ServeOption {
+	return func(n *core.IpfsNode, mux *http.ServeMux) (*http.ServeMux, error) {
+		if len(cfg.Credentials) == 0 {
+			return mux, nil
+		}
+
+		anon := cfg.AnonymousScope
+		if anon == "" {
+			anon = config.APIScopeRead
+		}
+		if anon != config.APIScopeRead && anon != config.APIScopeNone {
+			return nil, fmt.Errorf("API.AnonymousScope must be %q or %q, not %q", config.APIScopeRead, config.APIScopeNone, anon)
+		}
+		for i, c := range cfg.Credentials {
+			if c.Token == "" && c.Username == "" {
+				return nil, fmt.Errorf("API.Credentials[%d] has neither a Token nor a Username", i)
+			}
+			if c.Scope != config.APIScopeRead && c.Scope != config.APIScopeAdmin {
+				return nil, fmt.Errorf("API.Credentials[%d].Scope must be %q or %q, not %q", i, config.APIScopeRead, config.APIScopeAdmin, c.Scope)
+			}
+		}
+
+		childMux := http.NewServeMux()
+		mux.Handle("/", &authHandler{
+			credentials: cfg.Credentials,
+			anonymous:   anon,
+			next:        childMux,
+		})
+		return childMux, nil
+	}
+}
+
+type authHandler struct {
+	credentials []config.APICredential
+	anonymous   string
+	next        http.Handler
+}
+
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	need := requiredScope(r)
+
+	scope, presented, ok := h.scope(r)
+	switch {
+	case !ok:
+		h.deny(w, http.StatusUnauthorized, "invalid API credentials")
+	case scopeRank[scope] >= scopeRank[need]:
+		h.next.ServeHTTP(w, r)
+	case !presented:
+		h.deny(w, http.StatusUnauthorized, fmt.Sprintf("%s requires API credentials", r.URL.Path))
+	default:
+		h.deny(w, http.StatusForbidden, fmt.Sprintf("%s requires the %s scope", r.URL.Path, need))
+	}
+}
+
+// scope returns the scope of r, and whether it presented credentials. It
+// returns false if the credentials presented are invalid.
+func (h *authHandler) scope(r *http.Request) (string, bool, bool) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return h.anonymous, false, true
+	}
+
+	if strings.HasPrefix(auth, "Bearer ") {
+		token := strings.TrimPrefix(auth, "Bearer ")
+		for _, c := range h.credentials {
+			if c.Token != "" && secureEqual(c.Token, token) {
+				return c.Scope, true, true
+			}
+		}
+		return "", true, false
+	}
+
+	if user, pass, ok := r.BasicAuth(); ok {
+		for _, c := range h.credentials {
+			// compare both, so the time taken doesn't tell the
+			// username was right.
+			userOk := secureEqual(c.Username, user)
+			passOk := secureEqual(c.Password, pass)
+			if c.Username != "" && userOk && passOk {
+				return c.Scope, true, true
+			}
+		}
+	}
+	return "", true, false
+}
+
+func (h *authHandler) deny(w http.ResponseWriter, code int, msg string) {
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="ipfs"`)
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(code)
+	fmt.Fprintln(w, msg)
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// requiredScope returns the scope needed to serve r.
+func requiredScope(r *http.Request) string {
+	prefix := cmdsHttp.ApiPath + "/"
+	if strings.HasPrefix(r.URL.Path, prefix) {
+		// the commands handler answers OPTIONS requests as CORS
+		// preflights, which carry no credentials, and runs nothing.
+		if r.Method == "OPTIONS" {
+			return config.APIScopeNone
+		}
+
+		cmd := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		if readOnlyCommands[cmd] {
+			return config.APIScopeRead
+		}
+		return config.APIScopeAdmin
+	}
+
+	// orchestrators health check the node without credentials
+	if r.URL.Path == LivenessPath || r.URL.Path == ReadinessPath {
+		return config.APIScopeNone
+	}
+
+	// the gateway and webui, unless written to
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return config.APIScopeAdmin
+	}
+	if strings.HasPrefix(r.URL.Path, "/debug/") || r.URL.Path == "/logs" {
+		return config.APIScopeAdmin
+	}
+	return config.APIScopeRead
+}
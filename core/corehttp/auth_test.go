@@ -0,0 +1,154 @@
+package corehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	core "github.com/ipfs/go-ipfs/core"
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+// okOption answers every request it gets with 200.
+func okOption(n *core.IpfsNode, mux *http.ServeMux) (*http.ServeMux, error) {
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux, nil
+}
+
+func authHandlerOf(t *testing.T, cfg config.API) http.Handler {
+	h, err := makeHandler(nil, APIAuthOption(cfg), okOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestAPIAuth(t *testing.T) {
+	h := authHandlerOf(t, config.API{
+		Credentials: []config.APICredential{
+			{Token: "admintoken", Scope: config.APIScopeAdmin},
+			{Token: "readtoken", Scope: config.APIScopeRead},
+			{Username: "bob", Password: "hunter2", Scope: config.APIScopeAdmin},
+		},
+	})
+
+	cases := []struct {
+		method, path string
+		auth         func(r *http.Request)
+		code         int
+	}{
+		// anonymous requests may only read
+		{"POST", "/api/v0/cat", nil, 200},
+		{"POST", "/api/v0/pin/ls", nil, 200},
+		{"POST", "/api/v0/add", nil, 401},
+		{"POST", "/api/v0/pin/add", nil, 401},
+		{"POST", "/api/v0/config", nil, 401},
+		{"OPTIONS", "/api/v0/add", nil, 200},
+		{"GET", "/ipfs/QmFoo", nil, 200},
+		{"PUT", "/ipfs/QmFoo", nil, 401},
+		{"GET", "/debug/pprof/", nil, 401},
+
+		// a read token may not write
+		{"POST", "/api/v0/cat", bearer("readtoken"), 200},
+		{"POST", "/api/v0/add", bearer("readtoken"), 403},
+		{"POST", "/api/v0/name/publish", bearer("readtoken"), 403},
+		{"POST", "/api/v0/shutdown", bearer("readtoken"), 403},
+
+		// an admin may do anything
+		{"POST", "/api/v0/add", bearer("admintoken"), 200},
+		{"POST", "/api/v0/config", bearer("admintoken"), 200},
+		{"GET", "/debug/pprof/", bearer("admintoken"), 200},
+		{"POST", "/api/v0/add", basic("bob", "hunter2"), 200},
+
+		// bad credentials are refused, even to read
+		{"POST", "/api/v0/cat", bearer("nope"), 401},
+		{"POST", "/api/v0/cat", basic("bob", "nope"), 401},
+		{"POST", "/api/v0/cat", basic("", ""), 401},
+	}
+	for _, c := range cases {
+		r, err := http.NewRequest(c.method, "http://localhost"+c.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.auth != nil {
+			c.auth(r)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("%s %s (%q): expected %d, got %d", c.method, c.path, r.Header.Get("Authorization"), c.code, w.Code)
+		}
+	}
+}
+
+func TestAPIAuthAnonymousNone(t *testing.T) {
+	h := authHandlerOf(t, config.API{
+		Credentials:    []config.APICredential{{Token: "readtoken", Scope: config.APIScopeRead}},
+		AnonymousScope: config.APIScopeNone,
+	})
+
+	r, _ := http.NewRequest("POST", "http://localhost/api/v0/cat", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+
+	bearer("readtoken")(r)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	// orchestrators health check without credentials
+	for _, p := range []string{LivenessPath, ReadinessPath} {
+		r, _ := http.NewRequest("GET", "http://localhost"+p, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", p, w.Code)
+		}
+	}
+}
+
+func TestAPIAuthWithoutCredentials(t *testing.T) {
+	h := authHandlerOf(t, config.API{})
+
+	r, _ := http.NewRequest("POST", "http://localhost/api/v0/add", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected everything allowed, got %d", w.Code)
+	}
+}
+
+func TestAPIAuthBadConfig(t *testing.T) {
+	bad := []config.API{
+		{Credentials: []config.APICredential{{Token: "t", Scope: "root"}}},
+		{Credentials: []config.APICredential{{Scope: config.APIScopeAdmin}}},
+		{
+			Credentials:    []config.APICredential{{Token: "t", Scope: config.APIScopeAdmin}},
+			AnonymousScope: config.APIScopeAdmin,
+		},
+	}
+	for _, cfg := range bad {
+		if _, err := makeHandler(nil, APIAuthOption(cfg)); err == nil {
+			t.Errorf("expected %v to be refused", cfg)
+		}
+	}
+}
+
+func bearer(token string) func(r *http.Request) {
+	return func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+func basic(username, password string) func(r *http.Request) {
+	return func(r *http.Request) {
+		r.SetBasicAuth(username, password)
+	}
+}
@@ -15,11 +15,50 @@ const (
 	originEnvKey = "API_ORIGIN"
 )
 
-func CommandsOption(cctx commands.Context) ServeOption {
+const (
+	allowOriginHeader  = "Access-Control-Allow-Origin"
+	allowMethodsHeader = "Access-Control-Allow-Methods"
+	allowHeadersHeader = "Access-Control-Allow-Headers"
+)
+
+// CommandsOption serves the commands of the API. The requests of the
+// origins given, like those of the webui, are allowed along with those of
+// the config.
+func CommandsOption(cctx commands.Context, origins ...string) ServeOption {
 	return func(n *core.IpfsNode, mux *http.ServeMux) (*http.ServeMux, error) {
-		origin := os.Getenv(originEnvKey)
-		cmdHandler := cmdsHttp.NewHandler(cctx, corecommands.Root, origin)
+		origins := origins
+		if origin := os.Getenv(originEnvKey); len(origin) > 0 {
+			log.Info("Allowing API requests from origin: " + origin)
+			origins = append(origins, origin)
+		}
+
+		// the config is read for each request, so that changes to
+		// API.HTTPHeaders apply without a restart.
+		cmdHandler := cmdsHttp.NewDynamicHandler(cctx, corecommands.Root, func() *cmdsHttp.ServerConfig {
+			return apiServerConfig(n.Repo.Config().API.HTTPHeaders, origins)
+		})
 		mux.Handle(cmdsHttp.ApiPath+"/", cmdHandler)
 		return mux, nil
 	}
 }
+
+// apiServerConfig returns the configuration of the commands handler with
+// the headers of the API config, the CORS ones taken to be what is
+// allowed. origins are allowed too.
+func apiServerConfig(headers map[string][]string, origins []string) *cmdsHttp.ServerConfig {
+	cfg := &cmdsHttp.ServerConfig{Headers: make(map[string][]string)}
+	for k, v := range headers {
+		switch k = http.CanonicalHeaderKey(k); k {
+		case allowOriginHeader:
+			cfg.AllowedOrigins = append(cfg.AllowedOrigins, v...)
+		case allowMethodsHeader:
+			cfg.AllowedMethods = append(cfg.AllowedMethods, v...)
+		case allowHeadersHeader:
+			cfg.AllowedHeaders = append(cfg.AllowedHeaders, v...)
+		default:
+			cfg.Headers[k] = v
+		}
+	}
+	cfg.AllowedOrigins = append(cfg.AllowedOrigins, origins...)
+	return cfg
+}
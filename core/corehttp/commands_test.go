@@ -0,0 +1,28 @@
+package corehttp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAPIServerConfig(t *testing.T) {
+	cfg := apiServerConfig(map[string][]string{
+		"access-control-allow-origin":  []string{"http://app.example.org"},
+		"Access-Control-Allow-Methods": []string{"POST"},
+		"Access-Control-Allow-Headers": []string{"Authorization"},
+		"x-served-by":                  []string{"ipfs"},
+	}, []string{"http://other.example.org"})
+
+	if !reflect.DeepEqual(cfg.AllowedOrigins, []string{"http://app.example.org", "http://other.example.org"}) {
+		t.Errorf("unexpected origins %v", cfg.AllowedOrigins)
+	}
+	if !reflect.DeepEqual(cfg.AllowedMethods, []string{"POST"}) {
+		t.Errorf("unexpected methods %v", cfg.AllowedMethods)
+	}
+	if !reflect.DeepEqual(cfg.AllowedHeaders, []string{"Authorization"}) {
+		t.Errorf("unexpected headers %v", cfg.AllowedHeaders)
+	}
+	if !reflect.DeepEqual(cfg.Headers, map[string][]string{"X-Served-By": []string{"ipfs"}}) {
+		t.Errorf("unexpected response headers %v", cfg.Headers)
+	}
+}
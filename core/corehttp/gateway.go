@@ -17,6 +17,10 @@ type Gateway struct {
 type GatewayConfig struct {
 	BlockList *BlockList
 	Writable  bool
+
+	// NoDirListing stops the gateway listing the directories without an
+	// index.html.
+	NoDirListing bool
 }
 
 func NewGateway(conf GatewayConfig) *Gateway {
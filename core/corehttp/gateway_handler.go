@@ -6,10 +6,13 @@ import (
 	"html/template"
 	"io"
 	"net/http"
+	"net/url"
 	gopath "path"
 	"strings"
 	"time"
 
+	metrics "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/codahale/metrics"
+	humanize "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/dustin/go-humanize"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	key "github.com/ipfs/go-ipfs/blocks/key"
@@ -32,9 +35,9 @@ type webHandler map[string]interface{}
 
 // struct for directory listing
 type directoryItem struct {
-	Size uint64
+	Size string
 	Name string
-	Path string
+	Href string
 }
 
 // gatewayHandler is a HTTP handler that serves IPFS objects (accessible by default at /ipfs/<path>)
@@ -76,7 +79,31 @@ func (i *gatewayHandler) newDagFromReader(r io.Reader) (*dag.Node, error) {
 }
 
 // TODO(btc): break this apart into separate handlers using a more expressive muxer
+// gatewayLatency is the distribution of how long the gateway takes to
+// answer requests, in milliseconds, up to ten minutes.
+var (
+	gatewayRequests = metrics.Counter("gateway.Requests")
+	gatewayLatency  = metrics.NewHistogram("gateway.Request.ms", 0, int64(10*time.Minute/time.Millisecond), 3)
+)
+
 func (i *gatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gatewayRequests.Add()
+	start := time.Now()
+	defer func() {
+		gatewayLatency.RecordValue(int64(time.Since(start) / time.Millisecond))
+	}()
+
+	// read for each request, so that changes to the config apply without
+	// a restart.
+	for k, v := range i.node.Repo.Config().Gateway.HTTPHeaders {
+		w.Header()[http.CanonicalHeaderKey(k)] = v
+	}
+
+	if r.Method == "OPTIONS" {
+		// a CORS preflight, answered by the headers alone
+		return
+	}
+
 	if i.config.Writable {
 		switch r.Method {
 		case "POST":
@@ -120,18 +147,36 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if entry, denied := i.node.Denylist.DeniedPath(urlPath); denied {
+		i.denied(w, urlPath, entry)
+		return
+	}
+
 	nd, err := core.Resolve(ctx, i.node, path.Path(urlPath))
 	if err != nil {
 		webError(w, "Path Resolve error", err, http.StatusBadRequest)
 		return
 	}
 
-	etag := gopath.Base(urlPath)
-	if r.Header.Get("If-None-Match") == etag {
-		w.WriteHeader(http.StatusNotModified)
+	// the hash of what the path resolves to tags it: the same hash is
+	// always the same content, whatever path led to it.
+	k, err := nd.Key()
+	if err != nil {
+		internalWebError(w, err)
+		return
+	}
+
+	if entry, denied := i.node.Denylist.DeniedKey(k); denied {
+		i.denied(w, urlPath, entry)
 		return
 	}
 
+	// serving content puts off the eviction of its best-effort pins
+	i.node.Pinning.TouchBestEffort(k)
+	if parts := strings.SplitN(urlPath, "/", 4); len(parts) > 2 && parts[1] == "ipfs" {
+		i.node.Pinning.TouchBestEffort(key.B58KeyDecode(parts[2]))
+	}
+
 	w.Header().Set("X-IPFS-Path", urlPath)
 
 	// Suborigin header, sandboxes apps from each other in the browser (even
@@ -149,73 +194,126 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 
 	// set these headers _after_ the error, for we may just not have it
 	// and dont want the client to cache a 500 response...
-	// and only if it's /ipfs!
 	// TODO: break this out when we split /ipfs /ipns routes.
-	modtime := time.Now()
+	var modtime time.Time
 	if strings.HasPrefix(urlPath, ipfsPathPrefix) {
-		w.Header().Set("Etag", etag)
-		w.Header().Set("Cache-Control", "public, max-age=29030400")
+		w.Header().Set("Cache-Control", immutableCacheControl)
 
 		// set modtime to a really long time ago, since files are immutable and should stay cached
 		modtime = time.Unix(1, 0)
+	} else {
+		// what a name points to changes, so caches check back soon.
+		w.Header().Set("Cache-Control", ipnsCacheControl)
 	}
 
 	if err == nil {
 		defer dr.Close()
+		if notModified(w, r, etagOf(k, "")) {
+			return
+		}
 		_, name := gopath.Split(urlPath)
-		http.ServeContent(w, r, name, modtime, dr)
-		return
-	}
-
-	// storage for directory listing
-	var dirListing []directoryItem
-	// loop through files
-	foundIndex := false
-	for _, link := range nd.Links {
-		if link.Name == "index.html" {
-			if urlPath[len(urlPath)-1] != '/' {
-				http.Redirect(w, r, urlPath+"/", 302)
-				return
-			}
-
-			log.Debug("found index")
-			foundIndex = true
-			// return index page instead.
-			nd, err := core.Resolve(ctx, i.node, path.Path(urlPath+"/index.html"))
-			if err != nil {
-				internalWebError(w, err)
-				return
-			}
-			dr, err := uio.NewDagReader(ctx, nd, i.node.DAG)
-			if err != nil {
-				internalWebError(w, err)
-				return
-			}
-			defer dr.Close()
-
-			// write to request
-			if r.Method != "HEAD" {
-				io.Copy(w, dr)
-			}
-			break
+
+		// ?filename= names the download, and its extension takes
+		// precedence over the one in the path.
+		query := r.URL.Query()
+		filename := query.Get("filename")
+		if filename != "" {
+			name = filename
 		}
+		if ctype := typeByExtension(name); ctype != "" {
+			w.Header().Set("Content-Type", ctype)
+		}
+
+		if query.Get("download") == "true" {
+			w.Header().Set("Content-Disposition", contentDisposition("attachment", name))
+		} else if filename != "" {
+			w.Header().Set("Content-Disposition", contentDisposition("inline", name))
+		}
+
+		http.ServeContent(w, r, name, modtime, newLazySeeker(dr))
+		return
+	}
 
-		di := directoryItem{link.Size, link.Name, gopath.Join(urlPath, link.Name)}
-		dirListing = append(dirListing, di)
+	// directories are served at paths ending in a slash, so that the
+	// links in them resolve relative to the directory. The redirect is
+	// relative too, as the path may have been rewritten from the hostname.
+	if !strings.HasSuffix(urlPath, "/") {
+		location := gopath.Base(urlPath) + "/"
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+
+	links, err := uio.DirLinks(ctx, nd, i.node.DAG)
+	if err != nil {
+		internalWebError(w, err)
+		return
 	}
 
-	if !foundIndex {
-		// template and return directory listing
-		hndlr := webHandler{
-			"listing": dirListing,
-			"path":    urlPath,
+	// serve the index page instead, if there is one.
+	for _, link := range links {
+		if link.Name != "index.html" {
+			continue
+		}
+
+		log.Debug("found index")
+		nd, err := core.Resolve(ctx, i.node, path.Path(urlPath+"index.html"))
+		if err != nil {
+			internalWebError(w, err)
+			return
+		}
+		dr, err := uio.NewDagReader(ctx, nd, i.node.DAG)
+		if err != nil {
+			internalWebError(w, err)
+			return
+		}
+		defer dr.Close()
+
+		// the hash of the directory tags its index page too, the page
+		// being part of it.
+		if notModified(w, r, etagOf(k, "")) {
+			return
 		}
+		w.Header().Set("Content-Type", extensionTypes[".html"])
+		http.ServeContent(w, r, "index.html", modtime, newLazySeeker(dr))
+		return
+	}
+
+	if i.config.NoDirListing {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("403 - Forbidden: directory listing is disabled"))
+		return
+	}
+
+	dirListing := make([]directoryItem, 0, len(links))
+	for _, link := range links {
+		dirListing = append(dirListing, directoryItem{
+			Size: humanize.Bytes(link.Size),
+			Name: link.Name,
+			Href: (&url.URL{Path: link.Name}).String(),
+		})
+	}
+
+	// template and return directory listing
+	hndlr := webHandler{
+		"listing": dirListing,
+		"path":    urlPath,
+		// the root of /ipfs/<hash>/, or of a hostname, has no parent.
+		"parent": strings.Count(strings.Trim(urlPath, "/"), "/") > 1,
+	}
 
-		if r.Method != "HEAD" {
-			if err := i.dirList.Execute(w, hndlr); err != nil {
-				internalWebError(w, err)
-				return
-			}
+	// the listing is the page of this gateway, not the directory itself.
+	if notModified(w, r, etagOf(k, "DirIndex-")) {
+		return
+	}
+	w.Header().Set("Content-Type", extensionTypes[".html"])
+	if r.Method != "HEAD" {
+		if err := i.dirList.Execute(w, hndlr); err != nil {
+			internalWebError(w, err)
+			return
 		}
 	}
 }
@@ -251,10 +349,11 @@ func (i *gatewayHandler) putEmptyDirHandler(w http.ResponseWriter, r *http.Reque
 }
 
 func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO(cryptix): either ask mildred about the flow of this or rewrite it
-	webErrorWithCode(w, "Sorry, PUT is bugged right now, closing request", errors.New("handler disabled"), http.StatusInternalServerError)
-	return
 	urlPath := r.URL.Path
+	if !strings.HasPrefix(urlPath, ipfsPathPrefix) {
+		webError(w, "Only /ipfs/ paths can be written to", errors.New(urlPath), http.StatusBadRequest)
+		return
+	}
 	pathext := urlPath[5:]
 	var err error
 	if urlPath == ipfsPathPrefix+"QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn/" {
@@ -276,22 +375,11 @@ func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithCancel(i.node.Context())
 	defer cancel()
 
-	ipfsNode, err := core.Resolve(ctx, i.node, path.Path(urlPath))
-	if err != nil {
-		// FIXME HTTP error code
-		webError(w, "Could not resolve name", err, http.StatusInternalServerError)
-		return
-	}
-
-	k, err := ipfsNode.Key()
+	// the path being written doesn't exist yet, so it can't be resolved as a
+	// whole: take the root from the url and resolve as many parents as exist.
+	h, components, err := path.SplitAbsPath(path.Path(urlPath))
 	if err != nil {
-		webError(w, "Could not get key from resolved node", err, http.StatusInternalServerError)
-		return
-	}
-
-	h, components, err := path.SplitAbsPath(path.FromKey(k))
-	if err != nil {
-		webError(w, "Could not split path", err, http.StatusInternalServerError)
+		webError(w, "Could not split path", err, http.StatusBadRequest)
 		return
 	}
 
@@ -303,7 +391,6 @@ func (i *gatewayHandler) putHandler(w http.ResponseWriter, r *http.Request) {
 
 	tctx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
-	// TODO(cryptix): could this be core.Resolve() too?
 	rootnd, err := i.node.Resolver.DAG.Get(tctx, key.Key(h))
 	if err != nil {
 		webError(w, "Could not resolve root object", err, http.StatusBadRequest)
@@ -419,6 +506,49 @@ func (i *gatewayHandler) deleteHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, ipfsPathPrefix+key.String()+"/"+strings.Join(components[:len(components)-1], "/"), http.StatusCreated)
 }
 
+const (
+	// the content of /ipfs paths never changes: they may be cached for
+	// as long as caches like, without checking back.
+	immutableCacheControl = "public, max-age=29030400, immutable"
+	// what /ipns paths point to is cached briefly.
+	ipnsCacheControl = "public, max-age=60"
+)
+
+// etagOf returns the strong ETag of the response about the object k, its
+// kind told by prefix.
+func etagOf(k key.Key, prefix string) string {
+	return `"` + prefix + k.B58String() + `"`
+}
+
+// notModified sets the ETag of the response to etag, and returns whether
+// the request is conditional on an ETag it matches, in which case it has
+// answered it with a 304.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("Etag", etag)
+
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" {
+		return false
+	}
+	for _, tag := range strings.Split(inm, ",") {
+		tag = strings.TrimSpace(tag)
+		// weak comparison, as for GET and HEAD.
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// denied answers the request for urlPath, denied by entry of the denylist,
+// and records it in the audit log.
+func (i *gatewayHandler) denied(w http.ResponseWriter, urlPath, entry string) {
+	i.node.Denylist.Audit(urlPath, entry, "gateway")
+	w.WriteHeader(http.StatusGone)
+	fmt.Fprintf(w, "410 - Gone: %s is denied on this gateway", urlPath)
+}
+
 func webError(w http.ResponseWriter, message string, err error, defaultCode int) {
 	if _, ok := err.(path.ErrNoLink); ok {
 		webErrorWithCode(w, message, err, http.StatusNotFound)
@@ -452,12 +582,14 @@ var listingTemplate = `
 	</head>
 	<body>
 	<h2>Index of {{ .path }}</h2>
-	<ul>
-	<li><a href="./..">..</a></li>
-  {{ range .listing }}
-	<li><a href="{{ .Path }}">{{ .Name }}</a> - {{ .Size }} bytes</li>
+	<table>
+	{{ if .parent }}
+	<tr><td><a href="..">..</a></td><td></td></tr>
+	{{ end }}
+	{{ range .listing }}
+	<tr><td><a href="{{ .Href }}">{{ .Name }}</a></td><td>{{ .Size }}</td></tr>
 	{{ end }}
-	</ul>
+	</table>
 	</body>
 </html>
 `
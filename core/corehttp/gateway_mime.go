@@ -0,0 +1,65 @@
+package corehttp
+
+import (
+	"mime"
+	"net/url"
+	gopath "path"
+	"strings"
+)
+
+// extensionTypes covers the formats commonly served from the gateway, so
+// that their Content-Type does not depend on the mime.types of the host.
+// Other extensions fall back to the mime package, and content with no
+// known extension is sniffed by http.ServeContent.
+var extensionTypes = map[string]string{
+	".css":   "text/css; charset=utf-8",
+	".csv":   "text/csv; charset=utf-8",
+	".gif":   "image/gif",
+	".htm":   "text/html; charset=utf-8",
+	".html":  "text/html; charset=utf-8",
+	".ico":   "image/x-icon",
+	".jpeg":  "image/jpeg",
+	".jpg":   "image/jpeg",
+	".js":    "application/javascript",
+	".json":  "application/json",
+	".md":    "text/markdown; charset=utf-8",
+	".mp3":   "audio/mpeg",
+	".mp4":   "video/mp4",
+	".ogg":   "audio/ogg",
+	".pdf":   "application/pdf",
+	".png":   "image/png",
+	".svg":   "image/svg+xml",
+	".tar":   "application/x-tar",
+	".txt":   "text/plain; charset=utf-8",
+	".wasm":  "application/wasm",
+	".webm":  "video/webm",
+	".webp":  "image/webp",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".xml":   "text/xml; charset=utf-8",
+	".zip":   "application/zip",
+}
+
+// typeByExtension returns the Content-Type for the extension of name, or
+// "" if it is not known.
+func typeByExtension(name string) string {
+	ext := strings.ToLower(gopath.Ext(name))
+	if ext == "" {
+		return ""
+	}
+	if t, ok := extensionTypes[ext]; ok {
+		return t
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// contentDisposition formats a Content-Disposition header value, e.g.
+// `attachment; filename="cat.jpg"`. Names that can't be quoted are sent
+// percent-encoded as filename* (RFC 5987).
+func contentDisposition(disposition, filename string) string {
+	if v := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); v != "" {
+		return v
+	}
+	escaped := strings.Replace(url.QueryEscape(filename), "+", "%20", -1)
+	return disposition + "; filename*=UTF-8''" + escaped
+}
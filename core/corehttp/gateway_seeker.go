@@ -0,0 +1,60 @@
+package corehttp
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+)
+
+// lazySeeker serves a file to http.ServeContent, which answers Range
+// requests by seeking. Seeks are only recorded, and the DagReader is moved
+// when data is read, so that learning the size (by seeking to the end)
+// and skipping to a range fetch nothing but the blocks of the range.
+type lazySeeker struct {
+	dr     *uio.DagReader
+	size   int64
+	offset int64
+
+	// the offset of dr, which lags behind offset after a seek
+	read int64
+}
+
+func newLazySeeker(dr *uio.DagReader) *lazySeeker {
+	return &lazySeeker{dr: dr, size: dr.Size()}
+}
+
+func (ls *lazySeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case os.SEEK_SET:
+	case os.SEEK_CUR:
+		offset += ls.offset
+	case os.SEEK_END:
+		offset += ls.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	ls.offset = offset
+	return offset, nil
+}
+
+func (ls *lazySeeker) Read(p []byte) (int, error) {
+	if ls.offset >= ls.size {
+		return 0, io.EOF
+	}
+	if ls.offset != ls.read {
+		if _, err := ls.dr.Seek(ls.offset, os.SEEK_SET); err != nil {
+			return 0, err
+		}
+		ls.read = ls.offset
+	}
+
+	n, err := ls.dr.Read(p)
+	ls.offset += int64(n)
+	ls.read = ls.offset
+	return n, err
+}
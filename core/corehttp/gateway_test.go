@@ -1,14 +1,17 @@
 package corehttp
 
 import (
+	"bytes"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	core "github.com/ipfs/go-ipfs/core"
 	coreunix "github.com/ipfs/go-ipfs/core/coreunix"
 	namesys "github.com/ipfs/go-ipfs/namesys"
@@ -37,6 +40,10 @@ func (m mockNamesys) Publish(ctx context.Context, name ci.PrivKey, value path.Pa
 	return errors.New("not implemented for mockNamesys")
 }
 
+func (m mockNamesys) PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.Path, eol time.Time, ttl time.Duration) error {
+	return errors.New("not implemented for mockNamesys")
+}
+
 func newNodeWithMockNamesys(t *testing.T, ns mockNamesys) *core.IpfsNode {
 	c := config.Config{
 		Identity: config.Identity{
@@ -118,3 +125,403 @@ func TestGatewayGet(t *testing.T) {
 		}
 	}
 }
+
+func TestGatewayContentHeaders(t *testing.T) {
+	n := newNodeWithMockNamesys(t, mockNamesys{})
+	k, err := coreunix.Add(n, strings.NewReader("<html><body>fnord</body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := newGatewayHandler(n, GatewayConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		query       string
+		ctype       string
+		disposition string
+	}{
+		{"", "text/html; charset=utf-8", ""},
+		{"?filename=logo.svg", "image/svg+xml", `inline; filename=logo.svg`},
+		{"?filename=a b.txt&download=true", "text/plain; charset=utf-8", `attachment; filename="a b.txt"`},
+		{"?download=true", "text/html; charset=utf-8", "attachment; filename=" + k},
+	} {
+		r, err := http.NewRequest("GET", "/ipfs/"+k+test.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d", test.query, w.Code)
+		}
+		if ct := w.HeaderMap.Get("Content-Type"); ct != test.ctype {
+			t.Errorf("%s: expected Content-Type %q, got %q", test.query, test.ctype, ct)
+		}
+		if cd := w.HeaderMap.Get("Content-Disposition"); cd != test.disposition {
+			t.Errorf("%s: expected Content-Disposition %q, got %q", test.query, test.disposition, cd)
+		}
+	}
+}
+
+func TestGatewayRange(t *testing.T) {
+	n := newNodeWithMockNamesys(t, mockNamesys{})
+	data := make([]byte, 1024*1024)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	k, err := coreunix.Add(n, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the index page of a directory is served the same way.
+	index, _, err := coreunix.AddWrapped(n, strings.NewReader("<html><body>fnord</body></html>"), "index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := strings.TrimSuffix(index, "/index.html")
+
+	h, err := newGatewayHandler(n, GatewayConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		path   string
+		rng    string
+		status int
+		crange string
+		body   string
+	}{
+		{"/ipfs/" + k, "bytes=300000-300099", http.StatusPartialContent, "bytes 300000-300099/1048576", string(data[300000:300100])},
+		{"/ipfs/" + k, "bytes=-10", http.StatusPartialContent, "bytes 1048566-1048575/1048576", string(data[1048566:])},
+		{"/ipfs/" + k, "bytes=2000000-", http.StatusRequestedRangeNotSatisfiable, "", ""},
+		{"/ipfs/" + dir + "/", "bytes=6-11", http.StatusPartialContent, "bytes 6-11/31", "<body>"},
+	} {
+		r, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Range", test.rng)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Fatalf("%s %s: got status %d, expected %d", test.path, test.rng, w.Code, test.status)
+		}
+		if test.status != http.StatusPartialContent {
+			continue
+		}
+		if cr := w.HeaderMap.Get("Content-Range"); cr != test.crange {
+			t.Errorf("%s %s: expected Content-Range %q, got %q", test.path, test.rng, test.crange, cr)
+		}
+		if w.Body.String() != test.body {
+			t.Errorf("%s %s: unexpected body", test.path, test.rng)
+		}
+	}
+}
+
+func TestGatewayWritable(t *testing.T) {
+	n := newNodeWithMockNamesys(t, mockNamesys{})
+	h, err := newGatewayHandler(n, GatewayConfig{Writable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, p, body string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest(method, p, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	get := func(p string) string {
+		w := do("GET", p, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: got status %d: %s", p, w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+
+	w := do("POST", "/ipfs/", "fnord")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST: got status %d: %s", w.Code, w.Body)
+	}
+	loc := w.HeaderMap.Get("Location")
+	if loc != "/ipfs/"+w.HeaderMap.Get("IPFS-Hash") {
+		t.Fatalf("POST: Location %q doesn't match IPFS-Hash %q", loc, w.HeaderMap.Get("IPFS-Hash"))
+	}
+	if body := get(loc); body != "fnord" {
+		t.Fatalf("expected fnord, got %q", body)
+	}
+
+	// patch a file into directories that don't exist yet, then replace it.
+	empty := "/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn/"
+	if w := do("PUT", empty, ""); w.Code != http.StatusCreated {
+		t.Fatalf("PUT %s: got status %d: %s", empty, w.Code, w.Body)
+	}
+	w = do("PUT", empty+"a/b/file", "first")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", w.Code, w.Body)
+	}
+	root := w.HeaderMap.Get("IPFS-Hash")
+	if loc := w.HeaderMap.Get("Location"); loc != "/ipfs/"+root+"/a/b/file" {
+		t.Fatalf("PUT: unexpected Location %q", loc)
+	}
+	if body := get("/ipfs/" + root + "/a/b/file"); body != "first" {
+		t.Fatalf("expected first, got %q", body)
+	}
+
+	w = do("PUT", "/ipfs/"+root+"/a/b/file", "second")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("PUT: got status %d: %s", w.Code, w.Body)
+	}
+	if w.HeaderMap.Get("IPFS-Hash") == root {
+		t.Fatal("PUT of new content didn't change the root hash")
+	}
+	if body := get(w.HeaderMap.Get("Location")); body != "second" {
+		t.Fatalf("expected second, got %q", body)
+	}
+
+	for _, p := range []string{"/ipfs/" + root, "/ipns/example.com/file"} {
+		if w := do("PUT", p, "x"); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: got status %d, expected %d", p, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestGatewayDirectory(t *testing.T) {
+	n := newNodeWithMockNamesys(t, mockNamesys{})
+	writable, err := newGatewayHandler(n, GatewayConfig{Writable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(p, body string) string {
+		r, err := http.NewRequest("PUT", p, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		writable.ServeHTTP(w, r)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("PUT %s: got status %d: %s", p, w.Code, w.Body)
+		}
+		return "/ipfs/" + w.HeaderMap.Get("IPFS-Hash")
+	}
+	root := put("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn/docs/a%23b.txt", "fnord")
+	root = put(root+"/site/index.html", "<html><body>index</body></html>")
+
+	get := func(h *gatewayHandler, p string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest("GET", p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// directories are redirected to their path with a slash.
+	w := get(writable, root+"/docs?x=1")
+	if w.Code != http.StatusFound || w.HeaderMap.Get("Location") != "docs/?x=1" {
+		t.Fatalf("expected a redirect to docs/, got %d to %q", w.Code, w.HeaderMap.Get("Location"))
+	}
+
+	w = get(writable, root+"/docs/")
+	if w.Code != http.StatusOK {
+		t.Fatalf("listing: got status %d: %s", w.Code, w.Body)
+	}
+	for _, s := range []string{`<a href="a%23b.txt">a#b.txt</a>`, `<a href="..">..</a>`, "B</td>"} {
+		if !strings.Contains(w.Body.String(), s) {
+			t.Errorf("listing doesn't contain %q:\n%s", s, w.Body)
+		}
+	}
+	if w = get(writable, root+"/"); strings.Contains(w.Body.String(), `href=".."`) {
+		t.Errorf("the root listing links to its parent:\n%s", w.Body)
+	}
+
+	if w = get(writable, root+"/site/"); w.Body.String() != "<html><body>index</body></html>" {
+		t.Errorf("expected the index page, got %q", w.Body)
+	}
+
+	private, err := newGatewayHandler(n, GatewayConfig{NoDirListing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w = get(private, root+"/docs/"); w.Code != http.StatusForbidden {
+		t.Errorf("expected the listing to be forbidden, got %d", w.Code)
+	}
+	if w = get(private, root+"/site/"); w.Code != http.StatusOK {
+		t.Errorf("expected the index page to be served, got %d", w.Code)
+	}
+}
+
+func TestGatewaySubdomains(t *testing.T) {
+	ns := mockNamesys{}
+	n := newNodeWithMockNamesys(t, ns)
+	n.Repo.Config().Gateway.SubdomainHosts = []string{"localhost", "gateway.example.org"}
+	k, err := coreunix.Add(n, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h32 := encodeSubdomainLabel(key.B58KeyDecode(k).ToMultihash())
+	// the hostname is resolved with its prefix, the path without.
+	ns["example.com"] = path.FromString("/ipfs/" + k)
+	ns["/ipns/example.com"] = path.FromString("/ipfs/" + k)
+
+	h, err := makeHandler(n,
+		IPNSHostnameOption(),
+		GatewayOption(false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		host     string
+		path     string
+		status   int
+		text     string
+		location string
+	}{
+		{"localhost:8080", "/ipfs/" + k + "?x=1", http.StatusMovedPermanently, "", "http://" + h32 + ".ipfs.localhost:8080/?x=1"},
+		{"gateway.example.org", "/ipns/example.com", http.StatusOK, "fnord", ""},
+		{h32 + ".ipfs.localhost:8080", "/", http.StatusOK, "fnord", ""},
+		{strings.ToUpper(h32) + ".ipfs.gateway.example.org", "/", http.StatusOK, "fnord", ""},
+		{k + ".ipfs.localhost", "/", http.StatusOK, "fnord", ""},
+		{"nope.ipfs.localhost", "/", http.StatusBadRequest, "", ""},
+		{"example.com", "/", http.StatusOK, "fnord", ""},
+		{"127.0.0.1:8080", "/ipfs/" + k, http.StatusOK, "fnord", ""},
+	} {
+		r, err := http.NewRequest("GET", "http://"+test.host+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		urlstr := "http://" + test.host + test.path
+		if w.Code != test.status {
+			t.Errorf("got %d, expected %d from %s: %s", w.Code, test.status, urlstr, w.Body)
+			continue
+		}
+		if test.text != "" && w.Body.String() != test.text {
+			t.Errorf("unexpected response body from %s: expected %q; got %q", urlstr, test.text, w.Body)
+		}
+		if loc := w.HeaderMap.Get("Location"); loc != test.location {
+			t.Errorf("unexpected Location from %s: expected %q; got %q", urlstr, test.location, loc)
+		}
+	}
+}
+
+func TestGatewayCaching(t *testing.T) {
+	ns := mockNamesys{}
+	n := newNodeWithMockNamesys(t, ns)
+	k, err := coreunix.Add(n, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/example.com"] = path.FromString("/ipfs/" + k)
+	index, _, err := coreunix.AddWrapped(n, strings.NewReader("fnord"), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := strings.TrimSuffix(index, "/file")
+
+	h, err := newGatewayHandler(n, GatewayConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		path         string
+		etag         string
+		cacheControl string
+	}{
+		{"/ipfs/" + k, `"` + k + `"`, immutableCacheControl},
+		{"/ipfs/" + dir + "/file", `"` + k + `"`, immutableCacheControl},
+		{"/ipns/example.com", `"` + k + `"`, ipnsCacheControl},
+		{"/ipfs/" + dir + "/", `"DirIndex-` + dir + `"`, immutableCacheControl},
+	} {
+		for _, inm := range []string{"", test.etag, `"QmOther", W/` + test.etag, "*"} {
+			r, err := http.NewRequest("GET", test.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inm != "" {
+				r.Header.Set("If-None-Match", inm)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			status := http.StatusNotModified
+			if inm == "" {
+				status = http.StatusOK
+			}
+			if w.Code != status {
+				t.Errorf("%s (If-None-Match %s): expected %d, got %d", test.path, inm, status, w.Code)
+			}
+			if etag := w.HeaderMap.Get("Etag"); etag != test.etag {
+				t.Errorf("%s: expected Etag %s, got %s", test.path, test.etag, etag)
+			}
+			if cc := w.HeaderMap.Get("Cache-Control"); cc != test.cacheControl {
+				t.Errorf("%s: expected Cache-Control %q, got %q", test.path, test.cacheControl, cc)
+			}
+		}
+	}
+}
+
+func TestGatewayDenylist(t *testing.T) {
+	ns := mockNamesys{}
+	n := newNodeWithMockNamesys(t, ns)
+	denied, err := coreunix.Add(n, strings.NewReader("denied"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed, err := coreunix.Add(n, strings.NewReader("allowed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/example.com"] = path.FromString("/ipfs/" + denied)
+	ns["/ipns/example.org"] = path.FromString("/ipfs/" + allowed)
+
+	if err := n.Denylist.Add(denied, "/ipns/example.org/private"); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := newGatewayHandler(n, GatewayConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		path   string
+		status int
+	}{
+		{"/ipfs/" + denied, http.StatusGone},
+		{"/ipns/example.com", http.StatusGone},
+		{"/ipfs/" + allowed, http.StatusOK},
+		{"/ipns/example.org", http.StatusOK},
+		{"/ipns/example.org/private/a", http.StatusGone},
+	} {
+		r, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.path, test.status, w.Code)
+		}
+	}
+
+	if l := n.Denylist.AuditLog(); len(l) != 3 || l[0].Entry != denied || l[0].Source != "gateway" {
+		t.Fatalf("expected the 3 denied requests in the audit log, got %+v", l)
+	}
+}
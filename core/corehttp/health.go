@@ -0,0 +1,123 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	core "github.com/ipfs/go-ipfs/core"
+)
+
+const (
+	// LivenessPath answers 200 while the node runs, and 503 once it is
+	// shutting down.
+	LivenessPath = "/livez"
+	// ReadinessPath answers 200 once the node is ready to serve, and 503
+	// until then, along with the state of each of its checks.
+	ReadinessPath = "/readyz"
+)
+
+// healthDatastoreKey is the key the readiness check looks up, to see the
+// datastore answers.
+var healthDatastoreKey = ds.NewKey("/local/health")
+
+// HealthCheck is the state of one part of the node.
+type HealthCheck struct {
+	OK     bool
+	Detail string `json:",omitempty"`
+}
+
+// Readiness is the state of the node, by check: "repo", "swarm",
+// "bootstrap" and "api".
+type Readiness struct {
+	Ready  bool
+	Checks map[string]HealthCheck
+}
+
+// HealthOption serves the liveness and readiness of the node, for
+// orchestrators like Kubernetes or systemd to health check it. started
+// is closed once the daemon is done starting its servers.
+func HealthOption(started <-chan struct{}) ServeOption {
+	return func(n *core.IpfsNode, mux *http.ServeMux) (*http.ServeMux, error) {
+		mux.HandleFunc(LivenessPath, func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-n.Context().Done():
+				http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			default:
+				fmt.Fprintln(w, "ok")
+			}
+		})
+		mux.HandleFunc(ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+			rd := readiness(n, started)
+			w.Header().Set("Content-Type", "application/json")
+			if !rd.Ready {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			json.NewEncoder(w).Encode(rd)
+		})
+		return mux, nil
+	}
+}
+
+// readiness checks the repo is open, the swarm is listening, the node is
+// connected to peers once it bootstraps, and the daemon started.
+func readiness(n *core.IpfsNode, started <-chan struct{}) *Readiness {
+	checks := map[string]HealthCheck{
+		"repo":      repoCheck(n),
+		"swarm":     swarmCheck(n),
+		"bootstrap": bootstrapCheck(n),
+		"api":       {OK: true},
+	}
+	select {
+	case <-started:
+	default:
+		checks["api"] = HealthCheck{Detail: "the daemon is starting"}
+	}
+
+	rd := &Readiness{Ready: true, Checks: checks}
+	for _, c := range checks {
+		rd.Ready = rd.Ready && c.OK
+	}
+	return rd
+}
+
+func repoCheck(n *core.IpfsNode) HealthCheck {
+	if n.Repo == nil {
+		return HealthCheck{Detail: "the repo is not open"}
+	}
+	if _, err := n.Repo.Datastore().Has(healthDatastoreKey); err != nil {
+		return HealthCheck{Detail: fmt.Sprintf("the datastore fails: %s", err)}
+	}
+	return HealthCheck{OK: true}
+}
+
+func swarmCheck(n *core.IpfsNode) HealthCheck {
+	if !n.OnlineMode() {
+		return HealthCheck{OK: true, Detail: "offline"}
+	}
+	if n.PeerHost == nil {
+		return HealthCheck{Detail: "the swarm is not set up"}
+	}
+	addrs := n.PeerHost.Network().ListenAddresses()
+	if len(addrs) == 0 {
+		return HealthCheck{Detail: "the swarm is not listening"}
+	}
+	return HealthCheck{OK: true, Detail: fmt.Sprintf("listening on %d addresses", len(addrs))}
+}
+
+// bootstrapCheck is ready once the node is connected to a peer, or has no
+// peers to bootstrap to. The detail tells how far it got towards the
+// peers it bootstraps to.
+func bootstrapCheck(n *core.IpfsNode) HealthCheck {
+	if !n.OnlineMode() || n.PeerHost == nil {
+		return HealthCheck{OK: true, Detail: "offline"}
+	}
+
+	connected := len(n.PeerHost.Network().Peers())
+	detail := fmt.Sprintf("connected to %d of %d peers", connected, core.DefaultBootstrapConfig.MinPeerThreshold)
+	if connected == 0 && len(n.BootstrapList()) > 0 {
+		return HealthCheck{Detail: detail}
+	}
+	return HealthCheck{OK: true, Detail: detail}
+}
@@ -0,0 +1,62 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	n := newNodeWithMockNamesys(t, mockNamesys{})
+	started := make(chan struct{})
+	h, err := makeHandler(n, HealthOption(started))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest("GET", "http://localhost"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	readiness := func(code int) Readiness {
+		w := get(ReadinessPath)
+		if w.Code != code {
+			t.Fatalf("expected %d, got %d: %s", code, w.Code, w.Body)
+		}
+		var rd Readiness
+		if err := json.Unmarshal(w.Body.Bytes(), &rd); err != nil {
+			t.Fatal(err)
+		}
+		return rd
+	}
+
+	if w := get(LivenessPath); w.Code != http.StatusOK {
+		t.Fatalf("expected the node to be live, got %d", w.Code)
+	}
+
+	rd := readiness(http.StatusServiceUnavailable)
+	if rd.Ready || rd.Checks["api"].OK {
+		t.Fatalf("expected the node not to be ready while it starts, got %+v", rd)
+	}
+	for _, c := range []string{"repo", "swarm", "bootstrap"} {
+		if !rd.Checks[c].OK {
+			t.Fatalf("expected the %s check of an offline node to pass, got %+v", c, rd.Checks[c])
+		}
+	}
+
+	close(started)
+	if rd := readiness(http.StatusOK); !rd.Ready {
+		t.Fatalf("expected the node to be ready, got %+v", rd)
+	}
+
+	n.Close()
+	if w := get(LivenessPath); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a closed node not to be live, got %d", w.Code)
+	}
+}
@@ -1,16 +1,18 @@
 package corehttp
 
 import (
+	"encoding/base32"
 	"net/http"
 	"strings"
 
 	isd "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-is-domain"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	"github.com/ipfs/go-ipfs/core"
 )
 
 // IPNSHostnameOption rewrites an incoming request if its Host: header contains
-// an IPNS name.
+// an IPNS name, or is a subdomain of a host in Gateway.SubdomainHosts.
 // The rewritten request points at the resolved name on the gateway handler.
 func IPNSHostnameOption() ServeOption {
 	return func(n *core.IpfsNode, mux *http.ServeMux) (*http.ServeMux, error) {
@@ -20,7 +22,22 @@ func IPNSHostnameOption() ServeOption {
 			defer cancel()
 
 			host := strings.SplitN(r.Host, ":", 2)[0]
-			if len(host) > 0 && isd.IsDomain(host) {
+
+			// read for each request, so that changes to the config
+			// apply without a restart.
+			subdomainHosts := n.Repo.Config().Gateway.SubdomainHosts
+			if prefix, ok, err := subdomainPath(host, subdomainHosts); ok {
+				if err != nil {
+					webErrorWithCode(w, "Invalid subdomain", err, http.StatusBadRequest)
+					return
+				}
+				r.URL.Path = prefix + r.URL.Path
+			} else if location, ok := subdomainRedirect(r, host, subdomainHosts); ok {
+				// path gateway requests are moved to their subdomain,
+				// which gives each its own origin in the browser.
+				http.Redirect(w, r, location, http.StatusMovedPermanently)
+				return
+			} else if len(host) > 0 && isd.IsDomain(host) {
 				name := "/ipns/" + host
 				if _, err := n.Namesys.Resolve(ctx, name); err == nil {
 					r.URL.Path = name + r.URL.Path
@@ -31,3 +48,95 @@ func IPNSHostnameOption() ServeOption {
 		return childMux, nil
 	}
 }
+
+// subdomainPath returns the path which host, of the form
+// <hash>.ipfs.<gateway> or <hash>.ipns.<gateway> with gateway one of
+// gateways, serves, and true; or false if host isn't of that form.
+func subdomainPath(host string, gateways []string) (string, bool, error) {
+	lower := strings.ToLower(host)
+	for _, gw := range gateways {
+		suffix := "." + strings.ToLower(gw)
+		if !strings.HasSuffix(lower, suffix) {
+			continue
+		}
+
+		// the label keeps its case, which base58 needs.
+		rest := host[:len(host)-len(suffix)]
+		i := strings.LastIndex(rest, ".")
+		if i < 0 {
+			continue
+		}
+		label, ns := rest[:i], strings.ToLower(rest[i+1:])
+		if ns != "ipfs" && ns != "ipns" {
+			continue
+		}
+
+		h, err := decodeSubdomainLabel(label)
+		if err != nil {
+			return "", true, err
+		}
+		return "/" + ns + "/" + h.B58String(), true, nil
+	}
+	return "", false, nil
+}
+
+// subdomainRedirect returns the location on its subdomain of the path
+// gateway request r to host, one of gateways, and true; or false if r
+// can't be served from a subdomain.
+func subdomainRedirect(r *http.Request, host string, gateways []string) (string, bool) {
+	isGateway := false
+	for _, gw := range gateways {
+		if strings.EqualFold(host, gw) {
+			isGateway = true
+			break
+		}
+	}
+	if !isGateway {
+		return "", false
+	}
+
+	parts := strings.SplitN(r.URL.Path, "/", 4)
+	if len(parts) < 3 || (parts[1] != "ipfs" && parts[1] != "ipns") {
+		return "", false
+	}
+	// IPNS names which are domains don't fit in a label.
+	h, err := mh.FromB58String(parts[2])
+	if err != nil {
+		return "", false
+	}
+
+	u := *r.URL
+	u.Scheme = "http"
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	u.Host = encodeSubdomainLabel(h) + "." + parts[1] + "." + r.Host
+	u.Path = "/"
+	if len(parts) == 4 {
+		u.Path += parts[3]
+	}
+	return u.String(), true
+}
+
+// hashes are put in subdomains in lower case base32, as hostnames are
+// not case sensitive and so can't hold base58.
+var subdomainEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567")
+
+func encodeSubdomainLabel(h mh.Multihash) string {
+	return strings.TrimRight(subdomainEncoding.EncodeToString(h), "=")
+}
+
+// decodeSubdomainLabel returns the multihash of label, in base32 or, for
+// clients which keep the case of hostnames, base58.
+func decodeSubdomainLabel(label string) (mh.Multihash, error) {
+	padded := strings.ToLower(label)
+	if n := len(padded) % 8; n != 0 {
+		padded += strings.Repeat("=", 8-n)
+	}
+	if b, err := subdomainEncoding.DecodeString(padded); err == nil {
+		if h, err := mh.Cast(b); err == nil {
+			return h, nil
+		}
+	}
+	return mh.FromB58String(label)
+}
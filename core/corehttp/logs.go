@@ -6,6 +6,7 @@ import (
 
 	core "github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/thirdparty/eventlog"
+	util "github.com/ipfs/go-ipfs/util"
 )
 
 type writeErrNotifier struct {
@@ -41,6 +42,7 @@ func LogOption() ServeOption {
 			w.WriteHeader(200)
 			wnf, errs := newWriteErrNotifier(w)
 			eventlog.WriterGroup.AddWriter(wnf)
+			util.AddLogWriter(wnf)
 			log.Event(n.Context(), "log API client connected")
 			<-errs
 		})
@@ -0,0 +1,120 @@
+package corehttp
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	metrics "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/codahale/metrics"
+	core "github.com/ipfs/go-ipfs/core"
+)
+
+// histogramQuantiles are the gauges codahale/metrics adds for each
+// histogram, by the suffix of their name, and the quantiles they are.
+var histogramQuantiles = []struct {
+	suffix   string
+	quantile string
+}{
+	{".P50", "0.5"},
+	{".P75", "0.75"},
+	{".P90", "0.9"},
+	{".P95", "0.95"},
+	{".P99", "0.99"},
+	{".P999", "0.999"},
+}
+
+// PrometheusOption serves the counters, gauges and histograms of the
+// process on path, in the text format Prometheus scrapes. They're those of
+// /debug/vars, by the same names with '_' in place of the characters
+// Prometheus doesn't allow; histograms are summaries.
+func PrometheusOption(path string) ServeOption {
+	return func(n *core.IpfsNode, mux *http.ServeMux) (*http.ServeMux, error) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			counters, gauges := metrics.Snapshot()
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			w.Write(prometheusText(counters, gauges))
+		})
+		return mux, nil
+	}
+}
+
+type promFamily struct {
+	typ     string
+	samples []string
+}
+
+func prometheusText(counters map[string]uint64, gauges map[string]int64) []byte {
+	families := make(map[string]*promFamily)
+	add := func(typ, name, labels string, v interface{}) {
+		name, peer := promName(name)
+		if peer != "" {
+			labels = appendLabel(labels, "peer", peer)
+		}
+		f, ok := families[name]
+		if !ok {
+			f = &promFamily{typ: typ}
+			families[name] = f
+		}
+		if labels != "" {
+			labels = "{" + labels + "}"
+		}
+		f.samples = append(f.samples, fmt.Sprintf("%s%s %v", name, labels, v))
+	}
+
+	for name, v := range counters {
+		add("counter", name, "", v)
+	}
+gauges:
+	for name, v := range gauges {
+		for _, q := range histogramQuantiles {
+			if strings.HasSuffix(name, q.suffix) {
+				add("summary", strings.TrimSuffix(name, q.suffix), appendLabel("", "quantile", q.quantile), v)
+				continue gauges
+			}
+		}
+		add("gauge", name, "", v)
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		f := families[name]
+		sort.Strings(f.samples)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", name, f.typ)
+		for _, s := range f.samples {
+			buf.WriteString(s + "\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// promName returns the Prometheus name of the metric called name, and the
+// peer ID in name, if any: the metrics of fsrepo are named after the peer
+// of the repo, as "fsrepo.<peer>.usage", which is a label in Prometheus.
+func promName(name string) (string, string) {
+	var peer string
+	if parts := strings.SplitN(name, ".", 3); len(parts) == 3 && parts[0] == "fsrepo" {
+		name, peer = parts[0]+"."+parts[2], parts[1]
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name), peer
+}
+
+func appendLabel(labels, name, value string) string {
+	l := fmt.Sprintf("%s=%q", name, value)
+	if labels == "" {
+		return l
+	}
+	return labels + "," + l
+}
@@ -0,0 +1,24 @@
+package corehttp
+
+import "testing"
+
+func TestPrometheusText(t *testing.T) {
+	counters := map[string]uint64{"bitswap.BlocksReceived": 3}
+	gauges := map[string]int64{
+		"fsrepo.QmPeer.usage": 1024,
+		"dht.Query.ms.P50":    5,
+		"dht.Query.ms.P999":   90,
+	}
+
+	expected := `# TYPE bitswap_BlocksReceived counter
+bitswap_BlocksReceived 3
+# TYPE dht_Query_ms summary
+dht_Query_ms{quantile="0.5"} 5
+dht_Query_ms{quantile="0.999"} 90
+# TYPE fsrepo_usage gauge
+fsrepo_usage{peer="QmPeer"} 1024
+`
+	if out := string(prometheusText(counters, gauges)); out != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
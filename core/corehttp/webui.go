@@ -1,5 +1,21 @@
 package corehttp
 
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+	core "github.com/ipfs/go-ipfs/core"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	path "github.com/ipfs/go-ipfs/path"
+	pin "github.com/ipfs/go-ipfs/pin"
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
 // TODO: move to IPNS
 const WebUIPath = "/ipfs/QmS2HL9v5YeKgQkkWMvs1EMnFtUowTEdFfSSeMT4pos1e6"
 
@@ -13,4 +29,101 @@ var WebUIPaths = []string{
 	"/ipfs/QmctngrQAt9fjpQUZr7Bx3BsXUcif52eZGTizWhvcShsjz",
 }
 
-var WebUIOption = RedirectOption("webui", WebUIPath)
+// webUIPinLabel is the label of the pins of the webui.
+const webUIPinLabel = "webui"
+
+// ConfiguredWebUIPath returns the path of the webui to serve: the one of
+// API.WebUI, a hash or an /ipfs/ path, or else the one of the release.
+func ConfiguredWebUIPath(cfg *config.Config) (string, error) {
+	if cfg.API.WebUI == "" {
+		return WebUIPath, nil
+	}
+	p, err := path.ParsePath(cfg.API.WebUI)
+	if err != nil {
+		return "", fmt.Errorf("invalid API.WebUI %q: %s", cfg.API.WebUI, err)
+	}
+	if !strings.HasPrefix(p.String(), "/ipfs/") {
+		return "", fmt.Errorf("invalid API.WebUI %q: the webui must be an /ipfs/ path", cfg.API.WebUI)
+	}
+	return p.String(), nil
+}
+
+// IsWebUIPath returns whether p is under the path of a webui, of the
+// release, a past one, or the one of the config.
+func IsWebUIPath(cfg *config.Config, p string) bool {
+	paths := WebUIPaths
+	if custom, err := ConfiguredWebUIPath(cfg); err == nil {
+		paths = append([]string{custom}, paths...)
+	}
+	for _, webuipath := range paths {
+		if p == webuipath || strings.HasPrefix(p, webuipath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// WebUIOrigins returns the origins of the webui served by the API at addr,
+// for the API to allow its requests.
+func WebUIOrigins(addr ma.Multiaddr) ([]string, error) {
+	na, err := manet.ToNetAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	tcp, ok := na.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("the API address %s is not a tcp one", addr)
+	}
+
+	port := fmt.Sprint(tcp.Port)
+	if tcp.IP.IsLoopback() || tcp.IP.IsUnspecified() {
+		return []string{
+			"http://" + net.JoinHostPort("127.0.0.1", port),
+			"http://" + net.JoinHostPort("localhost", port),
+		}, nil
+	}
+	return []string{"http://" + net.JoinHostPort(tcp.IP.String(), port)}, nil
+}
+
+// WebUIOption redirects /webui to the webui of the config, and pins it in
+// the background the first time, so that it stays around once fetched.
+func WebUIOption(n *core.IpfsNode, mux *http.ServeMux) (*http.ServeMux, error) {
+	mux.Handle("/webui/", &webUIHandler{node: n, pinned: make(map[string]bool)})
+	return mux, nil
+}
+
+type webUIHandler struct {
+	node *core.IpfsNode
+
+	mx     sync.Mutex
+	pinned map[string]bool
+}
+
+func (h *webUIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, err := ConfiguredWebUIPath(h.node.Repo.Config())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.pin(p)
+	http.Redirect(w, r, p, http.StatusFound)
+}
+
+// pin queues the webui at p to be pinned, unless it was already.
+func (h *webUIHandler) pin(p string) {
+	if h.node.PinQueue == nil {
+		return
+	}
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	if h.pinned[p] {
+		return
+	}
+	label := &pin.Label{Name: webUIPinLabel}
+	if _, err := corerepo.PinBackground(h.node, []string{p}, true, label); err != nil {
+		log.Warningf("pinning the webui %s: %s", p, err)
+		return
+	}
+	h.pinned[p] = true
+}
@@ -0,0 +1,65 @@
+package corehttp
+
+import (
+	"reflect"
+	"testing"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+const customWebUI = "/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"
+
+func TestConfiguredWebUIPath(t *testing.T) {
+	cfg := &config.Config{}
+	if p, err := ConfiguredWebUIPath(cfg); err != nil || p != WebUIPath {
+		t.Fatalf("expected the webui of the release, got %q (%v)", p, err)
+	}
+
+	for _, webui := range []string{customWebUI, "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"} {
+		cfg.API.WebUI = webui
+		if p, err := ConfiguredWebUIPath(cfg); err != nil || p != customWebUI {
+			t.Fatalf("%s: expected %s, got %q (%v)", webui, customWebUI, p, err)
+		}
+	}
+
+	for _, bad := range []string{"/ipns/example.com", "nothash"} {
+		cfg.API.WebUI = bad
+		if _, err := ConfiguredWebUIPath(cfg); err == nil {
+			t.Fatalf("expected %s to be refused", bad)
+		}
+	}
+}
+
+func TestIsWebUIPath(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.API.WebUI = customWebUI
+
+	for _, p := range []string{WebUIPath + "/index.html", WebUIPaths[1], customWebUI + "/app.js"} {
+		if !IsWebUIPath(cfg, p) {
+			t.Fatalf("expected %s to be a webui path", p)
+		}
+	}
+	for _, p := range []string{"/ipfs/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n", customWebUI + "more"} {
+		if IsWebUIPath(cfg, p) {
+			t.Fatalf("expected %s not to be a webui path", p)
+		}
+	}
+}
+
+func TestWebUIOrigins(t *testing.T) {
+	cases := map[string][]string{
+		"/ip4/127.0.0.1/tcp/5001": {"http://127.0.0.1:5001", "http://localhost:5001"},
+		"/ip4/0.0.0.0/tcp/5001":   {"http://127.0.0.1:5001", "http://localhost:5001"},
+		"/ip4/10.0.0.2/tcp/5001":  {"http://10.0.0.2:5001"},
+	}
+	for addr, expected := range cases {
+		origins, err := WebUIOrigins(ma.StringCast(addr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(origins, expected) {
+			t.Fatalf("%s: expected %v, got %v", addr, expected, origins)
+		}
+	}
+}
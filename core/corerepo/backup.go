@@ -0,0 +1,241 @@
+package corerepo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	"github.com/ipfs/go-ipfs/core"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	path "github.com/ipfs/go-ipfs/path"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	seal "github.com/ipfs/go-ipfs/util/seal"
+)
+
+// BackupVersion is the version of the bundle format written by WriteBackup.
+const BackupVersion = 1
+
+const backupMagic = "ipfs-backup\n"
+
+// ErrBadPassphrase is returned when a backup cannot be decrypted.
+var ErrBadPassphrase = errors.New("backup: wrong passphrase or corrupted bundle")
+
+var errNoPassphrase = errors.New("backup: a passphrase is required")
+
+// Backup holds everything needed to recreate a node on another machine,
+// except for the blocks themselves, which are re-fetched by pin.
+type Backup struct {
+	Version int
+	Created time.Time
+
+	// Config is the node config, including the identity's private key,
+	// but not the secrets written in it, as config.RemoveSecrets removes.
+	Config map[string]interface{}
+
+	RecursivePins []string
+	DirectPins    []string
+
+	// IpnsRoot is the root of the node's mutable ipns filesystem, if it
+	// was mounted when the backup was taken.
+	IpnsRoot string `json:",omitempty"`
+
+	// FilesRoot is the root of the 'ipfs files' tree.
+	FilesRoot string `json:",omitempty"`
+
+	// Keys are the marshalled private keys of the keystore, by name.
+	Keys map[string][]byte `json:",omitempty"`
+}
+
+// NewBackup collects the config, keystore, pinset, ipns filesystem root
+// and 'ipfs files' root of n.
+func NewBackup(n *core.IpfsNode) (*Backup, error) {
+	cfg, err := config.ToMap(n.Repo.Config())
+	if err != nil {
+		return nil, err
+	}
+	config.RemoveSecrets(cfg)
+
+	b := &Backup{
+		Version: BackupVersion,
+		Created: time.Now(),
+		Config:  cfg,
+	}
+	if ks := n.Repo.Keystore(); ks != nil {
+		names, err := ks.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			sk, err := ks.Get(name)
+			if err != nil {
+				return nil, err
+			}
+			kb, err := ci.MarshalPrivateKey(sk)
+			if err != nil {
+				return nil, err
+			}
+			if b.Keys == nil {
+				b.Keys = make(map[string][]byte)
+			}
+			b.Keys[name] = kb
+		}
+	}
+	for _, k := range n.Pinning.RecursiveKeys() {
+		b.RecursivePins = append(b.RecursivePins, k.B58String())
+	}
+	for _, k := range n.Pinning.DirectKeys() {
+		b.DirectPins = append(b.DirectPins, k.B58String())
+	}
+
+	if n.FilesRoot != nil {
+		k, err := n.FilesRoot.GetNode().Key()
+		if err != nil {
+			return nil, err
+		}
+		b.FilesRoot = k.B58String()
+	}
+
+	if n.IpnsFs != nil {
+		if root, err := n.IpnsFs.GetRoot(n.Identity.Pretty()); err == nil {
+			nd, err := root.GetValue().GetNode()
+			if err != nil {
+				return nil, err
+			}
+			k, err := nd.Key()
+			if err != nil {
+				return nil, err
+			}
+			b.IpnsRoot = k.B58String()
+		}
+	}
+	return b, nil
+}
+
+// WriteBackup encrypts b with a key derived from passphrase and writes the
+// bundle to w.
+func WriteBackup(w io.Writer, b *Backup, passphrase string) error {
+	if passphrase == "" {
+		return errNoPassphrase
+	}
+	plain, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	data, err := seal.Seal(plain, passphrase, backupMagic)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadBackup decrypts and decodes a bundle written by WriteBackup.
+func ReadBackup(r io.Reader, passphrase string) (*Backup, error) {
+	if passphrase == "" {
+		return nil, errNoPassphrase
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := seal.Open(data, passphrase, backupMagic)
+	switch err {
+	case nil:
+	case seal.ErrNotSealed:
+		return nil, errors.New("backup: not an ipfs backup bundle")
+	case seal.ErrBadPassphrase:
+		return nil, ErrBadPassphrase
+	default:
+		return nil, err
+	}
+
+	b := new(Backup)
+	if err := json.Unmarshal(plain, b); err != nil {
+		return nil, err
+	}
+	if b.Version != BackupVersion {
+		return nil, fmt.Errorf("backup: unsupported bundle version %d", b.Version)
+	}
+	return b, nil
+}
+
+// RestoreKeys puts the keys recorded in b into ks, the keystore of the
+// repo recreated from b's config.
+func RestoreKeys(ks keystore.Keystore, b *Backup) error {
+	for name, kb := range b.Keys {
+		sk, err := ci.UnmarshalPrivateKey(kb)
+		if err != nil {
+			return fmt.Errorf("backup: key %s: %s", name, err)
+		}
+		if err := ks.Put(name, sk); err != nil {
+			return fmt.Errorf("backup: key %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// RestorePins pins, fetching as needed, everything recorded in b, restores
+// the 'ipfs files' root, and republishes the ipns filesystem root under the
+// node's name. n must be
+// the node recreated from b's config. Progress is reported on the returned
+// channel, which is closed when done.
+func RestorePins(ctx context.Context, n *core.IpfsNode, b *Backup) <-chan string {
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		report := func(format string, a ...interface{}) {
+			select {
+			case out <- fmt.Sprintf(format, a...):
+			case <-ctx.Done():
+			}
+		}
+
+		pin := func(keys []string, recursive bool) {
+			for _, k := range keys {
+				if _, err := Pin(n, []string{k}, recursive); err != nil {
+					report("failed to pin %s: %s", k, err)
+					continue
+				}
+				report("pinned %s", k)
+			}
+		}
+		pin(b.RecursivePins, true)
+		pin(b.DirectPins, false)
+
+		if b.FilesRoot != "" {
+			k := key.B58KeyDecode(b.FilesRoot)
+			nd, err := n.DAG.Get(ctx, k)
+			if err == nil {
+				err = n.SetFilesRoot(ctx, nd)
+			}
+			if err != nil {
+				report("failed to restore the files root %s: %s", k, err)
+			} else {
+				report("restored the files root %s", k)
+			}
+		}
+
+		if b.IpnsRoot == "" || n.Namesys == nil {
+			return
+		}
+		p := path.FromKey(key.B58KeyDecode(b.IpnsRoot))
+		if _, err := Pin(n, []string{p.String()}, true); err != nil {
+			report("failed to pin ipns root %s: %s", p, err)
+			return
+		}
+		if err := n.Namesys.Publish(ctx, n.PrivateKey, p); err != nil {
+			report("failed to republish ipns root %s: %s", p, err)
+			return
+		}
+		report("published %s to %s", p, n.Identity.Pretty())
+	}()
+	return out
+}
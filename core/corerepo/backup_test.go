@@ -0,0 +1,172 @@
+package corerepo
+
+import (
+	"bytes"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/ipfs/go-ipfs/core"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	merkledag "github.com/ipfs/go-ipfs/merkledag"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	repo "github.com/ipfs/go-ipfs/repo"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+)
+
+func TestBackupRoundTrip(t *testing.T) {
+	b := &Backup{
+		Version:       BackupVersion,
+		Config:        map[string]interface{}{"Identity": map[string]interface{}{"PeerID": "QmFoo"}},
+		RecursivePins: []string{"QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := WriteBackup(buf, b, "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("QmFoo")) {
+		t.Fatal("bundle should not contain plaintext config")
+	}
+
+	if _, err := ReadBackup(bytes.NewReader(buf.Bytes()), "wrong"); err != ErrBadPassphrase {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+
+	out, err := ReadBackup(bytes.NewReader(buf.Bytes()), "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.RecursivePins) != 1 || out.RecursivePins[0] != b.RecursivePins[0] {
+		t.Fatalf("pins did not survive the round trip: %v", out.RecursivePins)
+	}
+}
+
+func TestBackupFilesRoot(t *testing.T) {
+	ctx := context.Background()
+	from, err := core.NewNodeBuilder().Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close()
+
+	file := &merkledag.Node{Data: []byte("a file")}
+	dir := uio.NewEmptyDirectory()
+	if err := dir.AddNodeLinkClean("file", file); err != nil {
+		t.Fatal(err)
+	}
+	for _, nd := range []*merkledag.Node{file, dir} {
+		if _, err := from.DAG.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := from.SetFilesRoot(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+	dirk, err := dir.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewBackup(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.FilesRoot != dirk.B58String() {
+		t.Fatalf("expected the files root %s in the backup, got %q", dirk, b.FilesRoot)
+	}
+
+	to, err := core.NewNodeBuilder().Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+	// as if fetched from the network
+	for _, nd := range []*merkledag.Node{file, dir} {
+		if _, err := to.DAG.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _ = range RestorePins(ctx, to, b) {
+	}
+
+	got, err := to.FilesRoot.GetNode().Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != dirk || !to.Pinning.IsPinned(dirk) {
+		t.Fatalf("expected the files root %s restored and pinned, got %s", dirk, got)
+	}
+}
+
+func TestBackupKeys(t *testing.T) {
+	ctx := context.Background()
+	n, err := core.NewNodeBuilder().Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	ks := keystore.NewMemKeystore()
+	n.Repo.(*repo.Mock).K = ks
+
+	sk, _, err := ci.GenerateKeyPair(ci.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("mykey", sk); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewBackup(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteBackup(buf, b, "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	b, err = ReadBackup(buf, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := keystore.NewMemKeystore()
+	if err := RestoreKeys(restored, b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := restored.Get("mykey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equals(sk) {
+		t.Fatal("expected the key restored from the backup")
+	}
+}
+
+func TestBackupLeavesOutSecrets(t *testing.T) {
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	n.Repo.(*repo.Mock).C.Pinning.RemoteServices = map[string]config.RemotePinningService{
+		"pinner": {Endpoint: "https://pinning.example.com", Key: "token"},
+		"other":  {Endpoint: "https://other.example.com", Key: "env:PINNER_KEY"},
+	}
+
+	b, err := NewBackup(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.FromMap(b.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := cfg.Pinning.RemoteServices
+	if services["pinner"].Key != "" || services["other"].Key != "env:PINNER_KEY" {
+		t.Fatalf("expected the written key only left out, got %+v", services)
+	}
+	if n.Repo.Config().Pinning.RemoteServices["pinner"].Key != "token" {
+		t.Fatal("expected the config of the node unchanged")
+	}
+}
@@ -0,0 +1,153 @@
+package corerepo
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	"github.com/ipfs/go-ipfs/core"
+	erasure "github.com/ipfs/go-ipfs/erasure"
+	pin "github.com/ipfs/go-ipfs/pin"
+	remote "github.com/ipfs/go-ipfs/pin/remote"
+)
+
+// erasureLabel is the name of the label of the pins of erasure coding
+// manifests, whose "root" metadata is the key of the DAG they code.
+const erasureLabel = "erasure"
+
+// ParseReplication returns k and n of a replication of the form "k/n": k
+// data blocks to n blocks in all, with parity.
+func ParseReplication(s string) (k, n int, err error) {
+	parts := strings.Split(s, "/")
+	if len(parts) == 2 {
+		k, err = strconv.Atoi(parts[0])
+		if err == nil {
+			n, err = strconv.Atoi(parts[1])
+		}
+		if err == nil {
+			_, err = erasure.New(k, n)
+		}
+		if err == nil {
+			return k, n, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid replication %q: expected k/n, with 1 <= k < n <= 256", s)
+}
+
+// PinErasure erasure codes the DAG under root, which n pins recursively,
+// k blocks at a time with n-k parity shards. The manifest of the coding is
+// pinned recursively, along with the parity shards. The remote pinning
+// services of the config are asked to pin the manifest, and the parity
+// shards in turn, so that the DAG can be repaired out of them when blocks
+// are lost. It returns the key of the manifest.
+func PinErasure(ctx context.Context, n *core.IpfsNode, root key.Key, k, nn int) (key.Key, error) {
+	defer n.GCLocker.PinLock()()
+	m, err := erasure.Encode(ctx, n.Blocks, n.DAG, root, k, nn)
+	if err != nil {
+		return "", fmt.Errorf("pin: erasure coding %s: %s", root, err)
+	}
+
+	services := n.Repo.Config().Pinning.RemoteServices
+	for name := range services {
+		m.Services = append(m.Services, name)
+	}
+	sort.Strings(m.Services)
+
+	nd, err := m.Node()
+	if err != nil {
+		return "", err
+	}
+	mk, err := n.DAG.Add(nd)
+	if err != nil {
+		return "", err
+	}
+	if err := n.Pinning.Pin(ctx, nd, true); err != nil {
+		return "", fmt.Errorf("pin: %s", err)
+	}
+	err = n.Pinning.SetLabel(mk, pin.Label{
+		Name: erasureLabel,
+		Meta: map[string]string{
+			"root":        root.B58String(),
+			"replication": fmt.Sprintf("%d/%d", k, nn),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("pin: %s", err)
+	}
+	if err := n.Pinning.Flush(); err != nil {
+		return "", err
+	}
+
+	var origins []string
+	if n.PeerHost != nil {
+		for _, a := range n.PeerHost.Addrs() {
+			origins = append(origins, a.String()+"/ipfs/"+n.Identity.Pretty())
+		}
+	}
+	clients := make(map[string]*remote.Client)
+	for name, s := range services {
+		c := remote.NewClient(s.Endpoint, s.Key)
+		clients[name] = c
+		_, err := c.Add(ctx, remote.Pin{
+			Cid:     mk.B58String(),
+			Name:    root.B58String() + " erasure manifest",
+			Origins: origins,
+		})
+		if err != nil {
+			return mk, fmt.Errorf("pin: asking %s to pin the erasure manifest: %s", name, err)
+		}
+	}
+	for i, g := range m.Groups {
+		for j, p := range g.Parity {
+			name := m.Service(i, j)
+			if name == "" {
+				continue
+			}
+			_, err := clients[name].Add(ctx, remote.Pin{
+				Cid:     p.B58String(),
+				Name:    fmt.Sprintf("%s parity %d.%d", root, i, j),
+				Origins: origins,
+			})
+			if err != nil {
+				return mk, fmt.Errorf("pin: asking %s to pin parity of %s: %s", name, root, err)
+			}
+		}
+	}
+
+	notifyHooks(n, newHookEvent(n, HookPin, []key.Key{mk}))
+	return mk, nil
+}
+
+// ErasureManifests returns the keys of the erasure coding manifests pinned
+// by n, by the key of the DAG they code.
+func ErasureManifests(n *core.IpfsNode) map[key.Key]key.Key {
+	manifests := make(map[key.Key]key.Key)
+	for mk, l := range n.Pinning.Labels() {
+		if l.Name != erasureLabel {
+			continue
+		}
+		if root := key.B58KeyDecode(l.Meta["root"]); root != "" {
+			manifests[root] = mk
+		}
+	}
+	return manifests
+}
+
+// RepairErasure rebuilds the blocks of the DAG coded by the manifest mk
+// which n lost, or has corrupt, out of the others and the parity shards,
+// fetching those it doesn't have. It returns the keys of the blocks
+// rebuilt.
+func RepairErasure(ctx context.Context, n *core.IpfsNode, mk key.Key) ([]key.Key, error) {
+	nd, err := n.DAG.Get(ctx, mk)
+	if err != nil {
+		return nil, err
+	}
+	m, err := erasure.ParseManifest(nd)
+	if err != nil {
+		return nil, err
+	}
+	return erasure.Repair(ctx, m, n.Blockstore, n.DAG)
+}
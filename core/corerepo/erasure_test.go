@@ -0,0 +1,97 @@
+package corerepo
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/merkledag"
+)
+
+func TestRepairErasure(t *testing.T) {
+	ctx := context.Background()
+	n, err := core.NewNodeBuilder().Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	root := &merkledag.Node{Data: []byte("root")}
+	var children []key.Key
+	for i := 0; i < 5; i++ {
+		c := &merkledag.Node{Data: bytes.Repeat([]byte{byte(i)}, 100+i*10)}
+		if err := root.AddNodeLink(fmt.Sprintf("%d", i), c); err != nil {
+			t.Fatal(err)
+		}
+		ck, err := n.DAG.Add(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		children = append(children, ck)
+	}
+	rk, err := n.DAG.Add(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Pinning.Pin(ctx, root, true); err != nil {
+		t.Fatal(err)
+	}
+
+	mk, err := PinErasure(ctx, n, rk, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ErasureManifests(n)[rk]; got != mk {
+		t.Fatalf("expected the manifest of %s to be %s, got %s", rk, mk, got)
+	}
+
+	// lose two blocks of the same group, and one of another.
+	lost := []key.Key{rk, children[0], children[2]}
+	for _, k := range lost {
+		if err := n.Blockstore.DeleteBlock(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repaired, err := RepairErasure(ctx, n, mk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repaired) != len(lost) {
+		t.Fatalf("expected %d blocks repaired, got %v", len(lost), repaired)
+	}
+	for _, k := range lost {
+		if err := verifyBlock(n.Blockstore, k); err != nil {
+			t.Fatalf("%s not repaired: %s", k, err)
+		}
+	}
+
+	// lose a block and a parity shard of the first group, and then three
+	// of its four shards.
+	nd, err := n.DAG.Get(ctx, mk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parity := key.Key(nd.Links[0].Hash)
+	for _, k := range []key.Key{rk, parity} {
+		if err := n.Blockstore.DeleteBlock(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := RepairErasure(ctx, n, mk); err != nil {
+		t.Fatalf("expected two shards of four to be enough: %s", err)
+	}
+	if err := verifyBlock(n.Blockstore, parity); err != nil {
+		t.Fatalf("parity shard %s not repaired: %s", parity, err)
+	}
+	for _, k := range []key.Key{rk, children[0], parity} {
+		if err := n.Blockstore.DeleteBlock(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := RepairErasure(ctx, n, mk); err == nil {
+		t.Fatal("expected a group with one shard left not to be repaired")
+	}
+}
@@ -1,9 +1,21 @@
 package corerepo
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
+	humanize "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/dustin/go-humanize"
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	"github.com/ipfs/go-ipfs/core"
+	ipld "github.com/ipfs/go-ipfs/ipld"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	traverse "github.com/ipfs/go-ipfs/merkledag/traverse"
+	pin "github.com/ipfs/go-ipfs/pin"
 
 	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
 )
@@ -12,57 +24,451 @@ var log = eventlog.Logger("corerepo")
 
 type KeyRemoved struct {
 	Key key.Key
+	// Size is the size of the block, when the collection counts them.
+	Size uint64 `json:",omitempty"`
+}
+
+// GCBudget bounds a garbage collection, which stops once it has run for
+// MaxDuration or freed TargetFree bytes. A zero field is no bound. A
+// bounded collection only removes some of the garbage, and the next one
+// picks up from the key it stopped at, so collections can be kept short.
+type GCBudget struct {
+	MaxDuration time.Duration
+	TargetFree  uint64
 }
 
 func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel() // in case error occurs during operation
+	unlock := n.GCLocker.GCLock()
+	defer unlock()
+
 	keychan, err := n.Blockstore.AllKeysChan(ctx)
 	if err != nil {
 		return err
 	}
+	kept := bestEffortGraphs(n)
+	removed := 0
 	for k := range keychan { // rely on AllKeysChan to close chan
-		if !n.Pinning.IsPinned(k) {
+		if !gcKeeps(n, kept, k) {
 			err := n.Blockstore.DeleteBlock(k)
 			if err != nil {
 				return err
 			}
+			removed++
 		}
 	}
+
+	ev := newHookEvent(n, HookGC, nil)
+	ev.Removed = removed
+	notifyHooks(n, ev)
 	return nil
 }
 
 func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) (<-chan *KeyRemoved, error) {
+	return GarbageCollectBudget(n, ctx, GCBudget{})
+}
+
+// gcCursorKey is where a collection cut short records the greatest key it
+// looked at, for the next one to start past it.
+var gcCursorKey = ds.NewKey("/local/gc/cursor")
+
+// GarbageCollectBudget collects garbage as GarbageCollectAsync does, until
+// budget runs out. It looks at the keys past where the last collection
+// stopped first, and at those before after, so that a run of bounded
+// collections goes through all of the blocks; with datastores listing
+// their keys in order, such as flatfs and leveldb, it picks up exactly
+// where the last one stopped. When the blocks which aren't pinned fall
+// short of TargetFree, it evicts best-effort pins, least recently used
+// first, and removes their blocks, until it has freed enough.
+func GarbageCollectBudget(n *core.IpfsNode, ctx context.Context, budget GCBudget) (<-chan *KeyRemoved, error) {
+	cancel := func() {}
+	if budget.MaxDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, budget.MaxDuration)
+	}
 
+	unlock := n.GCLocker.GCLock()
 	keychan, err := n.Blockstore.AllKeysChan(ctx)
 	if err != nil {
+		unlock()
+		cancel()
 		return nil, err
 	}
 
+	// the blocks of transactional adds which never finished
+	if discarded, err := bstore.DiscardAbandoned(n.Repo.Datastore()); err != nil {
+		log.Debugf("Error discarding abandoned staged blocks: %s", err)
+	} else if discarded > 0 {
+		log.Infof("discarded %d abandoned staged blocks", discarded)
+	}
+
+	kept := bestEffortGraphs(n)
 	output := make(chan *KeyRemoved)
 	go func() {
 		defer close(output)
-		for {
+		defer cancel()
+		defer unlock()
+		removed := 0
+		var freed uint64
+		defer func() {
+			ev := newHookEvent(n, HookGC, nil)
+			ev.Removed = removed
+			notifyHooks(n, ev)
+		}()
+		// remove deletes the block of k, and tells whether to go on
+		remove := func(k key.Key) bool {
+			var size uint64
+			if budget.TargetFree > 0 {
+				s, err := n.Blockstore.GetSize(k)
+				if err != nil {
+					log.Debugf("Error reading the size of block to remove: %s", err)
+					return true
+				}
+				size = uint64(s)
+			}
+			err := n.Blockstore.DeleteBlock(k)
+			if err != nil {
+				log.Debugf("Error removing key from blockstore: %s", err)
+				return true
+			}
+			removed++
+			freed += size
 			select {
-			case k, ok := <-keychan:
-				if !ok {
+			case output <- &KeyRemoved{Key: k, Size: size}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// the keys past the cursor, then those up to it
+		cursor := gcCursor(n)
+		for pass := 0; pass < 2; pass++ {
+			if pass == 1 {
+				if cursor == "" {
+					break
+				}
+				keys, err := n.Blockstore.AllKeysChan(ctx)
+				if err != nil {
+					log.Errorf("listing the keys up to the gc cursor: %s", err)
+					return
+				}
+				keychan = keys
+			}
+			if !sweep(n, ctx, kept, keychan, budget, &freed, cursor, pass == 1, remove) {
+				return
+			}
+		}
+		setGCCursor(n, "")
+
+		if budget.TargetFree == 0 {
+			return
+		}
+		var evicted []key.Key
+		defer func() {
+			if len(evicted) == 0 {
+				return
+			}
+			if err := n.Pinning.Flush(); err != nil {
+				log.Errorf("saving the pins after evicting best-effort ones: %s", err)
+			}
+			notifyHooks(n, newHookEvent(n, HookUnpin, evicted))
+		}()
+		for _, root := range kept.roots {
+			if freed >= budget.TargetFree || ctx.Err() != nil {
+				return
+			}
+			log.Infof("gc evicts the best-effort pin of %s", root)
+			n.Pinning.GetManual().RemovePinWithMode(root, pin.BestEffort)
+			evicted = append(evicted, root)
+			for _, k := range kept.graphs[root] {
+				kept.refs[k]--
+				if gcKeeps(n, kept, k) {
+					continue
+				}
+				if !remove(k) {
 					return
 				}
-				if !n.Pinning.IsPinned(k) {
-					err := n.Blockstore.DeleteBlock(k)
-					if err != nil {
-						log.Debugf("Error removing key from blockstore: %s", err)
-						continue
-					}
-					select {
-					case output <- &KeyRemoved{k}:
-					case <-ctx.Done():
-					}
+			}
+		}
+	}()
+	return output, nil
+}
+
+// sweep removes the garbage of keys which are past cursor, or up to it if
+// upTo is set, until budget runs out. It tells whether it went through all
+// of them, and if not, records the greatest key it looked at as the new
+// cursor.
+func sweep(n *core.IpfsNode, ctx context.Context, kept *bestEffortPinned, keychan <-chan key.Key, budget GCBudget, freed *uint64, cursor key.Key, upTo bool, remove func(key.Key) bool) bool {
+	var last key.Key
+	stop := func() bool {
+		if last != "" {
+			setGCCursor(n, last)
+		}
+		return false
+	}
+	for {
+		if budget.TargetFree > 0 && *freed >= budget.TargetFree {
+			return stop()
+		}
+		select {
+		case k, ok := <-keychan:
+			if !ok {
+				return true
+			}
+			if (k > cursor) == upTo {
+				continue
+			}
+			if k > last {
+				last = k
+			}
+			if gcKeeps(n, kept, k) {
+				continue
+			}
+			if !remove(k) {
+				return stop()
+			}
+		case <-ctx.Done():
+			return stop()
+		}
+	}
+}
+
+// gcCursor returns the key the last collection stopped at, if it was cut
+// short.
+func gcCursor(n *core.IpfsNode) key.Key {
+	v, err := n.Repo.Datastore().Get(gcCursorKey)
+	if err != nil {
+		return ""
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return ""
+	}
+	return key.Key(b)
+}
+
+// setGCCursor records k as where the collection stopped, or that it went
+// through all of the keys if k is empty.
+func setGCCursor(n *core.IpfsNode, k key.Key) {
+	var err error
+	if k == "" {
+		err = n.Repo.Datastore().Delete(gcCursorKey)
+		if err == ds.ErrNotFound {
+			err = nil
+		}
+	} else {
+		err = n.Repo.Datastore().Put(gcCursorKey, []byte(k))
+	}
+	if err != nil {
+		log.Errorf("recording where gc stopped: %s", err)
+	}
+}
+
+// gcKeeps returns whether garbage collection must keep the block of k:
+// it's fetched by a background pin in progress, kept by a best-effort pin,
+// or pinned. It must be called with the gc lock held, for no block to be
+// added and pinned meanwhile; the adds, transactional or not, hold a pin
+// lock until they're pinned. Background pins don't, as they may take
+// long, but pin their blocks before they stop protecting them, which is
+// why those are checked first.
+func gcKeeps(n *core.IpfsNode, kept *bestEffortPinned, k key.Key) bool {
+	if n.PinQueue != nil && n.PinQueue.Protects(k) {
+		return true
+	}
+	return kept.refs[k] > 0 || n.Pinning.IsPinned(k)
+}
+
+// ErrBlockKept is why RemoveBlocks leaves a block gc would keep.
+var ErrBlockKept = errors.New("pinned: use --force to remove it anyway")
+
+// RemoveBlocks removes the blocks of keys from the blockstore of n, and
+// returns the error of each, nil for those removed. Unless force is set,
+// it leaves the blocks gc would keep, with ErrBlockKept.
+func RemoveBlocks(n *core.IpfsNode, keys []key.Key, force bool) []error {
+	unlock := n.GCLocker.GCLock()
+	defer unlock()
+
+	var kept *bestEffortPinned
+	if !force {
+		kept = bestEffortGraphs(n)
+	}
+	errs := make([]error, len(keys))
+	for i, k := range keys {
+		has, err := n.Blockstore.Has(k)
+		switch {
+		case err != nil:
+			errs[i] = err
+		case !has:
+			errs[i] = bstore.ErrNotFound
+		case !force && gcKeeps(n, kept, k):
+			errs[i] = ErrBlockKept
+		default:
+			errs[i] = n.Blockstore.DeleteBlock(k)
+		}
+	}
+	return errs
+}
+
+// bestEffortPinned holds the blocks the best-effort pins keep.
+type bestEffortPinned struct {
+	// roots are the best-effort pinned keys, least recently used first.
+	roots []key.Key
+	// graphs are the keys of the local blocks of the graph of each root.
+	graphs map[key.Key][]key.Key
+	// refs counts the graphs each block is in.
+	refs map[key.Key]int
+}
+
+// bestEffortGraphs walks the graphs of the best-effort pins of n, through
+// the blocks it has locally only.
+func bestEffortGraphs(n *core.IpfsNode) *bestEffortPinned {
+	b := &bestEffortPinned{
+		roots:  n.Pinning.BestEffortKeys(),
+		graphs: make(map[key.Key][]key.Key),
+		refs:   make(map[key.Key]int),
+	}
+	local := localLinksDAG{DAGService: n.DAG, bs: n.Blockstore}
+	for _, root := range b.roots {
+		nd, err := local.Get(n.Context(), root)
+		if err != nil {
+			continue
+		}
+		traverse.Traverse(nd, traverse.Options{
+			DAG:            local,
+			Order:          traverse.DFSPre,
+			SkipDuplicates: true,
+			Ctx:            n.Context(),
+			// what isn't local is left out, with all it links to
+			ErrFunc: func(error) error { return nil },
+			Func: func(st traverse.State) error {
+				k := root
+				if st.Link != nil {
+					k = key.Key(st.Link.Hash)
 				}
+				b.graphs[root] = append(b.graphs[root], k)
+				b.refs[k]++
+				return nil
+			},
+		})
+	}
+	return b
+}
+
+// localLinksDAG gets the blocks of a blockstore as nodes holding only their
+// links, of merkledag nodes and objects alike, for gc to walk them with
+// traverse without fetching what isn't local.
+type localLinksDAG struct {
+	dag.DAGService
+	bs bstore.Blockstore
+}
+
+func (d localLinksDAG) Get(ctx context.Context, k key.Key) (*dag.Node, error) {
+	blk, err := d.bs.Get(k)
+	if err != nil {
+		return nil, err
+	}
+	nd := new(dag.Node)
+	links, err := ipld.Links(blk)
+	if err != nil {
+		// kept, but what it links to can't be told
+		return nd, nil
+	}
+	for _, l := range links {
+		nd.Links = append(nd.Links, &dag.Link{Hash: mh.Multihash(l)})
+	}
+	return nd, nil
+}
+
+func (d localLinksDAG) GetNodes(ctx context.Context, keys []key.Key) []dag.NodeGetter {
+	getters := make([]dag.NodeGetter, len(keys))
+	for i, k := range keys {
+		getters[i] = localLinksGetter{d, k}
+	}
+	return getters
+}
+
+type localLinksGetter struct {
+	dag localLinksDAG
+	k   key.Key
+}
+
+func (g localLinksGetter) Get(ctx context.Context) (*dag.Node, error) {
+	return g.dag.Get(ctx, g.k)
+}
+
+// Default GC policy thresholds, in percent of StorageMax
+const (
+	defaultGCHighWater = 90
+	defaultGCLowWater  = 70
+	defaultGCPeriod    = time.Hour
+)
+
+// PeriodicGC starts enforcing the storage limit in the config of n, until
+// ctx is done: every period, it checks the size of the repo, and if it's
+// grown past the high water mark, collects garbage until it's back under
+// the low water mark, or as close as it gets. It does nothing if no limit
+// is set, and returns an error if the config is invalid.
+func PeriodicGC(ctx context.Context, n *core.IpfsNode) error {
+	cfg := n.Repo.Config().Datastore
+	if cfg.StorageMax == "" {
+		return nil
+	}
+	max, err := humanize.ParseBytes(cfg.StorageMax)
+	if err != nil {
+		return fmt.Errorf("invalid Datastore.StorageMax %q: %s", cfg.StorageMax, err)
+	}
+
+	high, low := cfg.StorageGCHighWater, cfg.StorageGCLowWater
+	if high <= 0 {
+		high = defaultGCHighWater
+	}
+	if low <= 0 {
+		low = defaultGCLowWater
+	}
+	if low > high || high > 100 {
+		return fmt.Errorf("invalid Datastore.StorageGCLowWater %d and StorageGCHighWater %d", low, high)
+	}
+	period := time.Duration(cfg.GCPeriodSeconds) * time.Second
+	if period <= 0 {
+		period = defaultGCPeriod
+	}
+
+	go func() {
+		for {
+			if err := maybeGC(ctx, n, max*uint64(high)/100, max*uint64(low)/100); err != nil {
+				log.Errorf("periodic gc: %s", err)
+			}
+			select {
+			case <-time.After(period):
 			case <-ctx.Done():
 				return
 			}
 		}
 	}()
-	return output, nil
+	return nil
+}
+
+// maybeGC collects garbage if the repo takes more than high bytes, until
+// it's back under low.
+func maybeGC(ctx context.Context, n *core.IpfsNode, high, low uint64) error {
+	usage, err := n.Repo.GetStorageUsage()
+	if err != nil {
+		return err
+	}
+	if usage <= high {
+		return nil
+	}
+
+	log.Infof("repo takes %s, over %s: collecting garbage", humanize.Bytes(usage), humanize.Bytes(high))
+	out, err := GarbageCollectBudget(n, ctx, GCBudget{TargetFree: usage - low})
+	if err != nil {
+		return err
+	}
+	var freed uint64
+	for r := range out {
+		freed += r.Size
+	}
+	log.Infof("periodic gc freed %s", humanize.Bytes(freed))
+	return nil
 }
@@ -0,0 +1,299 @@
+package corerepo
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/merkledag"
+	pin "github.com/ipfs/go-ipfs/pin"
+)
+
+func TestGarbageCollectBudget(t *testing.T) {
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	// the node's own garbage, such as the empty directory, goes first
+	collectAll(t, n)
+
+	present := make(map[key.Key]bool)
+	for i := 0; i < 10; i++ {
+		data := make([]byte, 100)
+		data[0] = byte(i)
+		b := blocks.NewBlock(data)
+		if err := n.Blockstore.Put(b); err != nil {
+			t.Fatal(err)
+		}
+		present[b.Key()] = true
+	}
+	count := func() int {
+		keys, err := n.Blockstore.AllKeysChan(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := 0
+		for _ = range keys {
+			c++
+		}
+		return c
+	}
+	before := count()
+
+	// each collection frees 300 bytes, picking up past the key the last
+	// one stopped at, until all of the blocks are gone
+	for _, want := range []int{3, 3, 3, 1} {
+		cursor := gcCursor(n)
+		out, err := GarbageCollectBudget(n, context.Background(), GCBudget{TargetFree: 250})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var freed uint64
+		removed := 0
+		wrapped := false
+		for r := range out {
+			if !present[r.Key] {
+				t.Fatalf("removed %s, which isn't there", r.Key)
+			}
+			delete(present, r.Key)
+			if r.Key <= cursor {
+				wrapped = true
+			} else if wrapped {
+				t.Fatalf("removed %s, past the cursor, after keys before it", r.Key)
+			}
+			freed += r.Size
+			removed++
+		}
+		if wrapped {
+			for k := range present {
+				if k > cursor {
+					t.Fatalf("left %s, past the cursor, and removed keys before it", k)
+				}
+			}
+		}
+		if removed != want || freed != uint64(100*want) {
+			t.Fatalf("expected %d blocks, %d bytes, removed, got %d, %d bytes", want, 100*want, removed, freed)
+		}
+		before -= want
+		if after := count(); after != before {
+			t.Fatalf("expected %d blocks left, got %d", before, after)
+		}
+	}
+	if len(present) != 0 {
+		t.Fatalf("expected all of the blocks removed, left %d", len(present))
+	}
+	if c := gcCursor(n); c != "" {
+		t.Fatalf("expected no cursor after going through all of the keys, got %s", c)
+	}
+}
+
+func collectAll(t *testing.T, n *core.IpfsNode) {
+	out, err := GarbageCollectAsync(n, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _ = range out {
+	}
+}
+
+func TestGarbageCollectBestEffort(t *testing.T) {
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	// two graphs of a root and a child each, pinned best-effort, the one
+	// of older used less lately
+	addGraph := func(i byte) (root, child key.Key) {
+		c := &merkledag.Node{Data: bytes.Repeat([]byte{i}, 100)}
+		r := &merkledag.Node{Data: []byte{i}}
+		if err := r.AddNodeLink("child", c); err != nil {
+			t.Fatal(err)
+		}
+		for _, nd := range []*merkledag.Node{c, r} {
+			if _, err := n.DAG.Add(nd); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rk, _ := r.Key()
+		ck, _ := c.Key()
+		n.Pinning.GetManual().PinWithMode(rk, pin.BestEffort)
+		time.Sleep(time.Millisecond)
+		return rk, ck
+	}
+	older, olderChild := addGraph(1)
+	newer, newerChild := addGraph(2)
+	has := func(k key.Key) bool {
+		ok, err := n.Blockstore.Has(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	// while space permits, the graphs are kept
+	out, err := GarbageCollectAsync(n, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _ = range out {
+	}
+	for _, k := range []key.Key{older, olderChild, newer, newerChild} {
+		if !has(k) {
+			t.Fatalf("expected %s to be kept", k)
+		}
+	}
+
+	// short of space, the least recently used is evicted
+	out, err = GarbageCollectBudget(n, context.Background(), GCBudget{TargetFree: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _ = range out {
+	}
+	if has(older) || has(olderChild) {
+		t.Fatal("expected the least recently used best-effort pin to be evicted")
+	}
+	if !has(newer) || !has(newerChild) {
+		t.Fatal("expected the best-effort pin used lately to be kept")
+	}
+	if keys := n.Pinning.BestEffortKeys(); len(keys) != 1 || keys[0] != newer {
+		t.Fatalf("expected only the pin used lately left, got %v", keys)
+	}
+}
+
+func TestGarbageCollectKeepsQueuedPins(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n, err := core.NewNodeBuilder().Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	n.PinQueue = pin.NewQueue(ctx, n.Pinning, n.DAG, pin.QueueOptions{
+		FetchTimeout: 50 * time.Millisecond,
+		MinBackoff:   time.Minute,
+	})
+
+	// the pin can't finish while a child is missing
+	present := &merkledag.Node{Data: []byte("present")}
+	missing := &merkledag.Node{Data: []byte("missing")}
+	root := &merkledag.Node{Data: []byte("root")}
+	if err := root.AddNodeLinkClean("present", present); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLinkClean("missing", missing); err != nil {
+		t.Fatal(err)
+	}
+	for _, nd := range []*merkledag.Node{present, root} {
+		if _, err := n.DAG.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rk, _ := root.Key()
+	n.PinQueue.Add(rk, true, nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if st, _ := n.PinQueue.Status(rk); st.State == pin.StateRetrying {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the background pin to be retrying")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	out, err := GarbageCollectAsync(n, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _ = range out {
+	}
+	for _, nd := range []*merkledag.Node{present, root} {
+		k, _ := nd.Key()
+		if has, _ := n.Blockstore.Has(k); !has {
+			t.Fatalf("gc removed %s, fetched by a background pin in progress", k)
+		}
+	}
+}
+
+func TestRemoveBlocks(t *testing.T) {
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	add := func(data string) key.Key {
+		nd := &merkledag.Node{Data: []byte(data)}
+		k, err := n.DAG.Add(nd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	pinned := add("pinned")
+	n.Pinning.GetManual().PinWithMode(pinned, pin.Recursive)
+	bestEffort := add("best-effort")
+	n.Pinning.GetManual().PinWithMode(bestEffort, pin.BestEffort)
+	loose := add("loose")
+	absent := key.Key(blocks.NewBlock([]byte("absent")).Multihash)
+
+	keys := []key.Key{pinned, bestEffort, loose, absent}
+	errs := RemoveBlocks(n, keys, false)
+	for i, want := range []error{ErrBlockKept, ErrBlockKept, nil, bstore.ErrNotFound} {
+		if errs[i] != want {
+			t.Fatalf("removing %s: expected %v, got %v", keys[i], want, errs[i])
+		}
+	}
+
+	errs = RemoveBlocks(n, keys[:2], true)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("removing %s with force: %s", keys[i], err)
+		}
+		if has, _ := n.Blockstore.Has(keys[i]); has {
+			t.Fatalf("expected %s removed with force", keys[i])
+		}
+	}
+}
+
+func TestRemoveBlocksWaitsForPins(t *testing.T) {
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	nd := &merkledag.Node{Data: []byte("being pinned")}
+	k, err := n.DAG.Add(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the block is added, but not pinned yet, when removal is asked for
+	unlock := n.GCLocker.PinLock()
+	done := make(chan error)
+	go func() {
+		done <- RemoveBlocks(n, []key.Key{k}, false)[0]
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("expected the removal to wait for the pin, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	n.Pinning.GetManual().PinWithMode(k, pin.Recursive)
+	unlock()
+
+	if err := <-done; err != ErrBlockKept {
+		t.Fatalf("expected the block pinned meanwhile kept, got %v", err)
+	}
+}
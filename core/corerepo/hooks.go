@@ -0,0 +1,212 @@
+package corerepo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+
+	ctxgroup "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-ctxgroup"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	"github.com/ipfs/go-ipfs/core"
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+// Event types delivered to hooks.
+const (
+	HookPin   = "pin"
+	HookUnpin = "unpin"
+	HookGC    = "gc"
+)
+
+const defaultHookTimeout = 5 * time.Second
+
+// HookEvent is the payload sent to the configured hooks.
+type HookEvent struct {
+	Type      string
+	Node      string
+	Time      time.Time
+	Keys      []string `json:",omitempty"`
+	Recursive bool     `json:",omitempty"`
+	// Removed is the number of blocks deleted by a garbage collection.
+	Removed int `json:",omitempty"`
+}
+
+func newHookEvent(n *core.IpfsNode, typ string, keys []key.Key) *HookEvent {
+	ev := &HookEvent{
+		Type: typ,
+		Node: n.Identity.Pretty(),
+		Time: time.Now(),
+	}
+	for _, k := range keys {
+		ev.Keys = append(ev.Keys, k.B58String())
+	}
+	return ev
+}
+
+// hookQueueSize bounds the events of a node waiting for their hooks.
+// Those past it are dropped rather than holding up what fired them.
+const hookQueueSize = 128
+
+// hookDrainTimeout is how long the events still queued are delivered for
+// once their node closes, as commands run without a daemon do at once.
+const hookDrainTimeout = 10 * time.Second
+
+type queuedHook struct {
+	hooks config.Hooks
+	ev    *HookEvent
+}
+
+// hookQueues holds the queue of each node with hooks, delivered by one
+// goroutine per node, in order.
+var hookQueues = struct {
+	sync.Mutex
+	m map[*core.IpfsNode]chan queuedHook
+}{m: make(map[*core.IpfsNode]chan queuedHook)}
+
+// NotifyPinned delivers the pin event of keys to the hooks of n, for the
+// pins made outside of this package, such as those of ipfs add.
+func NotifyPinned(n *core.IpfsNode, keys []key.Key, recursive bool) {
+	if len(keys) == 0 {
+		return
+	}
+	ev := newHookEvent(n, HookPin, keys)
+	ev.Recursive = recursive
+	notifyHooks(n, ev)
+}
+
+// notifyHooks queues ev for the hooks configured for n, which are run in
+// the background. Hook failures are logged but never fail the operation
+// that triggered them.
+func notifyHooks(n *core.IpfsNode, ev *HookEvent) {
+	if n.Repo == nil {
+		return
+	}
+	cfg := n.Repo.Config()
+	if cfg == nil || (len(cfg.Hooks.Webhooks) == 0 && cfg.Hooks.Exec == "") {
+		return
+	}
+
+	select {
+	case hookQueue(n) <- queuedHook{cfg.Hooks, ev}:
+	default:
+		log.Warningf("dropped a %s hook event, %d are waiting already", ev.Type, hookQueueSize)
+	}
+}
+
+// hookQueue returns the queue of n, starting its delivery if needed.
+func hookQueue(n *core.IpfsNode) chan queuedHook {
+	hookQueues.Lock()
+	defer hookQueues.Unlock()
+	if q, ok := hookQueues.m[n]; ok {
+		return q
+	}
+
+	q := make(chan queuedHook, hookQueueSize)
+	hookQueues.m[n] = q
+	if n.ContextGroup == nil {
+		go runHooks(n, q, nil)
+	} else {
+		n.AddChildFunc(func(parent ctxgroup.ContextGroup) {
+			runHooks(n, q, parent.Closing())
+		})
+	}
+	return q
+}
+
+// runHooks delivers the events of q until closing is, and then those left
+// for up to hookDrainTimeout.
+func runHooks(n *core.IpfsNode, q chan queuedHook, closing <-chan struct{}) {
+	deliver := func(h queuedHook) {
+		for _, err := range deliverHooks(h.hooks, h.ev) {
+			log.Warningf("%s hook failed: %s", h.ev.Type, err)
+		}
+	}
+
+	for closed := false; !closed; {
+		select {
+		case h := <-q:
+			deliver(h)
+		case <-closing:
+			closed = true
+		}
+	}
+
+	hookQueues.Lock()
+	delete(hookQueues.m, n)
+	hookQueues.Unlock()
+
+	deadline := time.Now().Add(hookDrainTimeout)
+	for {
+		select {
+		case h := <-q:
+			if time.Now().After(deadline) {
+				log.Warningf("dropped %d hook events left once the node closed", len(q)+1)
+				return
+			}
+			deliver(h)
+		default:
+			return
+		}
+	}
+}
+
+// deliverHooks runs every configured hook for ev in turn, returning the
+// errors encountered.
+func deliverHooks(hooks config.Hooks, ev *HookEvent) []error {
+	if len(hooks.Webhooks) == 0 && hooks.Exec == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return []error{err}
+	}
+
+	timeout := defaultHookTimeout
+	if hooks.TimeoutSeconds > 0 {
+		timeout = time.Duration(hooks.TimeoutSeconds) * time.Second
+	}
+
+	var errs []error
+	client := &http.Client{Timeout: timeout}
+	for _, url := range hooks.Webhooks {
+		resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			errs = append(errs, fmt.Errorf("%s: %s", url, resp.Status))
+		}
+	}
+
+	if hooks.Exec != "" {
+		if err := runExecHook(hooks.Exec, payload, timeout); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func runExecHook(prog string, payload []byte, timeout time.Duration) error {
+	cmd := exec.Command(prog)
+	cmd.Stdin = bytes.NewReader(payload)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("%s: timed out after %s", prog, timeout)
+	}
+}
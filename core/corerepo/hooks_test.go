@@ -0,0 +1,84 @@
+package corerepo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	"github.com/ipfs/go-ipfs/core"
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+func TestDeliverWebhook(t *testing.T) {
+	got := make(chan *HookEvent, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ev := new(HookEvent)
+		if err := json.NewDecoder(r.Body).Decode(ev); err != nil {
+			t.Error(err)
+		}
+		got <- ev
+	}))
+	defer ts.Close()
+
+	ev := &HookEvent{Type: HookPin, Keys: []string{"QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"}}
+	if errs := deliverHooks(config.Hooks{Webhooks: []string{ts.URL}}, ev); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	recv := <-got
+	if recv.Type != HookPin || len(recv.Keys) != 1 || recv.Keys[0] != ev.Keys[0] {
+		t.Fatalf("webhook received unexpected payload: %+v", recv)
+	}
+}
+
+func TestDeliverWebhookFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	errs := deliverHooks(config.Hooks{Webhooks: []string{ts.URL}}, &HookEvent{Type: HookGC})
+	if len(errs) != 1 {
+		t.Fatalf("expected one delivery error, got %v", errs)
+	}
+}
+
+func TestNotifyHooksQueued(t *testing.T) {
+	got := make(chan *HookEvent, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		ev := new(HookEvent)
+		if err := json.NewDecoder(r.Body).Decode(ev); err != nil {
+			t.Error(err)
+		}
+		got <- ev
+	}))
+	defer ts.Close()
+
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Repo.Config().Hooks.Webhooks = []string{ts.URL}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		NotifyPinned(n, []key.Key{key.B58KeyDecode("QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD")}, true)
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Fatalf("expected the hooks to run in the background, notifying took %s", d)
+	}
+
+	// the events still queued are delivered as the node closes
+	n.Close()
+	if len(got) != 3 {
+		t.Fatalf("expected 3 events delivered, got %d", len(got))
+	}
+	if ev := <-got; ev.Type != HookPin || !ev.Recursive {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+}
@@ -14,6 +14,7 @@ objects.
 package corerepo
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -21,19 +22,38 @@ import (
 
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	"github.com/ipfs/go-ipfs/core"
+	ipld "github.com/ipfs/go-ipfs/ipld"
 	"github.com/ipfs/go-ipfs/merkledag"
 	path "github.com/ipfs/go-ipfs/path"
+	pin "github.com/ipfs/go-ipfs/pin"
 )
 
+// ErrPinObjectRecursive is returned for recursive pins of objects stored
+// with 'ipfs dag put': recursive pins only follow the links of merkledag
+// nodes.
+var ErrPinObjectRecursive = errors.New("pin: objects stored with 'ipfs dag put' can only be pinned directly, or best-effort")
+
+var errPinObjectBackground = errors.New("pin: objects stored with 'ipfs dag put' can't be pinned in the background")
+
 func Pin(n *core.IpfsNode, paths []string, recursive bool) ([]key.Key, error) {
+	defer n.GCLocker.PinLock()()
 	// TODO(cryptix): do we want a ctx as first param for (Un)Pin() as well, just like core.Resolve?
 	ctx := n.Context()
 
 	dagnodes := make([]*merkledag.Node, 0)
+	var objects []key.Key
 	for _, fpath := range paths {
 		dagnode, err := core.Resolve(ctx, n, path.Path(fpath))
 		if err != nil {
-			return nil, fmt.Errorf("pin: %s", err)
+			k, ok := resolveObject(ctx, n, fpath)
+			if !ok {
+				return nil, fmt.Errorf("pin: %s", err)
+			}
+			if recursive {
+				return nil, ErrPinObjectRecursive
+			}
+			objects = append(objects, k)
+			continue
 		}
 		dagnodes = append(dagnodes, dagnode)
 	}
@@ -53,32 +73,54 @@ func Pin(n *core.IpfsNode, paths []string, recursive bool) ([]key.Key, error) {
 		}
 		out = append(out, k)
 	}
+	mp := n.Pinning.GetManual()
+	for _, k := range objects {
+		mp.PinWithMode(k, pin.Direct)
+		out = append(out, k)
+	}
 
 	err := n.Pinning.Flush()
 	if err != nil {
 		return nil, err
 	}
 
+	ev := newHookEvent(n, HookPin, out)
+	ev.Recursive = recursive
+	notifyHooks(n, ev)
 	return out, nil
 }
 
+// resolveObject returns the key of the object fpath leads to, if it is
+// one stored with 'ipfs dag put', rather than a merkledag node.
+func resolveObject(ctx context.Context, n *core.IpfsNode, fpath string) (key.Key, bool) {
+	k, err := core.ResolveToKey(ctx, n, path.Path(fpath))
+	if err != nil {
+		return "", false
+	}
+	b, err := n.Blocks.GetBlock(ctx, k)
+	if err != nil || !ipld.IsObject(b.Data) {
+		return "", false
+	}
+	return k, true
+}
+
 func Unpin(n *core.IpfsNode, paths []string, recursive bool) ([]key.Key, error) {
 	// TODO(cryptix): do we want a ctx as first param for (Un)Pin() as well, just like core.Resolve?
 	ctx := n.Context()
 
-	dagnodes := make([]*merkledag.Node, 0)
+	// only the keys are needed, which also unpins objects that aren't
+	// merkledag nodes
+	var keys []key.Key
 	for _, fpath := range paths {
-		dagnode, err := core.Resolve(ctx, n, path.Path(fpath))
+		k, err := core.ResolveToKey(ctx, n, path.Path(fpath))
 		if err != nil {
 			return nil, err
 		}
-		dagnodes = append(dagnodes, dagnode)
+		keys = append(keys, k)
 	}
 
 	var unpinned []key.Key
-	for _, dagnode := range dagnodes {
-		k, _ := dagnode.Key()
-
+	for _, k := range keys {
 		ctx, cancel := context.WithTimeout(ctx, time.Minute)
 		defer cancel()
 		err := n.Pinning.Unpin(ctx, k, recursive)
@@ -92,5 +134,134 @@ func Unpin(n *core.IpfsNode, paths []string, recursive bool) ([]key.Key, error)
 	if err != nil {
 		return nil, err
 	}
+
+	ev := newHookEvent(n, HookUnpin, unpinned)
+	ev.Recursive = recursive
+	notifyHooks(n, ev)
 	return unpinned, nil
 }
+
+// PinUpdate moves the recursive pin of the object at from over to the
+// object at to. Only the parts of to that from doesn't have are fetched.
+func PinUpdate(n *core.IpfsNode, from, to string) ([]key.Key, error) {
+	defer n.GCLocker.PinLock()()
+	ctx := n.Context()
+
+	fromnd, err := core.Resolve(ctx, n, path.Path(from))
+	if err != nil {
+		return nil, fmt.Errorf("pin: %s", err)
+	}
+	tond, err := core.Resolve(ctx, n, path.Path(to))
+	if err != nil {
+		return nil, fmt.Errorf("pin: %s", err)
+	}
+
+	fromk, err := fromnd.Key()
+	if err != nil {
+		return nil, err
+	}
+	tok, err := tond.Key()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := n.Pinning.Update(ctx, fromk, tond); err != nil {
+		return nil, fmt.Errorf("pin: %s", err)
+	}
+
+	if err := n.Pinning.Flush(); err != nil {
+		return nil, err
+	}
+
+	ev := newHookEvent(n, HookPin, []key.Key{tok})
+	ev.Recursive = true
+	notifyHooks(n, ev)
+	if fromk != tok {
+		ev := newHookEvent(n, HookUnpin, []key.Key{fromk})
+		ev.Recursive = true
+		notifyHooks(n, ev)
+	}
+	return []key.Key{fromk, tok}, nil
+}
+
+// LabelPins gives the direct or recursive pins of keys the label l.
+func LabelPins(n *core.IpfsNode, keys []key.Key, l pin.Label) error {
+	for _, k := range keys {
+		if err := n.Pinning.SetLabel(k, l); err != nil {
+			return fmt.Errorf("pin: %s", err)
+		}
+	}
+	return n.Pinning.Flush()
+}
+
+// PinBackground queues the objects at paths to be pinned in the background,
+// and returns their keys without waiting for them to be fetched. Each pin
+// is given label, if not nil, and hooks are notified of it once it's done.
+func PinBackground(n *core.IpfsNode, paths []string, recursive bool, label *pin.Label) ([]key.Key, error) {
+	if n.PinQueue == nil {
+		return nil, errors.New("pin: background pins need the daemon to be running")
+	}
+	ctx := n.Context()
+
+	var keys []key.Key
+	for _, fpath := range paths {
+		k, err := core.ResolveToKey(ctx, n, path.Path(fpath))
+		if err != nil {
+			return nil, fmt.Errorf("pin: %s", err)
+		}
+		// the queue fetches merkledag nodes only
+		if b, err := n.Blockstore.Get(k); err == nil && ipld.IsObject(b.Data) {
+			return nil, errPinObjectBackground
+		}
+		keys = append(keys, k)
+	}
+
+	for _, k := range keys {
+		k := k
+		n.PinQueue.Add(k, recursive, func() {
+			if label != nil {
+				if err := LabelPins(n, []key.Key{k}, *label); err != nil {
+					log.Warningf("labelling background pin of %s: %s", k, err)
+				}
+			}
+			ev := newHookEvent(n, HookPin, []key.Key{k})
+			ev.Recursive = recursive
+			notifyHooks(n, ev)
+		})
+	}
+	return keys, nil
+}
+
+// PinBestEffort pins the objects at paths best-effort: garbage collection
+// keeps them, and what is local of their graphs, until it runs short of
+// space. Only the objects themselves are fetched, not their graphs.
+func PinBestEffort(n *core.IpfsNode, paths []string) ([]key.Key, error) {
+	defer n.GCLocker.PinLock()()
+	ctx := n.Context()
+
+	var keys []key.Key
+	for _, fpath := range paths {
+		k, err := core.ResolveToKey(ctx, n, path.Path(fpath))
+		if err != nil {
+			return nil, fmt.Errorf("pin: %s", err)
+		}
+		// the object itself, which may be one stored with 'ipfs dag put'
+		if _, err := n.Blocks.GetBlock(ctx, k); err != nil {
+			return nil, fmt.Errorf("pin: %s", err)
+		}
+		keys = append(keys, k)
+	}
+
+	mp := n.Pinning.GetManual()
+	for _, k := range keys {
+		mp.PinWithMode(k, pin.BestEffort)
+	}
+	if err := n.Pinning.Flush(); err != nil {
+		return nil, err
+	}
+
+	notifyHooks(n, newHookEvent(n, HookPin, keys))
+	return keys, nil
+}
@@ -0,0 +1,68 @@
+package corerepo
+
+import (
+	"testing"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	"github.com/ipfs/go-ipfs/core"
+	ipld "github.com/ipfs/go-ipfs/ipld"
+)
+
+func TestPinObjects(t *testing.T) {
+	ctx := context.Background()
+	n, err := core.NewNodeBuilder().Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	child, err := ipld.NewBlock(map[string]interface{}{"name": "child"}, mh.SHA2_256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, err := ipld.NewBlock(map[string]interface{}{"child": ipld.Link(child.Key())}, mh.SHA2_256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Blocks.AddBlock(child); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.Blocks.AddBlock(parent); err != nil {
+		t.Fatal(err)
+	}
+	p := "/ipfs/" + parent.Key().B58String()
+
+	if _, err := Pin(n, []string{p}, true); err != ErrPinObjectRecursive {
+		t.Fatalf("expected ErrPinObjectRecursive, got %v", err)
+	}
+	if _, err := Pin(n, []string{p}, false); err != nil {
+		t.Fatal(err)
+	}
+	if !n.Pinning.IsPinned(parent.Key()) {
+		t.Fatal("expected the object to be pinned directly")
+	}
+	if _, err := Unpin(n, []string{p}, false); err != nil {
+		t.Fatal(err)
+	}
+	if n.Pinning.IsPinned(parent.Key()) {
+		t.Fatal("expected the object to be unpinned")
+	}
+
+	// gc keeps what a best-effort pin links to, through objects too
+	if _, err := PinBestEffort(n, []string{p}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := GarbageCollectAsync(n, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _ = range out {
+	}
+	for _, k := range []key.Key{parent.Key(), child.Key()} {
+		if has, _ := n.Blockstore.Has(k); !has {
+			t.Fatalf("expected gc to keep %s", k)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package corerepo
+
+import (
+	"fmt"
+
+	humanize "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/dustin/go-humanize"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/ipfs/go-ipfs/core"
+)
+
+// Stat describes the storage of a node's repo.
+type Stat struct {
+	NumObjects uint64
+	// RepoSize is the number of bytes the repo takes on disk.
+	RepoSize uint64
+	// StorageMax is the configured Datastore.StorageMax, in bytes, or zero
+	// if none is set.
+	StorageMax uint64
+	// Datastore is the configured datastore backend.
+	Datastore string
+}
+
+// RepoStat counts the blocks of n, and measures the size of its repo.
+func RepoStat(n *core.IpfsNode, ctx context.Context) (*Stat, error) {
+	usage, err := n.Repo.GetStorageUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := n.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var count uint64
+	for _ = range keys {
+		count++
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	stat := &Stat{
+		NumObjects: count,
+		RepoSize:   usage,
+	}
+	if cfg := n.Repo.Config(); cfg != nil {
+		stat.Datastore = cfg.Datastore.Type
+		if cfg.Datastore.StorageMax != "" {
+			max, err := humanize.ParseBytes(cfg.Datastore.StorageMax)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Datastore.StorageMax %q: %s", cfg.Datastore.StorageMax, err)
+			}
+			stat.StorageMax = max
+		}
+	}
+	return stat, nil
+}
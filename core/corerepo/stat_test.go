@@ -0,0 +1,37 @@
+package corerepo
+
+import (
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	"github.com/ipfs/go-ipfs/core"
+)
+
+func TestRepoStat(t *testing.T) {
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	before, err := RepoStat(n, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := n.Blockstore.Put(blocks.NewBlock([]byte{byte(i)})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after, err := RepoStat(n, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.NumObjects != before.NumObjects+5 {
+		t.Fatalf("expected %d objects, got %d", before.NumObjects+5, after.NumObjects)
+	}
+	if after.StorageMax != 0 {
+		t.Fatalf("expected no storage max, got %d", after.StorageMax)
+	}
+}
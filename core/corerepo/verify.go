@@ -0,0 +1,71 @@
+package corerepo
+
+import (
+	"fmt"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	"github.com/ipfs/go-ipfs/core"
+)
+
+// BlockCheck is the result of checking a block: Err is why it's corrupt,
+// and nil when it isn't.
+type BlockCheck struct {
+	Key     key.Key
+	Err     error
+	Removed bool
+}
+
+// VerifyBlocks checks that the data of every block of n hashes to its key,
+// sending the result of each on the channel returned. With remove set,
+// the corrupt blocks are removed, so that they're fetched again the next
+// time they're needed.
+func VerifyBlocks(ctx context.Context, n *core.IpfsNode, remove bool) (<-chan *BlockCheck, error) {
+	keychan, err := n.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(chan *BlockCheck)
+	go func() {
+		defer close(output)
+		for k := range keychan {
+			check := &BlockCheck{Key: k, Err: verifyBlock(n.Blockstore, k)}
+			if check.Err == bstore.ErrNotFound {
+				// removed since it was listed
+				continue
+			}
+			if check.Err != nil && remove {
+				if err := n.Blockstore.DeleteBlock(k); err != nil {
+					log.Debugf("Error removing corrupt block %s: %s", k, err)
+				} else {
+					check.Removed = true
+				}
+			}
+			select {
+			case output <- check:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return output, nil
+}
+
+func verifyBlock(bs bstore.Blockstore, k key.Key) error {
+	blk, err := bs.Get(k)
+	if err != nil {
+		return err
+	}
+	sum, err := blocks.SumLike(blk.Data, mh.Multihash(k))
+	if err != nil {
+		return err
+	}
+	if string(sum) != string(k) {
+		return fmt.Errorf("data hashes to %s", key.Key(sum))
+	}
+	return nil
+}
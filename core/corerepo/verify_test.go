@@ -0,0 +1,56 @@
+package corerepo
+
+import (
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	"github.com/ipfs/go-ipfs/core"
+)
+
+func TestVerifyBlocks(t *testing.T) {
+	n, err := core.NewNodeBuilder().Build(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	good := blocks.NewBlock([]byte("good"))
+	if err := n.Blockstore.Put(good); err != nil {
+		t.Fatal(err)
+	}
+	bad := blocks.NewBlock([]byte("bad"))
+	dskey := bstore.BlockPrefix.Child(bad.Key().DsKey())
+	if err := n.Repo.Datastore().Put(dskey, []byte("rotten")); err != nil {
+		t.Fatal(err)
+	}
+
+	checks, err := VerifyBlocks(context.Background(), n, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified := 0
+	for c := range checks {
+		verified++
+		switch c.Key {
+		case good.Key():
+			if c.Err != nil || c.Removed {
+				t.Fatalf("good block found corrupt: %v", c.Err)
+			}
+		case bad.Key():
+			if c.Err == nil || !c.Removed {
+				t.Fatal("corrupt block not found and removed")
+			}
+		}
+	}
+	if verified < 2 {
+		t.Fatalf("expected both blocks verified, got %d", verified)
+	}
+	if has, _ := n.Blockstore.Has(bad.Key()); has {
+		t.Fatal("corrupt block still in the blockstore")
+	}
+	if has, _ := n.Blockstore.Has(good.Key()); !has {
+		t.Fatal("good block removed")
+	}
+}
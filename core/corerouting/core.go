@@ -9,6 +9,7 @@ import (
 	"github.com/ipfs/go-ipfs/p2p/host"
 	"github.com/ipfs/go-ipfs/p2p/peer"
 	routing "github.com/ipfs/go-ipfs/routing"
+	delegated "github.com/ipfs/go-ipfs/routing/delegated"
 	supernode "github.com/ipfs/go-ipfs/routing/supernode"
 	gcproxy "github.com/ipfs/go-ipfs/routing/supernode/proxy"
 )
@@ -22,6 +23,7 @@ var (
 	errIdentityMissing  = errors.New("supernode routing server requires a peer ID identity")
 	errPeerstoreMissing = errors.New("supernode routing server requires a peerstore")
 	errServersMissing   = errors.New("supernode routing client requires at least 1 server peer")
+	errDelegateMissing  = errors.New("delegated routing requires the API address of a delegate in DelegatedRouting.API")
 )
 
 // SupernodeServer returns a configuration for a routing server that stores
@@ -54,3 +56,14 @@ func SupernodeClient(remotes ...peer.PeerInfo) core.RoutingOption {
 		return supernode.NewClient(proxy, ph, ph.Peerstore(), ph.ID())
 	}
 }
+
+// Delegated returns a configuration for a routing client which forwards
+// its queries to the HTTP API of the node at apiAddr.
+func Delegated(apiAddr string) core.RoutingOption {
+	return func(ctx context.Context, ph host.Host, dstore ds.ThreadSafeDatastore) (routing.IpfsRouting, error) {
+		if apiAddr == "" {
+			return nil, errDelegateMissing
+		}
+		return delegated.NewClient(apiAddr, ph.Peerstore())
+	}
+}
@@ -24,6 +24,7 @@ var log = eventlog.Logger("coreunix")
 // Add builds a merkledag from the a reader, pinning all objects to the local
 // datastore. Returns a key representing the root node.
 func Add(n *core.IpfsNode, r io.Reader) (string, error) {
+	defer n.GCLocker.PinLock()()
 	// TODO more attractive function signature importer.BuildDagFromReader
 	dagNode, err := importer.BuildDagFromReader(
 		r,
@@ -44,6 +45,7 @@ func Add(n *core.IpfsNode, r io.Reader) (string, error) {
 
 // AddR recursively adds files in |path|.
 func AddR(n *core.IpfsNode, root string) (key string, err error) {
+	defer n.GCLocker.PinLock()()
 	f, err := os.Open(root)
 	if err != nil {
 		return "", err
@@ -79,6 +81,7 @@ func AddR(n *core.IpfsNode, root string) (key string, err error) {
 // Returns the path of the added file ("<dir hash>/filename"), the DAG node of
 // the directory, and and error if any.
 func AddWrapped(n *core.IpfsNode, r io.Reader, filename string) (string, *merkledag.Node, error) {
+	defer n.GCLocker.PinLock()()
 	file := files.NewReaderFile(filename, ioutil.NopCloser(r), nil)
 	dir := files.NewSliceFile("", []files.File{file})
 	dagnode, err := addDir(n, dir)
@@ -127,6 +130,14 @@ func addFile(n *core.IpfsNode, file files.File) (*merkledag.Node, error) {
 		return addDir(n, file)
 	}
 
+	if s, ok := file.(*files.Symlink); ok {
+		sdata, err := unixfs.SymlinkData(s.Target)
+		if err != nil {
+			return nil, err
+		}
+		return &merkledag.Node{Data: sdata}, nil
+	}
+
 	dagnode, err := add(n, file)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	ipnsfs "github.com/ipfs/go-ipfs/ipnsfs"
+	merkledag "github.com/ipfs/go-ipfs/merkledag"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+)
+
+// filesRootKey is the datastore key holding the root of the 'ipfs files'
+// tree.
+var filesRootKey = ds.NewKey("/local/filesroot")
+
+// setupFilesRoot loads the root of the 'ipfs files' tree from the repo,
+// starting with an empty directory if there is none yet.
+func (n *IpfsNode) setupFilesRoot(ctx context.Context) error {
+	dstore := n.Repo.Datastore()
+
+	var nd *merkledag.Node
+	val, err := dstore.Get(filesRootKey)
+	if err == nil && val == nil {
+		// a datastore that keeps nothing, as behind 'ipfs add --only-hash'
+		err = ds.ErrNotFound
+	}
+	switch err {
+	case ds.ErrNotFound:
+		nd = uio.NewEmptyDirectory()
+		if _, err := n.DAG.Add(nd); err != nil {
+			return err
+		}
+	case nil:
+		b, ok := val.([]byte)
+		if !ok {
+			return errors.New("files root in datastore is not a key")
+		}
+		nd, err = n.DAG.Get(ctx, key.Key(b))
+		if err != nil {
+			return fmt.Errorf("could not load files root %s: %s", key.Key(b), err)
+		}
+	default:
+		return err
+	}
+
+	return n.openFilesRoot(ctx, nd)
+}
+
+// SetFilesRoot replaces the root of the 'ipfs files' tree with nd, which
+// is pinned in place of the old root.
+func (n *IpfsNode) SetFilesRoot(ctx context.Context, nd *merkledag.Node) error {
+	var old key.Key
+	if n.FilesRoot != nil {
+		k, err := n.FilesRoot.GetNode().Key()
+		if err != nil {
+			return err
+		}
+		old = k
+	}
+	if err := n.recordFilesRoot(ctx, old, nd); err != nil {
+		return err
+	}
+	return n.openFilesRoot(ctx, nd)
+}
+
+// recordFilesRoot makes nd the root of the 'ipfs files' tree in the repo,
+// in place of old. The recursive pin of old, if it has one, is moved to
+// nd, which only walks the parts of the tree that changed; otherwise nd
+// is pinned in full. nd is pinned before it replaces old in the
+// datastore, so that a mutation is either recorded whole or not at all.
+func (n *IpfsNode) recordFilesRoot(ctx context.Context, old key.Key, nd *merkledag.Node) error {
+	defer n.GCLocker.PinLock()()
+	k, err := nd.Key()
+	if err != nil {
+		return err
+	}
+	if k == old {
+		return nil
+	}
+
+	moved, pinned := false, false
+	for _, rk := range n.Pinning.RecursiveKeys() {
+		moved = moved || rk == old
+		pinned = pinned || rk == k
+	}
+	if moved {
+		err = n.Pinning.Update(ctx, old, nd)
+	} else {
+		// the first root of a new repo is never pinned
+		err = n.Pinning.Pin(ctx, nd, true)
+	}
+	if err == nil {
+		err = n.Pinning.Flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := n.Repo.Datastore().Put(filesRootKey, []byte(k)); err != nil {
+		// keep old pinned, as the repo still records it
+		if moved {
+			oldnd, gerr := n.DAG.Get(ctx, old)
+			if gerr == nil {
+				gerr = n.Pinning.Update(ctx, k, oldnd)
+			}
+			if gerr != nil {
+				log.Errorf("re-pinning the files root %s: %s", old, gerr)
+			}
+		} else if !pinned {
+			if uerr := n.Pinning.Unpin(ctx, k, true); uerr != nil {
+				log.Debugf("unpinning files root %s: %s", k, uerr)
+			}
+		}
+		if ferr := n.Pinning.Flush(); ferr != nil {
+			log.Errorf("saving the pins: %s", ferr)
+		}
+		return err
+	}
+	return nil
+}
+
+// openFilesRoot sets the root of the 'ipfs files' tree to nd, which is the
+// one in the repo.
+func (n *IpfsNode) openFilesRoot(ctx context.Context, nd *merkledag.Node) error {
+	current, err := nd.Key()
+	if err != nil {
+		return err
+	}
+
+	update := func(nd *merkledag.Node) error {
+		k, err := nd.Key()
+		if err != nil {
+			return err
+		}
+		if err := n.recordFilesRoot(ctx, current, nd); err != nil {
+			return err
+		}
+		current = k
+		return nil
+	}
+
+	root, err := ipnsfs.NewRoot(n.DAG, n.Pinning, nd, update)
+	if err != nil {
+		return err
+	}
+	n.FilesRoot = root
+	return nil
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	ipnsfs "github.com/ipfs/go-ipfs/ipnsfs"
+	"github.com/ipfs/go-ipfs/repo"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+	"github.com/ipfs/go-ipfs/util/testutil"
+)
+
+func TestFilesRootPersists(t *testing.T) {
+	ctx := context.Background()
+	r := &repo.Mock{
+		C: config.Config{Identity: testIdentity},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	n, err := NewIPFSNode(ctx, Offline(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := n.FilesRoot.GetValue().Mkdir("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := n.FilesRoot.GetNode().Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !n.Pinning.IsPinned(first) {
+		t.Fatal("files root was not pinned")
+	}
+
+	nd := uio.NewEmptyDirectory()
+	if _, err := n.DAG.Add(nd); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.AddChild("sub", nd); err != nil {
+		t.Fatal(err)
+	}
+	second, err := n.FilesRoot.GetNode().Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Fatal("root didn't change")
+	}
+	if n.Pinning.IsPinned(first) {
+		t.Fatal("replaced files root is still pinned")
+	}
+
+	// a node opened on the same repo picks up where the first left off
+	n2, err := NewIPFSNode(ctx, Offline(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := n2.FilesRoot.GetNode().Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k != second {
+		t.Fatalf("expected root %s after reopening, got %s", second, k)
+	}
+	fsn, err := ipnsfs.Lookup(n2.FilesRoot.GetValue(), "/dir/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsn.Type() != ipnsfs.TDir {
+		t.Fatal("/dir/sub is not a directory")
+	}
+	if _, err := ipnsfs.Lookup(n2.FilesRoot.GetValue(), "/dir/sub/missing"); err == nil {
+		t.Fatal("expected an error looking up a missing entry")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/ipfs/go-ipfs/blocks/blockstore"
 	blockservice "github.com/ipfs/go-ipfs/blockservice"
 	core "github.com/ipfs/go-ipfs/core"
+	denylist "github.com/ipfs/go-ipfs/denylist"
 	"github.com/ipfs/go-ipfs/exchange/offline"
 	mdag "github.com/ipfs/go-ipfs/merkledag"
 	nsys "github.com/ipfs/go-ipfs/namesys"
@@ -70,10 +71,15 @@ func NewMockNode() (*core.IpfsNode, error) {
 	nd.Pinning = pin.NewPinner(nd.Repo.Datastore(), nd.DAG)
 
 	// Namespace resolver
-	nd.Namesys = nsys.NewNameSystem(nd.Routing)
+	nd.Namesys = nsys.NewNameSystem(nd.Routing, nd.Repo.Datastore())
 
 	// Path resolver
 	nd.Resolver = &path.Resolver{DAG: nd.DAG}
 
+	nd.Denylist, err = denylist.New()
+	if err != nil {
+		return nil, err
+	}
+
 	return nd, nil
 }
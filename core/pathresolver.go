@@ -6,6 +6,7 @@ import (
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	merkledag "github.com/ipfs/go-ipfs/merkledag"
 	path "github.com/ipfs/go-ipfs/path"
 )
@@ -55,3 +56,21 @@ func Resolve(ctx context.Context, n *IpfsNode, p path.Path) (*merkledag.Node, er
 	// ok, we have an ipfs path now (or what we'll treat as one)
 	return n.Resolver.ResolvePath(ctx, p)
 }
+
+// ResolveToKey resolves the given path to the key of the object it names,
+// as Resolve does. A path that is just a key, such as /ipfs/<key>, is
+// taken as is, without fetching the object.
+func ResolveToKey(ctx context.Context, n *IpfsNode, p path.Path) (key.Key, error) {
+	if pp, err := path.ParsePath(p.String()); err == nil {
+		seg := pp.Segments()
+		if len(seg) == 2 && seg[0] == "ipfs" {
+			return key.B58KeyDecode(seg[1]), nil
+		}
+	}
+
+	nd, err := Resolve(ctx, n, p)
+	if err != nil {
+		return "", err
+	}
+	return nd.Key()
+}
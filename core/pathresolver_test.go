@@ -1,11 +1,19 @@
 package core_test
 
 import (
+	"io/ioutil"
 	"testing"
 
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	core "github.com/ipfs/go-ipfs/core"
 	coremock "github.com/ipfs/go-ipfs/core/mock"
+	dag "github.com/ipfs/go-ipfs/merkledag"
 	path "github.com/ipfs/go-ipfs/path"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+	u "github.com/ipfs/go-ipfs/util"
 )
 
 func TestResolveNoComponents(t *testing.T) {
@@ -25,3 +33,58 @@ func TestResolveNoComponents(t *testing.T) {
 	}
 
 }
+
+func TestResolveCids(t *testing.T) {
+	n, err := coremock.NewMockNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := &dag.Node{Data: []byte("raw leaf")}
+	leaf.SetPrefix(cid.Prefix{Version: 1, Codec: cid.Raw, MhType: u.SHA3_256, MhLength: 32})
+	root := &dag.Node{Data: ft.FolderPBData()}
+	root.SetPrefix(cid.Prefix{Version: 1, Codec: cid.DagProtobuf, MhType: mh.SHA2_256, MhLength: 32})
+	if err := root.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.DAG.AddRecursive(root); err != nil {
+		t.Fatal(err)
+	}
+	k, err := root.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := path.ParsePath("/ipfs/" + k.B58String() + "/leaf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err := core.Resolve(n.Context(), n, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := uio.NewDagReader(n.Context(), nd, n.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "raw leaf" {
+		t.Fatalf("expected the raw leaf, got %q", data)
+	}
+
+	if err := n.Pinning.Pin(n.Context(), root, true); err != nil {
+		t.Fatal(err)
+	}
+	leafk, err := leaf.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []key.Key{k, leafk} {
+		if !n.Pinning.IsPinned(k) {
+			t.Fatalf("expected %s pinned", k)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	math2 "github.com/ipfs/go-ipfs/thirdparty/math2"
+)
+
+// savedPeersKey is the datastore key holding the peers remembered across
+// restarts.
+var savedPeersKey = ds.NewKey("/local/peerstore")
+
+const (
+	defaultPeerstoreTTL      = 24 * time.Hour
+	defaultPeerstoreMaxPeers = 100
+
+	// peerstoreSaveInterval is how often the peers connected to are
+	// saved, besides when the node closes.
+	peerstoreSaveInterval = 10 * time.Minute
+)
+
+// SavedPeer is a peer the node remembers across restarts: its addresses
+// and protocols, as of when the node was last connected to it.
+type SavedPeer struct {
+	ID        string
+	Addrs     []string
+	Protocols []string `json:",omitempty"`
+	LastSeen  time.Time
+}
+
+// LoadSavedPeers returns the peers saved in dstore, the most recently
+// connected to first.
+func LoadSavedPeers(dstore ds.Datastore) ([]SavedPeer, error) {
+	val, err := dstore.Get(savedPeersKey)
+	if err == ds.ErrNotFound || (err == nil && val == nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, ok := val.([]byte)
+	if !ok {
+		return nil, errors.New("saved peers in datastore are not bytes")
+	}
+
+	var saved []SavedPeer
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, fmt.Errorf("could not load the saved peers: %s", err)
+	}
+	sortSavedPeers(saved)
+	return saved, nil
+}
+
+func sortSavedPeers(saved []SavedPeer) {
+	sort.Sort(byLastSeen(saved))
+}
+
+type byLastSeen []SavedPeer
+
+func (s byLastSeen) Len() int           { return len(s) }
+func (s byLastSeen) Less(i, j int) bool { return s[i].LastSeen.After(s[j].LastSeen) }
+func (s byLastSeen) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// peerMemory remembers the peers the node connects to in the repo, and
+// fills the peerstore with them when the node starts again, so it can
+// dial them without waiting for the bootstrap peers.
+type peerMemory struct {
+	n   *IpfsNode
+	ttl time.Duration
+	max int
+
+	mu    sync.Mutex
+	peers map[peer.ID]SavedPeer
+}
+
+// peerstoreLimits returns how long and how many peers cfg has remembered.
+// A TTL of 0 remembers none.
+func peerstoreLimits(cfg config.Peerstore) (time.Duration, int, error) {
+	ttl := defaultPeerstoreTTL
+	if cfg.TTL != "" {
+		d, err := time.ParseDuration(cfg.TTL)
+		if err != nil {
+			return 0, 0, fmt.Errorf("incorrectly formatted duration in config.Peerstore.TTL: %s", cfg.TTL)
+		}
+		ttl = d
+	}
+	max := cfg.MaxPeers
+	if max <= 0 {
+		max = defaultPeerstoreMaxPeers
+	}
+	return ttl, max, nil
+}
+
+// startPeerMemory restores the peers saved in the repo to the peerstore,
+// and saves those connected to periodically, until ctx is done.
+func (n *IpfsNode) startPeerMemory(ctx context.Context) error {
+	ttl, max, err := peerstoreLimits(n.Repo.Config().Peerstore)
+	if err != nil || ttl <= 0 {
+		return err
+	}
+
+	saved, err := LoadSavedPeers(n.Repo.Datastore())
+	if err != nil {
+		return err
+	}
+
+	m := &peerMemory{
+		n:     n,
+		ttl:   ttl,
+		max:   max,
+		peers: make(map[peer.ID]SavedPeer),
+	}
+	now := time.Now()
+	for _, sp := range saved {
+		left := sp.LastSeen.Add(ttl).Sub(now)
+		if left <= 0 {
+			continue
+		}
+		p, err := peer.IDB58Decode(sp.ID)
+		if err != nil || p == n.Identity {
+			continue
+		}
+		var addrs []ma.Multiaddr
+		for _, s := range sp.Addrs {
+			a, err := ma.NewMultiaddr(s)
+			if err != nil {
+				log.Debugf("skipping invalid saved address %q of %s: %s", s, sp.ID, err)
+				continue
+			}
+			addrs = append(addrs, a)
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+
+		n.Peerstore.AddAddrs(p, addrs, left)
+		if len(sp.Protocols) > 0 {
+			n.Peerstore.Put(p, "Protocols", sp.Protocols)
+		}
+		m.peers[p] = sp
+	}
+	log.Debugf("restored %d saved peers", len(m.peers))
+	n.peerMemory = m
+
+	go func() {
+		t := time.NewTicker(peerstoreSaveInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := m.save(); err != nil {
+					log.Errorf("saving the peerstore: %s", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// bootstrapPeers returns the remembered peers, to dial along with the
+// bootstrap peers of the config.
+func (m *peerMemory) bootstrapPeers() []peer.PeerInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pis []peer.PeerInfo
+	for p := range m.peers {
+		if pi := m.n.Peerstore.PeerInfo(p); len(pi.Addrs) > 0 {
+			pis = append(pis, pi)
+		}
+	}
+	return pis
+}
+
+// save records the peers connected to now, along with those remembered
+// from before which haven't expired, in the repo.
+func (m *peerMemory) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	ps := m.n.Peerstore
+	for _, p := range m.n.PeerHost.Network().Peers() {
+		if p == m.n.Identity {
+			continue
+		}
+		sp := SavedPeer{
+			ID:       p.Pretty(),
+			LastSeen: now,
+		}
+		for _, a := range ps.Addrs(p) {
+			sp.Addrs = append(sp.Addrs, a.String())
+		}
+		if len(sp.Addrs) == 0 {
+			continue
+		}
+		if v, err := ps.Get(p, "Protocols"); err == nil {
+			sp.Protocols, _ = v.([]string)
+		}
+		m.peers[p] = sp
+	}
+
+	saved := make([]SavedPeer, 0, len(m.peers))
+	for p, sp := range m.peers {
+		if now.Sub(sp.LastSeen) >= m.ttl {
+			delete(m.peers, p)
+			continue
+		}
+		saved = append(saved, sp)
+	}
+	sortSavedPeers(saved)
+	// forget the peers least recently connected to
+	keep := math2.IntMin(len(saved), m.max)
+	for _, sp := range saved[keep:] {
+		if p, err := peer.IDB58Decode(sp.ID); err == nil {
+			delete(m.peers, p)
+		}
+	}
+	saved = saved[:keep]
+
+	b, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return m.n.Repo.Datastore().Put(savedPeersKey, b)
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	host "github.com/ipfs/go-ipfs/p2p/host"
+	mocknet "github.com/ipfs/go-ipfs/p2p/net/mock"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	"github.com/ipfs/go-ipfs/repo"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	"github.com/ipfs/go-ipfs/util/testutil"
+)
+
+// nodeWithHost returns an offline node on r, given the network of h.
+func nodeWithHost(t *testing.T, ctx context.Context, r repo.Repo, h host.Host) *IpfsNode {
+	n, err := NewIPFSNode(ctx, Offline(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Identity = h.ID()
+	n.Peerstore = h.Peerstore()
+	n.PeerHost = h
+	if err := n.startPeerMemory(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestPeerMemory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	// rather than wait for identify to exchange them
+	for _, h := range hosts[1:] {
+		hosts[0].Peerstore().AddAddrs(h.ID(), h.Addrs(), peer.PermanentAddrTTL)
+	}
+
+	r := &repo.Mock{
+		C: config.Config{
+			Identity:  testIdentity,
+			Peerstore: config.Peerstore{TTL: "1h", MaxPeers: 2},
+		},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+
+	// a peer seen long ago is forgotten
+	stale := SavedPeer{
+		ID:       hosts[3].ID().Pretty(),
+		Addrs:    []string{hosts[3].Addrs()[0].String()},
+		LastSeen: time.Now().Add(-2 * time.Hour),
+	}
+	b, err := json.Marshal([]SavedPeer{stale})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.D.Put(savedPeersKey, b); err != nil {
+		t.Fatal(err)
+	}
+
+	n := nodeWithHost(t, ctx, r, hosts[0])
+	if len(n.peerMemory.peers) != 0 {
+		t.Fatalf("restored a stale peer: %v", n.peerMemory.peers)
+	}
+	if err := n.peerMemory.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// of the three peers connected to, MaxPeers are saved
+	saved, err := LoadSavedPeers(r.D)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("expected 2 saved peers, got %d", len(saved))
+	}
+	for _, sp := range saved {
+		if sp.ID == hosts[0].ID().Pretty() {
+			t.Fatal("saved the node itself")
+		}
+		if len(sp.Addrs) == 0 || time.Since(sp.LastSeen) > time.Minute {
+			t.Fatalf("bad saved peer: %v", sp)
+		}
+	}
+
+	// a node restarted on the repo, knowing no one, is given them back
+	h, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n2 := nodeWithHost(t, ctx, r, h)
+	pis := n2.peerMemory.bootstrapPeers()
+	if len(pis) != 2 {
+		t.Fatalf("expected 2 peers to bootstrap with, got %d", len(pis))
+	}
+	for _, pi := range pis {
+		if len(h.Peerstore().Addrs(pi.ID)) == 0 {
+			t.Fatalf("the addresses of %s were not restored", pi.ID)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// package denylist implements the list of content a node refuses to serve,
+// by hash or path prefix, e.g. for the operators of public gateways to
+// handle abuse.
+package denylist
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	gopath "path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
+)
+
+var log = eventlog.Logger("denylist")
+
+// auditSize is how many of the latest blocked requests are kept.
+const auditSize = 1000
+
+// Blocked is a request denied by an entry of the list.
+type Blocked struct {
+	Time time.Time
+	// What is the path or hash requested.
+	What string
+	// Entry is the entry of the list denying it.
+	Entry string
+	// Source is what asked, like "gateway" or "bitswap <peer>".
+	Source string
+}
+
+// Denylist holds the denied hashes, and path prefixes. Entries are hashes,
+// like "Qm...", or "/ipfs/Qm..." which is the same, and path prefixes like
+// "/ipns/example.com/private", which deny the path and those under it.
+type Denylist struct {
+	mx       sync.RWMutex
+	keys     map[key.Key]struct{}
+	prefixes map[string]struct{}
+
+	// audit holds the latest requests blocked, oldest first.
+	audit []Blocked
+}
+
+// New returns a Denylist of entries.
+func New(entries ...string) (*Denylist, error) {
+	d := &Denylist{
+		keys:     make(map[key.Key]struct{}),
+		prefixes: make(map[string]struct{}),
+	}
+	if err := d.Add(entries...); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ParseEntry returns entry in the form it is listed in: a hash, or a clean
+// path deeper than a hash.
+func ParseEntry(entry string) (string, error) {
+	if !strings.HasPrefix(entry, "/") {
+		if _, err := mh.FromB58String(entry); err != nil {
+			return "", fmt.Errorf("invalid denylist entry %q: not a hash nor a path", entry)
+		}
+		return entry, nil
+	}
+
+	p := gopath.Clean(entry)
+	parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	if len(parts) < 2 || (parts[0] != "ipfs" && parts[0] != "ipns") || parts[1] == "" {
+		return "", fmt.Errorf("invalid denylist entry %q: paths start with /ipfs/ or /ipns/", entry)
+	}
+	if parts[0] == "ipfs" {
+		if _, err := mh.FromB58String(parts[1]); err != nil {
+			return "", fmt.Errorf("invalid denylist entry %q: %s", entry, err)
+		}
+		if len(parts) == 2 {
+			return parts[1], nil
+		}
+	}
+	return p, nil
+}
+
+// Add adds entries to the list. None is added if one is invalid.
+func (d *Denylist) Add(entries ...string) error {
+	parsed := make([]string, 0, len(entries))
+	for _, e := range entries {
+		p, err := ParseEntry(e)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, p)
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	for _, p := range parsed {
+		if strings.HasPrefix(p, "/") {
+			d.prefixes[p] = struct{}{}
+		} else {
+			d.keys[key.B58KeyDecode(p)] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Remove removes entry from the list, and returns whether it was listed.
+func (d *Denylist) Remove(entry string) (bool, error) {
+	p, err := ParseEntry(entry)
+	if err != nil {
+		return false, err
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	if strings.HasPrefix(p, "/") {
+		_, ok := d.prefixes[p]
+		delete(d.prefixes, p)
+		return ok, nil
+	}
+	k := key.B58KeyDecode(p)
+	_, ok := d.keys[k]
+	delete(d.keys, k)
+	return ok, nil
+}
+
+// Entries returns the entries of the list, sorted.
+func (d *Denylist) Entries() []string {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+
+	entries := make([]string, 0, len(d.keys)+len(d.prefixes))
+	for k := range d.keys {
+		entries = append(entries, k.B58String())
+	}
+	for p := range d.prefixes {
+		entries = append(entries, p)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// DeniedKey returns the entry denying k, if one does.
+func (d *Denylist) DeniedKey(k key.Key) (string, bool) {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+	if _, ok := d.keys[k]; ok {
+		return k.B58String(), true
+	}
+	return "", false
+}
+
+// DeniedPath returns the entry denying the path p, if one does: a prefix
+// of p, or the hash p starts from.
+func (d *Denylist) DeniedPath(p string) (string, bool) {
+	p = gopath.Clean(p)
+	parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	if len(parts) >= 2 && parts[0] == "ipfs" {
+		if entry, ok := d.DeniedKey(key.B58KeyDecode(parts[1])); ok {
+			return entry, true
+		}
+	}
+
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+	for prefix := p; prefix != "/" && prefix != "."; prefix = gopath.Dir(prefix) {
+		if _, ok := d.prefixes[prefix]; ok {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+// Audit records that the request for what, from source, was blocked by
+// entry.
+func (d *Denylist) Audit(what, entry, source string) {
+	b := Blocked{
+		Time:   time.Now(),
+		What:   what,
+		Entry:  entry,
+		Source: source,
+	}
+	log.Event(context.Background(), "denylistBlocked", eventlog.LoggableMap{
+		"what":   what,
+		"entry":  entry,
+		"source": source,
+	})
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	if len(d.audit) >= auditSize {
+		copy(d.audit, d.audit[1:])
+		d.audit = d.audit[:auditSize-1]
+	}
+	d.audit = append(d.audit, b)
+}
+
+// AuditLog returns the latest requests blocked, oldest first.
+func (d *Denylist) AuditLog() []Blocked {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+	return append([]Blocked(nil), d.audit...)
+}
+
+// ReadFile returns the entries of the file name, one per line. Blank lines
+// and those starting with "#" are left out.
+func ReadFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,138 @@
+package denylist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+const (
+	hashA = "QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n"
+	hashB = "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"
+)
+
+func TestParseEntry(t *testing.T) {
+	cases := map[string]string{
+		hashA:                            hashA,
+		"/ipfs/" + hashA:                 hashA,
+		"/ipfs/" + hashA + "/":           hashA,
+		"/ipfs/" + hashA + "/a//b":       "/ipfs/" + hashA + "/a/b",
+		"/ipns/example.com/private/":     "/ipns/example.com/private",
+		"/ipns/example.com/a/../private": "/ipns/example.com/private",
+	}
+	for in, out := range cases {
+		got, err := ParseEntry(in)
+		if err != nil {
+			t.Fatalf("%s: %s", in, err)
+		}
+		if got != out {
+			t.Fatalf("%s: expected %s, got %s", in, out, got)
+		}
+	}
+
+	for _, bad := range []string{"", "nothash", "/ipfs/", "/ipfs/nothash", "/foo/bar", "/ipns"} {
+		if _, err := ParseEntry(bad); err == nil {
+			t.Fatalf("expected %q to be invalid", bad)
+		}
+	}
+}
+
+func TestDenied(t *testing.T) {
+	d, err := New(hashA, "/ipns/example.com/private")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := d.DeniedKey(key.B58KeyDecode(hashA)); !ok {
+		t.Fatal("expected hashA to be denied")
+	}
+	if _, ok := d.DeniedKey(key.B58KeyDecode(hashB)); ok {
+		t.Fatal("expected hashB not to be denied")
+	}
+
+	denied := map[string]string{
+		"/ipfs/" + hashA:                    hashA,
+		"/ipfs/" + hashA + "/file":          hashA,
+		"/ipns/example.com/private":         "/ipns/example.com/private",
+		"/ipns/example.com/private/a/b.txt": "/ipns/example.com/private",
+	}
+	for p, entry := range denied {
+		got, ok := d.DeniedPath(p)
+		if !ok || got != entry {
+			t.Fatalf("expected %s to be denied by %s, got %q", p, entry, got)
+		}
+	}
+	for _, p := range []string{"/ipfs/" + hashB, "/ipns/example.com", "/ipns/example.com/privateer"} {
+		if entry, ok := d.DeniedPath(p); ok {
+			t.Fatalf("expected %s not to be denied, but %s does", p, entry)
+		}
+	}
+
+	ok, err := d.Remove("/ipfs/" + hashA)
+	if err != nil || !ok {
+		t.Fatalf("expected hashA to be removed: %v", err)
+	}
+	if ok, _ := d.Remove(hashA); ok {
+		t.Fatal("expected hashA to be removed already")
+	}
+	if _, ok := d.DeniedPath("/ipfs/" + hashA); ok {
+		t.Fatal("expected hashA not to be denied once removed")
+	}
+}
+
+func TestAddInvalid(t *testing.T) {
+	d, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Add(hashA, "nothash"); err == nil {
+		t.Fatal("expected an invalid entry to fail")
+	}
+	if len(d.Entries()) != 0 {
+		t.Fatalf("expected no entry to be added, got %v", d.Entries())
+	}
+}
+
+func TestAudit(t *testing.T) {
+	d, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < auditSize+10; i++ {
+		d.Audit("/ipfs/"+hashA, hashA, "gateway")
+	}
+	d.Audit(hashB, hashB, "bitswap")
+
+	l := d.AuditLog()
+	if len(l) != auditSize {
+		t.Fatalf("expected %d blocked requests kept, got %d", auditSize, len(l))
+	}
+	if last := l[len(l)-1]; last.What != hashB || last.Source != "bitswap" {
+		t.Fatalf("expected the latest blocked request last, got %+v", last)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "denylist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "denylist")
+	content := "# abuse reports\n" + hashA + "\n\n  /ipns/example.com/private  \n"
+	if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0] != hashA || entries[1] != "/ipns/example.com/private" {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+}
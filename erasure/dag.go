@@ -0,0 +1,398 @@
+package erasure
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	ipld "github.com/ipfs/go-ipfs/ipld"
+	merkledag "github.com/ipfs/go-ipfs/merkledag"
+	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
+)
+
+var log = eventlog.Logger("erasure")
+
+// fetchTimeout is how long Repair waits for a parity shard it doesn't have
+// to be fetched.
+const fetchTimeout = time.Minute
+
+// Manifest tells how the blocks of the DAG under Root were erasure coded:
+// in groups of K, with N-K parity shards each.
+type Manifest struct {
+	Root   key.Key
+	K, N   int
+	Groups []Group
+	// Services are the remote pinning services asked to pin the parity
+	// shards, in turn: the i-th shard of the manifest, counting those of
+	// the groups before, goes to the (i mod len(Services))-th.
+	Services []string
+}
+
+// Group is K blocks of a DAG, or fewer for the last one, and their parity
+// shards. The blocks are padded with zeros to the length of the longest,
+// and the missing ones are zeros.
+type Group struct {
+	Blocks []key.Key
+	Sizes  []int
+	Parity []key.Key
+	// ParitySize is the size of each parity node of the group.
+	ParitySize uint64
+}
+
+// Service returns the remote pinning service the j-th parity shard of the
+// g-th group was asked of, or "" if none was.
+func (m *Manifest) Service(g, j int) string {
+	if len(m.Services) == 0 {
+		return ""
+	}
+	return m.Services[(g*(m.N-m.K)+j)%len(m.Services)]
+}
+
+// Encode erasure codes the blocks of the DAG under root, getting them from
+// bg, k at a time with n-k parity shards, adding the parity shards to ds as
+// nodes of their own.
+func Encode(ctx context.Context, bg ipld.BlockGetter, ds merkledag.DAGService, root key.Key, k, n int) (*Manifest, error) {
+	code, err := New(k, n)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Root: root, K: k, N: n}
+	var group []*blocks.Block
+	flush := func() error {
+		g, err := encodeGroup(code, ds, group)
+		if err != nil {
+			return err
+		}
+		m.Groups = append(m.Groups, *g)
+		group = group[:0]
+		return nil
+	}
+
+	err = ipld.Walk(ctx, bg, []key.Key{root}, func(b *blocks.Block) error {
+		group = append(group, b)
+		if len(group) < k {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(group) > 0 {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func encodeGroup(code *Code, ds merkledag.DAGService, group []*blocks.Block) (*Group, error) {
+	g := &Group{}
+	size := 0
+	for _, b := range group {
+		g.Blocks = append(g.Blocks, b.Key())
+		g.Sizes = append(g.Sizes, len(b.Data))
+		if len(b.Data) > size {
+			size = len(b.Data)
+		}
+	}
+
+	parity, err := code.Encode(padShards(code.K(), size, group))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range parity {
+		nd := &merkledag.Node{Data: p}
+		pk, err := ds.Add(nd)
+		if err != nil {
+			return nil, err
+		}
+		g.Parity = append(g.Parity, pk)
+		if g.ParitySize, err = nd.Size(); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// padShards returns the data shards of the blocks of a group: k, of size
+// bytes, nil for the blocks not given.
+func padShards(k, size int, group []*blocks.Block) [][]byte {
+	shards := make([][]byte, k)
+	for i := range shards {
+		if i < len(group) {
+			if group[i] == nil {
+				continue
+			}
+			shards[i] = make([]byte, size)
+			copy(shards[i], group[i].Data)
+		} else {
+			shards[i] = make([]byte, size)
+		}
+	}
+	return shards
+}
+
+// manifestData is the manifest as it is stored, in the data of its node.
+type manifestData struct {
+	Root     string
+	K, N     int
+	Groups   []groupData
+	Services []string `json:",omitempty"`
+}
+
+type groupData struct {
+	Blocks     []string
+	Sizes      []int
+	Parity     []string
+	ParitySize uint64
+}
+
+// Node returns the node of m: its data is m, and its links go to the parity
+// shards, for pinning it recursively to keep them.
+func (m *Manifest) Node() (*merkledag.Node, error) {
+	md := manifestData{Root: m.Root.B58String(), K: m.K, N: m.N, Services: m.Services}
+	nd := new(merkledag.Node)
+	for i, g := range m.Groups {
+		gd := groupData{Sizes: g.Sizes, ParitySize: g.ParitySize}
+		for _, b := range g.Blocks {
+			gd.Blocks = append(gd.Blocks, b.B58String())
+		}
+		for j, p := range g.Parity {
+			gd.Parity = append(gd.Parity, p.B58String())
+			err := nd.AddRawLink(fmt.Sprintf("%d.%d", i, j), &merkledag.Link{
+				Hash: mh.Multihash(p),
+				Size: g.ParitySize,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		md.Groups = append(md.Groups, gd)
+	}
+
+	data, err := json.Marshal(md)
+	if err != nil {
+		return nil, err
+	}
+	nd.Data = data
+	return nd, nil
+}
+
+// ParseManifest returns the manifest of the node nd, as made by Node.
+func ParseManifest(nd *merkledag.Node) (*Manifest, error) {
+	var md manifestData
+	if err := json.Unmarshal(nd.Data, &md); err != nil {
+		return nil, fmt.Errorf("not an erasure coding manifest: %s", err)
+	}
+	if _, err := New(md.K, md.N); err != nil {
+		return nil, err
+	}
+
+	decode := func(s string) (key.Key, error) {
+		k := key.B58KeyDecode(s)
+		if k == "" {
+			return "", fmt.Errorf("invalid key %q in erasure coding manifest", s)
+		}
+		return k, nil
+	}
+	root, err := decode(md.Root)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{Root: root, K: md.K, N: md.N, Services: md.Services}
+	for _, gd := range md.Groups {
+		if len(gd.Blocks) > md.K || len(gd.Sizes) != len(gd.Blocks) || len(gd.Parity) != md.N-md.K {
+			return nil, fmt.Errorf("invalid group in erasure coding manifest of %s", root)
+		}
+		g := Group{Sizes: gd.Sizes, ParitySize: gd.ParitySize}
+		for _, s := range gd.Blocks {
+			k, err := decode(s)
+			if err != nil {
+				return nil, err
+			}
+			g.Blocks = append(g.Blocks, k)
+		}
+		for _, s := range gd.Parity {
+			k, err := decode(s)
+			if err != nil {
+				return nil, err
+			}
+			g.Parity = append(g.Parity, k)
+		}
+		m.Groups = append(m.Groups, g)
+	}
+	return m, nil
+}
+
+// Repair rebuilds the blocks of the groups of m which are missing from bs,
+// or corrupt in it, and their parity shards, and returns their keys. The
+// data blocks are put in bs, and the parity shards added to ds, which
+// fetches those bs doesn't have when a group needs them. Repair goes on
+// with the other groups when one has too few shards left to rebuild.
+func Repair(ctx context.Context, m *Manifest, bs bstore.Blockstore, ds merkledag.DAGService) ([]key.Key, error) {
+	code, err := New(m.K, m.N)
+	if err != nil {
+		return nil, err
+	}
+
+	var repaired []key.Key
+	var groupErr error
+	for i := range m.Groups {
+		keys, err := repairGroup(ctx, code, &m.Groups[i], bs, ds)
+		repaired = append(repaired, keys...)
+		if err == ErrTooFewShards {
+			if groupErr == nil {
+				groupErr = fmt.Errorf("group %d of %s has too few shards left to be rebuilt", i, m.Root)
+			}
+			continue
+		}
+		if err != nil {
+			return repaired, err
+		}
+	}
+	return repaired, groupErr
+}
+
+func repairGroup(ctx context.Context, code *Code, g *Group, bs bstore.Blockstore, ds merkledag.DAGService) ([]key.Key, error) {
+	size := 0
+	for _, s := range g.Sizes {
+		if s > size {
+			size = s
+		}
+	}
+
+	group := make([]*blocks.Block, len(g.Blocks))
+	for i, k := range g.Blocks {
+		group[i] = localBlock(bs, k)
+	}
+	shards := padShards(code.K(), size, group)
+	shards = append(shards, make([][]byte, code.N()-code.K())...)
+
+	present := 0
+	for i, k := range g.Parity {
+		if b := localBlock(bs, k); b != nil {
+			shards[code.K()+i] = parityShard(b, size)
+		}
+	}
+	for _, s := range shards {
+		if s != nil {
+			present++
+		}
+	}
+	if present == code.N() {
+		return nil, nil
+	}
+
+	// fetch the parity shards not held until there are enough.
+	for i, k := range g.Parity {
+		if present >= code.K() {
+			break
+		}
+		if shards[code.K()+i] != nil {
+			continue
+		}
+		fctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		nd, err := ds.Get(fctx, k)
+		cancel()
+		if err != nil {
+			log.Debugf("fetching parity shard %s: %s", k, err)
+			continue
+		}
+		if nk, err := nd.Key(); err != nil || nk != k || len(nd.Data) != size {
+			continue
+		}
+		shards[code.K()+i] = nd.Data
+		present++
+	}
+	if present < code.K() {
+		return nil, ErrTooFewShards
+	}
+
+	missing := make([]bool, len(shards))
+	for i, s := range shards {
+		missing[i] = s == nil
+	}
+	if err := code.Reconstruct(shards); err != nil {
+		return nil, err
+	}
+
+	var repaired []key.Key
+	for i, k := range g.Blocks {
+		if !missing[i] {
+			continue
+		}
+		data := shards[i][:g.Sizes[i]]
+		sum, err := blocks.SumLike(data, mh.Multihash(k))
+		if err != nil {
+			return repaired, err
+		}
+		if string(sum) != string(k) {
+			return repaired, fmt.Errorf("rebuilt block %s does not hash to its key", k)
+		}
+		// a corrupt copy would keep the block from being put.
+		if err := deleteCorrupt(bs, k); err != nil {
+			return repaired, err
+		}
+		if err := bs.Put(&blocks.Block{Multihash: sum, Data: data}); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, k)
+	}
+	for i, k := range g.Parity {
+		if !missing[code.K()+i] {
+			continue
+		}
+		if err := deleteCorrupt(bs, k); err != nil {
+			return repaired, err
+		}
+		nd := &merkledag.Node{Data: shards[code.K()+i]}
+		if nk, err := ds.Add(nd); err != nil {
+			return repaired, err
+		} else if nk != k {
+			return repaired, fmt.Errorf("rebuilt parity shard %s does not hash to its key", k)
+		}
+		repaired = append(repaired, k)
+	}
+	return repaired, nil
+}
+
+// localBlock returns the block k of bs, or nil if bs doesn't have it, or
+// has it corrupt.
+func localBlock(bs bstore.Blockstore, k key.Key) *blocks.Block {
+	b, err := bs.Get(k)
+	if err != nil {
+		return nil
+	}
+	sum, err := blocks.SumLike(b.Data, mh.Multihash(k))
+	if err != nil || string(sum) != string(k) {
+		return nil
+	}
+	return b
+}
+
+// deleteCorrupt removes the block k from bs, if bs has it, as it's corrupt
+// when it's rebuilt.
+func deleteCorrupt(bs bstore.Blockstore, k key.Key) error {
+	has, err := bs.Has(k)
+	if err != nil || !has {
+		return err
+	}
+	return bs.DeleteBlock(k)
+}
+
+// parityShard returns the shard of the parity node of b, or nil if it
+// isn't one of size bytes.
+func parityShard(b *blocks.Block, size int) []byte {
+	nd, err := merkledag.Decoded(b.Data)
+	if err != nil || len(nd.Data) != size {
+		return nil
+	}
+	return nd.Data
+}
@@ -0,0 +1,63 @@
+package erasure
+
+// The arithmetic of GF(2^8), the field of the bytes, modulo the polynomial
+// x^8 + x^4 + x^3 + x^2 + 1, of which 2 is a generator.
+const gfPoly = 0x11d
+
+var (
+	gfExp [510]byte
+	gfLog [256]byte
+	// gfMulTable[a][b] is a times b.
+	gfMulTable [256][256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= gfPoly
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			gfMulTable[a][b] = gfExp[int(gfLog[a])+int(gfLog[b])]
+		}
+	}
+}
+
+func gfMul(a, b byte) byte {
+	return gfMulTable[a][b]
+}
+
+// gfInv returns the inverse of a, which is not 0.
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+func gfPow(a byte, e int) byte {
+	if e == 0 {
+		return 1
+	}
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])*e)%255]
+}
+
+// mulAdd adds c times in to out.
+func mulAdd(c byte, in, out []byte) {
+	if c == 0 {
+		return
+	}
+	t := &gfMulTable[c]
+	for i, b := range in {
+		out[i] ^= t[b]
+	}
+}
@@ -0,0 +1,195 @@
+// Package erasure implements Reed-Solomon erasure codes, and their use to
+// keep the blocks of a DAG recoverable: the blocks are grouped k at a time,
+// and n-k parity shards computed of each group, of which any k shards are
+// enough to rebuild the others.
+package erasure
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooFewShards is returned when too many of the shards of a group are
+// lost for the others to be rebuilt.
+var ErrTooFewShards = errors.New("too few shards left to rebuild the others")
+
+// Code is a systematic Reed-Solomon code of k data shards to n shards in
+// all: the first k shards are the data, as they are, and the others parity.
+type Code struct {
+	k, n int
+	// rows are the coefficients of each shard of the k data shards. The
+	// first k are those of the identity.
+	rows matrix
+}
+
+// New returns the code of k data shards to n shards. k is at least 1, and
+// n more than k and at most 256.
+func New(k, n int) (*Code, error) {
+	if k < 1 || n <= k || n > 256 {
+		return nil, fmt.Errorf("invalid erasure code %d/%d: need 1 <= k < n <= 256", k, n)
+	}
+
+	// any k rows of a vandermonde matrix of distinct points are
+	// independent, and so are they once multiplied by the inverse of its
+	// top, which makes the code systematic.
+	v := make(matrix, n)
+	for r := range v {
+		v[r] = make([]byte, k)
+		for c := range v[r] {
+			v[r][c] = gfPow(byte(r), c)
+		}
+	}
+	top, err := v[:k].invert()
+	if err != nil {
+		return nil, err
+	}
+	return &Code{k: k, n: n, rows: v.mul(top)}, nil
+}
+
+// K returns the number of data shards of c.
+func (c *Code) K() int { return c.k }
+
+// N returns the number of shards of c, data and parity.
+func (c *Code) N() int { return c.n }
+
+// Encode returns the n-k parity shards of the k data shards, which are all
+// of the same length.
+func (c *Code) Encode(data [][]byte) ([][]byte, error) {
+	if len(data) != c.k {
+		return nil, fmt.Errorf("expected %d data shards, got %d", c.k, len(data))
+	}
+	size := len(data[0])
+	for _, d := range data {
+		if len(d) != size {
+			return nil, errors.New("data shards differ in length")
+		}
+	}
+
+	parity := make([][]byte, c.n-c.k)
+	for i := range parity {
+		parity[i] = make([]byte, size)
+		for j, d := range data {
+			mulAdd(c.rows[c.k+i][j], d, parity[i])
+		}
+	}
+	return parity, nil
+}
+
+// Reconstruct rebuilds the shards which are nil, data or parity, out of the
+// others, which are all of the same length. At least k are needed.
+func (c *Code) Reconstruct(shards [][]byte) error {
+	if len(shards) != c.n {
+		return fmt.Errorf("expected %d shards, got %d", c.n, len(shards))
+	}
+
+	var present []int
+	size := -1
+	for i, s := range shards {
+		if s == nil {
+			continue
+		}
+		if size >= 0 && len(s) != size {
+			return errors.New("shards differ in length")
+		}
+		size = len(s)
+		present = append(present, i)
+	}
+	if len(present) == c.n {
+		return nil
+	}
+	if len(present) < c.k {
+		return ErrTooFewShards
+	}
+
+	// the data are the inverse of the rows of k shards present times
+	// those shards.
+	present = present[:c.k]
+	sub := make(matrix, c.k)
+	for i, r := range present {
+		sub[i] = c.rows[r]
+	}
+	inv, err := sub.invert()
+	if err != nil {
+		return err
+	}
+
+	data := make([][]byte, c.k)
+	for i := range data {
+		if shards[i] != nil {
+			data[i] = shards[i]
+			continue
+		}
+		data[i] = make([]byte, size)
+		for j, r := range present {
+			mulAdd(inv[i][j], shards[r], data[i])
+		}
+	}
+	copy(shards, data)
+
+	for i := c.k; i < c.n; i++ {
+		if shards[i] != nil {
+			continue
+		}
+		shards[i] = make([]byte, size)
+		for j, d := range data {
+			mulAdd(c.rows[i][j], d, shards[i])
+		}
+	}
+	return nil
+}
+
+// matrix is a matrix over GF(2^8), by rows.
+type matrix [][]byte
+
+// mul returns m times o.
+func (m matrix) mul(o matrix) matrix {
+	out := make(matrix, len(m))
+	for r := range m {
+		out[r] = make([]byte, len(o[0]))
+		for i, c := range m[r] {
+			mulAdd(c, o[i], out[r])
+		}
+	}
+	return out
+}
+
+// invert returns the inverse of the square matrix m, by Gauss-Jordan
+// elimination, leaving m as it is.
+func (m matrix) invert() (matrix, error) {
+	size := len(m)
+	// work on m next to the identity, which becomes the inverse.
+	w := make(matrix, size)
+	for r := range w {
+		w[r] = make([]byte, 2*size)
+		copy(w[r], m[r])
+		w[r][size+r] = 1
+	}
+
+	for c := 0; c < size; c++ {
+		p := c
+		for p < size && w[p][c] == 0 {
+			p++
+		}
+		if p == size {
+			return nil, errors.New("singular matrix")
+		}
+		w[c], w[p] = w[p], w[c]
+
+		if inv := gfInv(w[c][c]); inv != 1 {
+			for i := range w[c] {
+				w[c][i] = gfMul(inv, w[c][i])
+			}
+		}
+		for r := 0; r < size; r++ {
+			if r != c && w[r][c] != 0 {
+				mulAdd(w[r][c], w[c], w[r])
+			}
+		}
+	}
+
+	inv := make(matrix, size)
+	for r := range inv {
+		inv[r] = w[r][size:]
+	}
+	return inv, nil
+}
@@ -0,0 +1,59 @@
+package erasure
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestReconstruct(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, kn := range [][2]int{{1, 2}, {4, 6}, {10, 14}, {3, 256}} {
+		k, n := kn[0], kn[1]
+		c, err := New(k, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := make([][]byte, k)
+		for i := range data {
+			data[i] = make([]byte, 100)
+			r.Read(data[i])
+		}
+		parity, err := c.Encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all := append(append([][]byte(nil), data...), parity...)
+
+		// lose n-k shards, at random.
+		shards := append([][]byte(nil), all...)
+		for _, i := range r.Perm(n)[:n-k] {
+			shards[i] = nil
+		}
+		if err := c.Reconstruct(shards); err != nil {
+			t.Fatalf("%d/%d: %s", k, n, err)
+		}
+		for i := range all {
+			if !bytes.Equal(shards[i], all[i]) {
+				t.Fatalf("%d/%d: shard %d rebuilt wrong", k, n, i)
+			}
+		}
+
+		shards = append([][]byte(nil), all...)
+		for _, i := range r.Perm(n)[:n-k+1] {
+			shards[i] = nil
+		}
+		if err := c.Reconstruct(shards); err != ErrTooFewShards {
+			t.Fatalf("%d/%d: expected too few shards, got %v", k, n, err)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, kn := range [][2]int{{0, 2}, {3, 3}, {4, 2}, {10, 257}} {
+		if _, err := New(kn[0], kn[1]); err == nil {
+			t.Fatalf("expected %d/%d to be invalid", kn[0], kn[1])
+		}
+	}
+}
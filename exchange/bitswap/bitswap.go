@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	metrics "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/codahale/metrics"
 	process "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/goprocess"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	blocks "github.com/ipfs/go-ipfs/blocks"
@@ -41,10 +42,23 @@ const (
 
 	HasBlockBufferSize = 256
 	provideWorkers     = 4
+
+	// peers which sent us a wanted block in the last usefulPeerTimeout are
+	// tagged in the connection manager, to keep their conns open.
+	usefulPeerTag     = "bitswap"
+	usefulPeerValue   = 10
+	usefulPeerTimeout = time.Minute * 10
 )
 
 var rebroadcastDelay = delay.Fixed(time.Second * 10)
 
+// The counters of blocks, over all the instances of the process.
+var (
+	metricBlocksRecvd    = metrics.Counter("bitswap.BlocksReceived")
+	metricDupBlocksRecvd = metrics.Counter("bitswap.DupBlocksReceived")
+	metricBlocksSent     = metrics.Counter("bitswap.BlocksSent")
+)
+
 // New initializes a BitSwap instance that communicates over the provided
 // BitSwapNetwork. This function registers the returned instance as the network
 // delegate.
@@ -87,6 +101,8 @@ func New(parent context.Context, p peer.ID, network bsnet.BitSwapNetwork,
 		newBlocks:     make(chan *blocks.Block, HasBlockBufferSize),
 		provideKeys:   make(chan key.Key),
 		wm:            NewWantManager(ctx, network),
+		usefulPeers:   make(map[peer.ID]time.Time),
+		sessions:      make(map[uint64]*fetchSession),
 	}
 	go bs.wm.Run()
 	network.SetDelegate(bs)
@@ -129,6 +145,28 @@ type Bitswap struct {
 	counterLk      sync.Mutex
 	blocksRecvd    int
 	dupBlocksRecvd int
+	dataRecvd      uint64
+	dupDataRecvd   uint64
+
+	// usefulPeers holds when the peers last sent us a wanted block
+	usefulLk    sync.Mutex
+	usefulPeers map[peer.ID]time.Time
+
+	// sessions holds the live sessions by the ID of their context
+	sessionLk sync.Mutex
+	sessions  map[uint64]*fetchSession
+
+	// serveLimiter caps the rate of the blocks sent to other peers
+	serveLimiter serveLimiter
+	// serveFilter holds back the blocks not to send to other peers
+	serveFilter serveFilter
+
+	// providing counts the blocks given to HasBlock which aren't provided
+	// yet, and flushed holds the channels of the FlushProvides waiting
+	// for it to drop to 0.
+	provideLk sync.Mutex
+	providing int
+	flushed   []chan struct{}
 }
 
 type blockRequest struct {
@@ -185,6 +223,12 @@ func (bs *Bitswap) WantlistForPeer(p peer.ID) []key.Key {
 	return out
 }
 
+// LedgerForPeer returns a summary of the data exchanged with the given
+// peer.
+func (bs *Bitswap) LedgerForPeer(p peer.ID) *decision.Receipt {
+	return bs.engine.LedgerForPeer(p)
+}
+
 // GetBlocks returns a channel where the caller may receive blocks that
 // correspond to the provided |keys|. Returns an error if BitSwap is unable to
 // begin this request within the deadline enforced by the context.
@@ -192,6 +236,9 @@ func (bs *Bitswap) WantlistForPeer(p peer.ID) []key.Key {
 // NB: Your request remains open until the context expires. To conserve
 // resources, provide a context with a reasonably short deadline (ie. not one
 // that lasts throughout the lifetime of the server)
+//
+// Under a context made with exchange.NewSession, the keys are only asked
+// to the peers which sent the first blocks of the session, if any.
 func (bs *Bitswap) GetBlocks(ctx context.Context, keys []key.Key) (<-chan *blocks.Block, error) {
 	select {
 	case <-bs.process.Closing():
@@ -200,7 +247,22 @@ func (bs *Bitswap) GetBlocks(ctx context.Context, keys []key.Key) (<-chan *block
 	}
 	promise := bs.notifications.Subscribe(ctx, keys...)
 
-	bs.wm.WantBlocks(keys)
+	var targets []peer.ID
+	if s := bs.sessionFor(ctx); s != nil {
+		targets = s.want(keys)
+		go func() {
+			select {
+			case <-ctx.Done():
+				s.cancel(keys)
+			case <-bs.process.Closing():
+			}
+		}()
+	}
+	bs.wm.WantBlocks(keys, targets)
+	if len(targets) > 0 {
+		// the peers of the session are expected to have the keys
+		return promise, nil
+	}
 
 	req := &blockRequest{
 		keys: keys,
@@ -228,15 +290,55 @@ func (bs *Bitswap) HasBlock(ctx context.Context, blk *blocks.Block) error {
 	}
 
 	bs.notifications.Publish(blk)
+	bs.provideLk.Lock()
+	bs.providing++
+	bs.provideLk.Unlock()
 	select {
 	case bs.newBlocks <- blk:
 		// send block off to be reprovided
 	case <-ctx.Done():
+		bs.provided()
 		return ctx.Err()
 	}
 	return nil
 }
 
+// provided marks a block given to HasBlock as provided, or given up on.
+func (bs *Bitswap) provided() {
+	bs.provideLk.Lock()
+	defer bs.provideLk.Unlock()
+	bs.providing--
+	if bs.providing == 0 {
+		for _, ch := range bs.flushed {
+			close(ch)
+		}
+		bs.flushed = nil
+	}
+}
+
+// FlushProvides waits until the blocks given to HasBlock so far have been
+// provided to the routing system, so closing the node doesn't lose their
+// announcements. It gives up when ctx is done.
+func (bs *Bitswap) FlushProvides(ctx context.Context) error {
+	bs.provideLk.Lock()
+	if bs.providing == 0 {
+		bs.provideLk.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	bs.flushed = append(bs.flushed, ch)
+	bs.provideLk.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-bs.process.Closing():
+		return errors.New("bitswap is closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (bs *Bitswap) connectToProviders(ctx context.Context, entries []wantlist.Entry) {
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -286,6 +388,10 @@ func (bs *Bitswap) ReceiveMessage(ctx context.Context, p peer.ID, incoming bsmsg
 		keys = append(keys, block.Key())
 	}
 	bs.wm.CancelWants(keys)
+	if len(keys) > 0 {
+		bs.markUseful(p)
+		bs.receivedFrom(p, keys)
+	}
 
 	wg := sync.WaitGroup{}
 	for _, block := range iblocks {
@@ -294,6 +400,8 @@ func (bs *Bitswap) ReceiveMessage(ctx context.Context, p peer.ID, incoming bsmsg
 			defer wg.Done()
 			bs.counterLk.Lock()
 			bs.blocksRecvd++
+			metricBlocksRecvd.Add()
+			bs.dataRecvd += uint64(len(b.Data))
 			has, err := bs.blockstore.Has(b.Key())
 			if err != nil {
 				bs.counterLk.Unlock()
@@ -302,6 +410,8 @@ func (bs *Bitswap) ReceiveMessage(ctx context.Context, p peer.ID, incoming bsmsg
 			}
 			if err == nil && has {
 				bs.dupBlocksRecvd++
+				metricDupBlocksRecvd.Add()
+				bs.dupDataRecvd += uint64(len(b.Data))
 			}
 			brecvd := bs.blocksRecvd
 			bdup := bs.dupBlocksRecvd
@@ -330,6 +440,39 @@ func (bs *Bitswap) PeerConnected(p peer.ID) {
 func (bs *Bitswap) PeerDisconnected(p peer.ID) {
 	bs.wm.Disconnected(p)
 	bs.engine.PeerDisconnected(p)
+
+	bs.usefulLk.Lock()
+	delete(bs.usefulPeers, p)
+	bs.usefulLk.Unlock()
+}
+
+// markUseful tags p as useful in the connection manager, until it has sent
+// no wanted block for usefulPeerTimeout.
+func (bs *Bitswap) markUseful(p peer.ID) {
+	bs.usefulLk.Lock()
+	bs.usefulPeers[p] = time.Now()
+	bs.usefulLk.Unlock()
+
+	bs.network.ConnectionManager().TagPeer(p, usefulPeerTag, usefulPeerValue)
+}
+
+// untagIdlePeers removes the tags of the peers which sent no wanted block
+// for usefulPeerTimeout.
+func (bs *Bitswap) untagIdlePeers() {
+	var idle []peer.ID
+	bs.usefulLk.Lock()
+	for p, t := range bs.usefulPeers {
+		if time.Since(t) > usefulPeerTimeout {
+			idle = append(idle, p)
+			delete(bs.usefulPeers, p)
+		}
+	}
+	bs.usefulLk.Unlock()
+
+	cmgr := bs.network.ConnectionManager()
+	for _, p := range idle {
+		cmgr.UntagPeer(p, usefulPeerTag)
+	}
 }
 
 func (bs *Bitswap) ReceiveError(err error) {
@@ -280,3 +280,38 @@ func TestBasicBitswap(t *testing.T) {
 		}
 	}
 }
+
+func TestFlushProvides(t *testing.T) {
+	rs := mockrouting.NewServer()
+	net := tn.VirtualNetwork(rs, delay.Fixed(kNetworkDelay))
+	sg := NewTestSessionGenerator(net)
+	defer sg.Close()
+	bg := blocksutil.NewBlockGenerator()
+
+	inst := sg.Next()
+	defer inst.Exchange.Close()
+
+	blks := bg.Blocks(20)
+	for _, b := range blks {
+		if err := inst.Exchange.HasBlock(context.Background(), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := inst.Exchange.FlushProvides(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	client := rs.Client(p2ptestutil.RandTestBogusIdentityOrFatal(t))
+	for _, b := range blks {
+		provs, err := client.FindProviders(ctx, b.Key())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(provs) != 1 || provs[0].ID != inst.Peer {
+			t.Fatalf("block %s was not provided by the instance: %v", b.Key(), provs)
+		}
+	}
+}
@@ -186,6 +186,41 @@ func (e *Engine) Peers() []peer.ID {
 	return response
 }
 
+// LedgerForPeer returns a summary of the ledger kept for the given peer,
+// which is empty if no data was exchanged with it yet.
+func (e *Engine) LedgerForPeer(p peer.ID) *Receipt {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	r := &Receipt{Peer: p.Pretty()}
+	if l, ok := e.ledgerMap[p]; ok {
+		r.Value = l.Accounting.Value()
+		r.Sent = l.Accounting.BytesSent
+		r.Recv = l.Accounting.BytesRecv
+		r.Exchanged = l.ExchangeCount()
+	}
+	return r
+}
+
+// LedgerTotals returns the sums of the ledgers kept for every peer. Its
+// Value is the ratio of the bytes sent to those received, over all peers.
+func (e *Engine) LedgerTotals() *Receipt {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	var total debtRatio
+	r := new(Receipt)
+	for _, l := range e.ledgerMap {
+		total.BytesSent += l.Accounting.BytesSent
+		total.BytesRecv += l.Accounting.BytesRecv
+		r.Exchanged += l.ExchangeCount()
+	}
+	r.Value = total.Value()
+	r.Sent = total.BytesSent
+	r.Recv = total.BytesRecv
+	return r
+}
+
 // MessageReceived performs book-keeping. Returns error if passed invalid
 // arguments.
 func (e *Engine) MessageReceived(p peer.ID, m bsmsg.BitSwapMessage) error {
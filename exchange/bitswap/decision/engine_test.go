@@ -66,6 +66,53 @@ func TestConsistentAccounting(t *testing.T) {
 	}
 }
 
+func TestLedgerForPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sender := newEngine(ctx, "Ernie")
+	receiver := newEngine(ctx, "Bert")
+
+	m := message.New(false)
+	m.AddBlock(blocks.NewBlock([]byte("this is a block")))
+	m.AddBlock(blocks.NewBlock([]byte("this is another one")))
+	sender.Engine.MessageSent(receiver.Peer, m)
+
+	r := sender.Engine.LedgerForPeer(receiver.Peer)
+	if r.Peer != receiver.Peer.Pretty() {
+		t.Fatal("receipt is for the wrong peer", r.Peer)
+	}
+	if r.Sent != sender.Engine.numBytesSentTo(receiver.Peer) || r.Recv != 0 {
+		t.Fatal("receipt disagrees with the ledger", r)
+	}
+	if r.Exchanged != 2 {
+		t.Fatal("expected 2 exchanges, got", r.Exchanged)
+	}
+
+	if r := receiver.Engine.LedgerForPeer(peer.ID("Oscar")); r.Sent != 0 || r.Recv != 0 || r.Exchanged != 0 {
+		t.Fatal("receipt of an unknown peer is not empty", r)
+	}
+}
+
+func TestLedgerTotals(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sender := newEngine(ctx, "Ernie")
+
+	m := message.New(false)
+	m.AddBlock(blocks.NewBlock([]byte("this is a block")))
+	sender.Engine.MessageSent(peer.ID("Bert"), m)
+	sender.Engine.MessageSent(peer.ID("Oscar"), m)
+
+	r := sender.Engine.LedgerTotals()
+	want := sender.Engine.numBytesSentTo(peer.ID("Bert")) + sender.Engine.numBytesSentTo(peer.ID("Oscar"))
+	if r.Sent != want || r.Recv != 0 {
+		t.Fatal("totals disagree with the ledgers", r)
+	}
+	if r.Exchanged != 2 {
+		t.Fatal("expected 2 exchanges, got", r.Exchanged)
+	}
+}
+
 func TestPeerIsAddedToPeersWhenMessageReceivedOrSent(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -46,6 +46,15 @@ type ledger struct {
 	sentToPeer map[key.Key]time.Time
 }
 
+// Receipt is a summary of the ledger for a given peer.
+type Receipt struct {
+	Peer      string
+	Value     float64
+	Sent      uint64
+	Recv      uint64
+	Exchanged uint64
+}
+
 type debtRatio struct {
 	BytesSent uint64
 	BytesRecv uint64
@@ -23,6 +23,7 @@ var _ = math.Inf
 type Message struct {
 	Wantlist         *Message_Wantlist `protobuf:"bytes,1,opt,name=wantlist" json:"wantlist,omitempty"`
 	Blocks           [][]byte          `protobuf:"bytes,2,rep,name=blocks" json:"blocks,omitempty"`
+	Payload          []*Message_Block  `protobuf:"bytes,3,rep,name=payload" json:"payload,omitempty"`
 	XXX_unrecognized []byte            `json:"-"`
 }
 
@@ -44,6 +45,13 @@ func (m *Message) GetBlocks() [][]byte {
 	return nil
 }
 
+func (m *Message) GetPayload() []*Message_Block {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
 type Message_Wantlist struct {
 	Entries          []*Message_Wantlist_Entry `protobuf:"bytes,1,rep,name=entries" json:"entries,omitempty"`
 	Full             *bool                     `protobuf:"varint,2,opt,name=full" json:"full,omitempty"`
@@ -100,5 +108,29 @@ func (m *Message_Wantlist_Entry) GetCancel() bool {
 	return false
 }
 
+type Message_Block struct {
+	Prefix           []byte `protobuf:"bytes,1,opt,name=prefix" json:"prefix,omitempty"`
+	Data             []byte `protobuf:"bytes,2,opt,name=data" json:"data,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *Message_Block) Reset()         { *m = Message_Block{} }
+func (m *Message_Block) String() string { return proto.CompactTextString(m) }
+func (*Message_Block) ProtoMessage()    {}
+
+func (m *Message_Block) GetPrefix() []byte {
+	if m != nil {
+		return m.Prefix
+	}
+	return nil
+}
+
+func (m *Message_Block) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
 func init() {
 }
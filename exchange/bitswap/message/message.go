@@ -4,6 +4,7 @@ import (
 	"io"
 
 	blocks "github.com/ipfs/go-ipfs/blocks"
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	pb "github.com/ipfs/go-ipfs/exchange/bitswap/message/internal/pb"
 	wantlist "github.com/ipfs/go-ipfs/exchange/bitswap/wantlist"
@@ -77,6 +78,19 @@ func newMessageFromProto(pbm pb.Message) BitSwapMessage {
 		b := blocks.NewBlock(d)
 		m.AddBlock(b)
 	}
+	// blocks keyed otherwise come with their prefix, so each is hashed
+	// once, as it is keyed
+	for _, pbb := range pbm.GetPayload() {
+		p, err := cid.PrefixFromBytes(pbb.GetPrefix())
+		if err != nil {
+			continue
+		}
+		h, err := blocks.SumPrefix(pbb.GetData(), p)
+		if err != nil {
+			continue
+		}
+		m.AddBlock(&blocks.Block{Data: pbb.GetData(), Multihash: h})
+	}
 	return m
 }
 
@@ -156,7 +170,15 @@ func (m *impl) ToProto() *pb.Message {
 		})
 	}
 	for _, b := range m.Blocks() {
-		pbm.Blocks = append(pbm.Blocks, b.Data)
+		p, err := cid.PrefixOf(b.Key())
+		if err != nil || p == cid.V0Prefix {
+			pbm.Blocks = append(pbm.Blocks, b.Data)
+			continue
+		}
+		pbm.Payload = append(pbm.Payload, &pb.Message_Block{
+			Prefix: p.Bytes(),
+			Data:   b.Data,
+		})
 	}
 	return pbm
 }
@@ -6,9 +6,12 @@ import (
 
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
 
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	blocks "github.com/ipfs/go-ipfs/blocks"
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	pb "github.com/ipfs/go-ipfs/exchange/bitswap/message/internal/pb"
+	u "github.com/ipfs/go-ipfs/util"
 )
 
 func TestAppendWanted(t *testing.T) {
@@ -152,6 +155,47 @@ func TestToAndFromNetMessage(t *testing.T) {
 	}
 }
 
+func TestToAndFromNetPrefixedBlocks(t *testing.T) {
+	original := New(true)
+	v0 := blocks.NewBlock([]byte("v0"))
+	original.AddBlock(v0)
+	var keyed []key.Key
+	for _, p := range []cid.Prefix{
+		{Version: 0, Codec: cid.DagProtobuf, MhType: u.SHA3_256, MhLength: 20},
+		{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: 32},
+	} {
+		h, err := blocks.SumPrefix([]byte("prefixed"), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		original.AddBlock(&blocks.Block{Data: []byte("prefixed"), Multihash: h})
+		keyed = append(keyed, key.Key(h))
+	}
+
+	pbm := original.ToProto()
+	if len(pbm.GetBlocks()) != 1 || len(pbm.GetPayload()) != 2 {
+		t.Fatalf("expected 1 plain block and 2 with their prefix, got %d and %d", len(pbm.GetBlocks()), len(pbm.GetPayload()))
+	}
+
+	buf := new(bytes.Buffer)
+	if err := original.ToNet(buf); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := FromNet(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[key.Key]bool)
+	for _, b := range m2.Blocks() {
+		got[b.Key()] = true
+	}
+	for _, k := range append(keyed, v0.Key()) {
+		if !got[k] {
+			t.Fatalf("block %s was not received under its key", k)
+		}
+	}
+}
+
 func wantlistContains(wantlist *pb.Message_Wantlist, x string) bool {
 	for _, e := range wantlist.GetEntries() {
 		if e.GetBlock() == x {
@@ -4,6 +4,7 @@ import (
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
+	connmgr "github.com/ipfs/go-ipfs/p2p/net/connmgr"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
 )
@@ -25,6 +26,10 @@ type BitSwapNetwork interface {
 
 	ConnectTo(context.Context, peer.ID) error
 
+	// ConnectionManager returns the manager of the connections to peers,
+	// to tag the peers bitswap finds useful with.
+	ConnectionManager() *connmgr.ConnManager
+
 	Routing
 }
 
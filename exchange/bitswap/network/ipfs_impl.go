@@ -7,6 +7,7 @@ import (
 	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
 	host "github.com/ipfs/go-ipfs/p2p/host"
 	inet "github.com/ipfs/go-ipfs/p2p/net"
+	connmgr "github.com/ipfs/go-ipfs/p2p/net/connmgr"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	routing "github.com/ipfs/go-ipfs/routing"
 	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
@@ -102,6 +103,10 @@ func (bsnet *impl) ConnectTo(ctx context.Context, p peer.ID) error {
 }
 
 // FindProvidersAsync returns a channel of providers for the given key
+func (bsnet *impl) ConnectionManager() *connmgr.ConnManager {
+	return bsnet.host.ConnManager()
+}
+
 func (bsnet *impl) FindProvidersAsync(ctx context.Context, k key.Key, max int) <-chan peer.ID {
 
 	// Since routing queries are expensive, give bitswap the peers to which we
@@ -0,0 +1,37 @@
+package bitswap
+
+import (
+	"sync"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+)
+
+// ServeFilter decides whether the block of k is sent to the peer p which
+// wants it.
+type ServeFilter func(p peer.ID, k key.Key) bool
+
+// SetServeFilter sets the filter of the blocks sent to other peers, nil
+// sending them all.
+func (bs *Bitswap) SetServeFilter(f ServeFilter) {
+	bs.serveFilter.set(f)
+}
+
+type serveFilter struct {
+	lk sync.RWMutex
+	f  ServeFilter
+}
+
+func (sf *serveFilter) set(f ServeFilter) {
+	sf.lk.Lock()
+	sf.f = f
+	sf.lk.Unlock()
+}
+
+// allow returns whether the block of k may be sent to p.
+func (sf *serveFilter) allow(p peer.ID, k key.Key) bool {
+	sf.lk.RLock()
+	f := sf.f
+	sf.lk.RUnlock()
+	return f == nil || f(p, k)
+}
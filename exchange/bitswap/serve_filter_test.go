@@ -0,0 +1,49 @@
+package bitswap
+
+import (
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	tn "github.com/ipfs/go-ipfs/exchange/bitswap/testnet"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	mockrouting "github.com/ipfs/go-ipfs/routing/mock"
+	delay "github.com/ipfs/go-ipfs/thirdparty/delay"
+)
+
+func TestServeFilter(t *testing.T) {
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	g := NewTestSessionGenerator(net)
+	defer g.Close()
+
+	peers := g.Instances(2)
+	hasBlocks := peers[0]
+	wantsBlocks := peers[1]
+	defer hasBlocks.Exchange.Close()
+	defer wantsBlocks.Exchange.Close()
+
+	denied := blocks.NewBlock([]byte("denied"))
+	allowed := blocks.NewBlock([]byte("allowed"))
+	for _, b := range []*blocks.Block{denied, allowed} {
+		if err := hasBlocks.Exchange.HasBlock(context.Background(), b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hasBlocks.Exchange.SetServeFilter(func(p peer.ID, k key.Key) bool {
+		return k != denied.Key()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := wantsBlocks.Exchange.GetBlock(ctx, allowed.Key()); err != nil {
+		t.Fatal("expected the allowed block to be sent:", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+	if _, err := wantsBlocks.Exchange.GetBlock(ctx, denied.Key()); err == nil {
+		t.Fatal("expected the denied block to be held back")
+	}
+}
@@ -0,0 +1,68 @@
+package bitswap
+
+import (
+	"sync"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// ServeLimits caps the rate, in bytes per second, of the blocks sent to
+// the peers which want them, 0 meaning no cap. BusyRate is the cap while
+// blocks are wanted by the local node, so that serving leaves the uplink
+// to its own fetches; it defaults to Rate.
+type ServeLimits struct {
+	Rate     uint64
+	BusyRate uint64
+}
+
+// SetServeLimits sets the limits of the blocks sent to other peers.
+func (bs *Bitswap) SetServeLimits(l ServeLimits) {
+	bs.serveLimiter.setLimits(l)
+}
+
+// serveLimiter spaces the blocks sent out, so they go at the rate of its
+// limits.
+type serveLimiter struct {
+	lk     sync.Mutex
+	limits ServeLimits
+	// next is when the blocks sent so far are paid for
+	next time.Time
+}
+
+func (sl *serveLimiter) setLimits(l ServeLimits) {
+	sl.lk.Lock()
+	sl.limits = l
+	sl.lk.Unlock()
+}
+
+// wait returns once n more bytes may be sent, or with ctx's error. busy is
+// whether the local node wants blocks.
+func (sl *serveLimiter) wait(ctx context.Context, n int, busy bool) error {
+	sl.lk.Lock()
+	rate := sl.limits.Rate
+	if busy && sl.limits.BusyRate > 0 {
+		rate = sl.limits.BusyRate
+	}
+	if rate == 0 {
+		sl.lk.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	if sl.next.Before(now) {
+		sl.next = now
+	}
+	start := sl.next
+	sl.next = sl.next.Add(time.Duration(uint64(n) * uint64(time.Second) / rate))
+	sl.lk.Unlock()
+
+	if d := start.Sub(now); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package bitswap
+
+import (
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+func timeWaits(t *testing.T, sl *serveLimiter, n int, busy bool) time.Duration {
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if err := sl.wait(context.Background(), 100, busy); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return time.Since(start)
+}
+
+func TestServeLimiterRates(t *testing.T) {
+	var sl serveLimiter
+	if d := timeWaits(t, &sl, 10, false); d > time.Millisecond*50 {
+		t.Fatal("sends without limits were held for", d)
+	}
+
+	// 100 bytes every 50ms, and every 100ms when busy
+	sl.setLimits(ServeLimits{Rate: 2000, BusyRate: 1000})
+	if d := timeWaits(t, &sl, 5, false); d < time.Millisecond*150 || d > time.Millisecond*350 {
+		t.Fatal("expected 5 sends to take 200ms, took", d)
+	}
+	if d := timeWaits(t, &sl, 5, true); d < time.Millisecond*350 {
+		t.Fatal("expected 5 busy sends to take 400ms, took", d)
+	}
+}
+
+func TestServeLimiterWaitCancelled(t *testing.T) {
+	var sl serveLimiter
+	sl.setLimits(ServeLimits{Rate: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if err := sl.wait(ctx, 10, false); err != nil {
+		t.Fatal("the first send went out late:", err)
+	}
+	if err := sl.wait(ctx, 10, false); err != context.DeadlineExceeded {
+		t.Fatal("expected the wait to be cancelled, got", err)
+	}
+}
@@ -0,0 +1,165 @@
+package bitswap
+
+import (
+	"sync"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	exchange "github.com/ipfs/go-ipfs/exchange"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	"github.com/ipfs/go-ipfs/thirdparty/delay"
+)
+
+// maxSessionPeers is the number of peers, among those which sent the
+// blocks of a session first, its wants are sent to.
+const maxSessionPeers = 3
+
+// sessionBroadcastDelay is how long a session waits for its peers to send
+// a wanted block, before broadcasting its wants to every peer.
+var sessionBroadcastDelay = delay.Fixed(time.Second * 2)
+
+// fetchSession tracks the blocks wanted under an exchange.NewSession
+// context, and the peers which sent the ones got so far: as peers having
+// a block of a DAG likely have the rest of it, the wants of the session
+// go to them only, instead of every peer.
+type fetchSession struct {
+	lk sync.Mutex
+	// live holds the keys wanted and not received yet, with the number of
+	// requests open for them
+	live map[key.Key]int
+	// peers holds the peers which sent a block first, in that order
+	peers []peer.ID
+	// lastBlock is when a wanted block was last received
+	lastBlock time.Time
+}
+
+// sessionFor returns the session of ctx, creating it if needed. It's nil
+// for contexts made without exchange.NewSession.
+func (bs *Bitswap) sessionFor(ctx context.Context) *fetchSession {
+	es := exchange.SessionOf(ctx)
+	if es == nil {
+		return nil
+	}
+
+	bs.sessionLk.Lock()
+	defer bs.sessionLk.Unlock()
+	s, ok := bs.sessions[es.ID]
+	if ok {
+		return s
+	}
+
+	s = &fetchSession{
+		live:      make(map[key.Key]int),
+		lastBlock: time.Now(),
+	}
+	bs.sessions[es.ID] = s
+	go bs.runSession(es, s)
+	return s
+}
+
+// runSession broadcasts the wants of s when its peers send none of them
+// for sessionBroadcastDelay, and forgets s once the session is done.
+func (bs *Bitswap) runSession(es *exchange.Session, s *fetchSession) {
+	tick := time.NewTicker(sessionBroadcastDelay.Get())
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-tick.C:
+			if ks := s.stalled(); len(ks) > 0 {
+				log.Debugf("session %d stalled, broadcasting %d wants", es.ID, len(ks))
+				bs.wm.WantBlocks(ks, nil)
+			}
+		case <-es.Done:
+			bs.sessionLk.Lock()
+			delete(bs.sessions, es.ID)
+			bs.sessionLk.Unlock()
+			return
+		case <-bs.process.Closing():
+			return
+		}
+	}
+}
+
+// want adds ks to the live wants of s, and returns the peers to send them
+// to, none meaning every peer.
+func (s *fetchSession) want(ks []key.Key) []peer.ID {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if len(s.live) == 0 {
+		// the wait for a block starts now
+		s.lastBlock = time.Now()
+	}
+	for _, k := range ks {
+		s.live[k]++
+	}
+	return append([]peer.ID(nil), s.peers...)
+}
+
+// cancel drops a request for ks, whose context is done, from the live
+// wants of s, so they are not broadcast again once the session stalls.
+func (s *fetchSession) cancel(ks []key.Key) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	for _, k := range ks {
+		n, ok := s.live[k]
+		if !ok {
+			continue
+		}
+		if n <= 1 {
+			delete(s.live, k)
+		} else {
+			s.live[k] = n - 1
+		}
+	}
+}
+
+// received records that p sent k, adding p to the peers of s if k was
+// live.
+func (s *fetchSession) received(p peer.ID, k key.Key) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if _, ok := s.live[k]; !ok {
+		return
+	}
+	delete(s.live, k)
+	s.lastBlock = time.Now()
+
+	for _, sp := range s.peers {
+		if sp == p {
+			return
+		}
+	}
+	if len(s.peers) < maxSessionPeers {
+		s.peers = append(s.peers, p)
+	}
+}
+
+// stalled returns the live wants of s if no block was received for
+// sessionBroadcastDelay.
+func (s *fetchSession) stalled() []key.Key {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if len(s.live) == 0 || time.Since(s.lastBlock) < sessionBroadcastDelay.Get() {
+		return nil
+	}
+	s.lastBlock = time.Now()
+
+	ks := make([]key.Key, 0, len(s.live))
+	for k := range s.live {
+		ks = append(ks, k)
+	}
+	return ks
+}
+
+// receivedFrom passes the keys received from p to the sessions.
+func (bs *Bitswap) receivedFrom(p peer.ID, ks []key.Key) {
+	bs.sessionLk.Lock()
+	defer bs.sessionLk.Unlock()
+	for _, s := range bs.sessions {
+		for _, k := range ks {
+			s.received(p, k)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package bitswap
+
+import (
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	blocksutil "github.com/ipfs/go-ipfs/blocks/blocksutil"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	exchange "github.com/ipfs/go-ipfs/exchange"
+	tn "github.com/ipfs/go-ipfs/exchange/bitswap/testnet"
+	mockrouting "github.com/ipfs/go-ipfs/routing/mock"
+	delay "github.com/ipfs/go-ipfs/thirdparty/delay"
+)
+
+func fetchEach(t *testing.T, ctx context.Context, bs *Bitswap, blks []*blocks.Block) {
+	for _, b := range blks {
+		ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+		_, err := bs.GetBlock(ctx, b.Key())
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func dupBlocks(t *testing.T, bs *Bitswap) int {
+	// let the duplicates in flight arrive
+	time.Sleep(time.Millisecond * 200)
+	st, err := bs.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st.DupBlksReceived
+}
+
+func TestSessionGetsFewerDuplicates(t *testing.T) {
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	sg := NewTestSessionGenerator(net)
+	defer sg.Close()
+	bg := blocksutil.NewBlockGenerator()
+
+	instances := sg.Instances(5)
+	fetcher := instances[0].Exchange
+	blks := bg.Blocks(20)
+	for _, inst := range instances[1:] {
+		for _, b := range blks {
+			if err := inst.Exchange.HasBlock(context.Background(), b); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	fetchEach(t, context.Background(), fetcher, blks[:10])
+	broadcastDups := dupBlocks(t, fetcher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fetchEach(t, exchange.NewSession(ctx), fetcher, blks[10:])
+	sessionDups := dupBlocks(t, fetcher) - broadcastDups
+
+	t.Logf("%d duplicates without a session, %d with", broadcastDups, sessionDups)
+	if sessionDups >= broadcastDups {
+		t.Fatalf("the session got %d duplicates, no fewer than the %d of broadcasts", sessionDups, broadcastDups)
+	}
+}
+
+func TestSessionBroadcastsWhenStalled(t *testing.T) {
+	prev := sessionBroadcastDelay.Set(time.Millisecond * 100)
+	defer sessionBroadcastDelay.Set(prev)
+
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	sg := NewTestSessionGenerator(net)
+	defer sg.Close()
+	bg := blocksutil.NewBlockGenerator()
+
+	instances := sg.Instances(3)
+	fetcher := instances[0].Exchange
+	blks := bg.Blocks(2)
+	if err := instances[1].Exchange.HasBlock(context.Background(), blks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := instances[2].Exchange.HasBlock(context.Background(), blks[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the second block is only asked to the peer of the first at first
+	fetchEach(t, exchange.NewSession(ctx), fetcher, blks)
+}
+
+func TestSessionForgetsCancelledWants(t *testing.T) {
+	prev := sessionBroadcastDelay.Set(time.Millisecond * 100)
+	defer sessionBroadcastDelay.Set(prev)
+
+	net := tn.VirtualNetwork(mockrouting.NewServer(), delay.Fixed(kNetworkDelay))
+	sg := NewTestSessionGenerator(net)
+	defer sg.Close()
+	bg := blocksutil.NewBlockGenerator()
+
+	instances := sg.Instances(2)
+	fetcher := instances[0].Exchange
+	blks := bg.Blocks(2)
+	if err := instances[1].Exchange.HasBlock(context.Background(), blks[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	sctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sess := exchange.NewSession(sctx)
+	fetchEach(t, sess, fetcher, blks[:1])
+
+	// nobody has the second block, and its request is given up on
+	ctx, cancelGet := context.WithCancel(sess)
+	if _, err := fetcher.GetBlocks(ctx, []key.Key{blks[1].Key()}); err != nil {
+		t.Fatal(err)
+	}
+	cancelGet()
+
+	// let the session stall
+	time.Sleep(time.Millisecond * 300)
+	s := fetcher.sessionFor(sess)
+	if ks := s.stalled(); len(ks) != 0 {
+		t.Fatalf("expected the cancelled want to be dropped, got %v", ks)
+	}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if len(s.live) != 0 {
+		t.Fatalf("expected no live wants, got %d", len(s.live))
+	}
+}
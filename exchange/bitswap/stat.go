@@ -1,8 +1,10 @@
 package bitswap
 
 import (
-	key "github.com/ipfs/go-ipfs/blocks/key"
 	"sort"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	decision "github.com/ipfs/go-ipfs/exchange/bitswap/decision"
 )
 
 type Stat struct {
@@ -11,6 +13,10 @@ type Stat struct {
 	Peers           []string
 	BlocksReceived  int
 	DupBlksReceived int
+	DataReceived    uint64
+	DupDataReceived uint64
+	// Ledger holds the sums of the ledgers kept for every peer.
+	Ledger decision.Receipt
 }
 
 func (bs *Bitswap) Stat() (*Stat, error) {
@@ -20,12 +26,15 @@ func (bs *Bitswap) Stat() (*Stat, error) {
 	bs.counterLk.Lock()
 	st.BlocksReceived = bs.blocksRecvd
 	st.DupBlksReceived = bs.dupBlocksRecvd
+	st.DataReceived = bs.dataRecvd
+	st.DupDataReceived = bs.dupDataRecvd
 	bs.counterLk.Unlock()
 
 	for _, p := range bs.engine.Peers() {
 		st.Peers = append(st.Peers, p.Pretty())
 	}
 	sort.Strings(st.Peers)
+	st.Ledger = *bs.engine.LedgerTotals()
 
 	return st, nil
 }
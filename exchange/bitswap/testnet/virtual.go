@@ -7,6 +7,7 @@ import (
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	bsmsg "github.com/ipfs/go-ipfs/exchange/bitswap/message"
 	bsnet "github.com/ipfs/go-ipfs/exchange/bitswap/network"
+	connmgr "github.com/ipfs/go-ipfs/p2p/net/connmgr"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	routing "github.com/ipfs/go-ipfs/routing"
 	mockrouting "github.com/ipfs/go-ipfs/routing/mock"
@@ -33,6 +34,7 @@ func (n *network) Adapter(p testutil.Identity) bsnet.BitSwapNetwork {
 		local:   p.ID(),
 		network: n,
 		routing: n.routingserver.Client(p),
+		cmgr:    connmgr.New(0, 0, 0),
 	}
 	n.clients[p.ID()] = client
 	return client
@@ -81,6 +83,7 @@ type networkClient struct {
 	bsnet.Receiver
 	network *network
 	routing routing.IpfsRouting
+	cmgr    *connmgr.ConnManager
 }
 
 func (nc *networkClient) SendMessage(
@@ -117,6 +120,10 @@ func (nc *networkClient) Provide(ctx context.Context, k key.Key) error {
 	return nc.routing.Provide(ctx, k)
 }
 
+func (nc *networkClient) ConnectionManager() *connmgr.ConnManager {
+	return nc.cmgr
+}
+
 func (nc *networkClient) SetDelegate(r bsnet.Receiver) {
 	nc.Receiver = r
 }
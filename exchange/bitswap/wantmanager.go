@@ -15,13 +15,16 @@ import (
 
 type WantManager struct {
 	// sync channels for Run loop
-	incoming   chan []*bsmsg.Entry
+	incoming   chan *wantSet
 	connect    chan peer.ID // notification channel for new peers connecting
 	disconnect chan peer.ID // notification channel for peers disconnecting
 
 	// synchronized by Run loop, only touch inside there
 	peers map[peer.ID]*msgQueue
 	wl    *wantlist.ThreadSafe
+	// bcwl holds the wants sent to every peer, and not only to the peers
+	// of a session
+	bcwl *wantlist.ThreadSafe
 
 	network bsnet.BitSwapNetwork
 	ctx     context.Context
@@ -29,11 +32,12 @@ type WantManager struct {
 
 func NewWantManager(ctx context.Context, network bsnet.BitSwapNetwork) *WantManager {
 	return &WantManager{
-		incoming:   make(chan []*bsmsg.Entry, 10),
+		incoming:   make(chan *wantSet, 10),
 		connect:    make(chan peer.ID, 10),
 		disconnect: make(chan peer.ID, 10),
 		peers:      make(map[peer.ID]*msgQueue),
 		wl:         wantlist.NewThreadSafe(),
+		bcwl:       wantlist.NewThreadSafe(),
 		network:    network,
 		ctx:        ctx,
 	}
@@ -44,6 +48,13 @@ type msgPair struct {
 	msg bsmsg.BitSwapMessage
 }
 
+// wantSet is a change to the wantlist, sent to the targets only, or to
+// every peer if there are none.
+type wantSet struct {
+	entries []*bsmsg.Entry
+	targets []peer.ID
+}
+
 type cancellation struct {
 	who peer.ID
 	blk key.Key
@@ -56,20 +67,25 @@ type msgQueue struct {
 	out     bsmsg.BitSwapMessage
 	network bsnet.BitSwapNetwork
 
+	// wl holds the wants sent to this peer only, synchronized by Run loop
+	wl *wantlist.Wantlist
+
 	work chan struct{}
 	done chan struct{}
 }
 
-func (pm *WantManager) WantBlocks(ks []key.Key) {
+// WantBlocks adds ks to the wantlist, and sends them to the given peers,
+// or to every peer if none are given.
+func (pm *WantManager) WantBlocks(ks []key.Key, peers []peer.ID) {
 	log.Infof("want blocks: %s", ks)
-	pm.addEntries(ks, false)
+	pm.addEntries(ks, peers, false)
 }
 
 func (pm *WantManager) CancelWants(ks []key.Key) {
-	pm.addEntries(ks, true)
+	pm.addEntries(ks, nil, true)
 }
 
-func (pm *WantManager) addEntries(ks []key.Key, cancel bool) {
+func (pm *WantManager) addEntries(ks []key.Key, targets []peer.ID, cancel bool) {
 	var entries []*bsmsg.Entry
 	for i, k := range ks {
 		entries = append(entries, &bsmsg.Entry{
@@ -81,7 +97,7 @@ func (pm *WantManager) addEntries(ks []key.Key, cancel bool) {
 		})
 	}
 	select {
-	case pm.incoming <- entries:
+	case pm.incoming <- &wantSet{entries: entries, targets: targets}:
 	case <-pm.ctx.Done():
 	}
 }
@@ -97,7 +113,9 @@ func (pm *WantManager) SendBlock(ctx context.Context, env *engine.Envelope) {
 	err := pm.network.SendMessage(ctx, env.Peer, msg)
 	if err != nil {
 		log.Infof("sendblock error: %s", err)
+		return
 	}
+	metricBlocksSent.Add()
 }
 
 func (pm *WantManager) startPeerHandler(p peer.ID) *msgQueue {
@@ -111,7 +129,7 @@ func (pm *WantManager) startPeerHandler(p peer.ID) *msgQueue {
 
 	// new peer, we will want to give them our full wantlist
 	fullwantlist := bsmsg.New(true)
-	for _, e := range pm.wl.Entries() {
+	for _, e := range pm.bcwl.Entries() {
 		fullwantlist.AddEntry(e.Key, e.Priority)
 	}
 	mq.out = fullwantlist
@@ -200,26 +218,47 @@ func (pm *WantManager) Run() {
 	defer tock.Stop()
 	for {
 		select {
-		case entries := <-pm.incoming:
+		case ws := <-pm.incoming:
 
 			// add changes to our wantlist
-			for _, e := range entries {
+			for _, e := range ws.entries {
 				if e.Cancel {
 					pm.wl.Remove(e.Key)
+					pm.bcwl.Remove(e.Key)
+					for _, p := range pm.peers {
+						p.wl.Remove(e.Key)
+					}
 				} else {
 					pm.wl.Add(e.Key, e.Priority)
+					if len(ws.targets) == 0 {
+						pm.bcwl.Add(e.Key, e.Priority)
+					}
 				}
 			}
 
-			// broadcast those wantlist changes
-			for _, p := range pm.peers {
-				p.addMessage(entries)
+			if len(ws.targets) == 0 {
+				// broadcast those wantlist changes
+				for _, p := range pm.peers {
+					p.addMessage(ws.entries)
+				}
+				continue
+			}
+
+			for _, t := range ws.targets {
+				p, ok := pm.peers[t]
+				if !ok {
+					continue
+				}
+				for _, e := range ws.entries {
+					p.wl.Add(e.Key, e.Priority)
+				}
+				p.addMessage(ws.entries)
 			}
 
 		case <-tock.C:
 			// resend entire wantlist every so often (REALLY SHOULDNT BE NECESSARY)
 			var es []*bsmsg.Entry
-			for _, e := range pm.wl.Entries() {
+			for _, e := range pm.bcwl.Entries() {
 				es = append(es, &bsmsg.Entry{Entry: e})
 			}
 			for _, p := range pm.peers {
@@ -228,6 +267,12 @@ func (pm *WantManager) Run() {
 				p.outlk.Unlock()
 
 				p.addMessage(es)
+
+				var pes []*bsmsg.Entry
+				for _, e := range p.wl.Entries() {
+					pes = append(pes, &bsmsg.Entry{Entry: e})
+				}
+				p.addMessage(pes)
 			}
 		case p := <-pm.connect:
 			pm.startPeerHandler(p)
@@ -244,6 +289,7 @@ func (wm *WantManager) newMsgQueue(p peer.ID) *msgQueue {
 	mq.done = make(chan struct{})
 	mq.work = make(chan struct{}, 1)
 	mq.network = wm.network
+	mq.wl = wantlist.New()
 	mq.p = p
 
 	return mq
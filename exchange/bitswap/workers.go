@@ -72,6 +72,16 @@ func (bs *Bitswap) taskWorker(ctx context.Context) {
 					continue
 				}
 
+				if !bs.serveFilter.allow(envelope.Peer, envelope.Block.Key()) {
+					envelope.Sent()
+					continue
+				}
+
+				busy := bs.wm.wl.Len() > 0
+				if err := bs.serveLimiter.wait(ctx, len(envelope.Block.Data), busy); err != nil {
+					envelope.Sent()
+					return
+				}
 				bs.wm.SendBlock(ctx, envelope)
 			case <-ctx.Done():
 				return
@@ -96,6 +106,7 @@ func (bs *Bitswap) provideWorker(ctx context.Context) {
 				log.Error(err)
 			}
 			cancel()
+			bs.provided()
 		case <-ctx.Done():
 			return
 		}
@@ -180,6 +191,7 @@ func (bs *Bitswap) rebroadcastWorker(parent context.Context) {
 			if n > 0 {
 				log.Debug(n, "keys in bitswap wantlist")
 			}
+			bs.untagIdlePeers()
 		case <-broadcastSignal.C: // resend unfulfilled wantlist keys
 			entries := bs.wm.wl.Entries()
 			if len(entries) > 0 {
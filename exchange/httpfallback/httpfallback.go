@@ -0,0 +1,237 @@
+// package httpfallback implements an exchange that fetches blocks missing
+// from the network over HTTP from a configured list of block providers.
+//
+// Fetched blocks are verified against the requested key before they are
+// accepted, so providers do not need to be trusted.
+package httpfallback
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	exchange "github.com/ipfs/go-ipfs/exchange"
+	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
+)
+
+var log = eventlog.Logger("exchange/httpfallback")
+
+// DefaultFallbackDelay is how long the primary exchange is given to
+// produce a block before the HTTP providers are asked.
+const DefaultFallbackDelay = 10 * time.Second
+
+// maxBlockSize bounds how much is read from a provider for one block.
+const maxBlockSize = 2 << 20
+
+// ErrNotFound is returned when no provider could supply a valid block.
+var ErrNotFound = errors.New("block not found at any http provider")
+
+// rawBlockMediaType asks trustless gateways for the raw block bytes
+// instead of the decoded file.
+const rawBlockMediaType = "application/vnd.ipld.raw"
+
+// Fetcher retrieves and verifies blocks from HTTP block providers.
+type Fetcher struct {
+	urls   []string
+	client *http.Client
+}
+
+// NewFetcher constructs a Fetcher for the given provider URLs. A URL
+// containing "%s" has the base58 block key substituted in; any other URL
+// is treated as a gateway root and the block is requested from
+// <url>/ipfs/<key>?format=raw.
+func NewFetcher(urls []string) *Fetcher {
+	return &Fetcher{
+		urls:   urls,
+		client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Fetch asks each provider in turn for the block named by k, returning the
+// first response whose hash matches k.
+func (f *Fetcher) Fetch(ctx context.Context, k key.Key) (*blocks.Block, error) {
+	for _, u := range f.urls {
+		b, err := f.fetchFrom(ctx, u, k)
+		if err != nil {
+			log.Debugf("http provider %s failed for %s: %s", u, k, err)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		return b, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (f *Fetcher) fetchFrom(ctx context.Context, base string, k key.Key) (*blocks.Block, error) {
+	req, err := http.NewRequest("GET", blockURL(base, k), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", rawBlockMediaType)
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := f.client.Do(req)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			done <- result{err: fmt.Errorf("unexpected status: %s", resp.Status)}
+			return
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBlockSize+1))
+		if err == nil && len(data) > maxBlockSize {
+			err = errors.New("response exceeds maximum block size")
+		}
+		done <- result{data: data, err: err}
+	}()
+
+	// the request itself is bounded by the client timeout; on
+	// cancellation we simply stop waiting for it.
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	h, err := blocks.SumLike(res.data, mh.Multihash(k))
+	if err != nil {
+		return nil, err
+	}
+	b := &blocks.Block{Data: res.data, Multihash: h}
+	if b.Key() != k {
+		return nil, fmt.Errorf("provider returned data hashing to %s", b.Key())
+	}
+	return b, nil
+}
+
+func blockURL(base string, k key.Key) string {
+	if strings.Contains(base, "%s") {
+		return fmt.Sprintf(base, k.B58String())
+	}
+	return strings.TrimRight(base, "/") + "/ipfs/" + k.B58String() + "?format=raw"
+}
+
+// fallbackExchange asks the primary exchange first and the HTTP
+// providers for whatever it could not produce in time.
+type fallbackExchange struct {
+	primary exchange.Interface
+	fetcher *Fetcher
+	delay   time.Duration
+}
+
+// WithFallback wraps primary so that blocks it cannot provide within delay
+// are fetched from the HTTP providers instead. Blocks obtained over HTTP
+// are handed to primary.HasBlock, which stores and announces them.
+func WithFallback(primary exchange.Interface, f *Fetcher, delay time.Duration) exchange.Interface {
+	if delay <= 0 {
+		delay = DefaultFallbackDelay
+	}
+	return &fallbackExchange{
+		primary: primary,
+		fetcher: f,
+		delay:   delay,
+	}
+}
+
+// GetBlock implements exchange.Interface.
+func (e *fallbackExchange) GetBlock(ctx context.Context, k key.Key) (*blocks.Block, error) {
+	pctx, cancel := context.WithTimeout(ctx, e.delay)
+	b, err := e.primary.GetBlock(pctx, k)
+	cancel()
+	if err == nil {
+		return b, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return e.fetch(ctx, k)
+}
+
+// GetBlocks implements exchange.Interface.
+func (e *fallbackExchange) GetBlocks(ctx context.Context, ks []key.Key) (<-chan *blocks.Block, error) {
+	pctx, cancel := context.WithTimeout(ctx, e.delay)
+	prim, err := e.primary.GetBlocks(pctx, ks)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	out := make(chan *blocks.Block)
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		missing := make(map[key.Key]struct{}, len(ks))
+		for _, k := range ks {
+			missing[k] = struct{}{}
+		}
+
+		for b := range prim {
+			delete(missing, b.Key())
+			select {
+			case out <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		for k := range missing {
+			b, err := e.fetch(ctx, k)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			}
+			select {
+			case out <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (e *fallbackExchange) fetch(ctx context.Context, k key.Key) (*blocks.Block, error) {
+	b, err := e.fetcher.Fetch(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("fetched %s from http provider", k)
+	if err := e.primary.HasBlock(ctx, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// HasBlock implements exchange.Interface.
+func (e *fallbackExchange) HasBlock(ctx context.Context, b *blocks.Block) error {
+	return e.primary.HasBlock(ctx, b)
+}
+
+// Close closes the primary exchange.
+func (e *fallbackExchange) Close() error {
+	return e.primary.Close()
+}
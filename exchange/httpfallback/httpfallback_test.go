@@ -0,0 +1,88 @@
+package httpfallback
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	ds_sync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	"github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	offline "github.com/ipfs/go-ipfs/exchange/offline"
+)
+
+func provider(served map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := served[strings.TrimPrefix(r.URL.Path, "/ipfs/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+}
+
+func TestFallbackFetchesAndStores(t *testing.T) {
+	b := blocks.NewBlock([]byte("beep boop"))
+	ts := provider(map[string][]byte{b.Key().B58String(): b.Data})
+	defer ts.Close()
+
+	store := bstore()
+	ex := WithFallback(offline.Exchange(store), NewFetcher([]string{ts.URL}), time.Millisecond)
+
+	got, err := ex.GetBlock(context.Background(), b.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Key() != b.Key() {
+		t.Fatal("fetched the wrong block")
+	}
+	if _, err := store.Get(b.Key()); err != nil {
+		t.Fatal("fetched block should have been stored:", err)
+	}
+}
+
+func TestFallbackRejectsBadData(t *testing.T) {
+	b := blocks.NewBlock([]byte("beep boop"))
+	ts := provider(map[string][]byte{b.Key().B58String(): []byte("tampered")})
+	defer ts.Close()
+
+	ex := WithFallback(offline.Exchange(bstore()), NewFetcher([]string{ts.URL}), time.Millisecond)
+	if _, err := ex.GetBlock(context.Background(), b.Key()); err == nil {
+		t.Fatal("block with mismatched hash should be rejected")
+	}
+}
+
+func TestFallbackGetBlocks(t *testing.T) {
+	local := blocks.NewBlock([]byte("local"))
+	remote := blocks.NewBlock([]byte("remote"))
+	ts := provider(map[string][]byte{remote.Key().B58String(): remote.Data})
+	defer ts.Close()
+
+	store := bstore()
+	if err := store.Put(local); err != nil {
+		t.Fatal(err)
+	}
+	ex := WithFallback(offline.Exchange(store), NewFetcher([]string{"http://127.0.0.1:1/%s", ts.URL}), time.Millisecond)
+
+	out, err := ex.GetBlocks(context.Background(), []key.Key{local.Key(), remote.Key()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[key.Key]bool)
+	for b := range out {
+		seen[b.Key()] = true
+	}
+	if !seen[local.Key()] || !seen[remote.Key()] {
+		t.Fatalf("expected both blocks, got %v", seen)
+	}
+}
+
+func bstore() blockstore.Blockstore {
+	return blockstore.NewBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore()))
+}
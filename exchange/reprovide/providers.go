@@ -0,0 +1,78 @@
+package reprovide
+
+import (
+	"errors"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	pin "github.com/ipfs/go-ipfs/pin"
+)
+
+// ErrUnknownStrategy is returned for names of no reprovider strategy.
+var ErrUnknownStrategy = errors.New("unknown reprovider strategy")
+
+// NewBlockstoreProvider returns a KeyChanFunc providing every block of
+// bstore, the "all" strategy.
+func NewBlockstoreProvider(bstore blocks.Blockstore) KeyChanFunc {
+	return func(ctx context.Context) (<-chan key.Key, error) {
+		return bstore.AllKeysChan(ctx)
+	}
+}
+
+// NewPinnedProvider returns a KeyChanFunc providing the pinned blocks: of
+// the "pinned" strategy, or with onlyRoots, of the "roots" one, which
+// leaves out the blocks only pinned indirectly, by the roots of their DAG.
+func NewPinnedProvider(pinning pin.Pinner, onlyRoots bool) KeyChanFunc {
+	return func(ctx context.Context) (<-chan key.Key, error) {
+		seen := make(map[key.Key]struct{})
+		var keys []key.Key
+		add := func(k key.Key) {
+			if _, ok := seen[k]; ok {
+				return
+			}
+			seen[k] = struct{}{}
+			keys = append(keys, k)
+		}
+
+		for _, k := range pinning.DirectKeys() {
+			add(k)
+		}
+		for _, k := range pinning.RecursiveKeys() {
+			add(k)
+		}
+		if !onlyRoots {
+			for k := range pinning.IndirectKeys() {
+				add(k)
+			}
+		}
+
+		out := make(chan key.Key)
+		go func() {
+			defer close(out)
+			for _, k := range keys {
+				select {
+				case out <- k:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return out, nil
+	}
+}
+
+// NewStrategyProvider returns the KeyChanFunc of the strategy of the given
+// name: "all", "pinned" or "roots".
+func NewStrategyProvider(strategy string, bstore blocks.Blockstore, pinning pin.Pinner) (KeyChanFunc, error) {
+	switch strategy {
+	case "", "all":
+		return NewBlockstoreProvider(bstore), nil
+	case "pinned":
+		return NewPinnedProvider(pinning, false), nil
+	case "roots":
+		return NewPinnedProvider(pinning, true), nil
+	default:
+		return nil, ErrUnknownStrategy
+	}
+}
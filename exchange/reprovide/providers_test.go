@@ -0,0 +1,54 @@
+package reprovide_test
+
+import (
+	"testing"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	pin "github.com/ipfs/go-ipfs/pin"
+
+	. "github.com/ipfs/go-ipfs/exchange/reprovide"
+)
+
+func collect(t *testing.T, kcf KeyChanFunc) map[key.Key]bool {
+	ch, err := kcf(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[key.Key]bool)
+	for k := range ch {
+		if out[k] {
+			t.Fatalf("key %s provided twice", k)
+		}
+		out[k] = true
+	}
+	return out
+}
+
+func TestPinnedProviders(t *testing.T) {
+	pinning := pin.NewPinner(dssync.MutexWrap(ds.NewMapDatastore()), nil)
+	mp := pinning.GetManual()
+	mp.PinWithMode(key.Key("direct"), pin.Direct)
+	mp.PinWithMode(key.Key("root"), pin.Recursive)
+	mp.PinWithMode(key.Key("child"), pin.Indirect)
+	mp.PinWithMode(key.Key("root"), pin.Indirect)
+
+	pinned := collect(t, NewPinnedProvider(pinning, false))
+	if len(pinned) != 3 || !pinned["direct"] || !pinned["root"] || !pinned["child"] {
+		t.Fatalf("pinned strategy provided %v", pinned)
+	}
+
+	roots := collect(t, NewPinnedProvider(pinning, true))
+	if len(roots) != 2 || !roots["direct"] || !roots["root"] {
+		t.Fatalf("roots strategy provided %v", roots)
+	}
+}
+
+func TestUnknownStrategy(t *testing.T) {
+	_, err := NewStrategyProvider("everything", nil, nil)
+	if err != ErrUnknownStrategy {
+		t.Fatalf("expected ErrUnknownStrategy, got %v", err)
+	}
+}
@@ -6,51 +6,117 @@ import (
 
 	backoff "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/cenkalti/backoff"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
-	blocks "github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	routing "github.com/ipfs/go-ipfs/routing"
 	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
 )
 
 var log = eventlog.Logger("reprovider")
 
+// KeyChanFunc returns the keys a Reprovider provides.
+type KeyChanFunc func(context.Context) (<-chan key.Key, error)
+
 type Reprovider struct {
 	// The routing system to provide values through
 	rsys routing.IpfsRouting
 
-	// The backing store for blocks to be provided
-	bstore blocks.Blockstore
+	// keyProvider returns the keys to be provided
+	keyProvider KeyChanFunc
+
+	trigger chan chan error
+
+	// retick carries the new intervals of SetInterval.
+	retick chan time.Duration
 }
 
-func NewReprovider(rsys routing.IpfsRouting, bstore blocks.Blockstore) *Reprovider {
+func NewReprovider(rsys routing.IpfsRouting, keyProvider KeyChanFunc) *Reprovider {
 	return &Reprovider{
-		rsys:   rsys,
-		bstore: bstore,
+		rsys:        rsys,
+		keyProvider: keyProvider,
+		trigger:     make(chan chan error),
+		retick:      make(chan time.Duration, 1),
 	}
 }
 
+// ProvideEvery reprovides the keys every tick, and when triggered, until
+// ctx is done. A tick of 0 disables the periodic runs.
 func (rp *Reprovider) ProvideEvery(ctx context.Context, tick time.Duration) {
 	// dont reprovide immediately.
 	// may have just started the daemon and shutting it down immediately.
 	// probability( up another minute | uptime ) increases with uptime.
-	after := time.After(time.Minute)
+	var after <-chan time.Time
+	if tick > 0 {
+		after = time.After(time.Minute)
+	}
 	for {
+		var done chan error
 		select {
 		case <-ctx.Done():
 			return
+		case done = <-rp.trigger:
 		case <-after:
-			err := rp.Reprovide(ctx)
-			if err != nil {
-				log.Debug(err)
+		case tick = <-rp.retick:
+			// the next run is a whole new interval away.
+			after = nil
+			if tick > 0 {
+				after = time.After(tick)
 			}
+			continue
+		}
+
+		err := rp.Reprovide(ctx)
+		if err != nil {
+			log.Debug(err)
+		}
+		if done != nil {
+			done <- err
+		}
+		if tick > 0 {
 			after = time.After(tick)
 		}
 	}
 }
 
+// SetInterval changes the interval of ProvideEvery to tick, counted from
+// now. The last of the intervals set before ProvideEvery gets to them is
+// the one used.
+func (rp *Reprovider) SetInterval(tick time.Duration) {
+	for {
+		select {
+		case rp.retick <- tick:
+			return
+		default:
+		}
+		// drop the interval not taken yet, for this one.
+		select {
+		case <-rp.retick:
+		default:
+		}
+	}
+}
+
+// Trigger has ProvideEvery reprovide the keys now, and returns once they
+// are.
+func (rp *Reprovider) Trigger(ctx context.Context) error {
+	done := make(chan error, 1)
+	select {
+	case rp.trigger <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (rp *Reprovider) Reprovide(ctx context.Context) error {
-	keychan, err := rp.bstore.AllKeysChan(ctx)
+	keychan, err := rp.keyProvider(ctx)
 	if err != nil {
-		return fmt.Errorf("Failed to get key chan from blockstore: %s", err)
+		return fmt.Errorf("Failed to get key chan: %s", err)
 	}
 	for k := range keychan {
 		op := func() error {
@@ -2,12 +2,14 @@ package reprovide_test
 
 import (
 	"testing"
+	"time"
 
 	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	blocks "github.com/ipfs/go-ipfs/blocks"
 	blockstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	mock "github.com/ipfs/go-ipfs/routing/mock"
 	testutil "github.com/ipfs/go-ipfs/util/testutil"
 
@@ -31,7 +33,7 @@ func TestReprovide(t *testing.T) {
 	blk := blocks.NewBlock([]byte("this is a test"))
 	bstore.Put(blk)
 
-	reprov := NewReprovider(clA, bstore)
+	reprov := NewReprovider(clA, NewBlockstoreProvider(bstore))
 	err := reprov.Reprovide(ctx)
 	if err != nil {
 		t.Fatal(err)
@@ -50,3 +52,32 @@ func TestReprovide(t *testing.T) {
 		t.Fatal("Somehow got the wrong peer back as a provider.")
 	}
 }
+
+func TestSetInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := make(chan struct{}, 10)
+	reprov := NewReprovider(mock.NewServer().Client(testutil.RandIdentityOrFatal(t)), func(ctx context.Context) (<-chan key.Key, error) {
+		runs <- struct{}{}
+		ch := make(chan key.Key)
+		close(ch)
+		return ch, nil
+	})
+	go reprov.ProvideEvery(ctx, 0)
+
+	select {
+	case <-runs:
+		t.Fatal("reprovided with the periodic runs disabled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	reprov.SetInterval(10 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatal("didn't reprovide at the new interval")
+		}
+	}
+}
@@ -0,0 +1,429 @@
+// package scheduler implements an exchange that fetches each block once for
+// all the operations wanting it at the same time, such as a pin and a get of
+// overlapping DAGs, and bounds how many blocks are fetched at once.
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	exchange "github.com/ipfs/go-ipfs/exchange"
+	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
+)
+
+var log = eventlog.Logger("exchange/scheduler")
+
+// DefaultMaxFetches is how many blocks are fetched at once when no other
+// limit is given.
+const DefaultMaxFetches = 256
+
+// DefaultSlotTimeout is how long a fetch holds its slot when no other
+// limit is given.
+const DefaultSlotTimeout = 30 * time.Second
+
+// Options tune a Scheduler. A zero field takes the default.
+type Options struct {
+	// MaxFetches is how many blocks are fetched at once, at most.
+	MaxFetches int
+	// SlotTimeout is how long a fetch counts towards MaxFetches. A fetch
+	// that takes longer, such as that of a block nobody has, goes on, but
+	// gives its slot to the next one, so that a few such blocks don't
+	// hold up the fetches of all the others.
+	SlotTimeout time.Duration
+}
+
+// Stat is the state of the fetches of a Scheduler.
+type Stat struct {
+	// MaxFetches is how many blocks are fetched at once, at most.
+	MaxFetches int
+	// Fetching is how many blocks are being fetched.
+	Fetching int
+	// Queued is how many blocks wait for a fetch to end to be fetched.
+	Queued int
+	// Fetched is how many blocks were fetched.
+	Fetched uint64
+	// Deduplicated is how many requests for blocks were answered by the
+	// fetch of another, instead of fetching the block again.
+	Deduplicated uint64
+	// SlotTimeouts is how many fetches outlived their slot.
+	SlotTimeouts uint64
+}
+
+// Scheduler is an exchange fetching through another, which is asked once
+// for the blocks several requests want at the same time.
+type Scheduler struct {
+	inner       exchange.Interface
+	slots       chan struct{}
+	slotTimeout time.Duration
+
+	mx    sync.Mutex
+	wants map[key.Key]*fetch
+	stat  Stat
+}
+
+// fetch is the fetch of a block, shared by the requests waiting for it.
+type fetch struct {
+	done chan struct{}
+	blk  *blocks.Block
+	err  error
+
+	// refs is how many requests wait for the fetch, which is canceled
+	// once none does.
+	refs   int
+	cancel context.CancelFunc
+}
+
+// New returns a Scheduler fetching through inner.
+func New(inner exchange.Interface, opts Options) *Scheduler {
+	if opts.MaxFetches <= 0 {
+		opts.MaxFetches = DefaultMaxFetches
+	}
+	if opts.SlotTimeout <= 0 {
+		opts.SlotTimeout = DefaultSlotTimeout
+	}
+	return &Scheduler{
+		inner:       inner,
+		slots:       make(chan struct{}, opts.MaxFetches),
+		slotTimeout: opts.SlotTimeout,
+		wants:       make(map[key.Key]*fetch),
+		stat:        Stat{MaxFetches: opts.MaxFetches},
+	}
+}
+
+// want returns the fetch of k under way, if there is one, or starts one,
+// with the cancel function newCancel returns, and tells which.
+func (s *Scheduler) want(k key.Key, newCancel func() context.CancelFunc) (f *fetch, started bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if f, ok := s.wants[k]; ok {
+		f.refs++
+		s.stat.Deduplicated++
+		log.Debugf("joined the fetch of %s", k)
+		return f, false
+	}
+	f = &fetch{
+		done:   make(chan struct{}),
+		refs:   1,
+		cancel: newCancel(),
+	}
+	s.wants[k] = f
+	s.stat.Queued++
+	return f, true
+}
+
+// wait waits for f, the fetch of k, until ctx is done.
+func (s *Scheduler) wait(ctx context.Context, k key.Key, f *fetch) (*blocks.Block, error) {
+	select {
+	case <-f.done:
+		return f.blk, f.err
+	case <-ctx.Done():
+		s.mx.Lock()
+		f.refs--
+		if f.refs == 0 {
+			f.cancel()
+			if s.wants[k] == f {
+				delete(s.wants, k)
+			}
+		}
+		s.mx.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// GetBlock implements exchange.Interface. It waits for the fetch of k under
+// way, if there is one, or starts it.
+func (s *Scheduler) GetBlock(ctx context.Context, k key.Key) (*blocks.Block, error) {
+	// the fetch outlives the request starting it when others wait for
+	// it, so it keeps its values, like its session, but not its deadline.
+	fctx, cancel := context.WithCancel(valuesOf{ctx})
+	f, started := s.want(k, func() context.CancelFunc { return cancel })
+	if started {
+		go s.run(fctx, k, f)
+	} else {
+		cancel()
+	}
+	return s.wait(ctx, k, f)
+}
+
+func (s *Scheduler) run(ctx context.Context, k key.Key, f *fetch) {
+	defer f.cancel()
+
+	sl, err := s.acquire(ctx)
+	if err != nil {
+		s.mx.Lock()
+		s.stat.Queued--
+		s.mx.Unlock()
+		s.finish(k, f, nil, err)
+		return
+	}
+	s.started(1)
+
+	blk, err := s.inner.GetBlock(ctx, k)
+	sl.release()
+	s.ended(k, f, blk, err)
+}
+
+// started counts n queued fetches as started.
+func (s *Scheduler) started(n int) {
+	s.mx.Lock()
+	s.stat.Queued -= n
+	s.stat.Fetching += n
+	s.mx.Unlock()
+}
+
+// ended counts f, the fetch of k, as ended, and hands its result on.
+func (s *Scheduler) ended(k key.Key, f *fetch, blk *blocks.Block, err error) {
+	s.mx.Lock()
+	s.stat.Fetching--
+	if err == nil {
+		s.stat.Fetched++
+	}
+	s.mx.Unlock()
+	s.finish(k, f, blk, err)
+}
+
+// finish hands the result of f to the requests waiting for it.
+func (s *Scheduler) finish(k key.Key, f *fetch, blk *blocks.Block, err error) {
+	s.mx.Lock()
+	if s.wants[k] == f {
+		delete(s.wants, k)
+	}
+	s.mx.Unlock()
+
+	f.blk, f.err = blk, err
+	close(f.done)
+}
+
+// slot is one of the MaxFetches a Scheduler fetches with at once. It is
+// given back when its fetch ends, or after the slot timeout, whichever
+// comes first.
+type slot struct {
+	s     *Scheduler
+	once  sync.Once
+	timer *time.Timer
+}
+
+// acquire waits for a free slot, until ctx is done.
+func (s *Scheduler) acquire(ctx context.Context) (*slot, error) {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.held(), nil
+}
+
+// tryAcquire takes a free slot, if there is one.
+func (s *Scheduler) tryAcquire() (*slot, bool) {
+	select {
+	case s.slots <- struct{}{}:
+		return s.held(), true
+	default:
+		return nil, false
+	}
+}
+
+func (s *Scheduler) held() *slot {
+	sl := &slot{s: s}
+	sl.timer = time.AfterFunc(s.slotTimeout, func() {
+		sl.once.Do(func() {
+			<-s.slots
+			s.mx.Lock()
+			s.stat.SlotTimeouts++
+			s.mx.Unlock()
+		})
+	})
+	return sl
+}
+
+func (sl *slot) release() {
+	sl.once.Do(func() {
+		sl.timer.Stop()
+		<-sl.s.slots
+	})
+}
+
+// errNotFetched fails the blocks a batch ended without.
+var errNotFetched = errors.New("scheduler: the block was not fetched")
+
+// GetBlocks implements exchange.Interface. The keys fetched already are
+// waited for as GetBlock does, and the others are passed on together to
+// the GetBlocks of the inner exchange, as many at a time as there are
+// free slots. The blocks are sent as they come, which may not be in the
+// order of ks.
+func (s *Scheduler) GetBlocks(ctx context.Context, ks []key.Key) (<-chan *blocks.Block, error) {
+	b := &batch{}
+	b.ctx, b.cancel = context.WithCancel(valuesOf{ctx})
+
+	type want struct {
+		k key.Key
+		f *fetch
+	}
+	var wants []want
+	var newKeys []key.Key
+	var newFetches []*fetch
+	seen := make(map[key.Key]bool)
+	for _, k := range ks {
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		f, started := s.want(k, b.add)
+		if started {
+			newKeys = append(newKeys, k)
+			newFetches = append(newFetches, f)
+		}
+		wants = append(wants, want{k, f})
+	}
+	if len(newKeys) > 0 {
+		go s.runBatch(b, newKeys, newFetches)
+	} else {
+		b.cancel()
+	}
+
+	out := make(chan *blocks.Block)
+	var wg sync.WaitGroup
+	for _, w := range wants {
+		wg.Add(1)
+		go func(w want) {
+			defer wg.Done()
+			blk, err := s.wait(ctx, w.k, w.f)
+			if err != nil {
+				log.Debugf("failed to get %s: %s", w.k, err)
+				return
+			}
+			select {
+			case out <- blk:
+			case <-ctx.Done():
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out, nil
+}
+
+// batch is the fetch of the blocks asked for together, which is canceled
+// once all of them are.
+type batch struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mx   sync.Mutex
+	live int
+}
+
+// add counts a fetch in b, and returns the cancel function of the fetch.
+func (b *batch) add() context.CancelFunc {
+	b.mx.Lock()
+	b.live++
+	b.mx.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mx.Lock()
+			b.live--
+			if b.live == 0 {
+				b.cancel()
+			}
+			b.mx.Unlock()
+		})
+	}
+}
+
+// runBatch fetches the blocks of ks, which fs are the fetches of, through
+// the GetBlocks of the inner exchange: as many at a time as there are free
+// slots, and at least one.
+func (s *Scheduler) runBatch(b *batch, ks []key.Key, fs []*fetch) {
+	for len(ks) > 0 {
+		sl, err := s.acquire(b.ctx)
+		if err != nil {
+			s.mx.Lock()
+			s.stat.Queued -= len(ks)
+			s.mx.Unlock()
+			for i, k := range ks {
+				s.finish(k, fs[i], nil, err)
+				fs[i].cancel()
+			}
+			return
+		}
+		slots := []*slot{sl}
+		for len(slots) < len(ks) {
+			sl, ok := s.tryAcquire()
+			if !ok {
+				break
+			}
+			slots = append(slots, sl)
+		}
+		n := len(slots)
+		s.started(n)
+		go s.fetchSome(b, ks[:n], fs[:n], slots)
+		ks, fs = ks[n:], fs[n:]
+	}
+}
+
+// fetchSome fetches the blocks of ks, with a slot each, in a single call
+// to the inner exchange.
+func (s *Scheduler) fetchSome(b *batch, ks []key.Key, fs []*fetch, slots []*slot) {
+	pending := make(map[key.Key]int, len(ks))
+	for i, k := range ks {
+		pending[k] = i
+	}
+	end := func(i int, blk *blocks.Block, err error) {
+		slots[i].release()
+		s.ended(ks[i], fs[i], blk, err)
+		fs[i].cancel()
+	}
+
+	blks, err := s.inner.GetBlocks(b.ctx, ks)
+	if err == nil {
+		for blk := range blks {
+			i, ok := pending[blk.Key()]
+			if !ok {
+				continue
+			}
+			delete(pending, blk.Key())
+			end(i, blk, nil)
+		}
+		err = b.ctx.Err()
+		if err == nil {
+			err = errNotFetched
+		}
+	}
+	for _, i := range pending {
+		end(i, nil, err)
+	}
+}
+
+// HasBlock implements exchange.Interface.
+func (s *Scheduler) HasBlock(ctx context.Context, b *blocks.Block) error {
+	return s.inner.HasBlock(ctx, b)
+}
+
+// Close closes the exchange fetched through.
+func (s *Scheduler) Close() error {
+	return s.inner.Close()
+}
+
+// Stat returns the state of the fetches of s.
+func (s *Scheduler) Stat() Stat {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.stat
+}
+
+// valuesOf is a context holding the values of another, but never done.
+type valuesOf struct {
+	context.Context
+}
+
+func (valuesOf) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valuesOf) Done() <-chan struct{}       { return nil }
+func (valuesOf) Err() error                  { return nil }
@@ -0,0 +1,312 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+// slowExchange serves its blocks once released, and counts the fetches.
+type slowExchange struct {
+	blocks  map[key.Key]*blocks.Block
+	release chan struct{}
+
+	mx      sync.Mutex
+	fetches map[key.Key]int
+	batches [][]key.Key
+	running int
+	maxRun  int
+}
+
+func newSlowExchange(bs ...*blocks.Block) *slowExchange {
+	e := &slowExchange{
+		blocks:  make(map[key.Key]*blocks.Block),
+		release: make(chan struct{}),
+		fetches: make(map[key.Key]int),
+	}
+	for _, b := range bs {
+		e.blocks[b.Key()] = b
+	}
+	return e
+}
+
+func (e *slowExchange) GetBlock(ctx context.Context, k key.Key) (*blocks.Block, error) {
+	e.mx.Lock()
+	e.fetches[k]++
+	e.running++
+	if e.running > e.maxRun {
+		e.maxRun = e.running
+	}
+	e.mx.Unlock()
+	defer func() {
+		e.mx.Lock()
+		e.running--
+		e.mx.Unlock()
+	}()
+
+	select {
+	case <-e.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	b, ok := e.blocks[k]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return b, nil
+}
+
+func (e *slowExchange) GetBlocks(ctx context.Context, ks []key.Key) (<-chan *blocks.Block, error) {
+	e.mx.Lock()
+	e.batches = append(e.batches, ks)
+	e.mx.Unlock()
+
+	out := make(chan *blocks.Block)
+	var wg sync.WaitGroup
+	for _, k := range ks {
+		wg.Add(1)
+		go func(k key.Key) {
+			defer wg.Done()
+			b, err := e.GetBlock(ctx, k)
+			if err != nil {
+				return
+			}
+			select {
+			case out <- b:
+			case <-ctx.Done():
+			}
+		}(k)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out, nil
+}
+
+func (e *slowExchange) batchesSent() [][]key.Key {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	return append([][]key.Key(nil), e.batches...)
+}
+
+func (e *slowExchange) HasBlock(context.Context, *blocks.Block) error { return nil }
+func (e *slowExchange) Close() error                                  { return nil }
+
+func (e *slowExchange) fetchesOf(k key.Key) int {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	return e.fetches[k]
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 200; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("timed out")
+}
+
+func TestDeduplicates(t *testing.T) {
+	b := blocks.NewBlock([]byte("beep boop"))
+	inner := newSlowExchange(b)
+	s := New(inner, Options{})
+
+	errs := make(chan error)
+	for i := 0; i < 5; i++ {
+		go func() {
+			got, err := s.GetBlock(context.Background(), b.Key())
+			if err == nil && got.Key() != b.Key() {
+				err = errors.New("got the wrong block")
+			}
+			errs <- err
+		}()
+	}
+	waitFor(t, func() bool { return s.Stat().Deduplicated == 4 })
+	close(inner.release)
+	for i := 0; i < 5; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := inner.fetchesOf(b.Key()); n != 1 {
+		t.Fatalf("expected the block to be fetched once, got %d", n)
+	}
+	st := s.Stat()
+	if st.Fetched != 1 || st.Fetching != 0 || st.Queued != 0 {
+		t.Fatalf("unexpected stat %+v", st)
+	}
+}
+
+func TestCancelOneWaiter(t *testing.T) {
+	b := blocks.NewBlock([]byte("beep boop"))
+	inner := newSlowExchange(b)
+	s := New(inner, Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, err := s.GetBlock(ctx, b.Key())
+		canceled <- err
+	}()
+	waitFor(t, func() bool { return inner.fetchesOf(b.Key()) == 1 })
+
+	got := make(chan error)
+	go func() {
+		_, err := s.GetBlock(context.Background(), b.Key())
+		got <- err
+	}()
+	waitFor(t, func() bool { return s.Stat().Deduplicated == 1 })
+
+	// the fetch goes on for the request still waiting.
+	cancel()
+	if err := <-canceled; err != context.Canceled {
+		t.Fatalf("expected the canceled request to fail, got %v", err)
+	}
+	close(inner.release)
+	if err := <-got; err != nil {
+		t.Fatal(err)
+	}
+	if n := inner.fetchesOf(b.Key()); n != 1 {
+		t.Fatalf("expected the block to be fetched once, got %d", n)
+	}
+}
+
+func TestCancelAllWaiters(t *testing.T) {
+	b := blocks.NewBlock([]byte("beep boop"))
+	inner := newSlowExchange(b)
+	s := New(inner, Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := s.GetBlock(ctx, b.Key())
+		done <- err
+	}()
+	waitFor(t, func() bool { return s.Stat().Fetching == 1 })
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected the request to fail, got %v", err)
+	}
+	waitFor(t, func() bool { return s.Stat().Fetching == 0 })
+}
+
+func TestMaxFetches(t *testing.T) {
+	var bs []*blocks.Block
+	var ks []key.Key
+	for i := 0; i < 10; i++ {
+		b := blocks.NewBlock([]byte{byte(i)})
+		bs = append(bs, b)
+		ks = append(ks, b.Key())
+	}
+	inner := newSlowExchange(bs...)
+	s := New(inner, Options{MaxFetches: 3})
+
+	out, err := s.GetBlocks(context.Background(), ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { st := s.Stat(); return st.Fetching == 3 && st.Queued == 7 })
+	close(inner.release)
+
+	seen := 0
+	for range out {
+		seen++
+	}
+	if seen != len(ks) {
+		t.Fatalf("expected %d blocks, got %d", len(ks), seen)
+	}
+	if inner.maxRun > 3 {
+		t.Fatalf("expected 3 fetches at once at most, got %d", inner.maxRun)
+	}
+	if st := s.Stat(); st.Fetched != uint64(len(ks)) {
+		t.Fatalf("unexpected stat %+v", st)
+	}
+}
+
+func TestGetBlocksBatches(t *testing.T) {
+	var bs []*blocks.Block
+	var ks []key.Key
+	for i := 0; i < 5; i++ {
+		b := blocks.NewBlock([]byte{byte(i)})
+		bs = append(bs, b)
+		ks = append(ks, b.Key())
+	}
+	inner := newSlowExchange(bs...)
+	s := New(inner, Options{})
+
+	// the first block is fetched already, for another request
+	first := make(chan error)
+	go func() {
+		_, err := s.GetBlock(context.Background(), ks[0])
+		first <- err
+	}()
+	waitFor(t, func() bool { return inner.fetchesOf(ks[0]) == 1 })
+
+	out, err := s.GetBlocks(context.Background(), append(ks, ks[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(inner.batchesSent()) == 1 })
+	close(inner.release)
+	seen := 0
+	for range out {
+		seen++
+	}
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+
+	if seen != len(ks) {
+		t.Fatalf("expected %d blocks, got %d", len(ks), seen)
+	}
+	batches := inner.batchesSent()
+	if len(batches) != 1 || len(batches[0]) != len(ks)-1 {
+		t.Fatalf("expected a single batch of the %d keys not fetched yet, got %v", len(ks)-1, batches)
+	}
+	for _, k := range batches[0] {
+		if k == ks[0] {
+			t.Fatal("expected the key fetched already to be left out of the batch")
+		}
+	}
+	for _, k := range ks {
+		if n := inner.fetchesOf(k); n != 1 {
+			t.Fatalf("expected %s to be fetched once, got %d", k, n)
+		}
+	}
+}
+
+func TestSlotTimeout(t *testing.T) {
+	stuck := blocks.NewBlock([]byte("nobody has it"))
+	b := blocks.NewBlock([]byte("beep boop"))
+	inner := newSlowExchange(b)
+	s := New(inner, Options{MaxFetches: 1, SlotTimeout: 50 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.GetBlock(ctx, stuck.Key())
+	waitFor(t, func() bool { return inner.fetchesOf(stuck.Key()) == 1 })
+
+	// the stuck fetch gives its slot up, for the next one to start
+	got := make(chan error)
+	go func() {
+		_, err := s.GetBlock(context.Background(), b.Key())
+		got <- err
+	}()
+	waitFor(t, func() bool { return inner.fetchesOf(b.Key()) == 1 })
+	if st := s.Stat(); st.SlotTimeouts != 1 {
+		t.Fatalf("expected a slot timeout, got %+v", st)
+	}
+	close(inner.release)
+	if err := <-got; err != nil {
+		t.Fatal(err)
+	}
+}
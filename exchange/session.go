@@ -0,0 +1,36 @@
+package exchange
+
+import (
+	"sync/atomic"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+type sessionKey struct{}
+
+var lastSession uint64
+
+// Session is a logical fetch, such as of the DAG of an 'ipfs get', made up
+// of the requests under the contexts derived from the one of NewSession.
+type Session struct {
+	ID uint64
+	// Done is closed when the session ends
+	Done <-chan struct{}
+}
+
+// NewSession returns a context under which the blocks got make up one
+// Session: exchanges may then ask the peers which sent the first blocks
+// for the others, instead of every peer. The session ends with ctx.
+func NewSession(ctx context.Context) context.Context {
+	s := &Session{
+		ID:   atomic.AddUint64(&lastSession, 1),
+		Done: ctx.Done(),
+	}
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// SessionOf returns the session ctx was made for with NewSession, or nil.
+func SessionOf(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
@@ -0,0 +1,102 @@
+package filestore
+
+import (
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+// NewBlockstore returns a blockstore holding the blocks of bs and the
+// leaves of fs. New blocks all go to bs.
+func NewBlockstore(bs bstore.Blockstore, fs *Filestore) bstore.Blockstore {
+	return &blockstore{bs: bs, fs: fs}
+}
+
+type blockstore struct {
+	bs bstore.Blockstore
+	fs *Filestore
+}
+
+func (b *blockstore) Get(k key.Key) (*blocks.Block, error) {
+	blk, err := b.bs.Get(k)
+	if err != bstore.ErrNotFound {
+		return blk, err
+	}
+
+	blk, err = b.fs.Block(k)
+	if err == ErrNotFound {
+		return nil, bstore.ErrNotFound
+	}
+	return blk, err
+}
+
+func (b *blockstore) GetSize(k key.Key) (int, error) {
+	size, err := b.bs.GetSize(k)
+	if err != bstore.ErrNotFound {
+		return size, err
+	}
+
+	obj, err := b.fs.Get(k)
+	if err == ErrNotFound {
+		return 0, bstore.ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(obj.Size), nil
+}
+
+func (b *blockstore) Put(blk *blocks.Block) error {
+	return b.bs.Put(blk)
+}
+
+func (b *blockstore) Has(k key.Key) (bool, error) {
+	has, err := b.bs.Has(k)
+	if err != nil || has {
+		return has, err
+	}
+	return b.fs.Has(k)
+}
+
+// DeleteBlock removes k from both stores, so that garbage collection
+// also forgets leaves kept in the filestore.
+func (b *blockstore) DeleteBlock(k key.Key) error {
+	err := b.bs.DeleteBlock(k)
+	if has, _ := b.fs.Has(k); has {
+		return b.fs.Delete(k)
+	}
+	return err
+}
+
+func (b *blockstore) AllKeysChan(ctx context.Context) (<-chan key.Key, error) {
+	bkeys, err := b.bs.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := b.fs.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan key.Key)
+	go func() {
+		defer close(out)
+		for k := range bkeys {
+			select {
+			case out <- k:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for l := range leaves {
+			select {
+			case out <- l.Key:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
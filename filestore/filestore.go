@@ -0,0 +1,259 @@
+// package filestore keeps track of blocks whose data is kept in files
+// outside the repo, added with 'ipfs add --nocopy'. Only leaves are kept
+// that way: for each, the filestore records the file, and the offset and
+// length of the leaf's data in it, and the block is rebuilt from the file
+// when it's read.
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dsns "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/namespace"
+	dsq "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	pb "github.com/ipfs/go-ipfs/unixfs/pb"
+	"github.com/ipfs/go-ipfs/util"
+)
+
+var log = util.Logger("filestore")
+
+// FilestorePrefix namespaces the filestore in the repo datastore
+var FilestorePrefix = ds.NewKey("filestore")
+
+var (
+	ErrNotFound = errors.New("filestore: block not found")
+
+	// ErrChanged is returned reading a block whose file no longer holds
+	// the block's data.
+	ErrChanged = errors.New("filestore: file changed since it was added")
+)
+
+// DataObj records where the data of a leaf is kept.
+type DataObj struct {
+	FilePath string
+	Offset   uint64
+	Size     uint64
+
+	// Raw is set for leaves of unixfs type Raw, rather than File.
+	Raw bool `json:",omitempty"`
+}
+
+// Filestore maps the keys of leaves to the files holding their data.
+type Filestore struct {
+	datastore ds.Datastore
+}
+
+func New(d ds.ThreadSafeDatastore) *Filestore {
+	return &Filestore{datastore: dsns.Wrap(d, FilestorePrefix)}
+}
+
+// LeafNode returns the node of a leaf holding data, as the importer
+// builds it.
+func LeafNode(data []byte, raw bool) (*dag.Node, error) {
+	fsn := &ft.FSNode{Type: ft.TFile, Data: data}
+	if raw {
+		fsn.Type = ft.TRaw
+	}
+	b, err := fsn.GetBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &dag.Node{Data: b}, nil
+}
+
+// IsLeaf reports whether nd is a leaf that can be kept in the filestore,
+// and whether it's a raw leaf: a node without links whose data is all
+// file contents.
+func IsLeaf(nd *dag.Node) (leaf bool, raw bool) {
+	if len(nd.Links) > 0 {
+		return false, false
+	}
+	pbd, err := ft.FromBytes(nd.Data)
+	if err != nil || len(pbd.GetData()) == 0 {
+		return false, false
+	}
+	switch pbd.GetType() {
+	case pb.Data_File, pb.Data_Raw:
+	default:
+		return false, false
+	}
+
+	raw = pbd.GetType() == pb.Data_Raw
+	rebuilt, err := LeafNode(pbd.GetData(), raw)
+	if err != nil || string(rebuilt.Data) != string(nd.Data) {
+		// it carries more than its data, such as a mode
+		return false, false
+	}
+	return true, raw
+}
+
+// dsKey returns the datastore key of the leaf k, kept in base58 as a key
+// that isn't a valid path wouldn't survive ds.NewKey.
+func dsKey(k key.Key) ds.Key {
+	return ds.NewKey(k.B58String())
+}
+
+// Put records that the leaf k is kept as obj describes.
+func (f *Filestore) Put(k key.Key, obj *DataObj) error {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return f.datastore.Put(dsKey(k), b)
+}
+
+// Get returns where the leaf k is kept.
+func (f *Filestore) Get(k key.Key) (*DataObj, error) {
+	val, err := f.datastore.Get(dsKey(k))
+	if err == ds.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, ok := val.([]byte)
+	if !ok {
+		return nil, errors.New("filestore: value is not a data object")
+	}
+
+	obj := new(DataObj)
+	if err := json.Unmarshal(b, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (f *Filestore) Has(k key.Key) (bool, error) {
+	return f.datastore.Has(dsKey(k))
+}
+
+func (f *Filestore) Delete(k key.Key) error {
+	return f.datastore.Delete(dsKey(k))
+}
+
+// Block reads the leaf k from its file. It returns ErrChanged if what's
+// there isn't the leaf's data any more.
+func (f *Filestore) Block(k key.Key) (*blocks.Block, error) {
+	obj, err := f.Get(k)
+	if err != nil {
+		return nil, err
+	}
+	return obj.block(k)
+}
+
+func (obj *DataObj) block(k key.Key) (*blocks.Block, error) {
+	file, err := os.Open(obj.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data := make([]byte, obj.Size)
+	if _, err := file.ReadAt(data, int64(obj.Offset)); err != nil {
+		if err == io.EOF {
+			return nil, ErrChanged
+		}
+		return nil, err
+	}
+
+	nd, err := LeafNode(data, obj.Raw)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := nd.Encoded(false)
+	if err != nil {
+		return nil, err
+	}
+	h, err := blocks.SumLike(enc, mh.Multihash(k))
+	if err != nil {
+		return nil, err
+	}
+	if key.Key(h) != k {
+		return nil, ErrChanged
+	}
+	return &blocks.Block{Data: enc, Multihash: h}, nil
+}
+
+// Status of a leaf, as Verify finds it.
+const (
+	StatusOk      = "ok"
+	StatusChanged = "changed"
+	StatusMissing = "missing"
+	StatusError   = "error"
+)
+
+// Verify checks that the leaf k can still be read from its file, and
+// returns its status: StatusMissing if the file is gone, StatusChanged if
+// it no longer holds the leaf's data, or StatusError with the error met
+// reading it.
+func (f *Filestore) Verify(k key.Key, obj *DataObj) (string, error) {
+	_, err := obj.block(k)
+	switch {
+	case err == nil:
+		return StatusOk, nil
+	case err == ErrChanged:
+		return StatusChanged, nil
+	case os.IsNotExist(err):
+		return StatusMissing, nil
+	}
+	return StatusError, err
+}
+
+// ListRes is a leaf of the filestore, as returned by List.
+type ListRes struct {
+	Key key.Key
+	*DataObj
+}
+
+// List returns all the leaves in the filestore.
+func (f *Filestore) List(ctx context.Context) (<-chan ListRes, error) {
+	// datastore/namespace does *NOT* fix up Query.Prefix
+	res, err := f.datastore.Query(dsq.Query{Prefix: FilestorePrefix.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan ListRes)
+	go func() {
+		defer close(out)
+		defer res.Process().Close()
+
+		for e := range res.Next() {
+			if e.Error != nil {
+				log.Debugf("filestore.List got err: %s", e.Error)
+				return
+			}
+			k := key.B58KeyDecode(ds.NewKey(e.Key).Name())
+			if _, err := mh.Cast([]byte(k)); err != nil {
+				continue
+			}
+
+			b, ok := e.Value.([]byte)
+			if !ok {
+				continue
+			}
+			obj := new(DataObj)
+			if err := json.Unmarshal(b, obj); err != nil {
+				log.Debugf("filestore: bad data object for %s: %s", k, err)
+				continue
+			}
+
+			select {
+			case out <- ListRes{Key: k, DataObj: obj}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,181 @@
+package filestore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+)
+
+// setupLeaf writes data into a file at offset, and returns the file and
+// the key of the leaf holding data.
+func setupLeaf(t *testing.T, data []byte, offset int) (string, key.Key) {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fpath := filepath.Join(dir, "file")
+	contents := append(make([]byte, offset), data...)
+	if err := ioutil.WriteFile(fpath, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := LeafNode(data, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := nd.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fpath, k
+}
+
+func TestFilestoreBlock(t *testing.T) {
+	data := []byte("some data kept in a file")
+	fpath, k := setupLeaf(t, data, 100)
+	defer os.RemoveAll(filepath.Dir(fpath))
+
+	fs := New(dssync.MutexWrap(ds.NewMapDatastore()))
+	obj := &DataObj{FilePath: fpath, Offset: 100, Size: uint64(len(data)), Raw: true}
+	if err := fs.Put(k, obj); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := fs.Block(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Key() != k {
+		t.Fatal("got the wrong block")
+	}
+	if status, err := fs.Verify(k, obj); status != StatusOk || err != nil {
+		t.Fatalf("expected ok, got %s %v", status, err)
+	}
+
+	// the file changes under the filestore
+	if err := ioutil.WriteFile(fpath, append(make([]byte, 100), []byte("other data kept in afile")...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Block(k); err != ErrChanged {
+		t.Fatalf("expected ErrChanged, got %v", err)
+	}
+	if status, _ := fs.Verify(k, obj); status != StatusChanged {
+		t.Fatalf("expected changed, got %s", status)
+	}
+	if err := os.Truncate(fpath, 110); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := fs.Verify(k, obj); status != StatusChanged {
+		t.Fatalf("expected changed for a truncated file, got %s", status)
+	}
+	if err := os.Remove(fpath); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := fs.Verify(k, obj); status != StatusMissing {
+		t.Fatalf("expected missing, got %s", status)
+	}
+
+	if _, err := fs.Block(key.Key("nope")); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestIsLeaf(t *testing.T) {
+	raw, err := LeafNode([]byte("data"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		nd   *dag.Node
+		leaf bool
+		raw  bool
+	}{
+		{&dag.Node{Data: ft.FilePBData([]byte("data"), 4)}, true, false},
+		{raw, true, true},
+		{&dag.Node{Data: ft.WrapData([]byte("data"))}, false, false}, // no file size
+		{&dag.Node{Data: ft.FolderPBData()}, false, false},
+		{&dag.Node{Data: ft.FilePBData(nil, 0)}, false, false},
+	} {
+		leaf, raw := IsLeaf(c.nd)
+		if leaf != c.leaf || raw != c.raw {
+			t.Errorf("IsLeaf(%x) = %v %v, expected %v %v", c.nd.Data, leaf, raw, c.leaf, c.raw)
+		}
+	}
+
+	withLinks := &dag.Node{Data: ft.FilePBData([]byte("data"), 8)}
+	if err := withLinks.AddNodeLink("", &dag.Node{Data: ft.FilePBData([]byte("more"), 4)}); err != nil {
+		t.Fatal(err)
+	}
+	if leaf, _ := IsLeaf(withLinks); leaf {
+		t.Error("node with links taken for a leaf")
+	}
+}
+
+func TestBlockstore(t *testing.T) {
+	data := []byte("leaf data")
+	fpath, k := setupLeaf(t, data, 0)
+	defer os.RemoveAll(filepath.Dir(fpath))
+
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	fs := New(d)
+	bs := NewBlockstore(bstore.NewBlockstore(d), fs)
+	if err := fs.Put(k, &DataObj{FilePath: fpath, Size: uint64(len(data)), Raw: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	other := &dag.Node{Data: []byte("in the repo")}
+	ok, err := other.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := other.Encoded(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Put(blocks.NewBlock(enc)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []key.Key{k, ok} {
+		if has, err := bs.Has(want); !has || err != nil {
+			t.Fatalf("blockstore doesn't have %s: %v", want, err)
+		}
+		b, err := bs.Get(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Key() != want {
+			t.Fatal("got the wrong block")
+		}
+	}
+
+	keys, err := bs.AllKeysChan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[key.Key]bool)
+	for k := range keys {
+		seen[k] = true
+	}
+	if len(seen) != 2 || !seen[k] || !seen[ok] {
+		t.Fatalf("expected both keys, got %v", seen)
+	}
+
+	if err := bs.DeleteBlock(k); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bs.Get(k); err != bstore.ErrNotFound {
+		t.Fatalf("expected ErrNotFound after deleting, got %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"sync"
 	"testing"
+	"time"
 
 	fstest "github.com/ipfs/go-ipfs/Godeps/_workspace/src/bazil.org/fuse/fs/fstestutil"
 	racedet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-detect-race"
@@ -351,6 +352,113 @@ func TestConcurrentWrites(t *testing.T) {
 	}
 }
 
+// Test writers of different parts of one file, each through its own handle
+func TestConcurrentWritersOneFile(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	_, mnt := setupIpnsTest(t, nil)
+	defer mnt.Close()
+
+	nwriters := 4
+	partSize := 100 * 1024
+
+	fpath := mnt.Dir + "/local/shared"
+	writeFileData(t, make([]byte, nwriters*partSize), fpath)
+
+	data := randBytes(nwriters * partSize)
+	wg := sync.WaitGroup{}
+	errs := make(chan error, nwriters)
+	for i := 0; i < nwriters; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			fi, err := os.OpenFile(fpath, os.O_WRONLY, 0666)
+			if err != nil {
+				errs <- err
+				return
+			}
+			part := data[n*partSize : (n+1)*partSize]
+			if _, err := fi.WriteAt(part, int64(n*partSize)); err != nil {
+				errs <- err
+			}
+			if err := fi.Close(); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	verifyFile(t, fpath, data)
+}
+
+// Test that fsync republishes the changes, without closing the file
+func TestFsyncRepublishes(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	node, mnt := setupIpnsTest(t, nil)
+	defer mnt.Close()
+
+	fi, err := os.Create(mnt.Dir + "/local/synced")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fi.Close()
+
+	if _, err := fi.Write(randBytes(5000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fi.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "/ipns/" + node.Identity.Pretty()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		p, err := node.Namesys.Resolve(context.Background(), name)
+		if err == nil {
+			nd, err := core.Resolve(context.Background(), node, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, lnk := range nd.Links {
+				if lnk.Name == "synced" {
+					return
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("fsynced file never got published")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Test renaming over an existing file, as editors do to save
+func TestRenameReplaces(t *testing.T) {
+	_, mnt := setupIpnsTest(t, nil)
+	defer mnt.Close()
+
+	orig := mnt.Dir + "/local/file"
+	tmp := mnt.Dir + "/local/.file.swp"
+	writeFile(t, 1000, orig)
+	data := writeFile(t, 2000, tmp)
+
+	if err := os.Rename(tmp, orig); err != nil {
+		t.Fatal(err)
+	}
+
+	verifyFile(t, orig, data)
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatal("renamed file should be gone, got:", err)
+	}
+}
+
 func TestFSThrash(t *testing.T) {
 	files := make(map[string][]byte)
 
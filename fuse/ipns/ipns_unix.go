@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"syscall"
 
 	fuse "github.com/ipfs/go-ipfs/Godeps/_workspace/src/bazil.org/fuse"
 	fs "github.com/ipfs/go-ipfs/Godeps/_workspace/src/bazil.org/fuse/fs"
@@ -220,7 +221,7 @@ type File struct {
 func (d *Directory) Attr(ctx context.Context, a *fuse.Attr) error {
 	log.Debug("Directory Attr")
 	*a = fuse.Attr{
-		Mode: os.ModeDir | 0555,
+		Mode: os.ModeDir | 0755,
 		Uid:  uint32(os.Getuid()),
 		Gid:  uint32(os.Getgid()),
 	}
@@ -352,12 +353,12 @@ func (fi *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fus
 	return nil
 }
 
-// Fsync flushes the content in the file to disk, but does not
-// update the dag tree internally
+// Fsync flushes the content in the file to disk, and updates the dag
+// tree up to the root, so the change gets republished
 func (fi *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
 	errs := make(chan error, 1)
 	go func() {
-		errs <- fi.fi.Sync()
+		errs <- fi.fi.Flush()
 	}()
 	select {
 	case err := <-errs:
@@ -438,25 +439,45 @@ func (dir *Directory) Remove(ctx context.Context, req *fuse.RemoveRequest) error
 	return nil
 }
 
-// Rename implements NodeRenamer
+// Rename implements NodeRenamer. As rename(2) does, it replaces an
+// existing file by the new name, which editors rely on to save files.
 func (dir *Directory) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
 	cur, err := dir.dir.Child(req.OldName)
 	if err != nil {
 		return err
 	}
 
-	err = dir.dir.Unlink(req.OldName)
-	if err != nil {
-		return err
-	}
-
 	switch newDir := newDir.(type) {
 	case *Directory:
+		if newDir.dir == dir.dir && req.NewName == req.OldName {
+			return nil
+		}
+
 		nd, err := cur.GetNode()
 		if err != nil {
 			return err
 		}
 
+		if old, err := newDir.dir.Child(req.NewName); err == nil {
+			if olddir, ok := old.(*nsfs.Directory); ok {
+				if cur.Type() != nsfs.TDir {
+					return fuse.Errno(syscall.EISDIR)
+				}
+				if len(olddir.List()) > 0 {
+					return fuse.Errno(syscall.ENOTEMPTY)
+				}
+			}
+			err = newDir.dir.Unlink(req.NewName)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = dir.dir.Unlink(req.OldName)
+		if err != nil {
+			return err
+		}
+
 		err = newDir.dir.AddChild(req.NewName, nd)
 		if err != nil {
 			return err
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"syscall"
 
 	fuse "github.com/ipfs/go-ipfs/Godeps/_workspace/src/bazil.org/fuse"
 	fs "github.com/ipfs/go-ipfs/Godeps/_workspace/src/bazil.org/fuse/fs"
@@ -118,6 +119,13 @@ func (s *Node) Attr(ctx context.Context, a *fuse.Attr) error {
 			Uid:    uint32(os.Getuid()),
 			Gid:    uint32(os.Getgid()),
 		}
+	case ftpb.Data_Symlink:
+		*a = fuse.Attr{
+			Mode: os.ModeSymlink | 0555,
+			Size: uint64(len(s.cached.GetData())),
+			Uid:  uint32(os.Getuid()),
+			Gid:  uint32(os.Getgid()),
+		}
 
 	default:
 		return fmt.Errorf("Invalid data type - %s", s.cached.GetType())
@@ -155,6 +163,17 @@ func (s *Node) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 	return nil, fuse.ENOENT
 }
 
+// Readlink returns the target of a symlink node.
+func (s *Node) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
+	if err := s.loadData(); err != nil {
+		return "", err
+	}
+	if s.cached.GetType() != ftpb.Data_Symlink {
+		return "", fuse.Errno(syscall.EINVAL)
+	}
+	return string(s.cached.GetData()), nil
+}
+
 func (s *Node) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
 
 	k, err := s.Nd.Key()
@@ -204,6 +223,7 @@ type roNode interface {
 	fs.HandleReader
 	fs.Node
 	fs.NodeStringLookuper
+	fs.NodeReadlinker
 }
 
 var _ roNode = (*Node)(nil)
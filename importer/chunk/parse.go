@@ -0,0 +1,35 @@
+package chunk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FromString returns the splitter described by s, which is either
+// "size-<bytes>" for blocks of a fixed size, or "rabin-<min>-<avg>-<max>"
+// for content-defined blocks of the given sizes. An empty string gives
+// DefaultSplitter.
+func FromString(s string) (BlockSplitter, error) {
+	if s == "" {
+		return DefaultSplitter, nil
+	}
+
+	parts := strings.Split(s, "-")
+	sizes := make([]int, len(parts)-1)
+	for i, p := range parts[1:] {
+		n, err := strconv.Atoi(p)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid block size %q in chunker %q", p, s)
+		}
+		sizes[i] = n
+	}
+
+	switch {
+	case parts[0] == "size" && len(sizes) == 1:
+		return &SizeSplitter{Size: sizes[0]}, nil
+	case parts[0] == "rabin" && len(sizes) == 3:
+		return NewRabin(sizes[0], sizes[1], sizes[2])
+	}
+	return nil, fmt.Errorf("unrecognized chunker %q: want size-<bytes> or rabin-<min>-<avg>-<max>", s)
+}
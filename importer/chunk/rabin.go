@@ -8,6 +8,11 @@ import (
 	"math"
 )
 
+// MaybeRabin splits a stream at content-defined boundaries: a block ends
+// where a rolling hash of the last bytes read has the bits of its mask all
+// set. As a boundary only depends on the bytes around it, an insertion or
+// deletion in a stream only changes the blocks it touches, and the rest
+// split the same as before.
 type MaybeRabin struct {
 	mask         int
 	windowSize   int
@@ -25,9 +30,22 @@ func NewMaybeRabin(avgBlkSize int) *MaybeRabin {
 	return rb
 }
 
+// NewRabin returns a MaybeRabin splitter making blocks of about avg bytes
+// past min on average, and of min to max bytes.
+func NewRabin(min, avg, max int) (*MaybeRabin, error) {
+	if min <= 0 || min > avg || avg > max {
+		return nil, fmt.Errorf("invalid rabin block sizes %d-%d-%d: want 0 < min <= avg <= max", min, avg, max)
+	}
+	rb := NewMaybeRabin(avg)
+	rb.MinBlockSize = min
+	rb.MaxBlockSize = max
+	return rb, nil
+}
+
 func (mr *MaybeRabin) Split(r io.Reader) chan []byte {
 	out := make(chan []byte, 16)
 	go func() {
+		defer close(out)
 		inbuf := bufio.NewReader(r)
 		blkbuf := new(bytes.Buffer)
 
@@ -57,8 +75,7 @@ func (mr *MaybeRabin) Split(r io.Reader) chan []byte {
 		for ; i < mr.windowSize; i++ {
 			b, err := inbuf.ReadByte()
 			if err != nil {
-				fmt.Println(err)
-				return
+				break
 			}
 			blkbuf.WriteByte(b)
 			push(i, b)
@@ -66,7 +83,8 @@ func (mr *MaybeRabin) Split(r io.Reader) chan []byte {
 			an = (an * a) % MOD
 		}
 
-		for ; true; i++ {
+		// unless the stream ended before the window was full
+		for ; i >= mr.windowSize; i++ {
 			b, err := inbuf.ReadByte()
 			if err != nil {
 				break
@@ -74,6 +92,10 @@ func (mr *MaybeRabin) Split(r io.Reader) chan []byte {
 			outval := push(i, b)
 			blkbuf.WriteByte(b)
 			rollingHash = (rollingHash*a + int(b) - an*outval) % MOD
+			if rollingHash < 0 {
+				// keep the hash a function of the window only
+				rollingHash += MOD
+			}
 			if (rollingHash&mr.mask == mr.mask && blkbuf.Len() > mr.MinBlockSize) ||
 				blkbuf.Len() >= mr.MaxBlockSize {
 				out <- dup(blkbuf.Bytes())
@@ -86,9 +108,12 @@ func (mr *MaybeRabin) Split(r io.Reader) chan []byte {
 				break
 			}
 		}
-		io.Copy(blkbuf, inbuf)
-		out <- blkbuf.Bytes()
-		close(out)
+		if _, err := io.Copy(blkbuf, inbuf); err != nil {
+			log.Debugf("Block split error: %s", err)
+		}
+		for blkbuf.Len() > 0 {
+			out <- dup(blkbuf.Next(mr.MaxBlockSize))
+		}
 	}()
 	return out
 }
@@ -0,0 +1,107 @@
+package chunk
+
+import (
+	"bytes"
+	"testing"
+)
+
+func splitAll(s BlockSplitter, data []byte) [][]byte {
+	var blks [][]byte
+	for blk := range s.Split(bytes.NewReader(data)) {
+		blks = append(blks, blk)
+	}
+	return blks
+}
+
+func TestRabinBlockSizes(t *testing.T) {
+	rb, err := NewRabin(2048, 8192, 32768)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := randBuf(t, 2000000)
+	blks := splitAll(rb, data)
+
+	if !bytes.Equal(bytes.Join(blks, nil), data) {
+		t.Fatal("blocks don't add up to the input")
+	}
+	for i, blk := range blks {
+		if len(blk) > rb.MaxBlockSize || (len(blk) < rb.MinBlockSize && i != len(blks)-1) {
+			t.Fatalf("block %d has %d bytes", i, len(blk))
+		}
+	}
+	if avg := len(data) / len(blks); avg < 4096 || avg > 16384 {
+		t.Fatalf("average block size %d is far from the requested 8192", avg)
+	}
+}
+
+func TestRabinSharesBlocks(t *testing.T) {
+	rb, err := NewRabin(2048, 8192, 32768)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := randBuf(t, 1000000)
+	edited := append(append(append([]byte(nil), data[:500000]...), []byte("inserted")...), data[500000:]...)
+
+	before := make(map[string]bool)
+	for _, blk := range splitAll(rb, data) {
+		before[string(blk)] = true
+	}
+	after := splitAll(rb, edited)
+	changed := 0
+	for _, blk := range after {
+		if !before[string(blk)] {
+			changed++
+		}
+	}
+	// only the blocks around the insertion differ
+	if changed > 3 {
+		t.Fatalf("%d of %d blocks changed after a small insertion", changed, len(after))
+	}
+}
+
+func TestFromString(t *testing.T) {
+	for s, ok := range map[string]bool{
+		"":                      true,
+		"size-1024":             true,
+		"rabin-1024-4096-16384": true,
+		"size":                  false,
+		"size-0":                false,
+		"size-x":                false,
+		"rabin-4096-1024-8192":  false,
+		"rabin-1-2":             false,
+		"other-5":               false,
+	} {
+		spl, err := FromString(s)
+		if ok && (err != nil || spl == nil) {
+			t.Errorf("%q: %v", s, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+
+	spl, err := FromString("size-1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss, ok := spl.(*SizeSplitter); !ok || ss.Size != 1000 {
+		t.Fatalf("size-1000 gave %#v", spl)
+	}
+}
+
+func TestRabinShortStreams(t *testing.T) {
+	rb, err := NewRabin(2048, 8192, 32768)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, 1, 15, 16, 17, 100} {
+		data := randBuf(t, n)
+		blks := splitAll(rb, data)
+		if !bytes.Equal(bytes.Join(blks, nil), data) {
+			t.Fatalf("%d bytes: blocks don't add up to the input", n)
+		}
+		if (n == 0 && len(blks) != 0) || (n > 0 && len(blks) != 1) {
+			t.Fatalf("%d bytes: split into %d blocks", n, len(blks))
+		}
+	}
+}
@@ -22,6 +22,9 @@ type DagBuilderHelper struct {
 	nextData []byte // the next item to return.
 	maxlinks int
 	ncb      NodeCB
+	hashType int
+	sparse   bool
+	rootData func([]byte) ([]byte, error)
 }
 
 type DagBuilderParams struct {
@@ -33,6 +36,18 @@ type DagBuilderParams struct {
 
 	// Callback for each block added
 	NodeCB NodeCB
+
+	// Multihash function code to hash the nodes with, sha2-256 if zero
+	HashType int
+
+	// Sparse records the blocks of zeros by their size rather than store
+	// them: runs of them, up to BlockSizeLimit bytes, make one block
+	// holding no data.
+	Sparse bool
+
+	// RootData, if set, rewrites the data of the root before it is added,
+	// as to record the stat of the file in it
+	RootData func([]byte) ([]byte, error)
 }
 
 // Generate a new DagBuilderHelper from the given params, using 'in' as a
@@ -48,6 +63,9 @@ func (dbp *DagBuilderParams) New(in <-chan []byte) *DagBuilderHelper {
 		in:       in,
 		maxlinks: dbp.Maxlinks,
 		ncb:      ncb,
+		hashType: dbp.HashType,
+		sparse:   dbp.Sparse,
+		rootData: dbp.RootData,
 	}
 }
 
@@ -129,15 +147,40 @@ func (db *DagBuilderHelper) FillNodeWithData(node *UnixfsNode) error {
 		return ErrSizeLimitExceeded
 	}
 
+	if db.sparse && isZero(data) {
+		hole := len(data)
+		for !db.Done() && hole+len(db.nextData) <= BlockSizeLimit && isZero(db.nextData) {
+			hole += len(db.Next())
+		}
+		node.SetHole(uint64(hole))
+		return nil
+	}
+
 	node.SetData(data)
 	return nil
 }
 
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func (db *DagBuilderHelper) Add(node *UnixfsNode) (*dag.Node, error) {
 	dn, err := node.GetDagNode()
 	if err != nil {
 		return nil, err
 	}
+	if db.rootData != nil {
+		dn.Data, err = db.rootData(dn.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	db.setHashType(dn)
 
 	_, err = db.dserv.Add(dn)
 	if err != nil {
@@ -153,6 +196,13 @@ func (db *DagBuilderHelper) Add(node *UnixfsNode) (*dag.Node, error) {
 	return dn, nil
 }
 
+// setHashType has dn hashed as the nodes being built are.
+func (db *DagBuilderHelper) setHashType(dn *dag.Node) {
+	if db.hashType != 0 {
+		dn.SetHashType(db.hashType)
+	}
+}
+
 func (db *DagBuilderHelper) Maxlinks() int {
 	return db.maxlinks
 }
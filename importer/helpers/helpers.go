@@ -99,6 +99,7 @@ func (n *UnixfsNode) AddChild(child *UnixfsNode, db *DagBuilderHelper) error {
 	if err != nil {
 		return err
 	}
+	db.setHashType(childnode)
 
 	// Add a link to this node without storing a reference to the memory
 	// This way, we avoid nodes building up and consuming all of our RAM
@@ -135,6 +136,12 @@ func (n *UnixfsNode) SetData(data []byte) {
 	n.ufmt.Data = data
 }
 
+// SetHole sets the size of the run of zeros after the data of the node,
+// which is recorded rather than stored.
+func (n *UnixfsNode) SetHole(size uint64) {
+	n.ufmt.SetHole(size)
+}
+
 // getDagNode fills out the proper formatting for the unixfs node
 // inside of a DAG node and returns the dag node
 func (n *UnixfsNode) GetDagNode() (*dag.Node, error) {
@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	bal "github.com/ipfs/go-ipfs/importer/balanced"
+	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	h "github.com/ipfs/go-ipfs/importer/helpers"
+	trickle "github.com/ipfs/go-ipfs/importer/trickle"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// sparseData returns data with runs of zeros between random bytes.
+func sparseData(t *testing.T) []byte {
+	var buf bytes.Buffer
+	for _, size := range []int{5000, 0, 3000, 0, 100, 0} {
+		if size == 0 {
+			buf.Write(make([]byte, 3*h.BlockSizeLimit))
+			continue
+		}
+		if _, err := io.CopyN(&buf, u.NewTimeSeededRand(), int64(size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func testSparse(t *testing.T, layout func(*h.DagBuilderHelper) (*dag.Node, error)) {
+	data := sparseData(t)
+	ds := mdtest.Mock(t)
+	dbp := h.DagBuilderParams{
+		Dagserv:  ds,
+		Maxlinks: h.DefaultLinksPerBlock,
+		Sparse:   true,
+	}
+	nd, err := layout(dbp.New((&chunk.SizeSplitter{Size: 4096}).Split(bytes.NewReader(data))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dr, err := uio.NewDagReader(context.TODO(), nd, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dr.Size() != int64(len(data)) {
+		t.Fatalf("expected a size of %d, got %d", len(data), dr.Size())
+	}
+	out, err := ioutil.ReadAll(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("bad read")
+	}
+
+	// the zeros take no room.
+	size, err := nd.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size > uint64(len(data))/10 {
+		t.Fatalf("expected the zeros not to be stored, the DAG takes %d bytes", size)
+	}
+
+	for _, off := range []int64{0, 4000, 5000, 6000, int64(len(data)) - 50} {
+		if _, err := dr.Seek(off, os.SEEK_SET); err != nil {
+			t.Fatal(err)
+		}
+		out := make([]byte, 100)
+		n, err := io.ReadFull(dr, out)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out[:n], data[off:off+int64(n)]) {
+			t.Fatalf("bad read at %d", off)
+		}
+	}
+}
+
+func TestSparseBalanced(t *testing.T) {
+	testSparse(t, bal.BalancedLayout)
+}
+
+func TestSparseTrickle(t *testing.T) {
+	testSparse(t, trickle.TrickleLayout)
+}
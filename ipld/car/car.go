@@ -0,0 +1,202 @@
+// Package car writes DAGs out as archives of their blocks, and reads them
+// back.
+//
+// An archive is a header, then the blocks, each prefixed with the uvarint
+// length of its multihash and data, then the multihash:
+//
+//	uvarint(len(header)) | header
+//	uvarint(len(multihash)+len(data)) | multihash | data
+//	...
+//
+// The header is a CBOR map, {"roots": [<link>, ...], "version": 1}. Write
+// puts out the blocks of a DAG depth first, in the order of the links of
+// each object, and each block only once: the archive of a DAG is always
+// the same bytes.
+package car
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	ipld "github.com/ipfs/go-ipfs/ipld"
+)
+
+// Version is the version of the archives written.
+const Version = 1
+
+// maxSectionSize bounds the header and each block read, so a corrupt
+// length doesn't have the reader allocate without end.
+const maxSectionSize = 32 << 20
+
+var ErrSectionTooLarge = errors.New("car: section too large")
+
+// Header is what an archive starts with.
+type Header struct {
+	Version uint64
+	Roots   []key.Key
+}
+
+// Write writes the archive of the DAGs under roots to w, getting their
+// blocks from bg.
+func Write(ctx context.Context, bg ipld.BlockGetter, roots []key.Key, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if err := writeHeader(bw, &Header{Version: Version, Roots: roots}); err != nil {
+		return err
+	}
+
+	err := ipld.Walk(ctx, bg, roots, func(b *blocks.Block) error {
+		return writeSection(bw, []byte(b.Multihash), b.Data)
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeHeader(w io.Writer, h *Header) error {
+	roots := make([]interface{}, len(h.Roots))
+	for i, r := range h.Roots {
+		roots[i] = ipld.Link(r)
+	}
+	data, err := ipld.Encode(map[string]interface{}{
+		"roots":   roots,
+		"version": h.Version,
+	})
+	if err != nil {
+		return err
+	}
+	return writeSection(w, data)
+}
+
+func writeSection(w io.Writer, parts ...[]byte) error {
+	var n int
+	for _, p := range parts {
+		n += len(p)
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	if _, err := w.Write(buf[:binary.PutUvarint(buf, uint64(n))]); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reader reads the blocks of an archive.
+type Reader struct {
+	Header Header
+	r      *bufio.Reader
+}
+
+// NewReader reads the header of the archive r is, and returns a Reader of
+// its blocks.
+func NewReader(r io.Reader) (*Reader, error) {
+	cr := &Reader{r: bufio.NewReader(r)}
+	data, err := cr.section()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeHeader(data, &cr.Header); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func decodeHeader(data []byte, h *Header) error {
+	v, err := ipld.Decode(data)
+	if err != nil {
+		return fmt.Errorf("car: invalid header: %s", err)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.New("car: invalid header: not a map")
+	}
+
+	switch ver := m["version"].(type) {
+	case int64:
+		h.Version = uint64(ver)
+	case uint64:
+		h.Version = ver
+	default:
+		return errors.New("car: invalid header: no version")
+	}
+	if h.Version != Version {
+		return fmt.Errorf("car: unsupported version %d", h.Version)
+	}
+
+	roots, ok := m["roots"].([]interface{})
+	if !ok {
+		return errors.New("car: invalid header: no roots")
+	}
+	for _, r := range roots {
+		l, ok := r.(ipld.Link)
+		if !ok {
+			return errors.New("car: invalid header: root is not a link")
+		}
+		h.Roots = append(h.Roots, key.Key(l))
+	}
+	return nil
+}
+
+// Next returns the next block of the archive, or io.EOF after the last.
+// Blocks whose data doesn't match their hash are an error.
+func (cr *Reader) Next() (*blocks.Block, error) {
+	data, err := cr.section()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || len(data) < int(data[1])+2 {
+		return nil, errors.New("car: invalid block: truncated multihash")
+	}
+	// the second byte of a multihash is the length of its digest.
+	n := int(data[1]) + 2
+	h, err := mh.Cast(data[:n])
+	if err != nil {
+		return nil, fmt.Errorf("car: invalid block: %s", err)
+	}
+	chk, err := blocks.SumLike(data[n:], h)
+	if err != nil {
+		return nil, err
+	}
+	if string(chk) != string(h) {
+		return nil, fmt.Errorf("car: block %s doesn't match its hash", key.Key(h))
+	}
+	return &blocks.Block{Multihash: h, Data: data[n:]}, nil
+}
+
+// section reads the next length prefixed section, or returns io.EOF if
+// there's nothing left.
+func (cr *Reader) section() ([]byte, error) {
+	n, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	if n > maxSectionSize {
+		return nil, ErrSectionTooLarge
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(cr.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,136 @@
+package car
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	ipld "github.com/ipfs/go-ipfs/ipld"
+	merkledag "github.com/ipfs/go-ipfs/merkledag"
+)
+
+type mapGetter map[key.Key]*blocks.Block
+
+func (g mapGetter) GetBlock(ctx context.Context, k key.Key) (*blocks.Block, error) {
+	b, ok := g[k]
+	if !ok {
+		return nil, merkledag.ErrNotFound
+	}
+	return b, nil
+}
+
+func (g mapGetter) put(t *testing.T, obj interface{}) key.Key {
+	b, err := ipld.NewBlock(obj, mh.SHA2_256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g[b.Key()] = b
+	return b.Key()
+}
+
+func (g mapGetter) putNode(t *testing.T, nd *merkledag.Node) key.Key {
+	enc, err := nd.Encoded(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := blocks.NewBlock(enc)
+	g[b.Key()] = b
+	return b.Key()
+}
+
+func TestRoundTrip(t *testing.T) {
+	g := make(mapGetter)
+	file := &merkledag.Node{Data: []byte("file")}
+	dir := &merkledag.Node{}
+	if err := dir.AddNodeLink("f", file); err != nil {
+		t.Fatal(err)
+	}
+	filek := g.putNode(t, file)
+	dirk := g.putNode(t, dir)
+	leaf := g.put(t, map[string]interface{}{"c": "leaf"})
+	// the leaf is linked to twice, but is only written once.
+	root := g.put(t, map[string]interface{}{
+		"a":   []interface{}{ipld.Link(leaf), ipld.Link(leaf)},
+		"dir": ipld.Link(dirk),
+	})
+
+	var buf bytes.Buffer
+	if err := Write(context.Background(), g, []key.Key{root}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	if err := Write(context.Background(), g, []key.Key{root}, &again); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		t.Fatal("archives of the same DAG differ")
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Header.Version != Version || len(r.Header.Roots) != 1 || r.Header.Roots[0] != root {
+		t.Fatalf("wrong header: %+v", r.Header)
+	}
+	var got []key.Key
+	for {
+		b, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b.Data, g[b.Key()].Data) {
+			t.Fatalf("wrong data for %s", b.Key())
+		}
+		got = append(got, b.Key())
+	}
+	expected := []key.Key{root, leaf, dirk, filek}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d blocks, got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("block %d is %s, expected %s", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestReadCorrupt(t *testing.T) {
+	g := make(mapGetter)
+	root := g.put(t, map[string]interface{}{"a": "b"})
+	var buf bytes.Buffer
+	if err := Write(context.Background(), g, []key.Key{root}, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)-1] ^= 0xff
+	r, err := NewReader(bytes.NewReader(flipped))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); err == nil {
+		t.Fatal("block not matching its hash was read")
+	}
+
+	r, err = NewReader(bytes.NewReader(data[:len(data)-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected an unexpected EOF, got %v", err)
+	}
+
+	if _, err := NewReader(bytes.NewReader(nil)); err == nil {
+		t.Fatal("empty archive was read")
+	}
+}
@@ -0,0 +1,351 @@
+package ipld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"unicode/utf8"
+
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+// CBOR major types
+const (
+	majUint   = 0
+	majNegint = 1
+	majBytes  = 2
+	majText   = 3
+	majArray  = 4
+	majMap    = 5
+	majTag    = 6
+	majSimple = 7
+)
+
+// tagLink tags the byte strings holding the multihash of a linked object.
+const tagLink = 42
+
+// maxDepth bounds how deeply arrays and maps may nest in what's decoded.
+const maxDepth = 256
+
+var ErrNotMap = errors.New("ipld: objects must be maps")
+
+// Encode encodes v as canonical CBOR: integers and lengths as short as
+// they can be, floats as 64 bits, and map keys sorted, shortest first,
+// so that equal values always encode to the same bytes, and hash alike.
+//
+// v is built of nil, bool, int, int64, uint64, float64, string, []byte,
+// Link, []interface{} and map[string]interface{}.
+func Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(majSimple<<5 | 22)
+	case bool:
+		if v {
+			buf.WriteByte(majSimple<<5 | 21)
+		} else {
+			buf.WriteByte(majSimple<<5 | 20)
+		}
+	case int:
+		encodeInt(buf, int64(v))
+	case int64:
+		encodeInt(buf, v)
+	case uint64:
+		writeHead(buf, majUint, v)
+	case float64:
+		var b [9]byte
+		b[0] = majSimple<<5 | 27
+		binary.BigEndian.PutUint64(b[1:], math.Float64bits(v))
+		buf.Write(b[:])
+	case string:
+		writeHead(buf, majText, uint64(len(v)))
+		buf.WriteString(v)
+	case []byte:
+		writeHead(buf, majBytes, uint64(len(v)))
+		buf.Write(v)
+	case Link:
+		writeHead(buf, majTag, tagLink)
+		writeHead(buf, majBytes, uint64(len(v)))
+		buf.WriteString(string(v))
+	case []interface{}:
+		writeHead(buf, majArray, uint64(len(v)))
+		for _, e := range v {
+			if err := encode(buf, e); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Sort(canonicalKeys(keys))
+		writeHead(buf, majMap, uint64(len(v)))
+		for _, k := range keys {
+			writeHead(buf, majText, uint64(len(k)))
+			buf.WriteString(k)
+			if err := encode(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("ipld: can't encode %T", v)
+	}
+	return nil
+}
+
+func encodeInt(buf *bytes.Buffer, i int64) {
+	if i < 0 {
+		writeHead(buf, majNegint, uint64(-1-i))
+	} else {
+		writeHead(buf, majUint, uint64(i))
+	}
+}
+
+// writeHead writes the head of an item of the major type, with its
+// argument n in as few bytes as it fits in.
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	var b [9]byte
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+		return
+	case n <= math.MaxUint8:
+		b[0] = major<<5 | 24
+		b[1] = byte(n)
+		buf.Write(b[:2])
+	case n <= math.MaxUint16:
+		b[0] = major<<5 | 25
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		buf.Write(b[:3])
+	case n <= math.MaxUint32:
+		b[0] = major<<5 | 26
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		buf.Write(b[:5])
+	default:
+		b[0] = major<<5 | 27
+		binary.BigEndian.PutUint64(b[1:], n)
+		buf.Write(b[:9])
+	}
+}
+
+// canonicalKeys sorts map keys shortest first, then bytewise, which is
+// the order of their encodings.
+type canonicalKeys []string
+
+func (k canonicalKeys) Len() int      { return len(k) }
+func (k canonicalKeys) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k canonicalKeys) Less(i, j int) bool {
+	if len(k[i]) != len(k[j]) {
+		return len(k[i]) < len(k[j])
+	}
+	return k[i] < k[j]
+}
+
+// Decode decodes the CBOR item in data, into the values Encode takes.
+// Integers are decoded as int64, or uint64 if they don't fit, and link
+// tags as Links. Items of indefinite length, map keys other than strings
+// and tags other than links aren't accepted.
+func Decode(data []byte) (interface{}, error) {
+	d := &decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, errors.New("ipld: trailing data after the object")
+	}
+	return v, nil
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+var errTruncated = errors.New("ipld: object is truncated")
+
+// head reads the head of the next item: its major type, the additional
+// information in its first byte, and the argument that follows.
+func (d *decoder) head() (major, info byte, n uint64, err error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, 0, errTruncated
+	}
+	b := d.data[d.pos]
+	d.pos++
+	major, info = b>>5, b&0x1f
+
+	size := 0
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == 31:
+		return 0, 0, 0, errors.New("ipld: items of indefinite length aren't supported")
+	default:
+		return 0, 0, 0, fmt.Errorf("ipld: invalid item head %#x", b)
+	}
+	if len(d.data)-d.pos < size {
+		return 0, 0, 0, errTruncated
+	}
+	for _, c := range d.data[d.pos : d.pos+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.pos += size
+	return major, info, n, nil
+}
+
+// bytes reads the n bytes of a string.
+func (d *decoder) bytes(n uint64) ([]byte, error) {
+	if uint64(len(d.data)-d.pos) < n {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("ipld: object nests too deeply")
+	}
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	// every item takes at least a byte, which bounds the lengths of arrays
+	// and maps before anything is allocated for them
+	left := uint64(len(d.data) - d.pos)
+
+	switch major {
+	case majUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case majNegint:
+		if n > math.MaxInt64 {
+			return nil, errors.New("ipld: negative integer out of range")
+		}
+		return -1 - int64(n), nil
+	case majBytes:
+		b, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case majText:
+		b, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(b) {
+			return nil, errors.New("ipld: string is not valid UTF-8")
+		}
+		return string(b), nil
+	case majArray:
+		if n > left {
+			return nil, errTruncated
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			if arr[i], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case majMap:
+		if n > left/2 {
+			return nil, errTruncated
+		}
+		m := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			ks, ok := k.(string)
+			if !ok {
+				return nil, errors.New("ipld: map keys must be strings")
+			}
+			if _, dup := m[ks]; dup {
+				return nil, fmt.Errorf("ipld: duplicate map key %q", ks)
+			}
+			if m[ks], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case majTag:
+		if n != tagLink {
+			return nil, fmt.Errorf("ipld: unsupported tag %d", n)
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := v.([]byte)
+		if !ok {
+			return nil, errors.New("ipld: links must be byte strings")
+		}
+		if _, err := cid.Cast(key.Key(b)); err != nil {
+			return nil, fmt.Errorf("ipld: invalid link: %s", err)
+		}
+		return Link(b), nil
+	default:
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			// null and undefined
+			return nil, nil
+		case 25:
+			return halfFloat(uint16(n)), nil
+		case 26:
+			return float64(math.Float32frombits(uint32(n))), nil
+		case 27:
+			return math.Float64frombits(n), nil
+		}
+		return nil, fmt.Errorf("ipld: unsupported simple value %d", n)
+	}
+}
+
+// halfFloat returns the value of an IEEE 754 half-precision float.
+func halfFloat(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac != 0 {
+			return math.NaN()
+		}
+		return math.Inf(int(sign))
+	}
+	return sign * math.Ldexp(1024+frac, exp-25)
+}
@@ -0,0 +1,208 @@
+// package ipld stores structured objects of any shape as blocks, next to
+// the merkledag nodes of unixfs, and resolves paths through them.
+//
+// An object is a map whose values are strings, numbers, byte strings,
+// booleans, null, arrays, maps, and links to other objects, encoded in
+// CBOR. In JSON, links are written {"/": "<hash>"}. Merkledag nodes are
+// read as objects too, with their "Data", and their "Links", each with a
+// "Name", a "Size" and a "Hash" linking to the node it points to.
+package ipld
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	merkledag "github.com/ipfs/go-ipfs/merkledag"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// Link links to another object, by the multihash of its block.
+type Link key.Key
+
+func (l Link) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"/": key.Key(l).B58String()})
+}
+
+func (l Link) String() string {
+	return key.Key(l).B58String()
+}
+
+// FromJSON reads an object, or any other value, from JSON.
+func FromJSON(r io.Reader) (interface{}, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return fromJSON(v)
+}
+
+func fromJSON(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if s, ok := v["/"].(string); ok && len(v) == 1 {
+			c, err := cid.Parse(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid link %q: %s", s, err)
+			}
+			return Link(c.Key()), nil
+		}
+		for k, e := range v {
+			e, err := fromJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = e
+		}
+		return v, nil
+	case []interface{}:
+		for i, e := range v {
+			e, err := fromJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = e
+		}
+		return v, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		if i, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	}
+	return v, nil
+}
+
+// NewBlock encodes obj, which must be a map, in a block hashed with the
+// multihash function code.
+func NewBlock(obj interface{}, code int) (*blocks.Block, error) {
+	if _, ok := obj.(map[string]interface{}); !ok {
+		return nil, ErrNotMap
+	}
+	data, err := Encode(obj)
+	if err != nil {
+		return nil, err
+	}
+	h, err := u.Sum(data, code, -1)
+	if err != nil {
+		return nil, err
+	}
+	return &blocks.Block{Data: data, Multihash: h}, nil
+}
+
+// IsObject reports whether data is an object encoded in CBOR, rather than
+// a merkledag node: those never start with the head of a CBOR map.
+func IsObject(data []byte) bool {
+	return len(data) > 0 && data[0]>>5 == majMap
+}
+
+// codec returns the codec of the data of b: the one its cid names, and
+// else dag-cbor for objects and dag-pb for merkledag nodes.
+func codec(b *blocks.Block) uint64 {
+	if p, err := cid.PrefixOf(b.Key()); err == nil && p.Version == 1 {
+		return p.Codec
+	}
+	if IsObject(b.Data) {
+		return cid.DagCBOR
+	}
+	return cid.DagProtobuf
+}
+
+// FromBlock decodes the object in b, which may be a merkledag node. The
+// node is returned too, if it is one. Raw blocks are their data, as a byte
+// string, and a raw node.
+func FromBlock(b *blocks.Block) (interface{}, *merkledag.Node, error) {
+	switch codec(b) {
+	case cid.DagCBOR:
+		obj, err := Decode(b.Data)
+		return obj, nil, err
+	case cid.Raw:
+		nd := &merkledag.Node{Data: b.Data}
+		p, _ := cid.PrefixOf(b.Key())
+		nd.SetPrefix(p)
+		return b.Data, nd, nil
+	}
+	nd, err := merkledag.Decoded(b.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p, err := cid.PrefixOf(b.Key()); err == nil && p != cid.V0Prefix {
+		nd.SetPrefix(p)
+	}
+	return nodeObject(nd), nd, nil
+}
+
+// Links returns the keys of the blocks the object in b links to, in the
+// order of its encoding: of its links, if it's a merkledag node, and else
+// of the links in its values, depth first. Raw blocks link to none.
+func Links(b *blocks.Block) ([]key.Key, error) {
+	c := codec(b)
+	if c == cid.Raw {
+		return nil, nil
+	}
+	if c == cid.DagProtobuf {
+		nd, err := merkledag.Decoded(b.Data)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]key.Key, len(nd.Links))
+		for i, l := range nd.Links {
+			keys[i] = key.Key(l.Hash)
+		}
+		return keys, nil
+	}
+	obj, err := Decode(b.Data)
+	if err != nil {
+		return nil, err
+	}
+	return appendLinks(nil, obj), nil
+}
+
+func appendLinks(keys []key.Key, v interface{}) []key.Key {
+	switch v := v.(type) {
+	case Link:
+		keys = append(keys, key.Key(v))
+	case []interface{}:
+		for _, e := range v {
+			keys = appendLinks(keys, e)
+		}
+	case map[string]interface{}:
+		// in the order of the encoding, for the links to come out alike
+		// each time.
+		names := make(canonicalKeys, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Sort(names)
+		for _, name := range names {
+			keys = appendLinks(keys, v[name])
+		}
+	}
+	return keys
+}
+
+// nodeObject returns the object a merkledag node is read as.
+func nodeObject(nd *merkledag.Node) map[string]interface{} {
+	links := make([]interface{}, len(nd.Links))
+	for i, l := range nd.Links {
+		links[i] = map[string]interface{}{
+			"Name": l.Name,
+			"Size": l.Size,
+			"Hash": Link(l.Hash),
+		}
+	}
+	return map[string]interface{}{
+		"Data":  nd.Data,
+		"Links": links,
+	}
+}
@@ -0,0 +1,248 @@
+package ipld
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	merkledag "github.com/ipfs/go-ipfs/merkledag"
+)
+
+func TestEncodeCanonical(t *testing.T) {
+	cases := []struct {
+		v   interface{}
+		hex string
+	}{
+		{int64(0), "00"},
+		{int64(23), "17"},
+		{int64(24), "1818"},
+		{int64(1000), "1903e8"},
+		{int64(-1), "20"},
+		{int64(-1000), "3903e7"},
+		{uint64(1 << 63), "1b8000000000000000"},
+		{1.5, "fb3ff8000000000000"},
+		{"a", "6161"},
+		{[]byte{1, 2}, "420102"},
+		{nil, "f6"},
+		{true, "f5"},
+		{[]interface{}{int64(1), "b"}, "82016162"},
+		// shorter keys first
+		{map[string]interface{}{"bb": int64(1), "a": int64(2), "c": int64(3)}, "a3616102616303626262" + "01"},
+	}
+	for _, c := range cases {
+		b, err := Encode(c.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(b) != c.hex {
+			t.Errorf("%v encoded to %x, not %s", c.v, b, c.hex)
+		}
+		v, err := Decode(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, c.v) {
+			t.Errorf("%x decoded to %#v, not %#v", b, v, c.v)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, h := range []string{
+		"",
+		"1903",           // truncated
+		"0000",           // trailing data
+		"9f01ff",         // indefinite length
+		"a10101",         // integer key
+		"a2616101616102", // duplicate key
+		"c16161",         // unknown tag
+		"d82a420102",     // link that isn't a multihash
+		"9b00000000ffffffff",
+		"62c328", // invalid UTF-8
+	} {
+		b, _ := hex.DecodeString(h)
+		if _, err := Decode(b); err == nil {
+			t.Errorf("decoded %s", h)
+		}
+	}
+
+	deep := bytes.Repeat([]byte{0x81}, maxDepth+2)
+	if _, err := Decode(append(deep, 0)); err == nil {
+		t.Error("decoded an object nesting too deeply")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	h := hashOf(t, "hello")
+	in := `{"a": [1, -2, 3.5, "x", null, true], "l": {"/": "` + h.B58String() + `"}, "big": 18446744073709551615}`
+	v, err := FromJSON(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := v.(map[string]interface{})
+	if m["l"] != Link(h) {
+		t.Fatalf("link read as %#v", m["l"])
+	}
+	if m["big"] != uint64(18446744073709551615) {
+		t.Fatalf("big number read as %#v", m["big"])
+	}
+
+	b, err := Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := FromJSON(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, v) {
+		t.Fatalf("%s read back as %#v", out, back)
+	}
+
+	if _, err := FromJSON(strings.NewReader(`{"/": "nope"}`)); err == nil {
+		t.Fatal("read an invalid link")
+	}
+}
+
+type mapGetter map[key.Key]*blocks.Block
+
+func (g mapGetter) GetBlock(ctx context.Context, k key.Key) (*blocks.Block, error) {
+	b, ok := g[k]
+	if !ok {
+		return nil, merkledag.ErrNotFound
+	}
+	return b, nil
+}
+
+func (g mapGetter) put(t *testing.T, obj interface{}) key.Key {
+	b, err := NewBlock(obj, mh.SHA2_256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g[b.Key()] = b
+	return b.Key()
+}
+
+func TestResolve(t *testing.T) {
+	g := make(mapGetter)
+
+	file := &merkledag.Node{Data: []byte("file")}
+	dir := &merkledag.Node{}
+	if err := dir.AddNodeLink("f", file); err != nil {
+		t.Fatal(err)
+	}
+	for _, nd := range []*merkledag.Node{file, dir} {
+		enc, err := nd.Encoded(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := blocks.NewBlock(enc)
+		g[b.Key()] = b
+	}
+	dirk, _ := dir.Key()
+	filek, _ := file.Key()
+
+	leaf := g.put(t, map[string]interface{}{"c": "leaf"})
+	root := g.put(t, map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": []interface{}{Link(leaf), int64(7)},
+		},
+		"dir": Link(dirk),
+	})
+
+	cases := []struct {
+		path    string
+		key     key.Key
+		rem     string
+		value   interface{}
+		invalid bool
+	}{
+		{path: "a/b/0/c", key: leaf, rem: "c", value: "leaf"},
+		{path: "a/b/1", key: root, rem: "a/b/1", value: int64(7)},
+		{path: "a/b/0", key: leaf},
+		{path: "dir/f", key: filek},
+		{path: "dir/Links/0/Name", key: dirk, rem: "Links/0/Name", value: "f"},
+		{path: "a/x", invalid: true},
+		{path: "a/b/2", invalid: true},
+		{path: "a/b/1/c", invalid: true},
+		{path: "dir/g", invalid: true},
+	}
+	for _, c := range cases {
+		var names []string
+		if c.path != "" {
+			names = strings.Split(c.path, "/")
+		}
+		r, err := Resolve(context.Background(), g, root, names)
+		if c.invalid {
+			if err == nil {
+				t.Errorf("%s: resolved to %s", c.path, r)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", c.path, err)
+		}
+		if r.Key != c.key || strings.Join(r.RemPath, "/") != c.rem {
+			t.Errorf("%s: resolved to %s", c.path, r)
+		}
+		if c.value != nil && !reflect.DeepEqual(r.Value, c.value) {
+			t.Errorf("%s: resolved to %#v", c.path, r.Value)
+		}
+	}
+}
+
+func hashOf(t *testing.T, s string) mh.Multihash {
+	h, err := mh.Sum([]byte(s), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestStat(t *testing.T) {
+	g := make(mapGetter)
+
+	// a block linked twice counts once
+	leaf := g.put(t, map[string]interface{}{"c": "leaf"})
+	mid := g.put(t, map[string]interface{}{"l": Link(leaf)})
+	root := g.put(t, map[string]interface{}{"a": Link(mid), "b": Link(leaf)})
+
+	var size uint64
+	for _, k := range []key.Key{leaf, mid, root} {
+		size += uint64(len(g[k].Data))
+	}
+
+	var updates []DagStat
+	st, err := Stat(context.Background(), g, root, func(s DagStat) {
+		updates = append(updates, s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.NumBlocks != 3 || st.Size != size {
+		t.Fatalf("expected 3 blocks of %d bytes, got %+v", size, st)
+	}
+	if len(updates) != 3 || updates[2] != *st {
+		t.Fatalf("expected the progress of each block, got %v", updates)
+	}
+
+	delete(g, leaf)
+	if _, err := Stat(context.Background(), g, root, nil); err == nil {
+		t.Fatal("expected a missing block to fail")
+	}
+}
@@ -0,0 +1,117 @@
+package ipld
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	merkledag "github.com/ipfs/go-ipfs/merkledag"
+)
+
+// BlockGetter fetches blocks, as the blockservice does.
+type BlockGetter interface {
+	GetBlock(ctx context.Context, k key.Key) (*blocks.Block, error)
+}
+
+// Resolved is where a path leads.
+type Resolved struct {
+	// Key is the key of the last object the path reached, and RemPath the
+	// rest of the path, within that object, leading to Value.
+	Key     key.Key
+	RemPath []string
+	Value   interface{}
+}
+
+// Resolve walks names from the object at k: through the fields of maps,
+// the indexes of arrays and, in merkledag nodes, the names of their links,
+// fetching the objects links point to as it meets them. A path ending in
+// a link leads to the object it points to.
+func Resolve(ctx context.Context, bg BlockGetter, k key.Key, names []string) (*Resolved, error) {
+	r := &Resolved{Key: k}
+	obj, nd, err := fetch(ctx, bg, k)
+	if err != nil {
+		return nil, err
+	}
+	r.Value = obj
+
+	for _, name := range names {
+		var next interface{}
+		if nd != nil && len(r.RemPath) == 0 {
+			if l, err := nd.GetNodeLink(name); err == nil {
+				next = Link(l.Hash)
+			}
+		}
+		if next == nil {
+			if next, err = field(r.Value, name); err != nil {
+				return nil, fmt.Errorf("%s under %s", err, r)
+			}
+		}
+		r.RemPath = append(r.RemPath, name)
+
+		l, ok := next.(Link)
+		if !ok {
+			r.Value = next
+			continue
+		}
+		r.Key = key.Key(l)
+		r.RemPath = nil
+		if r.Value, nd, err = fetch(ctx, bg, r.Key); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *Resolved) String() string {
+	s := r.Key.B58String()
+	for _, name := range r.RemPath {
+		s += "/" + name
+	}
+	return s
+}
+
+// field returns the value named name in v, a map or an array.
+func field(v interface{}, name string) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		e, ok := v[name]
+		if !ok {
+			return nil, fmt.Errorf("no field %q", name)
+		}
+		return e, nil
+	case []interface{}:
+		i, err := strconv.Atoi(name)
+		if err != nil || i < 0 || i >= len(v) {
+			return nil, fmt.Errorf("no index %q in an array of %d", name, len(v))
+		}
+		return v[i], nil
+	}
+	return nil, fmt.Errorf("no field %q in a %s", name, kind(v))
+}
+
+// kind names the kind of value v is, for errors.
+func kind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []byte:
+		return "byte string"
+	case int64, uint64, float64:
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func fetch(ctx context.Context, bg BlockGetter, k key.Key) (interface{}, *merkledag.Node, error) {
+	b, err := bg.GetBlock(ctx, k)
+	if err != nil {
+		return nil, nil, err
+	}
+	return FromBlock(b)
+}
@@ -0,0 +1,72 @@
+package ipld
+
+import (
+	"fmt"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+// Walk calls f with each block of the DAGs under roots, getting them from
+// bg: depth first, in the order of the links of each object, and each
+// block only once.
+func Walk(ctx context.Context, bg BlockGetter, roots []key.Key, f func(*blocks.Block) error) error {
+	seen := make(map[key.Key]bool)
+	// the stack holds the links last to first, so they're popped in order.
+	stack := make([]key.Key, 0, len(roots))
+	for i := len(roots) - 1; i >= 0; i-- {
+		stack = append(stack, roots[i])
+	}
+	for len(stack) > 0 {
+		k := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		b, err := bg.GetBlock(ctx, k)
+		if err != nil {
+			return err
+		}
+		if err := f(b); err != nil {
+			return err
+		}
+		links, err := Links(b)
+		if err != nil {
+			return fmt.Errorf("reading links of %s: %s", k, err)
+		}
+		for i := len(links) - 1; i >= 0; i-- {
+			if !seen[links[i]] {
+				stack = append(stack, links[i])
+			}
+		}
+	}
+	return nil
+}
+
+// DagStat is the size of a DAG, counting each of its blocks once.
+type DagStat struct {
+	NumBlocks int
+	Size      uint64
+}
+
+// Stat counts the blocks of the DAG under root, and their bytes, getting
+// them from bg. progress, if not nil, is called with the counts so far as
+// each block comes.
+func Stat(ctx context.Context, bg BlockGetter, root key.Key, progress func(DagStat)) (*DagStat, error) {
+	var st DagStat
+	err := Walk(ctx, bg, []key.Key{root}, func(b *blocks.Block) error {
+		st.NumBlocks++
+		st.Size += uint64(len(b.Data))
+		if progress != nil {
+			progress(st)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
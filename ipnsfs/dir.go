@@ -195,6 +195,11 @@ func (d *Directory) Mkdir(name string) (*Directory, error) {
 	}
 
 	ndir := &dag.Node{Data: ft.FolderPBData()}
+	_, err = d.fs.dserv.Add(ndir)
+	if err != nil {
+		return nil, err
+	}
+
 	err = d.node.AddNodeLinkClean(name, ndir)
 	if err != nil {
 		return nil, err
@@ -61,6 +61,13 @@ func (fi *File) CtxReadFull(ctx context.Context, b []byte) (int, error) {
 // Close flushes, then propogates the modified dag node up the directory structure
 // and signals a republish to occur
 func (fi *File) Close() error {
+	return fi.Flush()
+}
+
+// Flush writes out the changes to the file, and propogates them up to the
+// root, which gets republished. Unlike Close, it is meant to be called while
+// the file is still being written, as on fsync.
+func (fi *File) Flush() error {
 	fi.Lock()
 	defer fi.Unlock()
 	if fi.hasChanges {
@@ -74,14 +81,15 @@ func (fi *File) Close() error {
 			return err
 		}
 
+		// writes made while the lock is released are left to the next flush
+		fi.hasChanges = false
 		fi.Unlock()
 		err = fi.parent.closeChild(fi.name, nd)
 		fi.Lock()
 		if err != nil {
+			fi.hasChanges = true
 			return err
 		}
-
-		fi.hasChanges = false
 	}
 
 	return nil
@@ -0,0 +1,159 @@
+package ipnsfs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	path "github.com/ipfs/go-ipfs/path"
+	pin "github.com/ipfs/go-ipfs/pin"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+)
+
+// UpdateFunc is called with the new root node of a tree after every change
+// to it. The node and everything below it have been stored by then.
+type UpdateFunc func(nd *dag.Node) error
+
+// Root is the root of a mutable directory tree that is not published under
+// a key, such as the one behind 'ipfs files'. Changes made anywhere in the
+// tree propagate up to it, and it reports each new root through an
+// UpdateFunc so that the caller can record it.
+type Root struct {
+	fs *Filesystem
+
+	lock sync.Mutex
+	node *dag.Node
+	dir  *Directory
+
+	update UpdateFunc
+}
+
+// NewRoot creates a Root for the directory node nd.
+func NewRoot(ds dag.DAGService, pins pin.Pinner, nd *dag.Node, update UpdateFunc) (*Root, error) {
+	pbn, err := ft.FromBytes(nd.Data)
+	if err != nil {
+		return nil, err
+	}
+	if pbn.GetType() != ft.TDirectory {
+		return nil, errors.New("root of a filesystem tree must be a directory")
+	}
+
+	root := &Root{
+		fs: &Filesystem{
+			dserv:    ds,
+			pins:     pins,
+			resolver: &path.Resolver{DAG: ds},
+		},
+		node:   nd,
+		update: update,
+	}
+	root.dir = NewDirectory("", nd.Copy(), root, root.fs)
+	return root, nil
+}
+
+// GetValue returns the top directory of the tree.
+func (r *Root) GetValue() *Directory {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.dir
+}
+
+// GetNode returns the current root node of the tree.
+func (r *Root) GetNode() *dag.Node {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.node
+}
+
+// closeChild implements the childCloser interface. It stores the new root
+// node and passes it on to the update function.
+func (r *Root) closeChild(name string, nd *dag.Node) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.setNode(nd)
+}
+
+// setNode records nd as the root node. If it can't be, the tree goes back
+// to the last root that was. r.lock must be held.
+func (r *Root) setNode(nd *dag.Node) error {
+	_, err := r.fs.dserv.Add(nd)
+	if err == nil && r.update != nil {
+		err = r.update(nd)
+	}
+	if err != nil {
+		r.dir = NewDirectory("", r.node.Copy(), r, r.fs)
+		return err
+	}
+	// the directories change their nodes in place
+	r.node = nd.Copy()
+	return nil
+}
+
+// ErrRootChanged is returned by Batch when the tree changed while the
+// batch ran.
+var ErrRootChanged = errors.New("the tree changed while the batch ran")
+
+// Batch runs f on a copy of the tree, then makes the result the tree in a
+// single update, so that a change of several steps is recorded whole or
+// not at all.
+func (r *Root) Batch(f func(dir *Directory) error) error {
+	r.lock.Lock()
+	base := r.node
+	r.lock.Unlock()
+
+	b := new(batchRoot)
+	if err := f(NewDirectory("", base.Copy(), b, r.fs)); err != nil {
+		return err
+	}
+	if b.node == nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.node != base {
+		return ErrRootChanged
+	}
+	if err := r.setNode(b.node); err != nil {
+		return err
+	}
+	r.dir = NewDirectory("", r.node.Copy(), r, r.fs)
+	return nil
+}
+
+// batchRoot is the root of the copy of a tree a batch changes. It keeps
+// the last root node, for the batch to record when done.
+type batchRoot struct {
+	node *dag.Node
+}
+
+func (b *batchRoot) closeChild(name string, nd *dag.Node) error {
+	b.node = nd
+	return nil
+}
+
+// Lookup returns the node at path p below the directory d. The path is
+// slash separated, and an empty path or "/" names d itself.
+func Lookup(d *Directory, p string) (FSNode, error) {
+	var cur FSNode = d
+	walked := ""
+	for _, name := range strings.Split(p, "/") {
+		if name == "" {
+			continue
+		}
+		dir, ok := cur.(*Directory)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a directory", walked)
+		}
+		walked += "/" + name
+
+		child, err := dir.Child(name)
+		if err != nil {
+			return nil, err
+		}
+		cur = child
+	}
+	return cur, nil
+}
@@ -0,0 +1,200 @@
+// package keystore stores the private keys a node holds besides its
+// identity, by name.
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+)
+
+// Keystore holds private keys by name.
+type Keystore interface {
+	// Has returns whether there is a key named name.
+	Has(name string) (bool, error)
+	// Put stores k under name, which mustn't be taken.
+	Put(name string, k ci.PrivKey) error
+	// Get returns the key named name, or ErrNoSuchKey.
+	Get(name string) (ci.PrivKey, error)
+	// Delete removes the key named name.
+	Delete(name string) error
+	// List returns the names of the keys, sorted.
+	List() ([]string, error)
+}
+
+var ErrNoSuchKey = errors.New("no key by the given name was found")
+var ErrKeyExists = errors.New("a key by that name already exists, refusing to overwrite")
+
+// validateName checks that name can name a key, and a file.
+func validateName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("key names must not be empty")
+	case strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("key names may not contain slashes: %q", name)
+	case strings.HasPrefix(name, "."):
+		return fmt.Errorf("key names may not start with a dot: %q", name)
+	}
+	return nil
+}
+
+// FSKeystore is a Keystore keeping each key in a file of its name, in
+// a directory only its owner may read.
+type FSKeystore struct {
+	dir string
+}
+
+var _ Keystore = (*FSKeystore)(nil)
+
+// NewFSKeystore returns the keystore in dir, making the directory if
+// there's none.
+func NewFSKeystore(dir string) (*FSKeystore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FSKeystore{dir: dir}, nil
+}
+
+func (ks *FSKeystore) Has(name string) (bool, error) {
+	if err := validateName(name); err != nil {
+		return false, err
+	}
+	_, err := os.Stat(filepath.Join(ks.dir, name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (ks *FSKeystore) Put(name string, k ci.PrivKey) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	b, err := ci.MarshalPrivateKey(k)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(ks.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if os.IsExist(err) {
+		return ErrKeyExists
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	return f.Close()
+}
+
+func (ks *FSKeystore) Get(name string) (ci.PrivKey, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(ks.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNoSuchKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ci.UnmarshalPrivateKey(b)
+}
+
+func (ks *FSKeystore) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(ks.dir, name))
+	if os.IsNotExist(err) {
+		return ErrNoSuchKey
+	}
+	return err
+}
+
+func (ks *FSKeystore) List() ([]string, error) {
+	fis, err := ioutil.ReadDir(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() && validateName(fi.Name()) == nil {
+			names = append(names, fi.Name())
+		}
+	}
+	return names, nil
+}
+
+// MemKeystore is a Keystore held in memory, for tests.
+type MemKeystore struct {
+	mu   sync.Mutex
+	keys map[string]ci.PrivKey
+}
+
+var _ Keystore = (*MemKeystore)(nil)
+
+func NewMemKeystore() *MemKeystore {
+	return &MemKeystore{keys: make(map[string]ci.PrivKey)}
+}
+
+func (ks *MemKeystore) Has(name string) (bool, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	_, ok := ks.keys[name]
+	return ok, nil
+}
+
+func (ks *MemKeystore) Put(name string, k ci.PrivKey) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if _, ok := ks.keys[name]; ok {
+		return ErrKeyExists
+	}
+	ks.keys[name] = k
+	return nil
+}
+
+func (ks *MemKeystore) Get(name string) (ci.PrivKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	k, ok := ks.keys[name]
+	if !ok {
+		return nil, ErrNoSuchKey
+	}
+	return k, nil
+}
+
+func (ks *MemKeystore) Delete(name string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if _, ok := ks.keys[name]; !ok {
+		return ErrNoSuchKey
+	}
+	delete(ks.keys, name)
+	return nil
+}
+
+func (ks *MemKeystore) List() ([]string, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	names := make([]string, 0, len(ks.keys))
+	for name := range ks.keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
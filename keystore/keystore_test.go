@@ -0,0 +1,83 @@
+package keystore
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+)
+
+func testKeystore(t *testing.T, ks Keystore) {
+	sk, _, err := ci.GenerateKeyPair(ci.RSA, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", "a/b", ".hidden"} {
+		if err := ks.Put(name, sk); err == nil {
+			t.Errorf("stored a key named %q", name)
+		}
+	}
+
+	if err := ks.Put("foo", sk); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("bar", sk); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("foo", sk); err != ErrKeyExists {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+
+	if has, err := ks.Has("foo"); err != nil || !has {
+		t.Fatalf("foo not found: %v", err)
+	}
+	got, err := ks.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equals(sk) {
+		t.Fatal("got another key than was stored")
+	}
+
+	names, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"bar", "foo"}) {
+		t.Fatalf("listed %v", names)
+	}
+
+	if err := ks.Delete("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := ks.Has("foo"); has {
+		t.Fatal("foo still there after Delete")
+	}
+	if _, err := ks.Get("foo"); err != ErrNoSuchKey {
+		t.Fatalf("expected ErrNoSuchKey, got %v", err)
+	}
+	if err := ks.Delete("foo"); err != ErrNoSuchKey {
+		t.Fatalf("expected ErrNoSuchKey, got %v", err)
+	}
+}
+
+func TestFSKeystore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks, err := NewFSKeystore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKeystore(t, ks)
+}
+
+func TestMemKeystore(t *testing.T) {
+	testKeystore(t, NewMemKeystore())
+}
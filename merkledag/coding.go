@@ -5,9 +5,10 @@ import (
 	"sort"
 
 	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
+	key "github.com/ipfs/go-ipfs/blocks/key"
 
 	pb "github.com/ipfs/go-ipfs/merkledag/internal/pb"
-	u "github.com/ipfs/go-ipfs/util"
 )
 
 // for now, we use a PBNode intermediate thing.
@@ -25,10 +26,11 @@ func (n *Node) Unmarshal(encoded []byte) error {
 	n.Links = make([]*Link, len(pbnl))
 	for i, l := range pbnl {
 		n.Links[i] = &Link{Name: l.GetName(), Size: l.GetTsize()}
-		h, err := mh.Cast(l.GetHash())
+		c, err := cid.Cast(key.Key(l.GetHash()))
 		if err != nil {
 			return fmt.Errorf("Link hash is not valid multihash. %v", err)
 		}
+		h := mh.Multihash(c.Key())
 		n.Links[i].Hash = h
 	}
 	sort.Stable(LinkSlice(n.Links)) // keep links sorted
@@ -80,11 +82,23 @@ func (n *Node) Encoded(force bool) ([]byte, error) {
 	sort.Stable(LinkSlice(n.Links)) // keep links sorted
 	if n.encoded == nil || force {
 		var err error
-		n.encoded, err = n.Marshal()
+		if n.IsRaw() {
+			if len(n.Links) > 0 {
+				return []byte{}, ErrRawLinks
+			}
+			n.encoded = n.Data
+		} else {
+			n.encoded, err = n.Marshal()
+			if err != nil {
+				return []byte{}, err
+			}
+		}
+		c, err := n.Prefix().Sum(n.encoded)
 		if err != nil {
+			n.encoded = nil
 			return []byte{}, err
 		}
-		n.cached = u.Hash(n.encoded)
+		n.cached = mh.Multihash(c.Key())
 	}
 
 	return n.encoded, nil
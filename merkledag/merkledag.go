@@ -7,6 +7,7 @@ import (
 
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	blocks "github.com/ipfs/go-ipfs/blocks"
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	bserv "github.com/ipfs/go-ipfs/blockservice"
 	u "github.com/ipfs/go-ipfs/util"
@@ -15,6 +16,9 @@ import (
 var log = u.Logger("merkledag")
 var ErrNotFound = fmt.Errorf("merkledag: not found")
 
+// ErrRawLinks is returned encoding a raw node with links.
+var ErrRawLinks = fmt.Errorf("merkledag: raw nodes have no links")
+
 // DAGService is an IPFS Merkle DAG service.
 type DAGService interface {
 	Add(*Node) (key.Key, error)
@@ -93,7 +97,32 @@ func (n *dagService) Get(ctx context.Context, k key.Key) (*Node, error) {
 		return nil, err
 	}
 
-	return Decoded(b.Data)
+	return decodeBlock(b)
+}
+
+// decodeBlock decodes the node in b, keyed as b is, so that it keeps its
+// key when stored again. Raw blocks decode to nodes holding their data.
+func decodeBlock(b *blocks.Block) (*Node, error) {
+	p, err := cid.PrefixOf(b.Key())
+	if err != nil {
+		return nil, err
+	}
+	var nd *Node
+	switch {
+	case p.Version == 1 && p.Codec == cid.Raw:
+		nd = &Node{Data: b.Data}
+	case p.Version == 1 && p.Codec != cid.DagProtobuf:
+		return nil, fmt.Errorf("merkledag: %s blocks are not merkledag nodes", cid.CodecNames[p.Codec])
+	default:
+		nd, err = Decoded(b.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p != cid.V0Prefix {
+		nd.SetPrefix(p)
+	}
+	return nd, nil
 }
 
 // Remove deletes the given node and all of its children from the BlockService
@@ -200,7 +229,7 @@ func (ds *dagService) GetNodes(ctx context.Context, keys []key.Key) []NodeGetter
 					return
 				}
 
-				nd, err := Decoded(blk.Data)
+				nd, err := decodeBlock(blk)
 				if err != nil {
 					// NB: can happen with improperly formatted input data
 					log.Debug("Got back bad block!")
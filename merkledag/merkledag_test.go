@@ -10,14 +10,18 @@ import (
 
 	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	bserv "github.com/ipfs/go-ipfs/blockservice"
 	bstest "github.com/ipfs/go-ipfs/blockservice/test"
 	offline "github.com/ipfs/go-ipfs/exchange/offline"
 	imp "github.com/ipfs/go-ipfs/importer"
+	bal "github.com/ipfs/go-ipfs/importer/balanced"
 	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	h "github.com/ipfs/go-ipfs/importer/helpers"
 	. "github.com/ipfs/go-ipfs/merkledag"
 	"github.com/ipfs/go-ipfs/pin"
 	uio "github.com/ipfs/go-ipfs/unixfs/io"
@@ -214,3 +218,116 @@ func runBatchFetchTest(t *testing.T, read io.Reader) {
 
 	wg.Wait()
 }
+
+func TestHashType(t *testing.T) {
+	var dagservs []DAGService
+	for _, bsi := range bstest.Mocks(t, 2) {
+		dagservs = append(dagservs, NewDAGService(bsi))
+	}
+
+	expected := make([]byte, 4096)
+	u.NewTimeSeededRand().Read(expected)
+	spl := &chunk.SizeSplitter{Size: 512}
+	dbp := h.DagBuilderParams{
+		Dagserv:  dagservs[0],
+		Maxlinks: 4,
+		HashType: u.SHA3_256,
+	}
+	root, err := bal.BalancedLayout(dbp.New(spl.Split(bytes.NewReader(expected))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := root.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range append([]key.Key{k}, linkKeys(root)...) {
+		if dh, err := mh.Decode(mh.Multihash(hash)); err != nil || dh.Code != u.SHA3_256 {
+			t.Fatalf("%s is not a sha3-256 hash", hash)
+		}
+	}
+
+	// fetched over bitswap, which keys the blocks it gets as they are sent
+	got, err := dagservs[1].Get(context.Background(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotk, err := got.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotk != k {
+		t.Fatalf("fetched node hashes to %s, not %s", gotk, k)
+	}
+
+	read, err := uio.NewDagReader(context.TODO(), got, dagservs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	datagot, err := ioutil.ReadAll(read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(datagot, expected) {
+		t.Fatal("Got bad data back!")
+	}
+}
+
+func TestCidNodes(t *testing.T) {
+	var dagservs []DAGService
+	for _, bsi := range bstest.Mocks(t, 2) {
+		dagservs = append(dagservs, NewDAGService(bsi))
+	}
+
+	leaf := &Node{Data: []byte("raw leaf")}
+	leaf.SetPrefix(cid.Prefix{Version: 1, Codec: cid.Raw, MhType: u.SHA3_256, MhLength: 32})
+	root := &Node{Data: []byte("root")}
+	root.SetPrefix(cid.Prefix{Version: 1, Codec: cid.DagProtobuf, MhType: mh.SHA2_256, MhLength: 32})
+	if err := root.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagservs[0].AddRecursive(root); err != nil {
+		t.Fatal(err)
+	}
+	k, err := root.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.B58String()[0] != 'z' {
+		t.Fatalf("%s is not a version 1 cid", k)
+	}
+
+	got, err := dagservs[1].Get(context.Background(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotk, _ := got.Key(); gotk != k {
+		t.Fatalf("fetched node keys to %s, not %s", gotk, k)
+	}
+	gotLeaf, err := got.Links[0].GetNode(context.Background(), dagservs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotLeaf.IsRaw() || string(gotLeaf.Data) != "raw leaf" {
+		t.Fatalf("expected the raw leaf back, got %q", gotLeaf.Data)
+	}
+	if gotk, _ := gotLeaf.Key(); string(gotk) != string(got.Links[0].Hash) {
+		t.Fatal("fetched raw leaf keys differently")
+	}
+
+	if err := gotLeaf.AddNodeLink("child", root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gotLeaf.Key(); err != ErrRawLinks {
+		t.Fatalf("expected ErrRawLinks, got %v", err)
+	}
+}
+
+func linkKeys(n *Node) []key.Key {
+	var ks []key.Key
+	for _, l := range n.Links {
+		ks = append(ks, key.Key(l.Hash))
+	}
+	return ks
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
 	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 )
 
@@ -19,6 +20,9 @@ type Node struct {
 	encoded []byte
 
 	cached mh.Multihash
+
+	// how the node is keyed, if not as cid.V0Prefix
+	prefix *cid.Prefix
 }
 
 // NodeStat is a statistics object for a Node. Mostly sizes.
@@ -43,7 +47,7 @@ type Link struct {
 	// cumulative size of target object
 	Size uint64
 
-	// multihash of the target object
+	// key of the target object: its multihash, or its version 1 cid
 	Hash mh.Multihash
 
 	// a ptr to the actual node for graph manipulation
@@ -161,6 +165,7 @@ func (n *Node) Copy() *Node {
 
 	nnode.Links = make([]*Link, len(n.Links))
 	copy(nnode.Links, n.Links)
+	nnode.prefix = n.prefix
 	return nnode
 }
 
@@ -210,6 +215,46 @@ func (n *Node) Stat() (*NodeStat, error) {
 	}, nil
 }
 
+// SetHashType sets the multihash function the node is hashed with, by its
+// code, keeping the cid version and codec it is keyed with. Nodes are
+// hashed with sha2-256 unless set otherwise.
+func (n *Node) SetHashType(code int) {
+	p := n.Prefix()
+	p.MhType = code
+	p.MhLength = -1
+	if l, ok := mh.DefaultLengths[code]; ok {
+		p.MhLength = l
+	}
+	n.SetPrefix(p)
+}
+
+// HashType returns the code of the multihash function the node is hashed
+// with.
+func (n *Node) HashType() int {
+	return n.Prefix().MhType
+}
+
+// SetPrefix sets how the node is keyed. Nodes of the cid.Raw codec are
+// keyed by their data alone, and have no links.
+func (n *Node) SetPrefix(p cid.Prefix) {
+	n.prefix = &p
+	n.encoded = nil
+	n.cached = nil
+}
+
+// Prefix returns how the node is keyed, cid.V0Prefix unless set otherwise.
+func (n *Node) Prefix() cid.Prefix {
+	if n.prefix == nil {
+		return cid.V0Prefix
+	}
+	return *n.prefix
+}
+
+// IsRaw returns whether n is a raw block rather than a merkledag node.
+func (n *Node) IsRaw() bool {
+	return n.prefix != nil && n.prefix.Version == 1 && n.prefix.Codec == cid.Raw
+}
+
 // Multihash hashes the encoded data of this node.
 func (n *Node) Multihash() (mh.Multihash, error) {
 	// Note: Encoded generates the hash and puts it in n.cached.
@@ -7,6 +7,7 @@ import (
 
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	mdag "github.com/ipfs/go-ipfs/merkledag"
 )
 
@@ -21,80 +22,185 @@ const (
 
 // Options specifies a series of traversal options
 type Options struct {
-	DAG     mdag.DAGService // the dagservice to fetch nodes
-	Order   Order           // what order to traverse in
-	Func    Func            // the function to perform at each step
-	ErrFunc ErrFunc         // see ErrFunc. Optional
+	DAG      mdag.DAGService // the dagservice to fetch nodes
+	Order    Order           // what order to traverse in
+	Func     Func            // the function to perform at each step. Optional
+	ErrFunc  ErrFunc         // see ErrFunc. Optional
+	LinkFunc LinkFunc        // see LinkFunc. Optional
 
 	SkipDuplicates bool // whether to skip duplicate nodes
+
+	// MaxDepth is how many links deep below the root to go, or 0 for no
+	// limit. The links of nodes at MaxDepth aren't followed.
+	MaxDepth int
+
+	// Concurrency is how many nodes are fetched at once: following a
+	// link fetches its node along with those of the next Concurrency-1
+	// links of the same node, or of all of them if it is -1. 0 or 1
+	// fetches nodes one at a time.
+	Concurrency int
+
+	// Ctx is what nodes are fetched with, context.TODO() if nil, and
+	// FetchTimeout, if not zero, how long to wait for each of them.
+	Ctx          context.Context
+	FetchTimeout time.Duration
 }
 
 // State is a current traversal state
 type State struct {
 	Node  *mdag.Node
 	Depth int
+
+	// Parent is the node Link, which led to Node, is from. Both are nil
+	// for the root.
+	Parent *mdag.Node
+	Link   *mdag.Link
 }
 
 type traversal struct {
 	opts Options
-	seen map[string]struct{}
+	ctx  context.Context
+	// seen holds the depth nodes were first met at
+	seen map[key.Key]int
 }
 
-func (t *traversal) shouldSkip(n *mdag.Node) (bool, error) {
-	if t.opts.SkipDuplicates {
-		k, err := n.Key()
-		if err != nil {
-			return true, err
-		}
-
-		if _, found := t.seen[string(k)]; found {
-			return true, nil
-		}
-		t.seen[string(k)] = struct{}{}
+// shouldSkip returns whether to skip the node k leads to, at depth. With
+// a MaxDepth, a node met again less deep than before is not skipped, as
+// its descendants may have been cut off the first time.
+func (t *traversal) shouldSkip(k key.Key, depth int) bool {
+	if !t.opts.SkipDuplicates {
+		return false
 	}
 
-	return false, nil
+	prev, found := t.seen[k]
+	if found && (t.opts.MaxDepth == 0 || prev <= depth) {
+		return true
+	}
+	t.seen[k] = depth
+	return false
 }
 
 func (t *traversal) callFunc(next State) error {
+	if t.opts.Func == nil {
+		return nil
+	}
 	return t.opts.Func(next)
 }
 
-// getNode returns the node for link. If it return an error,
-// stop processing. if it returns a nil node, just skip it.
-//
-// the error handling is a little complicated.
-func (t *traversal) getNode(link *mdag.Link) (*mdag.Node, error) {
-
-	getNode := func(l *mdag.Link) (*mdag.Node, error) {
-		ctx, cancel := context.WithTimeout(context.TODO(), time.Minute)
-		defer cancel()
-
-		next, err := l.GetNode(ctx, t.opts.DAG)
+// follow returns whether to follow the link l of curr.
+func (t *traversal) follow(curr State, l *mdag.Link) (bool, error) {
+	k := key.Key(l.Hash)
+	if l.Node != nil {
+		// the node at hand is what's visited, whatever the link says.
+		nk, err := l.Node.Key()
 		if err != nil {
-			return nil, err
+			return false, err
 		}
+		k = nk
+	}
+	if t.shouldSkip(k, curr.Depth+1) {
+		return false, nil
+	}
+	if t.opts.LinkFunc == nil {
+		return true, nil
+	}
+	return t.opts.LinkFunc(curr, l)
+}
 
-		skip, err := t.shouldSkip(next)
-		if skip {
-			next = nil
+// descends returns whether the links of curr are followed.
+func (t *traversal) descends(curr State) bool {
+	return t.opts.MaxDepth == 0 || curr.Depth < t.opts.MaxDepth
+}
+
+// children fetches the nodes the links of a node lead to, as the links
+// are followed.
+type children struct {
+	t       *traversal
+	links   []*mdag.Link
+	getters []mdag.NodeGetter
+
+	// ctx is what the nodes are fetched with, until done
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (t *traversal) children(n *mdag.Node) *children {
+	ctx, cancel := context.WithCancel(t.ctx)
+	return &children{
+		t:       t,
+		links:   n.Links,
+		getters: make([]mdag.NodeGetter, len(n.Links)),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// fetch starts fetching the node of link i, and those of the links after
+// it, up to Concurrency.
+func (c *children) fetch(i int) {
+	end := len(c.links)
+	switch n := c.t.opts.Concurrency; {
+	case n >= 0 && n <= 1:
+		end = i + 1
+	case n > 1 && i+n < end:
+		end = i + n
+	}
+
+	var keys []key.Key
+	var idx []int
+	for j := i; j < end; j++ {
+		if c.getters[j] == nil && c.links[j].Node == nil {
+			keys = append(keys, key.Key(c.links[j].Hash))
+			idx = append(idx, j)
 		}
-		return next, err
 	}
+	for n, g := range c.t.opts.DAG.GetNodes(c.ctx, keys) {
+		c.getters[idx[n]] = g
+	}
+}
 
-	next, err := getNode(link)
-	if err != nil && t.opts.ErrFunc != nil { // attempt recovery.
-		err = t.opts.ErrFunc(err)
+// getNode returns the node of link i. If it return an error, stop
+// processing. if it returns a nil node, just skip it.
+func (c *children) getNode(i int) (*mdag.Node, error) {
+	l := c.links[i]
+	if l.Node != nil {
+		return l.Node, nil
+	}
+
+	if c.getters[i] == nil {
+		c.fetch(i)
+	}
+	ctx := c.ctx
+	if c.t.opts.FetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.t.opts.FetchTimeout)
+		defer cancel()
+	}
+	next, err := c.getters[i].Get(ctx)
+	if err != nil && c.t.opts.ErrFunc != nil { // attempt recovery.
+		err = c.t.opts.ErrFunc(err)
 		next = nil // skip regardless
 	}
 	return next, err
 }
 
+// done gives up on the nodes fetched but not gotten.
+func (c *children) done() {
+	c.cancel()
+}
+
 // Func is the type of the function called for each dag.Node visited by Traverse.
 // The traversal argument contains the current traversal state.
 // If an error is returned, processing stops.
 type Func func(current State) error
 
+// LinkFunc is the type of the function called for each link Traverse is
+// about to follow, with the state of the node the link is from, before
+// the node it leads to is fetched. Links to nodes skipped as duplicates
+// aren't passed to it. It returns whether to follow the link; if it
+// returns an error, processing stops.
+type LinkFunc func(from State, l *mdag.Link) (bool, error)
+
 // If there is a problem walking to the Node, and ErrFunc is provided, Traverse
 // will call ErrFunc with the error encountered. ErrFunc can decide how to handle
 // that error, and return an error back to Traversal with how to proceed:
@@ -110,13 +216,24 @@ type ErrFunc func(err error) error
 func Traverse(root *mdag.Node, o Options) error {
 	t := traversal{
 		opts: o,
-		seen: map[string]struct{}{},
+		ctx:  o.Ctx,
+		seen: map[key.Key]int{},
+	}
+	if t.ctx == nil {
+		t.ctx = context.TODO()
 	}
 
 	state := State{
 		Node:  root,
 		Depth: 0,
 	}
+	if o.SkipDuplicates {
+		k, err := root.Key()
+		if err != nil {
+			return err
+		}
+		t.seen[k] = 0
+	}
 
 	switch o.Order {
 	default:
@@ -153,8 +270,22 @@ func dfsPostTraverse(state State, t *traversal) error {
 }
 
 func dfsDescend(df dfsFunc, curr State, t *traversal) error {
-	for _, l := range curr.Node.Links {
-		node, err := t.getNode(l)
+	if !t.descends(curr) {
+		return nil
+	}
+
+	c := t.children(curr.Node)
+	defer c.done()
+	for i, l := range curr.Node.Links {
+		ok, err := t.follow(curr, l)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		node, err := c.getNode(i)
 		if err != nil {
 			return err
 		}
@@ -163,8 +294,10 @@ func dfsDescend(df dfsFunc, curr State, t *traversal) error {
 		}
 
 		next := State{
-			Node:  node,
-			Depth: curr.Depth + 1,
+			Node:   node,
+			Depth:  curr.Depth + 1,
+			Parent: curr.Node,
+			Link:   l,
 		}
 		if err := df(next, t); err != nil {
 			return err
@@ -174,11 +307,6 @@ func dfsDescend(df dfsFunc, curr State, t *traversal) error {
 }
 
 func bfsTraverse(root State, t *traversal) error {
-
-	if skip, err := t.shouldSkip(root.Node); skip || err != nil {
-		return err
-	}
-
 	var q queue
 	q.enq(root)
 	for q.len() > 0 {
@@ -192,20 +320,43 @@ func bfsTraverse(root State, t *traversal) error {
 			return err
 		}
 
-		for _, l := range curr.Node.Links {
-			node, err := t.getNode(l)
-			if err != nil {
-				return err
-			}
-			if node == nil { // skip
-				continue
-			}
+		if err := bfsEnqueue(curr, &q, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bfsEnqueue(curr State, q *queue, t *traversal) error {
+	if !t.descends(curr) {
+		return nil
+	}
+
+	c := t.children(curr.Node)
+	defer c.done()
+	for i, l := range curr.Node.Links {
+		ok, err := t.follow(curr, l)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
 
-			q.enq(State{
-				Node:  node,
-				Depth: curr.Depth + 1,
-			})
+		node, err := c.getNode(i)
+		if err != nil {
+			return err
 		}
+		if node == nil { // skip
+			continue
+		}
+
+		q.enq(State{
+			Node:   node,
+			Depth:  curr.Depth + 1,
+			Parent: curr.Node,
+			Link:   l,
+		})
 	}
 	return nil
 }
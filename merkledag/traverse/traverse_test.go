@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	mdag "github.com/ipfs/go-ipfs/merkledag"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
 )
 
 func TestDFSPreNoSkip(t *testing.T) {
@@ -314,6 +315,116 @@ func TestBFSSkip(t *testing.T) {
 `))
 }
 
+func TestMaxDepth(t *testing.T) {
+	testWalkOutputs(t, newLinkedList(t), Options{Order: DFSPre, MaxDepth: 2}, []byte(`
+0 /a
+1 /a/aa
+2 /a/aa/aaa
+`))
+
+	testWalkOutputs(t, newBinaryTree(t), Options{Order: BFS, MaxDepth: 1}, []byte(`
+0 /a
+1 /a/aa
+1 /a/ab
+`))
+
+	// x is met at the depth limit first, and again above it, where its
+	// child is within reach.
+	y := &mdag.Node{Data: []byte("y")}
+	x := &mdag.Node{Data: []byte("x")}
+	b := &mdag.Node{Data: []byte("b")}
+	a := &mdag.Node{Data: []byte("a")}
+	addLink(t, x, y)
+	addLink(t, b, x)
+	addLink(t, a, b)
+	addLink(t, a, x)
+	testWalkOutputs(t, a, Options{Order: DFSPre, MaxDepth: 2, SkipDuplicates: true}, []byte(`
+0 a
+1 b
+2 x
+1 x
+2 y
+`))
+}
+
+func TestLinkFunc(t *testing.T) {
+	var links []string
+	opts := Options{
+		Order: DFSPre,
+		LinkFunc: func(from State, l *mdag.Link) (bool, error) {
+			links = append(links, l.Name)
+			// don't go below /a/ab
+			return string(from.Node.Data) != "/a/ab", nil
+		},
+	}
+	testWalkOutputs(t, newBinaryTree(t), opts, []byte(`
+0 /a
+1 /a/aa
+2 /a/aa/aaa
+2 /a/aa/aab
+1 /a/ab
+`))
+	expected := "/a2/a/aa /a/aa2/a/aa/aaa /a/aa2/a/aa/aab /a2/a/ab /a/ab2/a/ab/aba /a/ab2/a/ab/abb"
+	if got := fmt.Sprint(links); got != "["+expected+"]" {
+		t.Errorf("links passed to LinkFunc: %s", got)
+	}
+
+	opts = Options{
+		Order: BFS,
+		Func: func(s State) error {
+			// addLink names links after the nodes at both ends
+			if s.Depth > 0 && s.Link.Name != string(s.Parent.Data)+"2"+string(s.Node.Data) {
+				t.Errorf("%s: wrong parent or link: %s", s.Node.Data, s.Link.Name)
+			}
+			return nil
+		},
+	}
+	if err := Traverse(newBinaryTree(t), opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	ds := mdtest.Mock(t)
+	store := func(data string, children ...*mdag.Node) *mdag.Node {
+		n := &mdag.Node{Data: []byte(data)}
+		for _, c := range children {
+			if err := n.AddNodeLinkClean(string(c.Data), c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := ds.Add(n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	root := store("/a",
+		store("/a/aa", store("/a/aa/aaa"), store("/a/aa/aab")),
+		store("/a/ab", store("/a/ab/aba"), store("/a/ab/abb")),
+	)
+
+	for _, c := range []int{0, 1, 2, -1} {
+		testWalkOutputs(t, root, Options{DAG: ds, Order: DFSPre, Concurrency: c}, []byte(`
+0 /a
+1 /a/aa
+2 /a/aa/aaa
+2 /a/aa/aab
+1 /a/ab
+2 /a/ab/aba
+2 /a/ab/abb
+`))
+		testWalkOutputs(t, root, Options{DAG: ds, Order: BFS, Concurrency: c}, []byte(`
+0 /a
+1 /a/aa
+1 /a/ab
+2 /a/aa/aaa
+2 /a/aa/aab
+2 /a/ab/aba
+2 /a/ab/abb
+`))
+	}
+}
+
 func testWalkOutputs(t *testing.T, root *mdag.Node, opts Options, expect []byte) {
 	expect = bytes.TrimLeft(expect, "\n")
 
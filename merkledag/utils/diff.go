@@ -0,0 +1,216 @@
+// package dagutils implements utilities working on whole merkledags.
+package dagutils
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+	ftpb "github.com/ipfs/go-ipfs/unixfs/pb"
+)
+
+type ChangeType int
+
+const (
+	Add ChangeType = iota
+	Remove
+	Mod
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Add:
+		return "add"
+	case Remove:
+		return "remove"
+	case Mod:
+		return "mod"
+	}
+	return fmt.Sprintf("ChangeType(%d)", int(t))
+}
+
+// Change is one difference between two DAGs: an object added, removed,
+// or changed at Path, the names leading to it from the roots, separated
+// by slashes, or "" for the roots themselves.
+type Change struct {
+	Type ChangeType
+	Path string
+
+	// the object before and after the change; Before is empty for an
+	// Add, and After for a Remove
+	Before key.Key
+	After  key.Key
+
+	// File is set if the objects are unixfs files, which were SizeBefore
+	// and are SizeAfter bytes long
+	File       bool
+	SizeBefore uint64
+	SizeAfter  uint64
+}
+
+func (c *Change) String() string {
+	p := c.Path
+	if p == "" {
+		p = "/"
+	}
+	switch c.Type {
+	case Add:
+		return fmt.Sprintf("added %s %s", p, c.After)
+	case Remove:
+		return fmt.Sprintf("removed %s %s", p, c.Before)
+	}
+	return fmt.Sprintf("changed %s %s -> %s", p, c.Before, c.After)
+}
+
+// Diff returns the changes that turn the DAG rooted at a into the one
+// rooted at b, in the order of their paths. The entries of unixfs
+// directories, sharded or not, are compared by name, and those that
+// changed which are directories on both sides are compared in turn.
+// Anything else that changed is one change.
+func Diff(ctx context.Context, ds dag.DAGService, a, b *dag.Node) ([]*Change, error) {
+	var changes []*Change
+	if err := diff(ctx, ds, "", a, b, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func diff(ctx context.Context, ds dag.DAGService, p string, a, b *dag.Node, changes *[]*Change) error {
+	ka, err := a.Key()
+	if err != nil {
+		return err
+	}
+	kb, err := b.Key()
+	if err != nil {
+		return err
+	}
+	if ka == kb {
+		return nil
+	}
+
+	if !uio.IsDir(a) || !uio.IsDir(b) {
+		c := &Change{Type: Mod, Path: p, Before: ka, After: kb}
+		sa, oka := fileSize(a)
+		sb, okb := fileSize(b)
+		if oka && okb {
+			c.File, c.SizeBefore, c.SizeAfter = true, sa, sb
+		}
+		*changes = append(*changes, c)
+		return nil
+	}
+
+	la, err := entries(ctx, ds, a)
+	if err != nil {
+		return err
+	}
+	lb, err := entries(ctx, ds, b)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(la)+len(lb))
+	for name := range la {
+		names = append(names, name)
+	}
+	for name := range lb {
+		if _, ok := la[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	before := len(*changes)
+	for _, name := range names {
+		cp := path.Join(p, name)
+		ea, eb := la[name], lb[name]
+		switch {
+		case eb == nil:
+			c, err := entryChange(ctx, ds, Remove, cp, ea)
+			if err != nil {
+				return err
+			}
+			*changes = append(*changes, c)
+		case ea == nil:
+			c, err := entryChange(ctx, ds, Add, cp, eb)
+			if err != nil {
+				return err
+			}
+			*changes = append(*changes, c)
+		case string(ea.Hash) != string(eb.Hash):
+			na, err := ea.GetNode(ctx, ds)
+			if err != nil {
+				return err
+			}
+			nb, err := eb.GetNode(ctx, ds)
+			if err != nil {
+				return err
+			}
+			if err := diff(ctx, ds, cp, na, nb, changes); err != nil {
+				return err
+			}
+		}
+	}
+	if len(*changes) == before {
+		// the same entries, in a directory that changed otherwise, such as
+		// its metadata, or how it's sharded
+		*changes = append(*changes, &Change{Type: Mod, Path: p, Before: ka, After: kb})
+	}
+	return nil
+}
+
+// entries returns the entries of the directory nd, by name.
+func entries(ctx context.Context, ds dag.DAGService, nd *dag.Node) (map[string]*dag.Link, error) {
+	links, err := uio.DirLinks(ctx, nd, ds)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]*dag.Link, len(links))
+	for _, l := range links {
+		m[l.Name] = l
+	}
+	return m, nil
+}
+
+// entryChange returns the change of the entry l added or removed at p.
+func entryChange(ctx context.Context, ds dag.DAGService, t ChangeType, p string, l *dag.Link) (*Change, error) {
+	c := &Change{Type: t, Path: p}
+	k := key.Key(l.Hash)
+	if t == Add {
+		c.After = k
+	} else {
+		c.Before = k
+	}
+
+	nd, err := l.GetNode(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+	if size, ok := fileSize(nd); ok {
+		c.File = true
+		if t == Add {
+			c.SizeAfter = size
+		} else {
+			c.SizeBefore = size
+		}
+	}
+	return c, nil
+}
+
+// fileSize returns the size of nd, if it's a unixfs file.
+func fileSize(nd *dag.Node) (uint64, bool) {
+	pbd, err := ft.FromBytes(nd.Data)
+	if err != nil {
+		return 0, false
+	}
+	switch pbd.GetType() {
+	case ftpb.Data_File, ftpb.Data_Raw:
+		size, err := ft.DataSize(nd.Data)
+		return size, err == nil
+	}
+	return 0, false
+}
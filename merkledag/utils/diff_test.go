@@ -0,0 +1,101 @@
+package dagutils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	imp "github.com/ipfs/go-ipfs/importer"
+	"github.com/ipfs/go-ipfs/importer/chunk"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+)
+
+func addFile(t *testing.T, ds dag.DAGService, data string) *dag.Node {
+	nd, err := imp.BuildDagFromReader(bytes.NewReader([]byte(data)), ds, chunk.DefaultSplitter, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func addDir(t *testing.T, ds dag.DAGService, entries map[string]*dag.Node) *dag.Node {
+	dir := &dag.Node{Data: ft.FolderPBData()}
+	for name, nd := range entries {
+		if err := dir.AddNodeLink(name, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ds.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func mustKey(t *testing.T, nd *dag.Node) key.Key {
+	k, err := nd.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestDiff(t *testing.T) {
+	ds := mdtest.Mock(t)
+	same := addFile(t, ds, "unchanged")
+	before := addFile(t, ds, "hello")
+	after := addFile(t, ds, "hello, world")
+	gone := addFile(t, ds, "gone")
+	added := addFile(t, ds, "added")
+	subdir := addDir(t, ds, map[string]*dag.Node{"x": same})
+
+	a := addDir(t, ds, map[string]*dag.Node{
+		"same":   same,
+		"gone":   gone,
+		"change": before,
+		"sub":    addDir(t, ds, map[string]*dag.Node{"f": before, "g": same}),
+	})
+	b := addDir(t, ds, map[string]*dag.Node{
+		"same":   same,
+		"new":    added,
+		"newdir": subdir,
+		"change": after,
+		"sub":    addDir(t, ds, map[string]*dag.Node{"f": after, "g": same}),
+	})
+
+	changes, err := Diff(context.Background(), ds, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{Type: Mod, Path: "change", Before: mustKey(t, before), After: mustKey(t, after), File: true, SizeBefore: 5, SizeAfter: 12},
+		{Type: Remove, Path: "gone", Before: mustKey(t, gone), File: true, SizeBefore: 4},
+		{Type: Add, Path: "new", After: mustKey(t, added), File: true, SizeAfter: 5},
+		{Type: Add, Path: "newdir", After: mustKey(t, subdir)},
+		{Type: Mod, Path: "sub/f", Before: mustKey(t, before), After: mustKey(t, after), File: true, SizeBefore: 5, SizeAfter: 12},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %d: %v", len(expected), len(changes), changes)
+	}
+	for i, c := range changes {
+		if *c != expected[i] {
+			t.Errorf("expected %#v, got %#v", expected[i], *c)
+		}
+	}
+
+	if changes, err := Diff(context.Background(), ds, a, a); err != nil || len(changes) != 0 {
+		t.Fatalf("expected no changes from a DAG to itself, got %v, %v", changes, err)
+	}
+
+	// a file replaced by a directory is changed as a whole
+	changes, err = Diff(context.Background(), ds, before, subdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Path != "" || changes[0].Type != Mod || changes[0].File {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+}
@@ -1,9 +1,11 @@
 package metrics
 
 import (
-	gm "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/whyrusleeping/go-metrics"
+	"strings"
 	"sync"
 
+	gm "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/whyrusleeping/go-metrics"
+
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
 )
@@ -79,6 +81,62 @@ func (bwc *BandwidthCounter) GetBandwidthForProtocol(proto protocol.ID) (out Sta
 	}
 }
 
+// GetBandwidthByPeer returns the bandwidth of every peer streams were
+// opened with.
+func (bwc *BandwidthCounter) GetBandwidthByPeer() map[peer.ID]Stats {
+	out := make(map[peer.ID]Stats)
+	for k, st := range bwc.statsByPrefix("/peer/") {
+		out[peer.ID(k)] = st
+	}
+	return out
+}
+
+// GetBandwidthByProtocol returns the bandwidth of every protocol streams
+// were opened for.
+func (bwc *BandwidthCounter) GetBandwidthByProtocol() map[protocol.ID]Stats {
+	out := make(map[protocol.ID]Stats)
+	for k, st := range bwc.statsByPrefix("/proto/") {
+		out[protocol.ID(k)] = st
+	}
+	return out
+}
+
+// statsByPrefix gathers the in and out meters registered under prefix into
+// the Stats of each key.
+func (bwc *BandwidthCounter) statsByPrefix(prefix string) map[string]Stats {
+	out := make(map[string]Stats)
+	bwc.reg.Each(func(name string, v interface{}) {
+		m, ok := v.(gm.Meter)
+		if !ok || !strings.HasPrefix(name, prefix) {
+			return
+		}
+		name = name[len(prefix):]
+
+		var in bool
+		switch {
+		case strings.HasPrefix(name, "in/"):
+			in = true
+			name = name[len("in/"):]
+		case strings.HasPrefix(name, "out/"):
+			name = name[len("out/"):]
+		default:
+			return
+		}
+
+		snap := m.Snapshot()
+		st := out[name]
+		if in {
+			st.TotalIn = snap.Count()
+			st.RateIn = snap.RateFine()
+		} else {
+			st.TotalOut = snap.Count()
+			st.RateOut = snap.RateFine()
+		}
+		out[name] = st
+	})
+	return out
+}
+
 func (bwc *BandwidthCounter) GetBandwidthTotals() (out Stats) {
 	return Stats{
 		TotalIn:  bwc.totalIn.Count(),
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"testing"
+
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
+)
+
+func TestBandwidthByPeerAndProtocol(t *testing.T) {
+	bwc := NewBandwidthCounter()
+
+	bwc.LogSentMessageStream(100, protocol.ID("/a"), peer.ID("peerA"))
+	bwc.LogRecvMessageStream(30, protocol.ID("/a"), peer.ID("peerB"))
+	bwc.LogSentMessageStream(5, protocol.ID("/b"), peer.ID("peerB"))
+
+	byPeer := bwc.GetBandwidthByPeer()
+	if len(byPeer) != 2 {
+		t.Fatalf("expected 2 peers, got %d", len(byPeer))
+	}
+	if st := byPeer[peer.ID("peerA")]; st.TotalOut != 100 || st.TotalIn != 0 {
+		t.Fatal("wrong stats for peerA", st)
+	}
+	if st := byPeer[peer.ID("peerB")]; st.TotalOut != 5 || st.TotalIn != 30 {
+		t.Fatal("wrong stats for peerB", st)
+	}
+
+	byProto := bwc.GetBandwidthByProtocol()
+	if len(byProto) != 2 {
+		t.Fatalf("expected 2 protocols, got %d", len(byProto))
+	}
+	if st := byProto[protocol.ID("/a")]; st.TotalOut != 100 || st.TotalIn != 30 {
+		t.Fatal("wrong stats for /a", st)
+	}
+	if st := byProto[protocol.ID("/b")]; st.TotalOut != 5 || st.TotalIn != 0 {
+		t.Fatal("wrong stats for /b", st)
+	}
+}
@@ -52,3 +52,18 @@ func resolve(ctx context.Context, r resolver, name string, depth int, prefixes .
 		}
 	}
 }
+
+type noCacheKey struct{}
+
+// WithoutCache returns a context under which names are resolved without
+// the values cached for them, which are refreshed with what's found
+// instead.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// usesCache returns whether names may be resolved from the cache, under
+// ctx.
+func usesCache(ctx context.Context) bool {
+	return ctx.Value(noCacheKey{}) == nil
+}
@@ -43,18 +43,31 @@ func (r *DNSResolver) ResolveN(ctx context.Context, name string, depth int) (pat
 
 // resolveOnce implements resolver.
 // TXT records for a given domain name should contain a b58
-// encoded multihash.
+// encoded multihash, or a dnslink. Those of _dnslink.<name> are looked up
+// first, and those of the domain itself only if none of them parses, so
+// the dnslink can live apart from the other TXT records of the domain.
 func (r *DNSResolver) resolveOnce(ctx context.Context, name string) (path.Path, error) {
 	if !isd.IsDomain(name) {
 		return "", errors.New("not a valid domain name")
 	}
 
 	log.Infof("DNSResolver resolving %s", name)
+	if txt, err := r.lookupTXT(DNSLinkSubdomain + "." + name); err == nil {
+		if p, err := parseEntries(txt); err == nil {
+			return p, nil
+		}
+	}
+
 	txt, err := r.lookupTXT(name)
 	if err != nil {
 		return "", err
 	}
+	return parseEntries(txt)
+}
 
+// parseEntries returns the path of the first of the TXT records txt which
+// parses.
+func parseEntries(txt []string) (path.Path, error) {
 	for _, t := range txt {
 		p, err := parseEntry(t)
 		if err == nil {
@@ -86,6 +86,27 @@ func newMockDNS() *mockDNS {
 			"bad.example.com": []string{
 				"dnslink=",
 			},
+			"_dnslink.sub.example.com": []string{
+				"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD",
+			},
+			"sub.example.com": []string{
+				"v=spf1 -all",
+			},
+			"_dnslink.both.example.com": []string{
+				"dnslink=/ipns/sub.example.com",
+			},
+			"both.example.com": []string{
+				"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD/masked",
+			},
+			"_dnslink.fallback.example.com": []string{
+				"not a dnslink",
+			},
+			"fallback.example.com": []string{
+				"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD",
+			},
+			"_dnslink.key.example.com": []string{
+				"dnslink=/ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n",
+			},
 		},
 	}
 }
@@ -109,4 +130,22 @@ func TestDNSResolution(t *testing.T) {
 	testResolution(t, r, "loop1.example.com", 3, "/ipns/loop2.example.com", ErrResolveRecursion)
 	testResolution(t, r, "loop1.example.com", DefaultDepthLimit, "/ipns/loop1.example.com", ErrResolveRecursion)
 	testResolution(t, r, "bad.example.com", DefaultDepthLimit, "", ErrResolveFailed)
+	testResolution(t, r, "sub.example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	testResolution(t, r, "both.example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+	testResolution(t, r, "both.example.com", 1, "/ipns/sub.example.com", ErrResolveRecursion)
+	testResolution(t, r, "fallback.example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
+}
+
+func TestDNSLinkToIpnsResolution(t *testing.T) {
+	r := &mpns{
+		resolvers: map[string]resolver{
+			"dns": &DNSResolver{lookupTXT: newMockDNS().lookupTXT},
+			"one": mockResolverOne(),
+		},
+	}
+
+	testResolution(t, r, "/ipns/key.example.com", DefaultDepthLimit, "/ipfs/Qmcqtw8FfrVSBaRmbWwHxt3AuySBhJLcvmFYi3Lbc4xnwj", nil)
+	testResolution(t, r, "/ipns/key.example.com", 1, "/ipns/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n", ErrResolveRecursion)
+	testResolution(t, r, "/ipns/key.example.com", 2, "/ipns/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy", ErrResolveRecursion)
+	testResolution(t, r, "/ipns/dns2.example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
 }
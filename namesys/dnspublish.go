@@ -0,0 +1,153 @@
+package namesys
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	isd "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-is-domain"
+	dns "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/miekg/dns"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+// DNSLinkSubdomain is the label under which DNSLink TXT records are
+// published, so that they don't collide with other TXT records on the
+// domain itself.
+const DNSLinkSubdomain = "_dnslink"
+
+// DefaultDNSLinkTTL is the TTL, in seconds, of published DNSLink records
+// when none is configured.
+const DefaultDNSLinkTTL = 60
+
+// DNSLinkUpdateTimeout is the longest an update is waited for, less if
+// the context given is done sooner.
+const DNSLinkUpdateTimeout = 10 * time.Second
+
+// DNSLinkPublisher is an object capable of pointing a domain's DNSLink
+// record at a new path.
+type DNSLinkPublisher interface {
+	PublishDNSLink(ctx context.Context, domain string, value path.Path) error
+}
+
+// TSIGKey holds the credentials used to sign dynamic DNS updates.
+type TSIGKey struct {
+	Name      string
+	Secret    string // base64
+	Algorithm string // e.g. "hmac-sha256"; defaults to hmac-sha256
+}
+
+type exchangeFunc func(m *dns.Msg, server string, timeout time.Duration) (*dns.Msg, error)
+
+// rfc2136Publisher publishes DNSLink records using RFC 2136 dynamic
+// updates sent to an authoritative server.
+type rfc2136Publisher struct {
+	server   string
+	zone     string
+	ttl      uint32
+	tsig     *TSIGKey
+	exchange exchangeFunc
+}
+
+// NewRFC2136Publisher constructs a DNSLinkPublisher that sends dynamic
+// updates for zone to server (host:port). tsig may be nil to send
+// unsigned updates.
+func NewRFC2136Publisher(server, zone string, ttl uint32, tsig *TSIGKey) DNSLinkPublisher {
+	if ttl == 0 {
+		ttl = DefaultDNSLinkTTL
+	}
+	p := &rfc2136Publisher{
+		server: server,
+		zone:   dns.Fqdn(zone),
+		ttl:    ttl,
+		tsig:   tsig,
+	}
+	p.exchange = p.send
+	return p
+}
+
+// PublishDNSLink implements DNSLinkPublisher. It replaces the TXT records
+// at _dnslink.<domain> with a single "dnslink=<value>" record.
+func (p *rfc2136Publisher) PublishDNSLink(ctx context.Context, domain string, value path.Path) error {
+	domain = strings.TrimSuffix(domain, ".")
+	if !isd.IsDomain(domain) {
+		return errors.New("not a valid domain name")
+	}
+	if err := value.IsValid(); err != nil {
+		return err
+	}
+
+	name := dns.Fqdn(DNSLinkSubdomain + "." + domain)
+	if !dns.IsSubDomain(p.zone, name) {
+		return fmt.Errorf("%s is not in zone %s", name, p.zone)
+	}
+
+	m := dnsLinkUpdate(p.zone, name, p.ttl, value)
+	if p.tsig != nil {
+		algo := p.tsig.Algorithm
+		if algo == "" {
+			algo = dns.HmacSHA256
+		}
+		m.SetTsig(dns.Fqdn(p.tsig.Name), dns.Fqdn(algo), 300, time.Now().Unix())
+	}
+
+	timeout := DNSLinkUpdateTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := deadline.Sub(time.Now()); left < timeout {
+			timeout = left
+		}
+	}
+	if timeout <= 0 {
+		return context.DeadlineExceeded
+	}
+
+	log.Infof("DNSLink publishing %s -> %s via %s", name, value, p.server)
+	r, err := p.exchange(m, p.server, timeout)
+	if err != nil {
+		return err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("dns update of %s refused: %s", name, dns.RcodeToString[r.Rcode])
+	}
+	return nil
+}
+
+func (p *rfc2136Publisher) send(m *dns.Msg, server string, timeout time.Duration) (*dns.Msg, error) {
+	c := &dns.Client{
+		Net:          "tcp",
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	}
+	if p.tsig != nil {
+		c.TsigSecret = map[string]string{dns.Fqdn(p.tsig.Name): p.tsig.Secret}
+	}
+	r, _, err := c.Exchange(m, server)
+	return r, err
+}
+
+// dnsLinkUpdate builds an update message that atomically replaces the TXT
+// RRset at name with a dnslink entry for value.
+func dnsLinkUpdate(zone, name string, ttl uint32, value path.Path) *dns.Msg {
+	rr := &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Txt: []string{"dnslink=" + value.String()},
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(zone)
+	// RemoveRRset and Insert each overwrite the update section, so
+	// combine them by hand.
+	m.RemoveRRset([]dns.RR{rr})
+	remove := m.Ns
+	m.Insert([]dns.RR{rr})
+	m.Ns = append(remove, m.Ns...)
+	return m
+}
@@ -0,0 +1,104 @@
+package namesys
+
+import (
+	"testing"
+	"time"
+
+	dns "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/miekg/dns"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+func TestPublishDNSLinkUpdate(t *testing.T) {
+	var sent *dns.Msg
+	pub := NewRFC2136Publisher("127.0.0.1:53", "example.com", 0, nil).(*rfc2136Publisher)
+	pub.exchange = func(m *dns.Msg, server string, timeout time.Duration) (*dns.Msg, error) {
+		sent = m
+		r := new(dns.Msg)
+		r.SetReply(m)
+		return r, nil
+	}
+
+	p := path.FromString("/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD")
+	if err := pub.PublishDNSLink(context.Background(), "www.example.com", p); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent.Question[0].Name != "example.com." {
+		t.Fatalf("update sent for wrong zone %q", sent.Question[0].Name)
+	}
+	if len(sent.Ns) != 2 {
+		t.Fatalf("expected a delete and an insert, got %d records", len(sent.Ns))
+	}
+	if sent.Ns[0].Header().Class != dns.ClassANY {
+		t.Fatal("first record should delete the existing RRset")
+	}
+	txt, ok := sent.Ns[1].(*dns.TXT)
+	if !ok {
+		t.Fatalf("second record should be TXT, got %T", sent.Ns[1])
+	}
+	if txt.Hdr.Name != "_dnslink.www.example.com." {
+		t.Fatalf("record published at wrong name %q", txt.Hdr.Name)
+	}
+	if txt.Txt[0] != "dnslink="+p.String() || txt.Hdr.Ttl != DefaultDNSLinkTTL {
+		t.Fatalf("unexpected record: %s", txt)
+	}
+}
+
+func TestPublishDNSLinkErrors(t *testing.T) {
+	pub := NewRFC2136Publisher("127.0.0.1:53", "example.com.", 60, nil).(*rfc2136Publisher)
+	pub.exchange = func(m *dns.Msg, server string, timeout time.Duration) (*dns.Msg, error) {
+		r := new(dns.Msg)
+		r.SetRcode(m, dns.RcodeRefused)
+		return r, nil
+	}
+
+	ctx := context.Background()
+	p := path.FromString("/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD")
+	if err := pub.PublishDNSLink(ctx, "example.org", p); err == nil {
+		t.Fatal("should refuse domains outside the zone")
+	}
+	if err := pub.PublishDNSLink(ctx, "example.com", path.FromString("/foo")); err == nil {
+		t.Fatal("should refuse invalid paths")
+	}
+	if err := pub.PublishDNSLink(ctx, "example.com", p); err == nil {
+		t.Fatal("should surface a refused update")
+	}
+}
+
+func TestPublishDNSLinkTimeout(t *testing.T) {
+	var timeouts []time.Duration
+	pub := NewRFC2136Publisher("127.0.0.1:53", "example.com.", 60, nil).(*rfc2136Publisher)
+	pub.exchange = func(m *dns.Msg, server string, timeout time.Duration) (*dns.Msg, error) {
+		timeouts = append(timeouts, timeout)
+		r := new(dns.Msg)
+		r.SetReply(m)
+		return r, nil
+	}
+	p := path.FromString("/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	if err := pub.PublishDNSLink(ctx, "example.com", p); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := pub.PublishDNSLink(ctx, "example.com", p); err != nil {
+		t.Fatal(err)
+	}
+	if len(timeouts) != 2 || timeouts[0] != DNSLinkUpdateTimeout || timeouts[1] > time.Second || timeouts[1] <= 0 {
+		t.Fatalf("expected the timeouts clamped to the deadlines, got %v", timeouts)
+	}
+
+	// with the deadline gone, nothing is sent
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if err := pub.PublishDNSLink(ctx, "example.com", p); err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+	if len(timeouts) != 2 {
+		t.Fatal("expected no update sent past the deadline")
+	}
+}
@@ -0,0 +1,69 @@
+package namesys
+
+import (
+	"fmt"
+	"time"
+
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+
+	pb "github.com/ipfs/go-ipfs/namesys/internal/pb"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// RecordInfo is a decoded, human-readable view of a marshaled IPNS record.
+type RecordInfo struct {
+	Value        string
+	ValidityType string
+	Validity     time.Time
+	Sequence     uint64
+	TTL          time.Duration
+	Expired      bool
+}
+
+// InspectRecord decodes a marshaled IPNS record without verifying it.
+// A record whose validity cannot be parsed is still returned, together
+// with the parse error, so callers can show what they have.
+func InspectRecord(data []byte) (*RecordInfo, error) {
+	entry := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+
+	info := &RecordInfo{
+		Value:        string(entry.GetValue()),
+		ValidityType: entry.GetValidityType().String(),
+		Sequence:     entry.GetSequence(),
+		TTL:          time.Duration(entry.GetTtl()),
+	}
+
+	switch entry.GetValidityType() {
+	case pb.IpnsEntry_EOL:
+		t, err := u.ParseRFC3339(string(entry.GetValidity()))
+		if err != nil {
+			return info, err
+		}
+		info.Validity = t
+		info.Expired = time.Now().After(t)
+	default:
+		return info, ErrUnrecognizedValidity
+	}
+	return info, nil
+}
+
+// VerifyRecord checks that the marshaled IPNS record in data was signed by
+// the private key corresponding to pk.
+func VerifyRecord(pk ci.PubKey, data []byte) error {
+	entry := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(data, entry); err != nil {
+		return err
+	}
+	return verifyEntry(pk, entry)
+}
+
+func verifyEntry(pk ci.PubKey, entry *pb.IpnsEntry) error {
+	if ok, err := pk.Verify(ipnsEntryDataForSig(entry), entry.GetSignature()); err != nil || !ok {
+		return fmt.Errorf("Invalid value. Not signed by PrivateKey corresponding to %v", pk)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package namesys
+
+import (
+	"testing"
+	"time"
+
+	path "github.com/ipfs/go-ipfs/path"
+	testutil "github.com/ipfs/go-ipfs/util/testutil"
+)
+
+func TestInspectAndVerifyRecord(t *testing.T) {
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	data, err := createRoutingEntryData(privk, p, time.Now().Add(time.Hour), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := InspectRecord(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Value != p.String() {
+		t.Fatalf("expected value %s, got %s", p, info.Value)
+	}
+	if info.TTL != time.Minute {
+		t.Fatalf("expected ttl %s, got %s", time.Minute, info.TTL)
+	}
+	if info.ValidityType != "EOL" || info.Expired {
+		t.Fatalf("unexpected validity: %s expired=%t", info.ValidityType, info.Expired)
+	}
+
+	if err := VerifyRecord(pubk, data); err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyRecord(otherk, data); err == nil {
+		t.Fatal("record should not verify against an unrelated key")
+	}
+}
@@ -31,6 +31,7 @@ package namesys
 
 import (
 	"errors"
+	"time"
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	ci "github.com/ipfs/go-ipfs/p2p/crypto"
@@ -46,6 +47,10 @@ const (
 	// trust resolution to eventually complete and can't put an upper
 	// limit on how many steps it will take.
 	UnlimitedDepth = 0
+
+	// DefaultRecordLifetime is how long published mappings are valid for,
+	// unless Publisher.PublishWithEOL is told otherwise.
+	DefaultRecordLifetime = time.Hour * 24
 )
 
 // ErrResolveFailed signals an error when attempting to resolve.
@@ -105,4 +110,8 @@ type Publisher interface {
 	// Publish establishes a name-value mapping.
 	// TODO make this not PrivKey specific.
 	Publish(ctx context.Context, name ci.PrivKey, value path.Path) error
+
+	// PublishWithEOL is like Publish, but the mapping is valid until eol,
+	// and resolvers may cache it for ttl, or not at all if ttl is 0.
+	PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.Path, eol time.Time, ttl time.Duration) error
 }
@@ -2,9 +2,13 @@ package namesys
 
 import (
 	"strings"
+	"time"
 
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	floodsub "github.com/ipfs/go-ipfs/p2p/protocol/floodsub"
 	path "github.com/ipfs/go-ipfs/path"
 	routing "github.com/ipfs/go-ipfs/routing"
 )
@@ -21,15 +25,21 @@ import (
 type mpns struct {
 	resolvers  map[string]resolver
 	publishers map[string]Publisher
+
+	// pubsub, if set, is tried before the other resolvers, and published
+	// to along with the routing system
+	pubsub *pubsubResolver
 }
 
-// NewNameSystem will construct the IPFS naming system based on Routing
-func NewNameSystem(r routing.IpfsRouting) NameSystem {
+// NewNameSystem will construct the IPFS naming system based on Routing.
+// The values of names it caches are kept in dstore, if it's not nil, to
+// be found again after a restart.
+func NewNameSystem(r routing.IpfsRouting, dstore ds.Datastore) NameSystem {
 	return &mpns{
 		resolvers: map[string]resolver{
 			"dns":      newDNSResolver(),
 			"proquint": new(ProquintResolver),
-			"dht":      newRoutingResolver(r),
+			"dht":      newRoutingResolver(r, dstore),
 		},
 		publishers: map[string]Publisher{
 			"/ipns/": NewRoutingPublisher(r),
@@ -37,6 +47,16 @@ func NewNameSystem(r routing.IpfsRouting) NameSystem {
 	}
 }
 
+// NewPubsubNameSystem constructs a naming system which also publishes
+// records over ps, and follows the names it resolves there, to resolve
+// them without asking the routing system once records come in. It stops
+// following them once ctx is done.
+func NewPubsubNameSystem(ctx context.Context, r routing.IpfsRouting, dstore ds.Datastore, ps *floodsub.PubSub) NameSystem {
+	ns := NewNameSystem(r, dstore).(*mpns)
+	ns.pubsub = newPubsubResolver(ctx, ps, r)
+	return ns
+}
+
 // Resolve implements Resolver.
 func (ns *mpns) Resolve(ctx context.Context, name string) (path.Path, error) {
 	return ns.ResolveN(ctx, name, DefaultDepthLimit)
@@ -66,6 +86,11 @@ func (ns *mpns) resolveOnce(ctx context.Context, name string) (path.Path, error)
 		return "", ErrResolveFailed
 	}
 
+	if ns.pubsub != nil && usesCache(ctx) {
+		if p, err := ns.pubsub.resolveOnce(ctx, segments[2]); err == nil {
+			return p, nil
+		}
+	}
 	for protocol, resolver := range ns.resolvers {
 		log.Debugf("Attempting to resolve %s with %s", name, protocol)
 		p, err := resolver.resolveOnce(ctx, segments[2])
@@ -79,5 +104,32 @@ func (ns *mpns) resolveOnce(ctx context.Context, name string) (path.Path, error)
 
 // Publish implements Publisher
 func (ns *mpns) Publish(ctx context.Context, name ci.PrivKey, value path.Path) error {
-	return ns.publishers["/ipns/"].Publish(ctx, name, value)
+	return ns.PublishWithEOL(ctx, name, value, time.Now().Add(DefaultRecordLifetime), 0)
+}
+
+// PublishWithEOL implements Publisher
+func (ns *mpns) PublishWithEOL(ctx context.Context, name ci.PrivKey, value path.Path, eol time.Time, ttl time.Duration) error {
+	h, err := name.GetPublic().Hash()
+	if err != nil {
+		return err
+	}
+	pname := key.Key(h).Pretty()
+
+	// followers hear of it at once, without waiting on the routing system
+	if ns.pubsub != nil {
+		if err := ns.pubsub.publish(name, pname, value, eol, ttl); err != nil {
+			return err
+		}
+	}
+
+	err = ns.publishers["/ipns/"].PublishWithEOL(ctx, name, value, eol, ttl)
+	if err != nil {
+		return err
+	}
+
+	// don't go on resolving the name to what it was before
+	if r, ok := ns.resolvers["dht"].(*routingResolver); ok {
+		r.cacheSet(pname, value, eol, ttl)
+	}
+	return nil
 }
@@ -43,9 +43,15 @@ func NewRoutingPublisher(route routing.IpfsRouting) Publisher {
 // Publish implements Publisher. Accepts a keypair and a value,
 // and publishes it out to the routing system
 func (p *ipnsPublisher) Publish(ctx context.Context, k ci.PrivKey, value path.Path) error {
+	return p.PublishWithEOL(ctx, k, value, time.Now().Add(DefaultRecordLifetime), 0)
+}
+
+// PublishWithEOL implements Publisher. The record is valid until eol, and
+// carries ttl, if any, as a hint to resolvers.
+func (p *ipnsPublisher) PublishWithEOL(ctx context.Context, k ci.PrivKey, value path.Path, eol time.Time, ttl time.Duration) error {
 	log.Debugf("Publish %s", value)
 
-	data, err := createRoutingEntryData(k, value)
+	data, err := createRoutingEntryData(k, value, eol, ttl)
 	if err != nil {
 		return err
 	}
@@ -79,13 +85,25 @@ func (p *ipnsPublisher) Publish(ctx context.Context, k ci.PrivKey, value path.Pa
 	return nil
 }
 
-func createRoutingEntryData(pk ci.PrivKey, val path.Path) ([]byte, error) {
+func createRoutingEntryData(pk ci.PrivKey, val path.Path, eol time.Time, ttl time.Duration) ([]byte, error) {
+	return createSequencedEntryData(pk, val, eol, ttl, 0)
+}
+
+// createSequencedEntryData is createRoutingEntryData for a record that
+// carries the sequence number seq, if it's not 0, under the signature.
+func createSequencedEntryData(pk ci.PrivKey, val path.Path, eol time.Time, ttl time.Duration, seq uint64) ([]byte, error) {
 	entry := new(pb.IpnsEntry)
 
 	entry.Value = []byte(val)
 	typ := pb.IpnsEntry_EOL
 	entry.ValidityType = &typ
-	entry.Validity = []byte(u.FormatRFC3339(time.Now().Add(time.Hour * 24)))
+	entry.Validity = []byte(u.FormatRFC3339(eol))
+	if ttl > 0 {
+		entry.Ttl = proto.Uint64(uint64(ttl))
+	}
+	if seq > 0 {
+		entry.Sequence = proto.Uint64(seq)
+	}
 
 	sig, err := pk.Sign(ipnsEntryDataForSig(entry))
 	if err != nil {
@@ -95,13 +113,19 @@ func createRoutingEntryData(pk ci.PrivKey, val path.Path) ([]byte, error) {
 	return proto.Marshal(entry)
 }
 
+// ipnsEntryDataForSig returns the data of e that is signed. The sequence
+// number is only signed when it's set, so that records without one still
+// verify.
 func ipnsEntryDataForSig(e *pb.IpnsEntry) []byte {
-	return bytes.Join([][]byte{
+	parts := [][]byte{
 		e.Value,
 		e.Validity,
 		[]byte(fmt.Sprint(e.GetValidityType())),
-	},
-		[]byte{})
+	}
+	if e.Sequence != nil {
+		parts = append(parts, []byte(fmt.Sprint(e.GetSequence())))
+	}
+	return bytes.Join(parts, []byte{})
 }
 
 var IpnsRecordValidator = &record.ValidChecker{
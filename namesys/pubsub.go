@@ -0,0 +1,258 @@
+package namesys
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	pb "github.com/ipfs/go-ipfs/namesys/internal/pb"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	floodsub "github.com/ipfs/go-ipfs/p2p/protocol/floodsub"
+	path "github.com/ipfs/go-ipfs/path"
+	routing "github.com/ipfs/go-ipfs/routing"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// pubsubTopic returns the topic the records of name, the hash of a public
+// key, are published on.
+func pubsubTopic(name string) string {
+	return "/ipns/" + name
+}
+
+// pubsubIdleTimeout is how long a name is followed for after it was last
+// resolved.
+var pubsubIdleTimeout = time.Hour
+
+// pubsubResolver follows names over floodsub. The first time a name is
+// resolved, it subscribes to the topic of the name, and fails for the
+// routing system to be asked instead. From then on, the records
+// published to the name are picked up as they come in, and the name
+// resolves at once to the latest of them, while it is valid. A name that
+// isn't resolved for pubsubIdleTimeout is no longer followed.
+//
+// The latest record is the one with the highest sequence number, and of
+// those, the one valid the longest. Records without a sequence number
+// come before all those with one.
+type pubsubResolver struct {
+	ctx     context.Context
+	ps      *floodsub.PubSub
+	routing routing.IpfsRouting
+
+	mx      sync.Mutex
+	subs    map[string]*pubsubSub
+	latest  map[string]pubsubEntry
+	pubkeys map[string]ci.PubKey
+}
+
+// pubsubSub is the subscription to the topic of a followed name.
+type pubsubSub struct {
+	sub    *floodsub.Subscription
+	cancel context.CancelFunc
+	idle   *time.Timer
+}
+
+// pubsubEntry is the latest record known of a name.
+type pubsubEntry struct {
+	val path.Path
+	eol time.Time
+	seq uint64
+}
+
+// newer returns whether e is a later record than o.
+func (e pubsubEntry) newer(o pubsubEntry) bool {
+	if e.seq != o.seq {
+		return e.seq > o.seq
+	}
+	return e.eol.After(o.eol)
+}
+
+func newPubsubResolver(ctx context.Context, ps *floodsub.PubSub, r routing.IpfsRouting) *pubsubResolver {
+	return &pubsubResolver{
+		ctx:     ctx,
+		ps:      ps,
+		routing: r,
+		subs:    make(map[string]*pubsubSub),
+		latest:  make(map[string]pubsubEntry),
+		pubkeys: make(map[string]ci.PubKey),
+	}
+}
+
+// resolveOnce implements resolver.
+func (r *pubsubResolver) resolveOnce(ctx context.Context, name string) (path.Path, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	s, followed := r.subs[name]
+	if followed {
+		s.idle.Reset(pubsubIdleTimeout)
+	}
+	if e, ok := r.latest[name]; ok && time.Now().Before(e.eol) {
+		return e.val, nil
+	}
+	if followed {
+		return "", ErrResolveFailed
+	}
+
+	// only names that are hashes are published to
+	if _, err := mh.FromB58String(name); err != nil {
+		return "", err
+	}
+	sub, err := r.ps.Subscribe(pubsubTopic(name))
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	s = &pubsubSub{
+		sub:    sub,
+		cancel: cancel,
+		idle:   time.AfterFunc(pubsubIdleTimeout, func() { r.cancel(name) }),
+	}
+	r.subs[name] = s
+	go r.follow(ctx, name, s)
+	return "", ErrResolveFailed
+}
+
+// cancel stops following name, and forgets the records of it. It returns
+// whether name was followed.
+func (r *pubsubResolver) cancel(name string) bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	s, ok := r.subs[name]
+	if !ok {
+		return false
+	}
+	r.drop(name, s)
+	return true
+}
+
+// drop forgets the subscription s to name, if it's the current one. It
+// must be called with the lock held.
+func (r *pubsubResolver) drop(name string, s *pubsubSub) {
+	if r.subs[name] != s {
+		return
+	}
+	s.idle.Stop()
+	s.cancel()
+	delete(r.subs, name)
+	delete(r.latest, name)
+}
+
+// publish publishes val to name until eol, under a sequence number later
+// than that of any record known of. Here, it replaces whatever record was
+// known of.
+func (r *pubsubResolver) publish(pk ci.PrivKey, name string, val path.Path, eol time.Time, ttl time.Duration) error {
+	r.mx.Lock()
+	// nanoseconds go on rising across restarts, unlike a counter
+	seq := uint64(time.Now().UnixNano())
+	if e, ok := r.latest[name]; ok && e.seq >= seq {
+		seq = e.seq + 1
+	}
+	r.latest[name] = pubsubEntry{val: val, eol: eol, seq: seq}
+	r.mx.Unlock()
+
+	data, err := createSequencedEntryData(pk, val, eol, ttl, seq)
+	if err != nil {
+		return err
+	}
+	return r.ps.Publish(pubsubTopic(name), data)
+}
+
+// setLatest keeps e as the latest record of name, unless the record it
+// knows of is later, or name is no longer followed.
+func (r *pubsubResolver) setLatest(name string, e pubsubEntry) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if _, ok := r.subs[name]; !ok {
+		return
+	}
+	if l, ok := r.latest[name]; ok && !e.newer(l) {
+		return
+	}
+	r.latest[name] = e
+}
+
+func (r *pubsubResolver) follow(ctx context.Context, name string, s *pubsubSub) {
+	defer func() {
+		s.sub.Cancel()
+		r.mx.Lock()
+		r.drop(name, s)
+		r.mx.Unlock()
+	}()
+	for {
+		msg, err := s.sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		if err := r.receive(name, msg.Data); err != nil {
+			log.Debugf("pubsub: dropping a record for %s from %s: %s", name, msg.From, err)
+		}
+	}
+}
+
+// receive checks the record data published to name, and keeps it if it's
+// the latest.
+func (r *pubsubResolver) receive(name string, data []byte) error {
+	entry := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(data, entry); err != nil {
+		return err
+	}
+	if err := ValidateIpnsRecord(key.Key(pubsubTopic(name)), data); err != nil {
+		return err
+	}
+	pubkey, err := r.pubkey(name)
+	if err != nil {
+		return err
+	}
+	if err := verifyEntry(pubkey, entry); err != nil {
+		return err
+	}
+
+	p, err := entryPath(entry)
+	if err != nil {
+		return err
+	}
+	// ValidateIpnsRecord parsed it already
+	eol, _ := u.ParseRFC3339(string(entry.GetValidity()))
+	r.setLatest(name, pubsubEntry{val: p, eol: eol, seq: entry.GetSequence()})
+	return nil
+}
+
+// pubkey returns the public key name is the hash of.
+func (r *pubsubResolver) pubkey(name string) (ci.PubKey, error) {
+	r.mx.Lock()
+	pk, ok := r.pubkeys[name]
+	r.mx.Unlock()
+	if ok {
+		return pk, nil
+	}
+
+	hash, err := mh.FromB58String(name)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(r.ctx, time.Second*10)
+	defer cancel()
+	pk, err = routing.GetPublicKey(r.routing, ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	pkh, err := pk.Hash()
+	if err != nil {
+		return nil, err
+	}
+	if string(pkh) != string(hash) {
+		return nil, fmt.Errorf("the public key found is not the one %s names", name)
+	}
+
+	r.mx.Lock()
+	r.pubkeys[name] = pk
+	r.mx.Unlock()
+	return pk, nil
+}
@@ -0,0 +1,231 @@
+package namesys
+
+import (
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	floodsub "github.com/ipfs/go-ipfs/p2p/protocol/floodsub"
+	p2ptestutil "github.com/ipfs/go-ipfs/p2p/test/util"
+	path "github.com/ipfs/go-ipfs/path"
+	mockrouting "github.com/ipfs/go-ipfs/routing/mock"
+	testutil "github.com/ipfs/go-ipfs/util/testutil"
+)
+
+func TestPubsubFollowsNames(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the two share the routing system
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	h1 := p2ptestutil.GenHostSwarm(t, ctx)
+	h2 := p2ptestutil.GenHostSwarm(t, ctx)
+	ns1 := NewPubsubNameSystem(ctx, d, nil, floodsub.NewPubSub(ctx, h1))
+	ns2 := NewPubsubNameSystem(ctx, d, nil, floodsub.NewPubSub(ctx, h2)).(*mpns)
+	if err := h1.Connect(ctx, h2.Peerstore().PeerInfo(h2.ID())); err != nil {
+		t.Fatal(err)
+	}
+
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkhash, err := pubk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := key.Key(pkhash).Pretty()
+
+	first := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	if err := ns1.Publish(ctx, privk, first); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first resolution goes to the routing system, and follows the name
+	if _, err := ns2.pubsub.resolveOnce(ctx, name); err != ErrResolveFailed {
+		t.Fatalf("expected the name to be unknown over pubsub, got %v", err)
+	}
+	if p, err := ns2.Resolve(ctx, "/ipns/"+name); err != nil || p != first {
+		t.Fatalf("resolved to %s, %v", p, err)
+	}
+
+	// wait for h1 to hear h2 subscribe
+	topic := pubsubTopic(name)
+	for i := 0; i < 100 && len(ns1.(*mpns).pubsub.ps.ListPeers(topic)) == 0; i++ {
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	second := path.FromString("/ipfs/QmcqtdfbALbq7MFmNeq7hQbGVsGtHBH1v58phzCxnRb8Py")
+	if err := ns1.PublishWithEOL(ctx, privk, second, time.Now().Add(time.Hour*48), 0); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if p, err := ns2.pubsub.resolveOnce(ctx, name); err == nil {
+			if p != second {
+				t.Fatalf("resolved over pubsub to %s", p)
+			}
+			return
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	t.Fatal("the record published never came in over pubsub")
+}
+
+func TestPubsubDropsForgedRecords(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	r := newPubsubResolver(ctx, floodsub.NewPubSub(ctx, p2ptestutil.GenHostSwarm(t, ctx)), d)
+
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewRoutingPublisher(d).Publish(ctx, privk, path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")); err != nil {
+		t.Fatal(err)
+	}
+	pkhash, err := pubk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := key.Key(pkhash).Pretty()
+
+	forged, err := createRoutingEntryData(other, path.FromString("/ipfs/QmcqtdfbALbq7MFmNeq7hQbGVsGtHBH1v58phzCxnRb8Py"), time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.receive(name, forged); err == nil {
+		t.Fatal("accepted a record signed by another key")
+	}
+
+	expired, err := createRoutingEntryData(privk, path.FromString("/ipfs/QmcqtdfbALbq7MFmNeq7hQbGVsGtHBH1v58phzCxnRb8Py"), time.Now().Add(-time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.receive(name, expired); err == nil {
+		t.Fatal("accepted an expired record")
+	}
+	if _, ok := r.latest[name]; ok {
+		t.Fatal("kept a record it dropped")
+	}
+}
+
+func TestPubsubKeepsLatestSequence(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	r := newPubsubResolver(ctx, floodsub.NewPubSub(ctx, p2ptestutil.GenHostSwarm(t, ctx)), d)
+
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewRoutingPublisher(d).Publish(ctx, privk, path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")); err != nil {
+		t.Fatal(err)
+	}
+	pkhash, err := pubk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := key.Key(pkhash).Pretty()
+	if _, err := r.resolveOnce(ctx, name); err != ErrResolveFailed {
+		t.Fatalf("expected the name to be unknown over pubsub, got %v", err)
+	}
+
+	first := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	second := path.FromString("/ipfs/QmcqtdfbALbq7MFmNeq7hQbGVsGtHBH1v58phzCxnRb8Py")
+	receive := func(val path.Path, eol time.Time, seq uint64) {
+		data, err := createSequencedEntryData(privk, val, eol, 0, seq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.receive(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(val path.Path) {
+		if p, err := r.resolveOnce(ctx, name); err != nil || p != val {
+			t.Fatalf("expected %s, got %s, %v", val, p, err)
+		}
+	}
+
+	receive(first, time.Now().Add(time.Hour*48), 0)
+	expect(first)
+	// a sequence number comes after none, even valid for less long
+	receive(second, time.Now().Add(time.Hour), 2)
+	expect(second)
+	// an earlier sequence number is dropped, however long it's valid
+	receive(first, time.Now().Add(time.Hour*96), 1)
+	expect(second)
+	// of the same sequence number, the one valid the longest is kept
+	receive(first, time.Now().Add(time.Hour*2), 2)
+	expect(first)
+}
+
+func TestPubsubCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	ps := floodsub.NewPubSub(ctx, p2ptestutil.GenHostSwarm(t, ctx))
+	r := newPubsubResolver(ctx, ps, d)
+
+	_, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkhash, err := pubk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := key.Key(pkhash).Pretty()
+	topic := pubsubTopic(name)
+
+	subscribed := func() bool {
+		for _, tp := range ps.GetTopics() {
+			if tp == topic {
+				return true
+			}
+		}
+		return false
+	}
+	waitFor := func(want bool) {
+		for i := 0; i < 100 && subscribed() != want; i++ {
+			time.Sleep(time.Millisecond * 20)
+		}
+		if subscribed() != want {
+			t.Fatalf("expected subscribed to be %v", want)
+		}
+	}
+
+	r.resolveOnce(ctx, name)
+	waitFor(true)
+	if !r.cancel(name) {
+		t.Fatal("expected the name to be followed")
+	}
+	waitFor(false)
+	if r.cancel(name) {
+		t.Fatal("expected the name to be no longer followed")
+	}
+
+	// names not resolved for a while are no longer followed
+	defer func(d time.Duration) { pubsubIdleTimeout = d }(pubsubIdleTimeout)
+	pubsubIdleTimeout = time.Millisecond * 50
+	r.resolveOnce(ctx, name)
+	waitFor(true)
+	waitFor(false)
+	r.mx.Lock()
+	_, ok := r.subs[name]
+	r.mx.Unlock()
+	if ok {
+		t.Fatal("expected the idle name to be dropped")
+	}
+}
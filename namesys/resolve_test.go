@@ -2,7 +2,9 @@ package namesys
 
 import (
 	"testing"
+	"time"
 
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	path "github.com/ipfs/go-ipfs/path"
@@ -43,3 +45,105 @@ func TestRoutingResolve(t *testing.T) {
 		t.Fatal("Got back incorrect value.")
 	}
 }
+
+func TestRoutingResolveCachesForTTL(t *testing.T) {
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+
+	resolver := NewRoutingResolver(d)
+	publisher := NewRoutingPublisher(d)
+
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkhash, err := pubk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := key.Key(pkhash).Pretty()
+
+	a := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	b := path.FromString("/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy")
+	eol := time.Now().Add(time.Hour)
+
+	ctx := context.Background()
+	if err := publisher.PublishWithEOL(ctx, privk, a, eol, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := resolver.Resolve(ctx, name); err != nil || res != a {
+		t.Fatalf("resolved to %s, %v", res, err)
+	}
+
+	// the record carried a ttl, so the value is cached
+	if err := publisher.PublishWithEOL(ctx, privk, b, eol, 0); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := resolver.Resolve(ctx, name); err != nil || res != a {
+		t.Fatalf("expected the cached %s, resolved to %s, %v", a, res, err)
+	}
+
+	// once the cache runs out, the new record is looked up, and not cached
+	resolver.(*routingResolver).cache.Purge()
+	if res, err := resolver.Resolve(ctx, name); err != nil || res != b {
+		t.Fatalf("expected %s, resolved to %s, %v", b, res, err)
+	}
+	if resolver.(*routingResolver).cache.Len() != 0 {
+		t.Fatal("cached a record without a ttl")
+	}
+}
+
+func TestRoutingResolveCacheSurvivesRestarts(t *testing.T) {
+	d := mockrouting.NewServer().Client(testutil.RandIdentityOrFatal(t))
+	dstore := ds.NewMapDatastore()
+	publisher := NewRoutingPublisher(d)
+
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkhash, err := pubk.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := key.Key(pkhash).Pretty()
+
+	a := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	b := path.FromString("/ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy")
+	eol := time.Now().Add(time.Hour)
+
+	ctx := context.Background()
+	if err := publisher.PublishWithEOL(ctx, privk, a, eol, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := newRoutingResolver(d, dstore).Resolve(ctx, name); err != nil || res != a {
+		t.Fatalf("resolved to %s, %v", res, err)
+	}
+	if err := publisher.PublishWithEOL(ctx, privk, b, eol, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new resolver finds the value cached by the first one
+	resolver := newRoutingResolver(d, dstore)
+	if res, err := resolver.Resolve(ctx, name); err != nil || res != a {
+		t.Fatalf("expected the cached %s, resolved to %s, %v", a, res, err)
+	}
+
+	// without the cache, the new record is looked up, and cached instead
+	if res, err := resolver.Resolve(WithoutCache(ctx), name); err != nil || res != b {
+		t.Fatalf("expected %s, resolved to %s, %v", b, res, err)
+	}
+	if res, err := newRoutingResolver(d, dstore).Resolve(ctx, name); err != nil || res != b {
+		t.Fatalf("expected the cached %s, resolved to %s, %v", b, res, err)
+	}
+
+	// entries that ran out are dropped
+	if err := dstore.Put(cacheKey(name), []byte(`{"Value": "`+a.String()+`", "EOL": "2000-01-01T00:00:00Z"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := newRoutingResolver(d, dstore).cacheGet(name); ok {
+		t.Fatal("found an entry that ran out")
+	}
+	if has, _ := dstore.Has(cacheKey(name)); has {
+		t.Fatal("kept an entry that ran out")
+	}
+}
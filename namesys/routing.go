@@ -1,9 +1,12 @@
 package namesys
 
 import (
-	"fmt"
+	"encoding/json"
+	"time"
 
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	lru "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/hashicorp/golang-lru"
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
@@ -16,28 +19,130 @@ import (
 
 var log = u.Logger("namesys")
 
+// cacheSize is how many resolved names a routingResolver caches.
+const cacheSize = 128
+
 // routingResolver implements NSResolver for the main IPFS SFS-like naming
 type routingResolver struct {
 	routing routing.IpfsRouting
+
+	// cache holds the values of names whose records carried a ttl, until
+	// it runs out, and dstore, if set, keeps them across restarts
+	cache  *lru.Cache
+	dstore ds.Datastore
+}
+
+type cacheEntry struct {
+	val path.Path
+	eol time.Time
+}
+
+// storedEntry is how a cacheEntry is kept in the datastore.
+type storedEntry struct {
+	Value string
+	EOL   time.Time
 }
 
 // NewRoutingResolver constructs a name resolver using the IPFS Routing system
 // to implement SFS-like naming on top.
 func NewRoutingResolver(route routing.IpfsRouting) Resolver {
+	return newRoutingResolver(route, nil)
+}
+
+// newRoutingResolver returns a resolver instead of a Resolver. The values
+// it caches are also kept in dstore, if it's not nil.
+func newRoutingResolver(route routing.IpfsRouting, dstore ds.Datastore) *routingResolver {
 	if route == nil {
 		panic("attempt to create resolver with nil routing system")
 	}
 
-	return &routingResolver{routing: route}
+	cache, err := lru.New(cacheSize)
+	if err != nil {
+		panic(err)
+	}
+	return &routingResolver{routing: route, cache: cache, dstore: dstore}
 }
 
-// newRoutingResolver returns a resolver instead of a Resolver.
-func newRoutingResolver(route routing.IpfsRouting) resolver {
-	if route == nil {
-		panic("attempt to create resolver with nil routing system")
+// cacheKey is where the cached value of name is kept in the datastore.
+func cacheKey(name string) ds.Key {
+	return ds.NewKey("/namesys/cache/" + name)
+}
+
+// cacheGet returns the cached value of name, if it's still fresh.
+func (r *routingResolver) cacheGet(name string) (path.Path, bool) {
+	var e cacheEntry
+	if v, ok := r.cache.Get(name); ok {
+		e = v.(cacheEntry)
+	} else if stored, ok := r.storeGet(name); ok {
+		e = stored
+		r.cache.Add(name, e)
+	} else {
+		return "", false
+	}
+
+	if time.Now().After(e.eol) {
+		r.cacheRemove(name)
+		return "", false
+	}
+	return e.val, true
+}
+
+// storeGet returns the value of name kept in the datastore, if any.
+func (r *routingResolver) storeGet(name string) (cacheEntry, bool) {
+	if r.dstore == nil {
+		return cacheEntry{}, false
+	}
+	v, err := r.dstore.Get(cacheKey(name))
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return cacheEntry{}, false
 	}
+	var stored storedEntry
+	if err := json.Unmarshal(b, &stored); err != nil {
+		log.Debugf("namesys: dropping the bad cache entry of %s: %s", name, err)
+		r.cacheRemove(name)
+		return cacheEntry{}, false
+	}
+	return cacheEntry{val: path.Path(stored.Value), eol: stored.EOL}, true
+}
+
+// cacheSet caches the value of name for ttl, but no longer than the
+// record it came in is valid, until eol. Without a ttl, any value cached
+// is dropped.
+func (r *routingResolver) cacheSet(name string, val path.Path, eol time.Time, ttl time.Duration) {
+	if ttl <= 0 {
+		r.cacheRemove(name)
+		return
+	}
+	if until := time.Now().Add(ttl); until.Before(eol) {
+		eol = until
+	}
+	r.cache.Add(name, cacheEntry{val: val, eol: eol})
 
-	return &routingResolver{routing: route}
+	if r.dstore == nil {
+		return
+	}
+	b, err := json.Marshal(&storedEntry{Value: val.String(), EOL: eol})
+	if err != nil {
+		log.Debugf("namesys: encoding the cache entry of %s: %s", name, err)
+		return
+	}
+	if err := r.dstore.Put(cacheKey(name), b); err != nil {
+		log.Debugf("namesys: storing the cache entry of %s: %s", name, err)
+	}
+}
+
+func (r *routingResolver) cacheRemove(name string) {
+	r.cache.Remove(name)
+	if r.dstore == nil {
+		return
+	}
+	if err := r.dstore.Delete(cacheKey(name)); err != nil && err != ds.ErrNotFound {
+		log.Debugf("namesys: removing the cache entry of %s: %s", name, err)
+	}
 }
 
 // Resolve implements Resolver.
@@ -54,6 +159,12 @@ func (r *routingResolver) ResolveN(ctx context.Context, name string, depth int)
 // resolve SFS-like names.
 func (r *routingResolver) resolveOnce(ctx context.Context, name string) (path.Path, error) {
 	log.Debugf("RoutingResolve: '%s'", name)
+	if usesCache(ctx) {
+		if val, ok := r.cacheGet(name); ok {
+			return val, nil
+		}
+	}
+
 	hash, err := mh.FromB58String(name)
 	if err != nil {
 		log.Warning("RoutingResolve: bad input hash: [%s]\n", name)
@@ -88,20 +199,31 @@ func (r *routingResolver) resolveOnce(ctx context.Context, name string) (path.Pa
 	log.Debugf("pk hash = %s", key.Key(hsh))
 
 	// check sig with pk
-	if ok, err := pubkey.Verify(ipnsEntryDataForSig(entry), entry.GetSignature()); err != nil || !ok {
-		return "", fmt.Errorf("Invalid value. Not signed by PrivateKey corresponding to %v", pubkey)
+	if err := verifyEntry(pubkey, entry); err != nil {
+		return "", err
 	}
 
 	// ok sig checks out. this is a valid name.
+	p, err := entryPath(entry)
+	if err != nil {
+		return "", err
+	}
 
+	if eol, err := u.ParseRFC3339(string(entry.GetValidity())); err == nil {
+		r.cacheSet(name, p, eol, time.Duration(entry.GetTtl()))
+	}
+	return p, nil
+}
+
+// entryPath returns the path the record entry points to.
+func entryPath(entry *pb.IpnsEntry) (path.Path, error) {
 	// check for old style record:
 	valh, err := mh.Cast(entry.GetValue())
 	if err != nil {
 		// Not a multihash, probably a new record
 		return path.ParsePath(string(entry.GetValue()))
-	} else {
-		// Its an old style multihash record
-		log.Warning("Detected old style multihash record")
-		return path.FromKey(key.Key(valh)), nil
 	}
+	// Its an old style multihash record
+	log.Warning("Detected old style multihash record")
+	return path.FromKey(key.Key(valh)), nil
 }
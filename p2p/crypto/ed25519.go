@@ -0,0 +1,97 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+
+	pb "github.com/ipfs/go-ipfs/p2p/crypto/internal/pb"
+)
+
+var errEd25519Encrypt = errors.New("ed25519 keys sign, but don't encrypt")
+
+type Ed25519PrivateKey struct {
+	k ed25519.PrivateKey
+}
+
+type Ed25519PublicKey struct {
+	k ed25519.PublicKey
+}
+
+func (pk *Ed25519PublicKey) Verify(data, sig []byte) (bool, error) {
+	return ed25519.Verify(pk.k, data, sig), nil
+}
+
+func (pk *Ed25519PublicKey) Bytes() ([]byte, error) {
+	pbmes := new(pb.PublicKey)
+	typ := pb.KeyType_Ed25519
+	pbmes.Type = &typ
+	pbmes.Data = pk.k
+	return proto.Marshal(pbmes)
+}
+
+func (pk *Ed25519PublicKey) Encrypt(b []byte) ([]byte, error) {
+	return nil, errEd25519Encrypt
+}
+
+// Equals checks whether this key is equal to another
+func (pk *Ed25519PublicKey) Equals(k Key) bool {
+	return KeyEqual(pk, k)
+}
+
+func (pk *Ed25519PublicKey) Hash() ([]byte, error) {
+	return KeyHash(pk)
+}
+
+func (sk *Ed25519PrivateKey) GenSecret() []byte {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return buf
+}
+
+func (sk *Ed25519PrivateKey) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(sk.k, message), nil
+}
+
+func (sk *Ed25519PrivateKey) GetPublic() PubKey {
+	return &Ed25519PublicKey{sk.k.Public().(ed25519.PublicKey)}
+}
+
+func (sk *Ed25519PrivateKey) Decrypt(b []byte) ([]byte, error) {
+	return nil, errEd25519Encrypt
+}
+
+func (sk *Ed25519PrivateKey) Bytes() ([]byte, error) {
+	pbmes := new(pb.PrivateKey)
+	typ := pb.KeyType_Ed25519
+	pbmes.Type = &typ
+	pbmes.Data = sk.k.Seed()
+	return proto.Marshal(pbmes)
+}
+
+// Equals checks whether this key is equal to another
+func (sk *Ed25519PrivateKey) Equals(k Key) bool {
+	return KeyEqual(sk, k)
+}
+
+func (sk *Ed25519PrivateKey) Hash() ([]byte, error) {
+	return KeyHash(sk)
+}
+
+// UnmarshalEd25519PrivateKey returns the private key of the seed b.
+func UnmarshalEd25519PrivateKey(b []byte) (*Ed25519PrivateKey, error) {
+	if len(b) != ed25519.SeedSize {
+		return nil, fmt.Errorf("ed25519 private keys are %d bytes, not %d", ed25519.SeedSize, len(b))
+	}
+	return &Ed25519PrivateKey{ed25519.NewKeyFromSeed(b)}, nil
+}
+
+func UnmarshalEd25519PublicKey(b []byte) (*Ed25519PublicKey, error) {
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("ed25519 public keys are %d bytes, not %d", ed25519.PublicKeySize, len(b))
+	}
+	return &Ed25519PublicKey{ed25519.PublicKey(append([]byte(nil), b...))}, nil
+}
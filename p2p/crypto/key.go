@@ -1,6 +1,6 @@
 // package crypto implements various cryptographic utilities used by ipfs.
-// This includes a Public and Private key interface and an RSA key implementation
-// that satisfies it.
+// This includes a Public and Private key interface and RSA and Ed25519 key
+// implementations that satisfy it.
 package crypto
 
 import (
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rand"
@@ -31,6 +32,7 @@ var ErrBadKeyType = errors.New("invalid or unsupported key type")
 
 const (
 	RSA = iota
+	Ed25519
 )
 
 // Key represents a crypto key that can be compared to another key
@@ -79,7 +81,8 @@ func GenerateKeyPair(typ, bits int) (PrivKey, PubKey, error) {
 	return GenerateKeyPairWithReader(typ, bits, rand.Reader)
 }
 
-// Generates a keypair of the given type and bitsize
+// Generates a keypair of the given type and bitsize. Ed25519 keys are
+// always 256 bits, whatever the bitsize.
 func GenerateKeyPairWithReader(typ, bits int, src io.Reader) (PrivKey, PubKey, error) {
 	switch typ {
 	case RSA:
@@ -89,6 +92,12 @@ func GenerateKeyPairWithReader(typ, bits int, src io.Reader) (PrivKey, PubKey, e
 		}
 		pk := &priv.PublicKey
 		return &RsaPrivateKey{sk: priv}, &RsaPublicKey{pk}, nil
+	case Ed25519:
+		pub, priv, err := ed25519.GenerateKey(src)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &Ed25519PrivateKey{priv}, &Ed25519PublicKey{pub}, nil
 	default:
 		return nil, nil, ErrBadKeyType
 	}
@@ -240,6 +249,8 @@ func UnmarshalPublicKey(data []byte) (PubKey, error) {
 	switch pmes.GetType() {
 	case pb.KeyType_RSA:
 		return UnmarshalRsaPublicKey(pmes.GetData())
+	case pb.KeyType_Ed25519:
+		return UnmarshalEd25519PublicKey(pmes.GetData())
 	default:
 		return nil, ErrBadKeyType
 	}
@@ -248,15 +259,12 @@ func UnmarshalPublicKey(data []byte) (PubKey, error) {
 // MarshalPublicKey converts a public key object into a protobuf serialized
 // public key
 func MarshalPublicKey(k PubKey) ([]byte, error) {
-	b, err := MarshalRsaPublicKey(k.(*RsaPublicKey))
-	if err != nil {
-		return nil, err
+	switch k.(type) {
+	case *RsaPublicKey, *Ed25519PublicKey:
+		return k.Bytes()
+	default:
+		return nil, ErrBadKeyType
 	}
-	pmes := new(pb.PublicKey)
-	typ := pb.KeyType_RSA // for now only type.
-	pmes.Type = &typ
-	pmes.Data = b
-	return proto.Marshal(pmes)
 }
 
 // UnmarshalPrivateKey converts a protobuf serialized private key into its
@@ -271,6 +279,8 @@ func UnmarshalPrivateKey(data []byte) (PrivKey, error) {
 	switch pmes.GetType() {
 	case pb.KeyType_RSA:
 		return UnmarshalRsaPrivateKey(pmes.GetData())
+	case pb.KeyType_Ed25519:
+		return UnmarshalEd25519PrivateKey(pmes.GetData())
 	default:
 		return nil, ErrBadKeyType
 	}
@@ -278,12 +288,12 @@ func UnmarshalPrivateKey(data []byte) (PrivKey, error) {
 
 // MarshalPrivateKey converts a key object into its protobuf serialized form.
 func MarshalPrivateKey(k PrivKey) ([]byte, error) {
-	b := MarshalRsaPrivateKey(k.(*RsaPrivateKey))
-	pmes := new(pb.PrivateKey)
-	typ := pb.KeyType_RSA // for now only type.
-	pmes.Type = &typ
-	pmes.Data = b
-	return proto.Marshal(pmes)
+	switch k.(type) {
+	case *RsaPrivateKey, *Ed25519PrivateKey:
+		return k.Bytes()
+	default:
+		return nil, ErrBadKeyType
+	}
 }
 
 // ConfigDecodeKey decodes from b64 (for config file), and unmarshals.
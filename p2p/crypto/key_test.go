@@ -19,6 +19,21 @@ func TestRsaKeys(t *testing.T) {
 	testKeyEquals(t, pk)
 }
 
+func TestEd25519Keys(t *testing.T) {
+	sk, pk, err := GenerateKeyPair(Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKeySignature(t, sk)
+	testKeyEncoding(t, sk)
+	testKeyEquals(t, sk)
+	testKeyEquals(t, pk)
+
+	if _, err := pk.Encrypt([]byte("data")); err == nil {
+		t.Fatal("ed25519 keys should not encrypt")
+	}
+}
+
 func testKeySignature(t *testing.T, sk PrivKey) {
 	pk := sk.GetPublic()
 
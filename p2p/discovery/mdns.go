@@ -26,6 +26,9 @@ type Service interface {
 	io.Closer
 	RegisterNotifee(Notifee)
 	UnregisterNotifee(Notifee)
+
+	// Discovered reports whether the peer was found by the service.
+	Discovered(peer.ID) bool
 }
 
 type Notifee interface {
@@ -39,7 +42,10 @@ type mdnsService struct {
 
 	lk       sync.Mutex
 	notifees []Notifee
+	found    map[peer.ID]struct{}
 	interval time.Duration
+
+	closing chan struct{}
 }
 
 func getDialableListenAddrs(ph host.Host) ([]*net.TCPAddr, error) {
@@ -96,7 +102,9 @@ func NewMdnsService(peerhost host.Host, interval time.Duration) (Service, error)
 		server:   server,
 		service:  service,
 		host:     peerhost,
+		found:    make(map[peer.ID]struct{}),
 		interval: interval,
+		closing:  make(chan struct{}),
 	}
 
 	go s.pollForEntries()
@@ -105,13 +113,17 @@ func NewMdnsService(peerhost host.Host, interval time.Duration) (Service, error)
 }
 
 func (m *mdnsService) Close() error {
+	close(m.closing)
 	return m.server.Shutdown()
 }
 
 func (m *mdnsService) pollForEntries() {
 	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
 	for {
 		select {
+		case <-m.closing:
+			return
 		case <-ticker.C:
 			entriesCh := make(chan *mdns.ServiceEntry, 16)
 			go func() {
@@ -161,6 +173,7 @@ func (m *mdnsService) handleEntry(e *mdns.ServiceEntry) {
 	}
 
 	m.lk.Lock()
+	m.found[mpeer] = struct{}{}
 	for _, n := range m.notifees {
 		n.HandlePeerFound(pi)
 	}
@@ -187,3 +200,10 @@ func (m *mdnsService) UnregisterNotifee(n Notifee) {
 	}
 	m.lk.Unlock()
 }
+
+func (m *mdnsService) Discovered(p peer.ID) bool {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	_, ok := m.found[p]
+	return ok
+}
@@ -0,0 +1,57 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/cryptix/mdns"
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	"github.com/ipfs/go-ipfs/p2p/peer"
+	netutil "github.com/ipfs/go-ipfs/p2p/test/util"
+)
+
+type recorder chan peer.PeerInfo
+
+func (r recorder) HandlePeerFound(pi peer.PeerInfo) {
+	r <- pi
+}
+
+func TestHandleEntry(t *testing.T) {
+	ctx := context.Background()
+	h := netutil.GenHostSwarm(t, ctx)
+	defer h.Close()
+	other := netutil.GenHostSwarm(t, ctx)
+	defer other.Close()
+
+	m := &mdnsService{
+		host:  h,
+		found: make(map[peer.ID]struct{}),
+	}
+	r := make(recorder, 2)
+	m.RegisterNotifee(r)
+
+	// entries of the node itself are ignored
+	m.handleEntry(&mdns.ServiceEntry{Info: h.ID().Pretty(), AddrV4: []byte{127, 0, 0, 1}, Port: 4001})
+	if m.Discovered(h.ID()) {
+		t.Fatal("node discovered itself")
+	}
+
+	m.handleEntry(&mdns.ServiceEntry{Info: other.ID().Pretty(), AddrV4: []byte{127, 0, 0, 1}, Port: 4001})
+	if !m.Discovered(other.ID()) {
+		t.Fatal("peer should be marked discovered")
+	}
+
+	select {
+	case pi := <-r:
+		if pi.ID != other.ID() {
+			t.Fatal("notified of the wrong peer")
+		}
+		exp, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/4001")
+		if len(pi.Addrs) != 1 || !pi.Addrs[0].Equal(exp) {
+			t.Fatalf("wrong addrs: %v", pi.Addrs)
+		}
+	default:
+		t.Fatal("notifee was not told of the peer")
+	}
+}
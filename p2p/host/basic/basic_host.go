@@ -2,6 +2,7 @@ package basichost
 
 import (
 	"io"
+	"sync"
 
 	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
 	goprocess "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/goprocess"
@@ -10,7 +11,9 @@ import (
 	mstream "github.com/ipfs/go-ipfs/metrics/stream"
 	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
 
+	inat "github.com/ipfs/go-ipfs/p2p/nat"
 	inet "github.com/ipfs/go-ipfs/p2p/net"
+	connmgr "github.com/ipfs/go-ipfs/p2p/net/connmgr"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
 	identify "github.com/ipfs/go-ipfs/p2p/protocol/identify"
@@ -37,16 +40,23 @@ const (
 //  * uses an identity service to send + receive node information
 //  * uses a relay service to allow hosts to relay conns for each other
 //  * uses a nat service to establish NAT port mappings
+//  * uses a connection manager to trim its connections
 type BasicHost struct {
 	network inet.Network
 	mux     *protocol.Mux
 	ids     *identify.IDService
 	relay   *relay.RelayService
 	natmgr  *natManager
+	cmgr    *connmgr.ConnManager
 
 	proc goprocess.Process
 
 	bwc metrics.Reporter
+
+	// addrsFilter leaves addresses out of Addrs, e.g. those peers
+	// couldn't dial back.
+	addrsMx     sync.Mutex
+	addrsFilter func(ma.Multiaddr) bool
 }
 
 // New constructs and sets up a new *BasicHost with given Network
@@ -55,6 +65,7 @@ func New(net inet.Network, opts ...interface{}) *BasicHost {
 		network: net,
 		mux:     protocol.NewMux(),
 		bwc:     metrics.NewBandwidthCounter(),
+		cmgr:    connmgr.New(0, 0, 0),
 	}
 
 	h.proc = goprocess.WithTeardown(func() error {
@@ -78,9 +89,13 @@ func New(net inet.Network, opts ...interface{}) *BasicHost {
 			}
 		case metrics.Reporter:
 			h.bwc = o
+		case *connmgr.ConnManager:
+			h.cmgr = o
 		}
 	}
 
+	net.Notify(h.cmgr)
+
 	net.SetConnHandler(h.newConnHandler)
 	net.SetStreamHandler(h.newStreamHandler)
 
@@ -216,6 +231,35 @@ func (h *BasicHost) dialPeer(ctx context.Context, p peer.ID) error {
 // Addrs returns all the addresses of BasicHost at this moment in time.
 // It's ok to not include addresses if they're not available to be used now.
 func (h *BasicHost) Addrs() []ma.Multiaddr {
+	addrs := h.AllAddrs()
+
+	h.addrsMx.Lock()
+	filter := h.addrsFilter
+	h.addrsMx.Unlock()
+	if filter == nil {
+		return addrs
+	}
+
+	var out []ma.Multiaddr
+	for _, addr := range addrs {
+		if filter(addr) {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// SetAddrsFilter has Addrs leave out the addresses f returns false for.
+// A nil f removes the filter.
+func (h *BasicHost) SetAddrsFilter(f func(ma.Multiaddr) bool) {
+	h.addrsMx.Lock()
+	defer h.addrsMx.Unlock()
+	h.addrsFilter = f
+}
+
+// AllAddrs returns the addresses of BasicHost, including those left out of
+// Addrs by its filter.
+func (h *BasicHost) AllAddrs() []ma.Multiaddr {
 	addrs, err := h.Network().InterfaceListenAddresses()
 	if err != nil {
 		log.Debug("error retrieving network interface addrs")
@@ -235,11 +279,29 @@ func (h *BasicHost) Addrs() []ma.Multiaddr {
 	return addrs
 }
 
+// NATMappings returns the port mappings open on the NAT, none if the host
+// doesn't map ports or found no NAT.
+func (h *BasicHost) NATMappings() []inat.Mapping {
+	if h.natmgr == nil {
+		return nil
+	}
+	nat := h.natmgr.NAT()
+	if nat == nil {
+		return nil
+	}
+	return nat.Mappings()
+}
+
 // Close shuts down the Host's services (network, etc).
 func (h *BasicHost) Close() error {
 	return h.proc.Close()
 }
 
+// ConnManager returns the manager trimming the connections of the Host
+func (h *BasicHost) ConnManager() *connmgr.ConnManager {
+	return h.cmgr
+}
+
 // GetBandwidthReporter exposes the Host's bandiwth metrics reporter
 func (h *BasicHost) GetBandwidthReporter() metrics.Reporter {
 	return h.bwc
@@ -5,6 +5,7 @@ import (
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	metrics "github.com/ipfs/go-ipfs/metrics"
 	inet "github.com/ipfs/go-ipfs/p2p/net"
+	connmgr "github.com/ipfs/go-ipfs/p2p/net/connmgr"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
 	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
@@ -59,5 +60,9 @@ type Host interface {
 	// Close shuts down the host, its Network, and services.
 	Close() error
 
+	// ConnManager returns the manager trimming the connections of the Host,
+	// with which services tag the peers useful to them.
+	ConnManager() *connmgr.ConnManager
+
 	GetBandwidthReporter() metrics.Reporter
 }
@@ -11,7 +11,9 @@ import (
 
 	metrics "github.com/ipfs/go-ipfs/metrics"
 	host "github.com/ipfs/go-ipfs/p2p/host"
+	inat "github.com/ipfs/go-ipfs/p2p/nat"
 	inet "github.com/ipfs/go-ipfs/p2p/net"
+	connmgr "github.com/ipfs/go-ipfs/p2p/net/connmgr"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
 	routing "github.com/ipfs/go-ipfs/routing"
@@ -117,6 +119,21 @@ func (rh *RoutedHost) Close() error {
 	return rh.host.Close()
 }
 
+func (rh *RoutedHost) ConnManager() *connmgr.ConnManager {
+	return rh.host.ConnManager()
+}
+
 func (rh *RoutedHost) GetBandwidthReporter() metrics.Reporter {
 	return rh.host.GetBandwidthReporter()
 }
+
+// NATMappings returns the port mappings of the wrapped host, if it maps
+// ports on a NAT.
+func (rh *RoutedHost) NATMappings() []inat.Mapping {
+	if nh, ok := rh.host.(interface {
+		NATMappings() []inat.Mapping
+	}); ok {
+		return nh.NATMappings()
+	}
+	return nil
+}
@@ -52,6 +52,28 @@ func newSingleConn(ctx context.Context, local, remote peer.ID, maconn manet.Conn
 	return conn, nil
 }
 
+// Upgrade makes a Conn of maconn, a connection to remote set up by other
+// means than a Dialer or Listener, e.g. relayed by another peer. remote may
+// be empty when unknown, as the handshake securing the conn with sk learns
+// it. If sk is nil, the conn is not secured.
+func Upgrade(ctx context.Context, local, remote peer.ID, sk ic.PrivKey, maconn manet.Conn) (Conn, error) {
+	c, err := newSingleConn(ctx, local, remote, maconn)
+	if err != nil {
+		return nil, err
+	}
+
+	if sk == nil {
+		log.Warningf("conn %s upgraded INSECURELY", c)
+		return c, nil
+	}
+	sc, err := newSecureConn(ctx, sk, c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return sc, nil
+}
+
 // close is the internal close function, called by ContextCloser.Close
 func (c *singleConn) Close() error {
 	defer func() {
@@ -14,6 +14,7 @@ import (
 	lgbl "github.com/ipfs/go-ipfs/util/eventlog/loggables"
 
 	addrutil "github.com/ipfs/go-ipfs/p2p/net/swarm/addr"
+	websocket "github.com/ipfs/go-ipfs/p2p/net/websocket"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 )
 
@@ -95,6 +96,20 @@ func (d *Dialer) Dial(ctx context.Context, raddr ma.Multiaddr, remote peer.ID) (
 	return connOut, nil
 }
 
+// DialRaw opens the transport conn to raddr which Dial secures, wrapped
+// with d.Wrapper, so that a failed dial can be told from a failed
+// handshake.
+func (d *Dialer) DialRaw(ctx context.Context, raddr ma.Multiaddr, remote peer.ID) (manet.Conn, error) {
+	maconn, err := d.rawConnDial(ctx, raddr, remote)
+	if err != nil {
+		return nil, err
+	}
+	if d.Wrapper != nil {
+		maconn = d.Wrapper(maconn)
+	}
+	return maconn, nil
+}
+
 // rawConnDial dials the underlying net.Conn + manet.Conns
 func (d *Dialer) rawConnDial(ctx context.Context, raddr ma.Multiaddr, remote peer.ID) (manet.Conn, error) {
 
@@ -114,6 +129,15 @@ func (d *Dialer) rawConnDial(ctx context.Context, raddr ma.Multiaddr, remote pee
 	logdial := lgbl.Dial("conn", d.LocalPeer, remote, laddr, raddr)
 	defer log.EventBegin(ctx, "connDialRawConn", logdial).Done()
 
+	// websocket conns are upgraded from tcp ones, and like utp conns do not
+	// reuse ports.
+	if websocket.Matches(raddr) {
+		return websocket.Dial(d.Dialer, raddr)
+	}
+	if isUtpAddr(raddr) {
+		return utpDial(d.Dialer, raddr)
+	}
+
 	// make a copy of the manet.Dialer, we may need to change its timeout.
 	madialer := d.Dialer
 
@@ -231,6 +255,10 @@ func pickLocalAddr(laddrs []ma.Multiaddr, raddr ma.Multiaddr) (laddr ma.Multiadd
 		}
 		return true
 	})
+	if len(laddrs) < 1 {
+		// none can, as when listening on loopback only.
+		return nil
+	}
 
 	// TODO pick with a good heuristic
 	// we use a random one for now to prevent bad addresses from making nodes unreachable
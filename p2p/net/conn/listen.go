@@ -14,6 +14,7 @@ import (
 
 	ic "github.com/ipfs/go-ipfs/p2p/crypto"
 	filter "github.com/ipfs/go-ipfs/p2p/net/filter"
+	websocket "github.com/ipfs/go-ipfs/p2p/net/websocket"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 )
 
@@ -177,6 +178,13 @@ func (l *listener) SetConnWrapper(cw ConnWrapper) {
 }
 
 func manetListen(addr ma.Multiaddr) (manet.Listener, error) {
+	if websocket.Matches(addr) {
+		return websocket.Listen(addr)
+	}
+	if isUtpAddr(addr) {
+		return utpListen(addr)
+	}
+
 	network, naddr, err := manet.DialArgs(addr)
 	if err != nil {
 		return nil, err
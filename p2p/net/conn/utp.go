@@ -0,0 +1,108 @@
+package conn
+
+import (
+	"net"
+
+	utp "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/h2so5/utp"
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+)
+
+// manet refuses utp, so utp addresses are listened on and dialed here.
+
+var utpMa = ma.StringCast("/utp")
+
+// isUtpAddr returns whether addr is a utp address, like
+// /ip4/1.2.3.4/udp/4001/utp.
+func isUtpAddr(addr ma.Multiaddr) bool {
+	protos := addr.Protocols()
+	return len(protos) > 0 && protos[len(protos)-1].Code == ma.P_UTP
+}
+
+// fromUtpAddr returns the multiaddr of a, which utp conns give either as
+// a utp.Addr or as the raw udp address.
+func fromUtpAddr(a net.Addr) (ma.Multiaddr, error) {
+	if ua, ok := a.(*utp.Addr); ok {
+		a = ua.Addr
+	}
+	m, err := manet.FromNetAddr(a)
+	if err != nil {
+		return nil, err
+	}
+	return m.Encapsulate(utpMa), nil
+}
+
+type utpConn struct {
+	net.Conn
+	laddr ma.Multiaddr
+	raddr ma.Multiaddr
+}
+
+func (c *utpConn) LocalMultiaddr() ma.Multiaddr  { return c.laddr }
+func (c *utpConn) RemoteMultiaddr() ma.Multiaddr { return c.raddr }
+
+type utpListener struct {
+	*utp.Listener
+	laddr ma.Multiaddr
+}
+
+func (l *utpListener) NetListener() net.Listener { return l.Listener }
+func (l *utpListener) Multiaddr() ma.Multiaddr   { return l.laddr }
+
+func (l *utpListener) Accept() (manet.Conn, error) {
+	nconn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	raddr, err := fromUtpAddr(nconn.RemoteAddr())
+	if err != nil {
+		nconn.Close()
+		return nil, err
+	}
+	return &utpConn{Conn: nconn, laddr: l.laddr, raddr: raddr}, nil
+}
+
+func utpListen(addr ma.Multiaddr) (manet.Listener, error) {
+	network, naddr, err := manet.DialArgs(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	uaddr, err := utp.ResolveAddr(network, naddr)
+	if err != nil {
+		return nil, err
+	}
+
+	ul, err := utp.Listen(network, uaddr)
+	if err != nil {
+		return nil, err
+	}
+
+	laddr, err := fromUtpAddr(ul.Addr())
+	if err != nil {
+		ul.Close()
+		return nil, err
+	}
+	return &utpListener{Listener: ul, laddr: laddr}, nil
+}
+
+func utpDial(d manet.Dialer, raddr ma.Multiaddr) (manet.Conn, error) {
+	network, naddr, err := manet.DialArgs(raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	ud := utp.Dialer{Timeout: d.Dialer.Timeout}
+	nconn, err := ud.Dial(network, naddr)
+	if err != nil {
+		return nil, err
+	}
+
+	laddr, err := fromUtpAddr(nconn.LocalAddr())
+	if err != nil {
+		nconn.Close()
+		return nil, err
+	}
+	return &utpConn{Conn: nconn, laddr: laddr, raddr: raddr}, nil
+}
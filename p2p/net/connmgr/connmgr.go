@@ -0,0 +1,375 @@
+// Package connmgr keeps the number of connections of a node in check. It
+// scores the connected peers with the tags the services put on them, and
+// closes the connections of the least useful ones when there are too many.
+package connmgr
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	inet "github.com/ipfs/go-ipfs/p2p/net"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
+)
+
+var log = eventlog.Logger("connmgr")
+
+// SilencePeriod is the least time between two trims started by new
+// connections.
+var SilencePeriod = time.Second * 10
+
+// PendingPeerTTL is how long the tags of a peer are kept for before it
+// connects. Services may tag peers before the ConnManager is notified of
+// their conns; the tags of peers which never connect are dropped.
+var PendingPeerTTL = time.Minute
+
+// ConnManager trims the connections of a network to its low water mark
+// once they exceed its high water mark. Peers connected for less than the
+// grace period, and protected peers, are never trimmed. Others are trimmed
+// by ascending score, the sum of the values of their tags.
+//
+// A ConnManager only tracks peers while it is registered as a notifiee of
+// their network, with Network.Notify.
+type ConnManager struct {
+	lowWater    int
+	highWater   int
+	gracePeriod time.Duration
+
+	lk        sync.Mutex
+	peers     map[peer.ID]*peerInfo
+	protected map[peer.ID]map[string]struct{}
+	lastTrim  time.Time
+	lastSweep time.Time
+
+	trimming int32
+}
+
+type peerInfo struct {
+	tags      map[string]int
+	value     int
+	firstSeen time.Time
+	connected bool
+}
+
+// New returns a ConnManager trimming down to low connections when there
+// are more than high. A high water mark of 0 disables trimming.
+func New(low, high int, grace time.Duration) *ConnManager {
+	return &ConnManager{
+		lowWater:    low,
+		highWater:   high,
+		gracePeriod: grace,
+		peers:       make(map[peer.ID]*peerInfo),
+		protected:   make(map[peer.ID]map[string]struct{}),
+	}
+}
+
+// TagPeer sets the tag of a connected peer to val, in place of its
+// previous value. The tags of a peer not connected yet are kept for
+// PendingPeerTTL, as services may tag peers before the ConnManager is
+// notified of their conns.
+func (cm *ConnManager) TagPeer(p peer.ID, tag string, val int) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	if _, ok := cm.peers[p]; !ok {
+		cm.sweep(time.Now())
+	}
+	pi := cm.track(p)
+	pi.value += val - pi.tags[tag]
+	pi.tags[tag] = val
+}
+
+// UntagPeer removes the tag of a peer.
+func (cm *ConnManager) UntagPeer(p peer.ID, tag string) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	pi, ok := cm.peers[p]
+	if !ok {
+		return
+	}
+
+	pi.value -= pi.tags[tag]
+	delete(pi.tags, tag)
+}
+
+// Protect keeps the conns of p from being trimmed, until Unprotect is
+// called with the same tag. Peers may be protected before they connect.
+func (cm *ConnManager) Protect(p peer.ID, tag string) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	tags, ok := cm.protected[p]
+	if !ok {
+		tags = make(map[string]struct{})
+		cm.protected[p] = tags
+	}
+	tags[tag] = struct{}{}
+}
+
+// SetProtected protects the conns of the peers ps under tag, in place of
+// those protected under it before.
+func (cm *ConnManager) SetProtected(tag string, ps []peer.ID) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	for p, tags := range cm.protected {
+		delete(tags, tag)
+		if len(tags) == 0 {
+			delete(cm.protected, p)
+		}
+	}
+	for _, p := range ps {
+		tags, ok := cm.protected[p]
+		if !ok {
+			tags = make(map[string]struct{})
+			cm.protected[p] = tags
+		}
+		tags[tag] = struct{}{}
+	}
+}
+
+// SetLimits changes the water marks and grace period of the ConnManager,
+// which apply from the next trim on.
+func (cm *ConnManager) SetLimits(low, high int, grace time.Duration) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	cm.lowWater = low
+	cm.highWater = high
+	cm.gracePeriod = grace
+}
+
+// Unprotect removes the protection of p under tag, returning whether p is
+// still protected under other tags.
+func (cm *ConnManager) Unprotect(p peer.ID, tag string) bool {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	tags, ok := cm.protected[p]
+	if !ok {
+		return false
+	}
+	delete(tags, tag)
+	if len(tags) == 0 {
+		delete(cm.protected, p)
+		return false
+	}
+	return true
+}
+
+// TrimOpenConns closes the conns of the lowest scored peers of n, until it
+// has no more than the low water mark of connections left. It does nothing
+// if trimming is disabled, or already going on.
+func (cm *ConnManager) TrimOpenConns(n inet.Network) {
+	cm.lk.Lock()
+	disabled := cm.highWater == 0
+	cm.lk.Unlock()
+	if disabled {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&cm.trimming, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&cm.trimming, 0)
+
+	for _, p := range cm.peersToClose(n) {
+		log.Infof("closing conns to peer %s", p)
+		if err := n.ClosePeer(p); err != nil {
+			log.Debugf("closing conns to %s: %s", p, err)
+		}
+	}
+}
+
+// peersToClose returns the peers of n to close the conns of, in the order
+// to close them in.
+func (cm *ConnManager) peersToClose(n inet.Network) []peer.ID {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	now := time.Now()
+	cm.lastTrim = now
+
+	nconns := len(n.Conns())
+	if nconns <= cm.lowWater {
+		return nil
+	}
+
+	var candidates byValue
+	for p, pi := range cm.peers {
+		if !pi.connected {
+			continue
+		}
+		if _, ok := cm.protected[p]; ok {
+			continue
+		}
+		if now.Sub(pi.firstSeen) < cm.gracePeriod {
+			continue
+		}
+		candidates = append(candidates, TagInfo{ID: p, Value: pi.value})
+	}
+	sort.Sort(candidates)
+
+	var closed []peer.ID
+	for _, c := range candidates {
+		if nconns <= cm.lowWater {
+			break
+		}
+		nconns -= len(n.ConnsToPeer(c.ID))
+		closed = append(closed, c.ID)
+	}
+	return closed
+}
+
+// TagInfo describes a peer tracked by a ConnManager.
+type TagInfo struct {
+	ID        peer.ID
+	FirstSeen time.Time
+	Value     int
+	Tags      map[string]int
+	Protected bool
+}
+
+// Peers returns the connected peers tracked, by descending score.
+func (cm *ConnManager) Peers() []TagInfo {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	out := make(byValue, 0, len(cm.peers))
+	for p, pi := range cm.peers {
+		if !pi.connected {
+			continue
+		}
+		tags := make(map[string]int, len(pi.tags))
+		for t, v := range pi.tags {
+			tags[t] = v
+		}
+		_, protected := cm.protected[p]
+		out = append(out, TagInfo{
+			ID:        p,
+			FirstSeen: pi.firstSeen,
+			Value:     pi.value,
+			Tags:      tags,
+			Protected: protected,
+		})
+	}
+	sort.Sort(sort.Reverse(out))
+	return out
+}
+
+// byValue sorts TagInfos by ascending score, then peer.ID.
+type byValue []TagInfo
+
+func (s byValue) Len() int      { return len(s) }
+func (s byValue) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byValue) Less(i, j int) bool {
+	if s[i].Value != s[j].Value {
+		return s[i].Value < s[j].Value
+	}
+	return s[i].ID < s[j].ID
+}
+
+// Info describes the state of a ConnManager.
+type Info struct {
+	LowWater    int
+	HighWater   int
+	GracePeriod time.Duration
+	LastTrim    time.Time
+	Peers       int
+	Protected   int
+}
+
+// GetInfo returns the state of the ConnManager.
+func (cm *ConnManager) GetInfo() Info {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	npeers := 0
+	for _, pi := range cm.peers {
+		if pi.connected {
+			npeers++
+		}
+	}
+	return Info{
+		LowWater:    cm.lowWater,
+		HighWater:   cm.highWater,
+		GracePeriod: cm.gracePeriod,
+		LastTrim:    cm.lastTrim,
+		Peers:       npeers,
+		Protected:   len(cm.protected),
+	}
+}
+
+// track returns the info of p, which it starts tracking if need be.
+// cm.lk must be held.
+func (cm *ConnManager) track(p peer.ID) *peerInfo {
+	pi, ok := cm.peers[p]
+	if !ok {
+		pi = &peerInfo{
+			tags:      make(map[string]int),
+			firstSeen: time.Now(),
+		}
+		cm.peers[p] = pi
+	}
+	return pi
+}
+
+// sweep drops the tags of the peers which never connected within
+// PendingPeerTTL, at most once per PendingPeerTTL. cm.lk must be held.
+func (cm *ConnManager) sweep(now time.Time) {
+	if now.Sub(cm.lastSweep) < PendingPeerTTL {
+		return
+	}
+	cm.lastSweep = now
+	for p, pi := range cm.peers {
+		if !pi.connected && now.Sub(pi.firstSeen) >= PendingPeerTTL {
+			delete(cm.peers, p)
+		}
+	}
+}
+
+// Connected starts tracking the peer of c, and starts a trim if there are
+// more conns than the high water mark.
+func (cm *ConnManager) Connected(n inet.Network, c inet.Conn) {
+	p := c.RemotePeer()
+	if n.Connectedness(p) != inet.Connected {
+		// closed already, and Disconnected may have been seen first
+		return
+	}
+
+	cm.lk.Lock()
+	pi := cm.track(p)
+	if !pi.connected {
+		// the grace period starts with the first conn
+		pi.connected = true
+		pi.firstSeen = time.Now()
+	}
+	trim := cm.highWater > 0 &&
+		len(n.Conns()) > cm.highWater &&
+		time.Since(cm.lastTrim) > SilencePeriod
+	cm.lk.Unlock()
+
+	if trim {
+		go cm.TrimOpenConns(n)
+	}
+}
+
+// Disconnected stops tracking the peer of c, once it has no conns left.
+func (cm *ConnManager) Disconnected(n inet.Network, c inet.Conn) {
+	p := c.RemotePeer()
+	if n.Connectedness(p) == inet.Connected {
+		return
+	}
+
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+	delete(cm.peers, p)
+}
+
+func (cm *ConnManager) OpenedStream(n inet.Network, s inet.Stream) {}
+func (cm *ConnManager) ClosedStream(n inet.Network, s inet.Stream) {}
+func (cm *ConnManager) Listen(n inet.Network, a ma.Multiaddr)      {}
+func (cm *ConnManager) ListenClose(n inet.Network, a ma.Multiaddr) {}
@@ -0,0 +1,194 @@
+package connmgr_test
+
+import (
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	inet "github.com/ipfs/go-ipfs/p2p/net"
+	connmgr "github.com/ipfs/go-ipfs/p2p/net/connmgr"
+	mocknet "github.com/ipfs/go-ipfs/p2p/net/mock"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+)
+
+// connectedManager returns the nets of a mocknet of n peers, the first
+// connected to all others and tracked by cm.
+func connectedManager(t *testing.T, ctx context.Context, n int, cm *connmgr.ConnManager) []inet.Network {
+	mn, err := mocknet.FullMeshLinked(ctx, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nets := mn.Nets()
+	nets[0].Notify(cm)
+	for _, n2 := range nets[1:] {
+		if _, err := mn.ConnectNets(nets[0], n2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; len(cm.Peers()) < n-1; i++ {
+		if i == 50 {
+			t.Fatalf("tracking %d peers, not %d", len(cm.Peers()), n-1)
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	return nets
+}
+
+func TestTagValues(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm := connmgr.New(0, 0, 0)
+	nets := connectedManager(t, ctx, 2, cm)
+	p := nets[1].LocalPeer()
+
+	cm.TagPeer(p, "a", 5)
+	cm.TagPeer(p, "b", 3)
+	cm.TagPeer(p, "a", 4)
+	if v := cm.Peers()[0].Value; v != 7 {
+		t.Fatalf("expected a score of 7, got %d", v)
+	}
+
+	cm.UntagPeer(p, "a")
+	ti := cm.Peers()[0]
+	if ti.Value != 3 || len(ti.Tags) != 1 || ti.Tags["b"] != 3 {
+		t.Fatalf("expected only tag b=3, got %v", ti.Tags)
+	}
+
+	cm.Protect(p, "x")
+	cm.Protect(p, "y")
+	if !cm.Unprotect(p, "x") {
+		t.Fatal("expected the peer to still be protected")
+	}
+	if cm.Unprotect(p, "y") {
+		t.Fatal("expected the peer to be unprotected")
+	}
+}
+
+func TestTrimKeepsUsefulPeers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm := connmgr.New(3, 10, 0)
+	nets := connectedManager(t, ctx, 7, cm)
+	n := nets[0]
+
+	kept := []inet.Network{nets[1], nets[2], nets[3]}
+	cm.TagPeer(nets[1].LocalPeer(), "test", 10)
+	cm.TagPeer(nets[2].LocalPeer(), "test", 5)
+	cm.Protect(nets[3].LocalPeer(), "test")
+	cm.TagPeer(nets[4].LocalPeer(), "test", -5)
+
+	cm.TrimOpenConns(n)
+
+	if len(n.Conns()) != 3 {
+		t.Fatalf("expected 3 conns left, got %d", len(n.Conns()))
+	}
+	for _, k := range kept {
+		if n.Connectedness(k.LocalPeer()) != inet.Connected {
+			t.Fatalf("expected the conn to %s to be kept", k.LocalPeer())
+		}
+	}
+}
+
+func TestTrimSparesNewConns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm := connmgr.New(1, 10, time.Hour)
+	nets := connectedManager(t, ctx, 5, cm)
+
+	cm.TrimOpenConns(nets[0])
+	if len(nets[0].Conns()) != 4 {
+		t.Fatalf("expected the conns in their grace period kept, got %d", len(nets[0].Conns()))
+	}
+}
+
+func TestTrimDisabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm := connmgr.New(0, 0, 0)
+	nets := connectedManager(t, ctx, 4, cm)
+
+	cm.TrimOpenConns(nets[0])
+	if len(nets[0].Conns()) != 3 {
+		t.Fatalf("expected no conns trimmed, got %d left", len(nets[0].Conns()))
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm := connmgr.New(0, 0, 0)
+	nets := connectedManager(t, ctx, 5, cm)
+
+	cm.SetProtected("config", []peer.ID{nets[1].LocalPeer(), nets[2].LocalPeer()})
+	cm.SetProtected("config", []peer.ID{nets[1].LocalPeer()})
+	cm.SetLimits(1, 2, 0)
+	if info := cm.GetInfo(); info.LowWater != 1 || info.HighWater != 2 || info.Protected != 1 {
+		t.Fatalf("unexpected state %+v", info)
+	}
+
+	cm.TrimOpenConns(nets[0])
+	if len(nets[0].Conns()) != 1 || len(nets[0].ConnsToPeer(nets[1].LocalPeer())) != 1 {
+		t.Fatalf("expected only the conn of the protected peer left, got %d", len(nets[0].Conns()))
+	}
+}
+
+func TestTagsOfUnconnectedPeers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	defer func(ttl time.Duration) { connmgr.PendingPeerTTL = ttl }(connmgr.PendingPeerTTL)
+	connmgr.PendingPeerTTL = time.Millisecond * 50
+
+	mn, err := mocknet.FullMeshLinked(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nets := mn.Nets()
+	cm := connmgr.New(0, 0, 0)
+	nets[0].Notify(cm)
+	early, never := nets[1].LocalPeer(), nets[2].LocalPeer()
+
+	// tags put before the conn is seen are kept
+	cm.TagPeer(early, "a", 5)
+	if info := cm.GetInfo(); info.Peers != 0 || len(cm.Peers()) != 0 {
+		t.Fatalf("expected no peer connected, got %+v", info)
+	}
+	if _, err := mn.ConnectNets(nets[0], nets[1]); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; len(cm.Peers()) == 0; i++ {
+		if i == 50 {
+			t.Fatal("the peer was never tracked")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	if ti := cm.Peers()[0]; ti.ID != early || ti.Value != 5 {
+		t.Fatalf("expected the tag put before the conn, got %+v", ti)
+	}
+
+	// those of a peer which never connects are dropped
+	cm.TagPeer(never, "a", 5)
+	time.Sleep(connmgr.PendingPeerTTL)
+	cm.TagPeer(peer.ID("other"), "a", 5)
+	if _, err := mn.ConnectNets(nets[0], nets[2]); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; len(cm.Peers()) < 2; i++ {
+		if i == 50 {
+			t.Fatal("the peer was never tracked")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	for _, ti := range cm.Peers() {
+		if ti.ID == never && ti.Value != 0 {
+			t.Fatalf("expected the tag of the pending peer dropped, got %+v", ti)
+		}
+	}
+}
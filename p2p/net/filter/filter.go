@@ -1,21 +1,52 @@
 package filter
 
 import (
+	"bytes"
 	"net"
 	"strings"
+	"sync"
 
 	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
 	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
 )
 
+// Filters blocks the addresses in any of its IP ranges. Filters may be
+// added and removed while they are in use.
 type Filters struct {
+	mu      sync.RWMutex
 	filters []*net.IPNet
 }
 
 func (fs *Filters) AddDialFilter(f *net.IPNet) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
 	fs.filters = append(fs.filters, f)
 }
 
+// Remove drops the filters of the range of f, returning whether there
+// were any.
+func (fs *Filters) Remove(f *net.IPNet) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	keep := fs.filters[:0]
+	for _, ft := range fs.filters {
+		if !ft.IP.Equal(f.IP) || !bytes.Equal(ft.Mask, f.Mask) {
+			keep = append(keep, ft)
+		}
+	}
+	removed := len(keep) < len(fs.filters)
+	fs.filters = keep
+	return removed
+}
+
+// Filters returns the ranges filtered.
+func (fs *Filters) Filters() []*net.IPNet {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return append([]*net.IPNet(nil), fs.filters...)
+}
+
 func (f *Filters) AddrBlocked(a ma.Multiaddr) bool {
 	_, addr, err := manet.DialArgs(a)
 	if err != nil {
@@ -25,6 +56,9 @@ func (f *Filters) AddrBlocked(a ma.Multiaddr) bool {
 
 	ipstr := strings.Split(addr, ":")[0]
 	ip := net.ParseIP(ipstr)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 	for _, ft := range f.filters {
 		if ft.Contains(ip) {
 			return true
@@ -0,0 +1,125 @@
+package pnet
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+)
+
+func testPSK(b byte) *PSK {
+	psk := new(PSK)
+	for i := range psk {
+		psk[i] = b + byte(i)
+	}
+	return psk
+}
+
+func TestDecodeV1PSK(t *testing.T) {
+	psk := testPSK(1)
+
+	var buf bytes.Buffer
+	if err := EncodeV1PSK(&buf, psk); err != nil {
+		t.Fatal(err)
+	}
+	out, err := DecodeV1PSK(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *out != *psk {
+		t.Fatalf("decoded %x, not %x", out[:], psk[:])
+	}
+
+	b64 := "/key/swarm/psk/1.0.0/\n/base64/\nAQIDBAUGBwgJCgsMDQ4PEBES\nExQVFhcYGRobHB0eHyA=\n"
+	out, err = DecodeV1PSK(bytes.NewBufferString(b64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *out != *psk {
+		t.Fatalf("decoded %x, not %x", out[:], psk[:])
+	}
+
+	bad := []string{
+		"",
+		"/key/swarm/psk/2.0.0/\n/base16/\n00\n",
+		"/key/swarm/psk/1.0.0/\n/base32/\n00\n",
+		"/key/swarm/psk/1.0.0/\n/base16/\n0102\n",
+		"/key/swarm/psk/1.0.0/\n/base16/\nzz\n",
+	}
+	for _, s := range bad {
+		if _, err := DecodeV1PSK(bytes.NewBufferString(s)); err == nil {
+			t.Fatalf("expected %q to fail to decode", s)
+		}
+	}
+}
+
+// protectedPipe returns the two ends of a conn, protected by psk1 and psk2.
+func protectedPipe(t *testing.T, psk1, psk2 *PSK) (net.Conn, net.Conn) {
+	l, err := manet.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := make(chan manet.Conn)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- c
+	}()
+
+	c1, err := manet.Dial(l.Multiaddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2 := <-accepted
+	if c2 == nil {
+		t.FailNow()
+	}
+	return Protect(psk1, c1), Protect(psk2, c2)
+}
+
+func TestProtectSameKey(t *testing.T) {
+	c1, c2 := protectedPipe(t, testPSK(1), testPSK(1))
+	defer c1.Close()
+	defer c2.Close()
+
+	msgs := []string{"hello", "world", "the third message"}
+	go func() {
+		for _, m := range msgs {
+			c1.Write([]byte(m))
+		}
+	}()
+
+	for _, m := range msgs {
+		buf := make([]byte, len(m))
+		if _, err := io.ReadFull(c2, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != m {
+			t.Fatalf("read %q, not %q", buf, m)
+		}
+	}
+}
+
+func TestProtectOtherKey(t *testing.T) {
+	c1, c2 := protectedPipe(t, testPSK(1), testPSK(2))
+	defer c1.Close()
+	defer c2.Close()
+
+	m := []byte("hello world")
+	go c1.Write(m)
+
+	buf := make([]byte, len(m))
+	if _, err := io.ReadFull(c2, buf); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(buf, m) {
+		t.Fatal("read the message without the key")
+	}
+}
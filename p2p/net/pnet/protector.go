@@ -0,0 +1,73 @@
+package pnet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"sync"
+
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+)
+
+// Protect returns c encrypted with psk. Each side of the conn encrypts what
+// it writes with AES-256 in CTR mode, keyed by psk, from a random IV it
+// sends first. The IVs are exchanged on the first Read and Write, so that
+// Protect wraps conns without blocking.
+func Protect(psk *PSK, c manet.Conn) manet.Conn {
+	block, err := aes.NewCipher(psk[:])
+	if err != nil {
+		// aes.NewCipher only fails on key sizes other than 16, 24 or 32.
+		panic(err)
+	}
+	return &pskConn{Conn: c, block: block}
+}
+
+// pskConn is a manet.Conn encrypted with a pre-shared key.
+type pskConn struct {
+	manet.Conn
+	block cipher.Block
+
+	readLk sync.Mutex
+	readS  cipher.Stream
+
+	writeLk sync.Mutex
+	writeS  cipher.Stream
+}
+
+func (c *pskConn) Read(out []byte) (int, error) {
+	c.readLk.Lock()
+	defer c.readLk.Unlock()
+
+	if c.readS == nil {
+		iv := make([]byte, aes.BlockSize)
+		if _, err := io.ReadFull(c.Conn, iv); err != nil {
+			return 0, err
+		}
+		c.readS = cipher.NewCTR(c.block, iv)
+	}
+
+	n, err := c.Conn.Read(out)
+	c.readS.XORKeyStream(out[:n], out[:n])
+	return n, err
+}
+
+func (c *pskConn) Write(in []byte) (int, error) {
+	c.writeLk.Lock()
+	defer c.writeLk.Unlock()
+
+	if c.writeS == nil {
+		iv := make([]byte, aes.BlockSize)
+		if _, err := rand.Read(iv); err != nil {
+			return 0, err
+		}
+		if _, err := c.Conn.Write(iv); err != nil {
+			return 0, err
+		}
+		c.writeS = cipher.NewCTR(c.block, iv)
+	}
+
+	out := make([]byte, len(in))
+	c.writeS.XORKeyStream(out, in)
+	return c.Conn.Write(out)
+}
@@ -0,0 +1,105 @@
+// Package pnet limits nodes to private networks, of the peers holding the
+// same pre-shared key. The connections of such nodes are encrypted with the
+// key, under their regular encryption, so the peers without the key fail
+// their handshakes.
+package pnet
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// KeySize is the size of pre-shared keys.
+const KeySize = 32
+
+// V1Header is the first line of the files of pre-shared keys.
+const V1Header = "/key/swarm/psk/1.0.0/"
+
+// PSK is a pre-shared key.
+type PSK [KeySize]byte
+
+// DecodeV1PSK decodes a pre-shared key written like:
+//
+//	/key/swarm/psk/1.0.0/
+//	/base16/
+//	<the key, in hexadecimal>
+//
+// /base64/ and /bin/ encodings are accepted as well.
+func DecodeV1PSK(r io.Reader) (*PSK, error) {
+	br := bufio.NewReader(r)
+
+	header, err := readLine(br)
+	if err != nil {
+		return nil, err
+	}
+	if header != V1Header {
+		return nil, fmt.Errorf("swarm key: expected header %q, got %q", V1Header, header)
+	}
+
+	enc, err := readLine(br)
+	if err != nil {
+		return nil, err
+	}
+
+	rest, err := ioutil.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := string(bytes.Join(bytes.Fields(rest), nil))
+
+	var key []byte
+	switch enc {
+	case "/base16/":
+		key, err = hex.DecodeString(trimmed)
+	case "/base64/":
+		key, err = base64.StdEncoding.DecodeString(trimmed)
+	case "/bin/":
+		key = rest
+	default:
+		return nil, fmt.Errorf("swarm key: unknown encoding %q", enc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("swarm key: %s", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("swarm key: expected %d bytes, got %d", KeySize, len(key))
+	}
+
+	psk := new(PSK)
+	copy(psk[:], key)
+	return psk, nil
+}
+
+// EncodeV1PSK writes psk in the format DecodeV1PSK reads, in hexadecimal.
+func EncodeV1PSK(w io.Writer, psk *PSK) error {
+	_, err := fmt.Fprintf(w, "%s\n/base16/\n%s\n", V1Header, hex.EncodeToString(psk[:]))
+	return err
+}
+
+// Fingerprint identifies psk, without revealing it.
+func (psk *PSK) Fingerprint() []byte {
+	h := sha256.Sum256(append([]byte(V1Header), psk[:]...))
+	return h[:16]
+}
+
+func readLine(br *bufio.Reader) (string, error) {
+	l, err := br.ReadString('\n')
+	if err == io.EOF && l != "" {
+		err = nil
+	}
+	if err == io.EOF {
+		return "", errors.New("swarm key: unexpected end of file")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(l), nil
+}
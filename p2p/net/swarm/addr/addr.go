@@ -5,6 +5,9 @@ import (
 
 	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
 
+	// registers the /ws protocol, before the transports are parsed
+	_ "github.com/ipfs/go-ipfs/p2p/net/websocket"
+
 	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
 	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
@@ -18,27 +21,47 @@ var log = eventlog.Logger("p2p/net/swarm/addr")
 var SupportedTransportStrings = []string{
 	"/ip4/tcp",
 	"/ip6/tcp",
-	// "/ip4/udp/utp", disabled because the lib is broken
-	// "/ip6/udp/utp", disabled because the lib is broken
+	"/ip4/tcp/ws",
+	"/ip6/tcp/ws",
+	// "/ip4/udp/utp", disabled because the lib is broken, see UtpTransportStrings
+	// "/ip6/udp/utp", disabled because the lib is broken, see UtpTransportStrings
 	// "/ip4/udp/udt", disabled because the lib doesnt work on arm
 	// "/ip6/udp/udt", disabled because the lib doesnt work on arm
 }
 
+// UtpTransportStrings are the utp transports. They are not supported by
+// default: a swarm only listens and dials on them when made with utp
+// enabled, until the utp library, which was disabled as broken, is shown
+// fixed.
+var UtpTransportStrings = []string{
+	"/ip4/udp/utp",
+	"/ip6/udp/utp",
+}
+
 // SupportedTransportProtocols is the list of supported transports for the swarm.
 // These are []ma.Protocol lists. Populated at runtime from SupportedTransportStrings
 var SupportedTransportProtocols = [][]ma.Protocol{}
 
+// UtpTransportProtocols is the list of utp transports.
+// These are []ma.Protocol lists. Populated at runtime from UtpTransportStrings
+var UtpTransportProtocols = [][]ma.Protocol{}
+
 func init() {
-	// initialize SupportedTransportProtocols
-	transports := make([][]ma.Protocol, len(SupportedTransportStrings))
-	for _, s := range SupportedTransportStrings {
+	// initialize SupportedTransportProtocols and UtpTransportProtocols
+	SupportedTransportProtocols = transportProtocols(SupportedTransportStrings)
+	UtpTransportProtocols = transportProtocols(UtpTransportStrings)
+}
+
+func transportProtocols(strs []string) [][]ma.Protocol {
+	transports := make([][]ma.Protocol, 0, len(strs))
+	for _, s := range strs {
 		t, err := ma.ProtocolsWithString(s)
 		if err != nil {
 			panic(err) // important to fix this in the codebase
 		}
 		transports = append(transports, t)
 	}
-	SupportedTransportProtocols = transports
+	return transports
 }
 
 // FilterAddrs is a filter that removes certain addresses, according to filter.
@@ -62,6 +85,14 @@ func FilterUsableAddrs(a []ma.Multiaddr) []ma.Multiaddr {
 	})
 }
 
+// FilterUsableAddrsWithUtp is FilterUsableAddrs for a network with utp
+// enabled: it keeps the utp addresses too.
+func FilterUsableAddrsWithUtp(a []ma.Multiaddr) []ma.Multiaddr {
+	return FilterAddrs(a, func(m ma.Multiaddr) bool {
+		return AddrUsableWithUtp(m, false)
+	})
+}
+
 // AddrOverNonLocalIP returns whether the addr uses a non-local ip link
 func AddrOverNonLocalIP(a ma.Multiaddr) bool {
 	split := ma.Split(a)
@@ -80,6 +111,17 @@ func AddrOverNonLocalIP(a ma.Multiaddr) bool {
 // as we need to be able to connect to multiple ipfs nodes
 // in the same machine.
 func AddrUsable(a ma.Multiaddr, partial bool) bool {
+	return addrUsable(a, partial, SupportedTransportProtocols)
+}
+
+// AddrUsableWithUtp is AddrUsable for a network with utp enabled: it
+// also accepts the transports in UtpTransportStrings.
+func AddrUsableWithUtp(a ma.Multiaddr, partial bool) bool {
+	return addrUsable(a, partial, SupportedTransportProtocols) ||
+		addrUsable(a, partial, UtpTransportProtocols)
+}
+
+func addrUsable(a ma.Multiaddr, partial bool, transports [][]ma.Protocol) bool {
 	if a == nil {
 		return false
 	}
@@ -88,7 +130,7 @@ func AddrUsable(a ma.Multiaddr, partial bool) bool {
 		return false
 	}
 
-	// test the address protocol list is in SupportedTransportProtocols
+	// test the address protocol list is in transports
 	matches := func(supported, test []ma.Protocol) bool {
 		if len(test) > len(supported) {
 			return false
@@ -108,7 +150,7 @@ func AddrUsable(a ma.Multiaddr, partial bool) bool {
 	}
 
 	transport := a.Protocols()
-	for _, supported := range SupportedTransportProtocols {
+	for _, supported := range transports {
 		if matches(supported, transport) {
 			return true
 		}
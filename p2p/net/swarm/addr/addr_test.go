@@ -20,7 +20,7 @@ func TestFilterAddrs(t *testing.T) {
 	bad := []ma.Multiaddr{
 		newMultiaddr(t, "/ip4/1.2.3.4/udp/1234"),           // unreliable
 		newMultiaddr(t, "/ip4/1.2.3.4/udp/1234/sctp/1234"), // not in manet
-		newMultiaddr(t, "/ip4/1.2.3.4/udp/1234/utp"),       // utp is broken
+		newMultiaddr(t, "/ip4/1.2.3.4/udp/1234/utp"),       // utp is opt-in
 		newMultiaddr(t, "/ip4/1.2.3.4/udp/1234/udt"),       // udt is broken on arm
 		newMultiaddr(t, "/ip6/fe80::1/tcp/1234"),           // link local
 		newMultiaddr(t, "/ip6/fe80::100/tcp/1234"),         // link local
@@ -29,6 +29,7 @@ func TestFilterAddrs(t *testing.T) {
 	good := []ma.Multiaddr{
 		newMultiaddr(t, "/ip4/127.0.0.1/tcp/1234"),
 		newMultiaddr(t, "/ip6/::1/tcp/1234"),
+		newMultiaddr(t, "/ip4/127.0.0.1/tcp/1234/ws"),
 	}
 
 	goodAndBad := append(good, bad...)
@@ -58,6 +59,30 @@ func TestFilterAddrs(t *testing.T) {
 	subtestAddrsEqual(t, FilterUsableAddrs(goodAndBad), good)
 }
 
+func TestUtpAddrs(t *testing.T) {
+	utp := newMultiaddr(t, "/ip4/1.2.3.4/udp/1234/utp")
+	if AddrUsable(utp, false) {
+		t.Errorf("addr %s should be unusable without utp", utp)
+	}
+	if !AddrUsableWithUtp(utp, false) {
+		t.Errorf("addr %s should be usable with utp", utp)
+	}
+
+	// raw udp is unreliable, though it is part of the utp transport.
+	udp := newMultiaddr(t, "/ip4/1.2.3.4/udp/1234")
+	if AddrUsableWithUtp(udp, false) {
+		t.Errorf("addr %s should be unusable", udp)
+	}
+	if !AddrUsableWithUtp(udp, true) {
+		t.Errorf("addr %s should be partially usable with utp", udp)
+	}
+
+	tcp := newMultiaddr(t, "/ip4/1.2.3.4/tcp/1234")
+	addrs := []ma.Multiaddr{tcp, utp, udp}
+	subtestAddrsEqual(t, FilterUsableAddrs(addrs), []ma.Multiaddr{tcp})
+	subtestAddrsEqual(t, FilterUsableAddrsWithUtp(addrs), []ma.Multiaddr{tcp, utp})
+}
+
 func subtestAddrsEqual(t *testing.T, a, b []ma.Multiaddr) {
 	if len(a) != len(b) {
 		t.Error(t)
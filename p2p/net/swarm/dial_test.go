@@ -440,3 +440,64 @@ func TestDialBackoffClears(t *testing.T) {
 		t.Log("correctly cleared backoff")
 	}
 }
+
+func TestAddrTiers(t *testing.T) {
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/127.0.0.1/tcp/4002/ws"),
+		ma.StringCast("/ip4/127.0.0.1/tcp/4001"),
+		ma.StringCast("/ip4/127.0.0.1/udp/4001/utp"),
+		ma.StringCast("/ip6/::1/tcp/4001"),
+	}
+
+	tiers := addrTiers(addrs)
+	if len(tiers) != 3 {
+		t.Fatalf("expected 3 tiers, got %v", tiers)
+	}
+	if len(tiers[0]) != 2 {
+		t.Fatalf("tcp addrs should be dialed first, got %v", tiers[0])
+	}
+	if len(tiers[1]) != 1 || !tiers[1][0].Equal(addrs[2]) {
+		t.Fatalf("utp should be dialed second, got %v", tiers[1])
+	}
+	if len(tiers[2]) != 1 || !tiers[2][0].Equal(addrs[0]) {
+		t.Fatalf("websockets should be dialed last, got %v", tiers[2])
+	}
+}
+
+func TestDialFallback(t *testing.T) {
+	// utp before tcp, for a silent utp addr to fall back from
+	defer func(pref []int) { TransportPreference = pref }(TransportPreference)
+	TransportPreference = []int{ma.P_UTP, ma.P_TCP}
+
+	ctx := context.Background()
+	s1, s2 := makeSwarm(ctx, t, nil, true), makeSwarm(ctx, t, nil, false)
+	defer s1.Close()
+	defer s2.Close()
+
+	// a utp addr of s2 nothing answers on, preferred over its tcp one.
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	udpAddr, err := manet.FromNetAddr(silent.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	utpAddr := udpAddr.Encapsulate(ma.StringCast("/utp"))
+
+	s1.peers.AddAddr(s2.LocalPeer(), utpAddr, peer.PermanentAddrTTL)
+	s1.peers.AddAddr(s2.LocalPeer(), s2.ListenAddresses()[0], peer.PermanentAddrTTL)
+
+	before := time.Now()
+	c, err := s1.Dial(ctx, s2.LocalPeer())
+	if err != nil {
+		t.Fatal("dial should have fallen back on tcp:", err)
+	}
+	if time.Since(before) < DialFallbackDelay {
+		t.Error("tcp was dialed before the fallback delay")
+	}
+	if !c.RemoteMultiaddr().Equal(s2.ListenAddresses()[0]) {
+		t.Errorf("connected over %s, not the tcp addr", c.RemoteMultiaddr())
+	}
+}
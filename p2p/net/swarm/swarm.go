@@ -10,6 +10,7 @@ import (
 	metrics "github.com/ipfs/go-ipfs/metrics"
 	inet "github.com/ipfs/go-ipfs/p2p/net"
 	filter "github.com/ipfs/go-ipfs/p2p/net/filter"
+	pnet "github.com/ipfs/go-ipfs/p2p/net/pnet"
 	addrutil "github.com/ipfs/go-ipfs/p2p/net/swarm/addr"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
@@ -51,6 +52,14 @@ type Swarm struct {
 	notifmu sync.RWMutex
 	notifs  map[inet.Notifiee]ps.Notifiee
 
+	relaymu sync.Mutex
+	relayd  RelayDialer
+
+	// psk limits the swarm to a private network, if set. It is fixed
+	// when the swarm is made, before it listens.
+	psk *pnet.PSK
+	utp bool
+
 	// filters for addresses that shouldnt be dialed
 	Filters *filter.Filters
 
@@ -58,11 +67,14 @@ type Swarm struct {
 	bwc metrics.Reporter
 }
 
-// NewSwarm constructs a Swarm, with a Chan.
+// NewSwarm constructs a Swarm, with a Chan. If psk isn't nil, the swarm is
+// limited to the private network of the peers holding psk: all its conns
+// are encrypted with psk, and those to peers without it fail. If utp is
+// set, the swarm listens and dials on the utp transports too.
 func NewSwarm(ctx context.Context, listenAddrs []ma.Multiaddr,
-	local peer.ID, peers peer.Peerstore, bwc metrics.Reporter) (*Swarm, error) {
+	local peer.ID, peers peer.Peerstore, bwc metrics.Reporter, psk *pnet.PSK, utp bool) (*Swarm, error) {
 
-	listenAddrs, err := filterAddrs(listenAddrs)
+	listenAddrs, err := filterAddrs(listenAddrs, utp)
 	if err != nil {
 		return nil, err
 	}
@@ -75,6 +87,8 @@ func NewSwarm(ctx context.Context, listenAddrs []ma.Multiaddr,
 		dialT:   DialTimeout,
 		notifs:  make(map[inet.Notifiee]ps.Notifiee),
 		bwc:     bwc,
+		psk:     psk,
+		utp:     utp,
 		Filters: new(filter.Filters),
 	}
 
@@ -90,9 +104,9 @@ func (s *Swarm) teardown() error {
 }
 
 // CtxGroup returns the Context Group of the swarm
-func filterAddrs(listenAddrs []ma.Multiaddr) ([]ma.Multiaddr, error) {
+func filterAddrs(listenAddrs []ma.Multiaddr, utp bool) ([]ma.Multiaddr, error) {
 	if len(listenAddrs) > 0 {
-		filtered := addrutil.FilterUsableAddrs(listenAddrs)
+		filtered := filterUsableAddrs(listenAddrs, utp)
 		if len(filtered) < 1 {
 			return nil, fmt.Errorf("swarm cannot use any addr in: %s", listenAddrs)
 		}
@@ -103,7 +117,7 @@ func filterAddrs(listenAddrs []ma.Multiaddr) ([]ma.Multiaddr, error) {
 
 // CtxGroup returns the Context Group of the swarm
 func (s *Swarm) Listen(addrs ...ma.Multiaddr) error {
-	addrs, err := filterAddrs(addrs)
+	addrs, err := filterAddrs(addrs, s.utp)
 	if err != nil {
 		return err
 	}
@@ -111,6 +125,22 @@ func (s *Swarm) Listen(addrs ...ma.Multiaddr) error {
 	return s.listen(addrs)
 }
 
+// addrUsable returns whether a swarm, with utp enabled or not, can use addr.
+func addrUsable(addr ma.Multiaddr, partial, utp bool) bool {
+	if utp {
+		return addrutil.AddrUsableWithUtp(addr, partial)
+	}
+	return addrutil.AddrUsable(addr, partial)
+}
+
+// filterUsableAddrs keeps the addrs a swarm, with utp enabled or not, can use.
+func filterUsableAddrs(addrs []ma.Multiaddr, utp bool) []ma.Multiaddr {
+	if utp {
+		return addrutil.FilterUsableAddrsWithUtp(addrs)
+	}
+	return addrutil.FilterUsableAddrs(addrs)
+}
+
 // CtxGroup returns the Context Group of the swarm
 func (s *Swarm) CtxGroup() ctxgroup.ContextGroup {
 	return s.cg
@@ -66,13 +66,25 @@ func TestFilterAddrs(t *testing.T) {
 	ps := peer.NewPeerstore()
 	ctx := context.Background()
 
-	if _, err := NewNetwork(ctx, bad, id, ps, metrics.NewBandwidthCounter()); err == nil {
+	if _, err := NewNetwork(ctx, bad, id, ps, metrics.NewBandwidthCounter(), nil, false); err == nil {
 		t.Fatal("should have failed to create swarm")
 	}
 
-	if _, err := NewNetwork(ctx, goodAndBad, id, ps, metrics.NewBandwidthCounter()); err != nil {
+	if _, err := NewNetwork(ctx, goodAndBad, id, ps, metrics.NewBandwidthCounter(), nil, false); err != nil {
 		t.Fatal("should have succeeded in creating swarm", err)
 	}
+
+	// utp is usable on the swarms made with it enabled only
+	utp := []ma.Multiaddr{m("/ip4/127.0.0.1/udp/0/utp")}
+	if _, err := NewNetwork(ctx, utp, id, ps, metrics.NewBandwidthCounter(), nil, false); err == nil {
+		t.Fatal("should have failed to create swarm without utp")
+	}
+
+	n, err := NewNetwork(ctx, utp, id, ps, metrics.NewBandwidthCounter(), nil, true)
+	if err != nil {
+		t.Fatal("should have succeeded in creating swarm with utp", err)
+	}
+	n.Close()
 }
 
 func subtestAddrsEqual(t *testing.T, a, b []ma.Multiaddr) {
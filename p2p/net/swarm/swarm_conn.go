@@ -25,6 +25,13 @@ import (
 // layers do build up pieces of functionality. and they're all just io.RW :) )
 type Conn ps.Conn
 
+// connGroup is the type of the groups of conns other than their peer.
+type connGroup int
+
+// outboundGroup is the group of the connections the swarm dialed, rather
+// than accepted.
+const outboundGroup connGroup = 0
+
 // ConnHandler is called when new conns are opened from remote peers.
 // See peerstream.ConnHandler
 type ConnHandler func(*Conn)
@@ -45,6 +52,11 @@ func (c *Conn) String() string {
 	return fmt.Sprintf("<SwarmConn %s>", c.RawConn())
 }
 
+// Outbound returns whether the connection was dialed from this side.
+func (c *Conn) Outbound() bool {
+	return c.StreamConn().InGroup(outboundGroup)
+}
+
 // LocalMultiaddr is the Multiaddr on this side
 func (c *Conn) LocalMultiaddr() ma.Multiaddr {
 	return c.RawConn().LocalMultiaddr()
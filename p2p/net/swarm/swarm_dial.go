@@ -8,9 +8,10 @@ import (
 	"sync"
 	"time"
 
-	mconn "github.com/ipfs/go-ipfs/metrics/conn"
+	ic "github.com/ipfs/go-ipfs/p2p/crypto"
 	conn "github.com/ipfs/go-ipfs/p2p/net/conn"
 	addrutil "github.com/ipfs/go-ipfs/p2p/net/swarm/addr"
+	websocket "github.com/ipfs/go-ipfs/p2p/net/websocket"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	lgbl "github.com/ipfs/go-ipfs/util/eventlog/loggables"
 
@@ -48,6 +49,46 @@ const dialAttempts = 1
 // subcomponent of Dial)
 var DialTimeout time.Duration = time.Second * 10
 
+// DialFallbackDelay is how long the dials over a peer's addresses of one
+// transport get to succeed before those of the next in TransportPreference
+// start too. They start sooner if all the dials before them have failed.
+var DialFallbackDelay = time.Millisecond * 300
+
+// TransportPreference orders the transports to dial a peer over: tcp
+// first, then utp, on the swarms made with utp enabled, falling back on
+// websockets.
+var TransportPreference = []int{ma.P_TCP, ma.P_UTP, websocket.P_WS}
+
+// transportRank returns the place of addr's transport in TransportPreference.
+func transportRank(addr ma.Multiaddr) int {
+	protos := addr.Protocols()
+	last := protos[len(protos)-1].Code
+	for i, code := range TransportPreference {
+		if code == last {
+			return i
+		}
+	}
+	return len(TransportPreference)
+}
+
+// addrTiers groups addrs by transport, in the order of TransportPreference.
+// Each tier is permuted so we try different addrs first each time.
+func addrTiers(addrs []ma.Multiaddr) [][]ma.Multiaddr {
+	byRank := make([][]ma.Multiaddr, len(TransportPreference)+1)
+	for _, i := range rand.Perm(len(addrs)) {
+		r := transportRank(addrs[i])
+		byRank[r] = append(byRank[r], addrs[i])
+	}
+
+	var tiers [][]ma.Multiaddr
+	for _, tier := range byRank {
+		if len(tier) > 0 {
+			tiers = append(tiers, tier)
+		}
+	}
+	return tiers
+}
+
 // dialsync is a small object that helps manage ongoing dials.
 // this way, if we receive many simultaneous dial requests, one
 // can do its thing, while the rest wait.
@@ -286,6 +327,38 @@ func (s *Swarm) dial(ctx context.Context, p peer.ID) (*Conn, error) {
 		log.Debug("Dial not given PrivateKey, so WILL NOT SECURE conn.")
 	}
 
+	connC, err := s.dialDirect(ctx, p, sk)
+	if rd := s.relayDialer(); err != nil && rd != nil {
+		// p may be behind a NAT, or otherwise undialable. try relays.
+		log.Debugf("%s swarm dialing %s through relays: %s", s.local, p, err)
+		var rerr error
+		if connC, rerr = rd(ctx, p); rerr != nil {
+			err = fmt.Errorf("%s; through relays: %s", err, rerr)
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		logdial["error"] = err
+		return nil, err
+	}
+	logdial["netconn"] = lgbl.NetConn(connC)
+
+	// ok try to setup the new connection.
+	defer log.EventBegin(ctx, "swarmDialDoSetup", logdial, lgbl.NetConn(connC)).Done()
+	swarmC, err := dialConnSetup(ctx, s, connC)
+	if err != nil {
+		logdial["error"] = err
+		connC.Close() // close the connection. didn't work out :(
+		return nil, err
+	}
+
+	logdial["dial"] = "success"
+	return swarmC, nil
+}
+
+// dialDirect dials p over its own addresses, securing the conn with sk.
+func (s *Swarm) dialDirect(ctx context.Context, p peer.ID, sk ic.PrivKey) (conn.Conn, error) {
 	// get our own addrs. try dialing out from our listener addresses (reusing ports)
 	// Note that using our peerstore's addresses here is incorrect, as that would
 	// include observed addresses. TODO: make peerstore's address book smarter.
@@ -297,7 +370,7 @@ func (s *Swarm) dial(ctx context.Context, p peer.ID) (*Conn, error) {
 	// get remote peer addrs
 	remoteAddrs := s.peers.Addrs(p)
 	// make sure we can use the addresses.
-	remoteAddrs = addrutil.FilterUsableAddrs(remoteAddrs)
+	remoteAddrs = filterUsableAddrs(remoteAddrs, s.utp)
 	// drop out any addrs that would just dial ourselves. use ListenAddresses
 	// as that is a more authoritative view than localAddrs.
 	ila, _ := s.InterfaceListenAddresses()
@@ -306,52 +379,33 @@ func (s *Swarm) dial(ctx context.Context, p peer.ID) (*Conn, error) {
 
 	log.Debugf("%s swarm dialing %s -- local:%s remote:%s", s.local, p, s.ListenAddresses(), remoteAddrs)
 	if len(remoteAddrs) == 0 {
-		err := errors.New("peer has no addresses")
-		logdial["error"] = err
-		return nil, err
+		return nil, errors.New("peer has no addresses")
 	}
 
 	remoteAddrs = s.filterAddrs(remoteAddrs)
 	if len(remoteAddrs) == 0 {
-		err := errors.New("all adresses for peer have been filtered out")
-		logdial["error"] = err
-		return nil, err
+		return nil, errors.New("all adresses for peer have been filtered out")
 	}
 
-	// open connection to peer
-	d := &conn.Dialer{
+	// try to get a connection to any addr
+	return s.dialAddrs(ctx, s.Dialer(sk), p, remoteAddrs)
+}
+
+// Dialer returns a dialer opening conns as the swarm does: from its listen
+// addresses, over any of its transports, through its private network, and
+// secured with sk. The conns it opens are not added to the swarm.
+func (s *Swarm) Dialer(sk ic.PrivKey) *conn.Dialer {
+	return &conn.Dialer{
 		Dialer: manet.Dialer{
 			Dialer: net.Dialer{
 				Timeout: s.dialT,
 			},
 		},
 		LocalPeer:  s.local,
-		LocalAddrs: localAddrs,
+		LocalAddrs: s.ListenAddresses(),
 		PrivateKey: sk,
-		Wrapper: func(c manet.Conn) manet.Conn {
-			return mconn.WrapConn(s.bwc, c)
-		},
-	}
-
-	// try to get a connection to any addr
-	connC, err := s.dialAddrs(ctx, d, p, remoteAddrs)
-	if err != nil {
-		logdial["error"] = err
-		return nil, err
-	}
-	logdial["netconn"] = lgbl.NetConn(connC)
-
-	// ok try to setup the new connection.
-	defer log.EventBegin(ctx, "swarmDialDoSetup", logdial, lgbl.NetConn(connC)).Done()
-	swarmC, err := dialConnSetup(ctx, s, connC)
-	if err != nil {
-		logdial["error"] = err
-		connC.Close() // close the connection. didn't work out :(
-		return nil, err
+		Wrapper:    s.wrapConn,
 	}
-
-	logdial["dial"] = "success"
-	return swarmC, nil
 }
 
 func (s *Swarm) dialAddrs(ctx context.Context, d *conn.Dialer, p peer.ID, remoteAddrs []ma.Multiaddr) (conn.Conn, error) {
@@ -370,8 +424,18 @@ func (s *Swarm) dialAddrs(ctx context.Context, d *conn.Dialer, p peer.ID, remote
 	conns := make(chan conn.Conn, len(remoteAddrs))
 	errs := make(chan error, len(remoteAddrs))
 
+	// the dials of each tier report here when they fail, and the tier's
+	// channel is closed once all of them have.
+	tiers := addrTiers(remoteAddrs)
+	tierFailed := make([]chan struct{}, len(tiers))
+	tierErrs := make([]int, len(tiers))
+	var tierLk sync.Mutex
+	for i := range tierFailed {
+		tierFailed[i] = make(chan struct{})
+	}
+
 	// dialSingleAddr is used in the rate-limited async thing below.
-	dialSingleAddr := func(addr ma.Multiaddr) {
+	dialSingleAddr := func(addr ma.Multiaddr, tier int) {
 		connC, err := s.dialAddr(ctx, d, p, addr)
 
 		// check parent still wants our results
@@ -384,10 +448,17 @@ func (s *Swarm) dialAddrs(ctx context.Context, d *conn.Dialer, p peer.ID, remote
 		default:
 		}
 
+		if err == nil && connC == nil {
+			err = fmt.Errorf("failed to dial %s %s", p, addr)
+		}
 		if err != nil {
+			tierLk.Lock()
+			tierErrs[tier]++
+			if tierErrs[tier] == len(tiers[tier]) {
+				close(tierFailed[tier])
+			}
+			tierLk.Unlock()
 			errs <- err
-		} else if connC == nil {
-			errs <- fmt.Errorf("failed to dial %s %s", p, addr)
 		} else {
 			conns <- connC
 		}
@@ -399,20 +470,33 @@ func (s *Swarm) dialAddrs(ctx context.Context, d *conn.Dialer, p peer.ID, remote
 		// rate limiting just in case. at most 10 addrs at once.
 		limiter := ratelimit.NewRateLimiter(process.Background(), 10)
 		limiter.Go(func(worker process.Process) {
-			// permute addrs so we try different sets first each time.
-			for _, i := range rand.Perm(len(remoteAddrs)) {
-				select {
-				case <-foundConn: // if one of them succeeded already
-					break
-				case <-worker.Closing(): // our context was cancelled
-					break
-				default:
+			for t, tier := range tiers {
+				// fall back on this tier when the one before it is slow or failed.
+				if t > 0 {
+					select {
+					case <-tierFailed[t-1]:
+					case <-time.After(DialFallbackDelay):
+					case <-foundConn: // if one of them succeeded already
+						return
+					case <-worker.Closing(): // our context was cancelled
+						return
+					}
 				}
 
-				workerAddr := remoteAddrs[i] // shadow variable to avoid race
-				limiter.LimitedGo(func(worker process.Process) {
-					dialSingleAddr(workerAddr)
-				})
+				for _, addr := range tier {
+					select {
+					case <-foundConn:
+						return
+					case <-worker.Closing():
+						return
+					default:
+					}
+
+					workerAddr, workerTier := addr, t // shadow variables to avoid race
+					limiter.LimitedGo(func(worker process.Process) {
+						dialSingleAddr(workerAddr, workerTier)
+					})
+				}
 			}
 		})
 
@@ -481,6 +565,7 @@ func dialConnSetup(ctx context.Context, s *Swarm, connC conn.Conn) (*Conn, error
 		// connC is closed by caller if we fail.
 		return nil, fmt.Errorf("failed to add conn to ps.Swarm: %s", err)
 	}
+	psC.AddGroup(outboundGroup)
 
 	// ok try to setup the new connection. (newConnSetup will add to group)
 	swarmC, err := s.newConnSetup(ctx, psC)
@@ -0,0 +1,45 @@
+package swarm
+
+import (
+	"errors"
+	"net"
+
+	conn "github.com/ipfs/go-ipfs/p2p/net/conn"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// DialBack dials p at addr over a conn of its own, apart from the conns of
+// the swarm, and closes it once secured. It tells whether p can be dialed
+// at addr, even while we are connected to it already, e.g. for peers that
+// ask whether they are behind a NAT. The conn is dialed from a port of its
+// own rather than from our listeners, so as not to open a way through the
+// NAT of p.
+func (s *Swarm) DialBack(ctx context.Context, p peer.ID, addr ma.Multiaddr) error {
+	if p == s.local {
+		return ErrDialToSelf
+	}
+	if s.Filters.AddrBlocked(addr) {
+		return errors.New("address is filtered out")
+	}
+
+	d := &conn.Dialer{
+		Dialer: manet.Dialer{
+			Dialer: net.Dialer{
+				Timeout: s.dialT,
+			},
+		},
+		LocalPeer:  s.local,
+		PrivateKey: s.peers.PrivKey(s.local),
+		Wrapper:    s.wrapConn,
+	}
+	c, err := s.dialAddr(ctx, d, p, addr)
+	if err != nil {
+		return err
+	}
+	c.Close()
+	return nil
+}
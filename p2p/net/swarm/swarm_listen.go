@@ -3,14 +3,11 @@ package swarm
 import (
 	"fmt"
 
-	mconn "github.com/ipfs/go-ipfs/metrics/conn"
 	inet "github.com/ipfs/go-ipfs/p2p/net"
 	conn "github.com/ipfs/go-ipfs/p2p/net/conn"
-	addrutil "github.com/ipfs/go-ipfs/p2p/net/swarm/addr"
 	lgbl "github.com/ipfs/go-ipfs/util/eventlog/loggables"
 
 	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
-	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
 	ps "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-peerstream"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	multierr "github.com/ipfs/go-ipfs/thirdparty/multierr"
@@ -20,7 +17,7 @@ import (
 func (s *Swarm) listen(addrs []ma.Multiaddr) error {
 
 	for _, addr := range addrs {
-		if !addrutil.AddrUsable(addr, true) {
+		if !addrUsable(addr, true, s.utp) {
 			return fmt.Errorf("cannot use addr: %s", addr)
 		}
 	}
@@ -72,9 +69,7 @@ func (s *Swarm) setupListener(maddr ma.Multiaddr) error {
 	list.SetAddrFilters(s.Filters)
 
 	if cw, ok := list.(conn.ListenerConnWrapper); ok {
-		cw.SetConnWrapper(func(c manet.Conn) manet.Conn {
-			return mconn.WrapConn(s.bwc, c)
-		})
+		cw.SetConnWrapper(s.wrapConn)
 	}
 
 	// AddListener to the peerstream Listener. this will begin accepting connections
@@ -7,6 +7,7 @@ import (
 
 	metrics "github.com/ipfs/go-ipfs/metrics"
 	inet "github.com/ipfs/go-ipfs/p2p/net"
+	pnet "github.com/ipfs/go-ipfs/p2p/net/pnet"
 
 	ctxgroup "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-ctxgroup"
 	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
@@ -20,9 +21,9 @@ type Network Swarm
 
 // NewNetwork constructs a new network and starts listening on given addresses.
 func NewNetwork(ctx context.Context, listen []ma.Multiaddr, local peer.ID,
-	peers peer.Peerstore, bwc metrics.Reporter) (*Network, error) {
+	peers peer.Peerstore, bwc metrics.Reporter, psk *pnet.PSK, utp bool) (*Network, error) {
 
-	s, err := NewSwarm(ctx, listen, local, peers, bwc)
+	s, err := NewSwarm(ctx, listen, local, peers, bwc, psk, utp)
 	if err != nil {
 		return nil, err
 	}
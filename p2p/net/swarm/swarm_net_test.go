@@ -7,6 +7,7 @@ import (
 
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 	inet "github.com/ipfs/go-ipfs/p2p/net"
+	swarm "github.com/ipfs/go-ipfs/p2p/net/swarm"
 	testutil "github.com/ipfs/go-ipfs/p2p/test/util"
 )
 
@@ -75,3 +76,32 @@ func printConns(n inet.Network) string {
 	}
 	return s
 }
+
+// TestConnDirection checks that the conns dialed are outbound on the side
+// which dialed them only.
+func TestConnDirection(t *testing.T) {
+	ctx := context.Background()
+	a := testutil.GenSwarmNetwork(t, ctx)
+	b := testutil.GenSwarmNetwork(t, ctx)
+	defer a.Close()
+	defer b.Close()
+
+	testutil.DivulgeAddresses(b, a)
+	if _, err := a.DialPeer(ctx, b.LocalPeer()); err != nil {
+		t.Fatalf("Failed to dial: %s", err)
+	}
+	<-time.After(100 * time.Millisecond)
+
+	for _, c := range []struct {
+		n        inet.Network
+		outbound bool
+	}{{a, true}, {b, false}} {
+		conns := c.n.Conns()
+		if len(conns) != 1 {
+			t.Fatalf("expected 1 conn, got %d", len(conns))
+		}
+		if out := conns[0].(*swarm.Conn).Outbound(); out != c.outbound {
+			t.Errorf("%s: outbound is %t, expected %t", c.n.LocalPeer(), out, c.outbound)
+		}
+	}
+}
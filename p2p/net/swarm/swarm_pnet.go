@@ -0,0 +1,23 @@
+package swarm
+
+import (
+	mconn "github.com/ipfs/go-ipfs/metrics/conn"
+	pnet "github.com/ipfs/go-ipfs/p2p/net/pnet"
+
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+)
+
+// PrivateNetwork returns the key of the private network of the swarm, or
+// nil if it isn't limited to one.
+func (s *Swarm) PrivateNetwork() *pnet.PSK {
+	return s.psk
+}
+
+// wrapConn wraps the raw conns the swarm dials and accepts, to count their
+// bandwidth, and protect them with the key of its private network.
+func (s *Swarm) wrapConn(c manet.Conn) manet.Conn {
+	if s.psk != nil {
+		c = pnet.Protect(s.psk, c)
+	}
+	return mconn.WrapConn(s.bwc, c)
+}
@@ -0,0 +1,39 @@
+package swarm
+
+import (
+	"testing"
+	"time"
+
+	pnet "github.com/ipfs/go-ipfs/p2p/net/pnet"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+func TestPrivateNetwork(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	psk1, psk2 := new(pnet.PSK), new(pnet.PSK)
+	psk2[0] = 1
+	swarms := []*Swarm{
+		makeSwarm(ctx, t, psk1, false),
+		makeSwarm(ctx, t, psk1, false),
+		makeSwarm(ctx, t, psk2, false),
+	}
+
+	dial := func(s, dst *Swarm) error {
+		s.peers.AddAddrs(dst.local, dst.ListenAddresses(), peer.PermanentAddrTTL)
+		dctx, cancel := context.WithTimeout(ctx, time.Second*5)
+		defer cancel()
+		_, err := s.Dial(dctx, dst.local)
+		return err
+	}
+
+	if err := dial(swarms[0], swarms[1]); err != nil {
+		t.Fatalf("failed to dial a peer with the same key: %s", err)
+	}
+	if err := dial(swarms[0], swarms[2]); err == nil {
+		t.Fatal("dialed a peer with another key")
+	}
+}
@@ -0,0 +1,75 @@
+package swarm
+
+import (
+	"net"
+
+	conn "github.com/ipfs/go-ipfs/p2p/net/conn"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+
+	ps "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-peerstream"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// RelayDialer dials p through another peer relaying the conn, for peers
+// that can't be dialed directly, e.g. behind NATs. The conn must be to p.
+type RelayDialer func(ctx context.Context, p peer.ID) (conn.Conn, error)
+
+// SetRelayDialer has dials which fail to reach peers directly retried
+// with d. A nil d disables relaying.
+func (s *Swarm) SetRelayDialer(d RelayDialer) {
+	s.relaymu.Lock()
+	s.relayd = d
+	s.relaymu.Unlock()
+}
+
+func (s *Swarm) relayDialer() RelayDialer {
+	s.relaymu.Lock()
+	defer s.relaymu.Unlock()
+	return s.relayd
+}
+
+// AddRelayListener has the swarm take the conns l accepts, which must be
+// conn.Conns other peers relayed to us. l has no address of ours, so it is
+// not in ListenAddresses.
+func (s *Swarm) AddRelayListener(l net.Listener) error {
+	sl, err := s.swarm.AddListener(l)
+	if err != nil {
+		return err
+	}
+
+	go func(ctx context.Context, sl *ps.Listener) {
+		for {
+			select {
+			case err, more := <-sl.AcceptErrors():
+				if !more {
+					return
+				}
+				log.Warningf("swarm relay listener accept error: %s", err)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}(s.cg.Context(), sl)
+	return nil
+}
+
+// DialDirect dials p over its own addresses, even if we have conns to it
+// already, e.g. for a direct conn to replace a relayed one.
+func (s *Swarm) DialDirect(ctx context.Context, p peer.ID) (*Conn, error) {
+	if p == s.local {
+		return nil, ErrDialToSelf
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.dialT)
+	defer cancel()
+	connC, err := s.dialDirect(ctx, p, s.peers.PrivKey(s.local))
+	if err != nil {
+		return nil, err
+	}
+	swarmC, err := dialConnSetup(ctx, s, connC)
+	if err != nil {
+		connC.Close()
+		return nil, err
+	}
+	return swarmC, nil
+}
@@ -11,6 +11,8 @@ import (
 
 	metrics "github.com/ipfs/go-ipfs/metrics"
 	inet "github.com/ipfs/go-ipfs/p2p/net"
+	conn "github.com/ipfs/go-ipfs/p2p/net/conn"
+	pnet "github.com/ipfs/go-ipfs/p2p/net/pnet"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	testutil "github.com/ipfs/go-ipfs/util/testutil"
 
@@ -53,23 +55,29 @@ func makeSwarms(ctx context.Context, t *testing.T, num int) []*Swarm {
 	swarms := make([]*Swarm, 0, num)
 
 	for i := 0; i < num; i++ {
-		localnp := testutil.RandPeerNetParamsOrFatal(t)
+		swarms = append(swarms, makeSwarm(ctx, t, nil, false))
+	}
 
-		peerstore := peer.NewPeerstore()
-		peerstore.AddPubKey(localnp.ID, localnp.PubKey)
-		peerstore.AddPrivKey(localnp.ID, localnp.PrivKey)
+	return swarms
+}
 
-		addrs := []ma.Multiaddr{localnp.Addr}
-		swarm, err := NewSwarm(ctx, addrs, localnp.ID, peerstore, metrics.NewBandwidthCounter())
-		if err != nil {
-			t.Fatal(err)
-		}
+// makeSwarm makes a swarm of the private network of psk, or of none if psk
+// is nil, listening on a local address. utp enables the utp transports.
+func makeSwarm(ctx context.Context, t *testing.T, psk *pnet.PSK, utp bool) *Swarm {
+	localnp := testutil.RandPeerNetParamsOrFatal(t)
 
-		swarm.SetStreamHandler(EchoStreamHandler)
-		swarms = append(swarms, swarm)
+	peerstore := peer.NewPeerstore()
+	peerstore.AddPubKey(localnp.ID, localnp.PubKey)
+	peerstore.AddPrivKey(localnp.ID, localnp.PrivKey)
+
+	addrs := []ma.Multiaddr{localnp.Addr}
+	swarm, err := NewSwarm(ctx, addrs, localnp.ID, peerstore, metrics.NewBandwidthCounter(), psk, utp)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	return swarms
+	swarm.SetStreamHandler(EchoStreamHandler)
+	return swarm
 }
 
 func connectSwarms(t *testing.T, ctx context.Context, swarms []*Swarm) {
@@ -328,3 +336,60 @@ func TestFilterBounds(t *testing.T) {
 		fmt.Println("got connect")
 	}
 }
+
+// subtestTransport checks that two swarms listening on listenAddr connect
+// and exchange data over its transport. utp enables the utp transports.
+func subtestTransport(t *testing.T, listenAddr string, utp bool) {
+	ctx := context.Background()
+
+	swarms := make([]*Swarm, 2)
+	for i := range swarms {
+		localnp := testutil.RandPeerNetParamsOrFatal(t)
+
+		peerstore := peer.NewPeerstore()
+		peerstore.AddPubKey(localnp.ID, localnp.PubKey)
+		peerstore.AddPrivKey(localnp.ID, localnp.PrivKey)
+
+		addrs := []ma.Multiaddr{ma.StringCast(listenAddr)}
+		swarm, err := NewSwarm(ctx, addrs, localnp.ID, peerstore, metrics.NewBandwidthCounter(), nil, utp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer swarm.Close()
+
+		swarm.SetStreamHandler(EchoStreamHandler)
+		swarms[i] = swarm
+	}
+
+	laddr := swarms[1].ListenAddresses()[0]
+	if !conn.MultiaddrProtocolsMatch(laddr, ma.StringCast(listenAddr)) {
+		t.Fatalf("listen addr %s should match %s", laddr, listenAddr)
+	}
+
+	connectSwarms(t, ctx, swarms)
+
+	s, err := swarms[0].NewStreamWithPeer(swarms[1].LocalPeer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(s, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "pong" {
+		t.Fatalf("got %q instead of pong", buf)
+	}
+}
+
+func TestWebsocketTransport(t *testing.T) {
+	subtestTransport(t, "/ip4/127.0.0.1/tcp/0/ws", false)
+}
+
+func TestUtpTransport(t *testing.T) {
+	subtestTransport(t, "/ip4/127.0.0.1/udp/0/utp", true)
+}
@@ -0,0 +1,208 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+)
+
+// frame opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+const (
+	finBit  = 0x80
+	maskBit = 0x80
+
+	maxControlPayload = 125
+)
+
+var errBadFrame = errors.New("websocket: malformed frame")
+
+// conn is a manet.Conn reading and writing the payload of binary frames.
+// Each Write is sent as one frame, and Read returns the data of the
+// received frames as a stream, as the swarm expects of a raw connection.
+type conn struct {
+	manet.Conn
+	br *bufio.Reader
+
+	// client conns mask what they send, as RFC 6455 requires of them.
+	client bool
+
+	// remaining is the unread payload of the current data frame.
+	remaining uint64
+	mask      []byte
+	maskPos   int
+
+	wlk       sync.Mutex
+	closeOnce sync.Once
+}
+
+func newConn(c manet.Conn, br *bufio.Reader, client bool) *conn {
+	return &conn{Conn: c, br: br, client: client}
+}
+
+func (c *conn) LocalMultiaddr() ma.Multiaddr {
+	return c.Conn.LocalMultiaddr().Encapsulate(wsAddr)
+}
+
+func (c *conn) RemoteMultiaddr() ma.Multiaddr {
+	return c.Conn.RemoteMultiaddr().Encapsulate(wsAddr)
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if uint64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.br.Read(b)
+	c.unmask(b[:n])
+	c.remaining -= uint64(n)
+	return n, err
+}
+
+// nextFrame reads frame headers up to the next data frame, answering the
+// control frames on the way.
+func (c *conn) nextFrame() error {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return err
+	}
+	op := head[0] & 0x0f
+
+	length := uint64(head[1] &^ maskBit)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	c.mask = nil
+	c.maskPos = 0
+	if head[1]&maskBit != 0 {
+		c.mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.br, c.mask); err != nil {
+			return err
+		}
+	}
+
+	switch op {
+	case opContinuation, opText, opBinary:
+		c.remaining = length
+		return nil
+	case opClose, opPing, opPong:
+		if length > maxControlPayload {
+			return errBadFrame
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return err
+		}
+		c.unmask(payload)
+
+		switch op {
+		case opClose:
+			c.sendClose()
+			return io.EOF
+		case opPing:
+			return c.writeFrame(opPong, payload)
+		}
+		return nil
+	default:
+		return errBadFrame
+	}
+}
+
+func (c *conn) unmask(b []byte) {
+	if c.mask == nil {
+		return
+	}
+	for i := range b {
+		b[i] ^= c.mask[c.maskPos%4]
+		c.maskPos++
+	}
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	if err := c.writeFrame(opBinary, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *conn) writeFrame(op byte, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, finBit|op)
+
+	var maskFlag byte
+	if c.client {
+		maskFlag = maskBit
+	}
+
+	switch l := len(payload); {
+	case l <= maxControlPayload:
+		frame = append(frame, maskFlag|byte(l))
+	case l <= 0xffff:
+		frame = append(frame, maskFlag|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(l))
+	default:
+		frame = append(frame, maskFlag|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(l))
+	}
+
+	if !c.client {
+		frame = append(frame, payload...)
+	} else {
+		mask := make([]byte, 4)
+		if _, err := rand.Read(mask); err != nil {
+			return err
+		}
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	}
+
+	c.wlk.Lock()
+	defer c.wlk.Unlock()
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// sendClose sends the closing frame, once.
+func (c *conn) sendClose() {
+	c.closeOnce.Do(func() {
+		c.writeFrame(opClose, nil)
+	})
+}
+
+func (c *conn) Close() error {
+	c.sendClose()
+	return c.Conn.Close()
+}
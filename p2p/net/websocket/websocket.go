@@ -0,0 +1,194 @@
+// Package websocket implements the /ws swarm transport: raw connections
+// carried in the binary messages of a WebSocket (RFC 6455) over TCP, which
+// is how browser nodes, unable to open plain sockets, reach the swarm.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+var log = u.Logger("websocket")
+
+// acceptGUID is hashed with the client's key to accept the handshake.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// HandshakeTimeout bounds the HTTP upgrade of each connection.
+var HandshakeTimeout = 10 * time.Second
+
+// ErrBadHandshake is returned when the peer does not upgrade to WebSocket.
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// P_WS is the multiaddr protocol code of /ws.
+const P_WS = 477
+
+var wsAddr ma.Multiaddr
+
+func init() {
+	ma.Protocols = append(ma.Protocols, ma.Protocol{
+		Code:  P_WS,
+		Size:  0,
+		Name:  "ws",
+		VCode: ma.CodeToVarint(P_WS),
+	})
+	wsAddr = ma.StringCast("/ws")
+}
+
+// Matches returns whether addr is a WebSocket address, like
+// /ip4/1.2.3.4/tcp/4002/ws.
+func Matches(addr ma.Multiaddr) bool {
+	protos := addr.Protocols()
+	return len(protos) > 0 && protos[len(protos)-1].Code == P_WS
+}
+
+// Listen listens for WebSocket connections on the /ws address laddr.
+func Listen(laddr ma.Multiaddr) (manet.Listener, error) {
+	if !Matches(laddr) {
+		return nil, fmt.Errorf("not a websocket address: %s", laddr)
+	}
+
+	tl, err := manet.Listen(laddr.Decapsulate(wsAddr))
+	if err != nil {
+		return nil, err
+	}
+	return &listener{Listener: tl}, nil
+}
+
+// Dial dials the /ws address raddr with d, and upgrades the connection.
+func Dial(d manet.Dialer, raddr ma.Multiaddr) (manet.Conn, error) {
+	if !Matches(raddr) {
+		return nil, fmt.Errorf("not a websocket address: %s", raddr)
+	}
+
+	tc, err := d.Dial(raddr.Decapsulate(wsAddr))
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := clientHandshake(tc)
+	if err != nil {
+		tc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+type listener struct {
+	manet.Listener
+}
+
+// Accept returns the next connection which completes the handshake.
+func (l *listener) Accept() (manet.Conn, error) {
+	for {
+		tc, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := serverHandshake(tc)
+		if err != nil {
+			log.Debugf("websocket handshake with %s failed: %s", tc.RemoteMultiaddr(), err)
+			tc.Close()
+			continue
+		}
+		return c, nil
+	}
+}
+
+func (l *listener) Multiaddr() ma.Multiaddr {
+	return l.Listener.Multiaddr().Encapsulate(wsAddr)
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerHas(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func serverHandshake(tc manet.Conn) (*conn, error) {
+	tc.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer tc.SetDeadline(time.Time{})
+
+	br := bufio.NewReader(tc)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return nil, err
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if req.Method != "GET" || key == "" ||
+		!headerHas(req.Header, "Connection", "upgrade") ||
+		!headerHas(req.Header, "Upgrade", "websocket") {
+		fmt.Fprintf(tc, "HTTP/1.1 400 Bad Request\r\n\r\n")
+		return nil, ErrBadHandshake
+	}
+
+	_, err = fmt.Fprintf(tc, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return newConn(tc, br, false), nil
+}
+
+func clientHandshake(tc manet.Conn) (*conn, error) {
+	tc.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer tc.SetDeadline(time.Time{})
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	_, host, err := manet.DialArgs(tc.RemoteMultiaddr())
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = fmt.Fprintf(tc, "GET / HTTP/1.1\r\n"+
+		"Host: %s\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n", host, key)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(tc)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, ErrBadHandshake
+	}
+	return newConn(tc, br, true), nil
+}
@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+)
+
+func listenLocal(t *testing.T) manet.Listener {
+	l, err := Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0/ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Matches(l.Multiaddr()) {
+		t.Fatalf("listener addr %s is not a websocket addr", l.Multiaddr())
+	}
+	return l
+}
+
+func TestMatches(t *testing.T) {
+	if !Matches(ma.StringCast("/ip4/1.2.3.4/tcp/4002/ws")) {
+		t.Fatal("should match /ws addr")
+	}
+	if Matches(ma.StringCast("/ip4/1.2.3.4/tcp/4002")) {
+		t.Fatal("should not match tcp addr")
+	}
+}
+
+func TestProtocolRegistered(t *testing.T) {
+	if p := ma.ProtocolWithCode(P_WS); p.Name != "ws" {
+		t.Fatalf("expected /ws registered, got %q", p.Name)
+	}
+	a := ma.StringCast("/ip4/1.2.3.4/tcp/4002/ws")
+	b, err := ma.NewMultiaddrBytes(a.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "/ip4/1.2.3.4/tcp/4002/ws" {
+		t.Fatalf("/ws did not survive its binary form: %s", b)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	l := listenLocal(t)
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer c.Close()
+		io.Copy(c, c)
+	}()
+
+	c, err := Dial(manet.Dialer{}, l.Multiaddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if !Matches(c.RemoteMultiaddr()) || !Matches(c.LocalMultiaddr()) {
+		t.Fatal("conn addrs should be websocket addrs")
+	}
+
+	// small, 16 bit and 64 bit length frames
+	for _, size := range []int{5, 1000, 70000} {
+		data := bytes.Repeat([]byte{byte(size)}, size)
+		if _, err := c.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, size)
+		if _, err := io.ReadFull(c, got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("echo of %d bytes differs", size)
+		}
+	}
+}
+
+func TestCloseEndsRead(t *testing.T) {
+	l := listenLocal(t)
+	defer l.Close()
+
+	accepted := make(chan manet.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+			close(accepted)
+			return
+		}
+		accepted <- c
+	}()
+
+	c, err := Dial(manet.Dialer{}, l.Multiaddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, ok := <-accepted
+	if !ok {
+		t.Fatal("accept failed")
+	}
+	defer sc.Close()
+
+	c.Write([]byte("bye"))
+	c.Close()
+
+	out, err := ioutil.ReadAll(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "bye" {
+		t.Fatalf("read %q before close", out)
+	}
+}
+
+func TestNotWebsocket(t *testing.T) {
+	l := listenLocal(t)
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			c.Close()
+		}
+	}()
+
+	// a plain tcp conn sending garbage is turned away
+	tc, err := manet.Dial(l.Multiaddr().Decapsulate(wsAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.Close()
+	tc.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	resp, _ := ioutil.ReadAll(tc)
+	if !bytes.HasPrefix(resp, []byte("HTTP/1.1 400")) {
+		t.Fatalf("expected a 400, got %q", resp)
+	}
+}
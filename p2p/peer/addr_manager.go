@@ -178,6 +178,31 @@ func (mgr *AddrManager) Addrs(p ID) []ma.Multiaddr {
 	return good
 }
 
+// AddrTTL is a known address, and the time left until it expires.
+type AddrTTL struct {
+	Addr ma.Multiaddr
+	TTL  time.Duration
+}
+
+// AddrTTLs returns the known (and valid) addresses of p, with the time
+// left until each expires, for them to be put back as they were.
+func (mgr *AddrManager) AddrTTLs(p ID) []AddrTTL {
+	mgr.addrmu.Lock()
+	defer mgr.addrmu.Unlock()
+	if mgr.addrs == nil {
+		return nil
+	}
+
+	now := time.Now()
+	var out []AddrTTL
+	for _, m := range mgr.addrs[p] {
+		if !m.ExpiredBy(now) {
+			out = append(out, AddrTTL{Addr: m.Addr, TTL: m.TTL.Sub(now)})
+		}
+	}
+	return out
+}
+
 // ClearAddresses removes all previously stored addresses
 func (mgr *AddrManager) ClearAddrs(p ID) {
 	mgr.addrmu.Lock()
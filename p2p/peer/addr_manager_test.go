@@ -178,3 +178,30 @@ func TestClearWorks(t *testing.T) {
 	testHas(t, nil, m.Addrs(id1))
 	testHas(t, nil, m.Addrs(id2))
 }
+
+func TestAddrTTLs(t *testing.T) {
+	id1 := IDS(t, "QmcNstKuwBBoVTpSCSDrwzjgrRcaYXK833Psuz2EMHwyQN")
+	ma11 := MA(t, "/ip4/1.2.3.1/tcp/1111")
+	ma12 := MA(t, "/ip4/2.2.3.2/tcp/2222")
+
+	m := AddrManager{}
+	m.AddAddr(id1, ma11, time.Hour)
+	m.AddAddr(id1, ma12, PermanentAddrTTL)
+	ttls := m.AddrTTLs(id1)
+
+	// put back after a clear, they expire as they did
+	m.ClearAddrs(id1)
+	for _, a := range ttls {
+		m.AddAddr(id1, a.Addr, a.TTL)
+	}
+	testHas(t, []ma.Multiaddr{ma11, ma12}, m.Addrs(id1))
+	for _, a := range m.AddrTTLs(id1) {
+		want := time.Hour
+		if a.Addr.Equal(ma12) {
+			want = PermanentAddrTTL
+		}
+		if a.TTL > want || a.TTL < want-time.Minute {
+			t.Fatalf("expected %s to expire in %s, got %s", a.Addr, want, a.TTL)
+		}
+	}
+}
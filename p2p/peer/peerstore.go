@@ -61,6 +61,10 @@ type AddrBook interface {
 	// Addresses returns all known (and valid) addresses for a given
 	Addrs(p ID) []ma.Multiaddr
 
+	// AddrTTLs returns the known addresses of p with the time left until
+	// each expires.
+	AddrTTLs(p ID) []AddrTTL
+
 	// ClearAddresses removes all previously stored addresses
 	ClearAddrs(p ID)
 }
@@ -0,0 +1,452 @@
+// Package autonat implements a protocol by which peers dial each other
+// back, for nodes to learn whether they can be dialed at the addresses
+// they advertise, or are behind a NAT or firewall.
+package autonat
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	ggio "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/io"
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	host "github.com/ipfs/go-ipfs/p2p/host"
+	inet "github.com/ipfs/go-ipfs/p2p/net"
+	swarm "github.com/ipfs/go-ipfs/p2p/net/swarm"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
+	pb "github.com/ipfs/go-ipfs/p2p/protocol/autonat/pb"
+	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
+)
+
+var log = eventlog.Logger("p2p/protocol/autonat")
+
+// ID is the protocol.ID of AutoNAT.
+//
+// the protocol is very simple: the asking side sends a DIAL message with
+// its addresses, which the other side dials, each over a conn of its own,
+// and answers with those it could dial and those it couldn't.
+const ID protocol.ID = "/libp2p/autonat/1.0.0"
+
+const (
+	// maxMessageSize bounds the messages read.
+	maxMessageSize = 4096
+
+	// maxDialBackAddrs bounds the addresses dialed back for a request, and
+	// maxDialBacks the requests served at once.
+	maxDialBackAddrs = 8
+	maxDialBacks     = 4
+
+	// dialBackTimeout bounds the dial back to each address, and
+	// requestTimeout asking a peer to dial us back.
+	dialBackTimeout = 15 * time.Second
+	requestTimeout  = time.Minute
+
+	// checkDelay is how long after starting the node first checks its
+	// reachability, retryInterval how often it checks again while it is
+	// unknown, and refreshInterval once it is known.
+	checkDelay      = 15 * time.Second
+	retryInterval   = time.Minute
+	refreshInterval = 15 * time.Minute
+
+	// peersAnswering is how many peers are to answer a check, of the
+	// maxPeersAsked connected ones asked.
+	peersAnswering = 2
+	maxPeersAsked  = 5
+)
+
+// Reachability is whether the node can be dialed by peers of the
+// internet.
+type Reachability int
+
+const (
+	// ReachabilityUnknown is until peers answer.
+	ReachabilityUnknown Reachability = iota
+	// ReachabilityPublic is when peers could dial some address of the node.
+	ReachabilityPublic
+	// ReachabilityPrivate is when they couldn't dial any, e.g. behind a NAT.
+	ReachabilityPrivate
+)
+
+func (r Reachability) String() string {
+	switch r {
+	case ReachabilityPublic:
+		return "public"
+	case ReachabilityPrivate:
+		return "private"
+	default:
+		return "unknown"
+	}
+}
+
+// addrsHost is implemented by the hosts whose addresses can be filtered,
+// which leave out of Addrs those found unreachable.
+type addrsHost interface {
+	AllAddrs() []ma.Multiaddr
+	SetAddrsFilter(func(ma.Multiaddr) bool)
+}
+
+// AutoNAT dials peers back at their addresses when they ask, and asks
+// them to dial it back in turn, to learn the reachability of the node.
+type AutoNAT struct {
+	host  host.Host
+	swarm *swarm.Swarm
+	ctx   context.Context
+
+	// dialBacks bounds the requests served at once.
+	dialBacks chan struct{}
+	// dialsPrivate has private addresses dialed back too, for tests.
+	dialsPrivate bool
+
+	mx     sync.Mutex
+	status Reachability
+	// addrs holds whether the addresses of ours that peers dialed back,
+	// by String, could be dialed the last time they were.
+	addrs map[string]bool
+}
+
+// NewAutoNAT sets up AutoNAT for h, which must be on a swarm.Network, until
+// ctx is done. The addresses peers can't dial are left out of those of h,
+// when it can filter them.
+func NewAutoNAT(ctx context.Context, h host.Host) (*AutoNAT, error) {
+	return newAutoNAT(ctx, h, false)
+}
+
+func newAutoNAT(ctx context.Context, h host.Host, dialsPrivate bool) (*AutoNAT, error) {
+	n, ok := h.Network().(*swarm.Network)
+	if !ok {
+		return nil, errors.New("autonat needs a swarm network")
+	}
+
+	a := &AutoNAT{
+		host:         h,
+		swarm:        n.Swarm(),
+		ctx:          ctx,
+		dialBacks:    make(chan struct{}, maxDialBacks),
+		dialsPrivate: dialsPrivate,
+		addrs:        make(map[string]bool),
+	}
+	h.SetStreamHandler(ID, a.handleStream)
+	if ah, ok := h.(addrsHost); ok {
+		ah.SetAddrsFilter(a.reachable)
+	}
+
+	go a.background()
+	go func() {
+		<-ctx.Done()
+		h.RemoveStreamHandler(ID)
+		if ah, ok := h.(addrsHost); ok {
+			ah.SetAddrsFilter(nil)
+		}
+	}()
+	return a, nil
+}
+
+// Status returns the reachability of the node, as of the last check.
+func (a *AutoNAT) Status() Reachability {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	return a.status
+}
+
+// reachable returns false for the addresses found unreachable.
+func (a *AutoNAT) reachable(addr ma.Multiaddr) bool {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	ok, found := a.addrs[addr.String()]
+	return ok || !found
+}
+
+func (a *AutoNAT) background() {
+	delay := checkDelay
+	for {
+		select {
+		case <-time.After(delay):
+		case <-a.ctx.Done():
+			return
+		}
+
+		a.check()
+		delay = refreshInterval
+		if a.Status() == ReachabilityUnknown {
+			delay = retryInterval
+		}
+	}
+}
+
+// check asks connected peers to dial us back at our public addresses, and
+// updates the reachability of the node with their answers.
+func (a *AutoNAT) check() {
+	peers := a.host.Network().Peers()
+	if len(peers) == 0 {
+		return
+	}
+
+	addrs := a.publicAddrs()
+	if len(addrs) == 0 {
+		// with no address peers of the internet could dial, none will.
+		a.setStatus(ReachabilityPrivate, nil, nil)
+		return
+	}
+
+	var reachable, unreachable []ma.Multiaddr
+	var answers int
+	for i, j := range rand.Perm(len(peers)) {
+		if i >= maxPeersAsked || answers >= peersAnswering {
+			break
+		}
+		r, u, err := a.askDialBack(peers[j], addrs)
+		if err != nil {
+			log.Debugf("autonat: asking %s to dial back: %s", peers[j], err)
+			continue
+		}
+		answers++
+		reachable = append(reachable, r...)
+		unreachable = append(unreachable, u...)
+	}
+	if answers == 0 {
+		return
+	}
+
+	status := ReachabilityPrivate
+	if len(reachable) > 0 {
+		status = ReachabilityPublic
+	}
+	a.setStatus(status, reachable, unreachable)
+}
+
+// setStatus records the reachability of the node, and of its addresses
+// dialed back. An address one peer could dial is reachable, whatever
+// others found.
+func (a *AutoNAT) setStatus(status Reachability, reachable, unreachable []ma.Multiaddr) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if status != a.status {
+		log.Infof("autonat: reachability is %s", status)
+	}
+	a.status = status
+	checked := make(map[string]bool)
+	for _, addr := range unreachable {
+		checked[addr.String()] = false
+	}
+	for _, addr := range reachable {
+		checked[addr.String()] = true
+	}
+	for s, ok := range checked {
+		a.addrs[s] = ok
+	}
+}
+
+// publicAddrs returns those of our addresses peers of the internet could
+// dial, unfiltered.
+func (a *AutoNAT) publicAddrs() []ma.Multiaddr {
+	var addrs []ma.Multiaddr
+	if ah, ok := a.host.(addrsHost); ok {
+		addrs = ah.AllAddrs()
+	} else {
+		addrs = a.host.Addrs()
+	}
+
+	var out []ma.Multiaddr
+	for _, addr := range addrs {
+		if a.dialsPrivate || isPublicAddr(addr) {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// askDialBack asks p to dial us back at addrs, and returns those it could
+// dial and those it couldn't.
+func (a *AutoNAT) askDialBack(p peer.ID, addrs []ma.Multiaddr) (reachable, unreachable []ma.Multiaddr, err error) {
+	s, err := a.host.NewStream(ID, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer s.Close()
+	t := time.AfterFunc(requestTimeout, func() { s.Close() })
+	defer t.Stop()
+
+	req := &pb.Message{
+		Type: pb.Message_DIAL.Enum(),
+		Dial: &pb.Message_Dial{},
+	}
+	for _, addr := range addrs {
+		req.Dial.Addrs = append(req.Dial.Addrs, addr.Bytes())
+	}
+	if err := ggio.NewDelimitedWriter(s).WriteMsg(req); err != nil {
+		return nil, nil, err
+	}
+
+	var m pb.Message
+	if err := ggio.NewDelimitedReader(s, maxMessageSize).ReadMsg(&m); err != nil {
+		return nil, nil, err
+	}
+	res := m.GetDialResponse()
+	if m.GetType() != pb.Message_DIAL_RESPONSE || res == nil {
+		return nil, nil, errors.New("expected a dial response")
+	}
+	if res.GetStatus() != pb.Message_OK {
+		return nil, nil, errors.New(res.GetStatus().String() + ": " + res.GetStatusText())
+	}
+
+	return addrsFromPb(res.GetReachable()), addrsFromPb(res.GetUnreachable()), nil
+}
+
+// handleStream dials the peer of s back at the addresses it asks for.
+func (a *AutoNAT) handleStream(s inet.Stream) {
+	defer s.Close()
+
+	var m pb.Message
+	if err := ggio.NewDelimitedReader(s, maxMessageSize).ReadMsg(&m); err != nil {
+		log.Debugf("autonat: bad message from %s: %s", s.Conn().RemotePeer(), err)
+		return
+	}
+	var res *pb.Message_DialResponse
+	if m.GetType() != pb.Message_DIAL {
+		res = dialResponse(pb.Message_E_BAD_REQUEST, "expected a dial request")
+	} else {
+		res = a.dialBack(s.Conn(), m.GetDial().GetAddrs())
+	}
+
+	out := &pb.Message{
+		Type:         pb.Message_DIAL_RESPONSE.Enum(),
+		DialResponse: res,
+	}
+	if err := ggio.NewDelimitedWriter(s).WriteMsg(out); err != nil {
+		log.Debugf("autonat: answering %s: %s", s.Conn().RemotePeer(), err)
+	}
+}
+
+// dialBack dials the peer of c at addrs. Only the addresses at the IP c
+// comes from are dialed, so peers can't have us dial others.
+func (a *AutoNAT) dialBack(c inet.Conn, addrs [][]byte) *pb.Message_DialResponse {
+	select {
+	case a.dialBacks <- struct{}{}:
+		defer func() { <-a.dialBacks }()
+	default:
+		return dialResponse(pb.Message_E_INTERNAL_ERROR, "too many dial backs at once")
+	}
+
+	p := c.RemotePeer()
+	observed := addrIP(c.RemoteMultiaddr())
+	res := dialResponse(pb.Message_OK, "")
+	var dialed int
+	for _, b := range addrs {
+		if dialed >= maxDialBackAddrs {
+			break
+		}
+		addr, err := ma.NewMultiaddrBytes(b)
+		if err != nil {
+			return dialResponse(pb.Message_E_BAD_REQUEST, "invalid address")
+		}
+		ip := addrIP(addr)
+		if ip == nil || observed == nil || !ip.Equal(observed) {
+			continue
+		}
+		if !a.dialsPrivate && !isPublicAddr(addr) {
+			continue
+		}
+
+		dialed++
+		ctx, cancel := context.WithTimeout(a.ctx, dialBackTimeout)
+		err = a.swarm.DialBack(ctx, p, addr)
+		cancel()
+		if err != nil {
+			log.Debugf("autonat: dialing %s back at %s: %s", p, addr, err)
+			res.Unreachable = append(res.Unreachable, b)
+		} else {
+			res.Reachable = append(res.Reachable, b)
+		}
+	}
+	if dialed == 0 {
+		return dialResponse(pb.Message_E_DIAL_REFUSED, "no address to dial back")
+	}
+	return res
+}
+
+func dialResponse(status pb.Message_Status, text string) *pb.Message_DialResponse {
+	res := &pb.Message_DialResponse{Status: status.Enum()}
+	if text != "" {
+		res.StatusText = &text
+	}
+	return res
+}
+
+func addrsFromPb(bs [][]byte) []ma.Multiaddr {
+	var addrs []ma.Multiaddr
+	for _, b := range bs {
+		addr, err := ma.NewMultiaddrBytes(b)
+		if err != nil {
+			log.Debugf("autonat: skipping invalid address: %s", err)
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// addrIP returns the IP addr is over, or nil if it isn't over one.
+func addrIP(addr ma.Multiaddr) net.IP {
+	na, err := manet.ToNetAddr(addr)
+	if err != nil {
+		return nil
+	}
+	switch na := na.(type) {
+	case *net.TCPAddr:
+		return na.IP
+	case *net.UDPAddr:
+		return na.IP
+	case *net.IPAddr:
+		return na.IP
+	default:
+		return nil
+	}
+}
+
+// privateNetworks are the IP ranges which are not routed on the internet.
+var privateNetworks = parseCIDRs(
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, s := range cidrs {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isPublicAddr returns whether addr is over an IP routed on the internet.
+func isPublicAddr(addr ma.Multiaddr) bool {
+	ip := addrIP(addr)
+	if ip == nil || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package autonat
+
+import (
+	"net"
+	"testing"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	bhost "github.com/ipfs/go-ipfs/p2p/host/basic"
+	testutil "github.com/ipfs/go-ipfs/p2p/test/util"
+)
+
+// natHosts returns two connected hosts with AutoNAT, dialing back the
+// loopback addresses they listen on.
+func natHosts(t *testing.T, ctx context.Context) (a, b *bhost.BasicHost, an *AutoNAT) {
+	a = testutil.GenHostSwarm(t, ctx)
+	b = testutil.GenHostSwarm(t, ctx)
+	an, err := newAutoNAT(ctx, a, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newAutoNAT(ctx, b, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Connect(ctx, b.Peerstore().PeerInfo(b.ID())); err != nil {
+		t.Fatal(err)
+	}
+	return a, b, an
+}
+
+func TestAutoNATPublic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, _, an := natHosts(t, ctx)
+	if an.Status() != ReachabilityUnknown {
+		t.Fatalf("expected an unknown reachability before checking, got %s", an.Status())
+	}
+
+	an.check()
+	if an.Status() != ReachabilityPublic {
+		t.Fatalf("expected a public reachability, got %s", an.Status())
+	}
+	if len(a.Addrs()) != len(a.AllAddrs()) {
+		t.Fatalf("reachable addresses were filtered out: %v", a.Addrs())
+	}
+}
+
+func TestAutoNATDialBack(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, b, an := natHosts(t, ctx)
+
+	// nothing listens at the port of a closed listener
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed, err := manet.FromNetAddr(l.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	// b is not asked to dial others than a
+	other, err := ma.NewMultiaddr("/ip4/8.8.8.8/tcp/4001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good := a.AllAddrs()[0]
+	reachable, unreachable, err := an.askDialBack(b.ID(), []ma.Multiaddr{good, closed, other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reachable) != 1 || !reachable[0].Equal(good) {
+		t.Fatalf("expected %s to be reachable, got %v", good, reachable)
+	}
+	if len(unreachable) != 1 || !unreachable[0].Equal(closed) {
+		t.Fatalf("expected %s to be unreachable, got %v", closed, unreachable)
+	}
+
+	// b refuses to dial back addresses of others only
+	if _, _, err := an.askDialBack(b.ID(), []ma.Multiaddr{other}); err == nil {
+		t.Fatal("expected the dial back to be refused")
+	}
+
+	// the addresses found unreachable are not advertised
+	an.setStatus(ReachabilityPrivate, nil, a.AllAddrs())
+	if addrs := a.Addrs(); len(addrs) != 0 {
+		t.Fatalf("advertising unreachable addresses: %v", addrs)
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	cases := map[string]bool{
+		"/ip4/8.8.8.8/tcp/4001":         true,
+		"/ip6/2001:4860::8888/tcp/4001": true,
+		"/ip4/127.0.0.1/tcp/4001":       false,
+		"/ip4/192.168.1.10/tcp/4001":    false,
+		"/ip4/100.64.3.4/udp/4001/utp":  false,
+		"/ip6/fe80::1/tcp/4001":         false,
+		"/ip4/0.0.0.0/tcp/4001":         false,
+	}
+	for s, public := range cases {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isPublicAddr(addr) != public {
+			t.Errorf("isPublicAddr(%s) should be %t", s, public)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Code generated by protoc-gen-gogo.
+// source: autonat.proto
+// DO NOT EDIT!
+
+/*
+Package autonat_pb is a generated protocol buffer package.
+
+It is generated from these files:
+	autonat.proto
+
+It has these top-level messages:
+	Message
+*/
+package autonat_pb
+
+import proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+type Message_MessageType int32
+
+const (
+	// asks the peer to dial us back at addrs
+	Message_DIAL Message_MessageType = 0
+	// answers DIAL
+	Message_DIAL_RESPONSE Message_MessageType = 1
+)
+
+var Message_MessageType_name = map[int32]string{
+	0: "DIAL",
+	1: "DIAL_RESPONSE",
+}
+var Message_MessageType_value = map[string]int32{
+	"DIAL":          0,
+	"DIAL_RESPONSE": 1,
+}
+
+func (x Message_MessageType) Enum() *Message_MessageType {
+	p := new(Message_MessageType)
+	*p = x
+	return p
+}
+func (x Message_MessageType) String() string {
+	return proto.EnumName(Message_MessageType_name, int32(x))
+}
+func (x *Message_MessageType) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(Message_MessageType_value, data, "Message_MessageType")
+	if err != nil {
+		return err
+	}
+	*x = Message_MessageType(value)
+	return nil
+}
+
+type Message_Status int32
+
+const (
+	Message_OK               Message_Status = 0
+	Message_E_DIAL_REFUSED   Message_Status = 100
+	Message_E_BAD_REQUEST    Message_Status = 200
+	Message_E_INTERNAL_ERROR Message_Status = 300
+)
+
+var Message_Status_name = map[int32]string{
+	0:   "OK",
+	100: "E_DIAL_REFUSED",
+	200: "E_BAD_REQUEST",
+	300: "E_INTERNAL_ERROR",
+}
+var Message_Status_value = map[string]int32{
+	"OK":               0,
+	"E_DIAL_REFUSED":   100,
+	"E_BAD_REQUEST":    200,
+	"E_INTERNAL_ERROR": 300,
+}
+
+func (x Message_Status) Enum() *Message_Status {
+	p := new(Message_Status)
+	*p = x
+	return p
+}
+func (x Message_Status) String() string {
+	return proto.EnumName(Message_Status_name, int32(x))
+}
+func (x *Message_Status) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(Message_Status_value, data, "Message_Status")
+	if err != nil {
+		return err
+	}
+	*x = Message_Status(value)
+	return nil
+}
+
+type Message struct {
+	Type *Message_MessageType `protobuf:"varint,1,opt,name=type,enum=autonat.pb.Message_MessageType" json:"type,omitempty"`
+	// the request, in DIAL
+	Dial *Message_Dial `protobuf:"bytes,2,opt,name=dial" json:"dial,omitempty"`
+	// the answer, in DIAL_RESPONSE
+	DialResponse     *Message_DialResponse `protobuf:"bytes,3,opt,name=dialResponse" json:"dialResponse,omitempty"`
+	XXX_unrecognized []byte                `json:"-"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+
+func (m *Message) GetType() Message_MessageType {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return Message_DIAL
+}
+
+func (m *Message) GetDial() *Message_Dial {
+	if m != nil {
+		return m.Dial
+	}
+	return nil
+}
+
+func (m *Message) GetDialResponse() *Message_DialResponse {
+	if m != nil {
+		return m.DialResponse
+	}
+	return nil
+}
+
+type Message_Dial struct {
+	// multiaddrs to dial back
+	Addrs            [][]byte `protobuf:"bytes,1,rep,name=addrs" json:"addrs,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Message_Dial) Reset()         { *m = Message_Dial{} }
+func (m *Message_Dial) String() string { return proto.CompactTextString(m) }
+func (*Message_Dial) ProtoMessage()    {}
+
+func (m *Message_Dial) GetAddrs() [][]byte {
+	if m != nil {
+		return m.Addrs
+	}
+	return nil
+}
+
+type Message_DialResponse struct {
+	Status     *Message_Status `protobuf:"varint,1,opt,name=status,enum=autonat.pb.Message_Status" json:"status,omitempty"`
+	StatusText *string         `protobuf:"bytes,2,opt,name=statusText" json:"statusText,omitempty"`
+	// the multiaddrs dialed back, by whether they could be
+	Reachable        [][]byte `protobuf:"bytes,3,rep,name=reachable" json:"reachable,omitempty"`
+	Unreachable      [][]byte `protobuf:"bytes,4,rep,name=unreachable" json:"unreachable,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Message_DialResponse) Reset()         { *m = Message_DialResponse{} }
+func (m *Message_DialResponse) String() string { return proto.CompactTextString(m) }
+func (*Message_DialResponse) ProtoMessage()    {}
+
+func (m *Message_DialResponse) GetStatus() Message_Status {
+	if m != nil && m.Status != nil {
+		return *m.Status
+	}
+	return Message_OK
+}
+
+func (m *Message_DialResponse) GetStatusText() string {
+	if m != nil && m.StatusText != nil {
+		return *m.StatusText
+	}
+	return ""
+}
+
+func (m *Message_DialResponse) GetReachable() [][]byte {
+	if m != nil {
+		return m.Reachable
+	}
+	return nil
+}
+
+func (m *Message_DialResponse) GetUnreachable() [][]byte {
+	if m != nil {
+		return m.Unreachable
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("autonat.pb.Message_MessageType", Message_MessageType_name, Message_MessageType_value)
+	proto.RegisterEnum("autonat.pb.Message_Status", Message_Status_name, Message_Status_value)
+}
@@ -0,0 +1,443 @@
+// Package floodsub implements publish/subscribe messaging over the swarm.
+// Peers tell the peers they're connected to which topics they subscribe
+// to, and every message published is flooded to the subscribers of its
+// topics, which forward it on in turn, until all the connected
+// subscribers have seen it once.
+package floodsub
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	ggio "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/io"
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	host "github.com/ipfs/go-ipfs/p2p/host"
+	inet "github.com/ipfs/go-ipfs/p2p/net"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
+	pb "github.com/ipfs/go-ipfs/p2p/protocol/floodsub/pb"
+	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
+)
+
+var log = eventlog.Logger("p2p/protocol/floodsub")
+
+// ID is the protocol.ID of floodsub.
+const ID protocol.ID = "/floodsub/1.0.0"
+
+const (
+	// queueSize is how many messages are queued for each peer, and each
+	// subscription; those that come in beyond it are dropped.
+	queueSize = 32
+
+	// seenTTL is how long the ids of the messages seen are remembered, for
+	// copies coming in over other paths to be dropped.
+	seenTTL = time.Minute * 2
+)
+
+var ErrSubscriptionCancelled = errors.New("subscription cancelled")
+
+// Message is a message published to some topics.
+type Message struct {
+	From   peer.ID // the peer that published it
+	Data   []byte
+	Topics []string
+}
+
+// PubSub is the floodsub service of a host.
+type PubSub struct {
+	host host.Host
+	ctx  context.Context
+
+	mx sync.Mutex
+	// the queues of the messages sent to each connected peer
+	peers map[peer.ID]chan *pb.RPC
+	// the peers subscribed to each topic
+	topics map[string]map[peer.ID]struct{}
+	// the local subscriptions to each topic
+	mysubs map[string]map[*Subscription]struct{}
+	// the ids of the messages seen, and when
+	seen      map[string]time.Time
+	lastPurge time.Time
+	seqno     uint64
+	closed    bool
+}
+
+// NewPubSub starts the floodsub service on h, until ctx is done.
+func NewPubSub(ctx context.Context, h host.Host) *PubSub {
+	ps := &PubSub{
+		host:      h,
+		ctx:       ctx,
+		peers:     make(map[peer.ID]chan *pb.RPC),
+		topics:    make(map[string]map[peer.ID]struct{}),
+		mysubs:    make(map[string]map[*Subscription]struct{}),
+		seen:      make(map[string]time.Time),
+		lastPurge: time.Now(),
+		seqno:     uint64(time.Now().UnixNano()),
+	}
+
+	h.SetStreamHandler(ID, ps.handleNewStream)
+	h.Network().Notify((*netNotifiee)(ps))
+	for _, p := range h.Network().Peers() {
+		go ps.addPeer(p)
+	}
+
+	go func() {
+		<-ctx.Done()
+		h.Network().StopNotify((*netNotifiee)(ps))
+		h.RemoveStreamHandler(ID)
+		ps.close()
+	}()
+	return ps
+}
+
+func (ps *PubSub) close() {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	ps.closed = true
+	for p, ch := range ps.peers {
+		close(ch)
+		delete(ps.peers, p)
+	}
+	for topic, subs := range ps.mysubs {
+		for sub := range subs {
+			close(sub.ch)
+		}
+		delete(ps.mysubs, topic)
+	}
+}
+
+// Subscribe returns a subscription to the messages published to topic.
+func (ps *PubSub) Subscribe(topic string) (*Subscription, error) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	if ps.closed {
+		return nil, errors.New("floodsub: the service is closed")
+	}
+	sub := &Subscription{
+		topic: topic,
+		ch:    make(chan *Message, queueSize),
+		ps:    ps,
+	}
+	subs, ok := ps.mysubs[topic]
+	if !ok {
+		subs = make(map[*Subscription]struct{})
+		ps.mysubs[topic] = subs
+		ps.announceLocked(topic, true)
+	}
+	subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Publish publishes data to topic.
+func (ps *PubSub) Publish(topic string, data []byte) error {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	if ps.closed {
+		return errors.New("floodsub: the service is closed")
+	}
+	ps.seqno++
+	seqno := make([]byte, 8)
+	binary.BigEndian.PutUint64(seqno, ps.seqno)
+
+	ps.pushLocked(ps.host.ID(), &pb.Message{
+		From:     []byte(ps.host.ID()),
+		Data:     data,
+		Seqno:    seqno,
+		TopicIDs: []string{topic},
+	})
+	return nil
+}
+
+// GetTopics returns the topics subscribed to locally.
+func (ps *PubSub) GetTopics() []string {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	var topics []string
+	for t := range ps.mysubs {
+		topics = append(topics, t)
+	}
+	return topics
+}
+
+// ListPeers returns the connected peers subscribed to topic.
+func (ps *PubSub) ListPeers(topic string) []peer.ID {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	var peers []peer.ID
+	for p := range ps.topics[topic] {
+		if _, ok := ps.peers[p]; ok {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// announceLocked tells the connected peers of a change to the local
+// subscriptions.
+func (ps *PubSub) announceLocked(topic string, subscribe bool) {
+	rpc := &pb.RPC{
+		Subscriptions: []*pb.RPC_SubOpts{{
+			Subscribe: proto.Bool(subscribe),
+			Topicid:   proto.String(topic),
+		}},
+	}
+	for p, ch := range ps.peers {
+		ps.sendLocked(p, ch, rpc)
+	}
+}
+
+// helloLocked returns the first message sent to a peer: all the local
+// subscriptions.
+func (ps *PubSub) helloLocked() *pb.RPC {
+	rpc := new(pb.RPC)
+	for t := range ps.mysubs {
+		rpc.Subscriptions = append(rpc.Subscriptions, &pb.RPC_SubOpts{
+			Subscribe: proto.Bool(true),
+			Topicid:   proto.String(t),
+		})
+	}
+	return rpc
+}
+
+func (ps *PubSub) sendLocked(p peer.ID, ch chan *pb.RPC, rpc *pb.RPC) {
+	select {
+	case ch <- rpc:
+	default:
+		log.Debugf("floodsub: dropping a message to %s, its queue is full", p)
+	}
+}
+
+// pushLocked delivers the message m, received from src, to the local
+// subscribers of its topics, and forwards it to the peers subscribed to
+// them, unless it was seen already.
+func (ps *PubSub) pushLocked(src peer.ID, m *pb.Message) {
+	id := string(m.GetFrom()) + string(m.GetSeqno())
+	if ps.seenLocked(id) {
+		return
+	}
+
+	msg := &Message{
+		From:   peer.ID(m.GetFrom()),
+		Data:   m.GetData(),
+		Topics: m.GetTopicIDs(),
+	}
+	to := make(map[peer.ID]struct{})
+	for _, t := range m.GetTopicIDs() {
+		for sub := range ps.mysubs[t] {
+			select {
+			case sub.ch <- msg:
+			default:
+				log.Debugf("floodsub: dropping a message to a subscription to %s, its queue is full", t)
+			}
+		}
+		for p := range ps.topics[t] {
+			to[p] = struct{}{}
+		}
+	}
+	delete(to, src)
+	delete(to, msg.From)
+
+	rpc := &pb.RPC{Publish: []*pb.Message{m}}
+	for p := range to {
+		if ch, ok := ps.peers[p]; ok {
+			ps.sendLocked(p, ch, rpc)
+		}
+	}
+}
+
+// seenLocked returns whether the message id was seen already, and marks
+// it seen.
+func (ps *PubSub) seenLocked(id string) bool {
+	now := time.Now()
+	if now.Sub(ps.lastPurge) > seenTTL {
+		for k, t := range ps.seen {
+			if now.Sub(t) > seenTTL {
+				delete(ps.seen, k)
+			}
+		}
+		ps.lastPurge = now
+	}
+
+	if _, ok := ps.seen[id]; ok {
+		return true
+	}
+	ps.seen[id] = now
+	return false
+}
+
+// addPeer opens a stream to p, to send it messages on, if there's none.
+func (ps *PubSub) addPeer(p peer.ID) {
+	ps.mx.Lock()
+	if _, ok := ps.peers[p]; ok || ps.closed {
+		ps.mx.Unlock()
+		return
+	}
+	ch := make(chan *pb.RPC, queueSize)
+	ch <- ps.helloLocked()
+	ps.peers[p] = ch
+	ps.mx.Unlock()
+
+	s, err := ps.host.NewStream(ID, p)
+	if err != nil {
+		log.Debugf("floodsub: opening a stream to %s: %s", p, err)
+		ps.removePeer(p, ch)
+		return
+	}
+	go ps.writeLoop(s, p, ch)
+}
+
+// removePeer forgets p, if ch is still its queue, or for any queue if ch
+// is nil.
+func (ps *PubSub) removePeer(p peer.ID, ch chan *pb.RPC) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	cur, ok := ps.peers[p]
+	if !ok || (ch != nil && cur != ch) {
+		return
+	}
+	close(cur)
+	delete(ps.peers, p)
+	for t, peers := range ps.topics {
+		delete(peers, p)
+		if len(peers) == 0 {
+			delete(ps.topics, t)
+		}
+	}
+}
+
+func (ps *PubSub) writeLoop(s inet.Stream, p peer.ID, ch chan *pb.RPC) {
+	defer s.Close()
+
+	w := ggio.NewDelimitedWriter(s)
+	for rpc := range ch {
+		if err := w.WriteMsg(rpc); err != nil {
+			log.Debugf("floodsub: writing to %s: %s", p, err)
+			ps.removePeer(p, ch)
+			return
+		}
+	}
+}
+
+func (ps *PubSub) handleNewStream(s inet.Stream) {
+	defer s.Close()
+
+	p := s.Conn().RemotePeer()
+	go ps.addPeer(p)
+
+	r := ggio.NewDelimitedReader(s, inet.MessageSizeMax)
+	for {
+		rpc := new(pb.RPC)
+		if err := r.ReadMsg(rpc); err != nil {
+			if err != io.EOF {
+				log.Debugf("floodsub: reading from %s: %s", p, err)
+			}
+			return
+		}
+		ps.handleRPC(p, rpc)
+	}
+}
+
+func (ps *PubSub) handleRPC(from peer.ID, rpc *pb.RPC) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	if ps.closed {
+		return
+	}
+	for _, sub := range rpc.GetSubscriptions() {
+		t := sub.GetTopicid()
+		peers, ok := ps.topics[t]
+		if sub.GetSubscribe() {
+			if !ok {
+				peers = make(map[peer.ID]struct{})
+				ps.topics[t] = peers
+			}
+			peers[from] = struct{}{}
+		} else if ok {
+			delete(peers, from)
+			if len(peers) == 0 {
+				delete(ps.topics, t)
+			}
+		}
+	}
+	for _, m := range rpc.GetPublish() {
+		ps.pushLocked(from, m)
+	}
+}
+
+// Subscription is a subscription to the messages published to a topic.
+type Subscription struct {
+	topic string
+	ch    chan *Message
+	ps    *PubSub
+}
+
+// Topic returns the topic subscribed to.
+func (sub *Subscription) Topic() string {
+	return sub.topic
+}
+
+// Next returns the next message published to the topic, waiting for it
+// until ctx is done. It returns ErrSubscriptionCancelled once the
+// subscription is cancelled.
+func (sub *Subscription) Next(ctx context.Context) (*Message, error) {
+	select {
+	case msg, ok := <-sub.ch:
+		if !ok {
+			return nil, ErrSubscriptionCancelled
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Cancel cancels the subscription. Once the topic has no more local
+// subscriptions, the peers are told to stop sending its messages.
+func (sub *Subscription) Cancel() {
+	ps := sub.ps
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	subs := ps.mysubs[sub.topic]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.ch)
+	if len(subs) == 0 {
+		delete(ps.mysubs, sub.topic)
+		ps.announceLocked(sub.topic, false)
+	}
+}
+
+// netNotifiee has PubSub add and remove peers as they connect and leave.
+type netNotifiee PubSub
+
+func (nn *netNotifiee) Connected(n inet.Network, c inet.Conn) {
+	go (*PubSub)(nn).addPeer(c.RemotePeer())
+}
+
+func (nn *netNotifiee) Disconnected(n inet.Network, c inet.Conn) {
+	p := c.RemotePeer()
+	if n.Connectedness(p) != inet.Connected {
+		(*PubSub)(nn).removePeer(p, nil)
+	}
+}
+
+func (nn *netNotifiee) OpenedStream(n inet.Network, s inet.Stream) {}
+func (nn *netNotifiee) ClosedStream(n inet.Network, s inet.Stream) {}
+func (nn *netNotifiee) Listen(n inet.Network, a ma.Multiaddr)      {}
+func (nn *netNotifiee) ListenClose(n inet.Network, a ma.Multiaddr) {}
@@ -0,0 +1,132 @@
+package floodsub
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	host "github.com/ipfs/go-ipfs/p2p/host"
+	testutil "github.com/ipfs/go-ipfs/p2p/test/util"
+)
+
+func connect(t *testing.T, ctx context.Context, a, b host.Host) {
+	if err := a.Connect(ctx, b.Peerstore().PeerInfo(b.ID())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForPeers waits for ps to learn that n peers subscribe to topic.
+func waitForPeers(t *testing.T, ps *PubSub, topic string, n int) {
+	for i := 0; i < 100; i++ {
+		if len(ps.ListPeers(topic)) >= n {
+			return
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	t.Fatalf("%d peers subscribed to %s, not %d", len(ps.ListPeers(topic)), topic, n)
+}
+
+func nextOrFatal(t *testing.T, sub *Subscription) *Message {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	msg, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestFloodsubForwards(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a line: h1 - h2 - h3
+	hosts := []host.Host{
+		testutil.GenHostSwarm(t, ctx),
+		testutil.GenHostSwarm(t, ctx),
+		testutil.GenHostSwarm(t, ctx),
+	}
+	var pss []*PubSub
+	for _, h := range hosts {
+		pss = append(pss, NewPubSub(ctx, h))
+	}
+	connect(t, ctx, hosts[0], hosts[1])
+	connect(t, ctx, hosts[1], hosts[2])
+
+	var subs []*Subscription
+	for _, ps := range pss {
+		sub, err := ps.Subscribe("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+	waitForPeers(t, pss[0], "foo", 1)
+	waitForPeers(t, pss[1], "foo", 2)
+	waitForPeers(t, pss[2], "foo", 1)
+
+	if err := pss[0].Publish("foo", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	for i, sub := range subs {
+		msg := nextOrFatal(t, sub)
+		if !bytes.Equal(msg.Data, []byte("hello")) || msg.From != hosts[0].ID() {
+			t.Fatalf("subscriber %d got %q from %s", i, msg.Data, msg.From)
+		}
+	}
+
+	// the messages of other topics aren't delivered, and each message
+	// only once
+	if err := pss[2].Publish("bar", []byte("nope")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pss[2].Publish("foo", []byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	for i, sub := range subs {
+		if msg := nextOrFatal(t, sub); string(msg.Data) != "again" {
+			t.Fatalf("subscriber %d got %q", i, msg.Data)
+		}
+	}
+	time.Sleep(time.Millisecond * 100)
+	for i, sub := range subs {
+		select {
+		case msg := <-sub.ch:
+			t.Fatalf("subscriber %d got %q twice", i, msg.Data)
+		default:
+		}
+	}
+}
+
+func TestFloodsubCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1 := testutil.GenHostSwarm(t, ctx)
+	h2 := testutil.GenHostSwarm(t, ctx)
+	ps1 := NewPubSub(ctx, h1)
+	ps2 := NewPubSub(ctx, h2)
+	connect(t, ctx, h1, h2)
+
+	sub, err := ps2.Subscribe("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForPeers(t, ps1, "foo", 1)
+
+	sub.Cancel()
+	for i := 0; i < 100 && len(ps1.ListPeers("foo")) > 0; i++ {
+		time.Sleep(time.Millisecond * 20)
+	}
+	if len(ps1.ListPeers("foo")) != 0 {
+		t.Fatal("the peer is still subscribed after cancelling")
+	}
+	if len(ps2.GetTopics()) != 0 {
+		t.Fatalf("still subscribed to %v", ps2.GetTopics())
+	}
+	if _, err := sub.Next(ctx); err != ErrSubscriptionCancelled {
+		t.Fatalf("expected the subscription to be cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Code generated by protoc-gen-gogo.
+// source: rpc.proto
+// DO NOT EDIT!
+
+/*
+Package floodsub_pb is a generated protocol buffer package.
+
+It is generated from these files:
+	rpc.proto
+
+It has these top-level messages:
+	RPC
+	Message
+*/
+package floodsub_pb
+
+import proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+type RPC struct {
+	Subscriptions    []*RPC_SubOpts `protobuf:"bytes,1,rep,name=subscriptions" json:"subscriptions,omitempty"`
+	Publish          []*Message     `protobuf:"bytes,2,rep,name=publish" json:"publish,omitempty"`
+	XXX_unrecognized []byte         `json:"-"`
+}
+
+func (m *RPC) Reset()         { *m = RPC{} }
+func (m *RPC) String() string { return proto.CompactTextString(m) }
+func (*RPC) ProtoMessage()    {}
+
+func (m *RPC) GetSubscriptions() []*RPC_SubOpts {
+	if m != nil {
+		return m.Subscriptions
+	}
+	return nil
+}
+
+func (m *RPC) GetPublish() []*Message {
+	if m != nil {
+		return m.Publish
+	}
+	return nil
+}
+
+type RPC_SubOpts struct {
+	Subscribe        *bool   `protobuf:"varint,1,opt,name=subscribe" json:"subscribe,omitempty"`
+	Topicid          *string `protobuf:"bytes,2,opt,name=topicid" json:"topicid,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *RPC_SubOpts) Reset()         { *m = RPC_SubOpts{} }
+func (m *RPC_SubOpts) String() string { return proto.CompactTextString(m) }
+func (*RPC_SubOpts) ProtoMessage()    {}
+
+func (m *RPC_SubOpts) GetSubscribe() bool {
+	if m != nil && m.Subscribe != nil {
+		return *m.Subscribe
+	}
+	return false
+}
+
+func (m *RPC_SubOpts) GetTopicid() string {
+	if m != nil && m.Topicid != nil {
+		return *m.Topicid
+	}
+	return ""
+}
+
+type Message struct {
+	From             []byte   `protobuf:"bytes,1,opt,name=from" json:"from,omitempty"`
+	Data             []byte   `protobuf:"bytes,2,opt,name=data" json:"data,omitempty"`
+	Seqno            []byte   `protobuf:"bytes,3,opt,name=seqno" json:"seqno,omitempty"`
+	TopicIDs         []string `protobuf:"bytes,4,rep,name=topicIDs" json:"topicIDs,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+
+func (m *Message) GetFrom() []byte {
+	if m != nil {
+		return m.From
+	}
+	return nil
+}
+
+func (m *Message) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *Message) GetSeqno() []byte {
+	if m != nil {
+		return m.Seqno
+	}
+	return nil
+}
+
+func (m *Message) GetTopicIDs() []string {
+	if m != nil {
+		return m.TopicIDs
+	}
+	return nil
+}
+
+func init() {
+}
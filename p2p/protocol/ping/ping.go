@@ -0,0 +1,126 @@
+// Package ping implements a protocol measuring the round trip time to a
+// peer, apart from the other protocols.
+package ping
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	host "github.com/ipfs/go-ipfs/p2p/host"
+	inet "github.com/ipfs/go-ipfs/p2p/net"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
+	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
+)
+
+var log = eventlog.Logger("p2p/protocol/ping")
+
+// ID is the protocol.ID of the Ping Service.
+const ID protocol.ID = "/ipfs/ping/1.0.0"
+
+// PingSize is the size of the payload of a ping.
+const PingSize = 32
+
+// ErrBadPong is returned when a peer sends back other data than it was
+// sent.
+var ErrBadPong = errors.New("ping: pong doesn't match ping")
+
+// PingService answers pings, and sends them.
+//
+// the protocol is very simple: the pinging side writes PingSize random
+// bytes, which the other side writes back, as many times as it likes
+// over the stream.
+type PingService struct {
+	host host.Host
+}
+
+func NewPingService(h host.Host) *PingService {
+	ps := &PingService{h}
+	h.SetStreamHandler(ID, ps.pingHandler)
+	return ps
+}
+
+func (ps *PingService) pingHandler(s inet.Stream) {
+	defer s.Close()
+
+	buf := make([]byte, PingSize)
+	for {
+		if _, err := io.ReadFull(s, buf); err != nil {
+			if err != io.EOF {
+				log.Debugf("ping read error: %s", err)
+			}
+			return
+		}
+		if _, err := s.Write(buf); err != nil {
+			log.Debugf("ping write error: %s", err)
+			return
+		}
+	}
+}
+
+// Ping sends a ping to p over a stream of its own, and returns the time
+// until its pong came back, which is recorded as a latency of p in the
+// peerstore. It gives up when ctx is done.
+func (ps *PingService) Ping(ctx context.Context, p peer.ID) (time.Duration, error) {
+	type result struct {
+		took time.Duration
+		err  error
+	}
+	done := make(chan result, 1)
+	streams := make(chan inet.Stream, 1)
+	go func() {
+		s, err := ps.host.NewStream(ID, p)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		streams <- s
+		defer s.Close()
+
+		took, err := ping(s)
+		if err == nil {
+			ps.host.Peerstore().RecordLatency(p, took)
+		}
+		done <- result{took, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.took, r.err
+	case <-ctx.Done():
+		// unblock the ping, if it got its stream.
+		go func() {
+			select {
+			case s := <-streams:
+				s.Close()
+			case <-done:
+			}
+		}()
+		return 0, ctx.Err()
+	}
+}
+
+func ping(s inet.Stream) (time.Duration, error) {
+	buf := make([]byte, PingSize)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return 0, err
+	}
+
+	before := time.Now()
+	if _, err := s.Write(buf); err != nil {
+		return 0, err
+	}
+	pong := make([]byte, PingSize)
+	if _, err := io.ReadFull(s, pong); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(buf, pong) {
+		return 0, ErrBadPong
+	}
+	return time.Since(before), nil
+}
@@ -0,0 +1,63 @@
+package ping
+
+import (
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	inet "github.com/ipfs/go-ipfs/p2p/net"
+	testutil "github.com/ipfs/go-ipfs/p2p/test/util"
+)
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+	h1 := testutil.GenHostSwarm(t, ctx)
+	h2 := testutil.GenHostSwarm(t, ctx)
+	defer h1.Close()
+	defer h2.Close()
+
+	if err := h1.Connect(ctx, h2.Peerstore().PeerInfo(h2.ID())); err != nil {
+		t.Fatal(err)
+	}
+
+	ps1 := NewPingService(h1)
+	NewPingService(h2)
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		took, err := ps1.Ping(ctx, h2.ID())
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if took <= 0 {
+			t.Fatalf("implausible round trip time: %s", took)
+		}
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	ctx := context.Background()
+	h1 := testutil.GenHostSwarm(t, ctx)
+	h2 := testutil.GenHostSwarm(t, ctx)
+	defer h1.Close()
+	defer h2.Close()
+
+	if err := h1.Connect(ctx, h2.Peerstore().PeerInfo(h2.ID())); err != nil {
+		t.Fatal(err)
+	}
+
+	ps1 := NewPingService(h1)
+	// h2 reads pings, but never answers.
+	h2.SetStreamHandler(ID, func(s inet.Stream) {
+		buf := make([]byte, PingSize)
+		s.Read(buf)
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := ps1.Ping(ctx, h2.ID()); err != context.DeadlineExceeded {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
@@ -0,0 +1,616 @@
+package relay
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	ggio "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/io"
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	ic "github.com/ipfs/go-ipfs/p2p/crypto"
+	host "github.com/ipfs/go-ipfs/p2p/host"
+	inet "github.com/ipfs/go-ipfs/p2p/net"
+	conn "github.com/ipfs/go-ipfs/p2p/net/conn"
+	swarm "github.com/ipfs/go-ipfs/p2p/net/swarm"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
+	identify "github.com/ipfs/go-ipfs/p2p/protocol/identify"
+	pb "github.com/ipfs/go-ipfs/p2p/protocol/relay/pb"
+)
+
+// CircuitID is the protocol.ID of circuit relay, which connects peers that
+// can't dial each other, e.g. behind NATs, through a third one:
+//
+//	src --HOP--> relay --STOP--> dst
+//
+// The relay opens a stream to dst, which it must be connected to already,
+// and pipes it to the stream of src once dst accepts. Both ends then secure
+// the circuit, and use it as a conn of their swarms.
+const CircuitID protocol.ID = "/libp2p/circuit/relay/0.1.0"
+
+// P_CIRCUIT is the code of the p2p-circuit multiaddr protocol, which ends
+// the addresses of relayed conns: <relay address>/ipfs/<relay>/p2p-circuit
+const P_CIRCUIT = 290
+
+const (
+	// maxMessageSize bounds the circuit messages read.
+	maxMessageSize = 4096
+
+	// canHopTimeout bounds asking new peers whether they relay.
+	canHopTimeout = time.Second * 10
+
+	// handshakeTimeout bounds securing the circuits opened to us.
+	handshakeTimeout = time.Second * 30
+
+	// DefaultMaxCircuits is the MaxCircuits of relays that don't set it.
+	DefaultMaxCircuits = 1024
+
+	// DefaultMaxCircuitsPerPeer is the MaxCircuitsPerPeer of relays that
+	// don't set it.
+	DefaultMaxCircuitsPerPeer = 16
+
+	// pipeChunkSize bounds the bytes copied at a time between the streams
+	// of a circuit, for the bandwidth limit to pace them.
+	pipeChunkSize = 4096
+)
+
+func init() {
+	ma.Protocols = append(ma.Protocols, ma.Protocol{
+		Code:  P_CIRCUIT,
+		Size:  0,
+		Name:  "p2p-circuit",
+		VCode: ma.CodeToVarint(P_CIRCUIT),
+	})
+}
+
+// CircuitOpts configures the circuits of a host.
+type CircuitOpts struct {
+	// Hop has the host relay circuits between other peers.
+	Hop bool
+
+	// PreferDirect has direct conns replace relayed ones: once a circuit
+	// opens, its peer is dialed directly, and the circuits to the peers
+	// connected directly are closed.
+	PreferDirect bool
+
+	// MaxCircuits bounds the circuits relayed at once, and
+	// MaxCircuitsPerPeer those opened by any one peer. Relays refuse the
+	// circuits over either. They are DefaultMaxCircuits and
+	// DefaultMaxCircuitsPerPeer if not set.
+	MaxCircuits        int
+	MaxCircuitsPerPeer int
+
+	// BandwidthLimit bounds the bytes per second relayed, over all the
+	// circuits and both their directions. It's unbounded if not set.
+	BandwidthLimit int64
+}
+
+// Circuit dials the peers a swarm can't reach directly through the relays
+// it is connected to, and hands it the circuits relays open to us.
+type Circuit struct {
+	host  host.Host
+	swarm *swarm.Swarm
+	opts  CircuitOpts
+	ctx   context.Context
+	list  *circuitListener
+
+	mx     sync.Mutex
+	relays map[peer.ID]struct{}
+
+	// hops counts the circuits relayed, in all and by the peers that
+	// opened them, and bw paces them.
+	hops     int
+	peerHops map[peer.ID]int
+	bw       *bandwidthLimiter
+}
+
+// NewCircuit sets up circuits for h, which must be on a swarm.Network,
+// until ctx is done.
+func NewCircuit(ctx context.Context, h host.Host, opts CircuitOpts) (*Circuit, error) {
+	n, ok := h.Network().(*swarm.Network)
+	if !ok {
+		return nil, errors.New("circuit relay needs a swarm network")
+	}
+
+	if opts.MaxCircuits <= 0 {
+		opts.MaxCircuits = DefaultMaxCircuits
+	}
+	if opts.MaxCircuitsPerPeer <= 0 {
+		opts.MaxCircuitsPerPeer = DefaultMaxCircuitsPerPeer
+	}
+	c := &Circuit{
+		host:     h,
+		swarm:    n.Swarm(),
+		opts:     opts,
+		ctx:      ctx,
+		list:     newCircuitListener(),
+		relays:   make(map[peer.ID]struct{}),
+		peerHops: make(map[peer.ID]int),
+		bw:       newBandwidthLimiter(opts.BandwidthLimit),
+	}
+	if err := c.swarm.AddRelayListener(c.list); err != nil {
+		return nil, err
+	}
+	h.SetStreamHandler(CircuitID, c.handleStream)
+	c.swarm.SetRelayDialer(c.dialRelayed)
+	n.Notify((*circuitNotifiee)(c))
+
+	// the peers connected already may be relays too.
+	for _, p := range n.Peers() {
+		go c.checkHop(p)
+	}
+
+	go func() {
+		<-ctx.Done()
+		c.swarm.SetRelayDialer(nil)
+		n.StopNotify((*circuitNotifiee)(c))
+		h.RemoveStreamHandler(CircuitID)
+		c.list.Close()
+	}()
+	return c, nil
+}
+
+// Relays returns the connected peers known to relay circuits.
+func (c *Circuit) Relays() []peer.ID {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	var ps []peer.ID
+	for p := range c.relays {
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// IsRelayed returns whether c is a circuit, rather than a direct conn.
+func IsRelayed(c inet.Conn) bool {
+	for _, p := range c.RemoteMultiaddr().Protocols() {
+		if p.Code == P_CIRCUIT {
+			return true
+		}
+	}
+	return false
+}
+
+// dialRelayed dials p through the first relay that opens a circuit to it.
+func (c *Circuit) dialRelayed(ctx context.Context, p peer.ID) (conn.Conn, error) {
+	err := errors.New("no relays known")
+	for _, r := range c.Relays() {
+		if r == p {
+			continue
+		}
+		sc, rerr := c.dialThrough(ctx, r, p)
+		if rerr == nil {
+			return sc, nil
+		}
+		log.Debugf("circuit: dialing %s through %s: %s", p, r, rerr)
+		err = rerr
+	}
+	return nil, err
+}
+
+// dialThrough opens a circuit to p through the relay r, and secures it.
+func (c *Circuit) dialThrough(ctx context.Context, r, p peer.ID) (conn.Conn, error) {
+	s, err := c.host.NewStream(CircuitID, r)
+	if err != nil {
+		return nil, err
+	}
+
+	hop := &pb.CircuitRelay{
+		Type:    pb.CircuitRelay_HOP.Enum(),
+		SrcPeer: peerToPb(peer.PeerInfo{ID: c.host.ID(), Addrs: c.host.Addrs()}),
+		DstPeer: peerToPb(c.host.Peerstore().PeerInfo(p)),
+	}
+	if err := writeMsg(s, hop); err != nil {
+		s.Close()
+		return nil, err
+	}
+	code, err := readStatus(s)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	if code != pb.CircuitRelay_SUCCESS {
+		s.Close()
+		return nil, fmt.Errorf("%s refused a circuit: %s", r, code)
+	}
+
+	sc, err := conn.Upgrade(ctx, c.host.ID(), p, c.privKey(), newCircuitConn(s))
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	if sc.RemotePeer() != p {
+		sc.Close()
+		return nil, fmt.Errorf("misdial to %s through %s (got %s)", p, r, sc.RemotePeer())
+	}
+	return sc, nil
+}
+
+func (c *Circuit) privKey() ic.PrivKey {
+	return c.host.Peerstore().PrivKey(c.host.ID())
+}
+
+// handleStream answers the circuit requests of peers.
+func (c *Circuit) handleStream(s inet.Stream) {
+	var m pb.CircuitRelay
+	if err := readMsg(s, &m); err != nil {
+		log.Debugf("circuit: bad message from %s: %s", s.Conn().RemotePeer(), err)
+		s.Close()
+		return
+	}
+
+	switch m.GetType() {
+	case pb.CircuitRelay_HOP:
+		c.handleHop(s, &m)
+	case pb.CircuitRelay_STOP:
+		c.handleStop(s, &m)
+	case pb.CircuitRelay_CAN_HOP:
+		code := pb.CircuitRelay_SUCCESS
+		if !c.opts.Hop {
+			code = pb.CircuitRelay_HOP_CANT_SPEAK_RELAY
+		}
+		writeStatus(s, code)
+		s.Close()
+	default:
+		writeStatus(s, pb.CircuitRelay_MALFORMED_MESSAGE)
+		s.Close()
+	}
+}
+
+// handleHop relays a circuit from the peer of s to the one it asks for.
+func (c *Circuit) handleHop(s inet.Stream, m *pb.CircuitRelay) {
+	defer s.Close()
+
+	if !c.opts.Hop {
+		writeStatus(s, pb.CircuitRelay_HOP_CANT_SPEAK_RELAY)
+		return
+	}
+	src, err := peerFromPb(m.GetSrcPeer())
+	if err != nil || src != s.Conn().RemotePeer() {
+		writeStatus(s, pb.CircuitRelay_HOP_SRC_MULTIADDR_INVALID)
+		return
+	}
+	dst, err := peerFromPb(m.GetDstPeer())
+	if err != nil {
+		writeStatus(s, pb.CircuitRelay_HOP_DST_MULTIADDR_INVALID)
+		return
+	}
+	if dst == c.host.ID() {
+		writeStatus(s, pb.CircuitRelay_HOP_CANT_RELAY_TO_SELF)
+		return
+	}
+	if !c.addHop(src) {
+		log.Debugf("circuit: refusing a circuit from %s, over the limits", src)
+		writeStatus(s, pb.CircuitRelay_HOP_CANT_RELAY_MORE)
+		return
+	}
+	defer c.removeHop(src)
+
+	// relays only reach peers over the conns those keep to them, rather
+	// than dialing them on behalf of others.
+	if len(c.swarm.ConnectionsToPeer(dst)) == 0 {
+		writeStatus(s, pb.CircuitRelay_HOP_NO_CONN_TO_DST)
+		return
+	}
+	ds, err := c.host.NewStream(CircuitID, dst)
+	if err != nil {
+		writeStatus(s, pb.CircuitRelay_HOP_CANT_OPEN_DST_STREAM)
+		return
+	}
+	defer ds.Close()
+
+	stop := &pb.CircuitRelay{
+		Type:    pb.CircuitRelay_STOP.Enum(),
+		SrcPeer: m.SrcPeer,
+		DstPeer: m.DstPeer,
+	}
+	if err := writeMsg(ds, stop); err != nil {
+		writeStatus(s, pb.CircuitRelay_HOP_CANT_OPEN_DST_STREAM)
+		return
+	}
+	code, err := readStatus(ds)
+	if err != nil {
+		writeStatus(s, pb.CircuitRelay_HOP_CANT_OPEN_DST_STREAM)
+		return
+	}
+	if err := writeStatus(s, code); err != nil || code != pb.CircuitRelay_SUCCESS {
+		return
+	}
+
+	log.Debugf("circuit: %s relaying %s <--> %s", c.host.ID(), src, dst)
+	pipe(s, ds, c.bw)
+}
+
+// addHop counts a circuit opened by src, unless it is over the limits.
+func (c *Circuit) addHop(src peer.ID) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.hops >= c.opts.MaxCircuits || c.peerHops[src] >= c.opts.MaxCircuitsPerPeer {
+		return false
+	}
+	c.hops++
+	c.peerHops[src]++
+	return true
+}
+
+func (c *Circuit) removeHop(src peer.ID) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.hops--
+	if c.peerHops[src]--; c.peerHops[src] == 0 {
+		delete(c.peerHops, src)
+	}
+}
+
+// handleStop accepts the circuit a relay opened to us, for the swarm.
+func (c *Circuit) handleStop(s inet.Stream, m *pb.CircuitRelay) {
+	src, err := peerFromPb(m.GetSrcPeer())
+	if err != nil {
+		writeStatus(s, pb.CircuitRelay_STOP_SRC_MULTIADDR_INVALID)
+		s.Close()
+		return
+	}
+	if err := writeStatus(s, pb.CircuitRelay_SUCCESS); err != nil {
+		s.Close()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, handshakeTimeout)
+	defer cancel()
+	sc, err := conn.Upgrade(ctx, c.host.ID(), "", c.privKey(), newCircuitConn(s))
+	if err != nil {
+		log.Debugf("circuit: securing the circuit from %s: %s", src, err)
+		s.Close()
+		return
+	}
+	if sc.RemotePeer() != src {
+		log.Debugf("circuit: circuit from %s was from %s", src, sc.RemotePeer())
+		sc.Close()
+		return
+	}
+	c.list.push(sc)
+}
+
+// checkHop asks p whether it relays circuits, and remembers it if so.
+func (c *Circuit) checkHop(p peer.ID) {
+	s, err := c.host.NewStream(CircuitID, p)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+	t := time.AfterFunc(canHopTimeout, func() { s.Close() })
+	defer t.Stop()
+
+	if err := writeMsg(s, &pb.CircuitRelay{Type: pb.CircuitRelay_CAN_HOP.Enum()}); err != nil {
+		return
+	}
+	code, err := readStatus(s)
+	if err != nil || code != pb.CircuitRelay_SUCCESS {
+		return
+	}
+
+	log.Debugf("circuit: %s relays circuits", p)
+	c.mx.Lock()
+	c.relays[p] = struct{}{}
+	c.mx.Unlock()
+}
+
+// identifier is implemented by the hosts that identify their peers, which
+// tells us the addresses to dial peers on circuits directly.
+type identifier interface {
+	IDService() *identify.IDService
+}
+
+// preferDirect closes the circuits to p once connected to it directly.
+// Given a circuit v, it first dials p directly, for there to be a direct
+// conn: a NAT may let either peer reach the other at the addresses they
+// tell each other over the circuit.
+func (c *Circuit) preferDirect(p peer.ID, v inet.Conn) {
+	if IsRelayed(v) && !c.connectedDirectly(p) {
+		if ids, ok := c.host.(identifier); ok {
+			ids.IDService().IdentifyConn(v)
+		}
+		// p may have dialed us while we identified it.
+		if !c.connectedDirectly(p) {
+			if _, err := c.swarm.DialDirect(c.ctx, p); err != nil {
+				log.Debugf("circuit: dialing %s directly: %s", p, err)
+				return
+			}
+		}
+	}
+
+	if !c.connectedDirectly(p) {
+		return
+	}
+	for _, sc := range c.swarm.ConnectionsToPeer(p) {
+		if IsRelayed(sc) {
+			log.Debugf("circuit: closing the circuit to %s, connected directly", p)
+			sc.Close()
+		}
+	}
+}
+
+func (c *Circuit) connectedDirectly(p peer.ID) bool {
+	for _, sc := range c.swarm.ConnectionsToPeer(p) {
+		if !IsRelayed(sc) {
+			return true
+		}
+	}
+	return false
+}
+
+// circuitNotifiee follows the conns of the swarm, to find relays, and
+// replace circuits with direct conns.
+type circuitNotifiee Circuit
+
+func (cn *circuitNotifiee) circuit() *Circuit {
+	return (*Circuit)(cn)
+}
+
+func (cn *circuitNotifiee) Connected(n inet.Network, v inet.Conn) {
+	c := cn.circuit()
+	p := v.RemotePeer()
+	if c.opts.PreferDirect {
+		go c.preferDirect(p, v)
+	}
+	if !IsRelayed(v) {
+		go c.checkHop(p)
+	}
+}
+
+func (cn *circuitNotifiee) Disconnected(n inet.Network, v inet.Conn) {
+	c := cn.circuit()
+	p := v.RemotePeer()
+	if len(n.ConnsToPeer(p)) > 0 {
+		return
+	}
+	c.mx.Lock()
+	delete(c.relays, p)
+	c.mx.Unlock()
+}
+
+func (cn *circuitNotifiee) OpenedStream(n inet.Network, v inet.Stream) {}
+func (cn *circuitNotifiee) ClosedStream(n inet.Network, v inet.Stream) {}
+func (cn *circuitNotifiee) Listen(n inet.Network, a ma.Multiaddr)      {}
+func (cn *circuitNotifiee) ListenClose(n inet.Network, a ma.Multiaddr) {}
+
+func peerToPb(pi peer.PeerInfo) *pb.CircuitRelay_Peer {
+	p := &pb.CircuitRelay_Peer{Id: []byte(pi.ID)}
+	for _, a := range pi.Addrs {
+		p.Addrs = append(p.Addrs, a.Bytes())
+	}
+	return p
+}
+
+func peerFromPb(p *pb.CircuitRelay_Peer) (peer.ID, error) {
+	if p == nil {
+		return "", errors.New("no peer given")
+	}
+	return peer.IDFromBytes(p.GetId())
+}
+
+func writeMsg(w io.Writer, m *pb.CircuitRelay) error {
+	return ggio.NewDelimitedWriter(w).WriteMsg(m)
+}
+
+// readMsg reads a message of r, without reading ahead of it, as the bytes
+// of the circuit follow.
+func readMsg(r io.Reader, m *pb.CircuitRelay) error {
+	size, err := binary.ReadUvarint(byteReader{r})
+	if err != nil {
+		return err
+	}
+	if size > maxMessageSize {
+		return fmt.Errorf("circuit message of %d bytes is too large", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	return proto.Unmarshal(buf, m)
+}
+
+func writeStatus(w io.Writer, code pb.CircuitRelay_Status) error {
+	return writeMsg(w, &pb.CircuitRelay{
+		Type: pb.CircuitRelay_STATUS.Enum(),
+		Code: code.Enum(),
+	})
+}
+
+// readStatus reads the answer of a peer to a request.
+func readStatus(r io.Reader) (pb.CircuitRelay_Status, error) {
+	var m pb.CircuitRelay
+	if err := readMsg(r, &m); err != nil {
+		return 0, err
+	}
+	if m.GetType() != pb.CircuitRelay_STATUS {
+		return 0, fmt.Errorf("expected a status, got %s", m.GetType())
+	}
+	return m.GetCode(), nil
+}
+
+type byteReader struct {
+	io.Reader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r.Reader, b[:])
+	return b[0], err
+}
+
+// pipe copies between the two streams of a circuit, as fast as bw lets
+// it, until either is done.
+func pipe(a, b inet.Stream, bw *bandwidthLimiter) {
+	done := make(chan struct{}, 2)
+	go func() {
+		copyLimited(a, b, bw)
+		done <- struct{}{}
+	}()
+	go func() {
+		copyLimited(b, a, bw)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func copyLimited(w io.Writer, r io.Reader, bw *bandwidthLimiter) error {
+	buf := make([]byte, pipeChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			bw.wait(n)
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// bandwidthLimiter paces the bytes relayed to a rate of bytes per second,
+// shared by all the circuits. A nil one doesn't limit them.
+type bandwidthLimiter struct {
+	rate int64
+
+	mx   sync.Mutex
+	next time.Time
+}
+
+func newBandwidthLimiter(rate int64) *bandwidthLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{rate: rate}
+}
+
+// wait blocks until n more bytes may be sent.
+func (l *bandwidthLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+	l.mx.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.mx.Unlock()
+
+	time.Sleep(at.Sub(now))
+}
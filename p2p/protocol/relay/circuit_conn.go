@@ -0,0 +1,110 @@
+package relay
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+
+	inet "github.com/ipfs/go-ipfs/p2p/net"
+	conn "github.com/ipfs/go-ipfs/p2p/net/conn"
+)
+
+var errListenerClosed = errors.New("circuit listener closed")
+
+// circuitAddr is the net.Addr of an end of a circuit.
+type circuitAddr struct {
+	ma.Multiaddr
+}
+
+func (a circuitAddr) Network() string {
+	return "p2p-circuit"
+}
+
+// circuitConn is the stream of a circuit, as a manet.Conn to upgrade. Its
+// addresses are those of the conn to the relay, with /ipfs/<relay>/p2p-circuit
+// appended.
+type circuitConn struct {
+	inet.Stream
+	local  ma.Multiaddr
+	remote ma.Multiaddr
+}
+
+func newCircuitConn(s inet.Stream) *circuitConn {
+	rc := s.Conn()
+	circuit, err := ma.NewMultiaddr("/ipfs/" + rc.RemotePeer().Pretty() + "/p2p-circuit")
+	if err != nil {
+		panic(err) // a peer.ID always makes a valid /ipfs address.
+	}
+	return &circuitConn{
+		Stream: s,
+		local:  rc.LocalMultiaddr().Encapsulate(circuit),
+		remote: rc.RemoteMultiaddr().Encapsulate(circuit),
+	}
+}
+
+func (c *circuitConn) LocalMultiaddr() ma.Multiaddr {
+	return c.local
+}
+
+func (c *circuitConn) RemoteMultiaddr() ma.Multiaddr {
+	return c.remote
+}
+
+func (c *circuitConn) LocalAddr() net.Addr {
+	return circuitAddr{c.local}
+}
+
+func (c *circuitConn) RemoteAddr() net.Addr {
+	return circuitAddr{c.remote}
+}
+
+// streams have no deadlines; the conns upgraded from them are bounded by
+// their contexts, and by the conns to the relays.
+func (c *circuitConn) SetDeadline(t time.Time) error      { return nil }
+func (c *circuitConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *circuitConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// circuitListener hands the swarm the circuits relays opened to us.
+type circuitListener struct {
+	incoming  chan conn.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newCircuitListener() *circuitListener {
+	return &circuitListener{
+		incoming: make(chan conn.Conn),
+		closed:   make(chan struct{}),
+	}
+}
+
+// push waits for the swarm to accept c, unless the listener closes first.
+func (l *circuitListener) push(c conn.Conn) {
+	select {
+	case l.incoming <- c:
+	case <-l.closed:
+		c.Close()
+	}
+}
+
+func (l *circuitListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.incoming:
+		return c, nil
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *circuitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *circuitListener) Addr() net.Addr {
+	a, _ := ma.NewMultiaddr("/p2p-circuit")
+	return circuitAddr{a}
+}
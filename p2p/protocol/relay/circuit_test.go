@@ -0,0 +1,250 @@
+package relay_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	bhost "github.com/ipfs/go-ipfs/p2p/host/basic"
+	inet "github.com/ipfs/go-ipfs/p2p/net"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
+	relay "github.com/ipfs/go-ipfs/p2p/protocol/relay"
+	pb "github.com/ipfs/go-ipfs/p2p/protocol/relay/pb"
+	testutil "github.com/ipfs/go-ipfs/p2p/test/util"
+
+	ggio "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/io"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// circuitHosts returns a source, a relay and a destination host, with the
+// source and destination connected to the relay only.
+func circuitHosts(t *testing.T, ctx context.Context, hop, preferDirect bool) (src, r, dst *bhost.BasicHost, srcc *relay.Circuit) {
+	return circuitHostsOpts(t, ctx, relay.CircuitOpts{Hop: hop}, preferDirect)
+}
+
+// circuitHostsOpts is circuitHosts with a relay set up with ropts.
+func circuitHostsOpts(t *testing.T, ctx context.Context, ropts relay.CircuitOpts, preferDirect bool) (src, r, dst *bhost.BasicHost, srcc *relay.Circuit) {
+	src = testutil.GenHostSwarm(t, ctx)
+	r = testutil.GenHostSwarm(t, ctx)
+	dst = testutil.GenHostSwarm(t, ctx)
+
+	opts := relay.CircuitOpts{PreferDirect: preferDirect}
+	srcc, err := relay.NewCircuit(ctx, src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := relay.NewCircuit(ctx, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := relay.NewCircuit(ctx, r, ropts); err != nil {
+		t.Fatal(err)
+	}
+
+	rpi := r.Peerstore().PeerInfo(r.ID())
+	if err := src.Connect(ctx, rpi); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Connect(ctx, rpi); err != nil {
+		t.Fatal(err)
+	}
+	return src, r, dst, srcc
+}
+
+func waitForRelay(t *testing.T, c *relay.Circuit, r peer.ID) {
+	for i := 0; i < 50; i++ {
+		for _, p := range c.Relays() {
+			if p == r {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	t.Fatalf("%s never became a relay", r)
+}
+
+func TestCircuitRelaysConns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src, r, dst, srcc := circuitHosts(t, ctx, true, false)
+	waitForRelay(t, srcc, r.ID())
+
+	dst.SetStreamHandler(protocol.TestingID, func(s inet.Stream) {
+		io.Copy(s, s)
+		s.Close()
+	})
+
+	// src has no addresses of dst, so it can only reach it through r.
+	if err := src.Connect(ctx, peer.PeerInfo{ID: dst.ID()}); err != nil {
+		t.Fatal(err)
+	}
+	conns := src.Network().ConnsToPeer(dst.ID())
+	if len(conns) != 1 || !relay.IsRelayed(conns[0]) {
+		t.Fatalf("expected a relayed conn to dst, got %v", conns)
+	}
+
+	s, err := src.NewStream(protocol.TestingID, dst.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	buf1 := []byte("abcdefghij")
+	buf2 := make([]byte, len(buf1))
+	if _, err := s.Write(buf1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(s, buf2); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf1) != string(buf2) {
+		t.Fatalf("echoed %q, not %q", buf2, buf1)
+	}
+}
+
+func TestCircuitNeedsHop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src, _, dst, srcc := circuitHosts(t, ctx, false, false)
+
+	// give src the time to ask r whether it relays.
+	time.Sleep(time.Millisecond * 500)
+	if rs := srcc.Relays(); len(rs) != 0 {
+		t.Fatalf("expected no relays, got %s", rs)
+	}
+	if err := src.Connect(ctx, peer.PeerInfo{ID: dst.ID()}); err == nil {
+		t.Fatal("expected dialing dst without a relay to fail")
+	}
+}
+
+func TestCircuitPrefersDirect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src, r, dst, srcc := circuitHosts(t, ctx, true, true)
+	waitForRelay(t, srcc, r.ID())
+
+	if err := src.Connect(ctx, peer.PeerInfo{ID: dst.ID()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the hosts learn the addresses of each other over the circuit, and
+	// dial each other directly, for the circuit to be closed.
+	for i := 0; i < 50; i++ {
+		conns := src.Network().ConnsToPeer(dst.ID())
+		relayed := false
+		for _, c := range conns {
+			relayed = relayed || relay.IsRelayed(c)
+		}
+		if len(conns) > 0 && !relayed {
+			return
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	t.Fatalf("expected direct conns only, got %v", src.Network().ConnsToPeer(dst.ID()))
+}
+
+// hop asks r for a circuit from src to dst, and returns the stream of it
+// and the answer of r.
+func hop(t *testing.T, src, r, dst *bhost.BasicHost) (inet.Stream, pb.CircuitRelay_Status) {
+	s, err := src.NewStream(relay.CircuitID, r.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &pb.CircuitRelay{
+		Type:    pb.CircuitRelay_HOP.Enum(),
+		SrcPeer: &pb.CircuitRelay_Peer{Id: []byte(src.ID())},
+		DstPeer: &pb.CircuitRelay_Peer{Id: []byte(dst.ID())},
+	}
+	if err := ggio.NewDelimitedWriter(s).WriteMsg(m); err != nil {
+		t.Fatal(err)
+	}
+	var status pb.CircuitRelay
+	if err := ggio.NewDelimitedReader(s, 4096).ReadMsg(&status); err != nil {
+		t.Fatal(err)
+	}
+	return s, status.GetCode()
+}
+
+func TestCircuitLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ropts := relay.CircuitOpts{Hop: true, MaxCircuits: 2, MaxCircuitsPerPeer: 1}
+	src, r, dst, _ := circuitHostsOpts(t, ctx, ropts, false)
+	other := testutil.GenHostSwarm(t, ctx)
+	if err := other.Connect(ctx, r.Peerstore().PeerInfo(r.ID())); err != nil {
+		t.Fatal(err)
+	}
+	third := testutil.GenHostSwarm(t, ctx)
+	if err := third.Connect(ctx, r.Peerstore().PeerInfo(r.ID())); err != nil {
+		t.Fatal(err)
+	}
+
+	s1, code := hop(t, src, r, dst)
+	if code != pb.CircuitRelay_SUCCESS {
+		t.Fatalf("expected the first circuit relayed, got %s", code)
+	}
+	s2, code := hop(t, src, r, dst)
+	s2.Close()
+	if code != pb.CircuitRelay_HOP_CANT_RELAY_MORE {
+		t.Fatalf("expected a second circuit of src refused, got %s", code)
+	}
+
+	s3, code := hop(t, other, r, dst)
+	if code != pb.CircuitRelay_SUCCESS {
+		t.Fatalf("expected a circuit of another peer relayed, got %s", code)
+	}
+	defer s3.Close()
+	s4, code := hop(t, third, r, dst)
+	s4.Close()
+	if code != pb.CircuitRelay_HOP_CANT_RELAY_MORE {
+		t.Fatalf("expected a circuit over the total refused, got %s", code)
+	}
+
+	// once its circuit closes, src may open another
+	s1.Close()
+	for i := 0; i < 50; i++ {
+		s, code := hop(t, src, r, dst)
+		s.Close()
+		if code == pb.CircuitRelay_SUCCESS {
+			return
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	t.Fatal("the closed circuit was never forgotten")
+}
+
+func TestCircuitBandwidthLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ropts := relay.CircuitOpts{Hop: true, BandwidthLimit: 64 << 10}
+	src, r, dst, srcc := circuitHostsOpts(t, ctx, ropts, false)
+	waitForRelay(t, srcc, r.ID())
+
+	dst.SetStreamHandler(protocol.TestingID, func(s inet.Stream) {
+		io.Copy(s, s)
+		s.Close()
+	})
+	if err := src.Connect(ctx, peer.PeerInfo{ID: dst.ID()}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := src.NewStream(protocol.TestingID, dst.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// 32KiB each way, at 64KiB a second in all
+	start := time.Now()
+	data := make([]byte, 32<<10)
+	go s.Write(data)
+	if _, err := io.ReadFull(s, make([]byte, len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took < time.Millisecond*700 {
+		t.Fatalf("expected the circuit paced to the limit, took %s", took)
+	}
+}
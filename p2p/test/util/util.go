@@ -6,6 +6,7 @@ import (
 	metrics "github.com/ipfs/go-ipfs/metrics"
 	bhost "github.com/ipfs/go-ipfs/p2p/host/basic"
 	inet "github.com/ipfs/go-ipfs/p2p/net"
+	pnet "github.com/ipfs/go-ipfs/p2p/net/pnet"
 	swarm "github.com/ipfs/go-ipfs/p2p/net/swarm"
 	peer "github.com/ipfs/go-ipfs/p2p/peer"
 	tu "github.com/ipfs/go-ipfs/util/testutil"
@@ -19,7 +20,21 @@ func GenSwarmNetwork(t *testing.T, ctx context.Context) *swarm.Network {
 	ps := peer.NewPeerstore()
 	ps.AddPubKey(p.ID, p.PubKey)
 	ps.AddPrivKey(p.ID, p.PrivKey)
-	n, err := swarm.NewNetwork(ctx, []ma.Multiaddr{p.Addr}, p.ID, ps, metrics.NewBandwidthCounter())
+	n, err := swarm.NewNetwork(ctx, []ma.Multiaddr{p.Addr}, p.ID, ps, metrics.NewBandwidthCounter(), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.AddAddrs(p.ID, n.ListenAddresses(), peer.PermanentAddrTTL)
+	return n
+}
+
+// GenPrivateSwarmNetwork returns a network of the private network of psk.
+func GenPrivateSwarmNetwork(t *testing.T, ctx context.Context, psk *pnet.PSK) *swarm.Network {
+	p := tu.RandPeerNetParamsOrFatal(t)
+	ps := peer.NewPeerstore()
+	ps.AddPubKey(p.ID, p.PubKey)
+	ps.AddPrivKey(p.ID, p.PrivKey)
+	n, err := swarm.NewNetwork(ctx, []ma.Multiaddr{p.Addr}, p.ID, ps, metrics.NewBandwidthCounter(), psk, false)
 	if err != nil {
 		t.Fatal(err)
 	}
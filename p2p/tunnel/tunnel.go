@@ -0,0 +1,256 @@
+// Package tunnel forwards bytes between local TCP sockets and streams of
+// custom protocols, for other applications to reach each other over the
+// swarm. A listener hands the streams of its protocol that peers open to a
+// local address; a forward listens on a local address, and hands the
+// connections made to it to streams opened to a peer.
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	host "github.com/ipfs/go-ipfs/p2p/host"
+	inet "github.com/ipfs/go-ipfs/p2p/net"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
+	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
+)
+
+var log = eventlog.Logger("p2p/tunnel")
+
+// ProtocolPrefix starts the names of the protocols that may be forwarded,
+// for those of ipfs itself never to be.
+const ProtocolPrefix = "/x/"
+
+// dialTimeout bounds connecting to the peer of a forward.
+const dialTimeout = time.Second * 30
+
+var (
+	ErrNoSuchListener = errors.New("no such listener")
+	ErrNoSuchForward  = errors.New("no such forward")
+)
+
+// Listener hands the streams of Protocol peers open to Target.
+type Listener struct {
+	Protocol protocol.ID
+	Target   ma.Multiaddr
+}
+
+// Forward hands the connections made to Address to streams of Protocol
+// opened to Peer.
+type Forward struct {
+	Peer     peer.ID
+	Protocol protocol.ID
+	Address  ma.Multiaddr
+
+	list manet.Listener
+}
+
+// Tunnels keeps the listeners and forwards of a host.
+type Tunnels struct {
+	host host.Host
+	ctx  context.Context
+
+	mx        sync.Mutex
+	listeners map[protocol.ID]*Listener
+	forwards  map[string]*Forward // by address
+}
+
+// New returns the tunnels of h, which are all closed once ctx is done.
+func New(ctx context.Context, h host.Host) *Tunnels {
+	t := &Tunnels{
+		host:      h,
+		ctx:       ctx,
+		listeners: make(map[protocol.ID]*Listener),
+		forwards:  make(map[string]*Forward),
+	}
+	go func() {
+		<-ctx.Done()
+		t.closeAll()
+	}()
+	return t
+}
+
+func checkProtocol(proto protocol.ID) error {
+	if !strings.HasPrefix(string(proto), ProtocolPrefix) || len(proto) == len(ProtocolPrefix) {
+		return fmt.Errorf("protocol names must start with %s, not %q", ProtocolPrefix, proto)
+	}
+	return nil
+}
+
+// Listen has the streams of proto peers open handed to target.
+func (t *Tunnels) Listen(proto protocol.ID, target ma.Multiaddr) (*Listener, error) {
+	if err := checkProtocol(proto); err != nil {
+		return nil, err
+	}
+	if _, _, err := manet.DialArgs(target); err != nil {
+		return nil, err
+	}
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if _, ok := t.listeners[proto]; ok {
+		return nil, fmt.Errorf("%s is listened to already", proto)
+	}
+	l := &Listener{Protocol: proto, Target: target}
+	t.listeners[proto] = l
+	t.host.SetStreamHandler(proto, func(s inet.Stream) {
+		c, err := manet.Dial(target)
+		if err != nil {
+			log.Debugf("tunnel: dialing %s for %s: %s", target, proto, err)
+			s.Close()
+			return
+		}
+		proxy(s, c)
+	})
+	return l, nil
+}
+
+// Dial has the connections made to laddr handed to streams of proto opened
+// to p. The address listened on is that of the forward returned, which
+// differs from laddr when it has port 0.
+func (t *Tunnels) Dial(p peer.ID, proto protocol.ID, laddr ma.Multiaddr) (*Forward, error) {
+	if err := checkProtocol(proto); err != nil {
+		return nil, err
+	}
+	list, err := manet.Listen(laddr)
+	if err != nil {
+		return nil, err
+	}
+	f := &Forward{
+		Peer:     p,
+		Protocol: proto,
+		Address:  list.Multiaddr(),
+		list:     list,
+	}
+
+	t.mx.Lock()
+	t.forwards[f.Address.String()] = f
+	t.mx.Unlock()
+
+	go t.accept(f)
+	return f, nil
+}
+
+func (t *Tunnels) accept(f *Forward) {
+	for {
+		c, err := f.list.Accept()
+		if err != nil {
+			t.mx.Lock()
+			if t.forwards[f.Address.String()] == f {
+				delete(t.forwards, f.Address.String())
+			}
+			t.mx.Unlock()
+			return
+		}
+		go t.dialForward(f, c)
+	}
+}
+
+func (t *Tunnels) dialForward(f *Forward, c manet.Conn) {
+	ctx, cancel := context.WithTimeout(t.ctx, dialTimeout)
+	defer cancel()
+	if err := t.host.Connect(ctx, peer.PeerInfo{ID: f.Peer}); err != nil {
+		log.Debugf("tunnel: connecting to %s: %s", f.Peer, err)
+		c.Close()
+		return
+	}
+	s, err := t.host.NewStream(f.Protocol, f.Peer)
+	if err != nil {
+		log.Debugf("tunnel: opening a %s stream to %s: %s", f.Protocol, f.Peer, err)
+		c.Close()
+		return
+	}
+	proxy(s, c)
+}
+
+// proxy copies between s and c, until either is done.
+func proxy(s inet.Stream, c manet.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(s, c)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(c, s)
+		done <- struct{}{}
+	}()
+	<-done
+	s.Close()
+	c.Close()
+}
+
+// Listeners returns the listeners.
+func (t *Tunnels) Listeners() []*Listener {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	var ls []*Listener
+	for _, l := range t.listeners {
+		ls = append(ls, l)
+	}
+	return ls
+}
+
+// Forwards returns the forwards.
+func (t *Tunnels) Forwards() []*Forward {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	var fs []*Forward
+	for _, f := range t.forwards {
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+// CloseListener stops listening to proto. The streams handed over already
+// stay open.
+func (t *Tunnels) CloseListener(proto protocol.ID) error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if _, ok := t.listeners[proto]; !ok {
+		return ErrNoSuchListener
+	}
+	delete(t.listeners, proto)
+	t.host.RemoveStreamHandler(proto)
+	return nil
+}
+
+// CloseForward stops listening on the address addr of a forward. The
+// connections handed over already stay open.
+func (t *Tunnels) CloseForward(addr ma.Multiaddr) error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	f, ok := t.forwards[addr.String()]
+	if !ok {
+		return ErrNoSuchForward
+	}
+	delete(t.forwards, addr.String())
+	return f.list.Close()
+}
+
+func (t *Tunnels) closeAll() {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	for proto := range t.listeners {
+		t.host.RemoveStreamHandler(proto)
+		delete(t.listeners, proto)
+	}
+	for addr, f := range t.forwards {
+		f.list.Close()
+		delete(t.forwards, addr)
+	}
+}
@@ -0,0 +1,116 @@
+package tunnel
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	protocol "github.com/ipfs/go-ipfs/p2p/protocol"
+	testutil "github.com/ipfs/go-ipfs/p2p/test/util"
+)
+
+func localAddr(t *testing.T) ma.Multiaddr {
+	a, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// echo serves connections to a local address by echoing what they send.
+func echo(t *testing.T) manet.Listener {
+	list, err := manet.Listen(localAddr(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, err := list.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+	return list
+}
+
+func TestTunnelForwards(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1 := testutil.GenHostSwarm(t, ctx)
+	h2 := testutil.GenHostSwarm(t, ctx)
+	if err := h1.Connect(ctx, h2.Peerstore().PeerInfo(h2.ID())); err != nil {
+		t.Fatal(err)
+	}
+	t1 := New(ctx, h1)
+	t2 := New(ctx, h2)
+
+	target := echo(t)
+	defer target.Close()
+	if _, err := t2.Listen("/x/echo", target.Multiaddr()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := t2.Listen("/x/echo", target.Multiaddr()); err == nil {
+		t.Fatal("listened to the same protocol twice")
+	}
+
+	f, err := t1.Dial(h2.ID(), "/x/echo", localAddr(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := manet.Dial(f.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, []byte("hello")) {
+		t.Fatalf("got %q back", buf)
+	}
+
+	if len(t1.Forwards()) != 1 || len(t2.Listeners()) != 1 {
+		t.Fatal("the forward and listener aren't listed")
+	}
+	if err := t1.CloseForward(f.Address); err != nil {
+		t.Fatal(err)
+	}
+	if err := t1.CloseForward(f.Address); err != ErrNoSuchForward {
+		t.Fatalf("expected no such forward, got %v", err)
+	}
+	if _, err := manet.Dial(f.Address); err == nil {
+		t.Fatal("the forward still listens once closed")
+	}
+	if err := t2.CloseListener("/x/echo"); err != nil {
+		t.Fatal(err)
+	}
+	if len(t2.Listeners()) != 0 {
+		t.Fatal("the listener is still listed once closed")
+	}
+}
+
+func TestTunnelProtocolNames(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tun := New(ctx, testutil.GenHostSwarm(t, ctx))
+	for _, proto := range []string{"/ipfs/bitswap", "/x/", "x/foo"} {
+		if _, err := tun.Listen(protocol.ID(proto), localAddr(t)); err == nil {
+			t.Fatalf("listened to %s", proto)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package path
+
+import (
+	"sync/atomic"
+
+	lru "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/hashicorp/golang-lru"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+// DefaultCacheSize is how many paths a Cache remembers, unless set.
+const DefaultCacheSize = 4096
+
+// Cache remembers the keys of the objects paths resolve to, for a Resolver
+// not to walk their links again. The paths it holds start from a hash, so
+// they always resolve to the same object: IPNS names are resolved first,
+// and a name updated resolves to paths from another hash, which miss.
+type Cache struct {
+	lru    *lru.Cache
+	size   int
+	hits   uint64
+	misses uint64
+}
+
+// CacheStats counts how the lookups of a Cache were answered.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Len is the number of paths held, out of Size.
+	Len  int
+	Size int
+}
+
+// NewCache returns a Cache of the size latest paths resolved.
+func NewCache(size int) (*Cache, error) {
+	c, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{lru: c, size: size}, nil
+}
+
+func (c *Cache) get(p string) (key.Key, bool) {
+	v, ok := c.lru.Get(p)
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return "", false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	return v.(key.Key), true
+}
+
+func (c *Cache) add(p string, k key.Key) {
+	c.lru.Add(p, k)
+}
+
+// Stats returns the counts of the lookups of c.
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Len:    c.lru.Len(),
+		Size:   c.size,
+	}
+}
@@ -5,10 +5,8 @@ import (
 	"path"
 	"strings"
 
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
 	key "github.com/ipfs/go-ipfs/blocks/key"
-
-	b58 "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-base58"
-	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 )
 
 // ErrBadPath is returned when a given path is incorrectly formatted
@@ -77,16 +75,16 @@ func ParsePath(txt string) (Path, error) {
 }
 
 func ParseKeyToPath(txt string) (Path, error) {
-	chk := b58.Decode(txt)
+	chk := key.B58KeyDecode(txt)
 	if len(chk) == 0 {
 		return "", errors.New("not a key")
 	}
 
-	_, err := mh.Cast(chk)
+	c, err := cid.Cast(chk)
 	if err != nil {
 		return "", err
 	}
-	return FromKey(key.Key(chk)), nil
+	return FromKey(c.Key()), nil
 }
 
 func (p *Path) IsValid() error {
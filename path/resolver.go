@@ -4,13 +4,17 @@ package path
 import (
 	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
+	cid "github.com/ipfs/go-ipfs/blocks/cid"
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	merkledag "github.com/ipfs/go-ipfs/merkledag"
+	hamt "github.com/ipfs/go-ipfs/unixfs/hamt"
 	u "github.com/ipfs/go-ipfs/util"
 )
 
@@ -34,6 +38,10 @@ func (e ErrNoLink) Error() string {
 // It has a pointer to a DAGService, which is uses to resolve nodes.
 type Resolver struct {
 	DAG merkledag.DAGService
+
+	// Cache, if set, holds the keys of the objects of the paths resolved
+	// lately, for ResolvePath not to walk their links again.
+	Cache *Cache
 }
 
 // SplitAbsPath clean up and split fpath. It extracts the first component (which
@@ -52,24 +60,47 @@ func SplitAbsPath(fpath Path) (mh.Multihash, []string, error) {
 		return nil, nil, ErrNoComponents
 	}
 
-	// first element in the path is a b58 hash (for now)
-	h, err := mh.FromB58String(parts[0])
+	// first element in the path is a b58 hash, or cid
+	c, err := cid.Parse(parts[0])
 	if err != nil {
 		log.Debug("given path element is not a base58 string.\n")
 		return nil, nil, err
 	}
 
-	return h, parts[1:], nil
+	return mh.Multihash(c.Key()), parts[1:], nil
 }
 
 // ResolvePath fetches the node for given path. It returns the last item
 // returned by ResolvePathComponents.
 func (s *Resolver) ResolvePath(ctx context.Context, fpath Path) (*merkledag.Node, error) {
+	h, parts, err := SplitAbsPath(fpath)
+	if err != nil {
+		return nil, err
+	}
+	// paths of a hash alone have nothing to walk
+	var cpath string
+	if s.Cache != nil && len(parts) > 0 {
+		cpath = FromKey(key.Key(h)).String() + "/" + strings.Join(parts, "/")
+		if k, ok := s.Cache.get(cpath); ok {
+			ctx, cancel := context.WithTimeout(ctx, time.Minute)
+			defer cancel()
+			return s.DAG.Get(ctx, k)
+		}
+	}
+
 	nodes, err := s.ResolvePathComponents(ctx, fpath)
 	if err != nil || nodes == nil {
 		return nil, err
 	}
-	return nodes[len(nodes)-1], err
+	nd := nodes[len(nodes)-1]
+	if cpath != "" {
+		k, err := nd.Key()
+		if err != nil {
+			return nil, err
+		}
+		s.Cache.add(cpath, k)
+	}
+	return nd, nil
 }
 
 // ResolvePathComponents fetches the nodes for each segment of the given path.
@@ -108,18 +139,12 @@ func (s *Resolver) ResolveLinks(ctx context.Context, ndd *merkledag.Node, names
 	// for each of the path components
 	for _, name := range names {
 
-		var next key.Key
-		var nlink *merkledag.Link
-		// for each of the links in nd, the current object
-		for _, link := range nd.Links {
-			if link.Name == name {
-				next = key.Key(link.Hash)
-				nlink = link
-				break
-			}
+		nlink, err := s.findLink(ctx, nd, name)
+		if err != nil {
+			return result, err
 		}
 
-		if next == "" {
+		if nlink == nil {
 			n, _ := nd.Multihash()
 			return result, ErrNoLink{name: name, node: n}
 		}
@@ -128,8 +153,7 @@ func (s *Resolver) ResolveLinks(ctx context.Context, ndd *merkledag.Node, names
 			// fetch object for link and assign to nd
 			ctx, cancel := context.WithTimeout(ctx, time.Minute)
 			defer cancel()
-			var err error
-			nd, err = s.DAG.Get(ctx, next)
+			nd, err = s.DAG.Get(ctx, key.Key(nlink.Hash))
 			if err != nil {
 				return append(result, nd), err
 			}
@@ -142,3 +166,26 @@ func (s *Resolver) ResolveLinks(ctx context.Context, ndd *merkledag.Node, names
 	}
 	return result, nil
 }
+
+// findLink returns the link called name in nd, or nil if there is none.
+// The entries of a sharded directory are looked up in its shards.
+func (s *Resolver) findLink(ctx context.Context, nd *merkledag.Node, name string) (*merkledag.Link, error) {
+	if hamt.IsShard(nd) {
+		shard, err := hamt.NewHamtFromDag(s.DAG, nd)
+		if err != nil {
+			return nil, err
+		}
+		lnk, err := shard.Find(ctx, name)
+		if err == os.ErrNotExist {
+			return nil, nil
+		}
+		return lnk, err
+	}
+
+	for _, link := range nd.Links {
+		if link.Name == name {
+			return link, nil
+		}
+	}
+	return nil, nil
+}
@@ -82,3 +82,53 @@ func TestRecurivePathResolution(t *testing.T) {
 			p.String(), key.String(), cKey.String()))
 	}
 }
+
+func TestCachedPathResolution(t *testing.T) {
+	ctx := context.Background()
+	dstore := sync.MutexWrap(datastore.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := blockservice.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dagService := merkledag.NewDAGService(bserv)
+
+	a, _ := randNode()
+	b, bKey := randNode()
+	if err := a.AddNodeLink("child", b); err != nil {
+		t.Fatal(err)
+	}
+	if err := dagService.AddRecursive(a); err != nil {
+		t.Fatal(err)
+	}
+	aKey, err := a.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := path.NewCache(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := &path.Resolver{DAG: dagService, Cache: cache}
+	p := path.Path("/ipfs/" + aKey.String() + "/child")
+	for i := 0; i < 3; i++ {
+		node, err := resolver.ResolvePath(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k, _ := node.Key(); k != bKey {
+			t.Fatalf("resolved to %s, expected %s", k, bKey)
+		}
+	}
+
+	// a path of a hash alone is not cached
+	if _, err := resolver.ResolvePath(ctx, path.FromKey(aKey)); err != nil {
+		t.Fatal(err)
+	}
+
+	st := cache.Stats()
+	if st.Hits != 2 || st.Misses != 1 || st.Len != 1 {
+		t.Fatalf("expected 2 hits and 1 miss of 1 path, got %+v", st)
+	}
+}
@@ -0,0 +1,85 @@
+package pin
+
+import (
+	"sort"
+	"time"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+var bestEffortDatastoreKey = ds.NewKey("/local/pins/besteffort/keys")
+
+// bestEffortPins holds the best-effort pins, by when they were last used.
+// Unlike the other pins, they don't count towards the indirect pins of
+// their graphs: garbage collection keeps what it finds local of them, and
+// evicts them, least recently used first, when it runs short of space.
+type bestEffortPins map[key.Key]time.Time
+
+func loadBestEffort(d ds.Datastore, k ds.Key) (bestEffortPins, error) {
+	var stored map[string]time.Time
+	err := loadSet(d, k, &stored)
+	if err == ds.ErrNotFound {
+		return make(bestEffortPins), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pins := make(bestEffortPins, len(stored))
+	for s, t := range stored {
+		pins[key.B58KeyDecode(s)] = t
+	}
+	return pins, nil
+}
+
+func storeBestEffort(d ds.Datastore, k ds.Key, pins bestEffortPins) error {
+	stored := make(map[string]time.Time, len(pins))
+	for pk, t := range pins {
+		stored[pk.B58String()] = t
+	}
+	return storeSet(d, k, stored)
+}
+
+// keys returns the keys of the pins, least recently used first.
+func (b bestEffortPins) keys() []key.Key {
+	keys := make([]key.Key, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	sort.Sort(byLastUse{keys, b})
+	return keys
+}
+
+type byLastUse struct {
+	keys []key.Key
+	pins bestEffortPins
+}
+
+func (s byLastUse) Len() int      { return len(s.keys) }
+func (s byLastUse) Swap(i, j int) { s.keys[i], s.keys[j] = s.keys[j], s.keys[i] }
+func (s byLastUse) Less(i, j int) bool {
+	ti, tj := s.pins[s.keys[i]], s.pins[s.keys[j]]
+	if ti.Equal(tj) {
+		return s.keys[i] < s.keys[j]
+	}
+	return ti.Before(tj)
+}
+
+// BestEffortKeys returns the best-effort pinned keys, least recently used
+// first, in the order garbage collection evicts them.
+func (p *pinner) BestEffortKeys() []key.Key {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.bestEffort.keys()
+}
+
+// TouchBestEffort marks the best-effort pin of k, if there is one, as used
+// now, putting off its eviction. The time is saved with the next Flush.
+func (p *pinner) TouchBestEffort(k key.Key) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.bestEffort[k]; ok {
+		p.bestEffort[k] = time.Now()
+	}
+}
@@ -65,6 +65,30 @@ func (i *indirectPin) Decrement(k key.Key) {
 	}
 }
 
+// refDelta holds changes to the indirect pin counts, applied together once
+// they are all known.
+type refDelta map[key.Key]int
+
+func (d refDelta) inc(k key.Key) { d[k]++ }
+func (d refDelta) dec(k key.Key) { d[k]-- }
+
+// apply adds the changes of d to the counts.
+func (i *indirectPin) apply(d refDelta) {
+	for k, n := range d {
+		if n == 0 {
+			continue
+		}
+		c := i.refCounts[k] + n
+		if c <= 0 {
+			i.blockset.RemoveBlock(k)
+			delete(i.refCounts, k)
+			continue
+		}
+		i.refCounts[k] = c
+		i.blockset.AddBlock(k)
+	}
+}
+
 func (i *indirectPin) HasKey(k key.Key) bool {
 	return i.blockset.HasKey(k)
 }
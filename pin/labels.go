@@ -0,0 +1,41 @@
+package pin
+
+import (
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+)
+
+var labelDatastoreKey = ds.NewKey("/local/pins/labels")
+
+// Label is what a user tells about a direct or recursive pin: a name to
+// find it by, and any metadata of their own.
+type Label struct {
+	Name string
+	Meta map[string]string `json:",omitempty"`
+}
+
+func loadLabels(d ds.Datastore, k ds.Key) (map[key.Key]Label, error) {
+	var lbStore map[string]Label
+	err := loadSet(d, k, &lbStore)
+	if err == ds.ErrNotFound {
+		// repos from before pins had labels
+		return make(map[key.Key]Label), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[key.Key]Label)
+	for encK, l := range lbStore {
+		labels[key.B58KeyDecode(encK)] = l
+	}
+	return labels, nil
+}
+
+func storeLabels(d ds.Datastore, k ds.Key, labels map[key.Key]Label) error {
+	lbStore := map[string]Label{}
+	for k, l := range labels {
+		lbStore[key.B58KeyEncode(k)] = l
+	}
+	return storeSet(d, k, lbStore)
+}
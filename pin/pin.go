@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	nsds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/namespace"
@@ -14,6 +15,7 @@ import (
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	"github.com/ipfs/go-ipfs/blocks/set"
 	mdag "github.com/ipfs/go-ipfs/merkledag"
+	traverse "github.com/ipfs/go-ipfs/merkledag/traverse"
 	"github.com/ipfs/go-ipfs/util"
 )
 
@@ -29,17 +31,28 @@ const (
 	Direct
 	Indirect
 	NotPinned
+	// BestEffort pins keep an object, and what is local of its graph,
+	// from garbage collection while space permits.
+	BestEffort
 )
 
 type Pinner interface {
 	IsPinned(key.Key) bool
 	Pin(context.Context, *mdag.Node, bool) error
 	Unpin(context.Context, key.Key, bool) error
+	Update(ctx context.Context, from key.Key, to *mdag.Node) error
 	Flush() error
 	GetManual() ManualPinner
 	DirectKeys() []key.Key
 	IndirectKeys() map[key.Key]int
 	RecursiveKeys() []key.Key
+
+	// SetLabel labels the direct, recursive or best-effort pin of a key.
+	SetLabel(key.Key, Label) error
+	Labels() map[key.Key]Label
+
+	BestEffortKeys() []key.Key
+	TouchBestEffort(key.Key)
 }
 
 // ManualPinner is for manually editing the pin structure
@@ -57,6 +70,8 @@ type pinner struct {
 	recursePin set.BlockSet
 	directPin  set.BlockSet
 	indirPin   *indirectPin
+	bestEffort bestEffortPins
+	labels     map[key.Key]Label
 	dserv      mdag.DAGService
 	dstore     ds.ThreadSafeDatastore
 }
@@ -76,6 +91,8 @@ func NewPinner(dstore ds.ThreadSafeDatastore, serv mdag.DAGService) Pinner {
 		recursePin: rcset,
 		directPin:  dirset,
 		indirPin:   NewIndirectPin(nsdstore),
+		bestEffort: make(bestEffortPins),
+		labels:     make(map[key.Key]Label),
 		dserv:      serv,
 		dstore:     dstore,
 	}
@@ -121,23 +138,40 @@ func (p *pinner) Pin(ctx context.Context, node *mdag.Node, recurse bool) error {
 }
 
 // Unpin a given key
-func (p *pinner) Unpin(ctx context.Context, k key.Key, recursive bool) error {
+func (p *pinner) Unpin(ctx context.Context, k key.Key, recursive bool) (err error) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
+	if _, ok := p.bestEffort[k]; ok && !p.recursePin.HasKey(k) && !p.directPin.HasKey(k) {
+		delete(p.bestEffort, k)
+		delete(p.labels, k)
+		return nil
+	}
+	// the best-effort pin goes along with any other pin of k
+	defer func() {
+		if err == nil {
+			delete(p.bestEffort, k)
+		}
+	}()
+
 	if p.recursePin.HasKey(k) {
 		if recursive {
-			p.recursePin.RemoveBlock(k)
 			node, err := p.dserv.Get(ctx, k)
 			if err != nil {
 				return err
 			}
+			if err := p.unpinLinks(ctx, node); err != nil {
+				return err
+			}
 
-			return p.unpinLinks(ctx, node)
+			p.recursePin.RemoveBlock(k)
+			delete(p.labels, k)
+			return nil
 		} else {
 			return fmt.Errorf("%s is pinned recursively", k)
 		}
 	} else if p.directPin.HasKey(k) {
 		p.directPin.RemoveBlock(k)
+		delete(p.labels, k)
 		return nil
 	} else if p.indirPin.HasKey(k) {
 		return fmt.Errorf("%s is pinned indirectly. indirect pins cannot be removed directly", k)
@@ -146,53 +180,179 @@ func (p *pinner) Unpin(ctx context.Context, k key.Key, recursive bool) error {
 	}
 }
 
-func (p *pinner) unpinLinks(ctx context.Context, node *mdag.Node) error {
-	for _, l := range node.Links {
-		node, err := l.GetNode(ctx, p.dserv)
-		if err != nil {
+// Update moves the recursive pin of from over to the node to, pinning to
+// recursively and unpinning from. The indirect pins of the subgraphs the
+// two have in common are left as they are, so those subgraphs are neither
+// walked nor fetched: only the parts of to that changed are.
+func (p *pinner) Update(ctx context.Context, from key.Key, to *mdag.Node) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if !p.recursePin.HasKey(from) {
+		return fmt.Errorf("%s is not pinned recursively", from)
+	}
+	tok, err := to.Key()
+	if err != nil {
+		return err
+	}
+	if tok == from {
+		return nil
+	}
+
+	fromnd, err := p.dserv.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	if p.recursePin.HasKey(tok) {
+		// to's graph is pinned already; just drop from's
+		if err := p.unpinLinks(ctx, fromnd); err != nil {
 			return err
 		}
+	} else {
+		// the counts change only once the whole update is known, so a
+		// failure to fetch a node midway leaves them as they were.
+		d := make(refDelta)
+		if err := p.updateLinks(ctx, d, fromnd, to); err != nil {
+			return err
+		}
+		p.indirPin.apply(d)
+		if p.directPin.HasKey(tok) {
+			p.directPin.RemoveBlock(tok)
+		}
+		p.recursePin.AddBlock(tok)
+	}
+	p.recursePin.RemoveBlock(from)
+
+	if l, ok := p.labels[from]; ok {
+		if _, ok := p.labels[tok]; !ok {
+			p.labels[tok] = l
+		}
+		delete(p.labels, from)
+	}
+	return nil
+}
 
-		k, err := node.Key()
+// updateLinks records in d the changes turning the indirect pins of the
+// links of from into those of the links of to. A link of to that from has too is skipped, as it pins
+// the same subgraph. Of the others, a link that has an old counterpart in
+// from, with the same name, is updated in turn, and the rest are pinned,
+// or, in from, unpinned, in full.
+func (p *pinner) updateLinks(ctx context.Context, d refDelta, from, to *mdag.Node) error {
+	common := make(map[key.Key]int)
+	for _, l := range from.Links {
+		common[key.Key(l.Hash)]++
+	}
+	var added []*mdag.Link
+	for _, l := range to.Links {
+		k := key.Key(l.Hash)
+		if common[k] > 0 {
+			common[k]--
+			continue
+		}
+		added = append(added, l)
+	}
+	// what's left in common is what from has but to doesn't
+	removed := make(map[string][]*mdag.Link)
+	var order []*mdag.Link
+	for _, l := range from.Links {
+		k := key.Key(l.Hash)
+		if common[k] > 0 {
+			common[k]--
+			removed[l.Name] = append(removed[l.Name], l)
+			order = append(order, l)
+		}
+	}
+
+	paired := make(map[*mdag.Link]bool)
+	for _, l := range added {
+		nd, err := l.GetNode(ctx, p.dserv)
 		if err != nil {
 			return err
 		}
+		d.inc(key.Key(l.Hash))
 
-		p.indirPin.Decrement(k)
+		olds := removed[l.Name]
+		if len(olds) == 0 {
+			if err := p.eachDescendant(ctx, nd, d.inc); err != nil {
+				return err
+			}
+			continue
+		}
+		old := olds[0]
+		removed[l.Name] = olds[1:]
+		paired[old] = true
 
-		err = p.unpinLinks(ctx, node)
+		oldnd, err := old.GetNode(ctx, p.dserv)
 		if err != nil {
 			return err
 		}
+		d.dec(key.Key(old.Hash))
+		if err := p.updateLinks(ctx, d, oldnd, nd); err != nil {
+			return err
+		}
+	}
+
+	for _, l := range order {
+		if paired[l] {
+			continue
+		}
+		nd, err := l.GetNode(ctx, p.dserv)
+		if err != nil {
+			return err
+		}
+		d.dec(key.Key(l.Hash))
+		if err := p.eachDescendant(ctx, nd, d.dec); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (p *pinner) pinIndirectRecurse(ctx context.Context, node *mdag.Node) error {
-	k, err := node.Key()
-	if err != nil {
+// unpinLinks unpins the descendants of node, or none of them if one can't
+// be fetched.
+func (p *pinner) unpinLinks(ctx context.Context, node *mdag.Node) error {
+	d := make(refDelta)
+	if err := p.eachDescendant(ctx, node, d.dec); err != nil {
 		return err
 	}
-
-	p.indirPin.Increment(k)
-	return p.pinLinks(ctx, node)
+	p.indirPin.apply(d)
+	return nil
 }
 
+// pinLinks pins the descendants of node indirectly, or none of them if one
+// can't be fetched.
 func (p *pinner) pinLinks(ctx context.Context, node *mdag.Node) error {
-	for _, ng := range p.dserv.GetDAG(ctx, node) {
-		subnode, err := ng.Get(ctx)
-		if err != nil {
-			// TODO: Maybe just log and continue?
-			return err
-		}
-		err = p.pinIndirectRecurse(ctx, subnode)
-		if err != nil {
-			return err
-		}
+	d := make(refDelta)
+	if err := p.eachDescendant(ctx, node, d.inc); err != nil {
+		return err
 	}
+	p.indirPin.apply(d)
 	return nil
 }
 
+// eachDescendant calls f with the key of each descendant of node, once
+// for each path to it, as indirect pins are counted.
+func (p *pinner) eachDescendant(ctx context.Context, node *mdag.Node, f func(key.Key)) error {
+	return traverse.Traverse(node, traverse.Options{
+		DAG:         p.dserv,
+		Ctx:         ctx,
+		Order:       traverse.DFSPre,
+		Concurrency: -1,
+		Func: func(st traverse.State) error {
+			if st.Depth == 0 {
+				return nil
+			}
+			k, err := st.Node.Key()
+			if err != nil {
+				return err
+			}
+			f(k)
+			return nil
+		},
+	})
+}
+
 // IsPinned returns whether or not the given key is pinned
 func (p *pinner) IsPinned(key key.Key) bool {
 	p.lock.RLock()
@@ -212,10 +372,15 @@ func (p *pinner) RemovePinWithMode(key key.Key, mode PinMode) {
 		p.indirPin.Decrement(key)
 	case Recursive:
 		p.recursePin.RemoveBlock(key)
+	case BestEffort:
+		delete(p.bestEffort, key)
 	default:
 		// programmer error, panic OK
 		panic("unrecognized pin type")
 	}
+	if !p.hasLabelledPin(key) {
+		delete(p.labels, key)
+	}
 }
 
 // LoadPinner loads a pinner and its keysets from the given datastore
@@ -246,6 +411,22 @@ func LoadPinner(d ds.ThreadSafeDatastore, dserv mdag.DAGService) (Pinner, error)
 		}
 	}
 
+	{ // load best-effort pins
+		var err error
+		p.bestEffort, err = loadBestEffort(d, bestEffortDatastoreKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	{ // load labels
+		var err error
+		p.labels, err = loadLabels(d, labelDatastoreKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// assign services
 	p.dserv = dserv
 	p.dstore = d
@@ -268,6 +449,36 @@ func (p *pinner) RecursiveKeys() []key.Key {
 	return p.recursePin.GetKeys()
 }
 
+// SetLabel labels the pin of k, replacing any label it had. Only direct,
+// recursive and best-effort pins can be labelled.
+func (p *pinner) SetLabel(k key.Key, l Label) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.hasLabelledPin(k) {
+		return fmt.Errorf("%s is not pinned directly, recursively or best-effort", k)
+	}
+	p.labels[k] = l
+	return nil
+}
+
+// hasLabelledPin returns whether k has a pin of a kind which can be
+// labelled.
+func (p *pinner) hasLabelledPin(k key.Key) bool {
+	_, ok := p.bestEffort[k]
+	return ok || p.recursePin.HasKey(k) || p.directPin.HasKey(k)
+}
+
+// Labels returns the labels of all labelled pins
+func (p *pinner) Labels() map[key.Key]Label {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	labels := make(map[key.Key]Label, len(p.labels))
+	for k, l := range p.labels {
+		labels[k] = l
+	}
+	return labels
+}
+
 // Flush encodes and writes pinner keysets to the datastore
 func (p *pinner) Flush() error {
 	p.lock.Lock()
@@ -287,6 +498,16 @@ func (p *pinner) Flush() error {
 	if err != nil {
 		return err
 	}
+
+	err = storeBestEffort(p.dstore, bestEffortDatastoreKey, p.bestEffort)
+	if err != nil {
+		return err
+	}
+
+	err = storeLabels(p.dstore, labelDatastoreKey, p.labels)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -325,6 +546,8 @@ func (p *pinner) PinWithMode(k key.Key, mode PinMode) {
 		p.directPin.AddBlock(k)
 	case Indirect:
 		p.indirPin.Increment(k)
+	case BestEffort:
+		p.bestEffort[k] = time.Now()
 	}
 }
 
@@ -237,3 +237,313 @@ func TestPinRecursiveFail(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPinUpdate(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dserv := mdag.NewDAGService(bserv)
+
+	p := NewPinner(dstore, dserv)
+
+	add := func(nd *mdag.Node) {
+		if _, err := dserv.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(parent *mdag.Node, name string, child *mdag.Node) {
+		if err := parent.AddNodeLinkClean(name, child); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// shared is in both versions, deep is only reachable through it
+	deep, deepk := randNode()
+	shared, _ := randNode()
+	link(shared, "deep", deep)
+	oldpage, oldpagek := randNode()
+	newpage, _ := randNode()
+	gone, gonek := randNode()
+	extra, _ := randNode()
+
+	olddir, _ := randNode()
+	link(olddir, "page", oldpage)
+	link(olddir, "gone", gone)
+	newdir, _ := randNode()
+	link(newdir, "page", newpage)
+	link(newdir, "extra", extra)
+
+	from, _ := randNode()
+	link(from, "shared", shared)
+	link(from, "dir", olddir)
+	to, _ := randNode()
+	link(to, "shared", shared)
+	link(to, "dir", newdir)
+
+	for _, nd := range []*mdag.Node{deep, shared, oldpage, newpage, gone, extra, olddir, newdir, from, to} {
+		add(nd)
+	}
+	olddirk, _ := olddir.Key()
+	fromk, _ := from.Key()
+	tok, _ := to.Key()
+
+	if err := p.Update(ctx, fromk, to); err == nil {
+		t.Fatal("expected update of an unpinned object to fail")
+	}
+
+	if err := p.Pin(ctx, from, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// what's shared mustn't be walked again
+	if err := bstore.DeleteBlock(deepk); err != nil {
+		t.Fatal(err)
+	}
+	mctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := p.Update(mctx, fromk, to); err != nil {
+		t.Fatal(err)
+	}
+	add(deep)
+
+	if p.IsPinned(fromk) || !p.IsPinned(tok) {
+		t.Fatal("expected the pin to move")
+	}
+	for _, k := range []key.Key{oldpagek, gonek, olddirk} {
+		if p.IsPinned(k) {
+			t.Fatalf("%s is still pinned", k)
+		}
+	}
+
+	// the indirect pins must be those of pinning to afresh
+	q := NewPinner(dssync.MutexWrap(ds.NewMapDatastore()), dserv)
+	if err := q.Pin(ctx, to, true); err != nil {
+		t.Fatal(err)
+	}
+	got, want := p.IndirectKeys(), q.IndirectKeys()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d indirect pins, got %d", len(want), len(got))
+	}
+	for k, n := range want {
+		if got[k] != n {
+			t.Fatalf("indirect pin count of %s is %d, expected %d", k, got[k], n)
+		}
+	}
+	if !p.IsPinned(deepk) {
+		t.Fatal("expected the shared subtree to stay pinned")
+	}
+}
+
+func TestPinUpdateFail(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dserv := mdag.NewDAGService(bserv)
+
+	p := NewPinner(dstore, dserv)
+
+	link := func(parent *mdag.Node, name string, child *mdag.Node) {
+		if err := parent.AddNodeLinkClean(name, child); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// to updates dir, and adds a subtree one block of which can't be
+	// fetched, after the links of dir are already counted.
+	oldpage, _ := randNode()
+	newpage, _ := randNode()
+	olddir, _ := randNode()
+	link(olddir, "page", oldpage)
+	newdir, _ := randNode()
+	link(newdir, "page", newpage)
+	missing, missingk := randNode()
+	extra, _ := randNode()
+	link(extra, "missing", missing)
+
+	from, _ := randNode()
+	link(from, "dir", olddir)
+	to, _ := randNode()
+	link(to, "dir", newdir)
+	link(to, "extra", extra)
+
+	for _, nd := range []*mdag.Node{oldpage, newpage, olddir, newdir, missing, extra, from, to} {
+		if _, err := dserv.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fromk, _ := from.Key()
+	tok, _ := to.Key()
+
+	if err := p.Pin(ctx, from, true); err != nil {
+		t.Fatal(err)
+	}
+	before := make(map[key.Key]int)
+	for k, n := range p.IndirectKeys() {
+		before[k] = n
+	}
+
+	if err := bstore.DeleteBlock(missingk); err != nil {
+		t.Fatal(err)
+	}
+	mctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := p.Update(mctx, fromk, to); err == nil {
+		t.Fatal("expected the update to fail to fetch a block")
+	}
+
+	if !p.IsPinned(fromk) || p.IsPinned(tok) {
+		t.Fatal("expected the pin to stay on from")
+	}
+	got := p.IndirectKeys()
+	if len(got) != len(before) {
+		t.Fatalf("expected %d indirect pins, got %d", len(before), len(got))
+	}
+	for k, n := range before {
+		if got[k] != n {
+			t.Fatalf("indirect pin count of %s is %d, expected %d", k, got[k], n)
+		}
+	}
+
+	// nor may a failed recursive unpin drop the counts
+	if err := bstore.DeleteBlock(key.Key(olddir.Links[0].Hash)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Unpin(mctx, fromk, true); err == nil {
+		t.Fatal("expected the unpin to fail to fetch a block")
+	}
+	if !p.IsPinned(fromk) || len(p.IndirectKeys()) != len(before) {
+		t.Fatal("expected the failed unpin to leave the pins as they were")
+	}
+}
+
+func TestPinLabels(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dserv := mdag.NewDAGService(bserv)
+
+	p := NewPinner(dstore, dserv)
+
+	a, ak := randNode()
+	b, bk := randNode()
+	for _, nd := range []*mdag.Node{a, b} {
+		if _, err := dserv.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.SetLabel(ak, Label{Name: "a"}); err == nil {
+		t.Fatal("expected labelling an unpinned key to fail")
+	}
+
+	if err := p.Pin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pin(ctx, b, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetLabel(ak, Label{Name: "a", Meta: map[string]string{"owner": "me"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetLabel(bk, Label{Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	np, err := LoadPinner(dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := np.Labels()
+	if len(labels) != 2 || labels[ak].Name != "a" || labels[ak].Meta["owner"] != "me" || labels[bk].Name != "b" {
+		t.Fatalf("labels were not kept: %v", labels)
+	}
+
+	// unpinning drops the label
+	if err := np.Unpin(ctx, bk, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := np.Labels()[bk]; ok {
+		t.Fatal("expected the label of an unpinned key to be dropped")
+	}
+}
+
+func TestPinBestEffort(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dserv := mdag.NewDAGService(bserv)
+
+	p := NewPinner(dstore, dserv)
+
+	a, ak := randNode()
+	_, bk := randNode()
+	if _, err := dserv.Add(a); err != nil {
+		t.Fatal(err)
+	}
+
+	mp := p.GetManual()
+	mp.PinWithMode(ak, BestEffort)
+	time.Sleep(time.Millisecond)
+	mp.PinWithMode(bk, BestEffort)
+	if p.IsPinned(ak) {
+		t.Fatal("expected a best-effort pin not to be a pin garbage collection can't evict")
+	}
+	if keys := p.BestEffortKeys(); len(keys) != 2 || keys[0] != ak || keys[1] != bk {
+		t.Fatalf("expected the least recently used pin first, got %v", keys)
+	}
+
+	// using a lets b go first
+	time.Sleep(time.Millisecond)
+	p.TouchBestEffort(ak)
+	if err := p.SetLabel(ak, Label{Name: "cached"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	np, err := LoadPinner(dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := np.BestEffortKeys(); len(keys) != 2 || keys[0] != bk || keys[1] != ak {
+		t.Fatalf("expected the best-effort pins to be kept in order, got %v", keys)
+	}
+
+	if err := np.Unpin(ctx, ak, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := np.Labels()[ak]; ok {
+		t.Fatal("expected the label of an unpinned key to be dropped")
+	}
+	np.GetManual().RemovePinWithMode(bk, BestEffort)
+	if keys := np.BestEffortKeys(); len(keys) != 0 {
+		t.Fatalf("expected no best-effort pins left, got %v", keys)
+	}
+	if err := np.Unpin(ctx, ak, false); err == nil {
+		t.Fatal("expected unpinning an unpinned key to fail")
+	}
+}
@@ -0,0 +1,342 @@
+package pin
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	traverse "github.com/ipfs/go-ipfs/merkledag/traverse"
+)
+
+// States of a background pin
+const (
+	StateQueued   = "queued"
+	StateFetching = "fetching"
+	StateRetrying = "retrying"
+	StatePinned   = "pinned"
+	StateFailed   = "failed"
+)
+
+// queueWorkers is how many background pins fetch at once
+const queueWorkers = 4
+
+const maxAttempts = 10
+
+// QueueOptions tune a Queue. A zero field takes the default.
+type QueueOptions struct {
+	// FetchTimeout bounds the wait for each node fetched; an attempt
+	// that takes longer fails, and is retried. One minute by default.
+	FetchTimeout time.Duration
+
+	// MinBackoff and MaxBackoff bound the wait between attempts, which
+	// doubles after each failure. One second and five minutes by default.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// KeepFinished is how long the status of a finished pin is kept, an
+	// hour by default, and MaxFinished how many of them are, at most: a
+	// thousand by default.
+	KeepFinished time.Duration
+	MaxFinished  int
+}
+
+func (o QueueOptions) withDefaults() QueueOptions {
+	if o.FetchTimeout == 0 {
+		o.FetchTimeout = time.Minute
+	}
+	if o.MinBackoff == 0 {
+		o.MinBackoff = time.Second
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = 5 * time.Minute
+	}
+	if o.KeepFinished == 0 {
+		o.KeepFinished = time.Hour
+	}
+	if o.MaxFinished == 0 {
+		o.MaxFinished = 1000
+	}
+	return o
+}
+
+// PinStatus reports how a background pin is doing.
+type PinStatus struct {
+	Key       key.Key
+	Recursive bool
+	State     string
+
+	// Fetched is the number of blocks fetched so far, and Remaining the
+	// number of blocks known to be left. Remaining grows as more of the
+	// DAG is found.
+	Fetched   int
+	Remaining int
+
+	// Attempts is the number of attempts made at fetching the DAG, and
+	// Err the error the last failed one met.
+	Attempts int
+	Err      string `json:",omitempty"`
+}
+
+// Queue pins objects in the background. It fetches each DAG block by block,
+// reporting its progress, and retrying with backoff when a fetch fails;
+// once it's all local, the object is pinned. Fetched blocks are kept
+// between attempts, so a retry picks up where the last one failed, and
+// from garbage collection until the pin is done.
+type Queue struct {
+	ctx    context.Context
+	pinner Pinner
+	dserv  mdag.DAGService
+	opts   QueueOptions
+
+	lock sync.Mutex
+	jobs map[key.Key]*job
+	work chan struct{}
+}
+
+// job is a background pin.
+type job struct {
+	st *PinStatus
+	// fetched holds the blocks fetched so far, and those being fetched,
+	// until the pin is done.
+	fetched map[key.Key]struct{}
+	// finished is when the pin was done, or failed for good.
+	finished time.Time
+}
+
+// NewQueue returns a queue pinning into p objects fetched through dserv.
+// Background pins stop when ctx is done.
+func NewQueue(ctx context.Context, p Pinner, dserv mdag.DAGService, opts QueueOptions) *Queue {
+	return &Queue{
+		ctx:    ctx,
+		pinner: p,
+		dserv:  dserv,
+		opts:   opts.withDefaults(),
+		jobs:   make(map[key.Key]*job),
+		work:   make(chan struct{}, queueWorkers),
+	}
+}
+
+// Add queues k to be pinned, recursively or not, and returns at once. done,
+// if not nil, is called once k is pinned. Adding a key that is already
+// being pinned does nothing; one that was pinned, or failed, is pinned
+// again.
+func (q *Queue) Add(k key.Key, recursive bool, done func()) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.prune()
+	if j, ok := q.jobs[k]; ok && j.finished.IsZero() {
+		return
+	}
+	j := &job{
+		st:      &PinStatus{Key: k, Recursive: recursive, State: StateQueued},
+		fetched: make(map[key.Key]struct{}),
+	}
+	q.jobs[k] = j
+	go q.run(j, done)
+}
+
+// Status returns the status of the background pin of k.
+func (q *Queue) Status(k key.Key) (PinStatus, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.prune()
+	j, ok := q.jobs[k]
+	if !ok {
+		return PinStatus{}, false
+	}
+	return *j.st, true
+}
+
+// List returns the status of all the background pins.
+func (q *Queue) List() []PinStatus {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.prune()
+	out := make([]PinStatus, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		out = append(out, *j.st)
+	}
+	return out
+}
+
+// Protects returns whether k is a block a background pin in progress has
+// fetched, which garbage collection must keep.
+func (q *Queue) Protects(k key.Key) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, j := range q.jobs {
+		if _, ok := j.fetched[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// prune forgets the finished pins that were done longer than KeepFinished
+// ago, and then the oldest of them, down to MaxFinished. q.lock must be
+// held.
+func (q *Queue) prune() {
+	var finished []*job
+	for k, j := range q.jobs {
+		switch {
+		case j.finished.IsZero():
+		case time.Since(j.finished) > q.opts.KeepFinished:
+			delete(q.jobs, k)
+		default:
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= q.opts.MaxFinished {
+		return
+	}
+	sort.Sort(byFinished(finished))
+	for _, j := range finished[:len(finished)-q.opts.MaxFinished] {
+		delete(q.jobs, j.st.Key)
+	}
+}
+
+type byFinished []*job
+
+func (s byFinished) Len() int           { return len(s) }
+func (s byFinished) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byFinished) Less(i, j int) bool { return s[i].finished.Before(s[j].finished) }
+
+func (q *Queue) update(st *PinStatus, f func(*PinStatus)) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	f(st)
+}
+
+// finish marks j as done, for good.
+func (q *Queue) finish(j *job) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	j.fetched = nil
+	j.finished = time.Now()
+}
+
+func (q *Queue) run(j *job, done func()) {
+	st := j.st
+	backoff := q.opts.MinBackoff
+	for {
+		select {
+		case q.work <- struct{}{}:
+		case <-q.ctx.Done():
+			return
+		}
+		q.update(st, func(st *PinStatus) {
+			st.State = StateFetching
+			st.Attempts++
+			st.Fetched, st.Remaining = 0, 0
+		})
+		err := q.pin(j)
+		<-q.work
+
+		if err == nil {
+			q.update(st, func(st *PinStatus) {
+				st.State = StatePinned
+				st.Remaining = 0
+				st.Err = ""
+			})
+			q.finish(j)
+			if done != nil {
+				done()
+			}
+			return
+		}
+
+		log.Debugf("background pin of %s failed: %s", st.Key, err)
+		failed := false
+		q.update(st, func(st *PinStatus) {
+			st.Err = err.Error()
+			st.State = StateRetrying
+			if st.Attempts >= maxAttempts {
+				st.State = StateFailed
+				failed = true
+			}
+		})
+		if failed {
+			q.finish(j)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-q.ctx.Done():
+			return
+		}
+		backoff *= 2
+		if backoff > q.opts.MaxBackoff {
+			backoff = q.opts.MaxBackoff
+		}
+	}
+}
+
+// pin fetches the DAG of j's key, counting the blocks as it goes, and pins
+// it once it's local.
+func (q *Queue) pin(j *job) error {
+	st := j.st
+	ctx, cancel := context.WithTimeout(q.ctx, q.opts.FetchTimeout)
+	root, err := q.dserv.Get(ctx, st.Key)
+	cancel()
+	if err != nil {
+		return err
+	}
+	q.update(st, func(st *PinStatus) {
+		st.Fetched++
+		j.fetched[st.Key] = struct{}{}
+	})
+
+	if st.Recursive {
+		if err := q.fetch(root, j); err != nil {
+			return err
+		}
+	}
+
+	if err := q.pinner.Pin(q.ctx, root, st.Recursive); err != nil {
+		return err
+	}
+	return q.pinner.Flush()
+}
+
+// fetch fetches all the descendants of root, the children of each node
+// together.
+func (q *Queue) fetch(root *mdag.Node, j *job) error {
+	st := j.st
+	// the keys counted as remaining, which are those the traversal
+	// doesn't skip as duplicates.
+	seen := make(map[key.Key]struct{})
+	return traverse.Traverse(root, traverse.Options{
+		DAG:            q.dserv,
+		Ctx:            q.ctx,
+		Order:          traverse.BFS,
+		SkipDuplicates: true,
+		Concurrency:    -1,
+		FetchTimeout:   q.opts.FetchTimeout,
+		Func: func(ts traverse.State) error {
+			var n int
+			for _, l := range ts.Node.Links {
+				k := key.Key(l.Hash)
+				if _, ok := seen[k]; !ok {
+					seen[k] = struct{}{}
+					n++
+				}
+			}
+			q.update(st, func(st *PinStatus) {
+				// the children are being fetched, together
+				for _, l := range ts.Node.Links {
+					j.fetched[key.Key(l.Hash)] = struct{}{}
+				}
+				if ts.Depth > 0 {
+					st.Fetched++
+					st.Remaining--
+				}
+				st.Remaining += n
+			})
+			return nil
+		},
+	})
+}
@@ -0,0 +1,151 @@
+package pin
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/ipfs/go-ipfs/blocks/blockstore"
+	bs "github.com/ipfs/go-ipfs/blockservice"
+	"github.com/ipfs/go-ipfs/exchange/offline"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+)
+
+func waitState(t *testing.T, q *Queue, root *mdag.Node, state string) PinStatus {
+	k, _ := root.Key()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, ok := q.Status(k)
+		if !ok {
+			t.Fatal("pin is not in the queue")
+		}
+		if st.State == state {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected pin to be %s, it is %s (%s)", state, st.State, st.Err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var testQueueOptions = QueueOptions{
+	FetchTimeout: 100 * time.Millisecond,
+	MinBackoff:   10 * time.Millisecond,
+}
+
+func newQueueDAG(t *testing.T) (ds.ThreadSafeDatastore, mdag.DAGService) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bstore := blockstore.NewBlockstore(dstore)
+	bserv, err := bs.New(bstore, offline.Exchange(bstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dstore, mdag.NewDAGService(bserv)
+}
+
+func TestQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore, dserv := newQueueDAG(t)
+	p := NewPinner(dstore, dserv)
+	q := NewQueue(ctx, p, dserv, testQueueOptions)
+
+	root, _ := randNode()
+	var children []*mdag.Node
+	for i := 0; i < 3; i++ {
+		c, _ := randNode()
+		if err := root.AddNodeLinkClean(fmt.Sprintf("child%d", i), c); err != nil {
+			t.Fatal(err)
+		}
+		children = append(children, c)
+	}
+
+	// the last child is missing at first
+	for _, nd := range append([]*mdag.Node{root}, children[:2]...) {
+		if _, err := dserv.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rk, _ := root.Key()
+
+	done := make(chan struct{})
+	q.Add(rk, true, func() { close(done) })
+
+	st := waitState(t, q, root, StateRetrying)
+	if st.Err == "" {
+		t.Fatal("expected the failed attempt's error")
+	}
+	// what's fetched so far is kept from gc until the pin is done
+	for _, nd := range append([]*mdag.Node{root}, children[:2]...) {
+		k, _ := nd.Key()
+		if !q.Protects(k) {
+			t.Fatalf("expected fetched block %s to be protected", k)
+		}
+	}
+
+	if _, err := dserv.Add(children[2]); err != nil {
+		t.Fatal(err)
+	}
+	st = waitState(t, q, root, StatePinned)
+	if st.Fetched != 4 || st.Remaining != 0 || st.Attempts != 2 {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("done was not called")
+	}
+	if !p.IsPinned(rk) {
+		t.Fatal("expected root to be pinned")
+	}
+	ck, _ := children[2].Key()
+	if !p.IsPinned(ck) {
+		t.Fatal("expected the last child to be pinned indirectly")
+	}
+	if q.Protects(rk) {
+		t.Fatal("expected the blocks of a finished pin to be left to the pinner")
+	}
+}
+
+func TestQueuePrune(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore, dserv := newQueueDAG(t)
+	opts := testQueueOptions
+	opts.MaxFinished = 2
+	opts.KeepFinished = 200 * time.Millisecond
+	q := NewQueue(ctx, NewPinner(dstore, dserv), dserv, opts)
+
+	var roots []*mdag.Node
+	for i := 0; i < 3; i++ {
+		nd, _ := randNode()
+		if _, err := dserv.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+		k, _ := nd.Key()
+		q.Add(k, false, nil)
+		waitState(t, q, nd, StatePinned)
+		roots = append(roots, nd)
+	}
+
+	// past MaxFinished, the oldest finished pins are forgotten
+	if n := len(q.List()); n != 2 {
+		t.Fatalf("expected 2 pins kept, got %d", n)
+	}
+	k0, _ := roots[0].Key()
+	if _, ok := q.Status(k0); ok {
+		t.Fatal("expected the oldest pin to be forgotten")
+	}
+
+	// and past KeepFinished, all of them are
+	time.Sleep(opts.KeepFinished)
+	if n := len(q.List()); n != 0 {
+		t.Fatalf("expected the finished pins forgotten, got %d", n)
+	}
+}
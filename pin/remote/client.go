@@ -0,0 +1,239 @@
+// package remote implements a client of the IPFS pinning service API, by
+// which hosted pinners are asked to pin content on nodes of their own.
+//
+// See https://ipfs.github.io/pinning-services-api-spec/ for the API.
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+// Status is the state of a pin on a service.
+type Status string
+
+const (
+	Queued  Status = "queued"
+	Pinning Status = "pinning"
+	Pinned  Status = "pinned"
+	Failed  Status = "failed"
+)
+
+// AllStatuses are the statuses a pin may have, in the order it goes
+// through them.
+var AllStatuses = []Status{Queued, Pinning, Pinned, Failed}
+
+// ParseStatus returns the Status named s.
+func ParseStatus(s string) (Status, error) {
+	for _, st := range AllStatuses {
+		if string(st) == s {
+			return st, nil
+		}
+	}
+	return "", fmt.Errorf("unknown pin status %q, not one of %v", s, AllStatuses)
+}
+
+// maxErrorSize bounds how much of an error response is read.
+const maxErrorSize = 64 << 10
+
+// Pin is an object a service is asked to pin.
+type Pin struct {
+	Cid  string `json:"cid"`
+	Name string `json:"name,omitempty"`
+	// Origins are the multiaddrs of the peers which have the object, for
+	// the service to fetch it from.
+	Origins []string          `json:"origins,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// PinStatus is a pin as the service holds it, identified by RequestID.
+type PinStatus struct {
+	RequestID string    `json:"requestid"`
+	Status    Status    `json:"status"`
+	Created   time.Time `json:"created"`
+	Pin       Pin       `json:"pin"`
+	// Delegates are the multiaddrs of the peers of the service which pin
+	// the object, for the node to connect to.
+	Delegates []string          `json:"delegates"`
+	Info      map[string]string `json:"info,omitempty"`
+}
+
+// Filter selects the pins listed by Ls. Its empty fields select all pins.
+type Filter struct {
+	Cids   []string
+	Name   string
+	Status []Status
+	// Limit bounds the pins listed, 10 by default for the services.
+	Limit int
+}
+
+// Error is an error answered by a service.
+type Error struct {
+	StatusCode int
+	Reason     string
+	Details    string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("pinning service: %d %s", e.StatusCode, e.Reason)
+	if e.Details != "" {
+		msg += ": " + e.Details
+	}
+	return msg
+}
+
+// Client calls a pinning service.
+type Client struct {
+	endpoint string
+	key      string
+	http     *http.Client
+}
+
+// NewClient returns a Client of the service whose API is rooted at
+// endpoint, such as "https://pinning.example.com/api/v1", presenting key
+// as its access token.
+func NewClient(endpoint, key string) *Client {
+	return &Client{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		key:      key,
+		http:     &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Add asks the service to pin p.
+func (c *Client) Add(ctx context.Context, p Pin) (*PinStatus, error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	st := new(PinStatus)
+	if err := c.call(ctx, "POST", "/pins", body, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Get returns the status of the pin of requestID.
+func (c *Client) Get(ctx context.Context, requestID string) (*PinStatus, error) {
+	st := new(PinStatus)
+	if err := c.call(ctx, "GET", "/pins/"+url.QueryEscape(requestID), nil, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Ls returns the pins of the service f selects, the latest first.
+func (c *Client) Ls(ctx context.Context, f Filter) ([]PinStatus, error) {
+	statuses := f.Status
+	if len(statuses) == 0 {
+		// services list the pinned ones only by default
+		statuses = AllStatuses
+	}
+	var ss []string
+	for _, s := range statuses {
+		ss = append(ss, string(s))
+	}
+
+	q := url.Values{}
+	q.Set("status", strings.Join(ss, ","))
+	if len(f.Cids) > 0 {
+		q.Set("cid", strings.Join(f.Cids, ","))
+	}
+	if f.Name != "" {
+		q.Set("name", f.Name)
+	}
+	if f.Limit > 0 {
+		q.Set("limit", strconv.Itoa(f.Limit))
+	}
+
+	var out struct {
+		Count   int         `json:"count"`
+		Results []PinStatus `json:"results"`
+	}
+	if err := c.call(ctx, "GET", "/pins?"+q.Encode(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Results, nil
+}
+
+// Rm asks the service to remove the pin of requestID.
+func (c *Client) Rm(ctx context.Context, requestID string) error {
+	return c.call(ctx, "DELETE", "/pins/"+url.QueryEscape(requestID), nil, nil)
+}
+
+// call sends a request to the service, and decodes the JSON it answers
+// into out, unless out is nil.
+func (c *Client) call(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.endpoint+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.key)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		res, err := c.http.Do(req)
+		if err != nil {
+			done <- err
+			return
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode/100 != 2 {
+			done <- responseError(res)
+			return
+		}
+		if out == nil {
+			done <- nil
+			return
+		}
+		done <- json.NewDecoder(res.Body).Decode(out)
+	}()
+
+	// the request itself is bounded by the client timeout; on
+	// cancellation we simply stop waiting for it.
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// responseError returns the error of res, as answered by the service.
+func responseError(res *http.Response) error {
+	e := &Error{StatusCode: res.StatusCode, Reason: http.StatusText(res.StatusCode)}
+
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorSize))
+	if err != nil {
+		return e
+	}
+	var body struct {
+		Error struct {
+			Reason  string `json:"reason"`
+			Details string `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(b, &body); err == nil && body.Error.Reason != "" {
+		e.Reason = body.Error.Reason
+		e.Details = body.Error.Details
+	}
+	return e
+}
@@ -0,0 +1,178 @@
+package remote
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+)
+
+const testKey = "secret"
+
+// fakeService is a pinning service keeping its pins in memory, which pins
+// them at once.
+type fakeService struct {
+	mx   sync.Mutex
+	pins map[string]*PinStatus
+	next int
+}
+
+func (s *fakeService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testKey {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "bad access token")
+		return
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	id := strings.TrimPrefix(r.URL.Path, "/pins/")
+	switch {
+	case r.URL.Path == "/pins" && r.Method == "POST":
+		var p Pin
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.Cid == "" {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "no cid")
+			return
+		}
+		s.next++
+		st := &PinStatus{
+			RequestID: strconv.Itoa(s.next),
+			Status:    Pinned,
+			Created:   time.Now(),
+			Pin:       p,
+			Delegates: []string{"/ip4/1.2.3.4/tcp/4001/ipfs/QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n"},
+		}
+		s.pins[st.RequestID] = st
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(st)
+
+	case r.URL.Path == "/pins" && r.Method == "GET":
+		q := r.URL.Query()
+		var out struct {
+			Count   int         `json:"count"`
+			Results []PinStatus `json:"results"`
+		}
+		for _, st := range s.pins {
+			if q.Get("name") != "" && st.Pin.Name != q.Get("name") {
+				continue
+			}
+			if q.Get("cid") != "" && !strings.Contains(","+q.Get("cid")+",", ","+st.Pin.Cid+",") {
+				continue
+			}
+			if !strings.Contains(q.Get("status"), string(st.Status)) {
+				continue
+			}
+			out.Results = append(out.Results, *st)
+		}
+		out.Count = len(out.Results)
+		json.NewEncoder(w).Encode(out)
+
+	case s.pins[id] == nil:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "")
+
+	case r.Method == "GET":
+		json.NewEncoder(w).Encode(s.pins[id])
+
+	case r.Method == "DELETE":
+		delete(s.pins, id)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, reason, details string) {
+	w.WriteHeader(code)
+	var body struct {
+		Error struct {
+			Reason  string `json:"reason"`
+			Details string `json:"details"`
+		} `json:"error"`
+	}
+	body.Error.Reason = reason
+	body.Error.Details = details
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(&fakeService{pins: make(map[string]*PinStatus)})
+	defer s.Close()
+	c := NewClient(s.URL+"/", testKey)
+
+	st, err := c.Add(ctx, Pin{Cid: "QmA", Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != Pinned || st.Pin.Cid != "QmA" || len(st.Delegates) != 1 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if _, err := c.Add(ctx, Pin{Cid: "QmB", Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Get(ctx, st.RequestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Pin.Name != "a" {
+		t.Fatalf("got the wrong pin: %+v", got)
+	}
+
+	pins, err := c.Ls(ctx, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 2 {
+		t.Fatalf("expected 2 pins, got %d", len(pins))
+	}
+	pins, err = c.Ls(ctx, Filter{Name: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].Pin.Cid != "QmB" {
+		t.Fatalf("expected the pin named b, got %+v", pins)
+	}
+	pins, err = c.Ls(ctx, Filter{Status: []Status{Queued}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 0 {
+		t.Fatalf("expected no queued pins, got %+v", pins)
+	}
+
+	if err := c.Rm(ctx, st.RequestID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Get(ctx, st.RequestID)
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	s := httptest.NewServer(&fakeService{pins: make(map[string]*PinStatus)})
+	defer s.Close()
+
+	_, err := NewClient(s.URL, "wrong").Ls(context.Background(), Filter{})
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an Error, got %v", err)
+	}
+	if e.StatusCode != http.StatusUnauthorized || e.Reason != "UNAUTHORIZED" || e.Details != "bad access token" {
+		t.Fatalf("unexpected error %+v", e)
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	if s, err := ParseStatus("pinning"); err != nil || s != Pinning {
+		t.Fatalf("expected pinning, got %q, %v", s, err)
+	}
+	if _, err := ParseStatus("lost"); err == nil {
+		t.Fatal("expected an unknown status to fail")
+	}
+}
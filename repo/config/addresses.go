@@ -2,7 +2,7 @@ package config
 
 // Addresses stores the (string) multiaddr addresses for the node.
 type Addresses struct {
-	Swarm   []string // addresses for the swarm network
+	Swarm   []string // addresses for the swarm network, tcp or websocket (/tcp/4002/ws)
 	API     string   // address for the local API (RPC)
 	Gateway string   // address to listen on for IPFS HTTP object gateway
 }
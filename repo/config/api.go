@@ -0,0 +1,66 @@
+package config
+
+import (
+	"encoding/base64"
+)
+
+// API scopes, what a request to the HTTP API may do.
+const (
+	// APIScopeNone allows nothing.
+	APIScopeNone = "none"
+	// APIScopeRead allows the commands which only read, like cat, ls
+	// and pin ls.
+	APIScopeRead = "read"
+	// APIScopeAdmin allows every command.
+	APIScopeAdmin = "admin"
+)
+
+// API contains the access control and headers of the HTTP API.
+type API struct {
+	// Credentials grant their scope to the requests which present them.
+	// Without any, every request is allowed everything, so the API
+	// shouldn't listen beyond localhost.
+	Credentials []APICredential
+	// AnonymousScope is the scope of requests without credentials once
+	// there are Credentials: "read", the default, or "none".
+	AnonymousScope string
+
+	// HTTPHeaders are set on the responses of the API. The CORS ones,
+	// Access-Control-Allow-Origin, -Methods and -Headers, list what
+	// cross-origin requests are allowed, so that web pages can call it.
+	HTTPHeaders map[string][]string
+
+	// WebUI is the hash, or /ipfs/ path, of the webui served at /webui,
+	// instead of the one of the release, e.g. to try a build of one's own.
+	WebUI string
+}
+
+// APICredential is a bearer token, or a basic auth username and
+// password, along with the scope it grants.
+type APICredential struct {
+	Token    string `json:",omitempty"`
+	Username string `json:",omitempty"`
+	Password string `json:",omitempty"`
+	// Scope is "read" or "admin".
+	Scope string
+}
+
+// Authorization returns the value of the Authorization header which
+// presents c.
+func (c APICredential) Authorization() string {
+	if c.Token != "" {
+		return "Bearer " + c.Token
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password))
+}
+
+// AdminCredential returns the first credential of the admin scope, which
+// the ipfs command uses to call the daemon, or nil if there is none.
+func (a *API) AdminCredential() *APICredential {
+	for i := range a.Credentials {
+		if a.Credentials[i].Scope == APIScopeAdmin {
+			return &a.Credentials[i]
+		}
+	}
+	return nil
+}
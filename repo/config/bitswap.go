@@ -0,0 +1,16 @@
+package config
+
+// Bitswap configures the serving of blocks to the peers which want them,
+// and the fetching of those the node wants.
+type Bitswap struct {
+	// MaxServeRate caps the upload rate of the blocks served, per second,
+	// such as "1MB". Empty means no cap.
+	MaxServeRate string
+	// BusyServeRate is the cap while the node fetches blocks itself, for
+	// the fetches of local commands to keep most of the uplink. It
+	// defaults to MaxServeRate.
+	BusyServeRate string
+	// MaxConcurrentFetches caps how many blocks the node fetches at once,
+	// for all the commands fetching. 0 means the default of 256.
+	MaxConcurrentFetches int
+}
@@ -0,0 +1,14 @@
+package config
+
+// BlockProviders lists HTTP endpoints that blocks are fetched from when
+// no bitswap peer provides them, e.g. behind firewalls that block the
+// swarm. Responses are verified by hash, so providers need not be trusted.
+type BlockProviders struct {
+	// URLs are gateway roots (blocks are requested from
+	// <url>/ipfs/<key>?format=raw) or templates containing "%s", which
+	// is replaced by the block key.
+	URLs []string
+	// FallbackDelaySeconds is how long bitswap is given before the
+	// providers are tried. Defaults to 10 seconds.
+	FallbackDelaySeconds int
+}
@@ -51,6 +51,36 @@ func (c *Config) SetBootstrapPeers(bps []BootstrapPeer) {
 	c.Bootstrap = BootstrapPeerStrings(bps)
 }
 
+// BootstrapList returns the bootstrap list of the private network whose
+// key has the fingerprint fp, from PrivateBootstrap, where lists are keyed
+// by fingerprint in hexadecimal, as 'ipfs daemon' prints it. If fp is
+// empty, or the network has no list of its own, it returns Bootstrap.
+func (c *Config) BootstrapList(fp string) []string {
+	if fp != "" {
+		if addrs, ok := c.PrivateBootstrap[fp]; ok {
+			return addrs
+		}
+	}
+	return c.Bootstrap
+}
+
+// SetBootstrapList sets the bootstrap list of the private network whose
+// key has the fingerprint fp, or Bootstrap if fp is empty. An empty list
+// is kept, so the network isn't given the peers of Bootstrap instead.
+func (c *Config) SetBootstrapList(fp string, addrs []string) {
+	if fp == "" {
+		c.Bootstrap = addrs
+		return
+	}
+	if addrs == nil {
+		addrs = []string{}
+	}
+	if c.PrivateBootstrap == nil {
+		c.PrivateBootstrap = make(map[string][]string)
+	}
+	c.PrivateBootstrap[fp] = addrs
+}
+
 func ParseBootstrapPeer(addr string) (BootstrapPeer, error) {
 	ia, err := iaddr.ParseString(addr)
 	if err != nil {
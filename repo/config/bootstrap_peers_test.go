@@ -0,0 +1,30 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBootstrapList(t *testing.T) {
+	pub := []string{DefaultBootstrapAddresses[0]}
+	priv := []string{DefaultBootstrapAddresses[1]}
+	c := &Config{Bootstrap: pub}
+
+	if l := c.BootstrapList("f00d"); !reflect.DeepEqual(l, pub) {
+		t.Fatalf("a network without a list of its own got %v", l)
+	}
+
+	c.SetBootstrapList("f00d", priv)
+	if l := c.BootstrapList("f00d"); !reflect.DeepEqual(l, priv) {
+		t.Fatalf("expected the list of the network, got %v", l)
+	}
+	if l := c.BootstrapList(""); !reflect.DeepEqual(l, pub) {
+		t.Fatalf("expected the public list, got %v", l)
+	}
+
+	// emptying the list of a network doesn't give it the public one
+	c.SetBootstrapList("f00d", nil)
+	if l := c.BootstrapList("f00d"); len(l) != 0 {
+		t.Fatalf("expected an empty list, got %v", l)
+	}
+}
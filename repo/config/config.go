@@ -23,9 +23,24 @@ type Config struct {
 	Version          Version               // local node's version management
 	Discovery        Discovery             // local node's discovery mechanisms
 	Bootstrap        []string              // local nodes's bootstrap peer addresses
+	PrivateBootstrap map[string][]string   `json:",omitempty"` // bootstrap peer addresses of private networks
 	Tour             Tour                  // local node's tour position
 	Gateway          Gateway               // local node's gateway server options
 	SupernodeRouting SupernodeClientConfig // local node's routing servers (if SupernodeRouting enabled)
+	DelegatedRouting DelegatedRouting      // local node's routing delegate (if DelegatedRouting enabled)
+	DNSLink          DNSLink               // local node's DNSLink publishing credentials
+	Hooks            Hooks                 // local node's pinset change notifications
+	BlockProviders   BlockProviders        // local node's HTTP block fetch fallback
+	Relay            Relay                 // local node's circuit relay options
+	ConnMgr          ConnMgr               // local node's connection limits
+	Bitswap          Bitswap               // local node's block serving limits
+	Reprovider       Reprovider            // local node's provider records announcing
+	Peerstore        Peerstore             // local node's peers remembered across restarts
+	API              API                   // local node's HTTP API access control
+	Swarm            Swarm                 // local node's swarm options
+	Pinning          Pinning               // local node's remote pinning services
+	Denylist         Denylist              // local node's denied content
+	Experiments      Experiments           // local node's experimental features
 	DialBlocklist    []string
 	Log              Log
 }
@@ -98,6 +113,15 @@ func FromMap(v map[string]interface{}) (*Config, error) {
 	return &conf, nil
 }
 
+// Clone returns a deep copy of c, which can be changed without changing c.
+func (c *Config) Clone() (*Config, error) {
+	m, err := ToMap(c)
+	if err != nil {
+		return nil, err
+	}
+	return FromMap(m)
+}
+
 func ToMap(conf *Config) (map[string]interface{}, error) {
 	buf := new(bytes.Buffer)
 	if err := json.NewEncoder(buf).Encode(conf); err != nil {
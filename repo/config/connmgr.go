@@ -0,0 +1,14 @@
+package config
+
+// ConnMgr configures the connection manager, which closes the connections
+// of the least useful peers once there are more than HighWater of them,
+// until there are LowWater left. A HighWater of 0 disables it.
+type ConnMgr struct {
+	LowWater  int
+	HighWater int
+	// GracePeriod is how long new connections are kept for at least, such
+	// as "20s".
+	GracePeriod string
+	// Protected lists the peer IDs whose connections are never closed.
+	Protected []string `json:",omitempty"`
+}
@@ -5,8 +5,66 @@ const DefaultDataStoreDirectory = "datastore"
 
 // Datastore tracks the configuration of the datastore.
 type Datastore struct {
-	Type string
-	Path string
+	// Type is the backend the repo keeps everything but blocks in, and
+	// BlocksType the one it keeps blocks in. They default to "leveldb"
+	// and "flatfs".
+	Type       string
+	BlocksType string
+	Path       string
+
+	// S3 configures the mounts of type "s3", by the name of their
+	// directory in the repo: "blocks" or "datastore".
+	S3 map[string]S3Datastore `json:",omitempty"`
+
+	// StorageMax is the disk space the repo may take, such as "10GB". When
+	// it's set, the daemon collects garbage once the repo grows past
+	// StorageGCHighWater percent of it, until it's back under
+	// StorageGCLowWater percent.
+	StorageMax string
+	// StorageGCHighWater defaults to 90, StorageGCLowWater to 70.
+	StorageGCHighWater int
+	StorageGCLowWater  int
+	// GCPeriodSeconds is how often the daemon checks the repo size.
+	// Defaults to an hour.
+	GCPeriodSeconds int
+
+	// HasARCCacheSize is how many blocks the node remembers having, or
+	// not, in memory; HasBloomFilterSize is the size in bytes of a bloom
+	// filter of the blocks it has, which answers most lookups of blocks it
+	// doesn't. They default to 65536 and 524288; -1 disables them.
+	HasARCCacheSize    int
+	HasBloomFilterSize int
+
+	// PathCacheSize is how many of the paths resolved lately the node
+	// remembers the objects of, for the gateway not to walk the links
+	// of those requested often again. It defaults to 4096; -1 disables
+	// it.
+	PathCacheSize int
+}
+
+// S3Datastore configures a datastore kept in an S3 bucket. Nodes whose
+// "blocks" mounts share a bucket and prefix share their blocks; as garbage
+// collecting one of them removes the blocks only the others pin, such
+// nodes should keep their pins in sync, or not collect garbage.
+type S3Datastore struct {
+	Bucket string
+	// Prefix is prepended to the names of the objects of the datastore,
+	// such as "ipfs/blocks".
+	Prefix string
+
+	// Region is the AWS region of the bucket, such as "us-east-1", the
+	// default. Endpoint, such as "http://localhost:9000", is used instead
+	// for other services speaking the S3 protocol.
+	Region   string
+	Endpoint string
+
+	// AccessKey and SecretKey default to the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY environment variables, then to the instance's
+	// role, then to ~/.aws/credentials. Either may be "env:NAME" or
+	// "file:PATH" to read it from elsewhere, as ResolveSecret does; written
+	// out, they are left out of 'ipfs config show' and of backups.
+	AccessKey string `json:",omitempty"`
+	SecretKey string `json:",omitempty"`
 }
 
 // DataStorePath returns the default data store path given a configuration root
@@ -0,0 +1,10 @@
+package config
+
+// DelegatedRouting configures the node whose HTTP API runs the routing
+// queries of a daemon started with --routing=delegated. Such a daemon does
+// not announce its content: the delegate can't provide for it.
+type DelegatedRouting struct {
+	// API is the address of the API of the delegate, such as
+	// "/ip4/10.0.0.1/tcp/5001".
+	API string
+}
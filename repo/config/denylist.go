@@ -0,0 +1,14 @@
+package config
+
+// Denylist configures the content the node refuses to serve, on its
+// gateway and, if Bitswap is set, to other peers.
+type Denylist struct {
+	// Entries are hashes, like "Qm...", or path prefixes, like
+	// "/ipns/example.com/private", denying the paths under them.
+	Entries []string `json:",omitempty"`
+	// File is the path of a file of more entries, one per line, lines
+	// starting with "#" being comments. It is read when the node starts.
+	File string `json:",omitempty"`
+	// Bitswap denies the hashes listed to other peers too.
+	Bitswap bool
+}
@@ -0,0 +1,20 @@
+package config
+
+// DNSLink contains the options used by 'ipfs dns publish' to update
+// DNSLink TXT records through an RFC 2136 dynamic update server.
+type DNSLink struct {
+	// Server is the host:port of the authoritative server accepting
+	// dynamic updates.
+	Server string
+	// Zone is the zone the records live in, e.g. "example.com."
+	Zone string
+	// TTL of the published TXT record, in seconds.
+	TTL uint32
+
+	// TSIG credentials. Leave TsigName empty to send unsigned updates.
+	TsigName string
+	// TsigSecretFile is the path of a file holding the base64 secret,
+	// which must not be readable by others than its owner (mode 0600).
+	TsigSecretFile string
+	TsigAlgorithm  string // defaults to hmac-sha256
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Experiments enables the features which ship disabled, as they, or the
+// data they write, may still change.
+type Experiments struct {
+	// Sharding lets 'ipfs add --enable-sharding' shard large directories.
+	Sharding bool
+	// Filestore lets 'ipfs add --nocopy' keep the data of files outside
+	// the repo, and 'ipfs filestore' manage it.
+	Filestore bool
+	// Relay has the node take and, with Relay.Hop, relay circuits to the
+	// peers behind NATs. It is read when the node starts.
+	Relay bool
+	// Pubsub has the daemon run pubsub, as --enable-pubsub-experiment
+	// does. It is read when the node starts.
+	Pubsub bool
+	// Utp has the swarm listen and dial on utp addresses, after tcp ones.
+	// It is read when the node starts.
+	Utp bool
+}
+
+// Experiment is a feature the key Experiments.<Name> of the config
+// enables.
+type Experiment struct {
+	Name        string
+	Description string
+	flag        func(*Experiments) *bool
+}
+
+// ExperimentList lists the experiments, by name.
+var ExperimentList = []*Experiment{
+	{
+		Name:        "Filestore",
+		Description: "add files by reference, with 'ipfs add --nocopy'",
+		flag:        func(e *Experiments) *bool { return &e.Filestore },
+	},
+	{
+		Name:        "Pubsub",
+		Description: "send and receive messages with 'ipfs pubsub'",
+		flag:        func(e *Experiments) *bool { return &e.Pubsub },
+	},
+	{
+		Name:        "Relay",
+		Description: "connect to the peers behind NATs through circuit relays",
+		flag:        func(e *Experiments) *bool { return &e.Relay },
+	},
+	{
+		Name:        "Sharding",
+		Description: "shard large directories, with 'ipfs add --enable-sharding'",
+		flag:        func(e *Experiments) *bool { return &e.Sharding },
+	},
+	{
+		Name:        "Utp",
+		Description: "listen and dial on the utp swarm transport",
+		flag:        func(e *Experiments) *bool { return &e.Utp },
+	},
+}
+
+// FindExperiment returns the experiment of name, regardless of case.
+func FindExperiment(name string) (*Experiment, error) {
+	for _, x := range ExperimentList {
+		if strings.EqualFold(x.Name, name) {
+			return x, nil
+		}
+	}
+	return nil, fmt.Errorf("no experiment named %q", name)
+}
+
+// Key returns the config key enabling x.
+func (x *Experiment) Key() string {
+	return "Experiments." + x.Name
+}
+
+// Enabled returns whether x is enabled in e.
+func (x *Experiment) Enabled(e *Experiments) bool {
+	return *x.flag(e)
+}
+
+// Set enables or disables x in e.
+func (x *Experiment) Set(e *Experiments, enabled bool) {
+	*x.flag(e) = enabled
+}
+
+// ExperimentDisabledError is the error of the features used while their
+// experiment is disabled.
+type ExperimentDisabledError struct {
+	Experiment *Experiment
+}
+
+func (e ExperimentDisabledError) Error() string {
+	return fmt.Sprintf("the %s experiment is disabled: enable it with 'ipfs experiments enable %s', or by setting %s in the config",
+		e.Experiment.Name, e.Experiment.Name, e.Experiment.Key())
+}
+
+// Require returns an ExperimentDisabledError unless the experiment of name
+// is enabled in e.
+func (e *Experiments) Require(name string) error {
+	x, err := FindExperiment(name)
+	if err != nil {
+		return err
+	}
+	if !x.Enabled(e) {
+		return ExperimentDisabledError{x}
+	}
+	return nil
+}
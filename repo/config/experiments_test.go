@@ -0,0 +1,29 @@
+package config
+
+import "testing"
+
+func TestExperiments(t *testing.T) {
+	var e Experiments
+	if err := e.Require("Sharding"); err == nil {
+		t.Fatal("expected sharding to be disabled by default")
+	}
+
+	x, err := FindExperiment("sharding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.Set(&e, true)
+	if !e.Sharding {
+		t.Fatal("expected Set to enable Sharding")
+	}
+	if err := e.Require("Sharding"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Require("Filestore"); err == nil {
+		t.Fatal("expected filestore to stay disabled")
+	}
+
+	if _, err := FindExperiment("nope"); err == nil {
+		t.Fatal("expected an unknown experiment to fail")
+	}
+}
@@ -4,4 +4,19 @@ package config
 type Gateway struct {
 	RootRedirect string
 	Writable     bool
+
+	// NoDirListing stops the gateway listing the directories it serves
+	// which have no index.html, for private gateways.
+	NoDirListing bool
+
+	// SubdomainHosts are the hosts of the gateway, like "localhost" or
+	// "gateway.example.com", under which it serves /ipfs/<hash> at
+	// <hash>.ipfs.<host>, hash in base32, and /ipns/<id> at
+	// <id>.ipns.<host>, so that each has its own origin. Path requests
+	// to these hosts are redirected to their subdomain.
+	SubdomainHosts []string
+
+	// HTTPHeaders are set on the responses of the gateway, like
+	// Access-Control-Allow-Origin to let web pages fetch from it.
+	HTTPHeaders map[string][]string
 }
@@ -0,0 +1,13 @@
+package config
+
+// Hooks configures external programs and URLs that are notified when the
+// local pinset changes or a garbage collection completes.
+type Hooks struct {
+	// Webhooks receive each event as a JSON-encoded HTTP POST.
+	Webhooks []string
+	// Exec is a program run once per event, with the JSON-encoded event
+	// on its standard input.
+	Exec string
+	// TimeoutSeconds bounds each delivery. Defaults to 5 seconds.
+	TimeoutSeconds int
+}
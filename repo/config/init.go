@@ -52,6 +52,22 @@ func Init(out io.Writer, nBitsForKeypair int) (*Config, error) {
 			Enabled:  true,
 			Interval: 10,
 		}},
+		Relay: Relay{
+			PreferDirect: true,
+		},
+		ConnMgr: ConnMgr{
+			LowWater:    600,
+			HighWater:   900,
+			GracePeriod: "20s",
+		},
+		Reprovider: Reprovider{
+			Interval: "12h",
+			Strategy: "all",
+		},
+		Peerstore: Peerstore{
+			TTL:      "24h",
+			MaxPeers: 100,
+		},
 		Log: Log{
 			MaxSizeMB:  250,
 			MaxBackups: 1,
@@ -70,6 +86,11 @@ func Init(out io.Writer, nBitsForKeypair int) (*Config, error) {
 		Gateway: Gateway{
 			RootRedirect: "",
 			Writable:     false,
+			HTTPHeaders: map[string][]string{
+				"Access-Control-Allow-Origin":  []string{"*"},
+				"Access-Control-Allow-Methods": []string{"GET"},
+				"Access-Control-Allow-Headers": []string{"X-Requested-With"},
+			},
 		},
 	}
 
@@ -82,8 +103,9 @@ func datastoreConfig() (*Datastore, error) {
 		return nil, err
 	}
 	return &Datastore{
-		Path: dspath,
-		Type: "leveldb",
+		Path:       dspath,
+		Type:       "leveldb",
+		BlocksType: "flatfs",
 	}, nil
 }
 
@@ -0,0 +1,12 @@
+package config
+
+// Peerstore configures the peers the node remembers in the repo across
+// restarts, which it dials along with the bootstrap peers when it starts.
+type Peerstore struct {
+	// TTL is how long a peer is remembered after the node was last
+	// connected to it, such as "24h"; "0" remembers none.
+	TTL string
+	// MaxPeers caps the peers remembered, keeping the ones most recently
+	// connected to.
+	MaxPeers int
+}
@@ -0,0 +1,18 @@
+package config
+
+// Pinning configures the remote pinning services, which 'ipfs pin remote'
+// asks to pin objects on nodes of their own, by the names given to them.
+type Pinning struct {
+	RemoteServices map[string]RemotePinningService `json:",omitempty"`
+}
+
+// RemotePinningService is a service of the IPFS pinning service API.
+type RemotePinningService struct {
+	// Endpoint is the root of its API, such as
+	// "https://pinning.example.com/api/v1".
+	Endpoint string
+	// Key is the access token presented to it, or "env:NAME" or
+	// "file:PATH" to read it from elsewhere, as ResolveSecret does;
+	// written out, it is left out of 'ipfs config show' and of backups.
+	Key string
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Profile changes a config for a kind of node.
+type Profile func(*Config)
+
+// Profiles are the profiles which can be applied at init, by name.
+var Profiles = map[string]Profile{
+	// server is for nodes of a datacenter, which have no business with
+	// the hosts around them: it turns local discovery and NAT port mapping
+	// off, and filters out the private networks.
+	"server": func(c *Config) {
+		c.Discovery.MDNS.Enabled = false
+		c.Swarm.DisableNatPortMap = true
+		for _, f := range privateNetworks {
+			if !hasString(c.DialBlocklist, f) {
+				c.DialBlocklist = append(c.DialBlocklist, f)
+			}
+		}
+	},
+
+	// test is for nodes started by tests: they listen on loopback only,
+	// know no peers to begin with, and repeat their periodic work often.
+	"test": func(c *Config) {
+		c.Addresses.API = "/ip4/127.0.0.1/tcp/5001"
+		c.Addresses.Gateway = "/ip4/127.0.0.1/tcp/8080"
+		c.Addresses.Swarm = []string{"/ip4/127.0.0.1/tcp/0"}
+		c.Bootstrap = []string{}
+		c.Discovery.MDNS.Enabled = false
+		c.Reprovider.Interval = "1m"
+	},
+
+	// lowpower is for devices short of bandwidth, memory or battery: it
+	// keeps few connections, and does its periodic work rarely.
+	"lowpower": func(c *Config) {
+		c.ConnMgr = ConnMgr{
+			LowWater:    20,
+			HighWater:   40,
+			GracePeriod: "1m",
+		}
+		c.Discovery.MDNS.Interval = 60
+		c.Reprovider.Interval = "24h"
+	},
+}
+
+// privateNetworks are the address filters of the networks which aren't
+// routed on the internet.
+var privateNetworks = []string{
+	"/ip4/10.0.0.0/ipcidr/8",
+	"/ip4/100.64.0.0/ipcidr/10",
+	"/ip4/169.254.0.0/ipcidr/16",
+	"/ip4/172.16.0.0/ipcidr/12",
+	"/ip4/192.0.0.0/ipcidr/24",
+	"/ip4/192.168.0.0/ipcidr/16",
+	"/ip4/198.18.0.0/ipcidr/15",
+}
+
+// ApplyProfile applies the named profile to c.
+func ApplyProfile(c *Config, name string) error {
+	p, ok := Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown config profile %q, not one of %v", name, ProfileNames())
+	}
+	p(c)
+	return nil
+}
+
+// ProfileNames returns the names of the profiles, sorted.
+func ProfileNames() []string {
+	names := make([]string, 0, len(Profiles))
+	for name := range Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hasString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
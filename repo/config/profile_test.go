@@ -0,0 +1,32 @@
+package config
+
+import "testing"
+
+func TestApplyProfile(t *testing.T) {
+	c := &Config{DialBlocklist: []string{"/ip4/10.0.0.0/ipcidr/8"}}
+	c.Discovery.MDNS.Enabled = true
+
+	if err := ApplyProfile(c, "server"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Discovery.MDNS.Enabled {
+		t.Error("server profile left local discovery on")
+	}
+	if !c.Swarm.DisableNatPortMap {
+		t.Error("server profile left NAT port mapping on")
+	}
+	if len(c.DialBlocklist) != len(privateNetworks) {
+		t.Errorf("expected the private networks filtered once each, got %v", c.DialBlocklist)
+	}
+
+	if err := ApplyProfile(c, "lowpower"); err != nil {
+		t.Fatal(err)
+	}
+	if c.ConnMgr.HighWater == 0 {
+		t.Error("lowpower profile didn't limit connections")
+	}
+
+	if err := ApplyProfile(c, "nope"); err == nil {
+		t.Error("expected an unknown profile to fail")
+	}
+}
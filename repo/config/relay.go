@@ -0,0 +1,20 @@
+package config
+
+// Relay configures circuit relay, which connects peers that can't dial
+// each other, e.g. behind NATs, through a third peer. It is used once
+// Experiments.Relay is set.
+type Relay struct {
+	// Hop has the node relay circuits between other peers.
+	Hop bool
+	// PreferDirect has the circuits to peers closed once connected to them
+	// directly, which the node tries after each circuit opens.
+	PreferDirect bool
+
+	// MaxCircuits bounds the circuits relayed at once, and
+	// MaxCircuitsPerPeer those any one peer opens, 0 for the defaults.
+	MaxCircuits        int
+	MaxCircuitsPerPeer int
+	// BandwidthLimit bounds the bytes per second relayed, over all the
+	// circuits, 0 for no bound.
+	BandwidthLimit int64
+}
@@ -0,0 +1,12 @@
+package config
+
+// Reprovider configures the periodic announcing of the blocks the node
+// provides to the routing system.
+type Reprovider struct {
+	// Interval is the time between runs, such as "12h"; "0" disables them.
+	Interval string
+	// Strategy is which blocks are provided: "all" of them, the "pinned"
+	// ones, or only the "roots" of the pins, which peers fetching their
+	// DAGs find the rest of the blocks from.
+	Strategy string
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The prefixes of the secrets of the config which aren't in it: the rest
+// of the value names the environment variable or file holding them.
+const (
+	SecretEnvPrefix  = "env:"
+	SecretFilePrefix = "file:"
+)
+
+// secretKeys are the keys of the secrets of the config, "*" standing for
+// any name.
+var secretKeys = [][]string{
+	{"Datastore", "S3", "*", "AccessKey"},
+	{"Datastore", "S3", "*", "SecretKey"},
+	{"Pinning", "RemoteServices", "*", "Key"},
+}
+
+// ReadSecretFile returns the contents of the file at path, trimmed of
+// surrounding whitespace. It refuses files that users other than their
+// owner may read or write, that is files with a mode looser than 0600.
+func ReadSecretFile(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("%s has mode %04o, secrets need 0600 or stricter", path, fi.Mode().Perm())
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// IsSecretRef returns whether v refers to a secret kept out of the config,
+// as "env:NAME" or "file:PATH".
+func IsSecretRef(v string) bool {
+	return strings.HasPrefix(v, SecretEnvPrefix) || strings.HasPrefix(v, SecretFilePrefix)
+}
+
+// ResolveSecret returns the secret v of the config refers to: the value of
+// the environment variable NAME for "env:NAME", the contents of the file
+// at PATH for "file:PATH", which ReadSecretFile must accept, or else v
+// itself.
+func ResolveSecret(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, SecretEnvPrefix):
+		name := strings.TrimPrefix(v, SecretEnvPrefix)
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return s, nil
+	case strings.HasPrefix(v, SecretFilePrefix):
+		return ReadSecretFile(strings.TrimPrefix(v, SecretFilePrefix))
+	default:
+		return v, nil
+	}
+}
+
+// RemoveSecrets removes the secrets written in the config map m, that of
+// ToMap, leaving those referred to with "env:" or "file:".
+func RemoveSecrets(m map[string]interface{}) {
+	for _, k := range secretKeys {
+		removeSecret(m, k)
+	}
+}
+
+func removeSecret(m map[string]interface{}, key []string) {
+	if len(key) == 1 {
+		if v, ok := m[key[0]].(string); ok && !IsSecretRef(v) {
+			delete(m, key[0])
+		}
+		return
+	}
+	for name, v := range m {
+		if key[0] != "*" && key[0] != name {
+			continue
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			removeSecret(sub, key[1:])
+		}
+	}
+}
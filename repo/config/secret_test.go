@@ -0,0 +1,104 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadSecretFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(path, []byte("c2VjcmV0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := ReadSecretFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != "c2VjcmV0" {
+		t.Fatalf("expected the secret without its newline, got %q", secret)
+	}
+
+	for _, mode := range []os.FileMode{0640, 0604, 0660} {
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadSecretFile(path); err == nil {
+			t.Fatalf("expected a file of mode %04o to be refused", mode)
+		}
+	}
+	if _, err := ReadSecretFile(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected a missing file to fail")
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(path, []byte("from the file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("IPFS_TEST_SECRET", "from the env")
+	defer os.Unsetenv("IPFS_TEST_SECRET")
+
+	for v, expected := range map[string]string{
+		"written":               "written",
+		"env:IPFS_TEST_SECRET":  "from the env",
+		SecretFilePrefix + path: "from the file",
+	} {
+		s, err := ResolveSecret(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != expected {
+			t.Fatalf("%s: expected %q, got %q", v, expected, s)
+		}
+	}
+	if _, err := ResolveSecret("env:IPFS_TEST_UNSET"); err == nil {
+		t.Fatal("expected an unset variable to fail")
+	}
+}
+
+func TestRemoveSecrets(t *testing.T) {
+	cfg := &Config{
+		Datastore: Datastore{S3: map[string]S3Datastore{
+			"blocks": {Bucket: "ipfs", AccessKey: "AKID", SecretKey: "env:AWS_SECRET"},
+		}},
+		Pinning: Pinning{RemoteServices: map[string]RemotePinningService{
+			"pinner": {Endpoint: "https://pinning.example.com", Key: "token"},
+			"other":  {Endpoint: "https://other.example.com", Key: "file:/etc/ipfs/other.key"},
+		}},
+	}
+	m, err := ToMap(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RemoveSecrets(m)
+	out, err := FromMap(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s3 := out.Datastore.S3["blocks"]
+	if s3.AccessKey != "" || s3.SecretKey != "env:AWS_SECRET" || s3.Bucket != "ipfs" {
+		t.Fatalf("expected the access key only removed, got %+v", s3)
+	}
+	services := out.Pinning.RemoteServices
+	if services["pinner"].Key != "" || services["pinner"].Endpoint == "" {
+		t.Fatalf("expected the key of pinner removed, got %+v", services["pinner"])
+	}
+	if services["other"].Key != "file:/etc/ipfs/other.key" {
+		t.Fatalf("expected the reference to the key of other kept, got %+v", services["other"])
+	}
+}
@@ -0,0 +1,9 @@
+package config
+
+// Swarm configures the swarm, which opens and maintains the connections
+// to other peers.
+type Swarm struct {
+	// DisableNatPortMap stops the node from mapping its listen ports on the
+	// NAT it is behind, with UPnP or NAT-PMP, for peers to dial it there.
+	DisableNatPortMap bool
+}
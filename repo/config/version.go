@@ -10,6 +10,15 @@ import (
 // CurrentVersionNumber is the current application's version literal
 const CurrentVersionNumber = "0.3.5"
 
+// CurrentCommit is the git commit the binary was built from. It is set at
+// build time with: -ldflags "-X github.com/ipfs/go-ipfs/repo/config.CurrentCommit=<hash>"
+var CurrentCommit string
+
+// DefaultDistPubKey is the key releases are checked against when
+// Version.DistPubKey is not set. Builds of the official distribution set
+// it with: -ldflags "-X github.com/ipfs/go-ipfs/repo/config.DefaultDistPubKey=<key>"
+var DefaultDistPubKey string
+
 // Version regulates checking if the most recent version is run
 type Version struct {
 	// Current is the ipfs version for which config was generated
@@ -30,6 +39,15 @@ type Version struct {
 
 	// AutoUpdate is optional
 	AutoUpdate AutoUpdateSetting
+
+	// DistPath is the ipfs path of the distribution 'ipfs version --check'
+	// looks for new releases in, and DistPubKey the key its releases are
+	// signed with, base64 encoded like Identity.PrivKey. It defaults to
+	// DefaultDistPubKey. Without a key, checking fails unless
+	// AllowUnverified is set, and then releases aren't verified.
+	DistPath        string
+	DistPubKey      string
+	AllowUnverified bool
 }
 
 // supported Version.Check values
@@ -120,6 +138,9 @@ func (v *Version) ShouldCheckForUpdate() bool {
 	return true
 }
 
+// DefaultDistPath is where releases of go-ipfs are published.
+const DefaultDistPath = "/ipns/dist.ipfs.io/go-ipfs"
+
 // VersionDefaultValue returns the default version config value (for init).
 func VersionDefaultValue() Version {
 	return Version{
@@ -127,5 +148,6 @@ func VersionDefaultValue() Version {
 		Check:       "error",
 		CheckPeriod: strconv.Itoa(int(defaultCheckPeriod)),
 		AutoUpdate:  AutoUpdateMinor,
+		DistPath:    DefaultDistPath,
 	}
 }
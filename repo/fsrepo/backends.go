@@ -0,0 +1,185 @@
+package fsrepo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	aws "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/crowdmob/goamz/aws"
+	s3 "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/crowdmob/goamz/s3"
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	levelds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/leveldb"
+	dssync "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/sync"
+	ldbopts "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/syndtr/goleveldb/leveldb/opt"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	s3ds "github.com/ipfs/go-ipfs/thirdparty/s3-datastore"
+)
+
+// The repo keeps its blocks in one datastore, and everything else in
+// another. Datastore.BlocksType and Datastore.Type in the config pick the
+// backend of each, among those registered.
+const (
+	defaultBlocksBackend = "flatfs"
+	defaultBackend       = "leveldb"
+)
+
+// Backend opens datastores of one kind. Each datastore of the repo is
+// kept in a directory of its own, which the backend may use as it likes.
+type Backend interface {
+	// Open opens, or creates, the datastore kept in dir, as conf, the
+	// datastore config of the repo, says. If the datastore needs to be
+	// closed, it must implement io.Closer.
+	Open(dir string, conf *config.Datastore) (ds.ThreadSafeDatastore, error)
+}
+
+// BackendFunc adapts a function to the Backend interface.
+type BackendFunc func(dir string, conf *config.Datastore) (ds.ThreadSafeDatastore, error)
+
+func (f BackendFunc) Open(dir string, conf *config.Datastore) (ds.ThreadSafeDatastore, error) {
+	return f(dir, conf)
+}
+
+var backends = map[string]Backend{
+	"flatfs": BackendFunc(openFlatfs),
+	"leveldb": BackendFunc(func(dir string, _ *config.Datastore) (ds.ThreadSafeDatastore, error) {
+		return levelds.NewDatastore(dir, &levelds.Options{
+			Compression: ldbopts.NoCompression,
+		})
+	}),
+	"mem": BackendFunc(func(string, *config.Datastore) (ds.ThreadSafeDatastore, error) {
+		return dssync.MutexWrap(ds.NewMapDatastore()), nil
+	}),
+	"s3": BackendFunc(openS3),
+}
+
+// RegisterBackend makes a datastore backend available to repos under name.
+// It's meant to be called from the init function of the package providing
+// the backend.
+func RegisterBackend(name string, b Backend) {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+	backends[name] = b
+}
+
+// Backends returns the names of the registered backends, sorted.
+func Backends() []string {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// backend returns the backend called name, or def if name is empty. The
+// caller must hold packageLock.
+func backend(name, def string) (Backend, error) {
+	if name == "" {
+		name = def
+	}
+	b, ok := backends[name]
+	if !ok && name == "badger" {
+		return nil, errors.New("the badger backend is not built into this version of ipfs: programs embedding ipfs may register one with fsrepo.RegisterBackend")
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown datastore backend %q", name)
+	}
+	return b, nil
+}
+
+func openFlatfs(dir string, _ *config.Datastore) (ds.ThreadSafeDatastore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if _, err := recoverFlatfs(dir); err != nil {
+		return nil, fmt.Errorf("unable to recover flatfs datastore: %s", err)
+	}
+
+	// 4TB of 256kB objects ~=17M objects, splitting that 256-way
+	// leads to ~66k objects per dir, splitting 256*256-way leads to
+	// only 256.
+	//
+	// The keys seen by the block store have predictable prefixes,
+	// including "/" from datastore.Key and 2 bytes from multihash. To
+	// reach a uniform 256-way split, we need approximately 4 bytes of
+	// prefix.
+	return newStreamingFlatfs(dir, 4)
+}
+
+// openS3 opens the datastore configured in the S3 section of conf under
+// the name of the mount dir is for: its base name, up to any extension.
+func openS3(dir string, conf *config.Datastore) (ds.ThreadSafeDatastore, error) {
+	mount := strings.SplitN(filepath.Base(dir), ".", 2)[0]
+	c, ok := conf.S3[mount]
+	if !ok {
+		return nil, fmt.Errorf("no Datastore.S3.%s in the config", mount)
+	}
+	if c.Bucket == "" {
+		return nil, fmt.Errorf("no bucket in Datastore.S3.%s", mount)
+	}
+
+	region := aws.USEast
+	if c.Region != "" {
+		region, ok = aws.Regions[c.Region]
+		if !ok {
+			return nil, fmt.Errorf("unknown AWS region %q", c.Region)
+		}
+	}
+	if c.Endpoint != "" {
+		region = aws.Region{Name: c.Region, S3Endpoint: c.Endpoint}
+		if region.Name == "" {
+			region.Name = aws.USEast.Name
+		}
+	}
+
+	access, err := config.ResolveSecret(c.AccessKey)
+	if err != nil {
+		return nil, fmt.Errorf("Datastore.S3.%s.AccessKey: %s", mount, err)
+	}
+	secret, err := config.ResolveSecret(c.SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("Datastore.S3.%s.SecretKey: %s", mount, err)
+	}
+	auth, err := aws.GetAuth(access, secret, "", time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return &s3ds.S3Datastore{
+		Client: s3.New(auth, region),
+		Bucket: c.Bucket,
+		Prefix: c.Prefix,
+	}, nil
+}
+
+// ApplyProfile sets up the datastores of conf for the named profile, one
+// of the registered backends: the repo's blocks are kept in that backend,
+// and everything else in leveldb, or in memory for the "mem" profile.
+func ApplyProfile(conf *config.Config, profile string) error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+	if _, err := backend(profile, ""); err != nil {
+		return err
+	}
+	if profile == "s3" {
+		return errors.New("s3 needs Datastore.S3 in the config: init with another profile, set it, then use 'ipfs repo convert --blocks=s3'")
+	}
+	conf.Datastore.BlocksType = profile
+	if profile == "mem" {
+		conf.Datastore.Type = "mem"
+	}
+	return nil
+}
+
+func closeDatastore(d ds.Datastore) error {
+	if c, ok := d.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package fsrepo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	dsq "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+	"github.com/ipfs/go-ipfs/repo/common"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	lockfile "github.com/ipfs/go-ipfs/repo/fsrepo/lock"
+	serialize "github.com/ipfs/go-ipfs/repo/fsrepo/serialize"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// ConvertBlocks moves the blocks of the repo at repoPath to the datastore
+// backend to, and records it in the config. The repo must not be open.
+//
+// The blocks are copied to a new directory, which then takes the place of
+// the old one, so the repo keeps its blocks if the conversion fails.
+func ConvertBlocks(repoPath, to string) (int, error) {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	repoPath, err := u.TildeExpansion(path.Clean(repoPath))
+	if err != nil {
+		return 0, err
+	}
+	if err := checkInitialized(repoPath); err != nil {
+		return 0, err
+	}
+	lock, err := lockfile.Lock(repoPath)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Close()
+
+	filename, err := config.Filename(repoPath)
+	if err != nil {
+		return 0, err
+	}
+	conf, err := serialize.Load(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	from := conf.Datastore.BlocksType
+	if from == "" {
+		from = defaultBlocksBackend
+	}
+	if from == to {
+		return 0, fmt.Errorf("blocks are already kept in %s", to)
+	}
+	if to == "mem" || from == "mem" {
+		return 0, errors.New("blocks kept in memory are lost when the repo is closed, and can't be converted")
+	}
+	src, err := backend(from, "")
+	if err != nil {
+		return 0, err
+	}
+	dst, err := backend(to, "")
+	if err != nil {
+		return 0, err
+	}
+
+	blocksPath := path.Join(repoPath, flatfsDirectory)
+	newPath := blocksPath + ".convert"
+	oldPath := blocksPath + ".old"
+	if err := os.RemoveAll(newPath); err != nil {
+		return 0, err
+	}
+	// backends that keep nothing on disk still leave a directory behind
+	if err := os.MkdirAll(newPath, 0755); err != nil {
+		return 0, err
+	}
+
+	// the config is changed before the swap, so that all that can fail
+	// after it is writing the config, which the swap is then undone for
+	var mapconf map[string]interface{}
+	if err := serialize.ReadConfigFile(filename, &mapconf); err != nil {
+		return 0, err
+	}
+	if err := common.MapSetKV(mapconf, "Datastore.BlocksType", to); err != nil {
+		return 0, err
+	}
+
+	n, err := copyDatastore(&conf.Datastore, src, blocksPath, dst, newPath)
+	if err != nil {
+		os.RemoveAll(newPath)
+		return 0, err
+	}
+
+	if err := os.Rename(blocksPath, oldPath); err != nil {
+		os.RemoveAll(newPath)
+		return 0, err
+	}
+	if err := os.Rename(newPath, blocksPath); err != nil {
+		os.Rename(oldPath, blocksPath)
+		os.RemoveAll(newPath)
+		return 0, err
+	}
+	if err := writeConfigFile(filename, mapconf); err != nil {
+		if rerr := undoSwap(blocksPath, newPath, oldPath); rerr != nil {
+			return 0, fmt.Errorf("%s, and the blocks could not be put back: %s (they are in %s)", err, rerr, oldPath)
+		}
+		return 0, err
+	}
+
+	return n, os.RemoveAll(oldPath)
+}
+
+// writeConfigFile writes the config of a converted repo. It's a variable
+// for tests to have it fail.
+var writeConfigFile = serialize.WriteConfigFile
+
+// undoSwap puts the old blocks directory back in place of the converted
+// one, which is removed.
+func undoSwap(blocksPath, newPath, oldPath string) error {
+	if err := os.Rename(blocksPath, newPath); err != nil {
+		return err
+	}
+	if err := os.Rename(oldPath, blocksPath); err != nil {
+		return err
+	}
+	return os.RemoveAll(newPath)
+}
+
+// copyDatastore copies everything in the src datastore kept in srcDir to
+// the dst one kept in dstDir, and returns the number of entries copied.
+func copyDatastore(conf *config.Datastore, src Backend, srcDir string, dst Backend, dstDir string) (int, error) {
+	from, err := src.Open(srcDir, conf)
+	if err != nil {
+		return 0, err
+	}
+	defer closeDatastore(from)
+	to, err := dst.Open(dstDir, conf)
+	if err != nil {
+		return 0, err
+	}
+	defer closeDatastore(to)
+
+	res, err := from.Query(dsq.Query{KeysOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+
+	n := 0
+	for e := range res.Next() {
+		if e.Error != nil {
+			return 0, e.Error
+		}
+		k := ds.NewKey(e.Key)
+		v, err := from.Get(k)
+		if err != nil {
+			return 0, err
+		}
+		if err := to.Put(k, v); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
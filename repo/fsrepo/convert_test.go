@@ -0,0 +1,165 @@
+package fsrepo
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/crowdmob/goamz/aws"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/crowdmob/goamz/s3"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/crowdmob/goamz/s3/s3test"
+	datastore "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	"github.com/ipfs/go-ipfs/repo/config"
+	serialize "github.com/ipfs/go-ipfs/repo/fsrepo/serialize"
+	"github.com/ipfs/go-ipfs/thirdparty/assert"
+)
+
+func TestConvertBlocks(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("convert", t)
+	assert.Nil(Init(path, &config.Config{}), t, "should initialize successfully")
+
+	r, err := Open(path)
+	assert.Nil(err, t, "should open successfully")
+	var keys []datastore.Key
+	for i := 0; i < 10; i++ {
+		k := datastore.NewKey(fmt.Sprintf("/blocks/CIQBLOCK%02d", i))
+		keys = append(keys, k)
+		assert.Nil(r.Datastore().Put(k, []byte(k.String())), t, "Put should be successful")
+	}
+	assert.Nil(r.Close(), t)
+
+	n, err := ConvertBlocks(path, "leveldb")
+	assert.Nil(err, t, "should convert to leveldb")
+	if n != len(keys) {
+		t.Fatalf("converted %d blocks, expected %d", n, len(keys))
+	}
+	_, err = ConvertBlocks(path, "leveldb")
+	assert.Err(err, t, "converting to the same backend should fail")
+	_, err = ConvertBlocks(path, "mem")
+	assert.Err(err, t, "converting to memory should fail")
+
+	r, err = Open(path)
+	assert.Nil(err, t, "should open after converting")
+	defer r.Close()
+	if conf := r.Config(); conf.Datastore.BlocksType != "leveldb" {
+		t.Fatalf("blocks type is %q, expected leveldb", r.Config().Datastore.BlocksType)
+	}
+	for _, k := range keys {
+		v, err := r.Datastore().Get(k)
+		assert.Nil(err, t, "blocks should survive conversion")
+		if string(v.([]byte)) != k.String() {
+			t.Fatalf("%s changed in conversion", k)
+		}
+	}
+}
+
+func TestConvertBlocksConfigFails(t *testing.T) {
+	path := testRepoPath("convertfail", t)
+	assert.Nil(Init(path, &config.Config{}), t, "should initialize successfully")
+
+	r, err := Open(path)
+	assert.Nil(err, t, "should open successfully")
+	k := datastore.NewKey("/blocks/CIQKEPT")
+	assert.Nil(r.Datastore().Put(k, []byte("data")), t, "Put should be successful")
+	assert.Nil(r.Close(), t)
+
+	writeConfigFile = func(string, interface{}) error { return errors.New("disk full") }
+	_, err = ConvertBlocks(path, "leveldb")
+	writeConfigFile = serialize.WriteConfigFile
+	assert.Err(err, t, "should fail to write the config")
+
+	r, err = Open(path)
+	assert.Nil(err, t, "should open after the failed conversion")
+	defer r.Close()
+	if bt := r.Config().Datastore.BlocksType; bt != "" && bt != "flatfs" {
+		t.Fatalf("blocks type is %q after the failed conversion", bt)
+	}
+	v, err := r.Datastore().Get(k)
+	assert.Nil(err, t, "blocks should be where the config says")
+	if string(v.([]byte)) != "data" {
+		t.Fatalf("got %q back", v)
+	}
+	for _, dir := range []string{"blocks.convert", "blocks.old"} {
+		if _, err := os.Stat(filepath.Join(path, dir)); !os.IsNotExist(err) {
+			t.Fatalf("%s left behind", dir)
+		}
+	}
+}
+
+func TestConvertBlocksToS3(t *testing.T) {
+	t.Parallel()
+	srv, err := s3test.NewServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Quit()
+	client := s3.New(aws.Auth{AccessKey: "key", SecretKey: "secret"}, aws.Region{
+		Name:                 "test",
+		S3Endpoint:           srv.URL(),
+		S3LocationConstraint: true,
+	})
+	assert.Nil(client.Bucket("ipfs").PutBucket(s3.Private), t)
+
+	conf := &config.Config{}
+	conf.Datastore.S3 = map[string]config.S3Datastore{
+		"blocks": {
+			Bucket:    "ipfs",
+			Prefix:    "cluster/blocks",
+			Endpoint:  srv.URL(),
+			AccessKey: "key",
+			SecretKey: "secret",
+		},
+	}
+	path := testRepoPath("s3", t)
+	assert.Nil(Init(path, conf), t, "should initialize successfully")
+
+	r, err := Open(path)
+	assert.Nil(err, t, "should open successfully")
+	k := datastore.NewKey("/blocks/CIQS3BLOCK")
+	assert.Nil(r.Datastore().Put(k, []byte("data")), t)
+	assert.Nil(r.Close(), t)
+
+	_, err = ConvertBlocks(path, "s3")
+	assert.Nil(err, t, "should convert to s3")
+	if _, err := client.Bucket("ipfs").Get("cluster/blocks/" + hex.EncodeToString([]byte("CIQS3BLOCK"))); err != nil {
+		t.Fatalf("block not in the bucket: %s", err)
+	}
+
+	r, err = Open(path)
+	assert.Nil(err, t, "should open after converting")
+	defer r.Close()
+	v, err := r.Datastore().Get(k)
+	assert.Nil(err, t, "block should be read from s3")
+	if string(v.([]byte)) != "data" {
+		t.Fatalf("got %q from s3", v)
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	t.Parallel()
+	conf := &config.Config{}
+	assert.Err(ApplyProfile(conf, "nope"), t, "unknown profile should fail")
+	assert.Err(ApplyProfile(conf, "badger"), t, "badger isn't built in")
+	assert.Nil(ApplyProfile(conf, "mem"), t)
+	if conf.Datastore.Type != "mem" || conf.Datastore.BlocksType != "mem" {
+		t.Fatalf("mem profile gave %+v", conf.Datastore)
+	}
+
+	path := testRepoPath("mem", t)
+	assert.Nil(Init(path, conf), t, "should initialize successfully")
+	r, err := Open(path)
+	assert.Nil(err, t, "should open successfully")
+	k := datastore.NewKey("/blocks/CIQMEM")
+	assert.Nil(r.Datastore().Put(k, []byte("data")), t)
+	assert.Nil(r.Close(), t)
+
+	r, err = Open(path)
+	assert.Nil(err, t, "should open again")
+	defer r.Close()
+	_, err = r.Datastore().Get(k)
+	assert.True(err == datastore.ErrNotFound, t, "mem repo should forget its blocks")
+}
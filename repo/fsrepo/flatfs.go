@@ -0,0 +1,164 @@
+package fsrepo
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/flatfs"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/goprocess"
+)
+
+// streamingFlatfs is a flatfs datastore whose queries send the keys as the
+// directories are read, rather than gathering them all first, as there may
+// be a great many of them. It also lists the keys of the prefix
+// directories past any stray file in them, where flatfs stops.
+type streamingFlatfs struct {
+	*flatfs.Datastore
+	path      string
+	prefixLen int
+}
+
+func newStreamingFlatfs(path string, prefixLen int) (*streamingFlatfs, error) {
+	fs, err := flatfs.New(path, prefixLen)
+	if err != nil {
+		return nil, err
+	}
+	return &streamingFlatfs{Datastore: fs, path: path, prefixLen: prefixLen}, nil
+}
+
+// GetSize returns the size of the value of key from the size of its file,
+// without reading it.
+func (fs *streamingFlatfs) GetSize(key ds.Key) (int, error) {
+	name := hex.EncodeToString(key.Bytes()[1:])
+	dir := (name + strings.Repeat("_", 2*fs.prefixLen))[:2*fs.prefixLen]
+	fi, err := os.Stat(filepath.Join(fs.path, dir, name+flatfsExtension))
+	if os.IsNotExist(err) {
+		return 0, ds.ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(fi.Size()), nil
+}
+
+func (fs *streamingFlatfs) Query(q query.Query) (query.Results, error) {
+	if (q.Prefix != "" && q.Prefix != "/") ||
+		len(q.Filters) > 0 ||
+		len(q.Orders) > 0 ||
+		q.Limit > 0 ||
+		q.Offset > 0 ||
+		!q.KeysOnly {
+		// the blockstore only lists all the keys
+		return nil, errors.New("flatfs only supports listing all keys in random order")
+	}
+
+	b := query.NewResultBuilder(q)
+	b.Process.Go(func(worker goprocess.Process) {
+		send := func(r query.Result) bool {
+			select {
+			case b.Output <- r:
+				return true
+			case <-worker.Closing(): // client told us to close early
+				return false
+			}
+		}
+		if err := fs.walk(func(key ds.Key) bool {
+			return send(query.Result{Entry: query.Entry{Key: key.String()}})
+		}); err != nil {
+			send(query.Result{Error: err})
+		}
+	})
+	go b.Process.CloseAfterChildren()
+	return b.Results(), nil
+}
+
+// walk calls f with the key of each block file, until f returns false.
+func (fs *streamingFlatfs) walk(f func(ds.Key) bool) error {
+	prefixes, err := readDirIfExists(fs.path)
+	if err != nil {
+		return err
+	}
+	for _, prefix := range prefixes {
+		if !prefix.IsDir() || strings.HasPrefix(prefix.Name(), ".") {
+			continue
+		}
+		more, err := fs.walkDir(prefix.Name(), f)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (fs *streamingFlatfs) walkDir(dir string, f func(ds.Key) bool) (bool, error) {
+	entries, err := readDirIfExists(filepath.Join(fs.path, dir))
+	if err != nil {
+		return false, err
+	}
+	for _, fi := range entries {
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		key, ok := decodeFlatfsName(fi.Name())
+		if !ok {
+			continue
+		}
+		if !f(key) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// decodeFlatfsName returns the key flatfs keeps in the file called name.
+func decodeFlatfsName(name string) (ds.Key, bool) {
+	if filepath.Ext(name) != flatfsExtension {
+		return ds.Key{}, false
+	}
+	k, err := hex.DecodeString(strings.TrimSuffix(name, flatfsExtension))
+	if err != nil {
+		return ds.Key{}, false
+	}
+	return ds.NewKey(string(k)), true
+}
+
+var _ ds.ThreadSafeDatastore = (*streamingFlatfs)(nil)
+
+// sizer is a datastore telling the size of a value without reading it, as
+// the blockstore looks for.
+type sizer interface {
+	GetSize(ds.Key) (int, error)
+}
+
+// blocksPrefix is where the blocks datastore is mounted.
+var blocksPrefix = ds.NewKey("/blocks")
+
+// sizingDatastore is the datastore of a repo, telling the size of the
+// blocks from the blocks datastore.
+type sizingDatastore struct {
+	ds.ThreadSafeDatastore
+	blocks sizer
+}
+
+func (d sizingDatastore) GetSize(key ds.Key) (int, error) {
+	if !blocksPrefix.IsAncestorOf(key) {
+		v, err := d.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		b, ok := v.([]byte)
+		if !ok {
+			return 0, errors.New("value is not bytes")
+		}
+		return len(b), nil
+	}
+	return d.blocks.GetSize(ds.NewKey(strings.TrimPrefix(key.String(), blocksPrefix.String())))
+}
@@ -0,0 +1,98 @@
+package fsrepo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
+	"github.com/ipfs/go-ipfs/repo/config"
+	"github.com/ipfs/go-ipfs/thirdparty/assert"
+)
+
+func TestStreamingFlatfsQuerySkipsStrayFiles(t *testing.T) {
+	t.Parallel()
+	root := testRepoPath("flatfs", t)
+	defer os.RemoveAll(root)
+
+	fs, err := newStreamingFlatfs(root, 2)
+	assert.Nil(err, t)
+	keys := []string{"/quua", "/quub", "/quuc", "/quud"}
+	for _, k := range keys {
+		assert.Nil(fs.Put(ds.NewKey(k), []byte("foobar")), t)
+	}
+	// left by interrupted puts, in the directory of the keys.
+	for _, name := range []string{"put-1", "put-2", ".hidden"} {
+		assert.Nil(ioutil.WriteFile(filepath.Join(root, "7175", name), nil, 0644), t)
+	}
+
+	res, err := fs.Query(query.Query{KeysOnly: true})
+	assert.Nil(err, t)
+	entries, err := res.Rest()
+	assert.Nil(err, t)
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Key)
+	}
+	sort.Strings(got)
+	if len(got) != len(keys) {
+		t.Fatalf("expected %v, got %v", keys, got)
+	}
+	for i := range keys {
+		if got[i] != keys[i] {
+			t.Fatalf("expected %v, got %v", keys, got)
+		}
+	}
+}
+
+func TestStreamingFlatfsQueryCloses(t *testing.T) {
+	t.Parallel()
+	root := testRepoPath("flatfs", t)
+	defer os.RemoveAll(root)
+
+	fs, err := newStreamingFlatfs(root, 2)
+	assert.Nil(err, t)
+	for _, k := range []string{"/a", "/b", "/c", "/d"} {
+		assert.Nil(fs.Put(ds.NewKey(k), []byte("foobar")), t)
+	}
+
+	res, err := fs.Query(query.Query{KeysOnly: true})
+	assert.Nil(err, t)
+	if r := <-res.Next(); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+	// closing mid-listing stops the walk
+	assert.Nil(res.Close(), t)
+}
+
+func TestBlocksGetSize(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("getsize", t)
+	defer os.RemoveAll(path)
+	assert.Nil(Init(path, &config.Config{}), t)
+	r, err := Open(path)
+	assert.Nil(err, t)
+	defer r.Close()
+
+	bs := bstore.NewBlockstore(r.Datastore())
+	b := blocks.NewBlock([]byte("some data"))
+	assert.Nil(bs.Put(b), t)
+	size, err := bs.GetSize(b.Key())
+	assert.Nil(err, t)
+	if size != len(b.Data) {
+		t.Fatalf("expected size %d, got %d", len(b.Data), size)
+	}
+	if _, err := bs.GetSize(blocks.NewBlock([]byte("absent")).Key()); err != bstore.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// from the size of the file of the block
+	if _, ok := r.Datastore().(sizer); !ok {
+		t.Fatal("expected the repo datastore to tell sizes")
+	}
+}
@@ -0,0 +1,151 @@
+package fsrepo
+
+import (
+	"encoding/hex"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	config "github.com/ipfs/go-ipfs/repo/config"
+	lockfile "github.com/ipfs/go-ipfs/repo/fsrepo/lock"
+	serialize "github.com/ipfs/go-ipfs/repo/fsrepo/serialize"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// FsckReport is what Fsck found in a repo, and what it did about it.
+type FsckReport struct {
+	// StaleLock is whether the repo was left locked by a process gone
+	// since, as after a crash. The lock is removed in any case.
+	StaleLock bool
+	// Incomplete are the files of block writes cut short, and Orphans
+	// the other files of the flatfs directory it never reads, such as
+	// blocks in the wrong directory. They're by their path in the repo.
+	Incomplete []string
+	Orphans    []string
+	// Quarantined is how many of them were moved to the quarantine
+	// directory of the flatfs directory.
+	Quarantined int
+}
+
+// Fsck checks the files of the repo at repoPath which opening it doesn't
+// look at, and with fix set, quarantines those in the way. The repo must
+// not be open.
+func Fsck(repoPath string, fix bool) (*FsckReport, error) {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	repoPath, err := u.TildeExpansion(path.Clean(repoPath))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkInitialized(repoPath); err != nil {
+		return nil, err
+	}
+
+	var report FsckReport
+	// the lock file is removed on close, so one there before taking the
+	// lock was left by a process which didn't get to close it.
+	report.StaleLock = u.FileExists(path.Join(repoPath, lockfile.LockFile))
+	lock, err := lockfile.Lock(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+
+	filename, err := config.Filename(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := serialize.Load(filename)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Datastore.BlocksType != "" && conf.Datastore.BlocksType != "flatfs" {
+		return &report, nil
+	}
+
+	root := path.Join(repoPath, flatfsDirectory)
+	if err := scanFlatfs(root, &report); err != nil {
+		return nil, err
+	}
+	if fix {
+		n, err := quarantine(root, &report)
+		report.Quarantined = n
+		if err != nil {
+			return &report, err
+		}
+	}
+	for i, f := range report.Incomplete {
+		report.Incomplete[i] = path.Join(flatfsDirectory, f)
+	}
+	for i, f := range report.Orphans {
+		report.Orphans[i] = path.Join(flatfsDirectory, f)
+	}
+	return &report, nil
+}
+
+// scanFlatfs adds the files of the flatfs directory at root which flatfs
+// doesn't read to report, by their path in root.
+func scanFlatfs(root string, report *FsckReport) error {
+	prefixes, err := readDirIfExists(root)
+	if err != nil {
+		return err
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(prefix.Name(), ".") {
+			continue
+		}
+		if !prefix.IsDir() {
+			report.Orphans = append(report.Orphans, prefix.Name())
+			continue
+		}
+		entries, err := readDirIfExists(filepath.Join(root, prefix.Name()))
+		if err != nil {
+			return err
+		}
+		for _, fi := range entries {
+			name := filepath.Join(prefix.Name(), fi.Name())
+			switch {
+			case strings.HasPrefix(fi.Name(), "."):
+			case !fi.Mode().IsRegular() || filepath.Ext(fi.Name()) != flatfsExtension:
+				report.Incomplete = append(report.Incomplete, name)
+			case !flatfsFileIn(prefix.Name(), fi.Name()):
+				report.Orphans = append(report.Orphans, name)
+			}
+		}
+	}
+	return nil
+}
+
+// flatfsFileIn returns whether flatfs keeps the block file of the given
+// name in the prefix directory dir.
+func flatfsFileIn(dir, name string) bool {
+	safe := strings.TrimSuffix(name, flatfsExtension)
+	if _, err := hex.DecodeString(safe); err != nil {
+		return false
+	}
+	// flatfs pads names shorter than its prefixes with '_'.
+	return strings.HasPrefix(safe+strings.Repeat("_", len(dir)), dir)
+}
+
+// quarantine moves the files of report into the quarantine directory of
+// the flatfs directory at root, and returns how many it moved.
+func quarantine(root string, report *FsckReport) (int, error) {
+	dst := filepath.Join(root, quarantineDirectory)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, files := range [][]string{report.Incomplete, report.Orphans} {
+		for _, f := range files {
+			to := filepath.Join(dst, strings.Replace(f, string(filepath.Separator), "-", -1))
+			if err := os.Rename(filepath.Join(root, f), to); err != nil {
+				return n, err
+			}
+			log.Warningf("quarantined %s", f)
+			n++
+		}
+	}
+	return n, nil
+}
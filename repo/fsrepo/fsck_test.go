@@ -0,0 +1,66 @@
+package fsrepo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/repo/config"
+	lockfile "github.com/ipfs/go-ipfs/repo/fsrepo/lock"
+	"github.com/ipfs/go-ipfs/thirdparty/assert"
+)
+
+func TestFsck(t *testing.T) {
+	t.Parallel()
+	repoPath := testRepoPath("fsck", t)
+	defer os.RemoveAll(repoPath)
+	assert.Nil(Init(repoPath, &config.Config{}), t, "should initialize successfully")
+
+	blocks := filepath.Join(repoPath, flatfsDirectory)
+	prefix := filepath.Join(blocks, "1220abcd")
+	assert.Nil(os.MkdirAll(prefix, 0755), t)
+	files := map[string]string{
+		"1220abcd/1220abcdef.data": "block",
+		"1220abcd/1220ffff00.data": "misplaced",
+		"1220abcd/nothex.data":     "junk",
+		"1220abcd/put-123456":      "trunc",
+		"stray":                    "junk",
+	}
+	for f, data := range files {
+		assert.Nil(ioutil.WriteFile(filepath.Join(blocks, f), []byte(data), 0644), t)
+	}
+	assert.Nil(ioutil.WriteFile(filepath.Join(repoPath, lockfile.LockFile), nil, 0644), t)
+
+	report, err := Fsck(repoPath, false)
+	assert.Nil(err, t, "fsck should succeed")
+	if !report.StaleLock {
+		t.Fatal("stale lock not found")
+	}
+	if len(report.Incomplete) != 1 || len(report.Orphans) != 3 || report.Quarantined != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(blocks, "stray")); err != nil {
+		t.Fatal("files shouldn't move without fix:", err)
+	}
+
+	report, err = Fsck(repoPath, true)
+	assert.Nil(err, t, "fsck --fix should succeed")
+	if report.StaleLock || report.Quarantined != 4 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(blocks, "1220abcd/1220abcdef.data")); err != nil {
+		t.Fatal("block should be untouched:", err)
+	}
+	report, err = Fsck(repoPath, false)
+	assert.Nil(err, t)
+	if len(report.Incomplete)+len(report.Orphans) != 0 {
+		t.Fatalf("files left in the way after fixing: %+v", report)
+	}
+
+	r, err := Open(repoPath)
+	assert.Nil(err, t)
+	defer r.Close()
+	_, err = Fsck(repoPath, false)
+	assert.Err(err, t, "fsck of an open repo should fail")
+}
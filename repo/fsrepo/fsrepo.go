@@ -4,18 +4,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/codahale/metrics"
 	ds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
-	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/flatfs"
-	levelds "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/leveldb"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/measure"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/mount"
-	ldbopts "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/syndtr/goleveldb/leveldb/opt"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	repo "github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/repo/common"
 	config "github.com/ipfs/go-ipfs/repo/config"
@@ -30,14 +31,17 @@ import (
 )
 
 // version number that we are currently expecting to see
-var RepoVersion = "2"
+var RepoVersion = "3"
+
+var log = eventlog.Logger("fsrepo")
 
 var migrationInstructions = `See https://github.com/ipfs/fs-repo-migrations/blob/master/run.md
 Sorry for the inconvenience. In the future, these will run automatically.`
 
 var errIncorrectRepoFmt = `Repo has incorrect version: %s
 Program version is: %s
-Please run the ipfs migration tool before continuing.
+Please run 'ipfs repo migrate', or start the daemon with --migrate, before
+continuing. Repos older than version 2 need the ipfs migration tool.
 ` + migrationInstructions
 
 var (
@@ -56,8 +60,12 @@ func (err NoRepoError) Error() string {
 }
 
 const (
-	leveldbDirectory = "datastore"
-	flatfsDirectory  = "blocks"
+	leveldbDirectory  = "datastore"
+	flatfsDirectory   = "blocks"
+	keystoreDirectory = "keystore"
+	swarmKeyFile      = "swarm.key"
+	// apiFile holds the address of the API of the daemon holding the repo.
+	apiFile = "api"
 )
 
 var (
@@ -94,9 +102,15 @@ type FSRepo struct {
 	config   *config.Config
 	ds       ds.ThreadSafeDatastore
 	// tracked separately for use in Close; do not use directly.
-	leveldbDS      levelds.Datastore
+	mainDS         ds.ThreadSafeDatastore
+	blocksDS       ds.ThreadSafeDatastore
 	metricsBlocks  measure.DatastoreCloser
 	metricsLevelDB measure.DatastoreCloser
+	metricsUsage   metrics.Gauge
+	keys           *keystore.FSKeystore
+	// wroteAPIFile is set once SetAPIAddr wrote the api file, for Close to
+	// remove it.
+	wroteAPIFile bool
 }
 
 var _ repo.Repo = (*FSRepo)(nil)
@@ -136,6 +150,12 @@ func open(repoPath string) (repo.Repo, error) {
 		}
 	}()
 
+	// an api file left by a node which did not close the repo sends the
+	// commands to a daemon which is gone
+	if err := os.Remove(path.Join(r.path, apiFile)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
 	// Check version, and error out if not matching
 	ver, err := mfsr.RepoPath(r.path).Version()
 	if err != nil {
@@ -146,7 +166,7 @@ func open(repoPath string) (repo.Repo, error) {
 	}
 
 	if ver != RepoVersion {
-		return nil, fmt.Errorf(errIncorrectRepoFmt, ver, RepoVersion)
+		return nil, VersionError{Path: r.path, Version: ver}
 	}
 
 	// check repo path, then check all constituent parts.
@@ -162,6 +182,11 @@ func open(repoPath string) (repo.Repo, error) {
 		return nil, err
 	}
 
+	r.keys, err = keystore.NewFSKeystore(path.Join(r.path, keystoreDirectory))
+	if err != nil {
+		return nil, err
+	}
+
 	// setup eventlogger
 	configureEventLoggerAtRepoPath(r.config, r.path)
 
@@ -236,7 +261,6 @@ func initConfig(path string, conf *config.Config) error {
 }
 
 // Init initializes a new FSRepo at the given path with the provided config.
-// TODO add support for custom datastores.
 func Init(repoPath string, conf *config.Config) error {
 
 	// packageLock must be held to ensure that the repo is not initialized more
@@ -309,27 +333,25 @@ func (r *FSRepo) openConfig() error {
 
 // openDatastore returns an error if the config file is not present.
 func (r *FSRepo) openDatastore() error {
-	leveldbPath := path.Join(r.path, leveldbDirectory)
-	var err error
-	// save leveldb reference so it can be neatly closed afterward
-	r.leveldbDS, err = levelds.NewDatastore(leveldbPath, &levelds.Options{
-		Compression: ldbopts.NoCompression,
-	})
+	cfg := r.config.Datastore
+	mainBackend, err := backend(cfg.Type, defaultBackend)
 	if err != nil {
-		return errors.New("unable to open leveldb datastore")
+		return err
+	}
+	blocksBackend, err := backend(cfg.BlocksType, defaultBlocksBackend)
+	if err != nil {
+		return err
 	}
 
-	// 4TB of 256kB objects ~=17M objects, splitting that 256-way
-	// leads to ~66k objects per dir, splitting 256*256-way leads to
-	// only 256.
-	//
-	// The keys seen by the block store have predictable prefixes,
-	// including "/" from datastore.Key and 2 bytes from multihash. To
-	// reach a uniform 256-way split, we need approximately 4 bytes of
-	// prefix.
-	blocksDS, err := flatfs.New(path.Join(r.path, flatfsDirectory), 4)
+	// save the datastore references so they can be neatly closed afterward
+	r.mainDS, err = mainBackend.Open(path.Join(r.path, leveldbDirectory), &cfg)
 	if err != nil {
-		return errors.New("unable to open flatfs datastore")
+		return fmt.Errorf("unable to open datastore: %s", err)
+	}
+	r.blocksDS, err = blocksBackend.Open(path.Join(r.path, flatfsDirectory), &cfg)
+	if err != nil {
+		closeDatastore(r.mainDS)
+		return fmt.Errorf("unable to open blocks datastore: %s", err)
 	}
 
 	// Add our PeerID to metrics paths to keep them unique
@@ -342,11 +364,19 @@ func (r *FSRepo) openDatastore() error {
 		id = fmt.Sprintf("uninitialized_%p", r)
 	}
 	prefix := "fsrepo." + id + ".datastore."
-	r.metricsBlocks = measure.New(prefix+"blocks", blocksDS)
-	r.metricsLevelDB = measure.New(prefix+"leveldb", r.leveldbDS)
+	r.metricsBlocks = measure.New(prefix+"blocks", r.blocksDS)
+	r.metricsLevelDB = measure.New(prefix+"leveldb", r.mainDS)
+	r.metricsUsage = metrics.Gauge("fsrepo." + id + ".usage")
+	r.metricsUsage.SetFunc(func() int64 {
+		du, err := r.GetStorageUsage()
+		if err != nil {
+			log.Debugf("measuring repo usage: %s", err)
+		}
+		return int64(du)
+	})
 	mountDS := mount.New([]mount.Mount{
 		{
-			Prefix:    ds.NewKey("/blocks"),
+			Prefix:    blocksPrefix,
 			Datastore: r.metricsBlocks,
 		},
 		{
@@ -354,14 +384,15 @@ func (r *FSRepo) openDatastore() error {
 			Datastore: r.metricsLevelDB,
 		},
 	})
-	// Make sure it's ok to claim the virtual datastore from mount as
-	// threadsafe. There's no clean way to make mount itself provide
-	// this information without copy-pasting the code into two
-	// variants. This is the same dilemma as the `[].byte` attempt at
-	// introducing const types to Go.
-	var _ ds.ThreadSafeDatastore = blocksDS
-	var _ ds.ThreadSafeDatastore = r.leveldbDS
+	// Both datastores being ThreadSafeDatastores, it's ok to claim the
+	// virtual datastore from mount as threadsafe. There's no clean way to
+	// make mount itself provide this information without copy-pasting the
+	// code into two variants. This is the same dilemma as the `[].byte`
+	// attempt at introducing const types to Go.
 	r.ds = ds2.ClaimThreadSafe{mountDS}
+	if s, ok := r.blocksDS.(sizer); ok {
+		r.ds = sizingDatastore{ThreadSafeDatastore: r.ds, blocks: s}
+	}
 	return nil
 }
 
@@ -386,7 +417,11 @@ func (r *FSRepo) Close() error {
 	if err := r.metricsLevelDB.Close(); err != nil {
 		return err
 	}
-	if err := r.leveldbDS.Close(); err != nil {
+	r.metricsUsage.Remove()
+	if err := closeDatastore(r.blocksDS); err != nil {
+		return err
+	}
+	if err := closeDatastore(r.mainDS); err != nil {
 		return err
 	}
 
@@ -398,6 +433,12 @@ func (r *FSRepo) Close() error {
 	// to disable logging once the component is closed.
 	// eventlog.Configure(eventlog.Output(os.Stderr))
 
+	if r.wroteAPIFile {
+		if err := os.Remove(path.Join(r.path, apiFile)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
 	r.closed = true
 	if err := r.lockfile.Close(); err != nil {
 		return err
@@ -408,6 +449,10 @@ func (r *FSRepo) Close() error {
 // Config returns the FSRepo's config. This method must not be called if the
 // repo is not open.
 //
+// The config returned is a snapshot: it is replaced, never changed, by
+// SetConfig and ReloadConfig, so it must not be changed either. Callers
+// that change it to set it again work on a Clone of it.
+//
 // Result when not Open is undefined. The method may panic if it pleases.
 func (r *FSRepo) Config() *config.Config {
 
@@ -448,7 +493,12 @@ func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
 	if err := serialize.WriteConfigFile(configFilename, mapconf); err != nil {
 		return err
 	}
-	*r.config = *updated // copy so caller cannot modify this private config
+	// copy so caller cannot modify this private config
+	conf, err := updated.Clone()
+	if err != nil {
+		return err
+	}
+	r.config = conf
 	return nil
 }
 
@@ -462,6 +512,28 @@ func (r *FSRepo) SetConfig(updated *config.Config) error {
 	return r.setConfigUnsynced(updated)
 }
 
+// ReloadConfig reads the config file again, so that the changes made to
+// it while the repo is open, as by hand, are seen.
+func (r *FSRepo) ReloadConfig() error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	if r.closed {
+		return errors.New("repo is closed")
+	}
+
+	configFilename, err := config.Filename(r.path)
+	if err != nil {
+		return err
+	}
+	conf, err := serialize.Load(configFilename)
+	if err != nil {
+		return err
+	}
+	r.config = conf
+	return nil
+}
+
 // GetConfigKey retrieves only the value of a particular key.
 func (r *FSRepo) GetConfigKey(key string) (interface{}, error) {
 	packageLock.Lock()
@@ -527,6 +599,70 @@ func (r *FSRepo) Datastore() ds.ThreadSafeDatastore {
 	return d
 }
 
+// Keystore returns the keystore in the repo.
+func (r *FSRepo) Keystore() keystore.Keystore {
+	return r.keys
+}
+
+// GetStorageUsage returns the sum of the sizes of the files in the repo.
+func (r *FSRepo) GetStorageUsage() (uint64, error) {
+	var du uint64
+	err := filepath.Walk(r.path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// files come and go as the repo is used
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !fi.IsDir() {
+			du += uint64(fi.Size())
+		}
+		return nil
+	})
+	return du, err
+}
+
+// SwarmKey returns the contents of the swarm.key file of the repo, or nil
+// if there is none.
+func (r *FSRepo) SwarmKey() ([]byte, error) {
+	b, err := ioutil.ReadFile(path.Join(r.path, swarmKeyFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// SetAPIAddr writes addr, the address the API of the node is served on,
+// to the api file of the repo, for the commands run while the node holds
+// the repo to reach it there. The file is removed once the repo is
+// closed.
+func (r *FSRepo) SetAPIAddr(addr string) error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	if err := ioutil.WriteFile(path.Join(r.path, apiFile), []byte(addr), 0600); err != nil {
+		return err
+	}
+	r.wroteAPIFile = true
+	return nil
+}
+
+// APIAddr returns the address of the API of the node holding the repo at
+// repoPath, read from its api file, or "" if it has none. Nodes which did
+// not close the repo leave the file behind until the repo is opened again,
+// so the address is only good while the repo is locked.
+func APIAddr(repoPath string) (string, error) {
+	b, err := ioutil.ReadFile(path.Join(path.Clean(repoPath), apiFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
 var _ io.Closer = &FSRepo{}
 var _ repo.Repo = &FSRepo{}
 
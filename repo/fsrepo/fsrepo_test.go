@@ -3,6 +3,7 @@ package fsrepo
 import (
 	"bytes"
 	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	datastore "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
@@ -116,3 +117,72 @@ func TestOpenMoreThanOnceInSameProcess(t *testing.T) {
 	assert.Nil(r1.Close(), t)
 	assert.Nil(r2.Close(), t)
 }
+
+func TestAPIFile(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("api", t)
+	assert.Nil(Init(path, &config.Config{}), t)
+
+	r, err := Open(path)
+	assert.Nil(err, t)
+	assert.Nil(r.SetAPIAddr("/ip4/127.0.0.1/tcp/5001"), t)
+	addr, err := APIAddr(path)
+	assert.Nil(err, t)
+	assert.True(addr == "/ip4/127.0.0.1/tcp/5001", t, "api file should hold the address set")
+
+	assert.Nil(r.Close(), t)
+	addr, err = APIAddr(path)
+	assert.Nil(err, t)
+	assert.True(addr == "", t, "api file should be removed on close")
+}
+
+func TestStaleAPIFileRemoved(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("api", t)
+	assert.Nil(Init(path, &config.Config{}), t)
+	assert.Nil(ioutil.WriteFile(filepath.Join(path, apiFile), []byte("/ip4/127.0.0.1/tcp/5001"), 0600), t)
+
+	r, err := Open(path)
+	assert.Nil(err, t)
+	addr, err := APIAddr(path)
+	assert.Nil(err, t)
+	assert.True(addr == "", t, "opening the repo should remove a stale api file")
+	assert.Nil(r.Close(), t)
+}
+
+func TestConfigSnapshots(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("config", t)
+	assert.Nil(Init(path, &config.Config{}), t)
+
+	r, err := Open(path)
+	assert.Nil(err, t)
+	defer r.Close()
+
+	// readers keep using the config they got while it is replaced
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			cfg := r.Config()
+			_ = cfg.Addresses.API
+			_ = len(cfg.Bootstrap)
+		}
+	}()
+
+	before := r.Config()
+	cfg, err := before.Clone()
+	assert.Nil(err, t)
+	for i := 0; i < 20; i++ {
+		cfg.Addresses.API = "/ip4/127.0.0.1/tcp/5002"
+		cfg.Bootstrap = append(cfg.Bootstrap, "/ip4/127.0.0.1/tcp/4001")
+		assert.Nil(r.SetConfig(cfg), t)
+		assert.Nil(r.ReloadConfig(), t)
+	}
+	<-done
+
+	assert.True(before.Addresses.API == "", t, "the config got before should not change")
+	assert.True(r.Config().Addresses.API == "/ip4/127.0.0.1/tcp/5002", t, "the config set should be seen")
+	cfg.Addresses.API = "/ip4/127.0.0.1/tcp/5003"
+	assert.True(r.Config().Addresses.API == "/ip4/127.0.0.1/tcp/5002", t, "changing the config set should not change the repo's")
+}
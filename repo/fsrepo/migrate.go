@@ -0,0 +1,111 @@
+package fsrepo
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/ipfs/go-ipfs/repo/common"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	lockfile "github.com/ipfs/go-ipfs/repo/fsrepo/lock"
+	mfsr "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+	serialize "github.com/ipfs/go-ipfs/repo/fsrepo/serialize"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// VersionError is returned by Open for repos of another version than
+// RepoVersion, which Migrate can take to it.
+type VersionError struct {
+	Path    string
+	Version string
+}
+
+var _ error = VersionError{}
+
+func (err VersionError) Error() string {
+	return fmt.Sprintf(errIncorrectRepoFmt, err.Version, RepoVersion)
+}
+
+func init() {
+	// Version 3 records the backends of the datastores in the config, as
+	// ipfs init does, so that changing the defaults doesn't change them
+	// for repos made before. Version 2 reads them all the same, so the
+	// backends it would default to are dropped again on the way down.
+	mfsr.Register(&mfsr.Migration{
+		From:  2,
+		To:    3,
+		Files: []string{config.DefaultConfigFile},
+		Up: func(repoPath string) error {
+			return setDefaultBackends(repoPath, func(v interface{}, def string) interface{} {
+				if v == nil || v == "" {
+					return def
+				}
+				return v
+			})
+		},
+		Down: func(repoPath string) error {
+			return setDefaultBackends(repoPath, func(v interface{}, def string) interface{} {
+				if v == def {
+					return ""
+				}
+				return v
+			})
+		},
+	})
+}
+
+// setDefaultBackends sets Datastore.Type and Datastore.BlocksType in the
+// config of the repo at repoPath to what set returns for their values and
+// defaults.
+func setDefaultBackends(repoPath string, set func(v interface{}, def string) interface{}) error {
+	filename := path.Join(repoPath, config.DefaultConfigFile)
+	var mapconf map[string]interface{}
+	if err := serialize.ReadConfigFile(filename, &mapconf); err != nil {
+		return err
+	}
+	for key, def := range map[string]string{
+		"Datastore.Type":       defaultBackend,
+		"Datastore.BlocksType": defaultBlocksBackend,
+	} {
+		v, _ := common.MapGetKV(mapconf, key)
+		if err := common.MapSetKV(mapconf, key, set(v, def)); err != nil {
+			return err
+		}
+	}
+	return serialize.WriteConfigFile(filename, mapconf)
+}
+
+// Migrate runs the migrations taking the repo at repoPath to version to,
+// such as RepoVersion, and returns the names of those it ran, like
+// "2-to-3". The repo must not be open.
+//
+// Each migration backs up the files it changes in the backups directory
+// of the repo first, and puts them back should it fail.
+func Migrate(repoPath, to string) ([]string, error) {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	repoPath, err := u.TildeExpansion(path.Clean(repoPath))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkInitialized(repoPath); err != nil {
+		return nil, err
+	}
+	version, err := strconv.Atoi(to)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect repo version %q", to)
+	}
+	lock, err := lockfile.Lock(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+
+	steps, err := mfsr.RepoPath(repoPath).Migrate(version)
+	names := make([]string, len(steps))
+	for i, s := range steps {
+		names[i] = s.String()
+	}
+	return names, err
+}
@@ -0,0 +1,61 @@
+package fsrepo
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/repo/config"
+	mfsr "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+	"github.com/ipfs/go-ipfs/thirdparty/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+	repoPath := testRepoPath("migrate", t)
+	assert.Nil(Init(repoPath, &config.Config{}), t, "should initialize successfully")
+	assert.Nil(mfsr.RepoPath(repoPath).WriteVersion("2"), t)
+
+	_, err := Open(repoPath)
+	if _, ok := err.(VersionError); !ok {
+		t.Fatalf("expected a VersionError opening an old repo, got %v", err)
+	}
+
+	steps, err := Migrate(repoPath, RepoVersion)
+	assert.Nil(err, t, "should migrate to the current version")
+	if !reflect.DeepEqual(steps, []string{"2-to-3"}) {
+		t.Fatalf("unexpected migrations %v", steps)
+	}
+	if _, err := os.Stat(path.Join(repoPath, mfsr.BackupDirectory, "2-to-3", config.DefaultConfigFile)); err != nil {
+		t.Fatalf("expected the config backed up: %s", err)
+	}
+
+	r, err := Open(repoPath)
+	assert.Nil(err, t, "should open after migrating")
+	if ds := r.Config().Datastore; ds.Type != "leveldb" || ds.BlocksType != "flatfs" {
+		t.Fatalf("backends not recorded in the config: %+v", ds)
+	}
+	_, err = Migrate(repoPath, "2")
+	assert.Err(err, t, "migrating an open repo should fail")
+	assert.Nil(r.Close(), t)
+
+	steps, err = Migrate(repoPath, RepoVersion)
+	assert.Nil(err, t, "migrating to the same version should succeed")
+	if len(steps) != 0 {
+		t.Fatalf("expected no migrations, got %v", steps)
+	}
+	_, err = Migrate(repoPath, "100")
+	assert.Err(err, t, "migrating to an unknown version should fail")
+
+	steps, err = Migrate(repoPath, "2")
+	assert.Nil(err, t, "should migrate back down")
+	if !reflect.DeepEqual(steps, []string{"3-to-2"}) {
+		t.Fatalf("unexpected migrations %v", steps)
+	}
+	conf, err := ConfigAt(repoPath)
+	assert.Nil(err, t)
+	if conf.Datastore.Type != "" || conf.Datastore.BlocksType != "" {
+		t.Fatalf("default backends left in the config: %+v", conf.Datastore)
+	}
+}
@@ -0,0 +1,164 @@
+package mfsr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+)
+
+// BackupDirectory is where the files a migration changes are backed up,
+// under a directory of the migration, such as "backups/2-to-3".
+const BackupDirectory = "backups"
+
+// Migration changes the layout of a repo from version From to To, the
+// next one.
+type Migration struct {
+	From, To int
+
+	// Files are the files of the repo the migration changes, by their
+	// path in the repo. They are backed up before it runs either way, and
+	// put back should it fail.
+	Files []string
+
+	// Up upgrades the repo at repoPath from From to To.
+	Up func(repoPath string) error
+	// Down downgrades the repo at repoPath from To to From. It's nil when
+	// that can't be done safely.
+	Down func(repoPath string) error
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%d-to-%d", m.From, m.To)
+}
+
+var (
+	migrationsLock sync.Mutex
+	migrations     = make(map[int]*Migration)
+)
+
+// Register makes m available to Migrate. It's meant to be called from the
+// init function of the package knowing the layouts m migrates between.
+func Register(m *Migration) {
+	if m.To != m.From+1 {
+		panic(fmt.Sprintf("migration %s doesn't go to the next version", m))
+	}
+
+	migrationsLock.Lock()
+	defer migrationsLock.Unlock()
+	migrations[m.From] = m
+}
+
+// Step is a migration run by Migrate, and whether it was run Down.
+type Step struct {
+	*Migration
+	Undo bool
+}
+
+func (s Step) String() string {
+	if s.Undo {
+		return fmt.Sprintf("%d-to-%d", s.To, s.From)
+	}
+	return s.Migration.String()
+}
+
+// Plan returns the migrations taking the repo from version from to to, in
+// the order they run, or an error if one of them is missing or can't be
+// undone.
+func Plan(from, to int) ([]Step, error) {
+	migrationsLock.Lock()
+	defer migrationsLock.Unlock()
+
+	var steps []Step
+	for v := from; v < to; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return nil, fmt.Errorf("no migration from version %d to %d", v, v+1)
+		}
+		steps = append(steps, Step{Migration: m})
+	}
+	for v := from; v > to; v-- {
+		m, ok := migrations[v-1]
+		if !ok {
+			return nil, fmt.Errorf("no migration from version %d to %d", v, v-1)
+		}
+		if m.Down == nil {
+			return nil, fmt.Errorf("migration from version %d to %d can't be undone", v-1, v)
+		}
+		steps = append(steps, Step{Migration: m, Undo: true})
+	}
+	return steps, nil
+}
+
+// Migrate runs the migrations taking the repo to version to, writing the
+// version of the repo after each of them, and returns those it ran. The
+// repo must not be open.
+func (rp RepoPath) Migrate(to int) ([]Step, error) {
+	v, err := rp.Version()
+	if err != nil {
+		return nil, err
+	}
+	from, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect repo version %q", v)
+	}
+
+	steps, err := Plan(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range steps {
+		if err := rp.run(s); err != nil {
+			return steps[:i], fmt.Errorf("migration %s: %s", s, err)
+		}
+	}
+	return steps, nil
+}
+
+// run runs the step s, putting back the files it changes if it fails.
+func (rp RepoPath) run(s Step) error {
+	backups := path.Join(string(rp), BackupDirectory, s.String())
+	if err := os.MkdirAll(backups, 0755); err != nil {
+		return err
+	}
+	for _, f := range s.Files {
+		if err := copyFile(path.Join(string(rp), f), path.Join(backups, f)); err != nil {
+			return fmt.Errorf("backing up %s: %s", f, err)
+		}
+	}
+
+	migrate, version := s.Up, s.To
+	if s.Undo {
+		migrate, version = s.Down, s.From
+	}
+	err := migrate(string(rp))
+	if err == nil {
+		err = rp.WriteVersion(strconv.Itoa(version))
+	}
+	if err != nil {
+		for _, f := range s.Files {
+			if err := copyFile(path.Join(backups, f), path.Join(string(rp), f)); err != nil {
+				return fmt.Errorf("restoring %s from %s: %s", f, backups, err)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	buf, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, buf, fi.Mode())
+}
@@ -0,0 +1,78 @@
+package fsrepo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// quarantineDirectory is where incomplete block writes found at startup are
+// moved. flatfs ignores entries beginning with '.', so the quarantine never
+// shows up as blocks.
+const quarantineDirectory = ".quarantine"
+
+// flatfsExtension is the suffix flatfs uses for committed block files.
+const flatfsExtension = ".data"
+
+// recoverFlatfs makes the flatfs directory at root consistent after a crash.
+//
+// flatfs writes each block to a temporary file in the prefix directory,
+// fsyncs it, and renames it into place, so a committed ".data" file is
+// never truncated. A power loss mid-Put can, however, leave the temporary
+// file behind. Those are moved into the quarantine directory rather than
+// deleted so they can be inspected. Leaving them in place is not harmless:
+// flatfs itself stops listing a prefix directory when it sees a stray
+// entry, though streamingFlatfs, which the repo opens, skips them.
+//
+// It returns the number of files quarantined.
+func recoverFlatfs(root string) (int, error) {
+	prefixes, err := readDirIfExists(root)
+	if err != nil {
+		return 0, err
+	}
+
+	quarantine := filepath.Join(root, quarantineDirectory)
+	n := 0
+	for _, prefix := range prefixes {
+		if !prefix.IsDir() || strings.HasPrefix(prefix.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(root, prefix.Name())
+		entries, err := readDirIfExists(dir)
+		if err != nil {
+			return n, err
+		}
+		for _, fi := range entries {
+			if fi.Mode().IsRegular() && filepath.Ext(fi.Name()) == flatfsExtension {
+				continue
+			}
+			if strings.HasPrefix(fi.Name(), ".") {
+				continue
+			}
+			if err := os.MkdirAll(quarantine, 0755); err != nil {
+				return n, err
+			}
+			src := filepath.Join(dir, fi.Name())
+			dst := filepath.Join(quarantine, prefix.Name()+"-"+fi.Name())
+			if err := os.Rename(src, dst); err != nil {
+				return n, err
+			}
+			log.Warningf("quarantined incomplete block write %s", src)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// readDirIfExists lists a directory, treating a missing one as empty.
+func readDirIfExists(dir string) ([]os.FileInfo, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdir(0)
+}
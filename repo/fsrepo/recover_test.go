@@ -0,0 +1,55 @@
+package fsrepo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/thirdparty/assert"
+)
+
+func TestRecoverFlatfsQuarantinesIncompleteWrites(t *testing.T) {
+	t.Parallel()
+	root := testRepoPath("flatfs", t)
+	defer os.RemoveAll(root)
+
+	prefix := filepath.Join(root, "1220abcd")
+	assert.Nil(os.MkdirAll(prefix, 0755), t)
+	block := filepath.Join(prefix, "1220abcdef.data")
+	assert.Nil(ioutil.WriteFile(block, []byte("complete"), 0644), t)
+	tmp := filepath.Join(prefix, "put-123456")
+	assert.Nil(ioutil.WriteFile(tmp, []byte("trunc"), 0644), t)
+
+	n, err := recoverFlatfs(root)
+	assert.Nil(err, t)
+	if n != 1 {
+		t.Fatalf("expected 1 quarantined file, got %d", n)
+	}
+
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatal("temporary file should have been moved out of the prefix directory")
+	}
+	if _, err := os.Stat(block); err != nil {
+		t.Fatal("committed block should be untouched:", err)
+	}
+	moved := filepath.Join(root, quarantineDirectory, "1220abcd-put-123456")
+	if _, err := os.Stat(moved); err != nil {
+		t.Fatal("temporary file should be in quarantine:", err)
+	}
+
+	n, err = recoverFlatfs(root)
+	assert.Nil(err, t)
+	if n != 0 {
+		t.Fatalf("second recovery should be a no-op, quarantined %d", n)
+	}
+}
+
+func TestRecoverFlatfsMissingDirectory(t *testing.T) {
+	t.Parallel()
+	n, err := recoverFlatfs(filepath.Join(testRepoPath("flatfs", t), "missing"))
+	assert.Nil(err, t)
+	if n != 0 {
+		t.Fatalf("expected nothing to recover, got %d", n)
+	}
+}
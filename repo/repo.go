@@ -4,6 +4,7 @@ import (
 	"io"
 
 	datastore "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	keystore "github.com/ipfs/go-ipfs/keystore"
 	config "github.com/ipfs/go-ipfs/repo/config"
 )
 
@@ -11,10 +12,28 @@ type Repo interface {
 	Config() *config.Config
 	SetConfig(*config.Config) error
 
+	// ReloadConfig reads the config again from where it is stored, for
+	// the changes made there while the repo is open to be seen.
+	ReloadConfig() error
+
 	SetConfigKey(key string, value interface{}) error
 	GetConfigKey(key string) (interface{}, error)
 
 	Datastore() datastore.ThreadSafeDatastore
 
+	// Keystore holds the keys of the node besides its identity.
+	Keystore() keystore.Keystore
+
+	// GetStorageUsage returns the number of bytes the repo takes on disk.
+	GetStorageUsage() (uint64, error)
+
+	// SwarmKey returns the pre-shared key of the private network the node
+	// is limited to, or nil if it isn't.
+	SwarmKey() ([]byte, error)
+
+	// SetAPIAddr records the address the API of the node is served on,
+	// for the commands run while the node holds the repo to reach it.
+	SetAPIAddr(addr string) error
+
 	io.Closer
 }
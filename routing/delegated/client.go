@@ -0,0 +1,275 @@
+// package delegated implements a routing system forwarding its calls to the
+// dht commands of the HTTP API of a remote node, for nodes which shouldn't
+// take on the load of the DHT themselves.
+package delegated
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	manet "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr-net"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	notif "github.com/ipfs/go-ipfs/notifications"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	routing "github.com/ipfs/go-ipfs/routing"
+	eventlog "github.com/ipfs/go-ipfs/thirdparty/eventlog"
+)
+
+var log = eventlog.Logger("delegated")
+
+var ErrPingUnsupported = errors.New("delegated routing: the delegate can't ping peers for us")
+
+// ErrProvideUnsupported is returned by Provide: the DHT only takes the
+// provider records of a peer from the peer itself, so the delegate can't
+// announce this node's content.
+var ErrProvideUnsupported = errors.New("delegated routing: the delegate can't provide for us")
+
+// Client is a routing.IpfsRouting which asks a remote node, the delegate,
+// to run its queries through the DHT. Values go through the API base64
+// encoded, as records are binary.
+type Client struct {
+	api       string
+	peerstore peer.Peerstore
+	http      *http.Client
+}
+
+// NewClient returns a Client for the delegate serving its API at apiAddr,
+// such as "/ip4/10.0.0.1/tcp/5001". The addresses of the peers found are
+// added to ps.
+func NewClient(apiAddr string, ps peer.Peerstore) (*Client, error) {
+	maddr, err := ma.NewMultiaddr(apiAddr)
+	if err != nil {
+		return nil, err
+	}
+	_, host, err := manet.DialArgs(maddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		api:       "http://" + host + "/api/v0/",
+		peerstore: ps,
+		http:      &http.Client{},
+	}, nil
+}
+
+var _ routing.IpfsRouting = &Client{}
+
+// query runs the dht command cmd with args and the options opts on the
+// delegate, and passes the events it streams to f until f returns false.
+func (c *Client) query(ctx context.Context, cmd string, args []string, opts url.Values, f func(*notif.QueryEvent) bool) error {
+	v := url.Values{}
+	for k, o := range opts {
+		v[k] = o
+	}
+	for _, a := range args {
+		v.Add("arg", a)
+	}
+	v.Set("encoding", "json")
+	v.Set("stream-channels", "true")
+
+	req, err := http.NewRequest("GET", c.api+"dht/"+cmd+"?"+v.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// stop reading the stream of events with ctx
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			res.Body.Close()
+		case <-done:
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		var e struct{ Message string }
+		if err := json.NewDecoder(res.Body).Decode(&e); err != nil || e.Message == "" {
+			return fmt.Errorf("delegated routing: %s", res.Status)
+		}
+		return fmt.Errorf("delegated routing: %s", e.Message)
+	}
+
+	dec := json.NewDecoder(res.Body)
+	for {
+		ev := new(notif.QueryEvent)
+		if err := dec.Decode(ev); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if !f(ev) {
+			return nil
+		}
+	}
+}
+
+// do sends req, and stops waiting for its response with ctx.
+func (c *Client) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	type result struct {
+		res *http.Response
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, err := c.http.Do(req)
+		done <- result{res, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.res, r.err
+	case <-ctx.Done():
+		go func() {
+			// close the response nobody waits for anymore
+			if r := <-done; r.err == nil {
+				r.res.Body.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// addAddrs remembers the addresses of the peers the delegate found.
+func (c *Client) addAddrs(pis []*peer.PeerInfo) {
+	for _, pi := range pis {
+		c.peerstore.AddAddrs(pi.ID, pi.Addrs, peer.TempAddrTTL)
+	}
+}
+
+func (c *Client) FindProvidersAsync(ctx context.Context, k key.Key, count int) <-chan peer.PeerInfo {
+	out := make(chan peer.PeerInfo)
+	go func() {
+		defer close(out)
+		found := 0
+		err := c.query(ctx, "findprovs", []string{k.B58String()}, nil, func(ev *notif.QueryEvent) bool {
+			if ev.Type != notif.Provider || len(ev.Responses) == 0 {
+				return true
+			}
+			c.addAddrs(ev.Responses)
+			select {
+			case out <- *ev.Responses[0]:
+			case <-ctx.Done():
+				return false
+			}
+			found++
+			return found < count
+		})
+		if err != nil {
+			log.Debugf("delegated findprovs %s: %s", k, err)
+		}
+	}()
+	return out
+}
+
+// base64Opts has the delegate take and give values base64 encoded.
+var base64Opts = url.Values{"base64": {"true"}}
+
+func (c *Client) PutValue(ctx context.Context, k key.Key, value []byte) error {
+	var qerr error
+	arg := base64.StdEncoding.EncodeToString(value)
+	err := c.query(ctx, "put", []string{k.B58String(), arg}, base64Opts, func(ev *notif.QueryEvent) bool {
+		if ev.Type == notif.QueryError {
+			qerr = errors.New(ev.Extra)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return qerr
+}
+
+func (c *Client) GetValue(ctx context.Context, k key.Key) ([]byte, error) {
+	var val []byte
+	var qerr error
+	err := c.query(ctx, "get", []string{k.B58String()}, base64Opts, func(ev *notif.QueryEvent) bool {
+		switch ev.Type {
+		case notif.Value:
+			val, qerr = base64.StdEncoding.DecodeString(ev.Extra)
+			if qerr != nil {
+				qerr = fmt.Errorf("delegated routing: invalid value: %s", qerr)
+			}
+			return false
+		case notif.QueryError:
+			qerr = errors.New(ev.Extra)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qerr != nil {
+		if strings.Contains(qerr.Error(), routing.ErrNotFound.Error()) {
+			return nil, routing.ErrNotFound
+		}
+		return nil, qerr
+	}
+	if val == nil {
+		return nil, routing.ErrNotFound
+	}
+	return val, nil
+}
+
+// Provide fails with ErrProvideUnsupported: the delegate would announce
+// itself, not this node, as the provider.
+func (c *Client) Provide(ctx context.Context, k key.Key) error {
+	return ErrProvideUnsupported
+}
+
+func (c *Client) FindPeer(ctx context.Context, p peer.ID) (peer.PeerInfo, error) {
+	var pi *peer.PeerInfo
+	var qerr error
+	err := c.query(ctx, "findpeer", []string{p.Pretty()}, nil, func(ev *notif.QueryEvent) bool {
+		switch ev.Type {
+		case notif.FinalPeer:
+			if len(ev.Responses) > 0 {
+				pi = ev.Responses[0]
+				return false
+			}
+		case notif.QueryError:
+			qerr = errors.New(ev.Extra)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return peer.PeerInfo{}, err
+	}
+	if qerr != nil {
+		return peer.PeerInfo{}, qerr
+	}
+	if pi == nil {
+		return peer.PeerInfo{}, routing.ErrNotFound
+	}
+	c.addAddrs([]*peer.PeerInfo{pi})
+	return *pi, nil
+}
+
+func (c *Client) Ping(ctx context.Context, p peer.ID) (time.Duration, error) {
+	return 0, ErrPingUnsupported
+}
+
+// Bootstrap does nothing, the delegate being bootstrapped on its own.
+func (c *Client) Bootstrap(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,153 @@
+package delegated
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ma "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multiaddr"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	notif "github.com/ipfs/go-ipfs/notifications"
+	peer "github.com/ipfs/go-ipfs/p2p/peer"
+	routing "github.com/ipfs/go-ipfs/routing"
+	testutil "github.com/ipfs/go-ipfs/util/testutil"
+)
+
+// fakeDelegate answers the dht commands with the events of events, by
+// command name.
+func fakeDelegate(t *testing.T, events map[string][]*notif.QueryEvent) (*httptest.Server, string) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cmd := strings.TrimPrefix(r.URL.Path, "/api/v0/dht/")
+		evs, ok := events[cmd]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(struct{ Message string }{"unknown command " + cmd})
+			return
+		}
+		for _, ev := range evs {
+			if err := json.NewEncoder(w).Encode(ev); err != nil {
+				t.Error(err)
+			}
+		}
+	}))
+
+	addr := strings.TrimPrefix(s.URL, "http://")
+	parts := strings.Split(addr, ":")
+	return s, "/ip4/" + parts[0] + "/tcp/" + parts[1]
+}
+
+func TestFindProviders(t *testing.T) {
+	pa := testutil.RandPeerIDFatal(t)
+	pb := testutil.RandPeerIDFatal(t)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/4001")
+
+	s, api := fakeDelegate(t, map[string][]*notif.QueryEvent{
+		"findprovs": {
+			{Type: notif.SendingQuery, ID: pb},
+			{Type: notif.Provider, Responses: []*peer.PeerInfo{{ID: pa, Addrs: []ma.Multiaddr{addr}}}},
+			{Type: notif.Provider, Responses: []*peer.PeerInfo{{ID: pb}}},
+		},
+	})
+	defer s.Close()
+
+	ps := peer.NewPeerstore()
+	c, err := NewClient(api, ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []peer.ID
+	for pi := range c.FindProvidersAsync(context.Background(), key.Key("foo"), 1) {
+		found = append(found, pi.ID)
+	}
+	if len(found) != 1 || found[0] != pa {
+		t.Fatal("expected to find the first provider only, got", found)
+	}
+	if addrs := ps.Addrs(pa); len(addrs) != 1 || !addrs[0].Equal(addr) {
+		t.Fatal("the address of the provider wasn't added", addrs)
+	}
+}
+
+func TestGetValue(t *testing.T) {
+	// records are binary, and not valid UTF-8
+	record := []byte{0xff, 0x00, 'w', 0xfe}
+	s, api := fakeDelegate(t, map[string][]*notif.QueryEvent{
+		"get": {
+			{Type: notif.Value, Extra: base64.StdEncoding.EncodeToString(record)},
+		},
+	})
+	defer s.Close()
+
+	c, err := NewClient(api, peer.NewPeerstore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := c.GetValue(context.Background(), key.Key("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, record) {
+		t.Fatalf("expected %x got %x", record, val)
+	}
+
+	if _, err := c.FindPeer(context.Background(), testutil.RandPeerIDFatal(t)); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Fatal("expected the error of the delegate, got", err)
+	}
+}
+
+func TestFindPeerNotFound(t *testing.T) {
+	s, api := fakeDelegate(t, map[string][]*notif.QueryEvent{
+		"findpeer": {
+			{Type: notif.QueryError, Extra: routing.ErrNotFound.Error()},
+		},
+	})
+	defer s.Close()
+
+	c, err := NewClient(api, peer.NewPeerstore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.FindPeer(context.Background(), testutil.RandPeerIDFatal(t)); err == nil {
+		t.Fatal("expected the query error")
+	}
+}
+
+func TestPutValue(t *testing.T) {
+	record := []byte{0xff, 0x00, 'w', 0xfe}
+	var got []byte
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("base64") != "true" || len(q["arg"]) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var err error
+		got, err = base64.StdEncoding.DecodeString(q["arg"][1])
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+	defer s.Close()
+
+	parts := strings.Split(strings.TrimPrefix(s.URL, "http://"), ":")
+	c, err := NewClient("/ip4/"+parts[0]+"/tcp/"+parts[1], peer.NewPeerstore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PutValue(context.Background(), key.Key("hello"), record); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, record) {
+		t.Fatalf("expected the delegate to get %x, got %x", record, got)
+	}
+
+	if err := c.Provide(context.Background(), key.Key("hello")); err != ErrProvideUnsupported {
+		t.Fatal("expected providing to fail, got", err)
+	}
+}
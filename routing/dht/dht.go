@@ -38,6 +38,13 @@ const doPinging = false
 // collect members of the routing table.
 const NumBootstrapQueries = 5
 
+// the peers in the routing table are tagged kbucketTag in the connection
+// manager, to keep the conns to them open.
+const (
+	kbucketTag      = "kbucket"
+	kbucketTagValue = 5
+)
+
 // TODO. SEE https://github.com/jbenet/node-ipfs/blob/master/submodules/ipfs-dht/index.js
 
 // IpfsDHT is an implementation of Kademlia with Coral and S/Kademlia modifications.
@@ -62,6 +69,19 @@ type IpfsDHT struct {
 
 // NewDHT creates a new DHT object with the given peer as the 'local' host
 func NewDHT(ctx context.Context, h host.Host, dstore ds.ThreadSafeDatastore) *IpfsDHT {
+	dht := newDHT(ctx, h, dstore)
+	h.SetStreamHandler(ProtocolDHT, dht.handleNewStream)
+	return dht
+}
+
+// NewDHTClient creates a DHT which runs queries, but doesn't answer those
+// of other peers: it doesn't handle the dht protocol, so the peers which
+// query it find it isn't a server.
+func NewDHTClient(ctx context.Context, h host.Host, dstore ds.ThreadSafeDatastore) *IpfsDHT {
+	return newDHT(ctx, h, dstore)
+}
+
+func newDHT(ctx context.Context, h host.Host, dstore ds.ThreadSafeDatastore) *IpfsDHT {
 	dht := new(IpfsDHT)
 	dht.datastore = dstore
 	dht.self = h.ID()
@@ -77,11 +97,17 @@ func NewDHT(ctx context.Context, h host.Host, dstore ds.ThreadSafeDatastore) *Ip
 		return nil
 	})
 
-	h.SetStreamHandler(ProtocolDHT, dht.handleNewStream)
 	dht.providers = NewProviderManager(dht.Context(), dht.self)
 	dht.AddChild(dht.providers)
 
 	dht.routingTable = kb.NewRoutingTable(20, kb.ConvertPeerID(dht.self), time.Minute, dht.peerstore)
+	cmgr := h.ConnManager()
+	dht.routingTable.PeerAdded = func(p peer.ID) {
+		cmgr.TagPeer(p, kbucketTag, kbucketTagValue)
+	}
+	dht.routingTable.PeerRemoved = func(p peer.ID) {
+		cmgr.UntagPeer(p, kbucketTag)
+	}
 	dht.birth = time.Now()
 
 	dht.Validator = make(record.Validator)
@@ -130,6 +130,32 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestClientDoesNotAnswer(t *testing.T) {
+	ctx := context.Background()
+
+	dhtA := setupDHT(ctx, t)
+	h := netutil.GenHostSwarm(t, ctx)
+	client := NewDHTClient(ctx, h, dssync.MutexWrap(ds.NewMapDatastore()))
+
+	defer dhtA.Close()
+	defer client.Close()
+	defer dhtA.host.Close()
+	defer h.Close()
+
+	connect(t, ctx, client, dhtA)
+
+	// the client queries the server, and the server can't query the client
+	ctxT, _ := context.WithTimeout(ctx, 100*time.Millisecond)
+	if _, err := client.Ping(ctxT, dhtA.self); err != nil {
+		t.Fatal(err)
+	}
+
+	ctxT, _ = context.WithTimeout(ctx, 100*time.Millisecond)
+	if _, err := dhtA.Ping(ctxT, client.self); err == nil {
+		t.Fatal("the client answered a ping")
+	}
+}
+
 func TestValueGetSet(t *testing.T) {
 	// t.Skip("skipping test to debug another")
 
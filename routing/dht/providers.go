@@ -18,6 +18,7 @@ type ProviderManager struct {
 	lpeer     peer.ID
 
 	getlocal chan chan []key.Key
+	getcount chan chan int
 	newprovs chan *addProv
 	getprovs chan *getProv
 	period   time.Duration
@@ -45,7 +46,9 @@ func NewProviderManager(ctx context.Context, local peer.ID) *ProviderManager {
 	pm.newprovs = make(chan *addProv)
 	pm.providers = make(map[key.Key]*providerSet)
 	pm.getlocal = make(chan chan []key.Key)
+	pm.getcount = make(chan chan int)
 	pm.local = make(map[key.Key]struct{})
+	pm.lpeer = local
 	pm.ContextGroup = ctxgroup.WithContext(ctx)
 
 	pm.Children().Add(1)
@@ -87,6 +90,9 @@ func (pm *ProviderManager) run() {
 			}
 			lc <- keys
 
+		case cc := <-pm.getcount:
+			cc <- len(pm.providers)
+
 		case <-tick.C:
 			for _, provs := range pm.providers {
 				var filtered []peer.ID
@@ -141,6 +147,13 @@ func (pm *ProviderManager) GetLocal() []key.Key {
 	return <-resp
 }
 
+// Count returns the number of keys providers are known for.
+func (pm *ProviderManager) Count() int {
+	resp := make(chan int)
+	pm.getcount <- resp
+	return <-resp
+}
+
 func newProviderSet() *providerSet {
 	return &providerSet{
 		set: make(map[peer.ID]time.Time),
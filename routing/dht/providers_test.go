@@ -21,3 +21,20 @@ func TestProviderManager(t *testing.T) {
 	}
 	p.Close()
 }
+
+func TestProviderCount(t *testing.T) {
+	ctx := context.Background()
+	mid := peer.ID("testing")
+	p := NewProviderManager(ctx, mid)
+	defer p.Close()
+
+	p.AddProvider(ctx, key.Key("a"), peer.ID("testingprovider"))
+	p.AddProvider(ctx, key.Key("a"), mid)
+	p.AddProvider(ctx, key.Key("b"), peer.ID("testingprovider"))
+	if n := p.Count(); n != 2 {
+		t.Fatalf("expected providers for 2 keys, got %d", n)
+	}
+	if n := len(p.GetLocal()); n != 1 {
+		t.Fatalf("expected 1 local key, got %d", n)
+	}
+}
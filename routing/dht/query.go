@@ -2,6 +2,7 @@ package dht
 
 import (
 	"sync"
+	"time"
 
 	key "github.com/ipfs/go-ipfs/blocks/key"
 	notif "github.com/ipfs/go-ipfs/notifications"
@@ -13,6 +14,7 @@ import (
 	pset "github.com/ipfs/go-ipfs/util/peerset"
 	todoctr "github.com/ipfs/go-ipfs/util/todocounter"
 
+	metrics "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/codahale/metrics"
 	process "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/goprocess"
 	ctxproc "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/goprocess/context"
 	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
@@ -20,6 +22,10 @@ import (
 
 var maxQueryConcurrency = AlphaValue
 
+// queryLatency is the distribution of how long queries take, in
+// milliseconds, up to ten minutes.
+var queryLatency = metrics.NewHistogram("dht.Query.ms", 0, int64(10*time.Minute/time.Millisecond), 3)
+
 type dhtQuery struct {
 	dht         *IpfsDHT
 	key         key.Key   // the key we're querying for
@@ -63,6 +69,11 @@ func (q *dhtQuery) Run(ctx context.Context, peers []peer.ID) (*dhtQueryResult, e
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	start := time.Now()
+	defer func() {
+		queryLatency.RecordValue(int64(time.Since(start) / time.Millisecond))
+	}()
+
 	runner := newQueryRunner(q)
 	return runner.Run(ctx, peers)
 }
@@ -157,6 +157,10 @@ func (dht *IpfsDHT) Provide(ctx context.Context, key key.Key) error {
 		wg.Add(1)
 		go func(p peer.ID) {
 			defer wg.Done()
+			notif.PublishQueryEvent(ctx, &notif.QueryEvent{
+				Type: notif.FinalPeer,
+				ID:   p,
+			})
 			log.Debugf("putProvider(%s, %s)", key, p)
 			err := dht.putProvider(ctx, p, string(key))
 			if err != nil {
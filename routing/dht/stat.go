@@ -0,0 +1,20 @@
+package dht
+
+// Stat holds the sizes of the tables the DHT keeps.
+type Stat struct {
+	// RoutingTableSize is the number of peers in the routing table.
+	RoutingTableSize int
+	// ProviderKeys is the number of keys providers are known for.
+	ProviderKeys int
+	// LocalProviderKeys is the number of keys the node provides itself.
+	LocalProviderKeys int
+}
+
+// Stat returns the sizes of the tables of the DHT.
+func (dht *IpfsDHT) Stat() *Stat {
+	return &Stat{
+		RoutingTableSize:  dht.routingTable.Size(),
+		ProviderKeys:      dht.providers.Count(),
+		LocalProviderKeys: len(dht.providers.GetLocal()),
+	}
+}
@@ -31,6 +31,11 @@ type RoutingTable struct {
 	// kBuckets define all the fingers to other nodes.
 	Buckets    []*Bucket
 	bucketsize int
+
+	// PeerAdded and PeerRemoved are called when peers enter and leave the
+	// table, with the table locked.
+	PeerAdded   func(peer.ID)
+	PeerRemoved func(peer.ID)
 }
 
 // NewRoutingTable creates a new routing table with a given bucketsize, local ID, and latency tolerance.
@@ -41,6 +46,8 @@ func NewRoutingTable(bucketsize int, localID ID, latency time.Duration, m peer.M
 	rt.local = localID
 	rt.maxLatency = latency
 	rt.metrics = m
+	rt.PeerAdded = func(peer.ID) {}
+	rt.PeerRemoved = func(peer.ID) {}
 	return rt
 }
 
@@ -73,6 +80,7 @@ func (rt *RoutingTable) Update(p peer.ID) {
 
 	// New peer, add to bucket
 	bucket.PushFront(p)
+	rt.PeerAdded(p)
 
 	// Are we past the max bucket size?
 	if bucket.Len() > rt.bucketsize {
@@ -83,7 +91,7 @@ func (rt *RoutingTable) Update(p peer.ID) {
 			return
 		} else {
 			// If the bucket cant split kick out least active node
-			bucket.PopBack()
+			rt.PeerRemoved(bucket.PopBack())
 			return
 		}
 	}
@@ -103,7 +111,10 @@ func (rt *RoutingTable) Remove(p peer.ID) {
 	}
 
 	bucket := rt.Buckets[bucketID]
-	bucket.Remove(p)
+	if bucket.Has(p) {
+		bucket.Remove(p)
+		rt.PeerRemoved(p)
+	}
 }
 
 func (rt *RoutingTable) nextBucket() peer.ID {
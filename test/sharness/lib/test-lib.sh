@@ -191,10 +191,13 @@ test_config_ipfs_gateway_writable() {
 	'
 }
 
+# test_launch_ipfs_daemon passes its arguments on to 'ipfs daemon'.
 test_launch_ipfs_daemon() {
 
+	args="$@"
+
 	test_expect_success "'ipfs daemon' succeeds" '
-		ipfs daemon >actual_daemon 2>daemon_err &
+		ipfs daemon $args >actual_daemon 2>daemon_err &
 	'
 
 	# we say the daemon is ready when the API server is ready.
@@ -65,9 +65,43 @@ test_init_ipfs
 # should work offline
 test_config_cmd
 
+test_expect_success "ipfs config profile apply --dry-run lists the changes" '
+  ipfs config Reprovider.Interval >before &&
+  ipfs config profile apply --dry-run lowpower >actual &&
+  grep "^+ ConnMgr.HighWater: 40$" actual &&
+  grep "^+ Reprovider.Interval: \"24h\"$" actual &&
+  ipfs config Reprovider.Interval >after &&
+  test_cmp before after
+'
+
+test_expect_success "ipfs config profile apply changes the config" '
+  ipfs config profile apply lowpower &&
+  echo 40 >expected &&
+  ipfs config ConnMgr.HighWater >actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "ipfs config profile apply of an unknown profile fails" '
+  test_must_fail ipfs config profile apply nope
+'
+
 # should work online
 test_launch_ipfs_daemon
 test_config_cmd
+
+test_expect_success "ipfs config applies to the running daemon" '
+  ipfs config --json ConnMgr.HighWater 77 &&
+  ipfs swarm connmgr >actual &&
+  grep "High water: 77" actual
+'
+
+test_expect_success "ipfs config reload applies the edited config file" '
+  sed -i.bak "s/\"HighWater\": 77/\"HighWater\": 88/" "$IPFS_PATH/config" &&
+  ipfs config reload &&
+  ipfs swarm connmgr >actual &&
+  grep "High water: 88" actual
+'
+
 test_kill_ipfs_daemon
 
 
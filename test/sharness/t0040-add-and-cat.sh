@@ -272,6 +272,46 @@ test_expect_success "ipfs add -w output looks good" '
 	test_cmp expected actual
 '
 
+test_expect_success "ipfs add -w --stdin-name succeeds" '
+	echo "hello" | ipfs add -w --stdin-name=hello.txt >actual
+'
+
+test_expect_success "ipfs add -w --stdin-name output looks good" '
+	echo "added QmU5PLEGqjetW4RAmXgHpEFL7nVCL3vFnEyrCKUfRk4MSq/hello.txt hello.txt" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "ipfs add --stdin-name names the content" '
+	echo "hello" | ipfs add --stdin-name=hello.txt >actual &&
+	echo "added QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN hello.txt" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "ipfs add -w of stdin without a name fails" '
+	echo "hello" | test_must_fail ipfs add -w 2>err &&
+	grep "stdin-name" err
+'
+
+test_expect_success "ipfs add --stdin-name with a path fails" '
+	echo "hello" | test_must_fail ipfs add --stdin-name=a/b 2>err &&
+	grep "not a path" err
+'
+
+test_expect_success "ipfs cat of an unavailable hash times out" '
+	test_expect_code 1 ipfs cat --timeout=1s QmaRGe7bVmVaLmxbrMiVNXqW4pRNNp3xq7hFtyRKA3mtJL >actual 2>err &&
+	grep "context deadline exceeded" err
+'
+
+test_expect_success "ipfs get of an unavailable hash times out" '
+	test_expect_code 1 ipfs get --timeout=1s QmaRGe7bVmVaLmxbrMiVNXqW4pRNNp3xq7hFtyRKA3mtJL >actual 2>err &&
+	grep "context deadline exceeded" err
+'
+
+test_expect_success "ipfs cat with an invalid timeout fails" '
+	test_must_fail ipfs cat --timeout=soon "$HASH" 2>err &&
+	grep "invalid timeout" err
+'
+
 test_kill_ipfs_daemon
 
 test_done
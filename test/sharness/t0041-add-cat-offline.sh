@@ -53,4 +53,44 @@ test_expect_success "ipfs cat file fails" '
 	test_must_fail ipfs cat $(cat oh_hash)
 '
 
+test_expect_success "ipfs --offline cat succeeds" '
+	ipfs --offline cat $HASH > out_3 &&
+	test_cmp afile out_3
+'
+
+test_expect_success "ipfs --offline dht findprovs fails at once" '
+	test_must_fail ipfs --offline dht findprovs $HASH 2> dht_err &&
+	grep "online mode" dht_err
+'
+
+test_launch_ipfs_daemon --offline
+
+test_expect_success "the daemon says it is offline" '
+	grep "Daemon is offline" actual_daemon
+'
+
+test_expect_success "ipfs cat through the offline daemon succeeds" '
+	ipfs cat $HASH > out_4 &&
+	test_cmp afile out_4
+'
+
+test_expect_success "ipfs add through the offline daemon succeeds" '
+	echo "content added offline" > bfile &&
+	ipfs add -q bfile > bhash &&
+	ipfs cat $(cat bhash) > out_5 &&
+	test_cmp bfile out_5
+'
+
+test_expect_success "ipfs swarm peers fails on the offline daemon" '
+	test_must_fail ipfs swarm peers 2> swarm_err &&
+	grep "online mode" swarm_err
+'
+
+test_expect_success "ipfs --offline fails while the daemon runs" '
+	test_must_fail ipfs --offline cat $HASH 2> offline_err &&
+	grep "ipfs daemon --offline" offline_err
+'
+
+test_kill_ipfs_daemon
+
 test_done
@@ -0,0 +1,52 @@
+#!/bin/sh
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the ignore rules of ipfs add"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "create the directory to add" '
+	mkdir -p mountdir/.git mountdir/build mountdir/sub/deep &&
+	echo "hello" >mountdir/hello.txt &&
+	echo "object" >mountdir/hello.o &&
+	echo "ref" >mountdir/.git/HEAD &&
+	echo "artifact" >mountdir/build/out &&
+	echo "secret" >mountdir/sub/secret &&
+	echo "secret" >mountdir/sub/.ipfsignore &&
+	echo "deep" >mountdir/sub/deep/deep.txt
+'
+
+test_add_ignore() {
+	test_expect_success "ipfs add $1 succeeds" '
+		ipfs add -r $1 mountdir >add_out &&
+		cut -d" " -f3 add_out | sort >actual
+	'
+
+	test_expect_success "ipfs add $1 leaves out the ignored files" '
+		printf "%s\n" $2 | sort >expected &&
+		test_cmp expected actual
+	'
+}
+
+test_add_ignore "" "mountdir mountdir/.git mountdir/.git/HEAD mountdir/build mountdir/build/out mountdir/hello.o mountdir/hello.txt mountdir/sub mountdir/sub/.ipfsignore mountdir/sub/deep mountdir/sub/deep/deep.txt"
+
+test_add_ignore "--ignore=*.o --ignore=.git/" "mountdir mountdir/build mountdir/build/out mountdir/hello.txt mountdir/sub mountdir/sub/.ipfsignore mountdir/sub/deep mountdir/sub/deep/deep.txt"
+
+test_expect_success "write the ignore rules file" '
+	echo "# build artifacts" >rules &&
+	echo "/build" >>rules &&
+	echo "*.o" >>rules
+'
+
+test_add_ignore "--ignore-rules-path=rules" "mountdir mountdir/.git mountdir/.git/HEAD mountdir/hello.txt mountdir/sub mountdir/sub/.ipfsignore mountdir/sub/deep mountdir/sub/deep/deep.txt"
+
+test_expect_success "ipfs add with an invalid rule fails" '
+	test_must_fail ipfs add -r --ignore="[" mountdir 2>err &&
+	grep "invalid ignore rule" err
+'
+
+test_done
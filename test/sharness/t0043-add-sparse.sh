@@ -0,0 +1,52 @@
+#!/bin/sh
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs add --sparse and the holes written by ipfs get"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "create a file with runs of zeros" '
+	{
+		random 5000 1 &&
+		dd if=/dev/zero bs=1048576 count=20 2>/dev/null &&
+		random 3000 2 &&
+		dd if=/dev/zero bs=1048576 count=4 2>/dev/null
+	} >disk.img
+'
+
+test_expect_success "ipfs add --sparse succeeds" '
+	SPARSE=$(ipfs add -q --sparse disk.img) &&
+	PLAIN=$(ipfs add -q disk.img)
+'
+
+test_expect_success "the sparse file gets another hash" '
+	test "$SPARSE" != "$PLAIN"
+'
+
+test_expect_success "the zeros of the sparse file are not stored" '
+	ipfs object stat "$SPARSE" >stat_out &&
+	SIZE=$(grep CumulativeSize stat_out | cut -d" " -f2) &&
+	test "$SIZE" -lt 100000
+'
+
+test_expect_success "ipfs cat gives the zeros back" '
+	ipfs cat "$SPARSE" >cat_out &&
+	test_cmp disk.img cat_out
+'
+
+test_expect_success "ipfs get --verify writes the file" '
+	ipfs get -o got.img --verify "$SPARSE" &&
+	test_cmp disk.img got.img
+'
+
+test_expect_success "ipfs get leaves holes for the zeros" '
+	ipfs get -o plain.img "$PLAIN" &&
+	test_cmp disk.img plain.img &&
+	test $(du -k plain.img | cut -f1) -lt 20000
+'
+
+test_done
@@ -0,0 +1,49 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test transactional adds"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "a directory with an unreadable file is set up" '
+	mkdir mydir &&
+	random 600000 1 >mydir/a &&
+	echo "unreadable" >mydir/b &&
+	chmod 000 mydir/b &&
+	ipfs refs local | sort >local_before
+'
+
+test_expect_success "a failed transactional add fails" '
+	test_must_fail ipfs add -r --transactional mydir
+'
+
+test_expect_success "it leaves no block behind" '
+	ipfs refs local | sort >local_after &&
+	test_cmp local_before local_after
+'
+
+test_expect_success "a transactional add succeeds" '
+	chmod 644 mydir/b &&
+	HASH=$(ipfs add -rq --transactional mydir | tail -n1) &&
+	ipfs pin ls --type=recursive >pins &&
+	grep "$HASH recursive" pins
+'
+
+test_expect_success "its blocks are kept by gc" '
+	ipfs repo gc &&
+	ipfs cat "$HASH/a" >actual &&
+	test_cmp mydir/a actual
+'
+
+test_expect_success "--transactional and --nocopy conflict" '
+	ipfs experiments enable Filestore &&
+	test_must_fail ipfs add --transactional --nocopy "$(pwd)/mydir/a" 2>err &&
+	grep "can.t be used with --nocopy" err
+'
+
+test_done
@@ -88,6 +88,22 @@ test_ls_cmd() {
 		EOF
 		test_cmp expected_ls_headers actual_ls_headers
 	'
+
+	test_expect_success "'ipfs ls --resolve-type=false' lists local entries alike" '
+		ipfs ls --resolve-type=false QmfNy183bXiRVyrhyWtq3TwHn79yHEkiAGFr18P7YNzESj >actual_ls_noresolve &&
+		ipfs ls QmfNy183bXiRVyrhyWtq3TwHn79yHEkiAGFr18P7YNzESj | tr -s " " >expected_ls_noresolve &&
+		test_cmp expected_ls_noresolve actual_ls_noresolve
+	'
+
+	test_expect_success "'ipfs ls --resolve-type=false' lists entries that are not local" '
+		cat <<-\EOF >missing.json &&
+			{"Data": "\u0008\u0001", "Links": [{"Name": "gone", "Hash": "QmTnXiAHv2eV3Nx1AwAuifoLFYXwY2HdHjB9atXCpXXXXX", "Size": 5}]}
+		EOF
+		MISSING_DIR=$(ipfs object put missing.json | cut -d" " -f2) &&
+		ipfs ls --resolve-type=false $MISSING_DIR >actual_ls_missing &&
+		echo "QmTnXiAHv2eV3Nx1AwAuifoLFYXwY2HdHjB9atXCpXXXXX 5 gone" >expected_ls_missing &&
+		test_cmp expected_ls_missing actual_ls_missing
+	'
 }
 
 # should work offline
@@ -0,0 +1,49 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs experiments"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "the experiments are disabled by default" '
+	ipfs experiments >list_out &&
+	grep "^Sharding   disabled" list_out &&
+	grep "^Filestore  disabled" list_out
+'
+
+test_expect_success "commands of a disabled experiment fail" '
+	mkdir dir &&
+	echo "hello" >dir/a &&
+	test_must_fail ipfs add -r --enable-sharding dir 2>shard_err &&
+	grep "ipfs experiments enable Sharding" shard_err &&
+	test_must_fail ipfs filestore ls 2>fs_err &&
+	grep "ipfs experiments enable Filestore" fs_err
+'
+
+test_expect_success "'ipfs experiments enable' enables them" '
+	ipfs experiments enable sharding &&
+	test "$(ipfs config Experiments.Sharding)" = "true" &&
+	ipfs add -r -q --enable-sharding dir
+'
+
+test_expect_success "'ipfs version --all' lists them" '
+	ipfs version --all >version_out &&
+	grep "Experiments.Sharding" version_out
+'
+
+test_expect_success "'ipfs experiments disable' disables them" '
+	ipfs experiments disable Sharding &&
+	test "$(ipfs config Experiments.Sharding)" = "false" &&
+	test_must_fail ipfs add -r --enable-sharding dir
+'
+
+test_expect_success "unknown experiments are refused" '
+	test_must_fail ipfs experiments enable nope
+'
+
+test_done
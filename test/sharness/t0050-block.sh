@@ -39,4 +39,34 @@ test_expect_success "'ipfs block get' output looks good" '
   test_cmp expected_stat actual_stat
 '
 
+test_expect_success "'ipfs block rm' succeeds" '
+	ipfs block rm $HASH >actual_rm &&
+	echo "removed $HASH" >expected_rm &&
+	test_cmp expected_rm actual_rm
+'
+
+test_expect_success "the block is gone from 'ipfs refs local'" '
+	ipfs refs local >refs_local &&
+	test_must_fail grep $HASH refs_local
+'
+
+test_expect_success "'ipfs block rm' of a missing block reports it" '
+	ipfs block rm $HASH >actual_rm &&
+	grep "cannot remove $HASH" actual_rm
+'
+
+test_expect_success "'ipfs block rm' leaves pinned blocks" '
+	echo "pinned block" >pinned &&
+	PINNED=$(ipfs add -q pinned) &&
+	ipfs block rm $PINNED >actual_rm &&
+	grep "pinned: use --force" actual_rm &&
+	ipfs block stat $PINNED
+'
+
+test_expect_success "'ipfs block rm --force' removes pinned blocks" '
+	ipfs block rm --force $PINNED >actual_rm &&
+	echo "removed $PINNED" >expected_rm &&
+	test_cmp expected_rm actual_rm
+'
+
 test_done
@@ -43,6 +43,13 @@ test_object_cmd() {
 		echo "CumulativeSize: 18" >> expected_stat &&
 		test_cmp expected_stat actual_stat
 	'
+
+	test_expect_success "'ipfs object stat --cumulative' counts the DAG" '
+		ipfs object stat --cumulative $HASH >actual_stat &&
+		echo "DagBlocks: 1" >> expected_stat &&
+		echo "DagSize: 18" >> expected_stat &&
+		test_cmp expected_stat actual_stat
+	'
 	
 	test_expect_success "'ipfs object put file.json' succeeds" '
 		ipfs object put  ../t0051-object-data/testPut.json > actual_putOut
@@ -131,6 +138,41 @@ test_object_cmd() {
 		echo QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn > rmlink_exp &&
 		test_cmp rmlink_exp rmlink_output
 	'
+
+	test_expect_success "add-link replaces a link of the same name" '
+		ipfs object patch $OUTPUT add-link foo $FILE > replaced &&
+		ipfs ls $(cat replaced) > replaced_links &&
+		echo "$FILE 20 foo" > replaced_exp &&
+		test_cmp replaced_exp replaced_links &&
+		ipfs cat $(cat replaced)/foo > replaced_out &&
+		test_cmp hwfile replaced_out
+	'
+
+	test_expect_success "rm-link removes links below the root" '
+		RMNESTED=$(ipfs object patch $(cat multi_patch) rm-link a/b/c) &&
+		ipfs ls $RMNESTED/a/b > rm_nested_out &&
+		test_must_be_empty rm_nested_out &&
+		ipfs ls $RMNESTED/a > rm_nested_out &&
+		grep " b/$" rm_nested_out
+	'
+
+	test_expect_success "add-link fails on missing directories" '
+		test_must_fail ipfs object patch $EMPTY add-link x/y/z $FILE
+	'
+
+	test_expect_success "add-link --create makes missing directories" '
+		CREATED=$(ipfs object patch --create $EMPTY add-link x/y/z $FILE) &&
+		ipfs cat $CREATED/x/y/z > created_out &&
+		test_cmp hwfile created_out
+	'
+
+	test_expect_success "set-data and append-data change the data" '
+		SET=$(ipfs object patch $EMPTY set-data foo) &&
+		APPENDED=$(echo bar | ipfs object patch /ipfs/$SET append-data) &&
+		ipfs object data $APPENDED > data_out &&
+		printf foobar > data_exp &&
+		test_cmp data_exp data_out
+	'
 }
 
 # should work offline
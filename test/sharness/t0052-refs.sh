@@ -0,0 +1,56 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test refs command"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+# root -b-> B -f-> F
+#      -x-> F
+#      -y-> B
+test_expect_success "setup a dag with shared objects" '
+	EMPTY=$(ipfs object new unixfs-dir) &&
+	F=$(echo leaf | ipfs add -q) &&
+	B=$(ipfs object patch $EMPTY add-link f $F) &&
+	R=$(ipfs object patch $EMPTY add-link b $B) &&
+	R=$(ipfs object patch $R add-link x $F) &&
+	R=$(ipfs object patch $R add-link y $B)
+'
+
+test_expect_success "'ipfs refs' lists the direct refs" '
+	printf "$B\n$F\n$B\n" >expected_direct &&
+	ipfs refs $R >actual_direct &&
+	test_cmp expected_direct actual_direct
+'
+
+test_expect_success "'ipfs refs -r' lists all refs" '
+	printf "$B\n$F\n$F\n$B\n$F\n" >expected_all &&
+	ipfs refs -r $R >actual_all &&
+	test_cmp expected_all actual_all
+'
+
+test_expect_success "'ipfs refs -r --unique' lists refs once" '
+	printf "$B\n$F\n" >expected_unique &&
+	ipfs refs -r --unique $R >actual_unique &&
+	test_cmp expected_unique actual_unique
+'
+
+test_expect_success "'ipfs refs -r --max-depth' stops at the depth" '
+	ipfs refs -r --max-depth=1 $R >actual_depth &&
+	test_cmp expected_direct actual_depth &&
+	ipfs refs -r --max-depth=2 $R >actual_depth &&
+	test_cmp expected_all actual_depth
+'
+
+test_expect_success "'ipfs refs --edges' lists edges" '
+	printf "$R -> $B\n$B -> $F\n" >expected_edges &&
+	ipfs refs -r -u --edges $R >actual_edges &&
+	test_cmp expected_edges actual_edges
+'
+
+test_done
@@ -0,0 +1,50 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs dag stat"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add a directory of the same file twice" '
+	mkdir dir &&
+	echo "hello" >dir/a &&
+	echo "hello" >dir/b &&
+	DIR=$(ipfs add -q -r dir | tail -n1) &&
+	FILE=$(ipfs add -q dir/a)
+'
+
+test_expect_success "'ipfs dag stat' counts each block once" '
+	ipfs dag stat $DIR >actual &&
+	grep "NumBlocks: 2" actual &&
+	DIRSIZE=$(ipfs block stat $DIR | grep Size | cut -d" " -f2) &&
+	FILESIZE=$(ipfs block stat $FILE | grep Size | cut -d" " -f2) &&
+	echo "Size: $(($DIRSIZE + $FILESIZE))" >expected_size &&
+	grep "Size: " actual | grep -v Num >actual_size &&
+	test_cmp expected_size actual_size
+'
+
+test_expect_success "'ipfs dag stat' takes paths" '
+	ipfs dag stat /ipfs/$DIR/a >actual &&
+	echo "NumBlocks: 1" >expected &&
+	echo "Size: $FILESIZE" >>expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs dag stat --progress' ends with the counts" '
+	ipfs dag stat --progress $DIR >actual &&
+	tail -n2 actual | tr -d "\r" >actual_tail &&
+	grep "NumBlocks: 2" actual_tail
+'
+
+test_expect_success "'ipfs dag stat' of a path within an object fails" '
+	KEY=$(echo "{\"a\": 1}" | ipfs dag put) &&
+	test_must_fail ipfs dag stat $KEY/a 2>err &&
+	grep "leads within an object" err
+'
+
+test_done
@@ -101,6 +101,30 @@ test_expect_success "'ipfs daemon' can be killed" '
   test_kill_repeat_10_sec $IPFS_PID
 '
 
+test_expect_success "'ipfs shutdown' fails without a daemon" '
+  test_must_fail ipfs shutdown 2>shutdown_err &&
+  grep "must run on the ipfs daemon" shutdown_err
+'
+
+test_expect_success "'ipfs daemon' launches again" '
+  ipfs daemon >actual_daemon 2>daemon_err &
+  IPFS_PID=$! &&
+  pollEndpoint -ep=/version -v -tout=1s -tries=60 2>poll_apierr >poll_apiout ||
+  test_fsh cat actual_daemon || test_fsh cat daemon_err || test_fsh cat poll_apierr || test_fsh cat poll_apiout
+'
+
+test_expect_success "'ipfs shutdown' stops the daemon" '
+  ipfs shutdown >shutdown_out &&
+  echo "Shut down the daemon" >expected_shutdown &&
+  test_cmp expected_shutdown shutdown_out &&
+  wait $IPFS_PID
+'
+
+test_expect_success "the daemon released the repo" '
+  test ! -e "$IPFS_PATH/repo.lock" &&
+  ipfs repo stat >/dev/null
+'
+
 test_expect_success "'ipfs daemon' should be able to run with a pipe attached to stdin (issue #861)" '
   yes | ipfs daemon --init >stdin_daemon_out 2>stdin_daemon_err &
   pollEndpoint -ep=/version -v -tout=1s -tries=10 >stdin_poll_apiout 2>stdin_poll_apierr &&
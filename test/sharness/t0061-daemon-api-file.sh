@@ -0,0 +1,54 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the api file of the daemon"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "commands run on the repo without a daemon" '
+	echo "hello" >afile &&
+	HASH=$(ipfs add -q afile) &&
+	test ! -e "$IPFS_PATH/api"
+'
+
+test_expect_success "a stale api file is left out" '
+	echo "/ip4/127.0.0.1/tcp/1" >"$IPFS_PATH/api" &&
+	ipfs cat "$HASH" >actual &&
+	test_cmp afile actual
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "the daemon writes its API address to the api file" '
+	echo "$ADDR_API" >expected_api &&
+	test_cmp expected_api "$IPFS_PATH/api"
+'
+
+test_expect_success "commands run through the daemon while it holds the repo" '
+	ipfs cat "$HASH" >actual &&
+	test_cmp afile actual &&
+	ipfs refs local >refs_out &&
+	grep "$HASH" refs_out &&
+	ipfs ls "$HASH"
+'
+
+test_expect_success "commands find the daemon by the api file" '
+	cp "$IPFS_PATH/config" config_bak &&
+	sed "s|$ADDR_API|/ip4/127.0.0.1/tcp/1|" config_bak >"$IPFS_PATH/config" &&
+	ipfs cat "$HASH" >actual &&
+	cp config_bak "$IPFS_PATH/config" &&
+	test_cmp afile actual
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "the daemon removes the api file when it stops" '
+	test ! -e "$IPFS_PATH/api"
+'
+
+test_done
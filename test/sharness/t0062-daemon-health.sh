@@ -0,0 +1,51 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the liveness and readiness endpoints of the daemon"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "the node has no peers to bootstrap to" '
+	ipfs bootstrap rm --all
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "the daemon is live" '
+	curl -sf "http://127.0.0.1:$PORT_API/livez" >actual &&
+	echo "ok" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "the daemon is ready" '
+	curl -sf "http://127.0.0.1:$PORT_API/readyz" >readyz &&
+	grep "\"Ready\":true" readyz
+'
+
+test_expect_success "the readiness lists each check" '
+	for c in repo swarm bootstrap api; do
+		grep "\"$c\":{\"OK\":true" readyz || return 1
+	done
+'
+
+test_expect_success "the endpoints don't need credentials" '
+	ipfs config --json API.Credentials "[{\"Token\": \"secret\", \"Scope\": \"admin\"}]" &&
+	ipfs config API.AnonymousScope none
+'
+
+test_kill_ipfs_daemon
+test_launch_ipfs_daemon
+
+test_expect_success "the daemon is ready to anonymous requests" '
+	curl -sf "http://127.0.0.1:$PORT_API/readyz" >readyz &&
+	grep "\"Ready\":true" readyz
+'
+
+test_kill_ipfs_daemon
+
+test_done
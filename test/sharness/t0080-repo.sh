@@ -149,4 +149,37 @@ test_expect_success "'ipfs pin ls --type=all --quiet' is correct" '
 
 test_kill_ipfs_daemon
 
+test_expect_success "'ipfs repo migrate --to=2' downgrades the repo" '
+	ipfs repo migrate --to=2 &&
+	echo 2 >expected &&
+	test_cmp expected "$IPFS_PATH/version"
+'
+
+test_expect_success "commands refuse to open the old repo" '
+	test_must_fail ipfs repo stat 2>migrate_err &&
+	grep "ipfs repo migrate" migrate_err
+'
+
+test_expect_success "'ipfs repo migrate' upgrades the repo" '
+	ipfs repo migrate >migrate_out &&
+	grep "2-to-3" migrate_out &&
+	test -f "$IPFS_PATH/backups/2-to-3/config" &&
+	ipfs repo stat
+'
+
+test_expect_success "'ipfs repo verify' finds no corrupt blocks" '
+	ipfs repo verify >verify_out &&
+	grep "blocks, 0 corrupt" verify_out
+'
+
+test_expect_success "'ipfs repo fsck' quarantines files in the way with --fix" '
+	mkdir -p "$IPFS_PATH/blocks/1220abcd" &&
+	echo junk >"$IPFS_PATH/blocks/1220abcd/put-123456" &&
+	ipfs repo fsck >fsck_out &&
+	grep "incomplete block write blocks/1220abcd/put-123456" fsck_out &&
+	ipfs repo fsck --fix >fsck_out &&
+	grep "quarantined 1" fsck_out &&
+	test -f "$IPFS_PATH/blocks/.quarantine/1220abcd-put-123456"
+'
+
 test_done
@@ -0,0 +1,60 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs pin remote"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs pin remote service ls' lists none at first" '
+	ipfs pin remote service ls >ls_out &&
+	test_must_be_empty ls_out
+'
+
+test_expect_success "'ipfs pin remote service add' saves services to the config" '
+	ipfs pin remote service add pinner https://pinning.example.com/api/v1 secret &&
+	ipfs pin remote service add other http://127.0.0.1:1/api other-secret &&
+	ipfs config Pinning.RemoteServices.pinner.Key >key_out &&
+	echo secret >expected &&
+	test_cmp expected key_out
+'
+
+test_expect_success "'ipfs pin remote service ls' lists them, without their keys" '
+	ipfs pin remote service ls >ls_out &&
+	printf "other http://127.0.0.1:1/api\npinner https://pinning.example.com/api/v1\n" >expected &&
+	test_cmp expected ls_out
+'
+
+test_expect_success "'ipfs pin remote service add' refuses taken names and bad endpoints" '
+	test_must_fail ipfs pin remote service add pinner https://elsewhere.example.com secret &&
+	test_must_fail ipfs pin remote service add third ftp://pinning.example.com secret
+'
+
+test_expect_success "'ipfs pin remote ls' needs a service picked among several" '
+	test_must_fail ipfs pin remote ls 2>err_out &&
+	grep -- "--service" err_out &&
+	test_must_fail ipfs pin remote ls --service=missing
+'
+
+test_expect_success "'ipfs pin remote ls' fails for an unreachable service" '
+	test_must_fail ipfs pin remote ls --service=other
+'
+
+test_expect_success "'ipfs pin remote ls' rejects unknown statuses" '
+	test_must_fail ipfs pin remote ls --service=other --status=lost 2>err_out &&
+	grep "unknown pin status" err_out
+'
+
+test_expect_success "'ipfs pin remote service rm' forgets services" '
+	ipfs pin remote service rm other &&
+	ipfs pin remote service ls >ls_out &&
+	echo "pinner https://pinning.example.com/api/v1" >expected &&
+	test_cmp expected ls_out &&
+	test_must_fail ipfs pin remote service rm other
+'
+
+test_done
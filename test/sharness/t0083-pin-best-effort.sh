@@ -0,0 +1,55 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test best-effort pins"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "pin an object best-effort" '
+	random 5000 1 >afile &&
+	HASH=$(ipfs add -q afile) &&
+	ipfs pin rm -r "$HASH" &&
+	ipfs pin add --type=best-effort "$HASH" >actual &&
+	echo "pinned $HASH best-effort" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "best-effort pins are listed" '
+	ipfs pin ls --type=best-effort >actual &&
+	echo "$HASH best-effort" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "best-effort and recursive pins conflict" '
+	test_must_fail ipfs pin add -r --type=best-effort "$HASH" 2>err &&
+	grep "conflicts with --type=best-effort" err
+'
+
+test_expect_success "gc keeps the object while space permits" '
+	ipfs repo gc &&
+	ipfs cat "$HASH" >actual &&
+	test_cmp afile actual
+'
+
+test_expect_success "gc short of space evicts the object" '
+	ipfs repo gc --target-free-bytes=1GB >gc_out &&
+	grep "removed $HASH" gc_out &&
+	ipfs pin ls --type=best-effort >actual &&
+	test_must_be_empty actual
+'
+
+test_expect_success "a best-effort pin can be removed" '
+	HASH=$(ipfs add -q afile) &&
+	ipfs pin rm -r "$HASH" &&
+	ipfs pin add --type=best-effort "$HASH" &&
+	ipfs pin rm "$HASH" &&
+	ipfs pin ls --type=best-effort >actual &&
+	test_must_be_empty actual
+'
+
+test_done
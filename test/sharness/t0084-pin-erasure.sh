@@ -0,0 +1,59 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test erasure coded pins"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "pin an object erasure coded" '
+	random 800000 1 >afile &&
+	HASH=$(ipfs add -q afile) &&
+	ipfs pin add --replication=2/3 "$HASH" >actual &&
+	MANIFEST=$(sed -n "s/.*manifest //p" actual) &&
+	echo "pinned $HASH recursively" >expected &&
+	echo "erasure coded $HASH, manifest $MANIFEST" >>expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "the manifest is pinned recursively" '
+	ipfs pin ls --name=erasure >actual &&
+	echo "$MANIFEST recursive erasure" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "invalid replications fail" '
+	test_must_fail ipfs pin add --replication=3 "$HASH" 2>err &&
+	grep "invalid replication" err &&
+	test_must_fail ipfs pin add --replication=3/3 "$HASH" &&
+	test_must_fail ipfs pin add --replication=2/3 --type=direct "$HASH" 2>err &&
+	grep "pins recursively only" err
+'
+
+test_expect_success "an intact pin needs no repair" '
+	ipfs pin repair "$HASH" >actual &&
+	echo "$HASH is intact" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "lost blocks are repaired" '
+	ipfs refs "$HASH" | head -2 >lost &&
+	ipfs block rm --force $(cat lost) &&
+	ipfs pin repair >actual &&
+	sed "s/^\(.*\)$/repaired \1 of $HASH/" lost >expected &&
+	test_cmp expected actual &&
+	ipfs cat "$HASH" >actual &&
+	test_cmp afile actual
+'
+
+test_expect_success "objects not erasure coded can't be repaired" '
+	echo other | ipfs add -q >other_hash &&
+	test_must_fail ipfs pin repair $(cat other_hash) 2>err &&
+	grep "not pinned with --replication" err
+'
+
+test_done
@@ -112,6 +112,32 @@ test_get_cmd() {
 	  test_cmp dir/b/c "$HASH2"/b/c &&
 	  rm -r "$HASH2"
 	'
+
+	test_expect_success "ipfs get --manifest succeeds (directory)" '
+	  ipfs get "$HASH2" --manifest=manifest.json >actual &&
+	  grep "Verified 2 file(s) against their hashes" actual &&
+	  grep "Saved manifest to manifest.json" actual
+	'
+
+	test_expect_success "ipfs get --manifest lists the files (directory)" '
+	  test_cmp dir/a "$HASH2"/a &&
+	  grep "\"Path\": \"$HASH2/a\"" manifest.json &&
+	  grep "\"Path\": \"$HASH2/b/c\"" manifest.json &&
+	  rm -r "$HASH2" manifest.json
+	'
+
+	test_expect_success "ipfs get --verify fails on a corrupt file" '
+	  ipfs get "$HASH2" &&
+	  echo "Hello, Worldz!" >"$HASH2"/b/c &&
+	  test_must_fail ipfs get "$HASH2" --continue --verify 2>err &&
+	  grep "$HASH2/b/c does not match" err &&
+	  rm -r "$HASH2"
+	'
+
+	test_expect_success "ipfs get --verify refuses archives" '
+	  test_must_fail ipfs get "$HASH2" -a --verify 2>err &&
+	  grep -- "--verify and --manifest can.t be used with --archive" err
+	'
 }
 
 # should work offline
@@ -64,4 +64,66 @@ test_expect_success "publish with our explicit node ID looks good" '
 	test_cmp expected_node_id_publish actual_node_id_publish
 '
 
+# publish with a lifetime and ttl
+
+test_expect_success "'ipfs name publish --lifetime --ttl' succeeds" '
+	ipfs name publish --lifetime=2h --ttl=10m "/ipfs/$HASH_WELCOME_DOCS" >actual_ttl_publish &&
+	test_cmp expected_node_id_publish actual_ttl_publish
+'
+
+test_expect_success "the record carries the ttl" '
+	ipfs name inspect "${PEERID}" >inspect_out &&
+	grep "^TTL: 10m0s$" inspect_out
+'
+
+test_expect_success "a record with a ttl resolves from the cache" '
+	ipfs name resolve "${PEERID}" >output &&
+	printf "/ipfs/%s" "$HASH_WELCOME_DOCS" >expected_ttl &&
+	test_cmp expected_ttl output
+'
+
+test_expect_success "'ipfs name resolve --nocache' succeeds" '
+	ipfs name resolve --nocache "${PEERID}" >output &&
+	test_cmp expected_ttl output
+'
+
+test_expect_success "'ipfs name publish' rejects bad durations" '
+	test_must_fail ipfs name publish --lifetime=forever "/ipfs/$HASH_WELCOME_DOCS" &&
+	test_must_fail ipfs name publish --ttl=-1m "/ipfs/$HASH_WELCOME_DOCS"
+'
+
+test_expect_success "'ipfs name publish --key' fails for a missing key" '
+	test_must_fail ipfs name publish --key=missing "/ipfs/$HASH_WELCOME_DOCS"
+'
+
+# resolve a name pointing to another
+
+test_expect_success "'ipfs name publish --key' publishes a name to another" '
+	ipfs key gen --type=ed25519 chainkey >gen_out &&
+	CHAINID=`cut -d" " -f1 gen_out` &&
+	ipfs name publish --key=chainkey "/ipns/${PEERID}" >publish_out
+'
+
+test_expect_success "'ipfs name resolve -r --steps' prints each value" '
+	ipfs name resolve -r --steps "${CHAINID}" >output &&
+	printf "/ipns/%s\n/ipfs/%s\n" "$PEERID" "$HASH_WELCOME_DOCS" >expected_steps &&
+	test_cmp expected_steps output
+'
+
+test_expect_success "'ipfs name resolve -r' prints the last value only" '
+	ipfs name resolve -r "${CHAINID}" >output &&
+	test_cmp expected_ttl output
+'
+
+test_expect_success "'ipfs name resolve --depth' limits the names resolved through" '
+	test_must_fail ipfs name resolve --depth=1 "${CHAINID}" &&
+	ipfs name resolve --depth=2 "${CHAINID}" >output &&
+	test_cmp expected_ttl output
+'
+
+test_expect_success "'ipfs name resolve --stream' rejects bad intervals" '
+	test_must_fail ipfs name resolve --stream --interval=soon "${CHAINID}" &&
+	test_must_fail ipfs name resolve --stream --interval=-1s "${CHAINID}"
+'
+
 test_done
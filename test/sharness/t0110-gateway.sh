@@ -49,6 +49,23 @@ test_expect_success "GET IPFS directory file output looks good" '
   test_cmp dir/test actual
 '
 
+test_expect_success "GET IPFS directory without a slash redirects" '
+  test_curl_resp_http_code "http://127.0.0.1:$port/ipfs/$HASH2" "HTTP/1.1 302 Found"
+'
+
+test_expect_success "GET IPFS directory lists it" '
+  curl -sfo actual "http://127.0.0.1:$port/ipfs/$HASH2/" &&
+  grep "Index of /ipfs/$HASH2/" actual &&
+  grep "<a href=\"test\">test</a>" actual
+'
+
+test_expect_success "GET IPFS directory serves its index.html" '
+  echo "<html>index</html>" >dir/index.html &&
+  HASH3=$(ipfs add -r -q dir | tail -n 1) &&
+  curl -sfo actual "http://127.0.0.1:$port/ipfs/$HASH3/" &&
+  test_cmp dir/index.html actual
+'
+
 test_expect_failure "GET IPNS path succeeds" '
   ipfs name publish "$HASH" &&
   NAME=$(ipfs config Identity.PeerID) &&
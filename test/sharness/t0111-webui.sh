@@ -0,0 +1,56 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the webui served by the API"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add a webui of one's own" '
+  mkdir webui &&
+  echo "<h1>dashboard</h1>" >webui/index.html &&
+  WEBUI=$(ipfs add -q -r webui | tail -n1) &&
+  ipfs pin rm -r $WEBUI &&
+  ipfs config API.WebUI $WEBUI
+'
+
+test_launch_ipfs_daemon
+
+apiport=$PORT_API
+
+test_expect_success "GET /webui/ redirects to the webui of the config" '
+  curl -si "http://127.0.0.1:$apiport/webui/" >webui_resp &&
+  grep "HTTP/1.1 302 Found" webui_resp &&
+  grep "Location: /ipfs/$WEBUI" webui_resp
+'
+
+test_expect_success "the API serves the webui of the config" '
+  curl -sf "http://127.0.0.1:$apiport/ipfs/$WEBUI/index.html" >actual &&
+  test_cmp webui/index.html actual
+'
+
+test_expect_success "the API does not serve other paths" '
+  OTHER=$(echo "not the webui" | ipfs add -q) &&
+  test_curl_resp_http_code "http://127.0.0.1:$apiport/ipfs/$OTHER" "HTTP/1.1 403 Forbidden"
+'
+
+test_expect_success "the webui gets pinned once visited" '
+  sleep 1 &&
+  ipfs pin ls --type=recursive >pins &&
+  grep "$WEBUI" pins
+'
+
+test_expect_success "the API allows the requests of the webui origin" '
+  curl -si -X OPTIONS -H "Origin: http://localhost:$apiport" \
+    -H "Access-Control-Request-Method: POST" \
+    "http://127.0.0.1:$apiport/api/v0/swarm/peers" >cors_resp &&
+  grep "Access-Control-Allow-Origin: http://localhost:$apiport" cors_resp
+'
+
+test_kill_ipfs_daemon
+
+test_done
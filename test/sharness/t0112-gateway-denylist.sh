@@ -0,0 +1,100 @@
+#!/bin/sh
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the denylist of the gateway"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add the content to deny" '
+  mkdir dir &&
+  echo "denied" >dir/denied &&
+  echo "allowed" >dir/allowed &&
+  DIR=$(ipfs add -r -q dir | tail -n 1) &&
+  DENIED=$(ipfs add -q dir/denied)
+'
+
+test_expect_success "'ipfs denylist add' succeeds" '
+  ipfs denylist add "/ipfs/$DENIED" >actual &&
+  echo "$DENIED" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "'ipfs denylist add' saves to the config" '
+  ipfs config Denylist.Entries >actual &&
+  grep "$DENIED" actual
+'
+
+test_expect_success "'ipfs denylist add' fails on an invalid entry" '
+  test_must_fail ipfs denylist add /foo/bar 2>err &&
+  grep "invalid denylist entry" err
+'
+
+test_expect_success "denylist file is read" '
+  echo "# more entries" >denylist &&
+  echo "/ipfs/$DIR/sub/" >>denylist &&
+  ipfs config Denylist.File "$(pwd)/denylist"
+'
+
+test_config_ipfs_gateway_readonly $ADDR_GWAY
+test_launch_ipfs_daemon
+
+port=$PORT_GWAY
+
+test_expect_success "'ipfs denylist' lists the entries" '
+  printf "%s\n" "$DENIED" "/ipfs/$DIR/sub" | sort >expected &&
+  ipfs denylist >actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "GET denied hash is gone" '
+  test_curl_resp_http_code "http://127.0.0.1:$port/ipfs/$DENIED" "HTTP/1.1 410 Gone"
+'
+
+test_expect_success "GET path resolving to a denied hash is gone" '
+  test_curl_resp_http_code "http://127.0.0.1:$port/ipfs/$DIR/denied" "HTTP/1.1 410 Gone"
+'
+
+test_expect_success "GET allowed path succeeds" '
+  curl -sfo actual "http://127.0.0.1:$port/ipfs/$DIR/allowed" &&
+  test_cmp dir/allowed actual
+'
+
+test_expect_success "GET path under a denied prefix is gone" '
+  test_curl_resp_http_code "http://127.0.0.1:$port/ipfs/$DIR/sub/file" "HTTP/1.1 410 Gone"
+'
+
+test_expect_success "'ipfs denylist log' shows the denied requests" '
+  ipfs denylist log >actual &&
+  test_line_count = 3 actual &&
+  grep "gateway /ipfs/$DENIED ($DENIED)" actual &&
+  grep "gateway /ipfs/$DIR/sub/file (/ipfs/$DIR/sub)" actual
+'
+
+test_expect_success "'ipfs denylist rm' succeeds" '
+  ipfs denylist rm "$DENIED" >actual &&
+  echo "$DENIED" >expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "GET hash removed from the denylist succeeds" '
+  curl -sfo actual "http://127.0.0.1:$port/ipfs/$DENIED" &&
+  test_cmp dir/denied actual
+'
+
+test_expect_success "'ipfs denylist rm' fails on an entry not denied" '
+  test_must_fail ipfs denylist rm "$DENIED" 2>err &&
+  grep "is not denied" err
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "'ipfs denylist rm' removes from the config" '
+  ipfs config Denylist >actual &&
+  test_must_fail grep "$DENIED" actual
+'
+
+test_done
@@ -122,9 +122,57 @@ test_bootstrap_cmd() {
 # should work offline
 test_bootstrap_cmd
 
+test_expect_success "'ipfs bootstrap list --pnet' fails without a swarm.key" '
+  test_must_fail ipfs bootstrap list --pnet 2>pnet_err &&
+  grep "no swarm.key" pnet_err
+'
+
+test_expect_success "a swarm.key is added to the repo" '
+  printf "/key/swarm/psk/1.0.0/\n/base16/\n%s\n" \
+    0000000000000000000000000000000000000000000000000000000000000000 >"$IPFS_PATH/swarm.key"
+'
+
+test_expect_success "'ipfs bootstrap add --pnet' succeeds" '
+  ipfs bootstrap add --pnet "$BP2" >pnet_add_actual &&
+  echo "$BP2" >pnet_add_expected &&
+  test_cmp pnet_add_expected pnet_add_actual
+'
+
+test_expect_success "'ipfs bootstrap list --pnet' shows the private list only" '
+  ipfs bootstrap list --pnet >pnet_list_actual &&
+  test_cmp pnet_add_expected pnet_list_actual &&
+  ipfs bootstrap list >pub_list_actual &&
+  test_must_be_empty pub_list_actual
+'
+
+test_expect_success "'ipfs bootstrap add --pnet --default' fails" '
+  test_must_fail ipfs bootstrap add --pnet --default
+'
+
+test_expect_success "'ipfs bootstrap rm --pnet --all' succeeds" '
+  ipfs bootstrap rm --pnet --all >pnet_rm_actual &&
+  test_cmp pnet_add_expected pnet_rm_actual &&
+  ipfs bootstrap list --pnet >pnet_list_actual &&
+  test_must_be_empty pnet_list_actual
+'
+
+test_expect_success "the swarm.key is removed" '
+  rm "$IPFS_PATH/swarm.key"
+'
+
+test_expect_success "'ipfs bootstrap check' fails offline" '
+  test_must_fail ipfs bootstrap check "$BP1"
+'
+
 # should work online
 test_launch_ipfs_daemon
 test_bootstrap_cmd
+
+test_expect_success "'ipfs bootstrap check' reports an unreachable peer" '
+  ipfs bootstrap check --timeout=2s /ip4/127.0.0.1/tcp/1/ipfs/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ >check_out &&
+  grep "unreachable" check_out
+'
+
 test_kill_ipfs_daemon
 
 
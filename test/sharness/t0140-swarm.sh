@@ -0,0 +1,105 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs swarm filters and connmgr"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs swarm addrs saved' lists none at first" '
+	ipfs swarm addrs saved >saved_out &&
+	test_must_be_empty saved_out
+'
+
+test_expect_success "the config limits the peers remembered" '
+	echo 24h >expected &&
+	ipfs config Peerstore.TTL >ttl_out &&
+	test_cmp expected ttl_out
+'
+
+test_expect_success "NAT port mapping can be turned off" '
+	ipfs config --bool Swarm.DisableNatPortMap true &&
+	echo true >expected &&
+	ipfs config Swarm.DisableNatPortMap >nat_out &&
+	test_cmp expected nat_out
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs id' reports an unknown reachability before peers dial back" '
+	echo unknown >expected &&
+	ipfs id -f="<reach>" >reach_out &&
+	test_cmp expected reach_out
+'
+
+test_expect_success "'ipfs swarm addrs listen' lists the loopback address listened on" '
+	ipfs swarm addrs listen >listen_out &&
+	grep "^/ip4/127.0.0.1/tcp/" listen_out
+'
+
+test_expect_success "'ipfs swarm filters' lists none at first" '
+	ipfs swarm filters >filters_out &&
+	test_must_be_empty filters_out
+'
+
+test_expect_success "'ipfs swarm filters add' adds filters" '
+	ipfs swarm filters add /ip4/10.0.0.0/ipcidr/8 /ip4/192.168.0.0/ipcidr/16 >add_out &&
+	printf "/ip4/10.0.0.0/ipcidr/8\n/ip4/192.168.0.0/ipcidr/16\n" >expected &&
+	test_cmp expected add_out &&
+	ipfs swarm filters >filters_out &&
+	test_cmp expected filters_out
+'
+
+test_expect_success "'ipfs swarm filters add' saves them to the config" '
+	ipfs config DialBlocklist >config_out &&
+	grep "/ip4/10.0.0.0/ipcidr/8" config_out &&
+	grep "/ip4/192.168.0.0/ipcidr/16" config_out
+'
+
+test_expect_success "'ipfs swarm filters add' refuses bad filters" '
+	test_must_fail ipfs swarm filters add /ip4/10.0.0.0
+'
+
+test_expect_success "'ipfs swarm filters rm' removes filters" '
+	ipfs swarm filters rm /ip4/10.0.0.0/ipcidr/8 &&
+	echo /ip4/192.168.0.0/ipcidr/16 >expected &&
+	ipfs swarm filters >filters_out &&
+	test_cmp expected filters_out &&
+	ipfs config DialBlocklist >config_out &&
+	test_must_fail grep "/ip4/10.0.0.0/ipcidr/8" config_out
+'
+
+test_expect_success "'ipfs swarm filters rm' fails on unfiltered ranges" '
+	test_must_fail ipfs swarm filters rm /ip4/10.0.0.0/ipcidr/8
+'
+
+test_kill_ipfs_daemon
+
+test_launch_ipfs_daemon
+
+test_expect_success "the filters in the config are applied on start" '
+	echo /ip4/192.168.0.0/ipcidr/16 >expected &&
+	ipfs swarm filters >filters_out &&
+	test_cmp expected filters_out
+'
+
+test_expect_success "'ipfs swarm connmgr' shows the limits of the config" '
+	ipfs swarm connmgr >connmgr_out &&
+	grep "Low water: 600" connmgr_out &&
+	grep "High water: 900" connmgr_out &&
+	grep "Grace period: 20s" connmgr_out
+'
+
+test_expect_success "'ipfs swarm connmgr trim' keeps the conns under the low water mark" '
+	ipfs swarm connmgr peers &&
+	ipfs swarm connmgr trim >trim_out &&
+	grep "^closed 0 connections" trim_out
+'
+
+test_kill_ipfs_daemon
+
+test_done
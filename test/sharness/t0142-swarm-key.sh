@@ -0,0 +1,42 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test private networks with a swarm.key"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "a swarm.key can be written to the repo" '
+	printf "/key/swarm/psk/1.0.0/\n/base16/\n%s\n" \
+		000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f \
+		>"$IPFS_PATH/swarm.key"
+'
+
+test_expect_success "'ipfs daemon' refuses a swarm.key with public bootstrap peers" '
+	ipfs bootstrap add --default >/dev/null &&
+	test_must_fail ipfs daemon >daemon_out 2>&1 &&
+	grep "swarm.key" daemon_out &&
+	ipfs bootstrap rm --all >/dev/null
+'
+
+test_expect_success "'ipfs daemon' refuses a malformed swarm.key" '
+	cp "$IPFS_PATH/swarm.key" swarm.key.good &&
+	printf "/key/swarm/psk/1.0.0/\n/base16/\n0001\n" >"$IPFS_PATH/swarm.key" &&
+	test_must_fail ipfs daemon >daemon_out 2>&1 &&
+	grep "swarm key: expected 32 bytes" daemon_out &&
+	mv swarm.key.good "$IPFS_PATH/swarm.key"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs daemon' reports the private network" '
+	grep "Swarm is limited to the private network" actual_daemon
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -0,0 +1,44 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs stats bw"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs stats bw' fails offline" '
+	test_must_fail ipfs stats bw
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs stats bw' prints the totals" '
+	ipfs stats bw >bw_out &&
+	grep "^TotalIn: " bw_out &&
+	grep "^RateOut: " bw_out
+'
+
+test_expect_success "'ipfs stats bw --peers' and '--protos' print tables" '
+	ipfs stats bw --peers >peers_out &&
+	grep "^Peer	Total Up" peers_out &&
+	ipfs stats bw --protos >protos_out &&
+	grep "^Protocol	Total Up" protos_out
+'
+
+test_expect_success "'ipfs stats bw' refuses more than one filter" '
+	test_must_fail ipfs stats bw --peers --protos
+'
+
+test_expect_success "the HTTP API serves the bandwidth as JSON" '
+	curl -sf "http://127.0.0.1:$PORT_API/api/v0/stats/bw?protos=true" >api_out &&
+	grep "\"TotalIn\":" api_out &&
+	grep "\"Protocols\":" api_out
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -0,0 +1,72 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs stats repo, bitswap and dht"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs stats repo' prints the size of the repo" '
+	ipfs stats repo >repo_out &&
+	grep "^NumObjects: " repo_out &&
+	grep "^RepoSize: " repo_out
+'
+
+test_expect_success "'ipfs stats bitswap' and 'ipfs stats dht' fail offline" '
+	test_must_fail ipfs stats bitswap &&
+	test_must_fail ipfs stats dht
+'
+
+test_expect_success "'ipfs stats repo' refuses a bad interval" '
+	test_must_fail ipfs stats repo --poll --interval=0s
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs stats bitswap' prints the ledger totals" '
+	ipfs stats bitswap >bitswap_out &&
+	grep "^ProvideQueue: " bitswap_out &&
+	grep "^LedgerSent: " bitswap_out
+'
+
+test_expect_success "'ipfs stats dht' prints the size of the tables" '
+	ipfs stats dht >dht_out &&
+	grep "^RoutingTableSize: " dht_out &&
+	grep "^ProviderKeys: " dht_out
+'
+
+test_expect_success "'ipfs stats dht --enc=json' prints JSON" '
+	ipfs stats dht --enc=json >dht_json &&
+	grep "\"RoutingTableSize\":" dht_json &&
+	grep "\"LocalProviderKeys\":" dht_json
+'
+
+test_expect_success "'ipfs stats repo --poll' prints the stats again" '
+	(ipfs stats repo --poll --interval=100ms >poll_out &) &&
+	sleep 1 &&
+	test $(grep -c "^NumObjects: " poll_out) -gt 1
+'
+
+test_expect_success "'ipfs stats paths' counts the paths resolved again" '
+	mkdir dir &&
+	echo "hello" >dir/file &&
+	DIR=$(ipfs add -r -q dir | tail -n1) &&
+	ipfs cat "/ipfs/$DIR/file" &&
+	ipfs cat "/ipfs/$DIR/file" &&
+	ipfs stats paths >paths_out &&
+	grep "^Hits: [1-9]" paths_out &&
+	grep "^HitRate: " paths_out
+'
+
+test_expect_success "the HTTP API serves the bitswap stats as JSON" '
+	curl -sf "http://127.0.0.1:$PORT_API/api/v0/stats/bitswap" >api_out &&
+	grep "\"Ledger\":" api_out
+'
+
+test_kill_ipfs_daemon
+
+test_done
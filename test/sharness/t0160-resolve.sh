@@ -0,0 +1,48 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs resolve"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "setup: add a directory" '
+	mkdir -p dir/sub &&
+	echo "hello" >dir/sub/file &&
+	DIR=$(ipfs add -r -q dir | tail -n1) &&
+	SUB=$(ipfs add -r -q dir/sub | tail -n1) &&
+	FILE=$(ipfs add -q dir/sub/file)
+'
+
+test_expect_success "'ipfs resolve' resolves the paths of a hash" '
+	ipfs resolve "/ipfs/$DIR/sub/file" >actual &&
+	echo "/ipfs/$FILE" >expected &&
+	test_cmp expected actual &&
+	ipfs resolve "/ipfs/$DIR/sub" >actual &&
+	echo "/ipfs/$SUB" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs resolve' takes bare hashes" '
+	ipfs resolve "$DIR" >actual &&
+	echo "/ipfs/$DIR" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs resolve' resolves paths into names" '
+	ipfs name publish "/ipfs/$DIR" &&
+	PEERID=$(ipfs id -f="<id>") &&
+	ipfs resolve -r "/ipns/$PEERID/sub/file" >actual &&
+	echo "/ipfs/$FILE" >expected &&
+	test_cmp expected actual
+'
+
+test_expect_success "'ipfs resolve' fails on missing links" '
+	test_must_fail ipfs resolve "/ipfs/$DIR/nope"
+'
+
+test_done
@@ -0,0 +1,79 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs key operations"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs key gen' makes an ed25519 key" '
+	ipfs key gen --type=ed25519 edkey >gen_out &&
+	EDID=`cut -d" " -f1 gen_out` &&
+	echo "$EDID edkey" >expected &&
+	test_cmp expected gen_out
+'
+
+test_expect_success "'ipfs key gen' makes an rsa key" '
+	ipfs key gen --size=1024 rsakey >gen_out &&
+	RSAID=`cut -d" " -f1 gen_out`
+'
+
+test_expect_success "'ipfs key gen' refuses taken and reserved names" '
+	test_must_fail ipfs key gen --type=ed25519 edkey &&
+	test_must_fail ipfs key gen self &&
+	test_must_fail ipfs key gen --type=dsa other
+'
+
+test_expect_success "'ipfs key list -l' lists self first" '
+	PEERID=`ipfs id --format="<id>"` &&
+	ipfs key list -l >list_out &&
+	printf "%s self\n%s edkey\n%s rsakey\n" "$PEERID" "$EDID" "$RSAID" >expected &&
+	test_cmp expected list_out
+'
+
+test_expect_success "'ipfs key rename' keeps the key" '
+	ipfs key rename rsakey rsa2 >rename_out &&
+	echo "$RSAID: renamed rsakey to rsa2" >expected &&
+	test_cmp expected rename_out &&
+	test_must_fail ipfs key rename self other
+'
+
+test_expect_success "'ipfs key export' needs a passphrase" '
+	printf "" >emptyfile &&
+	test_must_fail ipfs key export edkey emptyfile
+'
+
+test_expect_success "'ipfs key export' and 'ipfs key rm' succeed" '
+	echo secret >passfile &&
+	ipfs key export edkey passfile >edkey.key &&
+	ipfs key rm edkey >rm_out &&
+	echo "removed $EDID edkey" >expected &&
+	test_cmp expected rm_out &&
+	test_must_fail ipfs key rm self
+'
+
+test_expect_success "'ipfs key import' refuses the wrong passphrase" '
+	echo wrong >wrongfile &&
+	test_must_fail ipfs key import edkey edkey.key wrongfile
+'
+
+test_expect_success "'ipfs key import' restores the key" '
+	ipfs key import edkey edkey.key <passfile >import_out &&
+	echo "$EDID edkey" >expected &&
+	test_cmp expected import_out
+'
+
+test_expect_success "'ipfs name publish --key' publishes to the key" '
+	ipfs name publish --key=edkey "/ipfs/$HASH_WELCOME_DOCS" >publish_out &&
+	echo "Published to $EDID: /ipfs/$HASH_WELCOME_DOCS" >expected &&
+	test_cmp expected publish_out &&
+	ipfs name resolve "$EDID" >resolve_out &&
+	printf "/ipfs/%s" "$HASH_WELCOME_DOCS" >expected &&
+	test_cmp expected resolve_out
+'
+
+test_done
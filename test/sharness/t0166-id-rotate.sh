@@ -0,0 +1,62 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test rotating the identity, and running as a key of the keystore"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs id rotate' needs a name for the old key" '
+	OLDID=`ipfs id --format="<id>"` &&
+	test_must_fail ipfs id rotate 2>err &&
+	grep "old-key-backup" err &&
+	test_must_fail ipfs id rotate --old-key-backup=self
+'
+
+test_expect_success "'ipfs id rotate' gives the node a new identity" '
+	ipfs id rotate --old-key-backup=old-self --type=ed25519 >rotate_out &&
+	NEWID=`ipfs id --format="<id>"` &&
+	test "$NEWID" != "$OLDID" &&
+	echo "rotated the identity from $OLDID to $NEWID, the old key is kept as old-self" >expected &&
+	test_cmp expected rotate_out
+'
+
+test_expect_success "the old key is kept in the keystore" '
+	ipfs key list -l >list_out &&
+	printf "%s self\n%s old-self\n" "$NEWID" "$OLDID" >expected &&
+	test_cmp expected list_out
+'
+
+test_expect_success "names can still be published with the old key" '
+	HASH=`echo "rotated" | ipfs add -q` &&
+	ipfs name publish --key=old-self "/ipfs/$HASH" >publish_out &&
+	grep "$OLDID" publish_out
+'
+
+test_expect_success "a key to run as is made" '
+	ipfs key gen --type=ed25519 tenant >gen_out &&
+	TENANTID=`cut -d" " -f1 gen_out`
+'
+
+test_launch_ipfs_daemon --identity=tenant
+
+test_expect_success "the daemon runs as the key given" '
+	test "`ipfs id --format="<id>"`" = "$TENANTID"
+'
+
+test_expect_success "the identity can't be rotated while the daemon runs" '
+	test_must_fail ipfs id rotate --old-key-backup=other
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "the daemon fails to run as a key it doesn't have" '
+	test_must_fail ipfs daemon --identity=nokey 2>err &&
+	grep "no key named \"nokey\"" err
+'
+
+test_done
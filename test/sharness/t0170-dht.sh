@@ -0,0 +1,32 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs dht commands"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs dht provide' refuses blocks it doesn't have" '
+	HASH=`echo "not added" | ipfs add -q --only-hash` &&
+	test_must_fail ipfs dht provide $HASH 2>provide_err &&
+	grep "not found locally" provide_err
+'
+
+test_expect_success "'ipfs dht provide' refuses bad keys" '
+	test_must_fail ipfs dht provide foo
+'
+
+test_expect_success "'ipfs dht provide' provides added blocks" '
+	HASH=`echo "added" | ipfs add -q` &&
+	ipfs dht provide $HASH
+'
+
+test_kill_ipfs_daemon
+
+test_done
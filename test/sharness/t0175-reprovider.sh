@@ -0,0 +1,41 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Jeromy Johnson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test reprovider strategies"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "reprovider config has defaults" '
+	ipfs config Reprovider.Interval > config_out &&
+	ipfs config Reprovider.Strategy >> config_out &&
+	printf "12h\nall\n" > config_exp &&
+	test_cmp config_exp config_out
+'
+
+test_expect_success "set an unknown strategy" '
+	ipfs config Reprovider.Strategy everything
+'
+
+test_expect_success "daemon refuses an unknown strategy" '
+	test_must_fail ipfs daemon > daemon_out 2> daemon_err &&
+	grep "config.Reprovider.Strategy" daemon_err
+'
+
+test_expect_success "set the roots strategy" '
+	ipfs config Reprovider.Strategy roots
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "ipfs bitswap reprovide succeeds" '
+	ipfs bitswap reprovide
+'
+
+test_kill_ipfs_daemon
+
+test_done
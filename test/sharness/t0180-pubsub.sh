@@ -0,0 +1,69 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs pubsub"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs pubsub' fails offline" '
+	test_must_fail ipfs pubsub ls
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs pubsub' fails unless enabled" '
+	test_must_fail ipfs pubsub ls 2>ls_err &&
+	grep -- "--enable-pubsub-experiment" ls_err
+'
+
+test_kill_ipfs_daemon
+
+test_launch_ipfs_daemon --enable-pubsub-experiment
+
+test_expect_success "'ipfs pubsub sub' subscribes" '
+	ipfs pubsub sub testtopic >sub_out &
+	SUB_PID=$! &&
+	for i in 1 2 3 4 5 6 7 8 9 10; do
+		ipfs pubsub ls >ls_out &&
+		grep testtopic ls_out >/dev/null && break
+		sleep 1
+	done &&
+	echo testtopic >expected &&
+	test_cmp expected ls_out
+'
+
+test_expect_success "'ipfs pubsub peers' lists no peers alone" '
+	ipfs pubsub peers testtopic >peers_out &&
+	test_must_be_empty peers_out
+'
+
+test_expect_success "'ipfs pubsub pub' reaches the subscriber" '
+	ipfs pubsub pub testtopic "hello
+" "world
+" &&
+	for i in 1 2 3 4 5 6 7 8 9 10; do
+		test $(wc -l <sub_out) -ge 2 && break
+		sleep 1
+	done &&
+	printf "hello\nworld\n" >expected &&
+	test_cmp expected sub_out
+'
+
+test_expect_success "the subscription ends with 'ipfs pubsub sub'" '
+	kill $SUB_PID &&
+	for i in 1 2 3 4 5 6 7 8 9 10; do
+		ipfs pubsub ls >ls_out &&
+		test_must_be_empty ls_out && break
+		sleep 1
+	done &&
+	test_must_be_empty ls_out
+'
+
+test_kill_ipfs_daemon
+
+test_done
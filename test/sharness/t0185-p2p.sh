@@ -0,0 +1,54 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs p2p listeners and forwards"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs p2p' fails offline" '
+	test_must_fail ipfs p2p ls
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs p2p listen' succeeds" '
+	ipfs p2p listen /x/test /ip4/127.0.0.1/tcp/10101 >listen_out &&
+	echo "/x/test -> /ip4/127.0.0.1/tcp/10101" >expected &&
+	test_cmp expected listen_out
+'
+
+test_expect_success "'ipfs p2p listen' refuses other protocols, and taken ones" '
+	test_must_fail ipfs p2p listen /ipfs/bitswap /ip4/127.0.0.1/tcp/10101 &&
+	test_must_fail ipfs p2p listen /x/test /ip4/127.0.0.1/tcp/10102
+'
+
+test_expect_success "'ipfs p2p dial' listens on the address given" '
+	PEERID=`ipfs id -f="<id>"` &&
+	ipfs p2p dial $PEERID /x/test /ip4/127.0.0.1/tcp/10103 >dial_out &&
+	echo /ip4/127.0.0.1/tcp/10103 >expected &&
+	test_cmp expected dial_out
+'
+
+test_expect_success "'ipfs p2p ls' lists the listener and forward" '
+	ipfs p2p ls >ls_out &&
+	echo "/x/test -> /ip4/127.0.0.1/tcp/10101" >expected &&
+	echo "/ip4/127.0.0.1/tcp/10103 -> /ipfs/$PEERID/x/test" >>expected &&
+	test_cmp expected ls_out
+'
+
+test_expect_success "'ipfs p2p close' closes them" '
+	ipfs p2p close /x/test &&
+	ipfs p2p close /ip4/127.0.0.1/tcp/10103 &&
+	test_must_fail ipfs p2p close /x/test &&
+	ipfs p2p ls >ls_out &&
+	test_must_be_empty ls_out
+'
+
+test_kill_ipfs_daemon
+
+test_done
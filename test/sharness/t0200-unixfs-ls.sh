@@ -85,6 +85,21 @@ test_ls_cmd() {
 		test_cmp expected_ls_file actual_ls_file
 	'
 
+	test_expect_success "'ipfs file ls --blocks <file hashes>' succeeds" '
+		random 600000 42 >big &&
+		BIG=$(ipfs add -q big) &&
+		ipfs file ls --blocks $BIG >actual_ls_blocks &&
+		ipfs file ls --blocks QmQNd6ubRXaNG6Prov8o6vk3bn6eWsj9FxLGrAVDUAGkGe >actual_ls_blocks_small
+	'
+
+	test_expect_success "'ipfs file ls --blocks <file hashes>' output looks good" '
+		echo "$BIG: 600000 bytes, 3 blocks" >expected_ls_blocks &&
+		ipfs refs $BIG | sed -e "s/\$/ 262144/" -e "3s/262144/75712/" >>expected_ls_blocks &&
+		test_cmp expected_ls_blocks actual_ls_blocks &&
+		echo "QmQNd6ubRXaNG6Prov8o6vk3bn6eWsj9FxLGrAVDUAGkGe: 128 bytes, 0 blocks" >expected_ls_blocks_small &&
+		test_cmp expected_ls_blocks_small actual_ls_blocks_small
+	'
+
 	test_expect_success "'ipfs file ls <duplicates>' succeeds" '
 		ipfs file ls /ipfs/QmfNy183bXiRVyrhyWtq3TwHn79yHEkiAGFr18P7YNzESj/d1 /ipfs/QmSix55yz8CzWXf5ZVM9vgEvijnEeeXiTSarVtsqiiCJss /ipfs/QmR3jhV4XpxxPjPT3Y8vNnWvWNvakdcT3H6vqpRBsX1MLy/1024 /ipfs/QmbQBUSRL9raZtNXfpTDeaxQapibJEG6qEY8WqAN22aUzd >actual_ls_duplicates_file
 	'
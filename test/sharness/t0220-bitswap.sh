@@ -0,0 +1,49 @@
+#!/bin/sh
+#
+# Copyright (c) 2015 The IPFS Authors
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test bitswap commands"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "set the fetches at once" '
+	ipfs config --json Bitswap.MaxConcurrentFetches 8
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs stats fetch' prints the fetches of blocks" '
+	ipfs stats fetch >fetch_out &&
+	grep "Fetching: 0/8" fetch_out &&
+	grep "Deduplicated: 0" fetch_out
+'
+
+test_expect_success "'ipfs bitswap stat' prints the received data" '
+	ipfs bitswap stat >stat_out &&
+	grep "blocks received: 0" stat_out &&
+	grep "dup data received: 0" stat_out
+'
+
+test_expect_success "'ipfs bitswap wantlist' is empty" '
+	ipfs bitswap wantlist >wantlist_out &&
+	test_must_be_empty wantlist_out
+'
+
+test_expect_success "'ipfs bitswap ledger' prints an empty ledger for a new peer" '
+	PEERID=`ipfs id -f="<id>"` &&
+	ipfs bitswap ledger $PEERID >ledger_out &&
+	grep "Ledger for $PEERID" ledger_out &&
+	grep "Exchanges:	0" ledger_out
+'
+
+test_expect_success "'ipfs bitswap ledger' refuses a bad peer ID" '
+	test_must_fail ipfs bitswap ledger foo
+'
+
+test_kill_ipfs_daemon
+
+test_done
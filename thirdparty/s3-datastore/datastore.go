@@ -1,22 +1,52 @@
+// package s3datastore keeps a datastore in an S3 bucket, or in a bucket of
+// any service speaking the S3 protocol.
 package s3datastore
 
 import (
+	"encoding/hex"
 	"errors"
+	"strings"
 
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/crowdmob/goamz/s3"
 	datastore "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
 	query "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+	goprocess "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/goprocess"
 )
 
 var _ datastore.ThreadSafeDatastore = &S3Datastore{}
 
-var errTODO = errors.New("TODO")
-
 var ErrInvalidType = errors.New("s3 datastore: invalid type error")
 
+// listPage is how many keys a query lists at once
+const listPage = 1000
+
+// S3Datastore keeps each value as an object of Bucket, named after its
+// key in hex, as keys needn't be valid UTF-8, with Prefix in front.
+// Several datastores can share a bucket under different prefixes.
+//
+// Deleting a key that isn't there succeeds, as S3 doesn't tell.
 type S3Datastore struct {
 	Client *s3.S3
 	Bucket string
+	Prefix string
+}
+
+func (ds *S3Datastore) bucket() *s3.Bucket {
+	return ds.Client.Bucket(ds.Bucket)
+}
+
+// path returns the name of the object keeping key.
+func (ds *S3Datastore) path(key datastore.Key) string {
+	return ds.prefix() + hex.EncodeToString(key.Bytes()[1:])
+}
+
+// prefix returns the prefix of the names of the datastore's objects.
+func (ds *S3Datastore) prefix() string {
+	p := strings.Trim(ds.Prefix, "/")
+	if p == "" {
+		return ""
+	}
+	return p + "/"
 }
 
 func (ds *S3Datastore) Put(key datastore.Key, value interface{}) (err error) {
@@ -24,24 +54,96 @@ func (ds *S3Datastore) Put(key datastore.Key, value interface{}) (err error) {
 	if !ok {
 		return ErrInvalidType
 	}
-	// TODO extract perms and s3 options
-	return ds.Client.Bucket(ds.Bucket).Put(key.String(), data, "application/protobuf", s3.PublicRead, s3.Options{})
+	return ds.bucket().Put(ds.path(key), data, "application/octet-stream", s3.Private, s3.Options{})
 }
 
 func (ds *S3Datastore) Get(key datastore.Key) (value interface{}, err error) {
-	return ds.Client.Bucket(ds.Bucket).Get(key.String())
+	data, err := ds.bucket().Get(ds.path(key))
+	if isNotFound(err) {
+		return nil, datastore.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
 func (ds *S3Datastore) Has(key datastore.Key) (exists bool, err error) {
-	return ds.Client.Bucket(ds.Bucket).Exists(key.String())
+	return ds.bucket().Exists(ds.path(key))
 }
 
 func (ds *S3Datastore) Delete(key datastore.Key) (err error) {
-	return ds.Client.Bucket(ds.Bucket).Del(key.String())
+	err = ds.bucket().Del(ds.path(key))
+	if isNotFound(err) {
+		return datastore.ErrNotFound
+	}
+	return err
 }
 
+// Query lists the objects under the prefix of the datastore and q's,
+// a page at a time, fetching their values unless q is KeysOnly. Filters,
+// orders, offset and limit are applied naively.
 func (ds *S3Datastore) Query(q query.Query) (query.Results, error) {
-	return nil, errors.New("TODO implement query for s3 datastore?")
+	strip := ds.prefix()
+	prefix := strip
+	if q.Prefix != "" && q.Prefix != "/" {
+		prefix = ds.path(datastore.NewKey(q.Prefix))
+	}
+
+	b := query.NewResultBuilder(q)
+	b.Process.Go(func(worker goprocess.Process) {
+		send := func(r query.Result) bool {
+			select {
+			case b.Output <- r:
+				return true
+			case <-worker.Closing():
+				return false
+			}
+		}
+
+		marker := ""
+		for {
+			resp, err := ds.bucket().List(prefix, "", marker, listPage)
+			if err != nil {
+				send(query.Result{Error: err})
+				return
+			}
+			for _, obj := range resp.Contents {
+				k, err := hex.DecodeString(strings.TrimPrefix(obj.Key, strip))
+				if err != nil {
+					// not one of ours
+					continue
+				}
+				e := query.Entry{Key: datastore.NewKey(string(k)).String()}
+				if !q.KeysOnly {
+					v, err := ds.bucket().Get(obj.Key)
+					if err != nil {
+						send(query.Result{Error: err})
+						return
+					}
+					e.Value = v
+				}
+				if !send(query.Result{Entry: e}) {
+					return
+				}
+			}
+			if !resp.IsTruncated {
+				return
+			}
+			marker = resp.NextMarker
+		}
+	})
+	go b.Process.CloseAfterChildren()
+
+	// the prefix is already taken care of
+	nq := q
+	nq.Prefix = ""
+	return query.NaiveQueryApply(nq, b.Results()), nil
 }
 
 func (ds *S3Datastore) IsThreadSafe() {}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*s3.Error)
+	return ok && e.StatusCode == 404
+}
@@ -0,0 +1,96 @@
+package s3datastore
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/crowdmob/goamz/aws"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/crowdmob/goamz/s3"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/crowdmob/goamz/s3/s3test"
+	datastore "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore"
+	query "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-datastore/query"
+	"github.com/ipfs/go-ipfs/thirdparty/assert"
+)
+
+func testDatastore(t *testing.T, prefix string) (*S3Datastore, func()) {
+	srv, err := s3test.NewServer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := s3.New(aws.Auth{AccessKey: "key", SecretKey: "secret"}, aws.Region{
+		Name:                 "test",
+		S3Endpoint:           srv.URL(),
+		S3LocationConstraint: true,
+	})
+	if err := client.Bucket("ipfs").PutBucket(s3.Private); err != nil {
+		t.Fatal(err)
+	}
+	return &S3Datastore{Client: client, Bucket: "ipfs", Prefix: prefix}, srv.Quit
+}
+
+func TestPutGetHasDelete(t *testing.T) {
+	ds, done := testDatastore(t, "")
+	defer done()
+
+	key, val := datastore.NewKey("foo"), []byte("bar")
+	_, err := ds.Get(key)
+	assert.True(err == datastore.ErrNotFound, t, "missing key should not be found")
+	has, err := ds.Has(key)
+	assert.Nil(err, t)
+	assert.False(has, t, "missing key should not be there")
+
+	assert.Nil(ds.Put(key, val), t)
+	v, err := ds.Get(key)
+	assert.Nil(err, t)
+	if !bytes.Equal(v.([]byte), val) {
+		t.Fatalf("got %q, expected %q", v, val)
+	}
+	has, err = ds.Has(key)
+	assert.Nil(err, t)
+	assert.True(has, t, "key should be there after Put")
+
+	assert.Nil(ds.Delete(key), t)
+	_, err = ds.Get(key)
+	assert.True(err == datastore.ErrNotFound, t, "deleted key should not be found")
+
+	assert.True(ds.Put(key, "bar") == ErrInvalidType, t, "only bytes can be put")
+}
+
+func TestQuery(t *testing.T) {
+	ds, done := testDatastore(t, "node/blocks/")
+	defer done()
+
+	// another datastore in the bucket, which the query must not see
+	other := &S3Datastore{Client: ds.Client, Bucket: ds.Bucket, Prefix: "node/blocksmore"}
+	assert.Nil(other.Put(datastore.NewKey("x"), []byte("x")), t)
+
+	// more than a page of keys
+	expect := make(map[string]string)
+	for i := 0; i < listPage+5; i++ {
+		k := fmt.Sprintf("/k%04d", i)
+		expect[k] = k
+		assert.Nil(ds.Put(datastore.NewKey(k), []byte(k)), t)
+	}
+
+	res, err := ds.Query(query.Query{})
+	assert.Nil(err, t)
+	entries, err := res.Rest()
+	assert.Nil(err, t)
+	if len(entries) != len(expect) {
+		t.Fatalf("query returned %d entries, expected %d", len(entries), len(expect))
+	}
+	for _, e := range entries {
+		if v, ok := e.Value.([]byte); !ok || expect[e.Key] != string(v) {
+			t.Fatalf("unexpected entry %s: %v", e.Key, e.Value)
+		}
+	}
+
+	res, err = ds.Query(query.Query{Prefix: "/k000", KeysOnly: true})
+	assert.Nil(err, t)
+	entries, err = res.Rest()
+	assert.Nil(err, t)
+	if len(entries) != 10 {
+		t.Fatalf("prefix query returned %d entries, expected 10", len(entries))
+	}
+}
@@ -2,25 +2,104 @@ package tar
 
 import (
 	"archive/tar"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	fp "path/filepath"
+	"strconv"
 	"strings"
 )
 
+// OffsetRecord marks a file entry holding only the bytes from the given
+// offset on. It matches OffsetRecord in unixfs/tar.
+const OffsetRecord = "IPFS.offset"
+
+// ErrorRecord marks an entry standing in for a path that could not be
+// fetched. It matches ErrorRecord in unixfs/tar.
+const ErrorRecord = "IPFS.error"
+
+// StatRecord marks an entry whose mode and mtime are to be restored. It
+// matches StatRecord in unixfs/tar.
+const StatRecord = "IPFS.stat"
+
+// BlocksRecord marks an entry listing the blocks of the file entry after
+// it. It matches BlocksRecord in unixfs/tar.
+const BlocksRecord = "IPFS.blocks"
+
 type Extractor struct {
 	Path string
+
+	// Resume continues a previous extraction into Path. Path is taken to
+	// be the extracted root itself, and entries with an OffsetRecord are
+	// written into the existing files at that offset.
+	Resume bool
+
+	// KeepRoot writes every entry to Path joined with its full name in the
+	// archive, creating Path if needed. This is how archives with several
+	// top-level entries are extracted, each into its own directory.
+	KeepRoot bool
+
+	// Sparse leaves the runs of zeros of the files out, seeking over them
+	// rather than writing them, so they are holes in the files written on
+	// filesystems which support them.
+	Sparse bool
+
+	// Progress, if set, is called as file data is written with the name
+	// of the file in the archive and the number of bytes just written.
+	Progress func(name string, n int64)
+
+	// PathError, if set, is called with the name and message of each
+	// entry carrying an ErrorRecord, in place of extracting it.
+	PathError func(name, msg string)
+
+	// Verify, if set, is called for each file written, hardlinks included,
+	// with its name in the archive, the path it was written to, and the
+	// hash and contents of the entry with a BlocksRecord before it. The
+	// extraction fails with its error, or if a file has no such entry.
+	Verify func(name, path, hash string, blocks []byte) error
+
+	// blocks is the last entry with a BlocksRecord read.
+	blocks *blockList
+
+	// written maps the names of the files extracted so far to their
+	// paths, for the hardlinks that refer back to them.
+	written map[string]string
+
+	// dirs are the directories whose mode and mtime are restored at the
+	// end of the extraction.
+	dirs []pendingStat
+
+	// root is the output directory, outside of which nothing is written.
+	root string
+}
+
+type blockList struct {
+	name string
+	hash string
+	data []byte
+}
+
+type pendingStat struct {
+	path string
+	h    *tar.Header
 }
 
 func (te *Extractor) Extract(reader io.Reader) error {
 	tarReader := tar.NewReader(reader)
+	te.root = fp.Clean(te.Path)
+	if te.KeepRoot {
+		return te.extractRoots(tarReader)
+	}
 
 	// Check if the output path already exists, so we know whether we should
 	// create our output with that name, or if we should put the output inside
 	// a preexisting directory
 	exists := true
 	pathIsDir := false
-	if stat, err := os.Stat(te.Path); err != nil && os.IsNotExist(err) {
+	if te.Resume {
+		exists = false
+	} else if stat, err := os.Stat(te.Path); err != nil && os.IsNotExist(err) {
 		exists = false
 	} else if err != nil {
 		return err
@@ -30,13 +109,16 @@ func (te *Extractor) Extract(reader io.Reader) error {
 
 	// files come recursively in order (i == 0 is root directory)
 	for i := 0; ; i++ {
-		header, err := tarReader.Next()
+		header, err := te.next(tarReader)
 		if err != nil && err != io.EOF {
 			return err
 		}
 		if header == nil || err == io.EOF {
 			break
 		}
+		if te.reportError(header) {
+			continue
+		}
 
 		if header.Typeflag == tar.TypeDir {
 			err = te.extractDir(header, i, exists)
@@ -51,7 +133,77 @@ func (te *Extractor) Extract(reader io.Reader) error {
 			return err
 		}
 	}
-	return nil
+	return te.restoreDirs()
+}
+
+// extractRoots extracts the archive in KeepRoot mode.
+func (te *Extractor) extractRoots(tarReader *tar.Reader) error {
+	if err := os.MkdirAll(te.Path, 0755); err != nil {
+		return err
+	}
+
+	for {
+		header, err := te.next(tarReader)
+		if err == io.EOF {
+			return te.restoreDirs()
+		}
+		if err != nil {
+			return err
+		}
+		if te.reportError(header) {
+			continue
+		}
+
+		path := fp.Join(te.Path, fp.FromSlash(header.Name))
+		if err := te.checkPath(header, path); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeDir {
+			err = te.makeDir(path, header)
+		} else {
+			err = te.writeFile(path, header, tarReader)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// next returns the next header of r, keeping the entries with a
+// BlocksRecord for the files after them rather than returning them.
+func (te *Extractor) next(r *tar.Reader) (*tar.Header, error) {
+	for {
+		h, err := r.Next()
+		if err != nil {
+			return h, err
+		}
+		hash, ok := h.PAXRecords[BlocksRecord]
+		if !ok {
+			return h, nil
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		te.blocks = &blockList{
+			name: strings.TrimSuffix(h.Name, ".blocks"),
+			hash: hash,
+			data: data,
+		}
+	}
+}
+
+// reportError passes an entry carrying an ErrorRecord to PathError, and
+// returns whether it was one.
+func (te *Extractor) reportError(h *tar.Header) bool {
+	msg, ok := h.PAXRecords[ErrorRecord]
+	if !ok {
+		return false
+	}
+	if te.PathError != nil {
+		te.PathError(strings.TrimSuffix(h.Name, ".error"), msg)
+	}
+	return true
 }
 
 func (te *Extractor) extractDir(h *tar.Header, depth int, exists bool) error {
@@ -61,19 +213,50 @@ func (te *Extractor) extractDir(h *tar.Header, depth int, exists bool) error {
 	}
 	path := fp.Join(pathElements...)
 	path = fp.Join(te.Path, path)
+	if err := te.checkPath(h, path); err != nil {
+		return err
+	}
 	if depth == 0 {
 		// if this is the root root directory, use it as the output path for remaining files
 		te.Path = path
 	}
 
-	err := os.MkdirAll(path, 0755)
-	if err != nil {
+	return te.makeDir(path, h)
+}
+
+// makeDir creates the directory of entry h at path. A recorded mode and
+// mtime are restored once the whole archive is extracted, as writing the
+// directory's contents would change them.
+func (te *Extractor) makeDir(path string, h *tar.Header) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
 		return err
 	}
+	if _, ok := h.PAXRecords[StatRecord]; ok {
+		te.dirs = append(te.dirs, pendingStat{path, h})
+	}
+	return nil
+}
 
+// restoreDirs restores the recorded modes and mtimes of the directories,
+// innermost first.
+func (te *Extractor) restoreDirs() error {
+	for i := len(te.dirs) - 1; i >= 0; i-- {
+		if err := restoreStat(te.dirs[i].path, te.dirs[i].h); err != nil {
+			return err
+		}
+	}
+	te.dirs = nil
 	return nil
 }
 
+// restoreStat sets the mode and mtime of path to those in h.
+func restoreStat(path string, h *tar.Header) error {
+	if err := os.Chmod(path, os.FileMode(h.Mode).Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(path, h.ModTime, h.ModTime)
+}
+
 func (te *Extractor) extractFile(h *tar.Header, r *tar.Reader, depth int, exists bool, pathIsDir bool) error {
 	var path string
 	if depth == 0 {
@@ -92,17 +275,268 @@ func (te *Extractor) extractFile(h *tar.Header, r *tar.Reader, depth int, exists
 		path = fp.Join(pathElements...)
 		path = fp.Join(te.Path, path)
 	}
+	if err := te.checkPath(h, path); err != nil {
+		return err
+	}
+
+	return te.writeFile(path, h, r)
+}
+
+// writeFile writes the file entry h to path, as writeEntry does, and
+// passes it to Verify.
+func (te *Extractor) writeFile(path string, h *tar.Header, r io.Reader) error {
+	if err := te.writeEntry(path, h, r); err != nil {
+		return err
+	}
+	if te.Verify == nil || h.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+
+	bl := te.blocks
+	te.blocks = nil
+	if bl == nil || bl.name != h.Name {
+		return fmt.Errorf("%s: the archive does not list its blocks", h.Name)
+	}
+	return te.Verify(h.Name, path, bl.hash, bl.data)
+}
 
+// writeEntry writes the data of the file entry h to path. Symlinks and
+// hardlinks are created as links, replacing whatever is at path.
+func (te *Extractor) writeEntry(path string, h *tar.Header, r io.Reader) error {
+	switch h.Typeflag {
+	case tar.TypeSymlink:
+		if err := te.checkLink(h, path); err != nil {
+			return err
+		}
+		if err := removeExisting(path); err != nil {
+			return err
+		}
+		return os.Symlink(h.Linkname, path)
+	case tar.TypeLink:
+		if err := te.checkLink(h, path); err != nil {
+			return err
+		}
+		target, ok := te.written[h.Linkname]
+		if !ok {
+			return fmt.Errorf("%s links to %s, which is not in the archive", h.Name, h.Linkname)
+		}
+		if err := removeExisting(path); err != nil {
+			return err
+		}
+		return os.Link(target, path)
+	}
+
+	if te.written == nil {
+		te.written = make(map[string]string)
+	}
+	te.written[h.Name] = path
+
+	var src io.Reader = r
+	if te.Progress != nil {
+		src = &progressReader{r: r, name: h.Name, progress: te.Progress}
+	}
+
+	var err error
+	if off, ok := h.PAXRecords[OffsetRecord]; ok {
+		err = appendFile(path, off, src, te.Sparse)
+	} else {
+		err = createFile(path, src, te.Sparse)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, ok := h.PAXRecords[StatRecord]; ok {
+		return restoreStat(path, h)
+	}
+	return nil
+}
+
+func createFile(path string, r io.Reader, sparse bool) error {
 	file, err := os.Create(path)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	_, err = io.Copy(file, r)
+	return copyFile(file, r, sparse)
+}
+
+// copyFile writes r into file from its current offset, leaving holes for
+// the runs of zeros if sparse.
+func copyFile(file *os.File, r io.Reader, sparse bool) error {
+	if !sparse {
+		_, err := io.Copy(file, r)
+		return err
+	}
+
+	if _, err := io.Copy(&sparseWriter{file}, r); err != nil {
+		return err
+	}
+	// the zeros skipped at the end are not written, so set the size.
+	end, err := file.Seek(0, os.SEEK_CUR)
 	if err != nil {
 		return err
 	}
+	return file.Truncate(end)
+}
+
+// holeSize is the size of the runs of zeros made holes, which is the size
+// of the blocks of most filesystems.
+const holeSize = 4096
+
+// sparseWriter writes to a file, seeking over the pieces of holeSize
+// zeros rather than writing them.
+type sparseWriter struct {
+	f *os.File
+}
+
+func (w *sparseWriter) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if isHole(p[n:]) {
+			if _, err := w.f.Seek(holeSize, os.SEEK_CUR); err != nil {
+				return n, err
+			}
+			n += holeSize
+			continue
+		}
+
+		start := n
+		for n < len(p) && !isHole(p[n:]) {
+			n += holeSize
+		}
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := w.f.Write(p[start:n]); err != nil {
+			return start, err
+		}
+	}
+	return len(p), nil
+}
+
+// isHole returns whether p starts with holeSize zeros.
+func isHole(p []byte) bool {
+	if len(p) < holeSize {
+		return false
+	}
+	for _, b := range p[:holeSize] {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPath returns an error if the entry h, to be written at path, would
+// be written outside of the output directory, or through a symlink. Links
+// replace a symlink at path itself, the other entries don't.
+func (te *Extractor) checkPath(h *tar.Header, path string) error {
+	if strings.HasPrefix(h.Name, "/") || fp.IsAbs(h.Name) {
+		return fmt.Errorf("%s: refusing to extract an absolute name", h.Name)
+	}
+	rel, ok := within(te.root, path)
+	if !ok {
+		return fmt.Errorf("%s: refusing to extract outside of %s", h.Name, te.root)
+	}
+	if rel == "." {
+		return nil
+	}
 
+	parts := strings.Split(rel, string(fp.Separator))
+	if h.Typeflag == tar.TypeSymlink || h.Typeflag == tar.TypeLink {
+		parts = parts[:len(parts)-1]
+	}
+	cur := te.root
+	for _, part := range parts {
+		cur = fp.Join(cur, part)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s: refusing to extract through the symlink %s", h.Name, cur)
+		}
+	}
 	return nil
 }
+
+// checkLink returns an error if the target of the link entry h, to be
+// created at path, is absolute or outside of the output directory.
+func (te *Extractor) checkLink(h *tar.Header, path string) error {
+	if strings.HasPrefix(h.Linkname, "/") || fp.IsAbs(h.Linkname) {
+		return fmt.Errorf("%s: refusing to link to the absolute path %s", h.Name, h.Linkname)
+	}
+
+	// hardlinks name an entry of the archive, symlinks a path relative to
+	// their directory.
+	target := fp.Join(te.root, fp.FromSlash(h.Linkname))
+	if h.Typeflag == tar.TypeSymlink {
+		target = fp.Join(fp.Dir(path), fp.FromSlash(h.Linkname))
+	}
+	if _, ok := within(te.root, target); !ok {
+		return fmt.Errorf("%s: refusing to link to %s, outside of %s", h.Name, h.Linkname, te.root)
+	}
+	return nil
+}
+
+// within returns path relative to root, and whether it is root or under it.
+func within(root, path string) (string, bool) {
+	rel, err := fp.Rel(root, fp.Clean(path))
+	if err != nil {
+		return "", false
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(fp.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+func removeExisting(path string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// appendFile writes r into the file at path from the byte offset off,
+// discarding anything already stored past it.
+func appendFile(path, off string, r io.Reader, sparse bool) error {
+	offset, err := strconv.ParseInt(off, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := file.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := file.Seek(offset, 0); err != nil {
+		return err
+	}
+	return copyFile(file, r, sparse)
+}
+
+type progressReader struct {
+	r        io.Reader
+	name     string
+	progress func(string, int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.progress(pr.name, int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,148 @@
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	fp "path/filepath"
+	"testing"
+)
+
+type entry struct {
+	name     string
+	typ      byte
+	linkname string
+	data     string
+}
+
+func makeArchive(t *testing.T, entries []entry) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	w := tar.NewWriter(buf)
+	for _, e := range entries {
+		h := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typ,
+			Linkname: e.linkname,
+			Mode:     0644,
+			Size:     int64(len(e.data)),
+		}
+		if e.typ == tar.TypeDir {
+			h.Mode = 0755
+		}
+		if err := w.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestExtractLinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extractor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := makeArchive(t, []entry{
+		{name: "root", typ: tar.TypeDir},
+		{name: "root/sub", typ: tar.TypeDir},
+		{name: "root/sub/a", typ: tar.TypeReg, data: "hello"},
+		{name: "root/link", typ: tar.TypeSymlink, linkname: "sub/a"},
+		{name: "root/sub/hard", typ: tar.TypeLink, linkname: "root/sub/a"},
+	})
+	out := fp.Join(dir, "out")
+	te := &Extractor{Path: out}
+	if err := te.Extract(archive); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"link", "sub/hard"} {
+		data, err := ioutil.ReadFile(fp.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "hello" {
+			t.Fatalf("%s: expected hello, got %q", name, data)
+		}
+	}
+}
+
+func TestExtractMalicious(t *testing.T) {
+	cases := map[string][]entry{
+		"escaping name": {
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/../../outside", typ: tar.TypeReg, data: "evil"},
+		},
+		"absolute symlink": {
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/link", typ: tar.TypeSymlink, linkname: "/"},
+		},
+		"escaping symlink": {
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/link", typ: tar.TypeSymlink, linkname: "../.."},
+		},
+		"escaping hardlink": {
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/link", typ: tar.TypeLink, linkname: "../../outside"},
+		},
+		"write through symlink": {
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/sub", typ: tar.TypeDir},
+			{name: "root/link", typ: tar.TypeSymlink, linkname: "sub"},
+			{name: "root/link/outside", typ: tar.TypeReg, data: "evil"},
+		},
+		"write to symlink": {
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/outside", typ: tar.TypeReg, data: "good"},
+			{name: "root/link", typ: tar.TypeSymlink, linkname: "outside"},
+			{name: "root/link", typ: tar.TypeReg, data: "evil"},
+		},
+	}
+
+	for name, entries := range cases {
+		for _, keepRoot := range []bool{false, true} {
+			extractMalicious(t, name, entries, keepRoot)
+		}
+	}
+}
+
+// extractMalicious checks that the archive of entries is refused, and that
+// nothing of it is written outside of the output directory.
+func extractMalicious(t *testing.T, name string, entries []entry, keepRoot bool) {
+	dir, err := ioutil.TempDir("", "extractor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := fp.Join(dir, "a", "b", "out")
+	if err := os.MkdirAll(fp.Dir(out), 0755); err != nil {
+		t.Fatal(err)
+	}
+	te := &Extractor{Path: out, KeepRoot: keepRoot}
+	if err := te.Extract(makeArchive(t, entries)); err == nil {
+		t.Fatalf("%s: expected the archive to be refused", name)
+	}
+	if keepRoot {
+		out = fp.Join(out, "root")
+	}
+
+	for _, outside := range []string{fp.Join(dir, "a", "outside"), fp.Join(dir, "a", "b", "outside")} {
+		if _, err := os.Lstat(outside); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected nothing written outside of the output", name)
+		}
+	}
+	if data, err := ioutil.ReadFile(fp.Join(out, "outside")); err == nil && string(data) != "good" {
+		t.Fatalf("%s: expected nothing written through a symlink, got %q", name, data)
+	}
+	if _, err := os.Lstat(fp.Join(out, "sub", "outside")); !os.IsNotExist(err) {
+		t.Fatalf("%s: expected nothing written through a symlink", name)
+	}
+}
@@ -4,6 +4,8 @@ package unixfs
 
 import (
 	"errors"
+	"os"
+	"time"
 
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
 	pb "github.com/ipfs/go-ipfs/unixfs/pb"
@@ -14,6 +16,8 @@ const (
 	TFile      = pb.Data_File
 	TDirectory = pb.Data_Directory
 	TMetadata  = pb.Data_Metadata
+	TSymlink   = pb.Data_Symlink
+	THAMTShard = pb.Data_HAMTShard
 )
 
 var ErrMalformedFileFormat = errors.New("malformed data in file format")
@@ -29,6 +33,26 @@ func FromBytes(data []byte) (*pb.Data, error) {
 	return pbdata, nil
 }
 
+// HoleSize returns the size of the run of zeros the file node of pbdata
+// holds right after its data, before its blocks: the file size it
+// records less its data and the sizes of its blocks. Files added sparse
+// record the runs of zeros that way, rather than store them.
+func HoleSize(pbdata *pb.Data) uint64 {
+	switch pbdata.GetType() {
+	case pb.Data_File, pb.Data_Raw:
+	default:
+		return 0
+	}
+	size := uint64(len(pbdata.GetData()))
+	for _, bs := range pbdata.GetBlocksizes() {
+		size += bs
+	}
+	if pbdata.GetFilesize() <= size {
+		return 0
+	}
+	return pbdata.GetFilesize() - size
+}
+
 func FilePBData(data []byte, totalsize uint64) []byte {
 	pbfile := new(pb.Data)
 	typ := pb.Data_File
@@ -62,6 +86,28 @@ func FolderPBData() []byte {
 	return data
 }
 
+// SymlinkData returns the bytes of a node for a symlink pointing to path.
+func SymlinkData(path string) ([]byte, error) {
+	pbdata := new(pb.Data)
+	typ := pb.Data_Symlink
+	pbdata.Data = []byte(path)
+	pbdata.Type = &typ
+
+	return proto.Marshal(pbdata)
+}
+
+// SetStat returns data, the unixfs data of a node, with the permission
+// bits of mode and mtime recorded in it.
+func SetStat(data []byte, mode os.FileMode, mtime time.Time) ([]byte, error) {
+	pbdata, err := FromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	pbdata.Mode = proto.Uint32(uint32(mode.Perm()))
+	pbdata.Mtime = proto.Int64(mtime.Unix())
+	return proto.Marshal(pbdata)
+}
+
 func WrapData(b []byte) []byte {
 	pbdata := new(pb.Data)
 	typ := pb.Data_Raw
@@ -99,7 +145,7 @@ func DataSize(data []byte) (uint64, error) {
 	case pb.Data_File:
 		return pbdata.GetFilesize(), nil
 	case pb.Data_Raw:
-		return uint64(len(pbdata.GetData())), nil
+		return uint64(len(pbdata.GetData())) + HoleSize(pbdata), nil
 	default:
 		return 0, errors.New("Unrecognized node data type!")
 	}
@@ -114,6 +160,9 @@ type FSNode struct {
 	// running sum of blocksizes
 	subtotal uint64
 
+	// size of the zeros after Data, see HoleSize
+	hole uint64
+
 	// node type of this node
 	Type pb.Data_DataType
 }
@@ -128,7 +177,8 @@ func FSNodeFromBytes(b []byte) (*FSNode, error) {
 	n := new(FSNode)
 	n.Data = pbn.Data
 	n.blocksizes = pbn.Blocksizes
-	n.subtotal = pbn.GetFilesize() - uint64(len(n.Data))
+	n.hole = HoleSize(pbn)
+	n.subtotal = pbn.GetFilesize() - uint64(len(n.Data)) - n.hole
 	n.Type = pbn.GetType()
 	return n, nil
 }
@@ -147,14 +197,19 @@ func (n *FSNode) RemoveBlockSize(i int) {
 func (n *FSNode) GetBytes() ([]byte, error) {
 	pbn := new(pb.Data)
 	pbn.Type = &n.Type
-	pbn.Filesize = proto.Uint64(uint64(len(n.Data)) + n.subtotal)
+	pbn.Filesize = proto.Uint64(n.FileSize())
 	pbn.Blocksizes = n.blocksizes
 	pbn.Data = n.Data
 	return proto.Marshal(pbn)
 }
 
 func (n *FSNode) FileSize() uint64 {
-	return uint64(len(n.Data)) + n.subtotal
+	return uint64(len(n.Data)) + n.hole + n.subtotal
+}
+
+// SetHole sets the size of the run of zeros after the data of the node.
+func (n *FSNode) SetHole(size uint64) {
+	n.hole = size
 }
 
 func (n *FSNode) NumChildren() int {
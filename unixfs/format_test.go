@@ -1,7 +1,9 @@
 package unixfs
 
 import (
+	"os"
 	"testing"
+	"time"
 
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
 
@@ -37,3 +39,22 @@ func TestFSNode(t *testing.T) {
 		t.Fatal("Datasize calculations incorrect!")
 	}
 }
+
+func TestSetStat(t *testing.T) {
+	mtime := time.Unix(981173106, 0)
+	data, err := SetStat(FilePBData([]byte("beep"), 4), os.ModeDir|0750, mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pbn, err := FromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pbn.GetMode() != 0750 || pbn.GetMtime() != mtime.Unix() {
+		t.Fatalf("expected mode 0750 and mtime %d, got %o and %d", mtime.Unix(), pbn.GetMode(), pbn.GetMtime())
+	}
+	if string(pbn.GetData()) != "beep" || pbn.GetFilesize() != 4 {
+		t.Fatal("SetStat changed the file data")
+	}
+}
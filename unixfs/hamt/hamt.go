@@ -0,0 +1,345 @@
+// Package hamt implements sharded unixfs directories. A directory with
+// too many entries for one node is split into a hash array mapped trie:
+// each node of the trie, a shard, has a fixed number of slots, and an
+// entry goes in the slot picked by the next bits of the hash of its name.
+// A slot holds either one entry or, when names collide in it, a shard of
+// its own.
+//
+// A shard is stored as a unixfs node of type HAMTShard whose data is a
+// bitfield of the occupied slots. Its links are the occupied slots in
+// order: each link name starts with the slot index as fixed width hex,
+// which keeps the links (sorted by name) in slot order. A link to a
+// child shard is named by the index alone; a link to an entry is named
+// by the index followed by the entry's name.
+package hamt
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"os"
+	"time"
+
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	upb "github.com/ipfs/go-ipfs/unixfs/pb"
+)
+
+// HashFNV1a64 identifies the 64-bit FNV-1a hash of entry names, the only
+// hash function shards use.
+const HashFNV1a64 = 1
+
+// DefaultShardWidth is the number of slots in each shard made by NewShard.
+const DefaultShardWidth = 256
+
+var ErrNotShard = errors.New("node is not a sharded directory")
+
+// Shard is one node of a sharded directory. It is built up in memory;
+// child shards read from the DAG are only fetched when needed.
+type Shard struct {
+	dserv dag.DAGService
+
+	size      int
+	bits      uint
+	prefixLen int
+	depth     uint
+	slots     []*slot
+
+	// data is the unixfs data of the shard, with everything but the
+	// fields describing the trie kept when the shard is stored again.
+	data *upb.Data
+}
+
+type slot struct {
+	// the entry in this slot, with its own name as link name
+	entry *dag.Link
+
+	// or a child shard, which isn't loaded until it's needed
+	shard *Shard
+	link  *dag.Link
+}
+
+// NewShard returns an empty sharded directory with size slots per shard.
+// size must be a power of two, at most 256.
+func NewShard(dserv dag.DAGService, size int) (*Shard, error) {
+	typ := upb.Data_HAMTShard
+	return newShard(dserv, size, 0, &upb.Data{Type: &typ})
+}
+
+func newShard(dserv dag.DAGService, size int, depth uint, data *upb.Data) (*Shard, error) {
+	if size < 2 || size > 256 || size&(size-1) != 0 {
+		return nil, fmt.Errorf("invalid shard width %d", size)
+	}
+	bits := uint(0)
+	for 1<<bits < size {
+		bits++
+	}
+	return &Shard{
+		dserv:     dserv,
+		size:      size,
+		bits:      bits,
+		prefixLen: len(fmt.Sprintf("%X", size-1)),
+		depth:     depth,
+		slots:     make([]*slot, size),
+		data:      data,
+	}, nil
+}
+
+// NewHamtFromDag loads the sharded directory rooted at nd.
+func NewHamtFromDag(dserv dag.DAGService, nd *dag.Node) (*Shard, error) {
+	return loadShard(dserv, nd, 0)
+}
+
+func loadShard(dserv dag.DAGService, nd *dag.Node, depth uint) (*Shard, error) {
+	pbd, err := ft.FromBytes(nd.Data)
+	if err != nil {
+		return nil, err
+	}
+	if pbd.GetType() != upb.Data_HAMTShard {
+		return nil, ErrNotShard
+	}
+	if pbd.GetHashType() != HashFNV1a64 {
+		return nil, fmt.Errorf("unsupported shard hash function %d", pbd.GetHashType())
+	}
+
+	s, err := newShard(dserv, int(pbd.GetFanout()), depth, pbd)
+	if err != nil {
+		return nil, err
+	}
+
+	bitfield := new(big.Int).SetBytes(pbd.GetData())
+	links := nd.Links
+	for i := 0; i < s.size; i++ {
+		if bitfield.Bit(i) == 0 {
+			continue
+		}
+		if len(links) == 0 {
+			return nil, errors.New("shard has fewer links than occupied slots")
+		}
+		lnk := links[0]
+		links = links[1:]
+
+		if len(lnk.Name) < s.prefixLen || lnk.Name[:s.prefixLen] != s.prefix(i) {
+			return nil, fmt.Errorf("shard link %q is not in slot %s", lnk.Name, s.prefix(i))
+		}
+		if len(lnk.Name) == s.prefixLen {
+			s.slots[i] = &slot{link: lnk}
+		} else {
+			entry := *lnk
+			entry.Name = lnk.Name[s.prefixLen:]
+			s.slots[i] = &slot{entry: &entry}
+		}
+	}
+	if len(links) > 0 {
+		return nil, errors.New("shard has more links than occupied slots")
+	}
+	return s, nil
+}
+
+// IsShard reports whether nd is the root of a sharded directory.
+func IsShard(nd *dag.Node) bool {
+	pbd, err := ft.FromBytes(nd.Data)
+	return err == nil && pbd.GetType() == upb.Data_HAMTShard
+}
+
+// SetStat records mode and mtime in the root of the directory, as
+// ft.SetStat does for other nodes.
+func (s *Shard) SetStat(mode os.FileMode, mtime time.Time) {
+	s.data.Mode = proto.Uint32(uint32(mode.Perm()))
+	s.data.Mtime = proto.Int64(mtime.Unix())
+}
+
+func (s *Shard) prefix(i int) string {
+	return fmt.Sprintf("%0*X", s.prefixLen, i)
+}
+
+func hashName(name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return h.Sum64()
+}
+
+// index returns the slot of the name hashed to h in this shard.
+func (s *Shard) index(h uint64) (int, error) {
+	used := s.bits * (s.depth + 1)
+	if used > 64 {
+		return 0, errors.New("shard hash collision: too many names with the same hash")
+	}
+	return int(h>>(64-used)) & (s.size - 1), nil
+}
+
+func (s *Shard) child(ctx context.Context, sl *slot) (*Shard, error) {
+	if sl.shard != nil {
+		return sl.shard, nil
+	}
+	nd, err := sl.link.GetNode(ctx, s.dserv)
+	if err != nil {
+		return nil, err
+	}
+	child, err := loadShard(s.dserv, nd, s.depth+1)
+	if err != nil {
+		return nil, err
+	}
+	sl.shard = child
+	return child, nil
+}
+
+// Set adds nd to the directory as name, replacing any entry of that name.
+func (s *Shard) Set(ctx context.Context, name string, nd *dag.Node) error {
+	lnk, err := dag.MakeLink(nd)
+	if err != nil {
+		return err
+	}
+	lnk.Name = name
+	return s.set(ctx, hashName(name), lnk)
+}
+
+func (s *Shard) set(ctx context.Context, h uint64, lnk *dag.Link) error {
+	i, err := s.index(h)
+	if err != nil {
+		return err
+	}
+
+	sl := s.slots[i]
+	switch {
+	case sl == nil:
+		s.slots[i] = &slot{entry: lnk}
+		return nil
+	case sl.entry != nil && sl.entry.Name == lnk.Name:
+		sl.entry = lnk
+		return nil
+	case sl.entry != nil:
+		// two names in one slot: push both down into a new shard
+		typ := upb.Data_HAMTShard
+		child, err := newShard(s.dserv, s.size, s.depth+1, &upb.Data{Type: &typ})
+		if err != nil {
+			return err
+		}
+		if err := child.set(ctx, hashName(sl.entry.Name), sl.entry); err != nil {
+			return err
+		}
+		if err := child.set(ctx, h, lnk); err != nil {
+			return err
+		}
+		s.slots[i] = &slot{shard: child}
+		return nil
+	}
+
+	child, err := s.child(ctx, sl)
+	if err != nil {
+		return err
+	}
+	sl.link = nil // the child changes, so its old link goes stale
+	return child.set(ctx, h, lnk)
+}
+
+// Find returns the link to the entry called name, with name as its link
+// name, or os.ErrNotExist if there is none.
+func (s *Shard) Find(ctx context.Context, name string) (*dag.Link, error) {
+	h := hashName(name)
+	for cur := s; ; {
+		i, err := cur.index(h)
+		if err != nil {
+			return nil, os.ErrNotExist
+		}
+
+		sl := cur.slots[i]
+		switch {
+		case sl == nil:
+			return nil, os.ErrNotExist
+		case sl.entry != nil:
+			if sl.entry.Name != name {
+				return nil, os.ErrNotExist
+			}
+			return sl.entry, nil
+		}
+
+		cur, err = cur.child(ctx, sl)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// EnumLinks returns the links to all entries of the directory, with the
+// entries' names as link names, in slot order.
+func (s *Shard) EnumLinks(ctx context.Context) ([]*dag.Link, error) {
+	var links []*dag.Link
+	for _, sl := range s.slots {
+		switch {
+		case sl == nil:
+		case sl.entry != nil:
+			links = append(links, sl.entry)
+		default:
+			child, err := s.child(ctx, sl)
+			if err != nil {
+				return nil, err
+			}
+			sub, err := child.EnumLinks(ctx)
+			if err != nil {
+				return nil, err
+			}
+			links = append(links, sub...)
+		}
+	}
+	return links, nil
+}
+
+// Node stores the shard, and the child shards that changed, and returns
+// the node of the shard.
+func (s *Shard) Node() (*dag.Node, error) {
+	nd := new(dag.Node)
+	bitfield := new(big.Int)
+	for i, sl := range s.slots {
+		if sl == nil {
+			continue
+		}
+		bitfield.SetBit(bitfield, i, 1)
+
+		var lnk dag.Link
+		switch {
+		case sl.entry != nil:
+			lnk = *sl.entry
+			lnk.Name = s.prefix(i) + sl.entry.Name
+		case sl.link != nil:
+			lnk = *sl.link
+		default:
+			child, err := sl.shard.Node()
+			if err != nil {
+				return nil, err
+			}
+			l, err := dag.MakeLink(child)
+			if err != nil {
+				return nil, err
+			}
+			l.Name = s.prefix(i)
+			sl.link = l
+			lnk = *l
+		}
+		lnk.Node = nil
+		nd.Links = append(nd.Links, &lnk)
+	}
+
+	field := make([]byte, (s.size+7)/8)
+	b := bitfield.Bytes()
+	copy(field[len(field)-len(b):], b)
+
+	pbd := *s.data
+	pbd.Data = field
+	pbd.HashType = proto.Uint64(HashFNV1a64)
+	pbd.Fanout = proto.Uint64(uint64(s.size))
+	data, err := proto.Marshal(&pbd)
+	if err != nil {
+		return nil, err
+	}
+	nd.Data = data
+
+	if _, err := s.dserv.Add(nd); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
@@ -0,0 +1,145 @@
+package hamt
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+)
+
+func buildShard(t *testing.T, ds dag.DAGService, size, n int) (*Shard, map[string]*dag.Node) {
+	ctx := context.Background()
+	s, err := NewShard(ds, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]*dag.Node)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("entry-%d", i)
+		nd := &dag.Node{Data: ft.FilePBData([]byte(name), uint64(len(name)))}
+		if _, err := ds.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Set(ctx, name, nd); err != nil {
+			t.Fatal(err)
+		}
+		entries[name] = nd
+	}
+	return s, entries
+}
+
+func checkShard(t *testing.T, s *Shard, entries map[string]*dag.Node) {
+	ctx := context.Background()
+	for name, nd := range entries {
+		lnk, err := s.Find(ctx, name)
+		if err != nil {
+			t.Fatalf("finding %s: %s", name, err)
+		}
+		k, err := nd.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lnk.Name != name || string(lnk.Hash) != string(k) {
+			t.Fatalf("wrong link for %s: %s %s", name, lnk.Name, lnk.Hash.B58String())
+		}
+	}
+	if _, err := s.Find(ctx, "missing"); err != os.ErrNotExist {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+
+	links, err := s.EnumLinks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != len(entries) {
+		t.Fatalf("expected %d links, got %d", len(entries), len(links))
+	}
+	seen := make(map[string]bool)
+	for _, lnk := range links {
+		if _, ok := entries[lnk.Name]; !ok || seen[lnk.Name] {
+			t.Fatalf("unexpected link %s", lnk.Name)
+		}
+		seen[lnk.Name] = true
+	}
+}
+
+func TestShardSetFind(t *testing.T) {
+	// a narrow shard makes sure names collide and child shards are made
+	for _, size := range []int{DefaultShardWidth, 4} {
+		ds := mdtest.Mock(t)
+		s, entries := buildShard(t, ds, size, 3000)
+		checkShard(t, s, entries)
+
+		nd, err := s.Node()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsShard(nd) {
+			t.Fatal("stored shard isn't recognized as one")
+		}
+		if len(nd.Links) > size {
+			t.Fatalf("shard of width %d has %d links", size, len(nd.Links))
+		}
+
+		loaded, err := NewHamtFromDag(ds, nd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkShard(t, loaded, entries)
+	}
+}
+
+func TestShardReplaceAndModify(t *testing.T) {
+	ctx := context.Background()
+	ds := mdtest.Mock(t)
+	s, entries := buildShard(t, ds, 4, 200)
+	nd, err := s.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// changes to a loaded shard end up in its child shards
+	loaded, err := NewHamtFromDag(ds, nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repl := &dag.Node{Data: ft.FilePBData([]byte("new"), 3)}
+	if _, err := ds.Add(repl); err != nil {
+		t.Fatal(err)
+	}
+	entries["entry-7"] = repl
+	entries["added"] = repl
+	for _, name := range []string{"entry-7", "added"} {
+		if err := loaded.Set(ctx, name, repl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	nd2, err := loaded.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := NewHamtFromDag(ds, nd2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkShard(t, reloaded, entries)
+}
+
+func TestNotShard(t *testing.T) {
+	nd := &dag.Node{Data: ft.FolderPBData()}
+	if IsShard(nd) {
+		t.Fatal("directory recognized as a shard")
+	}
+	if _, err := NewHamtFromDag(mdtest.Mock(t), nd); err != ErrNotShard {
+		t.Fatalf("expected ErrNotShard, got %v", err)
+	}
+	if _, err := NewShard(mdtest.Mock(t), 3); err == nil {
+		t.Fatal("expected an error for a width that isn't a power of two")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	mdag "github.com/ipfs/go-ipfs/merkledag"
 	ft "github.com/ipfs/go-ipfs/unixfs"
 	ftpb "github.com/ipfs/go-ipfs/unixfs/pb"
@@ -17,6 +18,32 @@ import (
 
 var ErrIsDir = errors.New("this dag node is a directory")
 
+// DefaultPrefetchWindow is how many child blocks a DagReader requests
+// ahead of the one being read, unless set with SetPrefetchWindow or
+// WithPrefetchWindow. The
+// requests go out together, so reading a file from a remote peer is not
+// bound by the round trip of each block, while fetching a bounded window,
+// rather than every child at once, keeps the memory used to read a file
+// independent of its size.
+const DefaultPrefetchWindow = 32
+
+type prefetchWindowKey struct{}
+
+// WithPrefetchWindow returns a context under which the DagReaders made
+// request n child blocks ahead of the one being read, in place of
+// DefaultPrefetchWindow.
+func WithPrefetchWindow(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, prefetchWindowKey{}, n)
+}
+
+// prefetchWindow returns the window set on ctx, or DefaultPrefetchWindow.
+func prefetchWindow(ctx context.Context) int {
+	if n, ok := ctx.Value(prefetchWindowKey{}).(int); ok && n >= 1 {
+		return n
+	}
+	return DefaultPrefetchWindow
+}
+
 // DagReader provides a way to easily read the data contained in a dag.
 type DagReader struct {
 	serv mdag.DAGService
@@ -31,9 +58,14 @@ type DagReader struct {
 	// will either be a bytes.Reader or a child DagReader
 	buf ReadSeekCloser
 
-	// NodeGetters for each of 'nodes' child links
+	// NodeGetters for each of 'nodes' child links. They are requested
+	// as the window ahead of the read head slides over them, and dropped
+	// once read; nil means not requested.
 	promises []mdag.NodeGetter
 
+	// the number of child blocks requested ahead
+	window int
+
 	// the index of the child link currently being read from
 	linkPosition int
 
@@ -57,14 +89,13 @@ type ReadSeekCloser interface {
 // NewDagReader creates a new reader object that reads the data represented by the given
 // node, using the passed in DAGService for data retreival
 func NewDagReader(ctx context.Context, n *mdag.Node, serv mdag.DAGService) (*DagReader, error) {
-	pb := new(ftpb.Data)
-	err := proto.Unmarshal(n.Data, pb)
+	pb, err := unixfsData(n)
 	if err != nil {
 		return nil, err
 	}
 
 	switch pb.GetType() {
-	case ftpb.Data_Directory:
+	case ftpb.Data_Directory, ftpb.Data_HAMTShard:
 		// Dont allow reading directories
 		return nil, ErrIsDir
 	case ftpb.Data_Raw:
@@ -87,18 +118,49 @@ func NewDagReader(ctx context.Context, n *mdag.Node, serv mdag.DAGService) (*Dag
 
 func newDataFileReader(ctx context.Context, n *mdag.Node, pb *ftpb.Data, serv mdag.DAGService) *DagReader {
 	fctx, cancel := context.WithCancel(ctx)
-	promises := serv.GetDAG(fctx, n)
 	return &DagReader{
 		node:     n,
 		serv:     serv,
-		buf:      NewRSNCFromBytes(pb.GetData()),
-		promises: promises,
+		buf:      dataReader(pb),
+		promises: make([]mdag.NodeGetter, len(n.Links)),
+		window:   prefetchWindow(ctx),
 		ctx:      fctx,
 		cancel:   cancel,
 		pbdata:   pb,
 	}
 }
 
+// SetPrefetchWindow sets how many child blocks are requested ahead of the
+// one being read. A window of 1 fetches one block at a time.
+func (dr *DagReader) SetPrefetchWindow(n int) {
+	if n < 1 {
+		n = 1
+	}
+	dr.window = n
+}
+
+// preload requests the child blocks in the window starting at link pos
+// that have not been requested yet.
+func (dr *DagReader) preload(pos int) {
+	end := pos + dr.window
+	if end > len(dr.promises) {
+		end = len(dr.promises)
+	}
+	beg := pos
+	for beg < end && dr.promises[beg] != nil {
+		beg++
+	}
+	if beg == end {
+		return
+	}
+
+	keys := make([]key.Key, 0, end-beg)
+	for _, lnk := range dr.node.Links[beg:end] {
+		keys = append(keys, key.Key(lnk.Hash))
+	}
+	copy(dr.promises[beg:end], dr.serv.GetNodes(dr.ctx, keys))
+}
+
 // precalcNextBuf follows the next link in line and loads it from the DAGService,
 // setting the next buffer to read from
 func (dr *DagReader) precalcNextBuf(ctx context.Context) error {
@@ -107,27 +169,31 @@ func (dr *DagReader) precalcNextBuf(ctx context.Context) error {
 		return io.EOF
 	}
 
+	dr.preload(dr.linkPosition)
 	nxt, err := dr.promises[dr.linkPosition].Get(ctx)
 	if err != nil {
 		return err
 	}
+	// don't hold on to blocks that have been read.
+	dr.promises[dr.linkPosition] = nil
 	dr.linkPosition++
 
-	pb := new(ftpb.Data)
-	err = proto.Unmarshal(nxt.Data, pb)
+	pb, err := unixfsData(nxt)
 	if err != nil {
 		return fmt.Errorf("incorrectly formatted protobuf: %s", err)
 	}
 
 	switch pb.GetType() {
-	case ftpb.Data_Directory:
+	case ftpb.Data_Directory, ftpb.Data_HAMTShard:
 		// A directory should not exist within a file
 		return ft.ErrInvalidDirLocation
 	case ftpb.Data_File:
-		dr.buf = newDataFileReader(dr.ctx, nxt, pb, dr.serv)
+		child := newDataFileReader(dr.ctx, nxt, pb, dr.serv)
+		child.window = dr.window
+		dr.buf = child
 		return nil
 	case ftpb.Data_Raw:
-		dr.buf = NewRSNCFromBytes(pb.GetData())
+		dr.buf = dataReader(pb)
 		return nil
 	case ftpb.Data_Metadata:
 		return errors.New("Shouldnt have had metadata object inside file")
@@ -221,10 +287,13 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 
 		// left represents the number of bytes remaining to seek to (from beginning)
 		left := offset
-		if int64(len(pb.Data)) >= offset {
+		if own := int64(len(pb.Data)) + int64(ft.HoleSize(pb)); own >= offset {
 			// Close current buf to close potential child dagreader
 			dr.buf.Close()
-			dr.buf = NewRSNCFromBytes(pb.GetData()[offset:])
+			dr.buf = dataReader(pb)
+			if _, err := dr.buf.Seek(offset, os.SEEK_SET); err != nil {
+				return -1, err
+			}
 
 			// start reading links from the beginning
 			dr.linkPosition = 0
@@ -232,7 +301,7 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 			return offset, nil
 		} else {
 			// skip past root block data
-			left -= int64(len(pb.Data))
+			left -= own
 		}
 
 		// iterate through links and find where we need to be
@@ -245,6 +314,11 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 			}
 		}
 
+		// drop the blocks requested for the links skipped over.
+		for i := range dr.promises[:dr.linkPosition] {
+			dr.promises[i] = nil
+		}
+
 		// start sub-block request
 		err := dr.precalcNextBuf(dr.ctx)
 		if err != nil {
@@ -277,6 +351,103 @@ func (dr *DagReader) Seek(offset int64, whence int) (int64, error) {
 	return 0, nil
 }
 
+// unixfsData returns the unixfs data of n. Raw blocks read as raw data.
+func unixfsData(n *mdag.Node) (*ftpb.Data, error) {
+	if n.IsRaw() {
+		return &ftpb.Data{
+			Type:     ftpb.Data_Raw.Enum(),
+			Data:     n.Data,
+			Filesize: proto.Uint64(uint64(len(n.Data))),
+		}, nil
+	}
+	pb := new(ftpb.Data)
+	if err := proto.Unmarshal(n.Data, pb); err != nil {
+		return nil, err
+	}
+	return pb, nil
+}
+
+// dataReader returns a reader of the data of the node of pb, followed by
+// the zeros of its hole, if it has one.
+func dataReader(pb *ftpb.Data) ReadSeekCloser {
+	hole := ft.HoleSize(pb)
+	if hole == 0 {
+		return NewRSNCFromBytes(pb.GetData())
+	}
+	return &holeReader{data: pb.GetData(), size: int64(len(pb.GetData())) + int64(hole)}
+}
+
+// holeReader reads data, then zeros up to size bytes.
+type holeReader struct {
+	data   []byte
+	size   int64
+	offset int64
+}
+
+var zeros = make([]byte, 32*1024)
+
+func (r *holeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if left := r.size - r.offset; int64(len(p)) > left {
+		p = p[:left]
+	}
+	var n int
+	if r.offset < int64(len(r.data)) {
+		n = copy(p, r.data[r.offset:])
+	}
+	for i := range p[n:] {
+		p[n+i] = 0
+	}
+	r.offset += int64(len(p))
+	return len(p), nil
+}
+
+func (r *holeReader) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	if r.offset < int64(len(r.data)) {
+		n, err := w.Write(r.data[r.offset:])
+		total += int64(n)
+		r.offset += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	for r.offset < r.size {
+		chunk := zeros
+		if left := r.size - r.offset; int64(len(chunk)) > left {
+			chunk = chunk[:left]
+		}
+		n, err := w.Write(chunk)
+		total += int64(n)
+		r.offset += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (r *holeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case os.SEEK_SET:
+	case os.SEEK_CUR:
+		offset += r.offset
+	case os.SEEK_END:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("Invalid offset")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *holeReader) Close() error { return nil }
+
 // readSeekNopCloser wraps a bytes.Reader to implement ReadSeekCloser
 type readSeekNopCloser struct {
 	*bytes.Reader
@@ -0,0 +1,143 @@
+package io
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	"github.com/ipfs/go-ipfs/importer"
+	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+// latencyDAG hands out every node after a delay, as fetching its block
+// from a remote peer would. Nodes requested together arrive together.
+type latencyDAG struct {
+	mdag.DAGService
+	latency time.Duration
+}
+
+func (ld *latencyDAG) GetNodes(ctx context.Context, keys []key.Key) []mdag.NodeGetter {
+	promises := ld.DAGService.GetNodes(ctx, keys)
+	ready := time.Now().Add(ld.latency)
+	for i, p := range promises {
+		promises[i] = &delayedGetter{p, ready}
+	}
+	return promises
+}
+
+type delayedGetter struct {
+	mdag.NodeGetter
+	ready time.Time
+}
+
+func (dg *delayedGetter) Get(ctx context.Context) (*mdag.Node, error) {
+	time.Sleep(dg.ready.Sub(time.Now()))
+	return dg.NodeGetter.Get(ctx)
+}
+
+func buildTestFile(t testing.TB, size int64, ds mdag.DAGService) ([]byte, *mdag.Node) {
+	data, err := ioutil.ReadAll(io.LimitReader(u.NewTimeSeededRand(), size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spl := &chunk.SizeSplitter{Size: 4096}
+	nd, err := importer.BuildDagFromReader(bytes.NewReader(data), ds, spl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, nd
+}
+
+func TestDagReaderWindowSeek(t *testing.T) {
+	ds := mdtest.Mock(t)
+	data, nd := buildTestFile(t, 1024*1024, ds)
+
+	for _, window := range []int{1, 3, DefaultPrefetchWindow} {
+		dr, err := NewDagReader(context.Background(), nd, ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dr.SetPrefetchWindow(window)
+
+		out, err := ioutil.ReadAll(dr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatalf("window %d: read data differs from the file", window)
+		}
+
+		// seek back over blocks that have been read and dropped, and
+		// forward past blocks that were requested but not read.
+		for _, offset := range []int64{100000, 5000, 900000, 0} {
+			if _, err := dr.Seek(offset, os.SEEK_SET); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 20000)
+			if _, err := io.ReadFull(dr, buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf, data[offset:offset+20000]) {
+				t.Fatalf("window %d: data read at %d differs from the file", window, offset)
+			}
+		}
+		dr.Close()
+	}
+}
+
+func TestWithPrefetchWindow(t *testing.T) {
+	ds := mdtest.Mock(t)
+	data, nd := buildTestFile(t, 1024*1024, ds)
+
+	for set, expected := range map[int]int{5: 5, 1: 1, 0: DefaultPrefetchWindow} {
+		dr, err := NewDagReader(WithPrefetchWindow(context.Background(), set), nd, ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dr.window != expected {
+			t.Fatalf("window %d: expected the reader to prefetch %d blocks, got %d", set, expected, dr.window)
+		}
+		out, err := ioutil.ReadAll(dr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatalf("window %d: read data differs from the file", set)
+		}
+		dr.Close()
+	}
+}
+
+func benchmarkWindow(b *testing.B, window int) {
+	const size = 1024 * 1024
+	ds := mdtest.Mock(b)
+	_, nd := buildTestFile(b, size, ds)
+	slow := &latencyDAG{DAGService: ds, latency: time.Millisecond}
+
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dr, err := NewDagReader(context.Background(), nd, slow)
+		if err != nil {
+			b.Fatal(err)
+		}
+		dr.SetPrefetchWindow(window)
+		if _, err := io.Copy(ioutil.Discard, dr); err != nil {
+			b.Fatal(err)
+		}
+		dr.Close()
+	}
+}
+
+func BenchmarkDagReaderWindow1(b *testing.B)  { benchmarkWindow(b, 1) }
+func BenchmarkDagReaderWindow8(b *testing.B)  { benchmarkWindow(b, 8) }
+func BenchmarkDagReaderWindow32(b *testing.B) { benchmarkWindow(b, 32) }
@@ -0,0 +1,34 @@
+package io
+
+import (
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	hamt "github.com/ipfs/go-ipfs/unixfs/hamt"
+	ftpb "github.com/ipfs/go-ipfs/unixfs/pb"
+)
+
+// DirLinks returns the links to the entries of the directory nd, named
+// by the entries' names. For a sharded directory, these are gathered
+// from all of its shards; for any other node, they are its own links.
+func DirLinks(ctx context.Context, nd *mdag.Node, serv mdag.DAGService) ([]*mdag.Link, error) {
+	if !hamt.IsShard(nd) {
+		return nd.Links, nil
+	}
+	s, err := hamt.NewHamtFromDag(serv, nd)
+	if err != nil {
+		return nil, err
+	}
+	return s.EnumLinks(ctx)
+}
+
+// IsDir reports whether nd is a unixfs directory, sharded or not.
+func IsDir(nd *mdag.Node) bool {
+	pb, err := ft.FromBytes(nd.Data)
+	if err != nil {
+		return false
+	}
+	typ := pb.GetType()
+	return typ == ftpb.Data_Directory || typ == ftpb.Data_HAMTShard
+}
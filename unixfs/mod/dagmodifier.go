@@ -235,6 +235,8 @@ func (dm *DagModifier) modifyDag(node *mdag.Node, offset uint64, data io.Reader)
 
 	// If we've reached a leaf node.
 	if len(node.Links) == 0 {
+		// the zeros of a hole are written into as data.
+		f.Data = append(f.Data, make([]byte, ft.HoleSize(f))...)
 		n, err := data.Read(f.Data[offset:])
 		if err != nil && err != io.EOF {
 			return "", false, err
@@ -311,6 +313,7 @@ func (dm *DagModifier) appendData(node *mdag.Node, blks <-chan []byte) (*mdag.No
 		Dagserv:  dm.dagserv,
 		Maxlinks: help.DefaultLinksPerBlock,
 		NodeCB:   imp.BasicPinnerCB(dm.mp),
+		HashType: node.HashType(),
 	}
 
 	return trickle.TrickleAppend(node, dbp.New(blks))
@@ -451,7 +454,8 @@ func dagTruncate(nd *mdag.Node, size uint64, ds mdag.DAGService) (*mdag.Node, er
 			return nil, err
 		}
 
-		nd.Data = ft.WrapData(pbn.Data[:size])
+		data := append(pbn.Data, make([]byte, ft.HoleSize(pbn))...)
+		nd.Data = ft.WrapData(data[:size])
 		return nd, nil
 	}
 
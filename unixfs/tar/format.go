@@ -0,0 +1,300 @@
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	"github.com/ipfs/go-ipfs/importer"
+	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+)
+
+// A tarball imported with ImportTar is kept as a DAG that records the
+// archive byte for byte, so that ExportTar gives back the very stream
+// that was imported:
+//
+//   - the root's data is tarRootMarker followed by the archive trailer,
+//     everything from the end-of-archive block onwards;
+//   - the root links to one node per entry, named by the entry's index in
+//     the archive and its path, as links are kept sorted by name;
+//   - an entry node's data is the raw header blocks of the entry, along
+//     with any PAX or GNU long name blocks before it;
+//   - an entry links to its contents, a unixfs file, as "data", and to the
+//     padding after the contents as "padding", when that isn't all zeros.
+const tarRootMarker = "ipfs/tar\n"
+
+const blockSize = 512
+
+var (
+	ErrNotTarDAG = errors.New("object is not an imported tarball")
+	errSparse    = errors.New("sparse files are not supported")
+)
+
+// ImportTar reads a tar stream from r and stores it in ds, returning the
+// root node of the resulting DAG.
+func ImportTar(r io.Reader, ds mdag.DAGService) (*mdag.Node, error) {
+	root := &mdag.Node{Data: []byte(tarRootMarker)}
+	for i := 0; ; i++ {
+		nd, name, trailer, err := importEntry(r, ds)
+		if err != nil {
+			return nil, err
+		}
+		if nd == nil {
+			root.Data = append(root.Data, trailer...)
+			break
+		}
+		if err := root.AddNodeLinkClean(fmt.Sprintf("%010d %s", i, name), nd); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := ds.Add(root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// importEntry reads the next entry from r and stores it. At the end of
+// the archive, it returns a nil node and the trailer instead.
+func importEntry(r io.Reader, ds mdag.DAGService) (*mdag.Node, string, []byte, error) {
+	var raw []byte
+	blk := make([]byte, blockSize)
+	for {
+		if _, err := io.ReadFull(r, blk); err != nil {
+			if err == io.EOF && raw == nil {
+				// an archive without an end-of-archive marker
+				return nil, "", nil, nil
+			}
+			return nil, "", nil, fmt.Errorf("reading tar header: %s", err)
+		}
+		if isZero(blk) {
+			rest, err := ioutil.ReadAll(r)
+			if err != nil {
+				return nil, "", nil, err
+			}
+			trailer := append(append(raw, blk...), rest...)
+			return nil, "", trailer, nil
+		}
+		raw = append(raw, blk...)
+
+		// PAX and GNU long name entries describe the entry after them,
+		// and are kept in its header.
+		typ := blk[156]
+		if typ != tar.TypeXHeader && typ != tar.TypeGNULongName && typ != tar.TypeGNULongLink {
+			break
+		}
+		size, err := headerSize(blk)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		meta := make([]byte, size+padding(size))
+		if _, err := io.ReadFull(r, meta); err != nil {
+			return nil, "", nil, fmt.Errorf("reading tar header: %s", err)
+		}
+		raw = append(raw, meta...)
+	}
+
+	name, size, err := parseHeader(raw)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	nd := &mdag.Node{Data: raw}
+	if size > 0 {
+		data := &io.LimitedReader{R: r, N: size}
+		file, err := importer.BuildDagFromReader(data, ds, chunk.DefaultSplitter, nil)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if data.N > 0 {
+			return nil, "", nil, fmt.Errorf("reading contents of %s: %s", name, io.ErrUnexpectedEOF)
+		}
+		if err := nd.AddNodeLinkClean("data", file); err != nil {
+			return nil, "", nil, err
+		}
+
+		pad := make([]byte, padding(size))
+		if _, err := io.ReadFull(r, pad); err != nil {
+			return nil, "", nil, fmt.Errorf("reading contents of %s: %s", name, err)
+		}
+		if !isZero(pad) {
+			padnd := &mdag.Node{Data: pad}
+			if _, err := ds.Add(padnd); err != nil {
+				return nil, "", nil, err
+			}
+			if err := nd.AddNodeLinkClean("padding", padnd); err != nil {
+				return nil, "", nil, err
+			}
+		}
+	}
+
+	if _, err := ds.Add(nd); err != nil {
+		return nil, "", nil, err
+	}
+	return nd, name, nil, nil
+}
+
+// parseHeader returns the name of the entry described by the header
+// blocks raw, and the size of its contents.
+func parseHeader(raw []byte) (string, int64, error) {
+	last := raw[len(raw)-blockSize:]
+	switch last[156] {
+	case tar.TypeGNUSparse:
+		return "", 0, errSparse
+	case tar.TypeXGlobalHeader:
+		// global headers stand on their own, with PAX records as their
+		// contents. archive/tar would consume those, so take the header
+		// fields as they are.
+		size, err := headerSize(last)
+		if err != nil {
+			return "", 0, err
+		}
+		return cString(last[:100]), size, nil
+	}
+
+	h, err := tar.NewReader(bytes.NewReader(raw)).Next()
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid tar header: %s", err)
+	}
+	for k := range h.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return "", 0, errSparse
+		}
+	}
+
+	// only regular files have contents stored after their header
+	size := h.Size
+	switch h.Typeflag {
+	case tar.TypeLink, tar.TypeSymlink, tar.TypeChar, tar.TypeBlock, tar.TypeDir, tar.TypeFifo:
+		size = 0
+	}
+	return h.Name, size, nil
+}
+
+// headerSize parses the size field of a header block, which is octal or,
+// for large sizes, base-256.
+func headerSize(blk []byte) (int64, error) {
+	field := blk[124:136]
+	if field[0]&0x80 != 0 {
+		var size int64
+		for i, b := range field {
+			if i == 0 {
+				b &= 0x7f
+			}
+			size = size<<8 | int64(b)
+		}
+		return size, nil
+	}
+
+	s := strings.Trim(string(field), " \x00")
+	if s == "" {
+		return 0, nil
+	}
+	size, err := strconv.ParseInt(s, 8, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid tar header size %q", s)
+	}
+	return size, nil
+}
+
+// ExportTar returns the tar stream recorded by the DAG at root, which
+// must have been made by ImportTar.
+func ExportTar(ctx context.Context, root *mdag.Node, ds mdag.DAGService) (io.Reader, error) {
+	if !bytes.HasPrefix(root.Data, []byte(tarRootMarker)) {
+		return nil, ErrNotTarDAG
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(exportTar(ctx, root, ds, pw))
+	}()
+	return pr, nil
+}
+
+func exportTar(ctx context.Context, root *mdag.Node, ds mdag.DAGService, w io.Writer) error {
+	for _, lnk := range root.Links {
+		nd, err := lnk.GetNode(ctx, ds)
+		if err != nil {
+			return err
+		}
+		if err := exportEntry(ctx, nd, ds, w); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(root.Data[len(tarRootMarker):])
+	return err
+}
+
+func exportEntry(ctx context.Context, nd *mdag.Node, ds mdag.DAGService, w io.Writer) error {
+	if _, err := w.Write(nd.Data); err != nil {
+		return err
+	}
+
+	var data, pad *mdag.Node
+	for _, lnk := range nd.Links {
+		child, err := lnk.GetNode(ctx, ds)
+		if err != nil {
+			return err
+		}
+		switch lnk.Name {
+		case "data":
+			data = child
+		case "padding":
+			pad = child
+		default:
+			return ErrNotTarDAG
+		}
+	}
+	if data == nil {
+		return nil
+	}
+
+	dr, err := uio.NewDagReader(ctx, data, ds)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+	n, err := io.Copy(w, dr)
+	if err != nil {
+		return err
+	}
+
+	if pad != nil {
+		_, err = w.Write(pad.Data)
+	} else {
+		_, err = w.Write(make([]byte, padding(n)))
+	}
+	return err
+}
+
+// padding returns the number of bytes that pad size bytes of contents
+// to a whole block.
+func padding(size int64) int64 {
+	return (blockSize - size%blockSize) % blockSize
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
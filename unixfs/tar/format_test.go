@@ -0,0 +1,137 @@
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+)
+
+func buildArchive(t *testing.T, data []byte) []byte {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	mtime := time.Unix(1400000000, 0)
+	long := strings.Repeat("long/", 40) + "name"
+	entries := []struct {
+		h    tar.Header
+		data []byte
+	}{
+		{tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: mtime}, nil},
+		{tar.Header{Name: "dir/file", Mode: 0644, Uname: "someone", ModTime: mtime}, data},
+		{tar.Header{Name: "dir/empty", Mode: 0600, ModTime: mtime}, nil},
+		{tar.Header{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "file", ModTime: mtime}, nil},
+		{tar.Header{Name: long, Mode: 0644, ModTime: mtime, Format: tar.FormatGNU}, []byte("deep\n")},
+		{tar.Header{Name: "dir/pax", Mode: 0644, ModTime: mtime, PAXRecords: map[string]string{"comment": "kept"}}, []byte("x")},
+	}
+	for _, e := range entries {
+		e.h.Size = int64(len(e.data))
+		if err := tw.WriteHeader(&e.h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportExportTar(t *testing.T) {
+	data, _, _ := buildFile(t, 700*1024)
+	archive := buildArchive(t, data)
+
+	// non-zero padding after the last file, and blocks after the
+	// end-of-archive marker, are kept too
+	padded := append([]byte(nil), archive...)
+	padded[len(padded)-3*blockSize+1] = 'p' // after the last file's one byte
+	trailing := append(append([]byte(nil), archive...), bytes.Repeat([]byte{0}, 4096)...)
+
+	for name, in := range map[string][]byte{"plain": archive, "padded": padded, "trailing": trailing} {
+		ds := mdtest.Mock(t)
+		root, err := ImportTar(bytes.NewReader(in), ds)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if len(root.Links) != 6 {
+			t.Fatalf("%s: expected 6 entries, got %d", name, len(root.Links))
+		}
+		if name == "padded" {
+			last, err := root.Links[5].GetNode(context.Background(), ds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := last.GetNodeLink("padding"); err != nil {
+				t.Fatal("non-zero padding was not stored")
+			}
+		}
+
+		r, err := ExportTar(context.Background(), root, ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, in) {
+			t.Fatalf("%s: exported archive differs from the imported one", name)
+		}
+	}
+
+	// file contents are stored as unixfs files
+	ds := mdtest.Mock(t)
+	root, err := ImportTar(bytes.NewReader(archive), ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := root.Links[1].GetNode(context.Background(), ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := entry.GetNodeLink("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fnd, err := file.GetNode(context.Background(), ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dr, err := uio.NewDagReader(context.Background(), fnd, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("stored file contents differ")
+	}
+}
+
+func TestImportTarErrors(t *testing.T) {
+	archive := buildArchive(t, []byte("data"))
+
+	for name, in := range map[string][]byte{
+		"truncated": archive[:blockSize*2+100],
+		"garbage":   bytes.Repeat([]byte("garbage!"), blockSize/8),
+	} {
+		if _, err := ImportTar(bytes.NewReader(in), mdtest.Mock(t)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	ds := mdtest.Mock(t)
+	if _, err := ExportTar(context.Background(), uio.NewEmptyDirectory(), ds); err != ErrNotTarDAG {
+		t.Fatalf("expected ErrNotTarDAG, got %v", err)
+	}
+}
@@ -2,203 +2,407 @@ package tar
 
 import (
 	"archive/tar"
-	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"io"
 	gopath "path"
+	"strconv"
 	"time"
 
 	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
 
+	key "github.com/ipfs/go-ipfs/blocks/key"
 	mdag "github.com/ipfs/go-ipfs/merkledag"
 	path "github.com/ipfs/go-ipfs/path"
 	uio "github.com/ipfs/go-ipfs/unixfs/io"
 	upb "github.com/ipfs/go-ipfs/unixfs/pb"
 )
 
+// Reader streams an archive of a unixfs DAG. The archive is written into
+// a pipe as it is read, so only the data the consumer is currently
+// reading is held in memory, however large the DAG.
 type Reader struct {
-	buf        bytes.Buffer
-	closed     bool
-	signalChan chan struct{}
+	pipe *io.PipeReader
+	// ctx is done once the archive is written or closed, which stops
+	// the fetches of its blocks.
+	ctx        context.Context
+	cancel     context.CancelFunc
 	dag        mdag.DAGService
-	resolver   *path.Resolver
-	writer     *tar.Writer
+	writer     entryWriter
 	gzipWriter *gzip.Writer
-	err        error
+	offsets    map[string]Resume
+
+	// links maps the keys of the files written so far to their names,
+	// when identical files are written as hardlinks.
+	links map[key.Key]string
+
+	// verify writes the list of the blocks of each file before it.
+	verify bool
+}
+
+// entryWriter is an archive format. Entries are described with tar
+// headers, which *tar.Writer takes as is; a file's data is written after
+// its header.
+type entryWriter interface {
+	WriteHeader(h *tar.Header) error
+	io.Writer
+	Close() error
+}
+
+// OffsetRecord is the PAX record set on a file entry that starts at a
+// byte offset into the file, rather than at its beginning.
+const OffsetRecord = "IPFS.offset"
+
+// Resume is the part of a file already downloaded, to resume it from: its
+// first Offset bytes, of which Hash is the HashPrefix.
+type Resume struct {
+	Offset int64
+	Hash   string
+}
+
+// HashPrefix returns the hash of the data of r, to tell whether the part
+// of a file downloaded is that of the file in the DAG: the b58 sha2-256
+// multihash of the data.
+func HashPrefix(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	m, err := mh.Encode(h.Sum(nil), mh.SHA2_256)
+	if err != nil {
+		return "", err
+	}
+	return mh.Multihash(m).B58String(), nil
+}
+
+// ErrorRecord is the PAX record set on the entry standing in for a path
+// that could not be resolved. The entry is a text file named
+// <name>.error holding the error.
+const ErrorRecord = "IPFS.error"
+
+// StatRecord is the PAX record set on an entry whose mode and mtime were
+// recorded when it was added, rather than made up for the archive.
+const StatRecord = "IPFS.stat"
+
+// Entry is a top-level entry of an archive: a resolved DAG, or the error
+// that kept its path from resolving.
+type Entry struct {
+	Path path.Path
+	Node *mdag.Node
+	Err  error
+}
+
+// name is the name of the entry in the archive.
+func (e Entry) name() string {
+	_, filename := gopath.Split(e.Path.String())
+	return filename
+}
+
+func NewReader(ctx context.Context, path path.Path, dag mdag.DAGService, dagnode *mdag.Node, compression int) (*Reader, error) {
+	return NewTarReader(ctx, []Entry{{Path: path, Node: dagnode}}, dag, compression, nil, false, false)
 }
 
-func NewReader(path path.Path, dag mdag.DAGService, dagnode *mdag.Node, compression int) (*Reader, error) {
+// NewTarReader streams a tar archive holding each of entries. Of each file
+// in offsets, keyed by its name in the archive, it skips the bytes already
+// downloaded, once it has checked they hash as those of the DAG; the
+// blocks of those were fetched by the download resumed, so they're
+// normally not fetched again. The entries of resumed files carry an
+// OffsetRecord and hold only the remaining bytes, and the files whose
+// bytes downloaded differ are written whole.
+// With dedupe, a file identical to one already in the archive is written
+// as a hardlink to it. With verify, each file entry, hardlinks included,
+// comes after an entry carrying a BlocksRecord, for the file to be
+// checked against its hashes once extracted. The blocks are fetched with
+// ctx, and the archive fails with its error once it is done.
+func NewTarReader(ctx context.Context, entries []Entry, dag mdag.DAGService, compression int, offsets map[string]Resume, dedupe, verify bool) (*Reader, error) {
 
+	pr, pw := io.Pipe()
 	reader := &Reader{
-		signalChan: make(chan struct{}),
-		dag:        dag,
+		dag:     dag,
+		offsets: offsets,
+		verify:  verify,
+	}
+	if dedupe {
+		reader.links = make(map[key.Key]string)
 	}
 
 	var err error
 	if compression != gzip.NoCompression {
-		reader.gzipWriter, err = gzip.NewWriterLevel(&reader.buf, compression)
+		reader.gzipWriter, err = gzip.NewWriterLevel(pw, compression)
 		if err != nil {
 			return nil, err
 		}
 		reader.writer = tar.NewWriter(reader.gzipWriter)
 	} else {
-		reader.writer = tar.NewWriter(&reader.buf)
+		reader.writer = tar.NewWriter(pw)
 	}
 
-	// writeToBuf will write the data to the buffer, and will signal when there
-	// is new data to read
-	_, filename := gopath.Split(path.String())
-	go reader.writeToBuf(dagnode, filename, 0)
-
+	reader.start(ctx, pr, pw, entries)
 	return reader, nil
 }
 
-func (r *Reader) writeToBuf(dagnode *mdag.Node, path string, depth int) {
-	pb := new(upb.Data)
-	err := proto.Unmarshal(dagnode.Data, pb)
-	if err != nil {
-		r.emitError(err)
-		return
-	}
+// start writes the archive of entries into pw in the background. Writes
+// to the pipe block until the data has been read, so the archive is
+// never produced ahead of the consumer. The archive fails with the error
+// of ctx once it is done, or once the Reader is closed; both goroutines
+// end as soon as the archive is written or fails.
+func (r *Reader) start(ctx context.Context, pr *io.PipeReader, pw *io.PipeWriter, entries []Entry) {
+	r.pipe = pr
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(r.writeArchive(entries))
+	}()
+	go func() {
+		defer r.cancel()
+		select {
+		case <-r.ctx.Done():
+			pw.CloseWithError(r.ctx.Err())
+		case <-done:
+		}
+	}()
+}
 
-	if depth == 0 {
-		defer r.close()
+// TotalSize returns the number of file bytes an archive of entries will
+// carry, less the bytes skipped by offsets and those of the files
+// written as hardlinks with dedupe (see NewTarReader). It fetches the
+// directory nodes, but none of the file contents, so it takes the bytes
+// of offsets to be those of the files, which NewTarReader checks.
+func TotalSize(ctx context.Context, entries []Entry, dag mdag.DAGService, offsets map[string]Resume, dedupe bool) (uint64, error) {
+	var seen map[key.Key]bool
+	if dedupe {
+		seen = make(map[key.Key]bool)
 	}
 
-	if pb.GetType() == upb.Data_Directory {
-		err = r.writer.WriteHeader(&tar.Header{
-			Name:     path,
-			Typeflag: tar.TypeDir,
-			Mode:     0777,
-			ModTime:  time.Now(),
-			// TODO: set mode, dates, etc. when added to unixFS
-		})
+	var total uint64
+	for _, e := range entries {
+		if e.Err != nil {
+			continue
+		}
+		size, err := totalSize(ctx, dag, e.Node, e.name(), offsets, seen)
 		if err != nil {
-			r.emitError(err)
-			return
+			return 0, err
 		}
-		r.flush()
+		total += size
+	}
+	return total, nil
+}
 
-		ctx, cancel := context.WithTimeout(context.TODO(), time.Second*60)
-		defer cancel()
+// totalSize adds the size of dagnode, named path, to total: that of the
+// files in it if it's a directory.
+func totalSize(ctx context.Context, dag mdag.DAGService, dagnode *mdag.Node, path string, offsets map[string]Resume, seen map[key.Key]bool) (uint64, error) {
+	var total uint64
+	err := walkEntries(ctx, dag, dagnode, path, func(nd *mdag.Node, path string) error {
+		pb := new(upb.Data)
+		if err := proto.Unmarshal(nd.Data, pb); err != nil {
+			return err
+		}
 
-		for i, ng := range r.dag.GetDAG(ctx, dagnode) {
-			childNode, err := ng.Get(ctx)
+		switch pb.GetType() {
+		case upb.Data_Directory, upb.Data_HAMTShard, upb.Data_Symlink:
+			return nil
+		}
+		if seen != nil {
+			k, err := nd.Key()
 			if err != nil {
-				r.emitError(err)
-				return
+				return err
+			}
+			if seen[k] {
+				return nil
 			}
-			r.writeToBuf(childNode, gopath.Join(path, dagnode.Links[i].Name), depth+1)
+			seen[k] = true
+		}
+
+		size := pb.GetFilesize()
+		if res, ok := offsets[path]; ok && res.Offset >= 0 && uint64(res.Offset) <= size {
+			size -= uint64(res.Offset)
+		}
+		total += size
+		return nil
+	})
+	return total, err
+}
+
+func (r *Reader) writeArchive(entries []Entry) error {
+	for _, e := range entries {
+		var err error
+		if e.Err != nil {
+			err = r.writeError(e.name(), e.Err)
+		} else {
+			err = r.writeNode(e.Node, e.name())
+		}
+		if err != nil {
+			return err
 		}
-		return
 	}
+	return r.close()
+}
 
-	err = r.writer.WriteHeader(&tar.Header{
-		Name:     path,
-		Size:     int64(pb.GetFilesize()),
-		Typeflag: tar.TypeReg,
-		Mode:     0644,
-		ModTime:  time.Now(),
-		// TODO: set mode, dates, etc. when added to unixFS
+// writeError writes the entry standing in for a path that failed.
+func (r *Reader) writeError(name string, failure error) error {
+	msg := failure.Error()
+	err := r.writer.WriteHeader(&tar.Header{
+		Name:       name + ".error",
+		Size:       int64(len(msg) + 1),
+		Typeflag:   tar.TypeReg,
+		Mode:       0644,
+		ModTime:    time.Now(),
+		PAXRecords: map[string]string{ErrorRecord: msg},
 	})
 	if err != nil {
-		r.emitError(err)
-		return
+		return err
 	}
-	r.flush()
+	_, err = io.WriteString(r.writer, msg+"\n")
+	return err
+}
+
+// writeNode writes the entry of dagnode, named path, and if it's a
+// directory, those of everything in it.
+func (r *Reader) writeNode(dagnode *mdag.Node, path string) error {
+	return walkEntries(r.ctx, r.dag, dagnode, path, r.writeEntry)
+}
 
-	reader, err := uio.NewDagReader(context.TODO(), dagnode, r.dag)
+// writeEntry writes the entry of dagnode alone: a directory's header is
+// written without its entries.
+func (r *Reader) writeEntry(dagnode *mdag.Node, path string) error {
+	pb := new(upb.Data)
+	err := proto.Unmarshal(dagnode.Data, pb)
 	if err != nil {
-		r.emitError(err)
-		return
+		return err
 	}
 
-	err = r.syncCopy(reader)
-	if err != nil {
-		r.emitError(err)
-		return
+	if typ := pb.GetType(); typ == upb.Data_Directory || typ == upb.Data_HAMTShard {
+		header := &tar.Header{
+			Name:     path,
+			Typeflag: tar.TypeDir,
+			Mode:     0777,
+			ModTime:  time.Now(),
+		}
+		setStat(header, pb)
+		return r.writer.WriteHeader(header)
 	}
-}
 
-func (r *Reader) Read(p []byte) (int, error) {
-	// wait for the goroutine that is writing data to the buffer to tell us
-	// there is something to read
-	if !r.closed {
-		<-r.signalChan
+	if pb.GetType() == upb.Data_Symlink {
+		return r.writer.WriteHeader(&tar.Header{
+			Name:     path,
+			Linkname: string(pb.GetData()),
+			Typeflag: tar.TypeSymlink,
+			Mode:     0777,
+			ModTime:  time.Now(),
+		})
 	}
 
-	if r.err != nil {
-		return 0, r.err
+	if r.verify {
+		if err := r.writeBlockList(dagnode, path); err != nil {
+			return err
+		}
 	}
 
-	if !r.closed {
-		defer r.signal()
+	if r.links != nil {
+		k, err := dagnode.Key()
+		if err != nil {
+			return err
+		}
+		if first, ok := r.links[k]; ok {
+			return r.writer.WriteHeader(&tar.Header{
+				Name:     path,
+				Linkname: first,
+				Typeflag: tar.TypeLink,
+				Mode:     0644,
+				ModTime:  time.Now(),
+			})
+		}
+		r.links[k] = path
+	}
+
+	reader, err := uio.NewDagReader(r.ctx, dagnode, r.dag)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	size := int64(pb.GetFilesize())
+	res, resume := r.offsets[path]
+	offset := res.Offset
+	if resume && offset >= 0 && offset <= size {
+		// the local copy must be a prefix of this file.
+		h, err := HashPrefix(io.LimitReader(reader, offset))
+		if err != nil {
+			return err
+		}
+		if h != res.Hash {
+			// they differ, write it all again.
+			resume = false
+			if _, err := reader.Seek(0, 0); err != nil {
+				return err
+			}
+		}
+	} else {
+		// the local copy is not a prefix of this file, start over.
+		resume = false
 	}
 
-	if r.buf.Len() == 0 {
-		if r.closed {
-			return 0, io.EOF
+	header := &tar.Header{
+		Name:     path,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		ModTime:  time.Now(),
+	}
+	setStat(header, pb)
+	if resume {
+		header.Size = size - offset
+		if header.PAXRecords == nil {
+			header.PAXRecords = make(map[string]string)
 		}
-		return 0, nil
+		header.PAXRecords[OffsetRecord] = strconv.FormatInt(offset, 10)
 	}
 
-	n, err := r.buf.Read(p)
-	if err == io.EOF && !r.closed || r.buf.Len() > 0 {
-		return n, nil
+	err = r.writer.WriteHeader(header)
+	if err != nil {
+		return err
 	}
 
-	return n, err
+	_, err = io.Copy(r.writer, reader)
+	return err
 }
 
-func (r *Reader) signal() {
-	r.signalChan <- struct{}{}
+// setStat sets the mode and mtime of h to those recorded in pb, if it has
+// them, and marks h with a StatRecord.
+func setStat(h *tar.Header, pb *upb.Data) {
+	if pb.Mode == nil || pb.Mtime == nil {
+		return
+	}
+	h.Mode = int64(pb.GetMode())
+	h.ModTime = time.Unix(pb.GetMtime(), 0)
+	if h.PAXRecords == nil {
+		h.PAXRecords = make(map[string]string)
+	}
+	h.PAXRecords[StatRecord] = "1"
 }
 
-func (r *Reader) flush() {
-	r.signal()
-	<-r.signalChan
+func (r *Reader) Read(p []byte) (int, error) {
+	return r.pipe.Read(p)
 }
 
-func (r *Reader) emitError(err error) {
-	r.err = err
-	r.signal()
+// Close stops producing the archive. Reading after Close returns
+// io.ErrClosedPipe.
+func (r *Reader) Close() error {
+	err := r.pipe.Close()
+	r.cancel()
+	return err
 }
 
-func (r *Reader) close() {
-	r.closed = true
-	defer r.signal()
-	err := r.writer.Close()
-	if err != nil {
-		r.emitError(err)
-		return
+// close finishes the archive, flushing its trailers.
+func (r *Reader) close() error {
+	if err := r.writer.Close(); err != nil {
+		return err
 	}
 	if r.gzipWriter != nil {
-		err = r.gzipWriter.Close()
-		if err != nil {
-			r.emitError(err)
-			return
-		}
-	}
-}
-
-func (r *Reader) syncCopy(reader io.Reader) error {
-	buf := make([]byte, 32*1024)
-	for {
-		nr, err := reader.Read(buf)
-		if nr > 0 {
-			_, err := r.writer.Write(buf[:nr])
-			if err != nil {
-				return err
-			}
-			r.flush()
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
+		return r.gzipWriter.Close()
 	}
 	return nil
 }
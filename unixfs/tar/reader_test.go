@@ -0,0 +1,447 @@
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"testing"
+	"time"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	"github.com/ipfs/go-ipfs/importer"
+	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	path "github.com/ipfs/go-ipfs/path"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	hamt "github.com/ipfs/go-ipfs/unixfs/hamt"
+	u "github.com/ipfs/go-ipfs/util"
+)
+
+func buildFile(t *testing.T, size int64) ([]byte, *mdag.Node, mdag.DAGService) {
+	data, err := ioutil.ReadAll(io.LimitReader(u.NewTimeSeededRand(), size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := mdtest.Mock(t)
+	nd, err := importer.BuildDagFromReader(bytes.NewReader(data), ds, chunk.DefaultSplitter, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, nd, ds
+}
+
+func TestReaderRoundTrip(t *testing.T) {
+	data, nd, ds := buildFile(t, 1024*1024)
+
+	for _, compression := range []int{gzip.NoCompression, gzip.BestSpeed} {
+		r, err := NewReader(context.Background(), path.Path("/ipfs/QmFoo/file"), ds, nd, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var src io.Reader = r
+		if compression != gzip.NoCompression {
+			src, err = gzip.NewReader(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tr := tar.NewReader(src)
+		h, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name != "file" || h.Size != int64(len(data)) {
+			t.Fatalf("unexpected header: %s %d", h.Name, h.Size)
+		}
+		out, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatal("archived data differs from the file")
+		}
+		if _, err := tr.Next(); err != io.EOF {
+			t.Fatalf("expected end of archive, got %v", err)
+		}
+	}
+}
+
+func TestReaderResume(t *testing.T) {
+	data, nd, ds := buildFile(t, 1024*1024)
+
+	h, err := HashPrefix(bytes.NewReader(data[:300000]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offsets := map[string]Resume{"file": {Offset: 300000, Hash: h}}
+	hdr, out := readResumed(t, nd, ds, offsets)
+	if hdr.PAXRecords[OffsetRecord] != "300000" {
+		t.Fatalf("expected offset record, got %v", hdr.PAXRecords)
+	}
+	if !bytes.Equal(out, data[300000:]) {
+		t.Fatal("resumed data differs from the end of the file")
+	}
+}
+
+func TestReaderResumeChanged(t *testing.T) {
+	data, nd, ds := buildFile(t, 1024*1024)
+
+	// the bytes downloaded are as many, but not those of the file
+	local := append([]byte(nil), data[:300000]...)
+	local[1234] ^= 0xff
+	h, err := HashPrefix(bytes.NewReader(local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, res := range map[string]Resume{
+		"changed":  {Offset: 300000, Hash: h},
+		"no hash":  {Offset: 300000},
+		"too long": {Offset: int64(len(data)) + 1, Hash: h},
+		"negative": {Offset: -1, Hash: h},
+	} {
+		hdr, out := readResumed(t, nd, ds, map[string]Resume{"file": res})
+		if _, ok := hdr.PAXRecords[OffsetRecord]; ok {
+			t.Fatalf("%s: expected the file written whole, got offset record %v", name, hdr.PAXRecords)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatalf("%s: expected the whole file", name)
+		}
+	}
+}
+
+// readResumed returns the header and data of the file entry of the archive
+// of nd resumed from offsets.
+func readResumed(t *testing.T, nd *mdag.Node, ds mdag.DAGService, offsets map[string]Resume) (*tar.Header, []byte) {
+	r, err := NewTarReader(context.Background(), []Entry{{Path: path.Path("/ipfs/QmFoo/file"), Node: nd}}, ds, gzip.NoCompression, offsets, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	tr := tar.NewReader(r)
+	h, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, out
+}
+
+func TestReaderEntries(t *testing.T) {
+	data, nd, ds := buildFile(t, 64*1024)
+
+	entries := []Entry{
+		{Path: path.Path("/ipfs/QmFoo/a"), Node: nd},
+		{Path: path.Path("/ipfs/QmBar/b"), Err: errors.New("not found")},
+		{Path: path.Path("/ipfs/QmBaz/c"), Node: nd},
+	}
+	r, err := NewTarReader(context.Background(), entries, ds, gzip.NoCompression, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(r)
+	for _, name := range []string{"a", "b.error", "c"} {
+		h, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name != name {
+			t.Fatalf("expected entry %s, got %s", name, h.Name)
+		}
+		out, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "b.error" {
+			if h.PAXRecords[ErrorRecord] != "not found" || string(out) != "not found\n" {
+				t.Fatalf("unexpected error entry: %v %q", h.PAXRecords, out)
+			}
+		} else if !bytes.Equal(out, data) {
+			t.Fatalf("archived data of %s differs from the file", name)
+		}
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Fatalf("expected end of archive, got %v", err)
+	}
+
+	size, err := TotalSize(context.Background(), entries, ds, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != uint64(2*len(data)) {
+		t.Fatalf("expected total size %d, got %d", 2*len(data), size)
+	}
+}
+
+func TestReaderLinks(t *testing.T) {
+	data, nd, ds := buildFile(t, 64*1024)
+
+	sdata, err := ft.SymlinkData("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := &mdag.Node{Data: ft.FolderPBData()}
+	children := []struct {
+		name string
+		node *mdag.Node
+	}{
+		{"a", nd},
+		{"b", nd},
+		{"c", &mdag.Node{Data: sdata}},
+	}
+	for _, c := range children {
+		if _, err := ds.Add(c.node); err != nil {
+			t.Fatal(err)
+		}
+		if err := dir.AddNodeLink(c.name, c.node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := []Entry{{Path: path.Path("/ipfs/QmFoo/dir"), Node: dir}}
+	r, err := NewTarReader(context.Background(), entries, ds, gzip.NoCompression, nil, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(r)
+	expected := []struct {
+		name     string
+		typeflag byte
+		linkname string
+	}{
+		{"dir", tar.TypeDir, ""},
+		{"dir/a", tar.TypeReg, ""},
+		{"dir/b", tar.TypeLink, "dir/a"},
+		{"dir/c", tar.TypeSymlink, "a"},
+	}
+	for _, e := range expected {
+		h, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name != e.name || h.Typeflag != e.typeflag || h.Linkname != e.linkname {
+			t.Fatalf("expected %s (%c) -> %q, got %s (%c) -> %q", e.name, e.typeflag, e.linkname, h.Name, h.Typeflag, h.Linkname)
+		}
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Fatalf("expected end of archive, got %v", err)
+	}
+
+	size, err := TotalSize(context.Background(), entries, ds, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != uint64(len(data)) {
+		t.Fatalf("expected total size %d, got %d", len(data), size)
+	}
+}
+
+func TestReaderStat(t *testing.T) {
+	_, nd, ds := buildFile(t, 1024)
+
+	mtime := time.Unix(981173106, 0)
+	data, err := ft.SetStat(nd.Data, 0750, mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd = nd.Copy()
+	nd.Data = data
+
+	r, err := NewReader(context.Background(), path.Path("/ipfs/QmFoo/file"), ds, nd, gzip.NoCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := tar.NewReader(r).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Mode != 0750 || !h.ModTime.Equal(mtime) {
+		t.Fatalf("expected mode 0750 and mtime %s, got %o and %s", mtime, h.Mode, h.ModTime)
+	}
+	if _, ok := h.PAXRecords[StatRecord]; !ok {
+		t.Fatal("expected a stat record")
+	}
+}
+
+// A slow consumer reading in small pieces must not make the archive pile
+// up in memory. The file spans many DagReader prefetch windows, so only
+// the window may be held at a time.
+func TestReaderBoundedMemory(t *testing.T) {
+	const size = 64 * 1024 * 1024
+	_, nd, ds := buildFile(t, size)
+
+	r, err := NewReader(context.Background(), path.Path("/ipfs/QmFoo/file"), ds, nd, gzip.NoCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	heap := func() uint64 {
+		var ms runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&ms)
+		return ms.HeapAlloc
+	}
+
+	base := heap()
+	var peak uint64
+	buf := make([]byte, 512)
+	for read := 0; ; {
+		n, err := r.Read(buf)
+		read += n
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if read%(1024*1024) < n {
+			if h := heap(); h > peak {
+				peak = h
+			}
+		}
+	}
+
+	if peak > base && peak-base > size/4 {
+		t.Fatalf("heap grew by %d bytes while reading a %d byte archive", peak-base, size)
+	}
+}
+
+func TestReaderCancel(t *testing.T) {
+	_, nd, ds := buildFile(t, 1024*1024)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := NewReader(ctx, path.Path("/ipfs/QmFoo/file"), ds, nd, gzip.NoCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tar.NewReader(r).Next(); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	time.Sleep(time.Millisecond * 10)
+	if _, err := ioutil.ReadAll(r); err != context.Canceled {
+		t.Fatalf("expected the archive to fail once cancelled, got %v", err)
+	}
+}
+
+func TestReaderGoroutinesEnd(t *testing.T) {
+	_, nd, ds := buildFile(t, 256*1024)
+	base := runtime.NumGoroutine()
+
+	// read to the end, and closed without reading, with contexts which
+	// are never done
+	r, err := NewReader(context.Background(), path.Path("/ipfs/QmFoo/file"), ds, nd, gzip.NoCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	r, err = NewReader(context.Background(), path.Path("/ipfs/QmFoo/file"), ds, nd, gzip.NoCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	for i := 0; runtime.NumGoroutine() > base; i++ {
+		if i == 100 {
+			t.Fatalf("expected the goroutines of the readers to end, %d left of them", runtime.NumGoroutine()-base)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestReaderWalksDirs archives a directory holding a sharded one, whose
+// entries are those archived rather than the links of its shards.
+func TestReaderWalksDirs(t *testing.T) {
+	data, file, ds := buildFile(t, 1000)
+
+	shard, err := hamt.NewShard(ds, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, name := range names {
+		if err := shard.Set(context.Background(), name, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sharded, err := shard.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.Add(sharded); err != nil {
+		t.Fatal(err)
+	}
+	root := &mdag.Node{Data: ft.FolderPBData()}
+	if err := root.AddNodeLink("sharded", sharded); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLink("file", file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.Add(root); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []Entry{{Path: path.Path("/ipfs/QmFoo/root"), Node: root}}
+	size, err := TotalSize(context.Background(), entries, ds, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != uint64(len(data)*(len(names)+1)) {
+		t.Fatalf("expected the size of %d files, got %d", len(names)+1, size)
+	}
+
+	r, err := NewTarReader(context.Background(), entries, ds, gzip.NoCompression, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			out, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, data) {
+				t.Fatalf("%s differs from the file", h.Name)
+			}
+		}
+		got[h.Name] = true
+	}
+	expected := []string{"root", "root/file", "root/sharded"}
+	for _, name := range names {
+		expected = append(expected, "root/sharded/"+name)
+	}
+	for _, name := range expected {
+		if !got[name] {
+			t.Errorf("expected %s in the archive, got %v", name, got)
+		}
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d entries, got %v", len(expected), got)
+	}
+}
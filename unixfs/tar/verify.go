@@ -0,0 +1,271 @@
+package tar
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	ft "github.com/ipfs/go-ipfs/unixfs"
+	upb "github.com/ipfs/go-ipfs/unixfs/pb"
+)
+
+// BlocksRecord is the PAX record set on the entry listing the blocks of
+// the file entry after it, in archives made to verify the files. Its
+// value is the hash of the file. The entry is named <name>.blocks, and
+// holds a line per block with data of the file, in order: the hash of
+// the block, the size of the data, the hex of the bytes of the block
+// before and after the data, and the size of the zeros of its hole. The
+// file can then be checked against the hashes without the blocks
+// themselves.
+const BlocksRecord = "IPFS.blocks"
+
+// FileBlock is a block holding data of a file.
+type FileBlock struct {
+	Hash key.Key
+	Size int64
+	// Before and After are the bytes of the block around the data.
+	Before, After []byte
+	// Hole is the size of the zeros after the data, which the block
+	// records rather than holds (see unixfs.HoleSize).
+	Hole int64
+}
+
+// check returns whether data is the data of b, and b records its hole.
+func (b FileBlock) check(data []byte) error {
+	enc := make([]byte, 0, len(b.Before)+len(data)+len(b.After))
+	enc = append(append(append(enc, b.Before...), data...), b.After...)
+	h, err := blocks.SumLike(enc, mh.Multihash(b.Hash))
+	if err != nil {
+		return err
+	}
+	if key.Key(h) != b.Hash {
+		return fmt.Errorf("data does not hash to block %s", b.Hash)
+	}
+
+	nd, err := mdag.Decoded(enc)
+	if err != nil {
+		return err
+	}
+	pb, err := ft.FromBytes(nd.Data)
+	if err != nil {
+		return err
+	}
+	if int64(ft.HoleSize(pb)) != b.Hole {
+		return fmt.Errorf("block %s does not record a hole of %d bytes", b.Hash, b.Hole)
+	}
+	return nil
+}
+
+// fileBlocks appends the blocks holding the data of the file dagnode, of
+// hash k, to out, in the order a DagReader reads them. top is whether
+// dagnode is the root of the file.
+func fileBlocks(ctx context.Context, dag mdag.DAGService, dagnode *mdag.Node, k key.Key, top bool, out []FileBlock) ([]FileBlock, error) {
+	pb := new(upb.Data)
+	if err := proto.Unmarshal(dagnode.Data, pb); err != nil {
+		return nil, err
+	}
+
+	switch pb.GetType() {
+	case upb.Data_File, upb.Data_Raw:
+	case upb.Data_Metadata:
+		if !top || len(dagnode.Links) == 0 {
+			return nil, errors.New("incorrectly formatted metadata object")
+		}
+		child, err := dagnode.Links[0].GetNode(ctx, dag)
+		if err != nil {
+			return nil, err
+		}
+		return fileBlocks(ctx, dag, child, key.Key(dagnode.Links[0].Hash), true, out)
+	default:
+		return nil, ft.ErrUnrecognizedType
+	}
+
+	if data, hole := pb.GetData(), ft.HoleSize(pb); len(data) > 0 || hole > 0 {
+		b, err := fileBlock(dagnode, k, data, int64(hole))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	if pb.GetType() == upb.Data_Raw && !top {
+		return out, nil
+	}
+
+	keys := make([]key.Key, len(dagnode.Links))
+	for i, lnk := range dagnode.Links {
+		keys[i] = key.Key(lnk.Hash)
+	}
+	for i, ng := range dag.GetNodes(ctx, keys) {
+		child, err := ng.Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		out, err = fileBlocks(ctx, dag, child, keys[i], false, out)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// fileBlock returns the FileBlock of dagnode, of hash k, holding data and
+// a hole of hole bytes.
+func fileBlock(dagnode *mdag.Node, k key.Key, data []byte, hole int64) (FileBlock, error) {
+	enc, err := dagnode.Encoded(false)
+	if err != nil {
+		return FileBlock{}, err
+	}
+	i := bytes.Index(enc, data)
+	if i < 0 {
+		return FileBlock{}, fmt.Errorf("block %s does not hold its data", k)
+	}
+	b := FileBlock{
+		Hash:   k,
+		Size:   int64(len(data)),
+		Before: enc[:i],
+		After:  enc[i+len(data):],
+		Hole:   hole,
+	}
+	if err := b.check(data); err != nil {
+		return FileBlock{}, fmt.Errorf("block %s can't be verified: its encoding differs", k)
+	}
+	return b, nil
+}
+
+// writeBlockList writes the entry listing the blocks of the file dagnode,
+// named path in the archive.
+func (r *Reader) writeBlockList(dagnode *mdag.Node, path string) error {
+	k, err := dagnode.Key()
+	if err != nil {
+		return err
+	}
+	bs, err := fileBlocks(r.ctx, r.dag, dagnode, k, true, nil)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, b := range bs {
+		fmt.Fprintf(&buf, "%s %d %x %x %d\n", b.Hash.B58String(), b.Size, b.Before, b.After, b.Hole)
+	}
+	err = r.writer.WriteHeader(&tar.Header{
+		Name:       path + ".blocks",
+		Size:       int64(buf.Len()),
+		Typeflag:   tar.TypeReg,
+		Mode:       0644,
+		ModTime:    time.Now(),
+		PAXRecords: map[string]string{BlocksRecord: k.B58String()},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(r.writer)
+	return err
+}
+
+// ParseBlockList returns the blocks listed by the contents of an entry
+// carrying a BlocksRecord.
+func ParseBlockList(list io.Reader) ([]FileBlock, error) {
+	var bs []FileBlock
+	s := bufio.NewScanner(list)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		fields := strings.Split(s.Text(), " ")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("invalid block list line %q", s.Text())
+		}
+		h, err := mh.FromB58String(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid block hash %q: %s", fields[0], err)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid block size %q", fields[1])
+		}
+		before, err := hex.DecodeString(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		after, err := hex.DecodeString(fields[3])
+		if err != nil {
+			return nil, err
+		}
+		hole, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil || hole < 0 {
+			return nil, fmt.Errorf("invalid hole size %q", fields[4])
+		}
+		bs = append(bs, FileBlock{Hash: key.Key(h), Size: size, Before: before, After: after, Hole: hole})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+// VerifyFile checks that the data read from r is that of the blocks bs,
+// and nothing more.
+func VerifyFile(r io.Reader, bs []FileBlock) error {
+	var offset int64
+	for _, b := range bs {
+		data := make([]byte, b.Size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return fmt.Errorf("file ends at %d, before the data of block %s", offset, b.Hash)
+			}
+			return err
+		}
+		if err := b.check(data); err != nil {
+			return fmt.Errorf("bytes %d to %d: %s", offset, offset+b.Size, err)
+		}
+		offset += b.Size
+
+		if b.Hole > 0 {
+			n, err := io.Copy(zeroChecker{}, io.LimitReader(r, b.Hole))
+			if err != nil {
+				return fmt.Errorf("bytes %d to %d: %s", offset, offset+b.Hole, err)
+			}
+			if n < b.Hole {
+				return fmt.Errorf("file ends at %d, before the hole of block %s", offset+n, b.Hash)
+			}
+			offset += b.Hole
+		}
+	}
+
+	n, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("file has %d bytes past the data of its blocks", n)
+	}
+	return nil
+}
+
+var errNotZero = errors.New("data is not the zeros of a hole")
+
+// zeroChecker fails to write anything but zeros.
+type zeroChecker struct{}
+
+func (zeroChecker) Write(p []byte) (int, error) {
+	for i, c := range p {
+		if c != 0 {
+			return i, errNotZero
+		}
+	}
+	return len(p), nil
+}
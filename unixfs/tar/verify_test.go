@@ -0,0 +1,101 @@
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	"github.com/ipfs/go-ipfs/importer"
+	chunk "github.com/ipfs/go-ipfs/importer/chunk"
+	mdtest "github.com/ipfs/go-ipfs/merkledag/test"
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+// readVerified returns the block list and data of the single file of an
+// archive made with verify.
+func readVerified(t *testing.T, r io.Reader) ([]FileBlock, []byte) {
+	tr := tar.NewReader(r)
+	h, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Name != "file.blocks" || h.PAXRecords[BlocksRecord] == "" {
+		t.Fatalf("expected the block list first, got %s", h.Name)
+	}
+	bs, err := ParseBlockList(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err = tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Name != "file" {
+		t.Fatalf("expected the file after its block list, got %s", h.Name)
+	}
+	data, err := ioutil.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs, data
+}
+
+func TestVerifyFile(t *testing.T) {
+	data, nd, ds := buildFile(t, 1024*1024)
+
+	entries := []Entry{{Path: path.Path("/ipfs/QmFoo/file"), Node: nd}}
+	r, err := NewTarReader(context.Background(), entries, ds, gzip.NoCompression, nil, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, out := readVerified(t, r)
+	if len(bs) < 2 {
+		t.Fatalf("expected the blocks of the file to be listed, got %d", len(bs))
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatal("archived data differs from the file")
+	}
+
+	if err := VerifyFile(bytes.NewReader(data), bs); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	if err := VerifyFile(bytes.NewReader(corrupt), bs); err == nil {
+		t.Fatal("expected corrupt data to fail")
+	}
+	if err := VerifyFile(bytes.NewReader(data[:len(data)-1]), bs); err == nil {
+		t.Fatal("expected truncated data to fail")
+	}
+	if err := VerifyFile(bytes.NewReader(append(data, 'x')), bs); err == nil {
+		t.Fatal("expected extra data to fail")
+	}
+}
+
+func TestVerifyTrickleFile(t *testing.T) {
+	data, err := ioutil.ReadAll(io.LimitReader(bytes.NewReader(bytes.Repeat([]byte("trickle"), 200000)), 1024*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := mdtest.Mock(t)
+	nd, err := importer.BuildTrickleDagFromReader(bytes.NewReader(data), ds, &chunk.SizeSplitter{Size: 4096}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewTarReader(context.Background(), []Entry{{Path: path.Path("/ipfs/QmFoo/file"), Node: nd}}, ds, gzip.NoCompression, nil, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, out := readVerified(t, r)
+	if err := VerifyFile(bytes.NewReader(out), bs); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,114 @@
+package tar
+
+import (
+	gopath "path"
+	"time"
+
+	proto "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/gogo/protobuf/proto"
+	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+	traverse "github.com/ipfs/go-ipfs/merkledag/traverse"
+	uio "github.com/ipfs/go-ipfs/unixfs/io"
+	upb "github.com/ipfs/go-ipfs/unixfs/pb"
+)
+
+// entryFetchTimeout is how long to wait for the node of each entry.
+const entryFetchTimeout = time.Minute
+
+// walkEntries calls fn on dagnode, named path, and if it's a directory,
+// on each of its entries in turn, depth first, with their paths. The
+// entries of a directory are fetched in parallel.
+func walkEntries(ctx context.Context, dag mdag.DAGService, dagnode *mdag.Node, path string, fn func(nd *mdag.Node, path string) error) error {
+	root, err := dirEntries(ctx, dag, dagnode)
+	if err != nil {
+		return err
+	}
+
+	// the paths of the node visited and of its parents, by depth
+	paths := []string{path}
+	return traverse.Traverse(root, traverse.Options{
+		DAG:          entriesDAG{dag},
+		Order:        traverse.DFSPre,
+		Concurrency:  -1,
+		Ctx:          ctx,
+		FetchTimeout: entryFetchTimeout,
+		LinkFunc: func(from traverse.State, l *mdag.Link) (bool, error) {
+			// the links of files are their blocks, not entries
+			return isDir(from.Node), nil
+		},
+		Func: func(st traverse.State) error {
+			if st.Depth > 0 {
+				paths = append(paths[:st.Depth], gopath.Join(paths[st.Depth-1], st.Link.Name))
+			}
+			return fn(st.Node, paths[st.Depth])
+		},
+	})
+}
+
+// entriesDAG gets the nodes of directories, sharded or not, with links to
+// their entries in place of their own, for Traverse to walk the entries
+// of directories rather than the links of their nodes. Other nodes are
+// got as they are.
+type entriesDAG struct {
+	mdag.DAGService
+}
+
+func (d entriesDAG) Get(ctx context.Context, k key.Key) (*mdag.Node, error) {
+	nd, err := d.DAGService.Get(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	return dirEntries(ctx, d.DAGService, nd)
+}
+
+func (d entriesDAG) GetNodes(ctx context.Context, keys []key.Key) []mdag.NodeGetter {
+	getters := d.DAGService.GetNodes(ctx, keys)
+	for i, g := range getters {
+		getters[i] = entriesGetter{NodeGetter: g, dag: d.DAGService}
+	}
+	return getters
+}
+
+type entriesGetter struct {
+	mdag.NodeGetter
+	dag mdag.DAGService
+}
+
+func (g entriesGetter) Get(ctx context.Context) (*mdag.Node, error) {
+	nd, err := g.NodeGetter.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return dirEntries(ctx, g.dag, nd)
+}
+
+// dirEntries returns nd, or if it's a directory, a node with its data and
+// links to its entries.
+func dirEntries(ctx context.Context, dag mdag.DAGService, nd *mdag.Node) (*mdag.Node, error) {
+	if !isDir(nd) {
+		return nd, nil
+	}
+	links, err := uio.DirLinks(ctx, nd, dag)
+	if err != nil {
+		return nil, err
+	}
+	entries := &mdag.Node{Data: nd.Data, Links: make([]*mdag.Link, len(links))}
+	for i, l := range links {
+		// without the nodes they may hold, so that the nodes got are
+		// those of entriesDAG
+		entries.Links[i] = &mdag.Link{Name: l.Name, Size: l.Size, Hash: l.Hash}
+	}
+	return entries, nil
+}
+
+// isDir returns whether nd is a unixfs directory, sharded or not.
+func isDir(nd *mdag.Node) bool {
+	pb := new(upb.Data)
+	if err := proto.Unmarshal(nd.Data, pb); err != nil {
+		return false
+	}
+	typ := pb.GetType()
+	return typ == upb.Data_Directory || typ == upb.Data_HAMTShard
+}
@@ -0,0 +1,78 @@
+package tar
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	mdag "github.com/ipfs/go-ipfs/merkledag"
+)
+
+// NewZipReader is like NewTarReader, but produces a ZIP archive, and
+// can't resume. Files are stored uncompressed, or deflated when
+// compression is a gzip level other than gzip.NoCompression.
+func NewZipReader(ctx context.Context, entries []Entry, dag mdag.DAGService, compression int) (*Reader, error) {
+	pr, pw := io.Pipe()
+	zw := &zipWriter{zip: zip.NewWriter(pw), method: zip.Store}
+	if compression != gzip.NoCompression {
+		zw.method = zip.Deflate
+		zw.zip.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, compression)
+		})
+	}
+
+	reader := &Reader{
+		dag:    dag,
+		writer: zw,
+	}
+	reader.start(ctx, pr, pw, entries)
+	return reader, nil
+}
+
+// zipWriter adapts a zip.Writer to the tar headers a Reader writes.
+type zipWriter struct {
+	zip    *zip.Writer
+	method uint16
+	cur    io.Writer
+}
+
+func (zw *zipWriter) WriteHeader(h *tar.Header) error {
+	fh := &zip.FileHeader{
+		Name:   h.Name,
+		Method: zw.method,
+	}
+	fh.SetModTime(h.ModTime)
+	fh.SetMode(h.FileInfo().Mode())
+	if h.Typeflag == tar.TypeDir {
+		fh.Name = strings.TrimSuffix(fh.Name, "/") + "/"
+		fh.Method = zip.Store
+	}
+
+	if h.Typeflag == tar.TypeSymlink {
+		// zip keeps the target of a symlink as its contents.
+		fh.Method = zip.Store
+	}
+
+	w, err := zw.zip.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	zw.cur = w
+	if h.Typeflag == tar.TypeSymlink {
+		_, err = io.WriteString(w, h.Linkname)
+	}
+	return err
+}
+
+func (zw *zipWriter) Write(p []byte) (int, error) {
+	return zw.cur.Write(p)
+}
+
+func (zw *zipWriter) Close() error {
+	return zw.zip.Close()
+}
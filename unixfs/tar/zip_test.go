@@ -0,0 +1,56 @@
+package tar
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	path "github.com/ipfs/go-ipfs/path"
+)
+
+func TestZipReader(t *testing.T) {
+	data, nd, ds := buildFile(t, 512*1024)
+
+	for _, compression := range []int{gzip.NoCompression, gzip.DefaultCompression} {
+		r, err := NewZipReader(context.Background(), []Entry{{Path: path.Path("/ipfs/QmFoo/file"), Node: nd}}, ds, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archive, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(zr.File) != 1 || zr.File[0].Name != "file" {
+			t.Fatalf("unexpected entries: %v", zr.File)
+		}
+		expected := zip.Store
+		if compression != gzip.NoCompression {
+			expected = zip.Deflate
+		}
+		if zr.File[0].Method != expected {
+			t.Fatalf("expected method %d, got %d", expected, zr.File[0].Method)
+		}
+
+		f, err := zr.File[0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatal("zipped data differs from the file")
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package updates
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strings"
+
+	semver "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/coreos/go-semver/semver"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	config "github.com/ipfs/go-ipfs/repo/config"
+)
+
+// A distribution is a directory on ipfs, at Version.DistPath, with a
+// "versions" file listing the released versions, one per line, and a
+// directory for each, with the binaries of each platform:
+//
+//   versions
+//   v0.4.0/go-ipfs_v0.4.0_linux-amd64.tar.gz
+//   v0.4.0/go-ipfs_v0.4.0_linux-amd64.tar.gz.sig
+//
+// The .sig file next to a binary holds the signature, by the key of the
+// distribution, of the multihash of the binary, so checking it doesn't
+// take fetching the binary.
+
+// maxSigSize bounds the signature files read.
+const maxSigSize = 4096
+
+var (
+	ErrNoDistPath    = errors.New("no distribution to check: Version.DistPath is not set")
+	ErrBadSignature  = errors.New("the signature of the release doesn't match the key of the distribution")
+	ErrNoDistPubKey  = errors.New("no key to verify releases with: set Version.DistPubKey, or Version.AllowUnverified to skip verifying")
+	errEmptyVersions = errors.New("the distribution lists no versions")
+)
+
+// Dist reads a distribution off ipfs.
+type Dist interface {
+	// Cat returns the contents of the file at p.
+	Cat(ctx context.Context, p string) (io.Reader, error)
+	// Resolve returns the key of the object at p.
+	Resolve(ctx context.Context, p string) (key.Key, error)
+}
+
+// Release is a release of go-ipfs in a distribution.
+type Release struct {
+	Version string
+	// Path is the path of the binary for this platform, and Hash its hash.
+	Path string
+	Hash string
+	// Verified is whether the signature of the binary was checked against
+	// the key of the distribution. It is only false with
+	// Version.AllowUnverified set and no key.
+	Verified bool
+}
+
+// CheckDist looks for a release newer than the running version in the
+// distribution cfg names. It returns ErrNoUpdateAvailable if there is
+// none, and ErrBadSignature if the newest one isn't signed by the key of
+// the distribution: Version.DistPubKey, or config.DefaultDistPubKey. With
+// neither, it returns ErrNoDistPubKey, unless Version.AllowUnverified is
+// set. An external tool can then fetch the binary and install it.
+func CheckDist(ctx context.Context, d Dist, cfg config.Version) (*Release, error) {
+	if cfg.DistPath == "" {
+		return nil, ErrNoDistPath
+	}
+	pubkey := cfg.DistPubKey
+	if pubkey == "" {
+		pubkey = config.DefaultDistPubKey
+	}
+	if pubkey == "" && !cfg.AllowUnverified {
+		return nil, ErrNoDistPubKey
+	}
+	distPath := strings.TrimSuffix(cfg.DistPath, "/")
+
+	r, err := d.Cat(ctx, distPath+"/versions")
+	if err != nil {
+		return nil, fmt.Errorf("reading the versions of the distribution: %s", err)
+	}
+	latest, err := latestVersion(r)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := versionIsNewer(latest.String())
+	if err != nil {
+		return nil, err
+	}
+	if !newer {
+		return nil, ErrNoUpdateAvailable
+	}
+
+	ver := "v" + latest.String()
+	rel := &Release{
+		Version: latest.String(),
+		Path:    fmt.Sprintf("%s/%s/go-ipfs_%s_%s-%s.tar.gz", distPath, ver, ver, runtime.GOOS, runtime.GOARCH),
+	}
+	k, err := d.Resolve(ctx, rel.Path)
+	if err != nil {
+		return nil, fmt.Errorf("no binary of %s for %s-%s: %s", ver, runtime.GOOS, runtime.GOARCH, err)
+	}
+	rel.Hash = k.B58String()
+
+	if pubkey == "" {
+		log.Warningf("NOT verifying release %s: there is no key for the distribution and Version.AllowUnverified is set", rel.Version)
+		return rel, nil
+	}
+	if err := verifyRelease(ctx, d, rel.Path, k, pubkey); err != nil {
+		return nil, err
+	}
+	rel.Verified = true
+	return rel, nil
+}
+
+// latestVersion returns the newest of the versions r lists. Lines that
+// aren't versions are skipped.
+func latestVersion(r io.Reader) (*semver.Version, error) {
+	var latest *semver.Version
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimPrefix(strings.TrimSpace(s.Text()), "v")
+		if line == "" {
+			continue
+		}
+		v, err := semver.NewVersion(line)
+		if err != nil {
+			log.Debugf("distribution lists an invalid version %q: %s", line, err)
+			continue
+		}
+		if latest == nil || latest.LessThan(*v) {
+			latest = v
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return nil, errEmptyVersions
+	}
+	return latest, nil
+}
+
+// verifyRelease checks the signature next to the binary at p, whose key
+// is k, with pubkey, a key as encoded in the config.
+func verifyRelease(ctx context.Context, d Dist, p string, k key.Key, pubkey string) error {
+	pkb, err := ci.ConfigDecodeKey(pubkey)
+	if err != nil {
+		return fmt.Errorf("invalid distribution key: %s", err)
+	}
+	pk, err := ci.UnmarshalPublicKey(pkb)
+	if err != nil {
+		return fmt.Errorf("invalid distribution key: %s", err)
+	}
+
+	r, err := d.Cat(ctx, p+".sig")
+	if err != nil {
+		return fmt.Errorf("reading the signature of the release: %s", err)
+	}
+	sig, err := ioutil.ReadAll(io.LimitReader(r, maxSigSize))
+	if err != nil {
+		return fmt.Errorf("reading the signature of the release: %s", err)
+	}
+
+	ok, err := pk.Verify([]byte(k), sig)
+	if err != nil || !ok {
+		return ErrBadSignature
+	}
+	return nil
+}
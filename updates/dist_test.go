@@ -0,0 +1,134 @@
+package updates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"testing"
+
+	semver "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/coreos/go-semver/semver"
+	context "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/net/context"
+
+	key "github.com/ipfs/go-ipfs/blocks/key"
+	ci "github.com/ipfs/go-ipfs/p2p/crypto"
+	config "github.com/ipfs/go-ipfs/repo/config"
+	u "github.com/ipfs/go-ipfs/util"
+	testutil "github.com/ipfs/go-ipfs/util/testutil"
+)
+
+// mapDist is a distribution of files held in a map.
+type mapDist map[string][]byte
+
+func (d mapDist) Cat(ctx context.Context, p string) (io.Reader, error) {
+	data, ok := d[p]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (d mapDist) Resolve(ctx context.Context, p string) (key.Key, error) {
+	data, ok := d[p]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return key.Key(u.Hash(data)), nil
+}
+
+func TestCheckDist(t *testing.T) {
+	var err error
+	currentVersion, err = semver.NewVersion("0.3.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sk, pk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkb, err := pk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPkb, err := otherPk.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bin := fmt.Sprintf("/ipfs/dist/v0.4.1/go-ipfs_v0.4.1_%s-%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+	d := mapDist{
+		"/ipfs/dist/versions": []byte("v0.3.4\nv0.4.1\nnot a version\nv0.4.0\n"),
+		bin:                   []byte("the binary"),
+	}
+	d[bin+".sig"] = sign(t, sk, u.Hash(d[bin]))
+
+	cfg := config.Version{DistPath: "/ipfs/dist/"}
+	if _, err := CheckDist(context.Background(), d, cfg); err != ErrNoDistPubKey {
+		t.Fatalf("expected no key to verify with, got %v", err)
+	}
+
+	cfg.AllowUnverified = true
+	rel, err := CheckDist(context.Background(), d, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Version != "0.4.1" || rel.Path != bin || rel.Hash != key.Key(u.Hash(d[bin])).B58String() || rel.Verified {
+		t.Fatalf("wrong unverified release: %+v", rel)
+	}
+
+	// the built in key is used when the config names none
+	config.DefaultDistPubKey = ci.ConfigEncodeKey(pkb)
+	defer func() { config.DefaultDistPubKey = "" }()
+	rel, err = CheckDist(context.Background(), d, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rel.Verified {
+		t.Fatal("release should be verified with the built in key")
+	}
+
+	config.DefaultDistPubKey = ci.ConfigEncodeKey(otherPkb)
+	if _, err := CheckDist(context.Background(), d, cfg); err != ErrBadSignature {
+		t.Fatalf("expected a bad signature with the built in key, got %v", err)
+	}
+
+	// and the config key over it
+	cfg.AllowUnverified = false
+	cfg.DistPubKey = ci.ConfigEncodeKey(pkb)
+	rel, err = CheckDist(context.Background(), d, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rel.Verified {
+		t.Fatal("release should be verified")
+	}
+	config.DefaultDistPubKey = ""
+
+	cfg.DistPubKey = ci.ConfigEncodeKey(otherPkb)
+	if _, err := CheckDist(context.Background(), d, cfg); err != ErrBadSignature {
+		t.Fatalf("expected a bad signature, got %v", err)
+	}
+
+	currentVersion, _ = semver.NewVersion("0.4.1")
+	if _, err := CheckDist(context.Background(), d, cfg); err != ErrNoUpdateAvailable {
+		t.Fatalf("expected no update, got %v", err)
+	}
+
+	if _, err := CheckDist(context.Background(), d, config.Version{}); err != ErrNoDistPath {
+		t.Fatalf("expected no distribution, got %v", err)
+	}
+}
+
+func sign(t *testing.T, sk ci.PrivKey, data []byte) []byte {
+	sig, err := sk.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
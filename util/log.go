@@ -1,7 +1,10 @@
 package util
 
 import (
+	"io"
 	"os"
+	"sort"
+	"sync"
 
 	"github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 )
@@ -13,11 +16,13 @@ func init() {
 var log = logrus.New()
 
 // LogFormats is a map of formats used for our logger, keyed by name.
+// "json" writes each entry as a JSON object of its own line.
 // TODO: write custom TextFormatter (don't print module=name explicitly) and
 // fork logrus to add shortfile
-var LogFormats = map[string]*logrus.TextFormatter{
+var LogFormats = map[string]logrus.Formatter{
 	"nocolor": &logrus.TextFormatter{DisableColors: true, FullTimestamp: true, TimestampFormat: "2006-01-02 15:04:05.000000", DisableSorting: true},
 	"color":   &logrus.TextFormatter{DisableColors: false, FullTimestamp: true, TimestampFormat: "15:04:05:000", DisableSorting: true},
+	"json":    &logrus.JSONFormatter{TimestampFormat: "2006-01-02T15:04:05.000000Z07:00"},
 }
 var defaultLogFormat = "color"
 
@@ -27,8 +32,17 @@ const (
 	envLoggingFmt = "IPFS_LOGGING_FMT"
 )
 
-// loggers is the set of loggers in the system
-var loggers = map[string]*logrus.Entry{}
+var (
+	loggersLock sync.Mutex
+	// loggers is the set of loggers in the system. Each subsystem has a
+	// logrus.Logger of its own, for its level to be set apart from the
+	// others; they all share the output and format of log.
+	loggers = map[string]*logrus.Entry{}
+)
+
+// logTail is the hook of every logger sending its entries to the writers
+// of AddLogWriter.
+var logTail = &tailHook{}
 
 // SetupLogging will initialize the logger backend and set the flags.
 func SetupLogging() {
@@ -56,6 +70,13 @@ func SetupLogging() {
 		lvl = logrus.DebugLevel
 	}
 
+	loggersLock.Lock()
+	for _, logger := range loggers {
+		logger.Logger.Out = log.Out
+		logger.Logger.Formatter = log.Formatter
+	}
+	loggersLock.Unlock()
+
 	SetAllLoggers(lvl)
 }
 
@@ -66,9 +87,12 @@ func SetDebugLogging() {
 
 // SetAllLoggers changes the logrus.Level of all loggers to lvl
 func SetAllLoggers(lvl logrus.Level) {
+	loggersLock.Lock()
+	defer loggersLock.Unlock()
+
 	log.Level = lvl
 	for _, logger := range loggers {
-		logger.Level = lvl
+		logger.Logger.Level = lvl
 	}
 }
 
@@ -78,12 +102,34 @@ func Logger(name string) *logrus.Entry {
 		log.Warnf("Missing name parameter")
 		name = "undefined"
 	}
+
+	loggersLock.Lock()
+	defer loggersLock.Unlock()
+
 	if _, ok := loggers[name]; !ok {
-		loggers[name] = log.WithField("module", name)
+		l := logrus.New()
+		l.Out = log.Out
+		l.Formatter = log.Formatter
+		l.Level = log.Level
+		l.Hooks.Add(logTail)
+		loggers[name] = l.WithField("module", name)
 	}
 	return loggers[name]
 }
 
+// Loggers returns the names of the subsystems with a logger, sorted.
+func Loggers() []string {
+	loggersLock.Lock()
+	defer loggersLock.Unlock()
+
+	names := make([]string, 0, len(loggers))
+	for name := range loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // SetLogLevel changes the log level of a specific subsystem
 // name=="*" changes all subsystems
 func SetLogLevel(name, level string) error {
@@ -98,12 +144,63 @@ func SetLogLevel(name, level string) error {
 		return nil
 	}
 
+	loggersLock.Lock()
+	defer loggersLock.Unlock()
+
 	// Check if we have a logger by that name
 	if _, ok := loggers[name]; !ok {
 		return ErrNoSuchLogger
 	}
 
-	loggers[name].Level = lvl
+	loggers[name].Logger.Level = lvl
+
+	return nil
+}
+
+// AddLogWriter has the entries logged by every subsystem, at the levels
+// set for it, written to w too, as a JSON object on a line of its own,
+// until writing to w fails.
+func AddLogWriter(w io.Writer) {
+	logTail.lk.Lock()
+	defer logTail.lk.Unlock()
+	logTail.writers = append(logTail.writers, w)
+}
+
+type tailHook struct {
+	lk      sync.Mutex
+	writers []io.Writer
+}
+
+var tailFormatter = &logrus.JSONFormatter{TimestampFormat: "2006-01-02T15:04:05.000000Z07:00"}
+
+func (h *tailHook) Levels() []logrus.Level {
+	return []logrus.Level{
+		logrus.PanicLevel,
+		logrus.FatalLevel,
+		logrus.ErrorLevel,
+		logrus.WarnLevel,
+		logrus.InfoLevel,
+		logrus.DebugLevel,
+	}
+}
+
+func (h *tailHook) Fire(e *logrus.Entry) error {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	if len(h.writers) == 0 {
+		return nil
+	}
 
+	b, err := tailFormatter.Format(e)
+	if err != nil {
+		return nil
+	}
+	writers := h.writers[:0]
+	for _, w := range h.writers {
+		if _, err := w.Write(b); err == nil {
+			writers = append(writers, w)
+		}
+	}
+	h.writers = writers
 	return nil
 }
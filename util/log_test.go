@@ -0,0 +1,37 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSetLogLevelOfOneSubsystem(t *testing.T) {
+	a, b := Logger("test-a"), Logger("test-b")
+	if err := SetLogLevel("test-a", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetLogLevel("test-a", "error")
+
+	var buf bytes.Buffer
+	AddLogWriter(&buf)
+	a.Debug("from a")
+	b.Debug("from b")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected only the debug entry of test-a, got %q", buf.String())
+	}
+	var e map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e["module"] != "test-a" || e["msg"] != "from a" || e["level"] != "debug" {
+		t.Fatalf("unexpected entry %v", e)
+	}
+
+	if err := SetLogLevel("test-nope", "debug"); err != ErrNoSuchLogger {
+		t.Fatalf("expected ErrNoSuchLogger, got %v", err)
+	}
+}
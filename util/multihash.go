@@ -0,0 +1,76 @@
+package util
+
+import (
+	"fmt"
+
+	mh "github.com/ipfs/go-ipfs/Godeps/_workspace/src/github.com/jbenet/go-multihash"
+	sha3 "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/crypto/sha3"
+)
+
+// Multihash codes of the sha3 functions. go-multihash only knows sha3-512,
+// as "sha3"; the others are registered with it below, so that they decode
+// and print by name everywhere.
+const (
+	SHA3_512 = mh.SHA3
+	SHA3_384 = 0x15
+	SHA3_256 = 0x16
+	SHA3_224 = 0x17
+)
+
+var sha3Names = map[int]string{
+	SHA3_512: "sha3-512",
+	SHA3_384: "sha3-384",
+	SHA3_256: "sha3-256",
+	SHA3_224: "sha3-224",
+}
+
+var sha3Lengths = map[int]int{
+	SHA3_512: 64,
+	SHA3_384: 48,
+	SHA3_256: 32,
+	SHA3_224: 28,
+}
+
+func init() {
+	for code, name := range sha3Names {
+		mh.Names[name] = code
+		mh.Codes[code] = name
+		mh.DefaultLengths[code] = sha3Lengths[code]
+	}
+	// keep the old name of sha3-512 parsing
+	mh.Names["sha3"] = SHA3_512
+}
+
+// Sum hashes data with the multihash function code, truncated to length
+// bytes, or not at all if length is -1. Unlike mh.Sum, it knows all of the
+// sha3 functions.
+func Sum(data []byte, code int, length int) (mh.Multihash, error) {
+	var d []byte
+	switch code {
+	case SHA3_512:
+		a := sha3.Sum512(data)
+		d = a[:]
+	case SHA3_384:
+		a := sha3.Sum384(data)
+		d = a[:]
+	case SHA3_256:
+		a := sha3.Sum256(data)
+		d = a[:]
+	case SHA3_224:
+		a := sha3.Sum224(data)
+		d = a[:]
+	default:
+		if length > mh.DefaultLengths[code] {
+			return nil, fmt.Errorf("%s digests are at most %d bytes", mh.Codes[code], mh.DefaultLengths[code])
+		}
+		return mh.Sum(data, code, length)
+	}
+
+	if length > len(d) {
+		return nil, fmt.Errorf("%s digests are at most %d bytes", mh.Codes[code], len(d))
+	}
+	if length >= 0 {
+		d = d[:length]
+	}
+	return mh.Encode(d, code)
+}
@@ -0,0 +1,96 @@
+// Package seal encrypts data with a key derived from a passphrase, for
+// what the node writes out to be carried elsewhere: backups, keys.
+package seal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	pbkdf2 "github.com/ipfs/go-ipfs/Godeps/_workspace/src/golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	saltSize   = 16
+	iterations = 100000
+)
+
+// ErrBadPassphrase is returned when sealed data cannot be opened.
+var ErrBadPassphrase = errors.New("seal: wrong passphrase or corrupted data")
+
+// ErrNotSealed is returned when data doesn't start with the magic it was
+// expected to be sealed with.
+var ErrNotSealed = errors.New("seal: data is not sealed")
+
+// Seal encrypts plain with AES-GCM, under a key derived from passphrase
+// with PBKDF2. The result starts with magic, which tells what's sealed,
+// and is authenticated along with plain; then come the random salt and
+// nonce, and the ciphertext.
+func Seal(plain []byte, passphrase, magic string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, err := newCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(magic)
+	buf.Write(salt)
+	buf.Write(nonce)
+	buf.Write(aead.Seal(nil, nonce, plain, []byte(magic)))
+	return buf.Bytes(), nil
+}
+
+// Open decrypts data sealed with magic and passphrase.
+func Open(data []byte, passphrase, magic string) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, ErrNotSealed
+	}
+	data = data[len(magic):]
+	if len(data) < saltSize {
+		return nil, ErrBadPassphrase
+	}
+	salt, data := data[:saltSize], data[saltSize:]
+
+	aead, err := newCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, ErrBadPassphrase
+	}
+	nonce, data := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, data, []byte(magic))
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	return plain, nil
+}
+
+func newCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("seal: a passphrase is required")
+	}
+	block, err := aes.NewCipher(deriveKey(passphrase, salt, iterations))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKey derives the AES-256 key of passphrase and salt, with PBKDF2
+// and HMAC-SHA256.
+func deriveKey(passphrase string, salt []byte, iter int) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, iter, 32, sha256.New)
+}
@@ -0,0 +1,55 @@
+package seal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDeriveKeyVectors(t *testing.T) {
+	cases := []struct {
+		iter int
+		out  string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+	}
+	for _, c := range cases {
+		dk := hex.EncodeToString(deriveKey("password", []byte("salt"), c.iter))
+		if dk != c.out {
+			t.Fatalf("pbkdf2 with %d iterations: got %s, want %s", c.iter, dk, c.out)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	plain := []byte("the secret")
+	data, err := Seal(plain, "hunter2", "magic\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, plain) {
+		t.Fatal("sealed data should not contain the plaintext")
+	}
+
+	if _, err := Open(data, "wrong", "magic\n"); err != ErrBadPassphrase {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+	if _, err := Open(data, "hunter2", "other\n"); err != ErrNotSealed {
+		t.Fatalf("expected ErrNotSealed, got %v", err)
+	}
+	if _, err := Open(data[:len(data)-1], "hunter2", "magic\n"); err != ErrBadPassphrase {
+		t.Fatalf("expected ErrBadPassphrase for truncated data, got %v", err)
+	}
+	if _, err := Seal(plain, "", "magic\n"); err == nil {
+		t.Fatal("sealed without a passphrase")
+	}
+
+	out, err := Open(data, "hunter2", "magic\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, plain) {
+		t.Fatalf("opened %q, not %q", out, plain)
+	}
+}